@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/pederhe/nca/pkg/api"
+	"github.com/pederhe/nca/pkg/log"
+)
+
+// cliCommand is a node of the command tree of nca. The top-level commands run with the arguments
+// after their name, the nodes below them are the words completed after a command, like its actions
+// and flags.
+type cliCommand struct {
+	name        string
+	description string
+	run         func(args []string)
+	subcommands []cliCommand
+	// Completes the word after the node with the output of "nca completion list <kind>"
+	dynamic string
+}
+
+// Config keys completed by "nca config set", the routes of the router are added to them
+var configKeys = []string{
+	"allowed_commands", "api_base_url", "api_key", "approve_file_writes", "auto_approve",
+	"auto_approve_edits", "auto_approve_key", "auto_snapshot", "auto_snapshot_min_files",
+	"checkpoint_snapshots", "command_output_tail_kb", "command_timeout", "commit.style", "commit.template",
+	"denied_commands", "disable_stream_timeout", "env_files", "env_vars", "file_lock_mode", "hooks.append_output",
+	"hooks.post_edit", "hooks.timeout", "line_endings", "load_dotenv", "max_steps", "max_steps_prompt",
+	"mcp_cache_ttl", "mcp_mode", "mcp_resource_max_kb", "mcp_schema_token_budget", "mcp_settings_file",
+	"model", "network_access", "network_allowed_hosts", "network_blocked_hosts", "otel.endpoint",
+	"otel.headers", "otel.service_name", "profile", "provider", "repo_map", "resolve.test_command",
+	"stream_flush_ms", "summarizer_api_base_url", "summarizer_api_key", "summarizer_model",
+	"summarizer_provider", "system_prompt_file", "system_prompt_mode", "temperature", "tokenizer_file",
+	"tool_max_result_entries", "tool_protocol", "tools.disabled", "ui.answer_language", "ui.render_markdown",
+	"verify_build.command", "verify_build.timeout", "workspace.restrict_files",
+}
+
+// words returns completion nodes for words without a description
+func words(names ...string) []cliCommand {
+	nodes := make([]cliCommand, 0, len(names))
+	for _, name := range names {
+		nodes = append(nodes, cliCommand{name: name})
+	}
+	return nodes
+}
+
+// configKeyWords returns the completion nodes of the config keys
+func configKeyWords() []cliCommand {
+	keys := append([]string(nil), configKeys...)
+	for _, route := range api.Routes {
+		keys = append(keys, "router."+route)
+	}
+	return words(keys...)
+}
+
+// getCLICommands returns the command tree. It's built by a function because the completion
+// command generates its scripts from the tree.
+func getCLICommands() []cliCommand {
+	keys := configKeyWords()
+	return []cliCommand{
+		{
+			name:        "config",
+			description: "Manage configuration settings",
+			run: func(args []string) {
+				log.LogDebug(fmt.Sprintf("Config command: %v\n", args))
+				handleConfigCommand(args)
+			},
+			subcommands: append([]cliCommand{
+				{name: "set", description: "Set a setting", subcommands: keys},
+				{name: "unset", description: "Remove a setting", subcommands: keys},
+				{name: "list", description: "List the settings"},
+				{name: "profiles", description: "List or delete the profiles", subcommands: []cliCommand{
+					{name: "delete", description: "Delete a profile", dynamic: "profiles"},
+				}},
+			}, words("--global", "--profile")...),
+		},
+		{
+			name:        "commit",
+			description: "Commit all current changes with a summary of the changes",
+			run: func(args []string) {
+				log.LogDebug("Commit command detected\n")
+				runREPL("commit all current changes, and summarize the changes", nil)
+			},
+		},
+		{
+			name:        "setup",
+			description: "Choose the provider, API key and model interactively",
+			run: func(args []string) {
+				log.LogDebug("Setup command detected\n")
+				runSetup()
+			},
+		},
+		{
+			name:        "help",
+			description: "Display help information",
+			run: func(args []string) {
+				log.LogDebug("Help command detected\n")
+				displayHelp()
+			},
+		},
+		{
+			name:        "trust",
+			description: "Manage workspace trust decisions",
+			run: func(args []string) {
+				log.LogDebug(fmt.Sprintf("Trust command: %v\n", args))
+				handleTrustCommand(args)
+			},
+			subcommands: []cliCommand{
+				{name: "list", description: "List the trust decisions"},
+				{name: "revoke", description: "Revoke the trust decision of a directory"},
+			},
+		},
+		{
+			name:        "audit",
+			description: "Show the log of file writes, commands and commits",
+			run: func(args []string) {
+				log.LogDebug(fmt.Sprintf("Audit command: %v\n", args))
+				handleAuditCommand(args)
+			},
+			subcommands: []cliCommand{
+				{name: "show", description: "Show the audit log", subcommands: words("--since")},
+			},
+		},
+		{
+			name:        "debug",
+			description: "Show a debug log in a readable form",
+			run:         handleDebugCommand,
+			subcommands: []cliCommand{
+				{name: "show", description: "Show the latest or the given debug log"},
+			},
+		},
+		{
+			name:        "resolve",
+			description: "Resolve merge conflicts with the agent",
+			run: func(args []string) {
+				log.LogDebug(fmt.Sprintf("Resolve command: %v\n", args))
+				handleResolveCommand(args)
+			},
+			subcommands: words("--test"),
+		},
+		{
+			name:        "review",
+			description: "Review changes or a pull request",
+			run: func(args []string) {
+				log.LogDebug(fmt.Sprintf("Review command: %v\n", args))
+				handleReviewCommand(args)
+			},
+			subcommands: []cliCommand{
+				{name: "--staged"},
+				{name: "--format", subcommands: words("text", "markdown", "github")},
+				{name: "--post"},
+			},
+		},
+		{
+			name:        "new",
+			description: "Create a project from a template",
+			run: func(args []string) {
+				log.LogDebug(fmt.Sprintf("New command: %v\n", args))
+				handleNewCommand(args)
+			},
+			subcommands: words("--var", "--no-agent"),
+			dynamic:     "templates",
+		},
+		{
+			name:        "completion",
+			description: "Generate a shell completion script",
+			run:         handleCompletionCommand,
+			subcommands: words("bash", "zsh", "fish"),
+		},
+	}
+}
+
+// findCLICommand returns the top-level command with a name
+func findCLICommand(name string) (cliCommand, bool) {
+	for _, command := range getCLICommands() {
+		if command.name == name {
+			return command, true
+		}
+	}
+	return cliCommand{}, false
+}
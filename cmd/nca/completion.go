@@ -0,0 +1,392 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pederhe/nca/internal/core"
+	"github.com/pederhe/nca/pkg/config"
+)
+
+// Kinds of values completed after a flag, other completions are lists of words
+const (
+	completeFiles    = "files"
+	completeDirs     = "dirs"
+	completeProfiles = "profiles"
+	completeNothing  = ""
+)
+
+// flagCompletion is how the value of a flag is completed
+type flagCompletion struct {
+	kind  string
+	words []string
+}
+
+// Completions of the values of the flags, flags of commands included. Flags that take a value
+// and aren't listed here complete nothing.
+var flagValueCompletions = map[string]flagCompletion{
+	"output":             {words: []string{"text", "json"}},
+	"system-prompt-mode": {words: []string{"replace", "append"}},
+	"system-prompt-file": {kind: completeFiles},
+	"record-api":         {kind: completeFiles},
+	"replay-api":         {kind: completeFiles},
+	"workspace":          {kind: completeDirs},
+	"profile":            {kind: completeProfiles},
+	"since":              {words: []string{"24h", "7d"}},
+	"test":               {kind: completeNothing},
+	"var":                {kind: completeNothing},
+}
+
+// completionFlag is a flag of the command line
+type completionFlag struct {
+	name  string
+	usage string
+	value bool // Whether it takes a value
+}
+
+// completionPath is a sequence of words and the words completed after it
+type completionPath struct {
+	path    string // The words after "nca", separated by spaces
+	words   []cliCommand
+	dynamic string
+}
+
+// Handle the completion command, format: "nca completion bash|zsh|fish". "nca completion list
+// <kind>" prints the words of dynamic completions, the scripts call it.
+func handleCompletionCommand(args []string) {
+	if len(args) == 2 && args[0] == "list" {
+		for _, word := range completionWords(args[1]) {
+			fmt.Println(word)
+		}
+		return
+	}
+	if len(args) != 1 {
+		fmt.Println("Usage: nca completion bash|zsh|fish")
+		return
+	}
+
+	switch args[0] {
+	case "bash":
+		fmt.Print(bashCompletion())
+	case "zsh":
+		fmt.Print(zshCompletion())
+	case "fish":
+		fmt.Print(fishCompletion())
+	default:
+		fmt.Printf("Unknown shell '%s', completion scripts are available for bash, zsh and fish\n", args[0])
+	}
+}
+
+// completionWords returns the words of a dynamic completion
+func completionWords(kind string) []string {
+	var result []string
+	switch kind {
+	case completeProfiles:
+		result = config.ListProfiles()
+	case "templates":
+		for _, template := range core.ListTemplates() {
+			result = append(result, template.Name)
+		}
+	}
+	return result
+}
+
+// completionFlags returns the flags of the command line, sorted by name
+func completionFlags() []completionFlag {
+	var flags []completionFlag
+	flag.CommandLine.VisitAll(func(f *flag.Flag) {
+		boolFlag, ok := f.Value.(interface{ IsBoolFlag() bool })
+		flags = append(flags, completionFlag{name: f.Name, usage: f.Usage, value: !ok || !boolFlag.IsBoolFlag()})
+	})
+	sort.Slice(flags, func(i, j int) bool { return flags[i].name < flags[j].name })
+	return flags
+}
+
+// flagWord returns how a flag is written, "-p" or "--debug"
+func flagWord(name string) string {
+	if len(name) == 1 {
+		return "-" + name
+	}
+	return "--" + name
+}
+
+// valueFlagNames returns the flags that take a value, of the command line and of the commands
+func valueFlagNames() []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, f := range completionFlags() {
+		if f.value {
+			seen[f.name] = true
+			names = append(names, f.name)
+		}
+	}
+	for name := range flagValueCompletions {
+		if !seen[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// completionPaths returns the paths of the command tree that complete words, starting with the
+// top-level commands and the flags
+func completionPaths() []completionPath {
+	root := completionPath{words: getCLICommands()}
+	for _, f := range completionFlags() {
+		root.words = append(root.words, cliCommand{name: flagWord(f.name), description: f.usage})
+	}
+	paths := []completionPath{root}
+
+	var walk func(prefix string, commands []cliCommand)
+	walk = func(prefix string, commands []cliCommand) {
+		for _, command := range commands {
+			if len(command.subcommands) == 0 && command.dynamic == "" {
+				continue
+			}
+			path := strings.TrimSpace(prefix + " " + command.name)
+			paths = append(paths, completionPath{path: path, words: command.subcommands, dynamic: command.dynamic})
+			walk(path, command.subcommands)
+		}
+	}
+	walk("", getCLICommands())
+	return paths
+}
+
+// shellQuote quotes a word with single quotes
+func shellQuote(word string) string {
+	return "'" + strings.ReplaceAll(word, "'", `'\''`) + "'"
+}
+
+// flagPatterns returns a case pattern matching the ways a flag can be written
+func flagPatterns(name string) string {
+	return "-" + name + "|--" + name
+}
+
+// bashCompletion returns the completion script of bash
+func bashCompletion() string {
+	var b strings.Builder
+	b.WriteString(`# bash completion for nca, load it with: source <(nca completion bash)
+_nca() {
+    local cur prev word path i skip=0 words=""
+    cur="${COMP_WORDS[COMP_CWORD]}"
+    prev="${COMP_WORDS[COMP_CWORD-1]}"
+
+    # Values of flags
+    case "$prev" in
+`)
+	var valuePatterns []string
+	for _, name := range valueFlagNames() {
+		valuePatterns = append(valuePatterns, flagPatterns(name))
+		completion := flagValueCompletions[name]
+		reply := "COMPREPLY=()"
+		switch {
+		case len(completion.words) > 0:
+			reply = fmt.Sprintf(`COMPREPLY=($(compgen -W "%s" -- "$cur"))`, strings.Join(completion.words, " "))
+		case completion.kind == completeFiles:
+			reply = `COMPREPLY=($(compgen -f -- "$cur"))`
+		case completion.kind == completeDirs:
+			reply = `COMPREPLY=($(compgen -d -- "$cur"))`
+		case completion.kind == completeProfiles:
+			reply = `COMPREPLY=($(compgen -W "$(nca completion list profiles 2>/dev/null)" -- "$cur"))`
+		}
+		fmt.Fprintf(&b, "        %s) %s; return ;;\n", flagPatterns(name), reply)
+	}
+	fmt.Fprintf(&b, `    esac
+
+    # The words before the current one without the flags and their values
+    path=""
+    for ((i = 1; i < COMP_CWORD; i++)); do
+        word="${COMP_WORDS[i]}"
+        if [[ $skip == 1 ]]; then
+            skip=0
+            continue
+        fi
+        case "$word" in
+            %s) skip=1; continue ;;
+            -*) continue ;;
+        esac
+        path="${path:+$path }$word"
+    done
+
+    case "$path" in
+`, strings.Join(valuePatterns, "|"))
+	for _, path := range completionPaths() {
+		var names []string
+		for _, word := range path.words {
+			names = append(names, word.name)
+		}
+		line := fmt.Sprintf(`words="%s"`, strings.Join(names, " "))
+		if path.dynamic != "" {
+			line += fmt.Sprintf(`; words="$words $(nca completion list %s 2>/dev/null)"`, path.dynamic)
+		}
+		fmt.Fprintf(&b, "        %q) %s ;;\n", path.path, line)
+	}
+	b.WriteString(`    esac
+    COMPREPLY=($(compgen -W "$words" -- "$cur"))
+}
+complete -o default -F _nca nca
+`)
+	return b.String()
+}
+
+// zshCompletion returns the completion script of zsh
+func zshCompletion() string {
+	var b strings.Builder
+	b.WriteString(`#compdef nca
+# zsh completion for nca, load it with: source <(nca completion zsh)
+_nca() {
+    local prev=${words[CURRENT-1]} word cmdpath="" i skip=0
+    local -a candidates
+
+    # Values of flags
+    case $prev in
+`)
+	var valuePatterns []string
+	for _, name := range valueFlagNames() {
+		valuePatterns = append(valuePatterns, flagPatterns(name))
+		completion := flagValueCompletions[name]
+		action := "_message value"
+		switch {
+		case len(completion.words) > 0:
+			action = "compadd -- " + strings.Join(completion.words, " ")
+		case completion.kind == completeFiles:
+			action = "_files"
+		case completion.kind == completeDirs:
+			action = "_files -/"
+		case completion.kind == completeProfiles:
+			action = `compadd -- ${(f)"$(nca completion list profiles 2>/dev/null)"}`
+		}
+		fmt.Fprintf(&b, "        %s) %s; return ;;\n", flagPatterns(name), action)
+	}
+	fmt.Fprintf(&b, `    esac
+
+    # The words before the current one without the flags and their values
+    for ((i = 2; i < CURRENT; i++)); do
+        word=${words[i]}
+        if (( skip )); then
+            skip=0
+            continue
+        fi
+        case $word in
+            %s) skip=1; continue ;;
+            -*) continue ;;
+        esac
+        cmdpath="${cmdpath:+$cmdpath }$word"
+    done
+
+    case $cmdpath in
+`, strings.Join(valuePatterns, "|"))
+	for _, path := range completionPaths() {
+		var entries []string
+		for _, word := range path.words {
+			entry := strings.ReplaceAll(word.name, ":", `\:`)
+			if word.description != "" {
+				entry += ":" + word.description
+			}
+			entries = append(entries, shellQuote(entry))
+		}
+		line := fmt.Sprintf("candidates=(%s)", strings.Join(entries, " "))
+		if path.dynamic != "" {
+			line += fmt.Sprintf(`; candidates+=(${(f)"$(nca completion list %s 2>/dev/null)"})`, path.dynamic)
+		}
+		fmt.Fprintf(&b, "        %s) %s ;;\n", shellQuote(path.path), line)
+	}
+	b.WriteString(`    esac
+    if (( ${#candidates} )); then
+        _describe 'nca' candidates
+    else
+        _files
+    fi
+}
+if [ "$funcstack[1]" = "_nca" ]; then
+    _nca "$@"
+else
+    compdef _nca nca
+fi
+`)
+	return b.String()
+}
+
+// fishCompletion returns the completion script of fish
+func fishCompletion() string {
+	var b strings.Builder
+	var valuePatterns []string
+	for _, name := range valueFlagNames() {
+		valuePatterns = append(valuePatterns, "-"+name, "--"+name)
+	}
+	fmt.Fprintf(&b, `# fish completion for nca, load it with: nca completion fish | source
+
+# __nca_path prints the words before the current one without the flags and their values
+function __nca_path
+    set -l path
+    set -l skip 0
+    for token in (commandline -opc)[2..-1]
+        if test $skip = 1
+            set skip 0
+            continue
+        end
+        switch $token
+            case %s
+                set skip 1
+                continue
+            case '-*'
+                continue
+        end
+        set -a path $token
+    end
+    echo $path
+end
+
+function __nca_path_is
+    set -l path (__nca_path)
+    test "$path" = "$argv[1]"
+end
+
+`, strings.Join(valuePatterns, " "))
+
+	for _, path := range completionPaths() {
+		condition := fmt.Sprintf(`'__nca_path_is "%s"'`, path.path)
+		for _, word := range path.words {
+			if path.path == "" && strings.HasPrefix(word.name, "-") {
+				// Flags of the command line are completed below
+				continue
+			}
+			line := fmt.Sprintf("complete -c nca -n %s -f -a %s", condition, shellQuote(word.name))
+			if word.description != "" {
+				line += " -d " + shellQuote(word.description)
+			}
+			b.WriteString(line + "\n")
+		}
+		if path.dynamic != "" {
+			fmt.Fprintf(&b, "complete -c nca -n %s -f -a '(nca completion list %s 2>/dev/null)'\n", condition, path.dynamic)
+		}
+	}
+
+	b.WriteString("\n")
+	for _, f := range completionFlags() {
+		line := "complete -c nca -l " + f.name
+		if len(f.name) == 1 {
+			line = "complete -c nca -s " + f.name
+		}
+		if f.value {
+			completion := flagValueCompletions[f.name]
+			switch {
+			case len(completion.words) > 0:
+				line += " -x -a " + shellQuote(strings.Join(completion.words, " "))
+			case completion.kind == completeFiles:
+				line += " -r -F"
+			case completion.kind == completeDirs:
+				line += " -x -a '(__fish_complete_directories)'"
+			case completion.kind == completeProfiles:
+				line += " -x -a '(nca completion list profiles 2>/dev/null)'"
+			default:
+				line += " -x"
+			}
+		}
+		b.WriteString(line + " -d " + shellQuote(f.usage) + "\n")
+	}
+	return b.String()
+}
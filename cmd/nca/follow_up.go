@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/pederhe/nca/pkg/log"
+	"github.com/pederhe/nca/pkg/utils"
+)
+
+// Lines typed while a task runs in the REPL are queued. Prompts are added to the conversation
+// before the next request, so they steer the task, and the input left when the task ends, like
+// slash commands, is handled as the next input. A line starting with "!" first interrupts the
+// running request or command.
+const interruptPrefix = "!"
+
+var (
+	// Whether lines typed while a task runs are queued, only in the REPL
+	queueTypedInput  bool
+	queuedInput      []string
+	queuedInputMutex sync.Mutex
+)
+
+// queueInput queues a line typed while a task runs
+func queueInput(line string) {
+	line = strings.TrimSpace(line)
+	interrupt := strings.HasPrefix(line, interruptPrefix)
+	if interrupt {
+		line = strings.TrimSpace(strings.TrimPrefix(line, interruptPrefix))
+	}
+	if line != "" {
+		queuedInputMutex.Lock()
+		queuedInput = append(queuedInput, line)
+		queuedInputMutex.Unlock()
+		log.LogDebug(fmt.Sprintf("Queued input: %s\n", line))
+		fmt.Println(utils.ColoredText("Queued: "+line, utils.ColorGray))
+	}
+	if interrupt {
+		interruptStep()
+	}
+}
+
+// takeQueuedPrompts returns the queued prompts joined as one message, slash commands stay queued
+// until the task ends
+func takeQueuedPrompts() string {
+	queuedInputMutex.Lock()
+	defer queuedInputMutex.Unlock()
+	var prompts, rest []string
+	for _, input := range queuedInput {
+		if strings.HasPrefix(input, "/") {
+			rest = append(rest, input)
+		} else {
+			prompts = append(prompts, input)
+		}
+	}
+	queuedInput = rest
+	return strings.Join(prompts, "\n")
+}
+
+// takeQueuedInput returns the input left when a task ends, consecutive lines of a prompt are
+// joined
+func takeQueuedInput() []string {
+	queuedInputMutex.Lock()
+	defer queuedInputMutex.Unlock()
+	var inputs []string
+	for i, input := range queuedInput {
+		if i > 0 && !strings.HasPrefix(input, "/") && !strings.HasPrefix(queuedInput[i-1], "/") {
+			inputs[len(inputs)-1] += "\n" + input
+			continue
+		}
+		inputs = append(inputs, input)
+	}
+	queuedInput = nil
+	return inputs
+}
+
+// addQueuedPrompts adds the prompts queued during the last step to the conversation. They're
+// appended to the last user message when there is one, like the result of a tool, since roles
+// alternate.
+func addQueuedPrompts(conversation *[]map[string]string) {
+	prompts := takeQueuedPrompts()
+	if prompts == "" {
+		return
+	}
+	content := "The user sent this message while you were working:\n" + prompts
+	log.LogDebug(fmt.Sprintf("QUEUED PROMPTS ADDED: %s\n", prompts))
+	if last := len(*conversation) - 1; last >= 0 && (*conversation)[last]["role"] == "user" {
+		(*conversation)[last]["content"] += "\n\n" + content
+		return
+	}
+	*conversation = append(*conversation, map[string]string{
+		"role":    "user",
+		"content": content,
+	})
+}
+
+// handleQueuedInput handles the input queued when the last task ended, and the input queued by
+// the tasks it starts, it returns whether NCA should exit
+func handleQueuedInput(conversation *[]map[string]string, currentDeletedRange *[2]int) bool {
+	for {
+		inputs := takeQueuedInput()
+		if len(inputs) == 0 {
+			return false
+		}
+		for _, input := range inputs {
+			fmt.Println(utils.ColoredText(">>> "+input, utils.ColorPurple))
+			if handleInput(input, conversation, currentDeletedRange) {
+				return true
+			}
+		}
+	}
+}
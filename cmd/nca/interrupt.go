@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pederhe/nca/internal/core"
+	"github.com/pederhe/nca/pkg/log"
+	"github.com/pederhe/nca/pkg/utils"
+)
+
+// Ctrl+C stops what is running: the API request, or the command of execute_command and the
+// processes it started. A second Ctrl+C within doubleInterruptWindow aborts the task, the
+// conversation up to that point is kept.
+const doubleInterruptWindow = 2 * time.Second
+
+var (
+	lastInterrupt      time.Time
+	lastInterruptMutex sync.Mutex
+	// Whether a task is running and whether it should stop before its next request
+	taskRunning        atomic.Bool
+	taskAbortRequested atomic.Bool
+)
+
+// handleInterrupt handles a Ctrl+C while NCA isn't reading input
+func handleInterrupt() {
+	lastInterruptMutex.Lock()
+	double := time.Since(lastInterrupt) < doubleInterruptWindow
+	lastInterrupt = time.Now()
+	lastInterruptMutex.Unlock()
+
+	if double && taskRunning.Load() && !taskAbortRequested.Load() {
+		log.LogDebug("Aborting the task due to a double interrupt\n")
+		taskAbortRequested.Store(true)
+		fmt.Println(utils.ColoredText("\nAborting the task", utils.ColorYellow))
+	}
+
+	if interruptStep() && !taskAbortRequested.Load() {
+		fmt.Println(utils.ColoredText("\nCommand interrupted, press Ctrl+C again to abort the task", utils.ColorYellow))
+	}
+}
+
+// interruptStep cancels the API request in progress or interrupts the running command, it returns
+// whether a command was interrupted
+func interruptStep() bool {
+	if isProcessingAPIRequest && currentRequestCancel != nil {
+		// If an API request is in progress, cancel it
+		log.LogDebug("Cancelling current API request due to interrupt\n")
+		currentRequestCancel()
+		fmt.Println("\nAPI request cancelled")
+		return false
+	}
+	if core.InterruptCommand() {
+		log.LogDebug("Interrupting the running command\n")
+		return true
+	}
+	return false
+}
+
+// startTask marks a task as running, lines typed in the REPL are queued until the returned
+// function marks it as finished
+func startTask() func() {
+	taskAbortRequested.Store(false)
+	taskRunning.Store(true)
+	stopTypeAhead := func() {}
+	if queueTypedInput {
+		stopTypeAhead = core.StartTypeAhead(queueInput)
+	}
+	return func() {
+		stopTypeAhead()
+		taskRunning.Store(false)
+	}
+}
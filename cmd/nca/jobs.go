@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pederhe/nca/internal/core"
+	"github.com/pederhe/nca/pkg/log"
+	"github.com/pederhe/nca/pkg/utils"
+)
+
+// Handle the /jobs command, which lists the background jobs of the session
+func handleJobsCommand() {
+	jobs := core.ListBackgroundJobs()
+	if len(jobs) == 0 {
+		fmt.Println("No background jobs, commands run in the background when the agent uses run_in_background")
+		return
+	}
+	for _, job := range jobs {
+		status := job.Status()
+		color := utils.ColorGreen
+		if status != "running" {
+			color = utils.ColorYellow
+		}
+		fmt.Printf("%d  %s  %s  started %s\n", job.ID, utils.ColoredText(status, color), job.Command, job.Started.Format(time.TimeOnly))
+	}
+	log.LogDebug("Background jobs listed\n")
+}
+
+// Handle the /logs command, format: "/logs <job_id>"
+func handleLogsCommand(args []string) {
+	if len(args) != 1 {
+		fmt.Println("Usage: /logs <job_id>")
+		return
+	}
+	job, err := core.GetBackgroundJob(args[0])
+	if err != nil {
+		fmt.Println(utils.ColoredText("Error: "+err.Error(), utils.ColorRed))
+		return
+	}
+	fmt.Println(utils.ColoredText(fmt.Sprintf("Job %d (%s): %s", job.ID, job.Status(), job.Command), utils.ColorBlue))
+	fmt.Print(job.Output())
+}
+
+// Handle the /kill command, format: "/kill <job_id>"
+func handleKillCommand(args []string) {
+	if len(args) != 1 {
+		fmt.Println("Usage: /kill <job_id>")
+		return
+	}
+	job, err := core.GetBackgroundJob(args[0])
+	if err != nil {
+		fmt.Println(utils.ColoredText("Error: "+err.Error(), utils.ColorRed))
+		return
+	}
+	if !job.Stop() {
+		fmt.Printf("Job %d already %s\n", job.ID, job.Status())
+		return
+	}
+	fmt.Printf("Job %d stopped\n", job.ID)
+	log.LogDebug(fmt.Sprintf("Background job %d stopped\n", job.ID))
+}
+
+// backgroundJobIDs returns the IDs of the background jobs for completion
+func backgroundJobIDs(string) []string {
+	var ids []string
+	for _, job := range core.ListBackgroundJobs() {
+		ids = append(ids, fmt.Sprint(job.ID))
+	}
+	return ids
+}
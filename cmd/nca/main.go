@@ -3,11 +3,15 @@ package main
 import (
 	"bufio"
 	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"io"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -33,6 +37,8 @@ var (
 	currentRequestCancel context.CancelFunc
 	// Flag indicating whether an API request is being processed
 	isProcessingAPIRequest bool
+	// ID of the last API request in the debug log, the tool calls of its response refer to it
+	lastRequestID string
 )
 
 // Global variables for checkpoints
@@ -40,6 +46,28 @@ var (
 	checkpointManager *core.CheckpointManager
 )
 
+// The last prompt of the conversation, /edit changes it and runs it again
+var lastPrompt struct {
+	text         string // The prompt as entered by the user
+	content      string // The content of its message in the conversation
+	checkpointID string // The checkpoint created when it was handled
+}
+
+// Images pasted with /paste-image, they're attached to the next prompt
+var pastedImages []string
+
+// summarizerTimeout limits auxiliary requests like summaries and titles
+const summarizerTimeout = 2 * time.Minute
+
+// Writes the events of a one-off query in JSON output mode, nil in text mode
+var eventWriter *core.EventWriter
+
+// Answer language of this session set with /lang, empty to use the ui.answer_language config
+var sessionAnswerLanguage string
+
+// Whether the last task stopped at the step limit, /continue resumes it
+var taskStepLimitReached bool
+
 // Mode selection: Agent or Ask
 var (
 	// true for Agent mode, false for Ask mode
@@ -48,6 +76,18 @@ var (
 	conversationTruncatedCount = 0
 )
 
+// stringListFlag collects the values of a flag that can be given several times
+type stringListFlag []string
+
+func (f *stringListFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *stringListFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
 func main() {
 	// Initialize checkpoint manager
 	checkpointManager = core.NewCheckpointManager()
@@ -72,8 +112,87 @@ func main() {
 	promptFlag := flag.Bool("p", false, "Run a one-time query and exit")
 	versionFlag := flag.Bool("v", false, "Show version information")
 	debugFlag := flag.Bool("debug", false, "Enable debug mode to log conversation data")
+	resumeFlag := flag.Bool("resume", false, "Resume a saved session, the most recent one if no name is given")
+	keepScratchFlag := flag.Bool("keep-scratch", false, "Keep the scratch directories of finished tasks")
+	outputFlag := flag.String("output", "text", "Output format of one-time queries: text or json")
+	dryRunFlag := flag.Bool("dry-run", false, "Preview file changes, commits and commands as a plan instead of running them")
+	systemPromptFileFlag := flag.String("system-prompt-file", "", "Use a template file as the system prompt")
+	systemPromptModeFlag := flag.String("system-prompt-mode", "replace", "How the system prompt file is used: replace or append to the built-in prompt")
+	var workspaceFlags stringListFlag
+	flag.Var(&workspaceFlags, "workspace", "A root directory the file tools work in, repeat it for several roots")
+	profileFlag := flag.String("profile", "", "Use the settings of a config profile")
+	recordAPIFlag := flag.String("record-api", "", "Record the API responses to a cassette file")
+	replayAPIFlag := flag.String("replay-api", "", "Replay the API responses of a cassette file instead of calling the API")
+	verboseFlag := flag.Bool("verbose", false, "Show the full output of tools instead of collapsing large outputs")
+	yesFlag := flag.Bool("yes", false, "Approve every action without asking, for CI and scripts")
+	approvalFlag := flag.String("approval", "", "Approval policy when nobody can answer prompts: never, auto-safe or always-ask")
 	flag.Parse()
 
+	if *outputFlag != "text" && *outputFlag != "json" {
+		fmt.Printf("Error: Unknown output format '%s', use text or json\n", *outputFlag)
+		return
+	}
+	// Switch before anything is printed, stdout must only carry events
+	if *outputFlag == "json" {
+		enableJSONOutput()
+	}
+
+	// NCA_ variables of the project's env files override the config, in trusted workspaces
+	if err := config.LoadEnvFiles("."); err != nil {
+		fmt.Printf("Warning: Failed to load env file: %s\n", err)
+	}
+	if *profileFlag != "" {
+		if err := config.SelectProfile(*profileFlag); err != nil {
+			fmt.Printf("Error: %s\n", err)
+			return
+		}
+	}
+
+	// Cassettes make the responses of the API repeatable, for tests of the tool loop
+	if *recordAPIFlag != "" && *replayAPIFlag != "" {
+		fmt.Println("Error: -record-api and -replay-api can't be used together")
+		return
+	} else if *recordAPIFlag != "" {
+		api.RecordCassette(*recordAPIFlag)
+	} else if *replayAPIFlag != "" {
+		if err := api.ReplayCassette(*replayAPIFlag); err != nil {
+			fmt.Printf("Error: %s\n", err)
+			return
+		}
+	}
+
+	if err := core.SetWorkspaceRoots(workspaceFlags); err != nil {
+		fmt.Printf("Error: %s\n", err)
+		return
+	}
+	if *systemPromptFileFlag != "" {
+		if err := core.SetSystemPromptFile(*systemPromptFileFlag, *systemPromptModeFlag); err != nil {
+			fmt.Printf("Error: %s\n", err)
+			return
+		}
+	}
+
+	if *yesFlag {
+		if *approvalFlag != "" {
+			fmt.Println("Error: -yes and -approval can't be used together")
+			return
+		}
+		*approvalFlag = core.ApprovalYes
+	}
+	if err := core.SetApprovalPolicy(*approvalFlag); err != nil {
+		fmt.Printf("Error: %s\n", err)
+		return
+	}
+
+	core.SetKeepScratch(*keepScratchFlag)
+	core.SetPlanMode(*dryRunFlag)
+	core.SetVerboseOutput(*verboseFlag)
+	core.SetContextSummarizer(summarizeContext)
+	core.SetTraceServiceVersion(Version)
+	defer endScratchTask()
+	defer core.FlushTraces()
+	defer core.StopBackgroundJobs()
+
 	// Show version information
 	if *versionFlag {
 		fmt.Printf("NCA version: %s\n", Version)
@@ -91,23 +210,29 @@ func main() {
 
 	args := flag.Args()
 
-	// Process command line arguments
-	if len(args) > 0 {
-		switch args[0] {
-		case "config":
-			// Handle configuration settings command
-			log.LogDebug(fmt.Sprintf("Config command: %v\n", args))
-			handleConfigCommand(args[1:])
-			return
-		case "commit":
-			// Handle git commit operation command
-			log.LogDebug("Commit command detected\n")
-			runREPL("commit all current changes, and summarize the changes")
+	// Resume a saved session, format: "nca --resume [name]"
+	if *resumeFlag {
+		name := ""
+		if len(args) > 0 {
+			name = args[0]
+		}
+		session, err := core.LoadSession(name)
+		if err != nil {
+			fmt.Printf("Error resuming session: %s\n", err)
+			log.LogDebug(fmt.Sprintf("Error resuming session %s: %s\n", name, err))
 			return
-		case "help":
-			// Display help information
-			log.LogDebug("Help command detected\n")
-			displayHelp()
+		}
+		log.LogDebug(fmt.Sprintf("Resuming session %s with %d messages\n", session.Name, len(session.Conversation)))
+		checkWorkspaceTrust()
+		checkClientConfig()
+		runREPL("", session)
+		return
+	}
+
+	// Process command line arguments, a command runs instead of a prompt
+	if len(args) > 0 {
+		if command, ok := findCLICommand(args[0]); ok {
+			command.run(args[1:])
 			return
 		}
 	}
@@ -151,9 +276,16 @@ func main() {
 		}
 		log.LogDebug(fmt.Sprintf("Running one-time query mode with pipe input: %s\n", initialPrompt))
 		runOneOffQuery(initialPrompt)
+		// Stdin was the pipe, the plan can't be confirmed
+		if *dryRunFlag {
+			printPlan()
+		}
 		return
 	}
 
+	// Ask whether the workspace is trusted the first time NCA runs in it
+	checkWorkspaceTrust()
+
 	// Run REPL or one-off query (only reached if no pipe input)
 	if *promptFlag {
 		if initialPrompt == "" {
@@ -163,172 +295,916 @@ func main() {
 		}
 		log.LogDebug(fmt.Sprintf("One-time query mode with prompt: %s\n", initialPrompt))
 		runOneOffQuery(initialPrompt)
+		if *dryRunFlag && len(core.GetPlan()) > 0 {
+			printPlan()
+			if eventWriter == nil && core.CanAskUser() {
+				fmt.Print("Apply the plan? (y/n): ")
+				var response string
+				fmt.Fscanln(core.Input, &response)
+				if strings.ToLower(response) == "y" {
+					applyPlan()
+				}
+			}
+		}
 	} else {
+		if *outputFlag == "json" {
+			fmt.Println("Error: JSON output is only supported for one-time queries, use it with -p")
+			return
+		}
 		log.LogDebug("Starting interactive REPL mode\n")
 		if initialPrompt != "" {
 			log.LogDebug(fmt.Sprintf("With initial prompt: %s\n", initialPrompt))
 		}
-		runREPL(initialPrompt)
+		checkClientConfig()
+		runREPL(initialPrompt, nil)
 	}
 }
 
+// enableJSONOutput switches a one-off query to JSON output. Stdout only carries the events,
+// the text output, prompts and progress are shown on stderr instead.
+func enableJSONOutput() {
+	eventWriter = core.NewEventWriter(os.Stdout)
+	os.Stdout = os.Stderr
+	log.LogDebug("JSON output enabled\n")
+}
+
+// emitEvent writes an event in JSON output mode
+func emitEvent(eventType string, fields map[string]interface{}) {
+	if eventWriter != nil {
+		eventWriter.Emit(eventType, fields)
+	}
+}
+
+// emitResult writes the final answer of a task in JSON output mode
+func emitResult(text string) {
+	files := checkpointManager.ChangedFiles()
+	if files == nil {
+		files = []string{}
+	}
+	emitEvent("result", map[string]interface{}{"text": text, "files_changed": files})
+}
+
+// getEnvironmentDetails returns the environment details appended to a user message, all of them
+// for the first message of a task and only the changed ones afterwards
 func getEnvironmentDetails() string {
-	details := "\n# Current Mode\n"
-	if isAgentMode {
-		details += "AGENT MODE\n"
-	} else {
-		details += "ASK MODE\n"
+	return core.FormatEnvironmentDetails(environmentSections())
+}
+
+// environmentSections returns the sections of the environment details
+func environmentSections() []core.EnvironmentSection {
+	var sections []core.EnvironmentSection
+	mode := "AGENT MODE"
+	if !isAgentMode {
+		mode = "ASK MODE"
+	}
+	sections = append(sections, core.EnvironmentSection{Title: "Current Mode", Content: mode})
+
+	lang := getAnswerLanguage()
+	language := fmt.Sprintf("Speak in %s", lang)
+	if lang != "English" {
+		language += "\nKeep code, code comments and commit messages in the language the project already uses."
+	}
+	sections = append(sections, core.EnvironmentSection{Title: "Preferred Language", Content: language})
+
+	if scratchDir, err := core.GetScratchDir(); err == nil {
+		sections = append(sections, core.EnvironmentSection{Title: "Scratch Directory",
+			Content: fmt.Sprintf("%s\nUse it for experiments, downloaded files and generated assets that don't belong in the project. It is deleted when the task ends.", scratchDir)})
+	}
+
+	if core.IsPlanMode() {
+		sections = append(sections, core.EnvironmentSection{Title: "Plan Mode",
+			Content: "File writes, downloads, commits and commands that require approval are not executed but recorded as a plan the user reviews and applies at once. Continue as if they succeeded: edits of a planned file apply to its planned content, but read_file and commands still see the files on disk. Finish with attempt_completion and summarize the plan."})
+	}
+
+	if roots := core.GetWorkspaceRoots(); len(roots) > 1 {
+		sections = append(sections, core.EnvironmentSection{Title: "Workspace Roots",
+			Content: strings.Join(roots, "\n") + "\nFile tools work inside these directories."})
 	}
+	sections = append(sections, core.EnvironmentSection{Title: "Workspace Files", Content: core.BuildWorkspaceMap()})
+	if repoMap := core.GetRepoMap(); repoMap != "" {
+		sections = append(sections, core.EnvironmentSection{Title: "Repository Map", Content: repoMap})
+	}
+
+	if checklist := core.FormatChecklist(); checklist != "" {
+		sections = append(sections, core.EnvironmentSection{Title: "Task Checklist", Content: checklist})
+	}
+
+	// Tell the model where its commands run after a "cd"
+	if core.IsWorkingDirChanged() {
+		sections = append(sections, core.EnvironmentSection{Title: "Current Working Directory",
+			Content: fmt.Sprintf("%s (relative paths are resolved against it)", core.GetWorkingDir())})
+	}
+
+	return sections
+}
+
+// completeWithSummarizer answers an auxiliary prompt with the summarizer model, or the main
+// model if no summarizer model is configured
+func completeWithSummarizer(prompt string) (string, error) {
+	client, err := api.NewSummarizerClient()
+	if err != nil {
+		return "", err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), summarizerTimeout)
+	defer cancel()
+	return client.Complete(ctx, prompt)
+}
+
+// summarizeContext summarizes the messages removed from a conversation that exceeds the context window
+func summarizeContext(prompt string) (string, error) {
+	fmt.Println(utils.ColoredText("Summarizing earlier messages to fit the context window...", utils.ColorCyan))
+	summary, err := completeWithSummarizer(prompt)
+	if err != nil {
+		fmt.Println(utils.ColoredText("Failed to summarize, the earlier messages are dropped: "+err.Error(), utils.ColorYellow))
+	}
+	return summary, err
+}
 
-	// Get system language preference
-	lang := os.Getenv("LANG")
+// endScratchTask ends the scratch directory of the current task, it is removed unless nca runs with -keep-scratch
+func endScratchTask() {
+	if dir := core.CleanupScratchDir(); dir != "" {
+		fmt.Println(utils.ColoredText("Scratch directory kept at "+dir, utils.ColorYellow))
+	}
+}
+
+// Names of the answer languages by language code
+var languageNames = map[string]string{
+	"ar": "العربية",
+	"de": "Deutsch",
+	"en": "English",
+	"es": "Español",
+	"fr": "Français",
+	"hi": "हिन्दी",
+	"id": "Bahasa Indonesia",
+	"it": "Italiano",
+	"ja": "日本語",
+	"ko": "한국어",
+	"nl": "Nederlands",
+	"pl": "Polski",
+	"pt": "Português",
+	"ru": "Русский",
+	"sv": "Svenska",
+	"th": "ไทย",
+	"tr": "Türkçe",
+	"uk": "Українська",
+	"vi": "Tiếng Việt",
+	"zh": "中文",
+}
+
+// getAnswerLanguage returns the language the model answers in. The /lang setting of the session
+// takes precedence over the ui.answer_language config, "auto" follows the locale of the system.
+func getAnswerLanguage() string {
+	lang := sessionAnswerLanguage
 	if lang == "" {
-		lang = "en_US.UTF-8" // Default to English if not set
+		lang = strings.TrimSpace(config.Get("ui.answer_language"))
+	}
+	if lang == "" || strings.EqualFold(lang, "auto") {
+		return getLanguageCode(getSystemLocale())
 	}
-	lang = getLanguageCode(lang)
-	details += fmt.Sprintf("\n# Preferred Language\nSpeak in %s\n", lang)
+	if name, ok := lookupLanguage(lang); ok {
+		return name
+	}
+	// Languages without a code are passed on as written, e.g. "Brazilian Portuguese"
+	return lang
+}
 
-	return fmt.Sprintf("\n\n<environment_details>\n%s\n</environment_details>", details)
+// getSystemLocale returns the locale of messages, LC_ALL and LC_MESSAGES take precedence over LANG
+func getSystemLocale() string {
+	for _, name := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		if value := os.Getenv(name); value != "" {
+			return value
+		}
+	}
+	return "en_US.UTF-8" // Default to English if not set
 }
 
+// getLanguageCode returns the name of the language of a locale like "ja_JP.UTF-8", English if it is unknown
 func getLanguageCode(lang string) string {
-	if strings.Contains(lang, "zh") {
-		return "中文"
+	if name, ok := lookupLanguage(lang); ok {
+		return name
 	}
 	return "English"
 }
 
+// lookupLanguage returns the name of the language of a code or locale like "pt", "pt-BR" or "zh_TW.UTF-8"
+func lookupLanguage(lang string) (string, bool) {
+	lang = strings.ToLower(lang)
+	code := lang
+	if i := strings.IndexAny(code, "_-.@"); i >= 0 {
+		code = code[:i]
+	}
+	if code == "zh" && (strings.Contains(lang, "tw") || strings.Contains(lang, "hk") || strings.Contains(lang, "hant")) {
+		return "繁體中文", true
+	}
+	name, ok := languageNames[code]
+	return name, ok
+}
+
+// handleLangCommand shows or changes the answer language of this session
+func handleLangCommand(args []string) {
+	if len(args) == 0 {
+		source := "ui.answer_language config"
+		if sessionAnswerLanguage != "" {
+			source = "/lang"
+		} else if value := config.Get("ui.answer_language"); value == "" || strings.EqualFold(value, "auto") {
+			source = "system locale"
+		}
+		fmt.Printf("Answer language: %s (from %s)\n", getAnswerLanguage(), source)
+		fmt.Println("Usage: /lang <code|name|auto>, e.g. /lang ja")
+		return
+	}
+
+	lang := strings.Join(args, " ")
+	if strings.EqualFold(lang, "auto") {
+		sessionAnswerLanguage = ""
+	} else {
+		sessionAnswerLanguage = lang
+	}
+	fmt.Printf("Answer language set to %s for this session\n", getAnswerLanguage())
+	log.LogDebug(fmt.Sprintf("Answer language changed: %s\n", lang))
+}
+
+// getAutoApproveKey returns the control character used to toggle auto-approve and its display name.
+// It is read from the auto_approve_key config (e.g. "ctrl+o") and defaults to Ctrl+O.
+func getAutoApproveKey() (rune, string) {
+	defaultKey, defaultName := rune(15), "Ctrl+O" // Ctrl+O (ASCII 15)
+
+	value := strings.ToLower(strings.TrimSpace(config.Get("auto_approve_key")))
+	if value == "" {
+		return defaultKey, defaultName
+	}
+
+	letter := strings.TrimPrefix(strings.TrimPrefix(value, "ctrl+"), "ctrl-")
+	if len(letter) != 1 || letter[0] < 'a' || letter[0] > 'z' {
+		fmt.Printf("Warning: Invalid auto_approve_key '%s', using %s\n", value, defaultName)
+		return defaultKey, defaultName
+	}
+
+	// Keys already used for mode switching, editing or line control can't be rebound
+	if strings.Contains("acdhijm", letter) {
+		fmt.Printf("Warning: auto_approve_key '%s' is reserved, using %s\n", value, defaultName)
+		return defaultKey, defaultName
+	}
+
+	return rune(letter[0]-'a') + 1, "Ctrl+" + strings.ToUpper(letter)
+}
+
 // Handle config command
 func handleConfigCommand(args []string) {
 	if len(args) == 0 {
-		fmt.Println("Usage: nca config [set|unset|list] [--global] [key] [value]")
+		fmt.Println("Usage: nca config [set|unset|list|profiles] [--global|--profile name] [key] [value]")
 		return
 	}
 
 	isGlobal := false
-	cmdArgs := args
+	profile := ""
+	var cmdArgs []string
 
-	// Check for --global flag
-	for i, arg := range args {
-		if arg == "--global" {
+	// Check for the --global and --profile flags
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "--global":
 			isGlobal = true
-			cmdArgs = append(args[:i], args[i+1:]...)
-			break
+		case args[i] == "--profile" && i+1 < len(args):
+			profile = args[i+1]
+			i++
+		case strings.HasPrefix(args[i], "--profile="):
+			profile = strings.TrimPrefix(args[i], "--profile=")
+		default:
+			cmdArgs = append(cmdArgs, args[i])
 		}
 	}
 
-	// Check if there are any arguments left after removing the --global flag
+	// Check if there are any arguments left after removing the flags
 	if len(cmdArgs) == 0 {
-		fmt.Println("Usage: nca config [set|unset|list] [--global] [key] [value]")
+		fmt.Println("Usage: nca config [set|unset|list|profiles] [--global|--profile name] [key] [value]")
 		return
 	}
 
 	switch cmdArgs[0] {
 	case "set":
 		if len(cmdArgs) < 3 {
-			fmt.Println("Usage: nca config set [--global] [key] [value]")
+			fmt.Println("Usage: nca config set [--global|--profile name] [key] [value]")
+			return
+		}
+		if profile != "" {
+			if err := config.SetProfileValue(profile, cmdArgs[1], cmdArgs[2]); err != nil {
+				fmt.Printf("Error: %s\n", err)
+				return
+			}
+			fmt.Printf("Set %s = %s in profile %s\n", cmdArgs[1], cmdArgs[2], profile)
 			return
 		}
 		config.Set(cmdArgs[1], cmdArgs[2], isGlobal)
 		fmt.Printf("Set %s = %s\n", cmdArgs[1], cmdArgs[2])
 	case "unset":
 		if len(cmdArgs) < 2 {
-			fmt.Println("Usage: nca config unset [--global] [key]")
+			fmt.Println("Usage: nca config unset [--global|--profile name] [key]")
+			return
+		}
+		if profile != "" {
+			if err := config.UnsetProfileValue(profile, cmdArgs[1]); err != nil {
+				fmt.Printf("Error: %s\n", err)
+				return
+			}
+			fmt.Printf("Removed setting %s from profile %s\n", cmdArgs[1], profile)
 			return
 		}
 		config.Unset(cmdArgs[1], isGlobal)
 		fmt.Printf("Removed setting %s\n", cmdArgs[1])
 	case "list":
-		// Get all configuration values
+		// Get all configuration values, or the values of a profile
 		allConfigs := config.GetAll()
+		if profile != "" {
+			if !config.ProfileExists(profile) {
+				fmt.Printf("Error: profile '%s' doesn't exist\n", profile)
+				return
+			}
+			allConfigs = config.GetProfile(profile)
+		}
 
 		if len(allConfigs) == 0 {
 			fmt.Println("No configuration settings found.")
 			return
 		}
 
-		fmt.Println("Current configuration settings:")
+		if profile != "" {
+			fmt.Printf("Settings of profile %s:\n", profile)
+		} else if active := config.ActiveProfile(); active != "" {
+			fmt.Printf("Current configuration settings (profile %s):\n", active)
+		} else {
+			fmt.Println("Current configuration settings:")
+		}
 		fmt.Println("------------------------------")
 		for key, value := range allConfigs {
 			fmt.Printf("%s = %s\n", key, value)
 		}
 		fmt.Println("------------------------------")
+	case "profiles":
+		handleProfilesCommand(cmdArgs[1:])
+	default:
+		fmt.Println("Unknown config command. Available commands: set, unset, list, profiles")
+	}
+}
+
+// handleProfilesCommand lists the config profiles or deletes one, format: "nca config profiles [delete name]"
+func handleProfilesCommand(args []string) {
+	if len(args) > 0 {
+		if args[0] != "delete" || len(args) < 2 {
+			fmt.Println("Usage: nca config profiles [delete name]")
+			return
+		}
+		if err := config.DeleteProfile(args[1]); err != nil {
+			fmt.Printf("Error: %s\n", err)
+			return
+		}
+		fmt.Printf("Deleted profile %s\n", args[1])
+		return
+	}
+
+	names := config.ListProfiles()
+	if len(names) == 0 {
+		fmt.Println("No profiles found, create one with: nca config set --profile <name> <key> <value>")
+		return
+	}
+	active := config.ActiveProfile()
+	for _, name := range names {
+		marker := "  "
+		if name == active {
+			marker = "* "
+		}
+		fmt.Printf("%s%s (%d settings)\n", marker, name, len(config.GetProfile(name)))
+	}
+}
+
+// checkWorkspaceTrust asks the user to trust the current directory if no decision has been made yet
+func checkWorkspaceTrust() {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return
+	}
+
+	trusted, known := config.GetWorkspaceTrust(cwd)
+	if !known {
+		// Without a user to answer, the workspace stays undecided, which isn't trusted either
+		if !core.CanAskUser() {
+			return
+		}
+		fmt.Printf("Do you trust this workspace? %s\n", utils.ColoredText(cwd, utils.ColorYellow))
+		fmt.Println("Untrusted workspaces run without auto-approve and without network tools.")
+		fmt.Print("Trust this workspace? (y/n): ")
+		var response string
+		fmt.Fscanln(core.Input, &response)
+		trusted = strings.ToLower(response) == "y"
+
+		if err := config.SetWorkspaceTrust(cwd, trusted); err != nil {
+			fmt.Printf("Warning: Failed to save trust decision: %s\n", err)
+		}
+		log.LogDebug(fmt.Sprintf("Workspace trust decision for %s: %t\n", cwd, trusted))
+		if trusted {
+			if err := config.LoadEnvFiles("."); err != nil {
+				fmt.Printf("Warning: Failed to load env file: %s\n", err)
+			}
+		}
+	}
+
+	if !trusted {
+		fmt.Println(utils.ColoredText("Running in untrusted workspace: auto-approve and network tools are disabled", utils.ColorYellow))
+	}
+}
+
+// Handle trust command
+func handleTrustCommand(args []string) {
+	if len(args) == 0 {
+		fmt.Println("Usage: nca trust [list|revoke] [path]")
+		return
+	}
+
+	switch args[0] {
+	case "list":
+		decisions := config.ListWorkspaceTrust()
+		if len(decisions) == 0 {
+			fmt.Println("No workspace trust decisions found.")
+			return
+		}
+
+		paths := make([]string, 0, len(decisions))
+		for path := range decisions {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+
+		fmt.Println("Workspace trust decisions:")
+		fmt.Println("------------------------------")
+		for _, path := range paths {
+			decision := decisions[path]
+			state := utils.ColoredText("trusted", utils.ColorGreen)
+			if !decision.Trusted {
+				state = utils.ColoredText("untrusted", utils.ColorRed)
+			}
+			fmt.Printf("%-9s %s (%s)\n", state, path, decision.DecidedAt.Format("2006-01-02 15:04"))
+		}
+		fmt.Println("------------------------------")
+	case "revoke":
+		path := "."
+		if len(args) > 1 {
+			path = args[1]
+		}
+		removed, err := config.RevokeWorkspaceTrust(path)
+		if err != nil {
+			fmt.Printf("Error revoking trust decision: %s\n", err)
+			return
+		}
+		if !removed {
+			fmt.Printf("No trust decision found for %s\n", path)
+			return
+		}
+		fmt.Printf("Revoked trust decision for %s, you will be asked again on the next run\n", path)
 	default:
-		fmt.Println("Unknown config command. Available commands: set, unset, list")
+		fmt.Println("Unknown trust command. Available commands: list, revoke")
 	}
 }
 
-// Run interactive REPL
-func runREPL(initialPrompt string) {
+// Handle the audit command, which shows the log of mutating actions
+func handleAuditCommand(args []string) {
+	if len(args) == 0 || args[0] != "show" {
+		fmt.Println("Usage: nca audit show [--since 24h|7d|2006-01-02]")
+		return
+	}
+
+	sinceValue := ""
+	for i := 1; i < len(args); i++ {
+		if args[i] == "--since" && i+1 < len(args) {
+			sinceValue = args[i+1]
+			i++
+		} else if strings.HasPrefix(args[i], "--since=") {
+			sinceValue = strings.TrimPrefix(args[i], "--since=")
+		}
+	}
+
+	since, err := core.ParseAuditSince(sinceValue)
+	if err != nil {
+		fmt.Printf("Error: Invalid --since value '%s', use a duration (24h, 7d) or a date (2006-01-02)\n", sinceValue)
+		return
+	}
+
+	entries, err := core.ReadAuditLog(since)
+	if err != nil {
+		fmt.Printf("Error reading audit log: %s\n", err)
+		return
+	}
+	if len(entries) == 0 {
+		fmt.Println("No audit log entries found.")
+		return
+	}
+
+	for _, entry := range entries {
+		status := entry.Status
+		if status != "success" {
+			status = utils.ColoredText(status, utils.ColorRed)
+		}
+		fmt.Printf("%s  %-15s  %-13s  %s  %s\n", entry.Time.Format("2006-01-02 15:04:05"), entry.Tool, entry.Approval, status, entry.Target)
+		fmt.Printf("    cwd: %s", entry.CWD)
+		if entry.DiffHash != "" {
+			fmt.Printf("  sha256: %s", entry.DiffHash)
+		}
+		fmt.Println()
+	}
+}
+
+// Handle the debug command, format: "nca debug show [path]"
+func handleDebugCommand(args []string) {
+	if len(args) == 0 || args[0] != "show" || len(args) > 2 {
+		fmt.Println("Usage: nca debug show [path]")
+		fmt.Println("Shows a debug log in a human-readable form, the latest one if no path is given.")
+		return
+	}
+
+	path := ""
+	if len(args) == 2 {
+		path = args[1]
+	} else {
+		latest, err := log.FindLatestDebugLog()
+		if err != nil {
+			fmt.Printf("Error: %s\n", err)
+			return
+		}
+		path = latest
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		fmt.Printf("Error opening debug log: %s\n", err)
+		return
+	}
+	defer file.Close()
+	fmt.Println(utils.ColoredText("Debug log: "+path, utils.ColorCyan))
+	if err := log.RenderEvents(file, os.Stdout); err != nil {
+		fmt.Printf("Error reading debug log: %s\n", err)
+	}
+}
+
+// Handle the new command, format: "nca new <template> <name> [--var key=value]... [--no-agent] [description]"
+func handleNewCommand(args []string) {
+	usage := "Usage: nca new <template> <name> [--var key=value]... [--no-agent] [description]"
+
+	vars := make(map[string]string)
+	noAgent := false
+	var positional []string
+	for i := 0; i < len(args); i++ {
+		value := ""
+		switch {
+		case args[i] == "--no-agent":
+			noAgent = true
+			continue
+		case args[i] == "--var" && i+1 < len(args):
+			value = args[i+1]
+			i++
+		case strings.HasPrefix(args[i], "--var="):
+			value = strings.TrimPrefix(args[i], "--var=")
+		default:
+			positional = append(positional, args[i])
+			continue
+		}
+		key, val, ok := strings.Cut(value, "=")
+		if !ok || key == "" {
+			fmt.Printf("Error: Invalid --var value '%s', use key=value\n", value)
+			return
+		}
+		vars[key] = val
+	}
+
+	if len(positional) < 2 {
+		fmt.Println(usage)
+		fmt.Println("\nTemplates:")
+		for _, template := range core.ListTemplates() {
+			fmt.Printf("  %-16s %s (%s)\n", template.Name, template.Description, template.Source)
+		}
+		return
+	}
+
+	template, err := core.LoadTemplate(positional[0])
+	if err != nil {
+		fmt.Printf("Error: %s\n", err)
+		return
+	}
+
+	name := positional[1]
+	variables := core.TemplateVariables(filepath.Base(name), vars)
+	files, err := template.Render(name, variables)
+	if err != nil {
+		fmt.Printf("Error creating %s: %s\n", name, err)
+		return
+	}
+	fmt.Println(utils.ColoredText(fmt.Sprintf("Created %s from the %s template:", name, template.Name), utils.ColorGreen))
+	for _, file := range files {
+		fmt.Println("  " + file)
+	}
+
+	task := template.TemplateTask(name, files, variables, strings.Join(positional[2:], " "))
+	if noAgent || task == "" {
+		return
+	}
+	checkWorkspaceTrust()
+	checkClientConfig()
+	runREPL(task, nil)
+}
+
+// Handle the resolve command, format: "nca resolve [--test command]". Every conflicted file is
+// resolved in its own task, resolved files are staged and the build and tests run at the end.
+func handleResolveCommand(args []string) {
+	var testCommand string
+	explicitTest := false
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "--test" && i+1 < len(args):
+			testCommand = args[i+1]
+			explicitTest = true
+			i++
+		case strings.HasPrefix(args[i], "--test="):
+			testCommand = strings.TrimPrefix(args[i], "--test=")
+			explicitTest = true
+		default:
+			fmt.Println("Usage: nca resolve [--test command]")
+			return
+		}
+	}
+
+	files, err := core.GetConflictedFiles()
+	if err != nil {
+		fmt.Printf("Error: %s\n", err)
+		return
+	}
+	if len(files) == 0 {
+		fmt.Println("No merge conflicts found.")
+		return
+	}
+	operation := core.DetectMergeOperation()
+
+	checkWorkspaceTrust()
+	checkClientConfig()
+	// The project's config only applies once the workspace is trusted
+	if !explicitTest {
+		testCommand = core.GetResolveTestCommand()
+	}
+
+	var resolved, unresolved []string
+	for i, file := range files {
+		fmt.Println(utils.ColoredText(fmt.Sprintf("\nResolving %s (%d/%d)", file, i+1, len(files)), utils.ColorCyan))
+		runOneOffQuery(core.BuildResolvePrompt(operation, file, i+1, len(files)))
+
+		// Only files without conflict markers are staged, git would accept the markers
+		if hasMarkers, err := core.HasConflictMarkers(file); err != nil || hasMarkers {
+			unresolved = append(unresolved, file)
+			continue
+		}
+		resolved = append(resolved, file)
+	}
+
+	if len(resolved) > 0 && testCommand != "" {
+		fmt.Println(utils.ColoredText("\nRunning "+testCommand, utils.ColorCyan))
+		result, ran := core.RunResolveTestCommand(testCommand, explicitTest)
+		if !ran {
+			fmt.Println(utils.ColoredText(result, utils.ColorYellow))
+		} else if !strings.HasSuffix(result, "[Exit code: 0]") {
+			fmt.Println(utils.ColoredText("The build or tests fail, letting the agent fix them", utils.ColorYellow))
+			runOneOffQuery(core.BuildResolveFixPrompt(testCommand, result, resolved))
+		}
+	}
+
+	if len(resolved) > 0 {
+		if err := utils.GitAdd(resolved); err != nil {
+			fmt.Println(utils.ColoredText("Error: "+err.Error(), utils.ColorRed))
+			return
+		}
+		fmt.Println(utils.ColoredText("\nResolved and staged:", utils.ColorGreen))
+		for _, file := range resolved {
+			fmt.Println("  " + file)
+		}
+	}
+	if len(unresolved) > 0 {
+		fmt.Println(utils.ColoredText("\nStill has conflict markers, not staged:", utils.ColorRed))
+		for _, file := range unresolved {
+			fmt.Println("  " + file)
+		}
+		return
+	}
+	if operation != "" {
+		fmt.Printf("\nReview the changes with git diff --cached and finish with git %s --continue\n", operation)
+	}
+}
+
+// Handle the /plan command, format: "/plan [show|apply|discard]". Without arguments plan mode is toggled.
+func handlePlanCommand(args []string) {
+	if len(args) == 0 {
+		enabled := !core.IsPlanMode()
+		core.SetPlanMode(enabled)
+		if enabled {
+			fmt.Println(utils.ColoredText("Plan mode on: file changes, commits and commands that need approval are previewed and collected instead of run", utils.ColorGreen))
+		} else {
+			fmt.Println("Plan mode off")
+			if steps := len(core.GetPlan()); steps > 0 {
+				fmt.Printf("%d planned steps are kept, apply them with /plan apply or discard them with /plan discard\n", steps)
+			}
+		}
+		log.LogDebug(fmt.Sprintf("Plan mode set to %v\n", enabled))
+		return
+	}
+
+	switch args[0] {
+	case "show":
+		printPlan()
+	case "apply":
+		applyPlan()
+	case "discard":
+		core.ClearPlan()
+		fmt.Println("Plan discarded")
+		log.LogDebug("Plan discarded\n")
+	default:
+		fmt.Println("Usage: /plan [show|apply|discard]")
+	}
+}
+
+// printPlan shows the planned steps with their diffs and commands
+func printPlan() {
+	plan := core.GetPlan()
+	if len(plan) == 0 {
+		fmt.Println("The plan is empty.")
+		return
+	}
+	fmt.Println(utils.ColoredText(fmt.Sprintf("\nPlan with %d steps:", len(plan)), utils.ColorCyan))
+	for i, step := range plan {
+		fmt.Println(utils.ColoredText(fmt.Sprintf("\n%d. %s", i+1, step.Summary), utils.ColorYellow))
+		if step.Preview != step.Summary {
+			fmt.Println(step.Preview)
+		}
+	}
+}
+
+// applyPlan runs the planned steps in order and stops at the first one that fails. The plan is
+// cleared, steps after a failure are listed so they can be redone.
+func applyPlan() {
+	plan := core.GetPlan()
+	if len(plan) == 0 {
+		fmt.Println("The plan is empty.")
+		return
+	}
+	core.ClearPlan()
+
+	wasPlanMode := core.IsPlanMode()
+	core.SetPlanMode(false)
+	defer core.SetPlanMode(wasPlanMode)
+
+	for i, step := range plan {
+		fmt.Println(utils.ColoredText(fmt.Sprintf("Applying step %d/%d: %s", i+1, len(plan), step.Summary), utils.ColorCyan))
+		result := handleToolUse(step.Params)
+		log.LogDebug(fmt.Sprintf("Plan step %d applied: %s\nResult: %s\n", i+1, step.Summary, result))
+
+		failed := strings.HasPrefix(result, "Error") || strings.HasSuffix(result, "cancelled") ||
+			(step.Tool == "execute_command" && !strings.Contains(result, "[Exit code: 0]"))
+		if failed {
+			fmt.Println(utils.ColoredText(fmt.Sprintf("Step %d failed: %s", i+1, result), utils.ColorRed))
+			if i+1 < len(plan) {
+				fmt.Println("Not applied:")
+				for _, remaining := range plan[i+1:] {
+					fmt.Println("  " + remaining.Summary)
+				}
+			}
+			return
+		}
+	}
+	fmt.Println(utils.ColoredText(fmt.Sprintf("Applied all %d steps of the plan", len(plan)), utils.ColorGreen))
+}
+
+// Run interactive REPL, continuing the conversation of a restored session if one is given
+func runREPL(initialPrompt string, session *core.Session) {
 	conversation := []map[string]string{}
 	// Track truncation state
 	var currentDeletedRange [2]int
 
+	if session != nil {
+		conversation = session.Conversation
+		currentDeletedRange = session.DeletedRange
+		isAgentMode = session.AgentMode
+		fmt.Println(utils.ColoredText(fmt.Sprintf("Resumed session '%s' saved at %s (%d messages)",
+			session.Name, session.SavedAt.Format("2006-01-02 15:04"), len(conversation)), utils.ColorGreen))
+		if cwd, err := os.Getwd(); err == nil && session.CWD != "" && session.CWD != cwd {
+			fmt.Println(utils.ColoredText("Warning: the session was saved in "+session.CWD, utils.ColorYellow))
+		}
+	}
+
+	// Key for toggling auto-approve, configurable with auto_approve_key
+	autoApproveKey, autoApproveKeyName := getAutoApproveKey()
+
 	// Log REPL start in debug mode
 	log.LogDebug("Starting REPL session\n")
 	if initialPrompt != "" {
 		log.LogDebug(fmt.Sprintf("Initial prompt: %s\n", initialPrompt))
 	}
 
+	// Lines typed while a task runs are queued
+	queueTypedInput = true
+
 	// If there's an initial prompt, handle it first
 	if initialPrompt != "" {
 		handlePrompt(initialPrompt, &conversation, &currentDeletedRange)
 	} else {
 		fmt.Printf("NCA %s (%s,%s)\n", Version, BuildTime, CommitHash)
 		fmt.Println("Press Ctrl+A to toggle between [Agent] and [Ask] mode")
+		fmt.Printf("Press %s to toggle auto-approve for this session\n", autoApproveKeyName)
 		if log.IsDebugMode() {
 			fmt.Print(utils.ColoredText("Debug mode enabled. Logs saved to: "+log.GetDebugLogPath()+"\n", utils.ColorYellow))
 		}
 	}
 
-	// Create custom completer for commands
-	completer := readline.NewPrefixCompleter(
+	// Create custom completer for commands, the file paths of prompts are completed as well
+	commandItems := []readline.PrefixCompleterInterface{
 		readline.PcItem("/clear"),
+		readline.PcItem("/diff"),
+		readline.PcItem("/cost"),
+		readline.PcItem("/expand"),
+		readline.PcItem("/jobs"),
+		readline.PcItem("/logs", readline.PcItemDynamic(backgroundJobIDs)),
+		readline.PcItem("/kill", readline.PcItemDynamic(backgroundJobIDs)),
+		readline.PcItem("/compact"),
+		readline.PcItem("/paste-image"),
+		readline.PcItem("/edit"),
+		readline.PcItem("/undo"),
+		readline.PcItem("/continue"),
+		readline.PcItem("/lang",
+			readline.PcItem("auto"),
+			readline.PcItem("en"),
+			readline.PcItem("zh"),
+			readline.PcItem("ja"),
+		),
 		readline.PcItem("/checkpoint",
 			readline.PcItem("list"),
-			readline.PcItem("restore"),
+			readline.PcItem("show", readline.PcItemDynamic(checkpointIDs)),
+			readline.PcItem("diff", readline.PcItemDynamic(checkpointIDs)),
+			readline.PcItem("restore", readline.PcItemDynamic(checkpointIDs)),
 			readline.PcItem("redo"),
 		),
 		readline.PcItem("/config",
 			readline.PcItem("set"),
 			readline.PcItem("unset"),
 			readline.PcItem("list"),
+			readline.PcItem("profiles"),
 			readline.PcItem("--global"),
+			readline.PcItem("--profile"),
 		),
 		readline.PcItem("/mcp",
 			readline.PcItem("list"),
 			readline.PcItem("reload"),
+			readline.PcItem("add"),
+			readline.PcItem("remove"),
+			readline.PcItem("enable"),
+			readline.PcItem("disable"),
+			readline.PcItem("login"),
+			readline.PcItem("logout"),
+		),
+		readline.PcItem("/session",
+			readline.PcItem("save"),
+			readline.PcItem("list"),
+		),
+		readline.PcItem("/plan",
+			readline.PcItem("show"),
+			readline.PcItem("apply"),
+			readline.PcItem("discard"),
 		),
 		readline.PcItem("/help"),
 		readline.PcItem("/exit"),
-	)
-
-	// Create a custom interrupt handler
-	interruptHandler := func() {
-		if isProcessingAPIRequest && currentRequestCancel != nil {
-			// If an API request is in progress, cancel it
-			log.LogDebug("Cancelling current API request due to interrupt\n")
-			currentRequestCancel()
-			fmt.Println("\nAPI request cancelled")
-		}
 	}
+	for _, command := range core.ListCustomCommands() {
+		commandItems = append(commandItems, readline.PcItem("/"+command.Name))
+	}
+	commandCompleter := readline.NewPrefixCompleter(commandItems...)
+	completer := &promptCompleter{commands: commandCompleter}
 
-	// Get the appropriate prompt prefix based on current mode
+	// Get the appropriate prompt prefix based on current mode and auto-approve state
 	getPromptPrefix := func() string {
+		prefix := "[Ask]"
 		if isAgentMode {
-			return "[Agent]>>> "
+			prefix = "[Agent]"
+		}
+		if core.IsAutoApprove() {
+			prefix += "[Auto]"
 		}
-		return "[Ask]>>> "
+		return prefix + ">>> "
 	}
 
-	// Initialize readline configuration
+	// Initialize readline configuration, without a home directory there's no history file
+	historyFile := ""
+	if home, err := os.UserHomeDir(); err == nil {
+		historyFile = filepath.Join(home, ".nca_history")
+	}
 	rl, err := readline.NewEx(&readline.Config{
 		Prompt:            utils.ColoredText(getPromptPrefix(), utils.ColorPurple),
-		HistoryFile:       os.Getenv("HOME") + "/.nca_history",
+		HistoryFile:       historyFile,
 		InterruptPrompt:   "^C",
 		EOFPrompt:         "exit",
 		HistorySearchFold: true, // Case-insensitive history search
 		AutoComplete:      completer,
+		Listener:          completer,
 	})
 	if err != nil {
 		fmt.Println("Error initializing readline:", err)
@@ -339,6 +1215,7 @@ func runREPL(initialPrompt string) {
 
 	// Set up Ctrl+A key handling for mode switching
 	// When user presses Ctrl+A, switch between Agent and Ask modes
+	// The configurable auto-approve key toggles auto-approve in the same way
 	oldHandler := rl.Config.FuncFilterInputRune
 	rl.Config.FuncFilterInputRune = func(r rune) (rune, bool) {
 		if r == 1 { // Ctrl+A key (ASCII 1)
@@ -352,6 +1229,16 @@ func runREPL(initialPrompt string) {
 			}
 			return r, true // rl.Close will block the program if we return false here
 		}
+		if r == autoApproveKey {
+			// Flip auto-approve for the rest of the session
+			if !isProcessingAPIRequest {
+				enabled := core.ToggleAutoApprove()
+				rl.SetPrompt(utils.ColoredText(getPromptPrefix(), utils.ColorPurple))
+				rl.Refresh()
+				log.LogDebug(fmt.Sprintf("Auto-approve switched to: %t\n", enabled))
+			}
+			return r, true
+		}
 		// Pass to original handler if set
 		if oldHandler != nil {
 			return oldHandler(r)
@@ -366,7 +1253,7 @@ func runREPL(initialPrompt string) {
 	// Start signal handling goroutine
 	go func() {
 		for range signalChan {
-			interruptHandler()
+			handleInterrupt()
 		}
 	}()
 
@@ -375,6 +1262,11 @@ func runREPL(initialPrompt string) {
 	clipboardMode := false
 
 	for {
+		// Input typed while the last task ran is handled first
+		if handleQueuedInput(&conversation, &currentDeletedRange) {
+			break
+		}
+
 		// Read input using readline
 		input, err := rl.Readline()
 		if err != nil {
@@ -480,6 +1372,8 @@ func runREPL(initialPrompt string) {
 func handleExit(exitReason string) {
 	fmt.Println("Exiting")
 	log.LogDebug(fmt.Sprintf("User exited: %s\n", exitReason))
+	core.ReleaseFileLocks()
+	core.StopBackgroundJobs()
 
 	// Save checkpoints before exit
 	if err := checkpointManager.SaveCheckpoints(); err != nil {
@@ -499,8 +1393,8 @@ func handleInput(input string, conversation *[]map[string]string, currentDeleted
 		}
 		handleSlashCommand(input, conversation, currentDeletedRange)
 	} else {
-		// Normal input processing
-		handlePrompt(input, conversation, currentDeletedRange)
+		// Normal input processing, a number picks a suggested answer of the last followup question
+		handlePrompt(core.ResolveFollowupAnswer(input), conversation, currentDeletedRange)
 	}
 	return false // Indicates no need to exit
 }
@@ -516,20 +1410,10 @@ func runOneOffQuery(prompt string) {
 	signalChan := make(chan os.Signal, 1)
 	signal.Notify(signalChan, os.Interrupt)
 
-	// Create a custom interrupt handler
-	interruptHandler := func() {
-		if isProcessingAPIRequest && currentRequestCancel != nil {
-			// If an API request is in progress, cancel it
-			log.LogDebug("Cancelling current API request due to interrupt\n")
-			currentRequestCancel()
-			fmt.Println("\nAPI request cancelled")
-		}
-	}
-
 	// Start signal handling goroutine
 	go func() {
 		for range signalChan {
-			interruptHandler()
+			handleInterrupt()
 		}
 	}()
 
@@ -544,55 +1428,162 @@ func runOneOffQuery(prompt string) {
 
 // Handle user input prompt
 func handlePrompt(prompt string, conversation *[]map[string]string, currentDeletedRange *[2]int) {
+	// Images pasted since the last prompt are attached to it as @image references
+	for _, path := range pastedImages {
+		prompt += " @image:" + path
+	}
+	pastedImages = nil
+
 	// Create a checkpoint at the beginning of each prompt handling
 	checkpointManager.CreateCheckpoint(prompt)
+	lastPrompt.text = prompt
+	lastPrompt.content = ""
+	lastPrompt.checkpointID = checkpointManager.CurrentCheckpoint.ID
+	taskStepLimitReached = false
 
-	// Check if the prompt contains files or URLs to be processed
+	// Check if the prompt contains files, URLs or images to be processed
 	// This helps users understand that their files or URLs are being processed
-	if utils.HasBackticks(prompt) {
+	var imageIDs []string
+	if utils.HasBackticks(prompt) || utils.HasImageReferences(prompt) || utils.HasMentions(prompt) {
 		fmt.Print("\nProcessing resources in prompt... ")
-		log.LogDebug("Detected backticks in prompt, processing resources\n")
+		log.LogDebug("Detected backticks, mentions or image references in prompt, processing resources\n")
 
-		newPrompt, err := utils.ProcessPrompt(prompt)
+		newPrompt, images, err := utils.ProcessPrompt(prompt)
+		if err == nil {
+			imageIDs, err = core.SavePromptImages(images)
+		}
 		if err != nil {
 			fmt.Println(utils.ColoredText("Error processing prompt: "+err.Error(), utils.ColorRed))
 			return
 		}
 		prompt = newPrompt
 		fmt.Println("Done")
+		if len(imageIDs) > 0 {
+			reportAttachedImages(len(imageIDs))
+		}
 		fmt.Println()
 	}
 
-	// Add user message to conversation history
-	*conversation = append(*conversation, map[string]string{
+	// Add user message to conversation history, the first message of a conversation gets all
+	// environment details
+	if len(*conversation) == 0 {
+		core.ResetEnvironmentDetails()
+	}
+	lastPrompt.content = prompt + getEnvironmentDetails()
+	message := map[string]string{
 		"role":    "user",
-		"content": prompt + getEnvironmentDetails(),
-	})
+		"content": lastPrompt.content,
+	}
+	if len(imageIDs) > 0 {
+		message["images"] = strings.Join(imageIDs, ",")
+	}
+	*conversation = append(*conversation, message)
 
 	// Log user input in debug mode
 	log.LogDebug(fmt.Sprintf("USER INPUT (Mode: %s): %s\n",
 		map[bool]string{true: "Agent", false: "Ask"}[isAgentMode], prompt))
 
+	runTaskLoop(conversation, currentDeletedRange)
+}
+
+// pasteImage saves the image in the clipboard to a temporary file and attaches it to the next prompt
+func pasteImage() {
+	data, err := utils.GetClipboardImage()
+	if err != nil {
+		fmt.Println(utils.ColoredText("Failed to paste image: "+err.Error(), utils.ColorRed))
+		return
+	}
+
+	file, err := os.CreateTemp("", "nca-paste-*.png")
+	if err == nil {
+		_, err = file.Write(data)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		fmt.Println(utils.ColoredText("Failed to save the pasted image: "+err.Error(), utils.ColorRed))
+		return
+	}
+
+	pastedImages = append(pastedImages, file.Name())
+	utils.DisplayInlineImage(data, filepath.Base(file.Name()), "image/png")
+	fmt.Printf("Pasted image (%s) saved to %s, it's attached to the next prompt\n", utils.FormatSize(int64(len(data))), file.Name())
+	log.LogDebug(fmt.Sprintf("Pasted image saved to %s\n", file.Name()))
+}
+
+// modelSupportsImages returns whether images can be sent to a model
+func modelSupportsImages(modelInfo *types.ModelInfo) bool {
+	return modelInfo != nil && modelInfo.SupportsImages != nil && *modelInfo.SupportsImages
+}
+
+// reportAttachedImages tells the user that images were attached to the prompt, or that they
+// aren't sent because the model of the task can't read them
+func reportAttachedImages(count int) {
+	client, err := api.NewClientForRoute(taskRoute())
+	if err != nil || modelSupportsImages(client.GetModelInfo()) {
+		fmt.Printf("Attached %d image(s)\n", count)
+		return
+	}
+	name := "The model"
+	if modelInfo := client.GetModelInfo(); modelInfo != nil {
+		name = modelInfo.Name
+	}
+	fmt.Println(utils.ColoredText(fmt.Sprintf("%s doesn't support images, the %d attached image(s) aren't sent to it", name, count), utils.ColorYellow))
+}
+
+// runTaskLoop requests responses and runs their tools until the task is completed, fails or
+// reaches the step limit. It continues the conversation, so /continue can resume a task with it.
+func runTaskLoop(conversation *[]map[string]string, currentDeletedRange *[2]int) {
+	// Files edited by this task are locked until it ends
+	defer core.ReleaseFileLocks()
+	defer startTask()()
+
+	// The API requests and tool calls of the task are spans of its trace
+	span := core.StartSpan("nca.task", core.SpanKindInternal, map[string]interface{}{
+		"nca.mode": map[bool]string{true: "agent", false: "ask"}[isAgentMode],
+	})
+	defer span.End("")
+
 	// Count of consecutive responses without tool use
 	noToolUseCount := 0
 
 	// Message count limit
-	maxMessagesPerTask := 25
+	maxSteps := getMaxSteps()
+	maxMessagesPerTask := maxSteps
 
 	// Multi-step task processing loop
 	for {
+		// A double Ctrl+C stops the task, the conversation so far is kept for the next prompt
+		if taskAbortRequested.Load() {
+			fmt.Println(utils.ColoredText("Task aborted, the conversation is kept", utils.ColorYellow))
+			emitEvent("error", map[string]interface{}{"message": "Task aborted by the user"})
+			log.LogDebug("TASK ABORTED BY USER\n")
+			break
+		}
+
+		// Prompts typed during the last step steer the task
+		addQueuedPrompts(conversation)
+
 		// Check if message count has reached the limit
 		if maxMessagesPerTask <= 0 {
-			limitMessage := "Maximum of 25 requests per task reached, system has automatically exited"
+			if confirmStepLimitContinue(maxSteps) {
+				maxMessagesPerTask = maxSteps
+				continue
+			}
+			limitMessage := fmt.Sprintf("Maximum of %d requests per task reached, use /continue to resume the task", maxSteps)
 			fmt.Println(utils.ColoredText(limitMessage, utils.ColorYellow))
+			emitEvent("error", map[string]interface{}{"message": limitMessage})
 			log.LogDebug(fmt.Sprintf("MESSAGE LIMIT REACHED: %s\n", limitMessage))
+			taskStepLimitReached = true
 			break
 		}
 
-		// Create API client
-		client, err := api.NewClient()
+		// Create API client, with the model routed to the mode of the task
+		client, err := api.NewClientForRoute(taskRoute())
 		if err != nil {
-			fmt.Println("Error: Failed to create API client:", err)
+			printClientErrorHelp(err)
+			emitEvent("error", map[string]interface{}{"message": "Failed to create API client: " + err.Error()})
 			break
 		}
 		// Call API
@@ -600,6 +1591,7 @@ func handlePrompt(prompt string, conversation *[]map[string]string, currentDelet
 		if err != nil {
 			fmt.Println("Error calling API:", err)
 			log.LogDebug(fmt.Sprintf("API ERROR: %s\n", err))
+			emitEvent("error", map[string]interface{}{"message": "Error calling API: " + err.Error()})
 
 			// Add error message to conversation history
 			*conversation = append(*conversation, map[string]string{
@@ -610,6 +1602,15 @@ func handlePrompt(prompt string, conversation *[]map[string]string, currentDelet
 			break
 		}
 		debugPrintUsage(response.Usage)
+		if response.Usage != nil {
+			emitEvent("usage", map[string]interface{}{
+				"prompt_tokens":      response.Usage.PromptTokens,
+				"completion_tokens":  response.Usage.CompletionTokens,
+				"total_tokens":       response.Usage.TotalTokens,
+				"cache_read_tokens":  response.Usage.CacheReadTokens,
+				"cache_write_tokens": response.Usage.CacheWriteTokens,
+			})
+		}
 		maxMessagesPerTask--
 
 		// if the finish_reason is "length", it means the context length is insufficient, so we need to cut off the previous conversation
@@ -618,15 +1619,13 @@ func handlePrompt(prompt string, conversation *[]map[string]string, currentDelet
 			// If we can't truncate any more messages, exit
 			if newRange[1] <= newRange[0] {
 				fmt.Println(utils.ColoredText("Context length exceeded and cannot be truncated further. Please use /clear to start a new conversation.", utils.ColorRed))
+				emitEvent("error", map[string]interface{}{"message": "Context length exceeded and cannot be truncated further"})
 				break
 			}
 
 			// Update current deleted range
 			*currentDeletedRange = newRange
-
-			// Create new conversation slice with truncated messages
-			// Keep messages before the truncation range and after the truncation range
-			*conversation = append((*conversation)[:newRange[0]], (*conversation)[newRange[1]+1:]...)
+			core.TruncateConversation(conversation, newRange)
 
 			// Log truncation in debug mode
 			log.LogDebug(fmt.Sprintf("Context truncated. Removed messages %d-%d\n", newRange[0], newRange[1]))
@@ -635,14 +1634,41 @@ func handlePrompt(prompt string, conversation *[]map[string]string, currentDelet
 			continue
 		}
 
+		assistantMessage := map[string]string{
+			"role":    "assistant",
+			"content": response.Content,
+		}
+
 		// Check if there's a tool use request
-		toolUse := extractToolUse(response.Content)
+		var toolUse map[string]interface{}
+		var toolCallID string
+		useNativeTools := client.UseNativeTools()
+		if useNativeTools {
+			var toolCallErr error
+			toolUse, toolCallID, toolCallErr = extractToolCall(response.ToolCalls, assistantMessage)
+			if toolCallErr != nil {
+				// Let the model correct invalid arguments
+				log.LogDebug(fmt.Sprintf("ERROR: Invalid tool call: %s\n", toolCallErr))
+				*conversation = append(*conversation, assistantMessage, map[string]string{
+					"role":         "tool",
+					"tool_call_id": toolCallID,
+					"content":      fmt.Sprintf("Error: %s", toolCallErr),
+				})
+				continue
+			}
+			printToolCall(toolUse)
+		} else {
+			toolUse = extractToolUse(response.Content)
+		}
 
 		// Add AI response to conversation history
-		*conversation = append(*conversation, map[string]string{
-			"role":    "assistant",
-			"content": response.Content,
-		})
+		*conversation = append(*conversation, assistantMessage)
+
+		// The final answer of native tool calling is written as the result instead
+		toolName, _ := toolUse["tool"].(string)
+		if text := core.AssistantText(response.Content, toolName); text != "" && (toolUse != nil || !useNativeTools) {
+			emitEvent("assistant", map[string]interface{}{"text": text})
+		}
 
 		// Process tool use request
 		if toolUse != nil {
@@ -650,29 +1676,80 @@ func handlePrompt(prompt string, conversation *[]map[string]string, currentDelet
 			noToolUseCount = 0
 
 			// Log tool use in debug mode
-			toolName, _ := toolUse["tool"].(string)
 			log.LogDebug(fmt.Sprintf("TOOL USE: %v\n", toolUse))
 
+			// Tools ending the task are written as the result
+			isFinalTool := toolName == "attempt_completion" || toolName == "ask_mode_response" || toolName == "ask_followup_question"
+			if !isFinalTool {
+				emitEvent("tool_call", map[string]interface{}{"tool": toolName, "params": core.ToolCallParams(toolUse)})
+			}
+
 			result := handleToolUse(toolUse)
 			if toolName == "replace_in_file" {
-				lines := strings.SplitN(result, "\n", 2)
-				if len(lines) == 2 {
-					result = lines[0]
-					fmt.Println(lines[1])
+				var display string
+				if result, display = core.SplitReplaceResult(result); display != "" {
+					fmt.Println(display)
 				}
 			}
+			if !isFinalTool {
+				showToolResult(toolUse, result)
+			}
 
 			// Log tool result in debug mode
 			log.LogDebug(fmt.Sprintf("TOOL RESULT: %s\n", result))
+			if !isFinalTool {
+				emitEvent("tool_result", map[string]interface{}{"tool": toolName, "result": result})
+			}
+
+			// An accepted new_task request replaces the conversation with the handoff context
+			if toolName == "new_task" {
+				if handoff, ok := core.TakeHandoff(); ok {
+					startHandoffTask(handoff, conversation, currentDeletedRange)
+					noToolUseCount = 0
+					maxMessagesPerTask = maxSteps
+					continue
+				}
+			}
+
+			// Show the checklist when it changes, each finished step extends the request budget
+			if (toolName == "create_plan" || toolName == "update_plan_step") && !strings.HasPrefix(result, "Error") {
+				fmt.Println(core.RenderChecklist())
+				if core.TakeChecklistProgress() {
+					maxMessagesPerTask = maxSteps
+				}
+			}
 
 			// Get tool name (already extracted above)
 			// Check if it's the task completion tool
-			if toolName == "attempt_completion" {
-				fmt.Println(utils.ColoredText(result, utils.ColorYellow))
-				// Task completed, exit loop
-				break
-			}
-			if toolName == "ask_mode_response" || toolName == "ask_followup_question" {
+			// An invalid followup question is returned to the model like other tool errors
+			isQuestion := toolName == "ask_followup_question" && !strings.HasPrefix(result, "Error:")
+			if toolName == "attempt_completion" || toolName == "ask_mode_response" || isQuestion {
+				if toolName == "attempt_completion" {
+					fmt.Println(utils.ColoredText(result, utils.ColorYellow))
+					printChangedFiles()
+				}
+				if options := core.FormatFollowupOptions(); isQuestion && options != "" {
+					fmt.Println(utils.ColoredText(options, utils.ColorCyan))
+				}
+				switch toolName {
+				case "attempt_completion":
+					text, _ := toolUse["result"].(string)
+					emitResult(text)
+				case "ask_mode_response":
+					text, _ := toolUse["response"].(string)
+					emitResult(text)
+				default:
+					text, _ := toolUse["question"].(string)
+					emitResult(text)
+				}
+				// Every native tool call needs a result, the user's reply follows it
+				if toolCallID != "" {
+					*conversation = append(*conversation, map[string]string{
+						"role":         "tool",
+						"tool_call_id": toolCallID,
+						"content":      "Shown to the user",
+					})
+				}
 				// Task completed, exit loop
 				break
 			}
@@ -682,46 +1759,215 @@ func handlePrompt(prompt string, conversation *[]map[string]string, currentDelet
 
 			// Add tool result to conversation history with description
 			// some models return multiple tools, so we need to tell them to only use one tool per message
-			toolResultContent := fmt.Sprintf("%s Result:\n%s", toolDesc, result)
+			toolResultContent := fmt.Sprintf("%s Result:\n%s", toolDesc, result) + core.ChecklistReminder()
 			if _, exists := toolUse["has_multiple_tools"]; exists {
 				toolResultContent += "\n\nOnly one tool may be used per message. You must assess the first tool's result before proceeding to use the next tool."
 			}
-			*conversation = append(*conversation, map[string]string{
+			toolResultMessage := map[string]string{
 				"role":    "user",
 				"content": toolResultContent,
+			}
+			if toolCallID != "" {
+				toolResultMessage["role"] = "tool"
+				toolResultMessage["tool_call_id"] = toolCallID
+			}
+			// Images returned by the tool are attached when the model supports them
+			if images := core.TakePendingImages(); len(images) > 0 {
+				toolResultMessage["images"] = strings.Join(images, ",")
+			}
+			*conversation = append(*conversation, toolResultMessage)
+
+			// Continue loop, process next step
+		} else if useNativeTools {
+			// With native tool calling a response without tool calls is the final answer
+			fmt.Println()
+			emitResult(strings.TrimSpace(response.Content))
+			break
+		} else {
+			log.LogDebug(fmt.Sprintf("ERROR: No tool use response, content: %s\n", response.Content))
+			// Increment counter for responses without tool use
+			noToolUseCount++
+
+			// Check if exceeded 3 attempts without tool use
+			if noToolUseCount >= 3 {
+				errorMessage := "[FATAL ERROR] You failed to use a tool after 3 attempts. Exiting task."
+				log.LogDebug(fmt.Sprintf("ERROR: %s\n", errorMessage))
+				*conversation = append(*conversation, map[string]string{
+					"role":    "user",
+					"content": errorMessage,
+				})
+				fmt.Println(utils.ColoredText("System error. You can use /clear to start a new conversation.", utils.ColorRed))
+				emitEvent("error", map[string]interface{}{"message": "The model failed to use a tool after 3 attempts"})
+				break
+			}
+
+			// No tool use request, add error message to conversation history
+			errorMessage := fmt.Sprintf("[ERROR] You did not use a tool in your previous response! Please retry with a tool use. (Attempt %d/3)", noToolUseCount)
+			log.LogDebug(fmt.Sprintf("ERROR: %s\n", errorMessage))
+			*conversation = append(*conversation, map[string]string{
+				"role":    "user",
+				"content": errorMessage,
 			})
+			fmt.Println(utils.ColoredText("No available tools found", utils.ColorRed))
+			// Don't exit loop, continue requesting AI to use a tool
+		}
+		// Update the context messages
+		core.UpdateContextMessages(client.GetModelInfo(), conversation, currentDeletedRange, response.Usage)
+	}
+}
+
+// startHandoffTask archives the conversation and starts a new one seeded with the handoff context of new_task
+func startHandoffTask(handoff string, conversation *[]map[string]string, currentDeletedRange *[2]int) {
+	sessionName, err := core.ArchiveConversation(*conversation, isAgentMode, *currentDeletedRange)
+	if err != nil {
+		fmt.Println(utils.ColoredText(fmt.Sprintf("Warning: Failed to archive conversation: %s", err), utils.ColorRed))
+	} else {
+		fmt.Println(utils.ColoredText(fmt.Sprintf("Previous conversation archived as session '%s' (resume with nca --resume %s)", sessionName, sessionName), utils.ColorYellow))
+	}
+	log.LogDebug(fmt.Sprintf("New task started with handoff: %s\n", handoff))
+
+	core.ResetEnvironmentDetails()
+	*conversation = []map[string]string{{
+		"role":    "user",
+		"content": core.FormatHandoffPrompt(handoff) + getEnvironmentDetails(),
+	}}
+	*currentDeletedRange = [2]int{0, 0}
+	conversationTruncatedCount = 0
+	core.ClearFollowupOptions()
+	fmt.Println(utils.ColoredText("----------------New Task----------------", utils.ColorBlue))
+}
+
+// compactConversation replaces the conversation with a summary of it, a manual counterpart of the
+// truncation when the context window is full. The instructions steer what the summary keeps.
+func compactConversation(instructions string, conversation *[]map[string]string, currentDeletedRange *[2]int) {
+	if len(*conversation) == 0 {
+		fmt.Println("The conversation is empty, there is nothing to compact")
+		return
+	}
+
+	fmt.Println(utils.ColoredText("Summarizing the conversation...", utils.ColorCyan))
+	summary, err := completeWithSummarizer(core.BuildCompactPrompt(*conversation, instructions))
+	if err == nil && strings.TrimSpace(summary) == "" {
+		err = fmt.Errorf("the summary is empty")
+	}
+	if err != nil {
+		fmt.Println(utils.ColoredText("Failed to compact the conversation, it is unchanged: "+err.Error(), utils.ColorRed))
+		log.LogDebug(fmt.Sprintf("Failed to compact the conversation: %s\n", err))
+		return
+	}
+
+	tokensBefore := core.CountContextTokens(nil, *conversation)
+	messages := len(*conversation)
+	*conversation = core.CompactConversation(summary)
+	*currentDeletedRange = [2]int{0, 0}
+	conversationTruncatedCount = 0
+	// The next prompt carries all environment details again, and can't be edited or undone
+	core.ResetEnvironmentDetails()
+	lastPrompt.content = ""
+
+	fmt.Println(utils.ColoredText(fmt.Sprintf("Compacted %d messages into a summary, the context went from about %d to %d tokens",
+		messages, tokensBefore, core.CountContextTokens(nil, *conversation)), utils.ColorYellow))
+	fmt.Println(summary)
+	log.LogDebug(fmt.Sprintf("Conversation compacted (instructions: %q):\n%s\n", instructions, summary))
+}
+
+// editLastPrompt opens the last prompt in the editor. The edited prompt replaces it: the turns
+// after it are discarded, the files are restored to the checkpoint taken at the prompt, and
+// the edited prompt is run.
+func editLastPrompt(conversation *[]map[string]string, currentDeletedRange *[2]int) {
+	index := findLastPrompt(*conversation)
+	if index < 0 {
+		fmt.Println("No prompt to edit in this conversation")
+		return
+	}
+
+	edited, err := utils.EditText(lastPrompt.text)
+	if err != nil {
+		fmt.Println(utils.ColoredText("Error editing prompt: "+err.Error(), utils.ColorRed))
+		return
+	}
+	edited = strings.TrimSpace(edited)
+	if edited == "" {
+		fmt.Println("Edit cancelled, the prompt is empty")
+		return
+	}
+
+	result := checkpointManager.RestoreCheckpoint(lastPrompt.checkpointID)
+	fmt.Println(result)
+	if strings.HasPrefix(result, "Error") {
+		return
+	}
+	log.LogDebug(fmt.Sprintf("Prompt edited, discarding %d messages: %s\n", len(*conversation)-index, edited))
+
+	*conversation = (*conversation)[:index]
+	core.ClearFollowupOptions()
+	// The discarded prompt may have been the only one with some environment details
+	core.ResetEnvironmentDetails()
+	handlePrompt(edited, conversation, currentDeletedRange)
+}
+
+// undoLastPrompt undoes the last prompt: the files are restored to the checkpoint taken at the
+// prompt, and the prompt and the turns after it are removed from the conversation. The
+// conversation is only changed if all files were restored.
+func undoLastPrompt(conversation *[]map[string]string) {
+	index := findLastPrompt(*conversation)
+	if index < 0 {
+		fmt.Println("Nothing to undo, /undo removes the last prompt of this conversation and restores the files it changed")
+		return
+	}
 
-			// Continue loop, process next step
-		} else {
-			log.LogDebug(fmt.Sprintf("ERROR: No tool use response, content: %s\n", response.Content))
-			// Increment counter for responses without tool use
-			noToolUseCount++
+	result := checkpointManager.RestoreCheckpoint(lastPrompt.checkpointID)
+	if !strings.Contains(result, "successfully restored") {
+		fmt.Println(utils.ColoredText(result, utils.ColorRed))
+		fmt.Println("The conversation was not changed")
+		return
+	}
+	log.LogDebug(fmt.Sprintf("Last prompt undone, discarding %d messages: %s\n", len(*conversation)-index, lastPrompt.text))
+
+	removed := len(*conversation) - index
+	*conversation = (*conversation)[:index]
+	lastPrompt.content = ""
+	taskStepLimitReached = false
+	core.ClearFollowupOptions()
+	// The discarded prompt may have been the only one with some environment details
+	core.ResetEnvironmentDetails()
+	fmt.Println(utils.ColoredText(fmt.Sprintf("Undid the last prompt: the files were restored to checkpoint %s and %d messages were removed from the conversation", lastPrompt.checkpointID, removed), utils.ColorYellow))
+}
 
-			// Check if exceeded 3 attempts without tool use
-			if noToolUseCount >= 3 {
-				errorMessage := "[FATAL ERROR] You failed to use a tool after 3 attempts. Exiting task."
-				log.LogDebug(fmt.Sprintf("ERROR: %s\n", errorMessage))
-				*conversation = append(*conversation, map[string]string{
-					"role":    "user",
-					"content": errorMessage,
-				})
-				fmt.Println(utils.ColoredText("System error. You can use /clear to start a new conversation.", utils.ColorRed))
-				break
-			}
+// findLastPrompt returns the index of the message of the last prompt in the conversation, or -1
+// if it was truncated from the conversation or replaced by a new task
+func findLastPrompt(conversation []map[string]string) int {
+	if lastPrompt.content == "" {
+		return -1
+	}
+	for i := len(conversation) - 1; i >= 0; i-- {
+		if conversation[i]["role"] == "user" && conversation[i]["content"] == lastPrompt.content {
+			return i
+		}
+	}
+	return -1
+}
 
-			// No tool use request, add error message to conversation history
-			errorMessage := fmt.Sprintf("[ERROR] You did not use a tool in your previous response! Please retry with a tool use. (Attempt %d/3)", noToolUseCount)
-			log.LogDebug(fmt.Sprintf("ERROR: %s\n", errorMessage))
-			*conversation = append(*conversation, map[string]string{
-				"role":    "user",
-				"content": errorMessage,
-			})
-			fmt.Println(utils.ColoredText("No available tools found", utils.ColorRed))
-			// Don't exit loop, continue requesting AI to use a tool
+// printChangedFiles prints the files changed during the task and the snapshots taken before
+// risky operations when it is completed
+func printChangedFiles() {
+	if snapshots := checkpointManager.TaskSnapshots(); len(snapshots) > 0 {
+		fmt.Println(utils.ColoredText("Snapshots taken:", utils.ColorCyan))
+		for _, snapshot := range snapshots {
+			fmt.Printf("  %s  before %s\n", snapshot.ID, snapshot.Snapshot)
 		}
-		// Update the context messages
-		core.UpdateContextMessages(client.GetModelInfo(), conversation, currentDeletedRange, response.Usage)
+		fmt.Println(utils.ColoredText("Use /checkpoint restore <checkpoint_id> to go back to one", utils.ColorCyan))
+	}
+
+	files := checkpointManager.ChangedFiles()
+	if len(files) == 0 {
+		return
+	}
+	fmt.Println(utils.ColoredText("Files changed:", utils.ColorCyan))
+	for _, file := range files {
+		fmt.Printf("  %s\n", file)
 	}
+	fmt.Println(utils.ColoredText("Use /diff to review the changes", utils.ColorCyan))
 }
 
 // Format tool description based on tool type and parameters
@@ -747,6 +1993,58 @@ func formatToolDescription(toolUse map[string]interface{}) string {
 		path, _ := toolUse["path"].(string)
 		return fmt.Sprintf("[%s for '%s']", toolName, path)
 
+	case "get_file_diff":
+		path, _ := toolUse["path"].(string)
+		if base, ok := toolUse["base"].(string); ok && base != "" {
+			return fmt.Sprintf("[%s for '%s' against '%s']", toolName, path, base)
+		}
+		return fmt.Sprintf("[%s for '%s']", toolName, path)
+
+	case "git_status", "git_diff", "git_log", "git_branch":
+		var details []string
+		for _, param := range []string{"ref", "base", "path"} {
+			if value, ok := toolUse[param].(string); ok && value != "" {
+				details = append(details, fmt.Sprintf("'%s'", value))
+			}
+		}
+		if len(details) > 0 {
+			return fmt.Sprintf("[%s for %s]", toolName, strings.Join(details, " in "))
+		}
+		return fmt.Sprintf("[%s]", toolName)
+
+	case "git_stage_hunks":
+		path, _ := toolUse["path"].(string)
+		if hunks, ok := toolUse["hunks"].(string); ok && hunks != "" {
+			return fmt.Sprintf("[%s %s for '%s']", toolName, hunks, path)
+		}
+		return fmt.Sprintf("[%s for '%s']", toolName, path)
+
+	case "read_job_output":
+		jobID, _ := toolUse["job_id"].(string)
+		return fmt.Sprintf("[%s for job %s]", toolName, jobID)
+
+	case "verify_build":
+		if path, ok := toolUse["path"].(string); ok && path != "" {
+			return fmt.Sprintf("[%s for '%s']", toolName, path)
+		}
+		return "[verify_build]"
+
+	case "read_files":
+		paths, _ := toolUse["paths"].([]string)
+		return fmt.Sprintf("[%s for '%s']", toolName, strings.Join(paths, ", "))
+
+	case "write_files":
+		files, _ := toolUse["files"].([]core.FileWrite)
+		paths := make([]string, 0, len(files))
+		for _, file := range files {
+			paths = append(paths, file.Path)
+		}
+		return fmt.Sprintf("[%s for '%s']", toolName, strings.Join(paths, ", "))
+
+	case "apply_patch":
+		patch, _ := toolUse["patch"].(string)
+		return fmt.Sprintf("[%s for '%s']", toolName, strings.Join(core.PatchFiles(patch), ", "))
+
 	case "search_files":
 		regex, _ := toolUse["regex"].(string)
 		filePattern, hasPattern := toolUse["file_pattern"].(string)
@@ -766,7 +2064,21 @@ func formatToolDescription(toolUse map[string]interface{}) string {
 
 		return fmt.Sprintf("[%s for message '%s']", toolName, message)
 
-	case "use_mcp_tool":
+	case "read_issue":
+		issue, _ := toolUse["issue"].(string)
+		return fmt.Sprintf("[%s for '%s']", toolName, issue)
+
+	case "create_pull_request":
+		title, _ := toolUse["title"].(string)
+		return fmt.Sprintf("[%s for '%s']", toolName, title)
+
+	case "comment_on_pr", "list_pr_review_comments":
+		if pr, ok := toolUse["pr"].(string); ok && pr != "" {
+			return fmt.Sprintf("[%s for '%s']", toolName, pr)
+		}
+		return fmt.Sprintf("[%s for the current branch]", toolName)
+
+	case "use_mcp_tool", "describe_mcp_tool":
 		serverName, _ := toolUse["server_name"].(string)
 		toolNameParam, _ := toolUse["tool_name"].(string)
 		return fmt.Sprintf("[%s for server '%s', tool '%s']", toolName, serverName, toolNameParam)
@@ -779,11 +2091,83 @@ func formatToolDescription(toolUse map[string]interface{}) string {
 	case "find_files":
 		return "[find_files]"
 
+	case "download_file":
+		url, _ := toolUse["url"].(string)
+		path, _ := toolUse["path"].(string)
+		return fmt.Sprintf("[%s for '%s' to '%s']", toolName, url, path)
+
+	case "new_task":
+		return "[new_task]"
+
+	case "create_plan":
+		return "[create_plan]"
+
+	case "update_plan_step":
+		step, _ := toolUse["step"].(string)
+		status, _ := toolUse["status"].(string)
+		return fmt.Sprintf("[%s for step %s: %s]", toolName, step, status)
+
+	case "spawn_subtask":
+		goal, _ := toolUse["goal"].(string)
+		return fmt.Sprintf("[%s for '%s']", toolName, goal)
+
+	case "get_artifact":
+		id, _ := toolUse["id"].(string)
+		if rangeStr, ok := toolUse["range"].(string); ok && rangeStr != "" {
+			return fmt.Sprintf("[%s for '%s' lines %s]", toolName, id, rangeStr)
+		}
+		return fmt.Sprintf("[%s for '%s']", toolName, id)
+
 	default:
 		return fmt.Sprintf("[%s]", toolName)
 	}
 }
 
+// handleMcpServerCommand adds, removes, enables or disables a server in the MCP settings file
+func handleMcpServerCommand(action string, args []string) {
+	hub := mcp.GetMcpHub()
+	var err error
+	switch {
+	case action == "add" && len(args) >= 2:
+		// A URL adds an SSE server, anything else is the command of a stdio server
+		config := &mcp.ServerConfig{TransportType: mcp.TransportTypeStdio, Command: args[1], Args: args[2:]}
+		if strings.HasPrefix(args[1], "http://") || strings.HasPrefix(args[1], "https://") {
+			if len(args) > 2 {
+				fmt.Println("Usage: /mcp add <name> <sse_url>")
+				return
+			}
+			config = &mcp.ServerConfig{TransportType: mcp.TransportTypeSSE, URL: args[1]}
+		}
+		err = hub.AddServer(args[0], config)
+	case action == "add":
+		fmt.Println("Usage: /mcp add <name> <command> [args...] or /mcp add <name> <sse_url>")
+		return
+	case len(args) != 1:
+		fmt.Printf("Usage: /mcp %s <name>\n", action)
+		return
+	case action == "remove":
+		err = hub.RemoveServer(args[0])
+	case action == "login":
+		err = hub.Login(args[0])
+	case action == "logout":
+		err = hub.Logout(args[0])
+	default:
+		err = hub.SetServerDisabled(args[0], action == "disable")
+	}
+	if err != nil {
+		fmt.Println(utils.ColoredText("Error: "+err.Error(), utils.ColorRed))
+		return
+	}
+
+	pastTense := map[string]string{"add": "added", "remove": "removed", "enable": "enabled", "disable": "disabled",
+		"login": "authorized", "logout": "logged out"}
+	fmt.Println(utils.ColoredText(fmt.Sprintf("MCP server %s %s", args[0], pastTense[action]), utils.ColorGreen))
+	log.LogDebug(fmt.Sprintf("MCP server %s: %s\n", pastTense[action], args[0]))
+	if action != "remove" && action != "logout" {
+		hub.PrintConnections()
+	}
+}
+
 // Handle slash command
 func handleSlashCommand(cmd string, conversation *[]map[string]string, currentDeletedRange *[2]int) {
 	// Handle /checkpoint command
@@ -800,7 +2184,7 @@ func handleSlashCommand(cmd string, conversation *[]map[string]string, currentDe
 		return
 	}
 
-	// Handle /config command, format: "/config [set|unset|list] [--global] [key] [value]"
+	// Handle /config command, format: "/config [set|unset|list|profiles] [--global|--profile name] [key] [value]"
 	if strings.HasPrefix(cmd, "/config") {
 		args := strings.Fields(cmd)
 		if len(args) > 1 {
@@ -808,17 +2192,19 @@ func handleSlashCommand(cmd string, conversation *[]map[string]string, currentDe
 			handleConfigCommand(args[1:])
 		} else {
 			// If there's only "/config" without other arguments, show usage
-			fmt.Println("Usage: /config [set|unset|list] [--global] [key] [value]")
+			fmt.Println("Usage: /config [set|unset|list|profiles] [--global|--profile name] [key] [value]")
 		}
 		log.LogDebug(fmt.Sprintf("Config command executed in interactive mode: %s\n", cmd))
 		return
 	}
 
-	// Handle /mcp command, format: "/mcp [list|reload]"
+	// Handle /mcp command, format: "/mcp [list|reload|add|remove|enable|disable|login|logout] [name]"
 	if strings.HasPrefix(cmd, "/mcp") {
 		args := strings.Fields(cmd)
 		if len(args) > 1 {
 			switch args[1] {
+			case "add", "remove", "enable", "disable", "login", "logout":
+				handleMcpServerCommand(args[1], args[2:])
 			case "list":
 				// Get MCPHub and show server connections
 				mcp.GetMcpHub().PrintConnections()
@@ -830,39 +2216,197 @@ func handleSlashCommand(cmd string, conversation *[]map[string]string, currentDe
 				mcp.GetMcpHub().PrintConnections()
 				log.LogDebug("MCP reload command executed\n")
 			default:
-				fmt.Println("Unknown MCP command. Available commands: list, reload")
+				fmt.Println("Unknown MCP command. Available commands: list, reload, add, remove, enable, disable, login, logout")
 			}
 		} else {
 			// If there's only "/mcp" without other arguments, show usage
-			fmt.Println("Usage: /mcp [list|reload]")
+			fmt.Println("Usage: /mcp [list|reload|add|remove|enable|disable|login|logout] [name]")
+		}
+		return
+	}
+
+	// Handle /lang command, format: "/lang [code|name|auto]"
+	if cmd == "/lang" || strings.HasPrefix(cmd, "/lang ") {
+		handleLangCommand(strings.Fields(cmd)[1:])
+		return
+	}
+
+	// Handle /session command, format: "/session [save|list] [name]"
+	if strings.HasPrefix(cmd, "/session") {
+		args := strings.Fields(cmd)
+		if len(args) < 2 {
+			fmt.Println("Usage: /session [save|list] [name]")
+			return
+		}
+		switch args[1] {
+		case "save":
+			session := &core.Session{
+				SystemPrompt: core.GetSystemPromptVariant(),
+				AgentMode:    isAgentMode,
+				DeletedRange: *currentDeletedRange,
+				Conversation: *conversation,
+			}
+			if len(args) > 2 {
+				session.Name = args[2]
+			}
+			if prompt := core.BuildTitlePrompt(*conversation); prompt != "" {
+				if title, err := completeWithSummarizer(prompt); err == nil {
+					session.Title = strings.Trim(strings.SplitN(title, "\n", 2)[0], "\"' ")
+				} else {
+					log.LogDebug(fmt.Sprintf("Failed to generate session title: %s\n", err))
+				}
+			}
+			if err := core.SaveSession(session); err != nil {
+				fmt.Println(utils.ColoredText("Error saving session: "+err.Error(), utils.ColorRed))
+				return
+			}
+			fmt.Printf("Session saved as '%s', resume it with: nca --resume %s\n", session.Name, session.Name)
+			log.LogDebug(fmt.Sprintf("Session saved: %s\n", session.Name))
+		case "list":
+			sessions, err := core.ListSessions()
+			if err != nil {
+				fmt.Println(utils.ColoredText("Error listing sessions: "+err.Error(), utils.ColorRed))
+				return
+			}
+			if len(sessions) == 0 {
+				fmt.Println("No saved sessions found.")
+				return
+			}
+			fmt.Printf("%-25s %-17s %-9s %-30s %s\n", "NAME", "SAVED AT", "MESSAGES", "DIRECTORY", "TITLE")
+			for _, session := range sessions {
+				fmt.Printf("%s %-17s %-9d %s %s\n", utils.PadRight(session.Name, 25), session.SavedAt.Format("2006-01-02 15:04"),
+					len(session.Conversation), utils.PadRight(session.CWD, 30), session.Title)
+			}
+		default:
+			fmt.Println("Unknown session command. Available commands: save, list")
 		}
 		return
 	}
 
+	// Handle /compact command, format: "/compact [instructions]"
+	if cmd == "/compact" || strings.HasPrefix(cmd, "/compact ") {
+		compactConversation(strings.TrimSpace(strings.TrimPrefix(cmd, "/compact")), conversation, currentDeletedRange)
+		return
+	}
+
+	// Handle /plan command, format: "/plan [show|apply|discard]"
+	if cmd == "/plan" || strings.HasPrefix(cmd, "/plan ") {
+		handlePlanCommand(strings.Fields(cmd)[1:])
+		return
+	}
+
+	// Handle /logs and /kill commands, format: "/logs <job_id>" and "/kill <job_id>"
+	if cmd == "/logs" || strings.HasPrefix(cmd, "/logs ") {
+		handleLogsCommand(strings.Fields(cmd)[1:])
+		return
+	}
+	if cmd == "/kill" || strings.HasPrefix(cmd, "/kill ") {
+		handleKillCommand(strings.Fields(cmd)[1:])
+		return
+	}
+
 	switch cmd {
 	case "/clear":
 		*conversation = []map[string]string{}
 		*currentDeletedRange = [2]int{0, 0}
 		conversationTruncatedCount = 0
+		core.ClearFollowupOptions()
+		core.ClearChecklist()
+		taskStepLimitReached = false
+		core.ResetWorkingDir()
+		endScratchTask()
+		checkpointManager.StartTask()
+		lastPrompt.content = ""
 		fmt.Println("Conversation history cleared")
 		fmt.Println(utils.ColoredText("----------------New Chat----------------", utils.ColorBlue))
 		log.LogDebug("Conversation history cleared by user\n")
+	case "/edit":
+		editLastPrompt(conversation, currentDeletedRange)
+	case "/undo":
+		undoLastPrompt(conversation)
+	case "/continue":
+		if !taskStepLimitReached {
+			fmt.Println("No task to continue, /continue resumes a task that stopped at the step limit (max_steps)")
+			return
+		}
+		taskStepLimitReached = false
+		log.LogDebug("Continuing the task after the step limit\n")
+		runTaskLoop(conversation, currentDeletedRange)
+	case "/diff":
+		fmt.Print(checkpointManager.DiffChangedFiles())
+		log.LogDebug("Diff of changed files displayed\n")
+	case "/paste-image":
+		pasteImage()
+	case "/cost":
+		fmt.Println(core.FormatSessionUsage(core.GetSessionUsage()))
+		log.LogDebug("Session usage displayed\n")
+	case "/jobs":
+		handleJobsCommand()
+	case "/expand":
+		description, output, ok := core.LastToolOutput()
+		if !ok {
+			fmt.Println("No tool output to show yet")
+			return
+		}
+		fmt.Println(utils.ColoredText(description, utils.ColorBlue))
+		fmt.Println(output)
+		log.LogDebug("Last tool output displayed\n")
 	case "/help":
 		fmt.Println("\nINTERACTIVE COMMANDS:")
 		fmt.Println("  /clear      - Clear conversation history")
+		fmt.Println("  /continue   - Continue a task that stopped at the step limit (max_steps)")
 		fmt.Println("  /config     - Manage configuration settings")
-		fmt.Println("               Usage: /config [set|unset|list] [--global] [key] [value]")
+		fmt.Println("               Usage: /config [set|unset|list|profiles] [--global|--profile name] [key] [value]")
+		fmt.Println("  /diff       - Show the changes made to files in this task")
+		fmt.Println("  /cost       - Show the tokens used in this session, the cache hits and the estimated cost")
+		fmt.Println("  /expand     - Show the full output of the last tool")
+		fmt.Println("  /jobs       - List the commands running in the background")
+		fmt.Println("  /logs       - Show the output of a background job")
+		fmt.Println("               Usage: /logs <job_id>")
+		fmt.Println("  /kill       - Stop a background job and the processes it started")
+		fmt.Println("               Usage: /kill <job_id>")
+		fmt.Println("  /compact    - Replace the conversation with a summary to free the context window")
+		fmt.Println("               Usage: /compact [instructions], e.g. /compact keep details about the auth refactor")
+		fmt.Println("  /paste-image - Attach the image in the clipboard to the next prompt, for vision models")
+		fmt.Println("  /edit       - Edit the last prompt in $EDITOR, undo its changes and run it again")
+		fmt.Println("  /undo       - Undo the last prompt: restore the files it changed and remove it from the conversation")
+		fmt.Println("  /lang       - Show or change the answer language of this session")
+		fmt.Println("               Usage: /lang [code|name|auto]")
 		fmt.Println("  /checkpoint - Manage checkpoints")
-		fmt.Println("               Usage: /checkpoint [list|restore|redo] [checkpoint_id]")
+		fmt.Println("               Usage: /checkpoint [list|show|diff|restore|redo] [checkpoint_id]")
 		fmt.Println("  /mcp        - Manage MCP server connections")
-		fmt.Println("               Usage: /mcp [list|reload]")
+		fmt.Println("               Usage: /mcp [list|reload|add|remove|enable|disable|login|logout] [name]")
+		fmt.Println("               Add a server: /mcp add <name> <command> [args...] or /mcp add <name> <sse_url>")
+		fmt.Println("               Authorize an SSE server with OAuth: /mcp login <name>")
+		fmt.Println("  /session    - Save the conversation to resume it later")
+		fmt.Println("               Usage: /session [save|list] [name]")
+		fmt.Println("  /plan       - Toggle plan mode, which previews changes and commands instead of running them")
+		fmt.Println("               Usage: /plan [show|apply|discard]")
 		fmt.Println("  /exit       - Exit the program")
 		fmt.Println("  /help       - Show help information")
+		if commands := core.ListCustomCommands(); len(commands) > 0 {
+			fmt.Println("\nCUSTOM COMMANDS:")
+			for _, command := range commands {
+				fmt.Printf("  /%-10s - %s\n", command.Name, command.Description)
+			}
+		}
 		log.LogDebug("Help information displayed\n")
 	case "/exit":
 		// These are handled in the runREPL function
 		// Nothing to do here
 	default:
+		// Commands of .nca/commands and ~/.nca/commands expand into a prompt
+		name, args, _ := strings.Cut(strings.TrimPrefix(cmd, "/"), " ")
+		if command := core.LoadCustomCommand(name); command != nil {
+			prompt, err := command.Expand(args)
+			if err != nil {
+				fmt.Println(utils.ColoredText("Error: "+err.Error(), utils.ColorRed))
+				return
+			}
+			log.LogDebug(fmt.Sprintf("Custom command %s from %s\n", name, command.Source))
+			handlePrompt(prompt, conversation, currentDeletedRange)
+			return
+		}
 		fmt.Println("Unknown command. Enter /help for help")
 		log.LogDebug(fmt.Sprintf("Unknown command attempted: %s\n", cmd))
 	}
@@ -870,10 +2414,63 @@ func handleSlashCommand(cmd string, conversation *[]map[string]string, currentDe
 
 // API response structure
 type APIResponse struct {
-	ReasoningContent string       `json:"reasoning_content"`
-	Content          string       `json:"content"`
-	Usage            *types.Usage `json:"usage"`
-	FinishReason     string       `json:"finish_reason"`
+	ReasoningContent string           `json:"reasoning_content"`
+	Content          string           `json:"content"`
+	Usage            *types.Usage     `json:"usage"`
+	FinishReason     string           `json:"finish_reason"`
+	ToolCalls        []types.ToolCall `json:"tool_calls,omitempty"` // Only set when native tool calling is used
+}
+
+// Size at which streamed text is written without waiting for the flush interval
+const streamFlushMaxBytes = 4096
+
+// getStreamFlushInterval returns how often streamed text is written to the terminal, set with
+// stream_flush_ms. 0 writes every chunk right away.
+func getStreamFlushInterval() time.Duration {
+	if value := config.Get("stream_flush_ms"); value != "" {
+		if ms, err := strconv.Atoi(value); err == nil && ms >= 0 {
+			return time.Duration(ms) * time.Millisecond
+		}
+	}
+	return 30 * time.Millisecond
+}
+
+// Default number of requests a task makes before it stops, set with max_steps
+const defaultMaxSteps = 25
+
+// getMaxSteps returns how many requests a task makes before it stops
+func getMaxSteps() int {
+	if value := config.Get("max_steps"); value != "" {
+		if steps, err := strconv.Atoi(value); err == nil && steps > 0 {
+			return steps
+		}
+	}
+	return defaultMaxSteps
+}
+
+// taskRoute returns the route of the requests of a task, which selects their model if one is
+// configured for it with router.<route>
+func taskRoute() string {
+	switch {
+	case core.IsPlanMode():
+		return api.RoutePlan
+	case !isAgentMode:
+		return api.RouteAsk
+	default:
+		return api.RouteEdit
+	}
+}
+
+// confirmStepLimitContinue asks whether a task that reached the step limit should make another
+// maxSteps requests, if max_steps_prompt is enabled and the user can answer
+func confirmStepLimitContinue(maxSteps int) bool {
+	if value := config.Get("max_steps_prompt"); (value != "true" && value != "1") || eventWriter != nil || !core.CanAskUser() {
+		return false
+	}
+	fmt.Printf("The task reached the limit of %d requests. Continue for another %d? (y/n): ", maxSteps, maxSteps)
+	var response string
+	fmt.Fscanln(core.Input, &response)
+	return strings.ToLower(response) == "y"
 }
 
 // Call AI API
@@ -885,6 +2482,9 @@ func callAPI(client *api.Client, conversation []map[string]string) (APIResponse,
 	defer func() {
 		isProcessingAPIRequest = false
 	}()
+	requestID := log.NextRequestID()
+	lastRequestID = requestID
+	start := time.Now()
 
 	// Create a cancellable context
 	ctx, cancel := context.WithCancel(context.Background())
@@ -902,6 +2502,23 @@ func callAPI(client *api.Client, conversation []map[string]string) (APIResponse,
 		return APIResponse{}, fmt.Errorf("error building system prompt: %s", err)
 	}
 
+	// With native tool calling the tools are sent as function definitions instead of XML documentation
+	useNativeTools := client.UseNativeTools()
+	var tools []types.ToolDefinition
+	if useNativeTools {
+		tools = core.BuildToolDefinitions(systemPrompt)
+		systemPrompt = core.AdaptSystemPromptForNativeTools(systemPrompt)
+	}
+
+	// Keep the size of the system prompt for the context budget of the conversation
+	tokenCounter := core.GetTokenCounter(client.GetModelInfo().Name)
+	systemPromptTokens := tokenCounter.Count(systemPrompt)
+	if len(tools) > 0 {
+		toolsJSON, _ := json.Marshal(tools)
+		systemPromptTokens += tokenCounter.Count(string(toolsJSON))
+	}
+	core.SetSystemPromptTokens(systemPromptTokens)
+
 	// Prepare messages
 	messages := []types.Message{
 		{
@@ -911,20 +2528,30 @@ func callAPI(client *api.Client, conversation []map[string]string) (APIResponse,
 	}
 
 	// Add conversation history
+	modelInfo := client.GetModelInfo()
+	supportsImages := modelSupportsImages(modelInfo)
 	for _, msg := range conversation {
-		messages = append(messages, types.Message{
-			Role:    msg["role"],
-			Content: msg["content"],
-		})
+		message := types.Message{
+			Role:       msg["role"],
+			Content:    msg["content"],
+			ToolCallID: msg["tool_call_id"],
+		}
+		if msg["tool_calls"] != "" {
+			json.Unmarshal([]byte(msg["tool_calls"]), &message.ToolCalls)
+		}
+		if supportsImages && msg["images"] != "" {
+			message.Images = core.LoadArtifactImages(strings.Split(msg["images"], ","))
+		}
+		messages = append(messages, message)
 	}
 
 	// Log API request in debug mode
-	log.LogDebug("API REQUEST PAYLOAD:\n")
+	log.LogDebug(fmt.Sprintf("API REQUEST PAYLOAD (%s):\n", requestID))
 	for i, msg := range messages {
 		// Truncate system message for brevity in logs
 		content := msg.Content
 		if msg.Role == "system" && len(content) > 100 {
-			content = content[:100] + "... [truncated]"
+			content = utils.TruncateToWidth(content, 100) + "... [truncated]"
 		}
 		log.LogDebug(fmt.Sprintf("  [%d] %s: %s\n", i, msg.Role, content))
 	}
@@ -934,8 +2561,15 @@ func callAPI(client *api.Client, conversation []map[string]string) (APIResponse,
 	animationDone := make(chan bool, 1) // Channel to confirm animation has stopped
 	go showLoadingAnimation(stopLoading, animationDone)
 
-	// Create a filter for XML tags
+	// Create a filter for XML tags, the Markdown of the response is rendered unless the output is
+	// piped or ui.render_markdown is false
 	filter := core.NewXMLTagFilter()
+	if !utils.IsOutputPiped() && config.Get("ui.render_markdown") != "false" {
+		filter.SetMarkdownRenderer(utils.NewMarkdownRenderer())
+	}
+
+	// Coalesce the streamed chunks so fast providers don't flood slow terminals
+	output := utils.NewOutputBuffer(os.Stdout, getStreamFlushInterval(), streamFlushMaxBytes)
 
 	// Flag to track if animation has been stopped
 	var animationStopped bool = false
@@ -947,6 +2581,7 @@ func callAPI(client *api.Client, conversation []map[string]string) (APIResponse,
 		content          string
 		usage            *types.Usage
 		finishReason     string
+		toolCalls        []types.ToolCall
 		err              error
 	}, 1)
 
@@ -965,6 +2600,7 @@ func callAPI(client *api.Client, conversation []map[string]string) (APIResponse,
 			if reasoningChunk != "" {
 				if !startReasoning {
 					startReasoning = true
+					output.Flush()
 					fmt.Println(utils.ColoredText("Reasoning:", utils.ColorBlue))
 				}
 				// Stop loading animation when first reasoning chunk is received
@@ -973,9 +2609,10 @@ func callAPI(client *api.Client, conversation []map[string]string) (APIResponse,
 					<-animationDone // Wait for animation to actually stop
 					animationStopped = true
 				}
-				fmt.Print(reasoningChunk)
+				output.WriteString(reasoningChunk)
 			} else if chunk != "" {
 				if startReasoning {
+					output.Flush()
 					fmt.Println(utils.ColoredText("\n----------------------------", utils.ColorBlue))
 					startReasoning = false
 				}
@@ -987,20 +2624,27 @@ func callAPI(client *api.Client, conversation []map[string]string) (APIResponse,
 					<-animationDone // Wait for animation to actually stop
 					animationStopped = true
 				}
-				fmt.Print(filtered)
+				output.WriteString(filtered)
 			}
 		}
 
 		// Call API with streaming, passing the context
-		response, err := client.ChatStream(ctx, messages, callback)
+		var response *types.ChatStreamResponse
+		var err error
+		if useNativeTools {
+			response, err = client.ChatStreamWithTools(ctx, messages, tools, callback)
+		} else {
+			response, err = client.ChatStream(ctx, messages, callback)
+		}
 		if err != nil {
 			resultCh <- struct {
 				reasoningContent string
 				content          string
 				usage            *types.Usage
 				finishReason     string
+				toolCalls        []types.ToolCall
 				err              error
-			}{"", "", nil, "", err}
+			}{"", "", nil, "", nil, err}
 			return
 		}
 
@@ -1010,14 +2654,16 @@ func callAPI(client *api.Client, conversation []map[string]string) (APIResponse,
 			content          string
 			usage            *types.Usage
 			finishReason     string
+			toolCalls        []types.ToolCall
 			err              error
-		}{response.ReasoningContent, response.Content, response.Usage, response.FinishReason, nil}
+		}{response.ReasoningContent, response.Content, response.Usage, response.FinishReason, response.ToolCalls, nil}
 	}()
 
 	// Wait for the API call to complete or the context to be cancelled
 	var reasoningContent, content string
 	var usage *types.Usage
 	var finishReason string
+	var toolCalls []types.ToolCall
 	var apiErr error
 
 	select {
@@ -1031,9 +2677,15 @@ func callAPI(client *api.Client, conversation []map[string]string) (APIResponse,
 		content = result.content
 		usage = result.usage
 		finishReason = result.finishReason
+		toolCalls = result.toolCalls
 		apiErr = result.err
+		// The streaming is done, write the end of the response held back by the renderer
+		output.WriteString(filter.Flush())
 	}
 
+	// Write the rest of the streamed text before anything else is printed
+	output.Close()
+
 	//fmt.Println() // Add newline after streaming completes
 
 	// Log raw response in debug mode
@@ -1049,20 +2701,64 @@ func callAPI(client *api.Client, conversation []map[string]string) (APIResponse,
 		stopLoading <- true
 		<-animationDone
 	}
+	logAPIRequest(requestID, modelInfo, len(messages), start, usage, finishReason, len(toolCalls), apiErr)
 
 	if apiErr != nil {
 		log.LogDebug(fmt.Sprintf("API STREAM ERROR: %s\n", apiErr))
 		return APIResponse{}, fmt.Errorf("API call error: %s", apiErr)
 	}
+	core.RecordUsage(modelInfo, usage)
 
 	return APIResponse{
 		ReasoningContent: reasoningContent,
 		Content:          content,
 		Usage:            usage,
 		FinishReason:     finishReason,
+		ToolCalls:        toolCalls,
 	}, nil
 }
 
+// logAPIRequest records an API request in the debug log and as a span of the trace of the task,
+// with its duration and token usage
+func logAPIRequest(requestID string, modelInfo *types.ModelInfo, messages int, start time.Time, usage *types.Usage, finishReason string, toolCalls int, err error) {
+	span := core.StartSpanAt("chat "+modelInfo.Name, core.SpanKindClient, start, map[string]interface{}{
+		"gen_ai.request.model": modelInfo.Name,
+		"nca.request_id":       requestID,
+		"nca.messages":         messages,
+		"nca.tool_calls":       toolCalls,
+	})
+	fields := log.Fields{
+		"request_id":  requestID,
+		"model":       modelInfo.Name,
+		"messages":    messages,
+		"duration_ms": time.Since(start).Milliseconds(),
+		"tool_calls":  toolCalls,
+	}
+	if finishReason != "" {
+		fields["finish_reason"] = finishReason
+		span.SetAttribute("gen_ai.response.finish_reason", finishReason)
+	}
+	if usage != nil {
+		fields["prompt_tokens"] = usage.PromptTokens
+		fields["completion_tokens"] = usage.CompletionTokens
+		fields["cache_read_tokens"] = usage.CacheReadTokens
+		fields["cache_write_tokens"] = usage.CacheWriteTokens
+		span.SetAttribute("gen_ai.usage.input_tokens", usage.PromptTokens)
+		span.SetAttribute("gen_ai.usage.output_tokens", usage.CompletionTokens)
+		if cost, ok := core.RequestCost(modelInfo, usage); ok {
+			fields["cost"] = cost
+			span.SetAttribute("nca.cost", cost)
+		}
+	}
+	errMessage := ""
+	if err != nil {
+		errMessage = err.Error()
+		fields["error"] = errMessage
+	}
+	log.LogEvent("api_request", fields)
+	span.End(errMessage)
+}
+
 // Display loading animation
 func showLoadingAnimation(stop chan bool, done chan bool) {
 	// If output is to a pipe, don't show animation
@@ -1086,7 +2782,7 @@ func showLoadingAnimation(stop chan bool, done chan bool) {
 		select {
 		case <-stop:
 			// Clear animation line to ensure it doesn't affect subsequent output
-			fmt.Print("\r                        \r")
+			fmt.Print("\r\033[K")
 			done <- true // Notify that animation has stopped
 			return
 		default:
@@ -1103,13 +2799,188 @@ func extractToolUse(content string) map[string]interface{} {
 	return core.ParseToolUse(content)
 }
 
-// Handle tool use request
+// extractToolCall converts the first native tool call of a response to a tool use request
+// and records the call in the assistant message. It returns the ID of the call.
+func extractToolCall(toolCalls []types.ToolCall, assistantMessage map[string]string) (map[string]interface{}, string, error) {
+	if len(toolCalls) == 0 {
+		return nil, "", nil
+	}
+
+	// Only the first call is executed, like the first tool of an XML response
+	call := toolCalls[0]
+	if data, err := json.Marshal([]types.ToolCall{call}); err == nil {
+		assistantMessage["tool_calls"] = string(data)
+	}
+
+	toolUse, err := core.ParseToolCall(call)
+	if err != nil {
+		return nil, call.ID, err
+	}
+	if len(toolCalls) > 1 {
+		toolUse["has_multiple_tools"] = true
+	}
+	return toolUse, call.ID, nil
+}
+
+// printToolCall shows a native tool call, which is not part of the streamed content
+func printToolCall(toolUse map[string]interface{}) {
+	if toolUse == nil {
+		return
+	}
+	switch toolUse["tool"] {
+	case "attempt_completion":
+		// The result is printed after the tool has run
+	case "ask_followup_question":
+		question, _ := toolUse["question"].(string)
+		fmt.Println(question)
+	case "ask_mode_response":
+		response, _ := toolUse["response"].(string)
+		fmt.Println(response)
+	default:
+		fmt.Println(utils.ColoredText(formatToolDescription(toolUse), utils.ColorBlue))
+	}
+}
+
+// showToolResult shows the result of a tool, in full with --verbose and otherwise as a one-line
+// summary that /expand expands. Commands have streamed their output while they ran.
+func showToolResult(toolUse map[string]interface{}, result string) {
+	core.SetLastToolOutput(formatToolDescription(toolUse), result)
+	if toolUse["tool"] == "execute_command" || strings.TrimSpace(result) == "" {
+		return
+	}
+	if core.IsVerboseOutput() {
+		fmt.Println(result)
+		return
+	}
+	fmt.Println(utils.ColoredText("  ↳ "+core.SummarizeToolOutput(result), utils.ColorGray))
+}
+
+// Handle tool use request, the call is recorded in the debug log with its duration and as a span
+// of the trace of the task
 func handleToolUse(toolUse map[string]interface{}) string {
+	toolName, _ := toolUse["tool"].(string)
+	start := time.Now()
+	span := core.StartSpan("execute_tool "+toolName, core.SpanKindInternal, map[string]interface{}{
+		"gen_ai.tool.name": toolName,
+		"nca.request_id":   lastRequestID,
+	})
+	result := runToolUse(toolUse)
+
+	failed := strings.HasPrefix(result, "Error")
+	fields := log.Fields{
+		"tool":         toolName,
+		"request_id":   lastRequestID,
+		"duration_ms":  time.Since(start).Milliseconds(),
+		"result_chars": len(result),
+		"error":        failed,
+	}
+	if toolName == "use_mcp_tool" || toolName == "access_mcp_resource" {
+		fields["mcp_server"] = toolUse["server_name"]
+		span.SetAttribute("mcp.server", fmt.Sprint(toolUse["server_name"]))
+	}
+	log.LogEvent("tool_call", fields)
+	span.SetAttribute("nca.result_chars", len(result))
+	errMessage := ""
+	if failed {
+		errMessage = strings.SplitN(result, "\n", 2)[0]
+	}
+	span.End(errMessage)
+	return result
+}
+
+// runToolUse runs a tool call with its checks and hooks and returns the result for the model
+func runToolUse(toolUse map[string]interface{}) string {
 	toolName, ok := toolUse["tool"].(string)
 	if !ok {
 		return "Error: Unable to determine tool to use"
 	}
 
+	// Relative paths are relative to the working directory, which a "cd" in a command may have changed
+	core.ResolveToolPaths(toolUse)
+
+	// Tools disabled by policy never run
+	if blocked := core.CheckToolEnabled(toolName); blocked != "" {
+		fmt.Println(utils.ColoredText(blocked, utils.ColorRed))
+		core.RecordToolAudit(toolName, toolUse, blocked, core.AuditBlocked)
+		return blocked
+	}
+
+	// File tools only work inside the workspace roots
+	if blocked := core.CheckWorkspacePaths(toolName, toolUse); blocked != "" {
+		fmt.Println(utils.ColoredText(blocked, utils.ColorRed))
+		core.RecordToolAudit(toolName, toolUse, blocked, core.AuditBlocked)
+		return blocked
+	}
+
+	// In plan mode changes are previewed and recorded, hooks run when the plan is applied
+	if core.IsPlanMode() {
+		if result, planned := core.PlanToolCall(toolName, toolUse); planned {
+			if plan := core.GetPlan(); !strings.HasPrefix(result, "Error") && len(plan) > 0 {
+				step := plan[len(plan)-1]
+				fmt.Println(utils.ColoredText(fmt.Sprintf("[Plan] Step %d: %s", len(plan), step.Summary), utils.ColorCyan))
+				if step.Preview != step.Summary {
+					fmt.Println(step.Preview)
+				}
+			}
+			return result
+		}
+	}
+
+	// Run the pre hooks, which may block the tool call or change its parameters
+	hooks := core.RunPreToolHooks(toolName, toolUse)
+	if hooks.Blocked != "" {
+		fmt.Println(utils.ColoredText(hooks.Blocked, utils.ColorRed))
+		core.RecordToolAudit(toolName, toolUse, hooks.Blocked, core.AuditBlocked)
+		return hooks.Blocked
+	}
+	if hooks.Changed {
+		// Changed paths must stay inside the workspace roots as well
+		core.ResolveToolPaths(toolUse)
+		if blocked := core.CheckWorkspacePaths(toolName, toolUse); blocked != "" {
+			fmt.Println(utils.ColoredText(blocked, utils.ColorRed))
+			core.RecordToolAudit(toolName, toolUse, blocked, core.AuditBlocked)
+			return blocked
+		}
+	}
+
+	// Lock edited files so concurrent nca instances in the workspace don't overwrite each other
+	if toolName == "write_to_file" || toolName == "replace_in_file" || toolName == "download_file" {
+		if path, ok := toolUse["path"].(string); ok && path != "" {
+			if blocked := core.LockFileForEdit(path); blocked != "" {
+				fmt.Println(utils.ColoredText(blocked, utils.ColorRed))
+				core.RecordToolAudit(toolName, toolUse, blocked, core.AuditBlocked)
+				return blocked
+			}
+		}
+	}
+	if files, ok := toolUse["files"].([]core.FileWrite); ok && toolName == "write_files" {
+		for _, file := range files {
+			if blocked := core.LockFileForEdit(file.Path); blocked != "" {
+				fmt.Println(utils.ColoredText(blocked, utils.ColorRed))
+				core.RecordToolAudit(toolName, toolUse, blocked, core.AuditBlocked)
+				return blocked
+			}
+		}
+	}
+	if patch, ok := toolUse["patch"].(string); ok && toolName == "apply_patch" {
+		for _, path := range core.PatchFiles(patch) {
+			if blocked := core.LockFileForEdit(path); blocked != "" {
+				fmt.Println(utils.ColoredText(blocked, utils.ColorRed))
+				core.RecordToolAudit(toolName, toolUse, blocked, core.AuditBlocked)
+				return blocked
+			}
+		}
+	}
+
+	// Take a snapshot before risky commands and large edits, so they can be undone with one command
+	if reason := core.RiskyOperation(toolName, toolUse); reason != "" {
+		if snapshot, err := checkpointManager.CreateSnapshot(reason); err != nil {
+			fmt.Println(utils.ColoredText(fmt.Sprintf("Warning: %s", err), utils.ColorYellow))
+		} else if snapshot != nil {
+			fmt.Println(utils.ColoredText(fmt.Sprintf("Snapshot %s taken before %s, restore it with /checkpoint restore %s", snapshot.ID, reason, snapshot.ID), utils.ColorCyan))
+		}
+	}
+
 	// If this is a command that might delete files, track it via execute_command
 	if toolName == "execute_command" {
 		// Get the command
@@ -1122,11 +2993,11 @@ func handleToolUse(toolUse map[string]interface{}) string {
 				// Extract potential file paths from the command
 				parts := strings.Fields(command)
 				for i := 1; i < len(parts); i++ {
-					path := parts[i]
 					// Skip flags
-					if strings.HasPrefix(path, "-") {
+					if strings.HasPrefix(parts[i], "-") {
 						continue
 					}
+					path := core.ResolvePath(parts[i])
 
 					// Check if file exists before executing
 					if fileInfo, err := os.Stat(path); err == nil && !fileInfo.IsDir() {
@@ -1142,7 +3013,8 @@ func handleToolUse(toolUse map[string]interface{}) string {
 
 	// Special handling for attempt_completion
 	if toolName == "attempt_completion" {
-		// If there's a command parameter, execute the command
+		// If there's a command parameter, run it as an execute_command call, so it's checked,
+		// hooked and audited like one and doesn't run when execute_command is disabled
 		if commandStr, ok := toolUse["command"].(string); ok && commandStr != "" {
 			// Create a temporary tool use request
 			cmdToolUse := map[string]interface{}{
@@ -1150,21 +3022,21 @@ func handleToolUse(toolUse map[string]interface{}) string {
 				"command":           commandStr,
 				"requires_approval": true,
 			}
-
-			// Execute command
-			return core.ExecuteCommand(cmdToolUse)
+			return runToolUse(cmdToolUse)
 		}
 
 		return ""
 	}
 
-	// Execute the appropriate tool function
-	var result string
+	// Execute the appropriate tool function, the approval of commands is recorded in the audit log
+	var result, approval string
 	switch toolName {
 	case "execute_command":
-		result = core.ExecuteCommand(toolUse)
+		result, approval = core.ExecuteCommandWithApproval(toolUse)
 	case "read_file":
 		result = core.ReadFile(toolUse)
+	case "read_files":
+		result = core.ReadFiles(toolUse)
 	case "write_to_file":
 		// Get the file path and content
 		path, pathOk := toolUse["path"].(string)
@@ -1188,6 +3060,27 @@ func handleToolUse(toolUse map[string]interface{}) string {
 		}
 
 		result = core.WriteToFile(toolUse)
+	case "write_files":
+		// Keep the original contents, the files are only recorded when all of them were written
+		files, _ := toolUse["files"].([]core.FileWrite)
+		oldContents := make(map[string]string)
+		for _, file := range files {
+			if fileContent, err := os.ReadFile(file.Path); err == nil {
+				oldContents[file.Path] = string(fileContent)
+			}
+		}
+
+		result = core.WriteFiles(toolUse)
+
+		if !strings.HasPrefix(result, "Error") {
+			for _, file := range files {
+				if oldContent, existed := oldContents[file.Path]; existed {
+					checkpointManager.RecordFileOperation("replace", file.Path, file.Content, oldContent)
+				} else {
+					checkpointManager.RecordFileOperation("write", file.Path, file.Content, "")
+				}
+			}
+		}
 	case "replace_in_file":
 		// Get the file path and diff
 		path, pathOk := toolUse["path"].(string)
@@ -1215,42 +3108,141 @@ func handleToolUse(toolUse map[string]interface{}) string {
 		} else {
 			result = core.ReplaceInFile(toolUse)
 		}
+	case "apply_patch":
+		// Keep the original contents, the files are only recorded when the whole patch was applied
+		patch, _ := toolUse["patch"].(string)
+		paths := core.PatchFiles(patch)
+		oldContents := make(map[string]string)
+		for _, path := range paths {
+			if fileContent, err := os.ReadFile(path); err == nil {
+				oldContents[path] = string(fileContent)
+			}
+		}
+
+		result = core.ApplyPatch(toolUse)
+
+		if !strings.HasPrefix(result, "Error") {
+			for _, path := range paths {
+				oldContent, existed := oldContents[path]
+				newContent, err := os.ReadFile(path)
+				switch {
+				case err != nil && existed:
+					checkpointManager.RecordFileOperation("delete", path, oldContent, "")
+				case err == nil && existed:
+					checkpointManager.RecordFileOperation("replace", path, string(newContent), oldContent)
+				case err == nil:
+					checkpointManager.RecordFileOperation("write", path, string(newContent), "")
+				}
+			}
+		}
 	case "search_files":
 		result = core.SearchFiles(toolUse)
 	case "list_files":
 		result = core.ListFiles(toolUse)
 	case "list_code_definition_names":
 		result = core.ListCodeDefinitionNames(toolUse)
+	case "get_file_diff":
+		result = core.GetFileDiff(toolUse)
+	case "verify_build":
+		result, approval = core.VerifyBuildWithApproval(toolUse)
+	case "read_job_output":
+		result = core.ReadJobOutput(toolUse)
 	case "ask_followup_question":
 		result = core.FollowupQuestion(toolUse)
 	case "ask_mode_response":
 		result = core.AskModeResponse(toolUse)
+	case "new_task":
+		result = core.NewTask(toolUse)
+	case "create_plan":
+		result = core.CreatePlan(toolUse)
+	case "update_plan_step":
+		result = core.UpdatePlanStep(toolUse)
+	case "spawn_subtask":
+		result = runSubtask(toolUse)
+	case "git_status":
+		result = core.GitStatus(toolUse)
+	case "git_diff":
+		result = core.GitDiff(toolUse)
+	case "git_log":
+		result = core.GitLog(toolUse)
+	case "git_branch":
+		result = core.GitBranch(toolUse)
+	case "git_stage_hunks":
+		result = core.StageHunks(toolUse)
 	case "git_commit":
+		// Commit the files changed during the task unless the model lists them or commits what is staged
+		if files, ok := toolUse["files"].([]string); (!ok || len(files) == 0) && toolUse["staged_only"] != true {
+			toolUse["files"] = checkpointManager.ChangedFiles()
+		}
 		result = core.GitCommit(toolUse)
+	case "read_issue":
+		result = core.ReadIssue(toolUse)
+	case "create_pull_request":
+		result = core.CreatePullRequest(toolUse)
+	case "comment_on_pr":
+		result = core.CommentOnPR(toolUse)
+	case "list_pr_review_comments":
+		result = core.ListPRReviewComments(toolUse)
 	case "fetch_web_content":
 		result = core.FetchWebContent(toolUse)
 	case "find_files":
 		result = core.FindFiles(toolUse)
 	case "use_mcp_tool":
 		result = core.UseMcpTool(toolUse)
+	case "describe_mcp_tool":
+		result = core.DescribeMcpTool(toolUse)
 	case "access_mcp_resource":
 		result = core.AccessMcpResource(toolUse)
+	case "download_file":
+		path, pathOk := toolUse["path"].(string)
+		oldContent := ""
+		existed := false
+		if pathOk {
+			if fileContent, err := os.ReadFile(path); err == nil {
+				oldContent = string(fileContent)
+				existed = true
+			}
+		}
+
+		result = core.DownloadFile(toolUse)
+
+		// Record the downloaded file so it can be rolled back with checkpoints
+		if pathOk && strings.HasPrefix(result, "File successfully downloaded") {
+			if newContent, err := os.ReadFile(path); err == nil {
+				if existed {
+					checkpointManager.RecordFileOperation("replace", path, string(newContent), oldContent)
+				} else {
+					checkpointManager.RecordFileOperation("write", path, string(newContent), "")
+				}
+			}
+		}
+	case "get_artifact":
+		result = core.GetArtifact(toolUse)
 	default:
 		result = fmt.Sprintf("Error: Unknown tool '%s'", toolName)
 	}
 
-	return result
+	// Secrets of the project's env files are masked in file contents, like in command output
+	result = core.MaskToolResult(toolName, result)
+
+	// Record mutating actions in the audit log
+	core.RecordToolAudit(toolName, toolUse, result, approval)
+
+	// Run the post hooks, their output is attached to the result
+	result = core.RunPostToolHooks(toolName, toolUse, result, hooks.Context)
+
+	// Enforce the per-tool result size limit before the result reaches the model
+	return core.LimitToolResult(toolName, result)
 }
 
 func debugPrintUsage(usage *types.Usage) {
 	if !log.IsDebugMode() {
 		return
 	}
-	usageStr := fmt.Sprintf("\nPrompt tokens: %d, Completion tokens: %d, Total tokens: %d\n",
-		usage.PromptTokens, usage.CompletionTokens, usage.TotalTokens)
+	usageStr := fmt.Sprintf("\nPrompt tokens: %d (cache hits: %d, cache writes: %d), Completion tokens: %d, Total tokens: %d\n",
+		usage.PromptTokens, usage.CacheReadTokens, usage.CacheWriteTokens, usage.CompletionTokens, usage.TotalTokens)
+	// The usage is logged with the api_request event
 	fmt.Print(usageStr)
-
-	log.LogDebug(usageStr)
 }
 
 // displayHelp shows all available commands and options
@@ -1265,28 +3257,83 @@ func displayHelp() {
 	fmt.Println("\nPROMPT FEATURES:")
 	fmt.Println("  File Reading   - Include file content by wrapping the path in backticks: `path/to/file.txt`")
 	fmt.Println("  Web Content    - Include web content by wrapping the URL in backticks: `https://example.com`")
+	fmt.Println("  Images         - Attach images for vision models with @image:path/to/shot.png or `path/to/shot.png`")
 	fmt.Println("  Multiple Files - You can include multiple files or URLs in the same prompt")
 	fmt.Println("  Size Limits    - Files are limited to 64KB, web content is filtered to extract text")
 
 	fmt.Println("\nCOMMANDS:")
 	fmt.Println("  help    - Display this help information")
 	fmt.Println("  config  - Manage configuration settings")
-	fmt.Println("           Usage: nca config [set|unset|list] [--global] [key] [value]")
+	fmt.Println("           Usage: nca config [set|unset|list|profiles] [--global|--profile name] [key] [value]")
 	fmt.Println("  commit  - Automatically commit all current changes, and summarize the changes")
+	fmt.Println("  setup   - Choose the provider, API key and model interactively")
+	fmt.Println("  trust   - Manage workspace trust decisions")
+	fmt.Println("           Usage: nca trust [list|revoke] [path]")
+	fmt.Println("  audit   - Show the log of file writes, commands and commits")
+	fmt.Println("           Usage: nca audit show [--since 24h|7d|2006-01-02]")
+	fmt.Println("  debug   - Show a debug log in a readable form, the latest one by default")
+	fmt.Println("           Usage: nca debug show [path]")
+	fmt.Println("  resolve - Resolve merge conflicts with the agent, stage the files and run the build and tests")
+	fmt.Println("           Usage: nca resolve [--test command]")
+	fmt.Println("  review  - Review the uncommitted changes, the staged changes, a branch or a pull request")
+	fmt.Println("           Usage: nca review [ref|--staged|pull-request-url] [--format text|markdown|github] [--post]")
+	fmt.Println("  new     - Create a project from a template and let the agent complete it")
+	fmt.Println("           Usage: nca new <template> <name> [--var key=value]... [--no-agent] [description]")
+	fmt.Println("  completion - Generate a shell completion script")
+	fmt.Println("           Usage: nca completion bash|zsh|fish")
 
 	fmt.Println("\nOPTIONS:")
 	fmt.Println("  -p      - Run a one-time query and exit")
 	fmt.Println("  -v      - Show version information")
 	fmt.Println("  -debug  - Enable debug mode to log conversation data")
+	fmt.Println("  -resume - Resume a saved session: nca -resume [name]")
+	fmt.Println("  -keep-scratch - Keep the scratch directory of a task instead of deleting it when the task ends")
+	fmt.Println("  -output - Output format of one-time queries: text (default) or json")
+	fmt.Println("            json writes JSON lines events to stdout: nca -p --output json \"prompt\"")
+	fmt.Println("  -dry-run - Preview file changes, commits and commands that need approval as a plan,")
+	fmt.Println("            the plan is applied in one step after confirming it or with /plan apply")
+	fmt.Println("  -system-prompt-file - Use a template file as the system prompt, see the README for its variables")
+	fmt.Println("  -system-prompt-mode - replace (default) or append the file to the built-in system prompt")
+	fmt.Println("  -workspace - A root directory the file tools work in instead of the detected project root,")
+	fmt.Println("            repeat it for several roots: nca -workspace ./svc-a -workspace ./svc-b")
+	fmt.Println("  -profile - Use the provider, model, API key and other settings of a config profile: nca -profile work")
+	fmt.Println("  -record-api - Record the streamed API responses to a cassette file: nca -record-api fixture.json")
+	fmt.Println("  -replay-api - Replay the responses of a cassette file in order instead of calling the API")
+	fmt.Println("  -verbose - Show the full output of tools, large outputs are collapsed by default")
+	fmt.Println("  -yes    - Approve every action without asking, for CI and scripts")
+	fmt.Println("  -approval - Approval policy: never (deny what needs approval), auto-safe (approve file writes,")
+	fmt.Println("            deny commands, commits, downloads and MCP tools) or always-ask (ask for file writes as well)")
 
 	fmt.Println("\nINTERACTIVE COMMANDS:")
 	fmt.Println("  /clear      - Clear conversation history")
+	fmt.Println("  /continue   - Continue a task that stopped at the step limit (max_steps)")
 	fmt.Println("  /config     - Manage configuration settings")
-	fmt.Println("               Usage: /config [set|unset|list] [--global] [key] [value]")
+	fmt.Println("               Usage: /config [set|unset|list|profiles] [--global|--profile name] [key] [value]")
+	fmt.Println("  /diff       - Show the changes made to files in this task")
+	fmt.Println("  /cost       - Show the tokens used in this session, the cache hits and the estimated cost")
+	fmt.Println("  /expand     - Show the full output of the last tool")
+	fmt.Println("  /jobs       - List the commands running in the background")
+	fmt.Println("  /logs       - Show the output of a background job")
+	fmt.Println("               Usage: /logs <job_id>")
+	fmt.Println("  /kill       - Stop a background job and the processes it started")
+	fmt.Println("               Usage: /kill <job_id>")
+	fmt.Println("  /compact    - Replace the conversation with a summary to free the context window")
+	fmt.Println("               Usage: /compact [instructions], e.g. /compact keep details about the auth refactor")
+	fmt.Println("  /paste-image - Attach the image in the clipboard to the next prompt, for vision models")
+	fmt.Println("  /edit       - Edit the last prompt in $EDITOR, undo its changes and run it again")
+	fmt.Println("  /undo       - Undo the last prompt: restore the files it changed and remove it from the conversation")
+	fmt.Println("  /lang       - Show or change the answer language of this session")
+	fmt.Println("               Usage: /lang [code|name|auto]")
 	fmt.Println("  /checkpoint - Manage checkpoints")
-	fmt.Println("               Usage: /checkpoint [list|restore|redo] [checkpoint_id]")
+	fmt.Println("               Usage: /checkpoint [list|show|diff|restore|redo] [checkpoint_id]")
 	fmt.Println("  /mcp        - Manage MCP server connections")
-	fmt.Println("               Usage: /mcp [list|reload]")
+	fmt.Println("               Usage: /mcp [list|reload|add|remove|enable|disable|login|logout] [name]")
+	fmt.Println("               Add a server: /mcp add <name> <command> [args...] or /mcp add <name> <sse_url>")
+	fmt.Println("               Authorize an SSE server with OAuth: /mcp login <name>")
+	fmt.Println("  /session    - Save the conversation to resume it later")
+	fmt.Println("               Usage: /session [save|list] [name]")
+	fmt.Println("  /plan       - Toggle plan mode, which previews changes and commands instead of running them")
+	fmt.Println("               Usage: /plan [show|apply|discard]")
 	fmt.Println("  /exit       - Exit the program")
 	fmt.Println("  /help       - Show help information")
 }
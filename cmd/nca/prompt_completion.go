@@ -0,0 +1,125 @@
+package main
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/chzyer/readline"
+	"github.com/pederhe/nca/internal/core"
+)
+
+// Prefixes of the words of a prompt that complete file paths. The contents of a file in
+// backticks are added to the prompt, @image: attaches an image, @git: mentions git changes and @
+// mentions a file or directory.
+var mentionPrefixes = []string{"@image:", "@git:", "@", "`"}
+
+// promptCompleter completes the slash commands, the git: mentions, and the file paths of the words
+// of a prompt that start with a mention prefix. Paths are completed like in a shell, and if no path starts with the
+// word it's replaced with the best fuzzy match of the workspace files. The readline completer can
+// only add text after the cursor, so the replacement is left for the listener that sees the line
+// after the Tab.
+type promptCompleter struct {
+	commands *readline.PrefixCompleter
+
+	mutex       sync.Mutex
+	replacement *mentionReplacement
+}
+
+// mentionReplacement replaces the query of a mention with a fuzzy match
+type mentionReplacement struct {
+	line  string
+	start int // Position of the query in the line
+	end   int
+	path  string
+}
+
+// mentionQuery returns the prefix and the query of the word before the cursor, if it starts with
+// a mention prefix
+func mentionQuery(line []rune, pos int) (string, string, bool) {
+	start := pos
+	for start > 0 && line[start-1] != ' ' && line[start-1] != '\t' {
+		start--
+	}
+	word := string(line[start:pos])
+	for _, prefix := range mentionPrefixes {
+		if strings.HasPrefix(word, prefix) {
+			return prefix, strings.TrimPrefix(word, prefix), true
+		}
+	}
+	return "", "", false
+}
+
+// Do returns the completions of the word before the cursor
+func (c *promptCompleter) Do(line []rune, pos int) ([][]rune, int) {
+	prefix, query, ok := mentionQuery(line, pos)
+	if !ok {
+		return c.commands.Do(line, pos)
+	}
+	if prefix == "@git:" {
+		var candidates [][]rune
+		for _, target := range core.CompleteGitMention(query) {
+			candidates = append(candidates, []rune(strings.TrimPrefix(target, query)))
+		}
+		return candidates, len([]rune(query))
+	}
+
+	// A file in backticks gets the closing backtick
+	suffix := func(path string) string {
+		if prefix == "`" && !strings.HasSuffix(path, "/") {
+			return path + "`"
+		}
+		return path
+	}
+
+	var candidates [][]rune
+	for _, path := range core.CompletePathPrefix(query) {
+		candidates = append(candidates, []rune(strings.TrimPrefix(suffix(path), query)))
+	}
+	if len(candidates) > 0 {
+		return candidates, len([]rune(query))
+	}
+
+	matches := core.FuzzyFindFiles(query)
+	if len(matches) == 0 {
+		return nil, 0
+	}
+	c.mutex.Lock()
+	c.replacement = &mentionReplacement{
+		line:  string(line),
+		start: pos - len([]rune(query)),
+		end:   pos,
+		path:  suffix(matches[0]),
+	}
+	c.mutex.Unlock()
+	// Nothing is added, the listener replaces the query
+	return [][]rune{{}}, len([]rune(query))
+}
+
+// OnChange replaces the query of a mention with its fuzzy match after the Tab that completed it
+func (c *promptCompleter) OnChange(line []rune, pos int, key rune) ([]rune, int, bool) {
+	c.mutex.Lock()
+	replacement := c.replacement
+	c.replacement = nil
+	c.mutex.Unlock()
+
+	if key != readline.CharTab || replacement == nil || replacement.line != string(line) || replacement.end != pos {
+		return nil, 0, false
+	}
+	newLine := append([]rune(nil), line[:replacement.start]...)
+	newLine = append(newLine, []rune(replacement.path)...)
+	newPos := len(newLine)
+	newLine = append(newLine, line[pos:]...)
+	return newLine, newPos, true
+}
+
+// checkpointIDs returns the IDs of the checkpoints and snapshots, the latest first
+func checkpointIDs(string) []string {
+	if checkpointManager == nil {
+		return nil
+	}
+	ids := make([]string, 0, len(checkpointManager.Checkpoints))
+	for i := len(checkpointManager.Checkpoints) - 1; i >= 0; i-- {
+		ids = append(ids, checkpointManager.Checkpoints[i].ID)
+	}
+	return ids
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/pederhe/nca/internal/core"
+	"github.com/pederhe/nca/pkg/api"
+	"github.com/pederhe/nca/pkg/api/types"
+	"github.com/pederhe/nca/pkg/log"
+	"github.com/pederhe/nca/pkg/utils"
+)
+
+const reviewUsage = "Usage: nca review [ref|--staged|pull-request-url] [--format text|markdown|github] [--post]"
+
+// Handle the review command, format: "nca review [ref|--staged|pull-request-url] [--format text|markdown|github] [--post]".
+// Progress goes to stderr so the report can be redirected to a file.
+func handleReviewCommand(args []string) {
+	target, format := "", "text"
+	staged, post := false, false
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "--staged":
+			staged = true
+		case args[i] == "--post":
+			post = true
+		case args[i] == "--format" && i+1 < len(args):
+			format = args[i+1]
+			i++
+		case strings.HasPrefix(args[i], "--format="):
+			format = strings.TrimPrefix(args[i], "--format=")
+		case !strings.HasPrefix(args[i], "-") && target == "":
+			target = args[i]
+		default:
+			fmt.Println(reviewUsage)
+			return
+		}
+	}
+	if (staged && target != "") || (format != "text" && format != "markdown" && format != "github") {
+		fmt.Println(reviewUsage)
+		return
+	}
+
+	reviewTarget, err := core.GetReviewTarget(target, staged)
+	if err != nil {
+		fmt.Printf("Error: %s\n", err)
+		return
+	}
+	if post && reviewTarget.PullRequest == "" {
+		fmt.Println("Error: --post needs the URL of a pull request")
+		return
+	}
+
+	checkWorkspaceTrust()
+	checkClientConfig()
+
+	client, err := api.NewClientForRoute(api.RouteReview)
+	if err != nil {
+		fmt.Printf("Error: %s\n", err)
+		return
+	}
+	fmt.Fprintln(os.Stderr, utils.ColoredText(fmt.Sprintf("Reviewing %s with %s...", reviewTarget.Description, client.GetModelInfo().Name), utils.ColorCyan))
+
+	system, prompt := core.BuildReviewPrompt(reviewTarget, getAnswerLanguage())
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	response, err := client.ChatStream(ctx, []types.Message{
+		{Role: "system", Content: system},
+		{Role: "user", Content: prompt},
+	}, func(string, string, bool) {})
+	if err != nil {
+		fmt.Printf("Error: %s\n", err)
+		log.LogDebug(fmt.Sprintf("Review request failed: %s\n", err))
+		return
+	}
+	log.LogDebug(fmt.Sprintf("Review answer: %s\n", response.Content))
+	review, err := core.ParseReview(response.Content)
+	if err != nil {
+		fmt.Printf("Error: %s\n", err)
+		return
+	}
+
+	switch format {
+	case "markdown":
+		fmt.Print(core.FormatReviewMarkdown(reviewTarget, review))
+	case "github":
+		data, _ := json.MarshalIndent(core.NewGitHubReview(reviewTarget, review), "", "  ")
+		fmt.Println(string(data))
+	default:
+		fmt.Print(core.FormatReview(reviewTarget, review))
+	}
+
+	if post {
+		result, err := core.PostReview(reviewTarget, review)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, utils.ColoredText("Error: "+err.Error(), utils.ColorRed))
+			return
+		}
+		fmt.Fprintln(os.Stderr, utils.ColoredText(result, utils.ColorGreen))
+	}
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chzyer/readline"
+	"github.com/pederhe/nca/pkg/api"
+	"github.com/pederhe/nca/pkg/api/types"
+	"github.com/pederhe/nca/pkg/config"
+	"github.com/pederhe/nca/pkg/log"
+	"github.com/pederhe/nca/pkg/utils"
+)
+
+const (
+	// Maximum number of models suggested when the configured model is unknown
+	maxSuggestedModels = 10
+	// Timeout of the test request sent by the setup
+	setupTestTimeout = 60 * time.Second
+)
+
+// printClientErrorHelp explains how to fix the configuration when the API client can't be created
+func printClientErrorHelp(err error) {
+	fmt.Println(utils.ColoredText("Error: Failed to create API client: "+err.Error(), utils.ColorRed))
+
+	provider := api.GetDefaultProviderType()
+	switch {
+	case errors.Is(err, api.ErrMissingAPIKey):
+		fmt.Printf("No API key is configured for the %s provider. Set it with:\n", provider)
+		fmt.Println("  nca config set --global api_key <your_api_key>")
+	case errors.Is(err, api.ErrUnsupportedProvider):
+		fmt.Printf("Supported providers: %s. Set the provider with:\n", formatProviders())
+		fmt.Println("  nca config set --global provider <provider>")
+	case errors.Is(err, types.ErrModelNotFound):
+		models := api.GetProviderModels(provider)
+		if len(models) > maxSuggestedModels {
+			models = append(models[:maxSuggestedModels], "...")
+		}
+		fmt.Printf("The %s provider doesn't know the model '%s'. Known models: %s\n", provider, config.Get("model"), strings.Join(models, ", "))
+		fmt.Println("Set the model with:")
+		fmt.Println("  nca config set --global model <model>")
+	}
+	fmt.Println("Or run 'nca setup' to choose the provider, API key and model.")
+}
+
+// formatProviders returns the names of the supported providers
+func formatProviders() string {
+	var names []string
+	for _, provider := range api.Providers {
+		names = append(names, string(provider))
+	}
+	return strings.Join(names, ", ")
+}
+
+// checkClientConfig offers the setup before the first prompt when the API client can't be created.
+// On the first run, before anything is configured, the setup starts right away.
+func checkClientConfig() {
+	_, err := api.NewClient()
+	if err == nil {
+		return
+	}
+	log.LogDebug(fmt.Sprintf("API client configuration error: %s\n", err))
+
+	if errors.Is(err, api.ErrMissingAPIKey) && !config.HasGlobalConfig() {
+		fmt.Println(utils.ColoredText("Welcome to NCA! Let's set up the AI provider before the first task.", utils.ColorGreen))
+		runSetup()
+		return
+	}
+	printClientErrorHelp(err)
+
+	fmt.Print("Do you want to run the setup now? (y/n): ")
+	var response string
+	fmt.Scanln(&response)
+	if strings.ToLower(response) == "y" {
+		runSetup()
+	}
+}
+
+// runSetup walks through the provider, API key, model and approval selection, saves them to the
+// global config and sends a test request. The API key is kept in the credentials file.
+func runSetup() {
+	reader := bufio.NewReader(os.Stdin)
+	fmt.Println("NCA setup, press Enter to keep the value in brackets")
+
+	// Provider
+	currentProvider := api.GetDefaultProviderType()
+	if !api.IsSupportedProvider(currentProvider) {
+		currentProvider = api.Providers[0]
+	}
+	var providers []string
+	fmt.Println("\nProviders:")
+	for i, provider := range api.Providers {
+		providers = append(providers, string(provider))
+		fmt.Printf("  %d) %s\n", i+1, provider)
+	}
+	provider := promptChoice(reader, "Provider", providers, string(currentProvider), false)
+	if provider == "" {
+		return
+	}
+
+	// API key, read without echo
+	credentialName := "api_key." + provider
+	hasKey := config.Get("api_key") != "" || config.GetCredential(credentialName) != ""
+	keyPrompt := fmt.Sprintf("API key for %s: ", provider)
+	if hasKey {
+		keyPrompt = fmt.Sprintf("API key for %s [keep current key]: ", provider)
+	}
+	key, err := readline.Password(keyPrompt)
+	if err != nil {
+		fmt.Println("Setup cancelled")
+		return
+	}
+	apiKey := strings.TrimSpace(string(key))
+	if apiKey == "" && !hasKey {
+		fmt.Println(utils.ColoredText("Error: An API key is required", utils.ColorRed))
+		return
+	}
+
+	// Model, OpenAI compatible endpoints serve models that aren't listed
+	models := api.GetProviderModels(api.ProviderType(provider))
+	fmt.Printf("\nModels of %s:\n", provider)
+	for i, model := range models {
+		fmt.Printf("  %d) %s\n", i+1, model)
+	}
+	allowOther := provider == string(api.OpenAIProvider)
+	defaultModel := models[0]
+	if current := config.Get("model"); current != "" && (allowOther || containsString(models, current)) {
+		defaultModel = current
+	}
+	model := promptChoice(reader, "Model", models, defaultModel, allowOther)
+	if model == "" {
+		return
+	}
+
+	// Base URL, e.g. of a proxy or an OpenAI compatible server
+	fmt.Print("API base URL (empty for the default endpoint of the provider): ")
+	baseURL, _ := reader.ReadString('\n')
+	baseURL = strings.TrimSpace(baseURL)
+
+	// Approval default, the session toggle and untrusted workspaces still override it
+	autoApprove := config.Get("auto_approve") == "true" || config.Get("auto_approve") == "1"
+	approvalDefault := map[bool]string{true: "y", false: "n"}[autoApprove]
+	fmt.Print("\nRun commands and change files without asking for approval by default? (y/n) [" + approvalDefault + "]: ")
+	approval, _ := reader.ReadString('\n')
+	if approval = strings.ToLower(strings.TrimSpace(approval)); approval != "" {
+		autoApprove = approval == "y"
+	}
+
+	if apiKey != "" {
+		if err := config.SetCredential(credentialName, apiKey); err != nil {
+			fmt.Println(utils.ColoredText("Error saving API key: "+err.Error(), utils.ColorRed))
+			return
+		}
+		// A key in the global config would take precedence over the stored key
+		config.Unset("api_key", true)
+	}
+
+	settings := map[string]string{"provider": provider, "model": model, "auto_approve": strconv.FormatBool(autoApprove)}
+	for key, value := range settings {
+		if err := config.Set(key, value, true); err != nil {
+			fmt.Println(utils.ColoredText("Error saving config: "+err.Error(), utils.ColorRed))
+			return
+		}
+	}
+	if baseURL != "" {
+		config.Set("api_base_url", baseURL, true)
+	} else {
+		config.Unset("api_base_url", true)
+	}
+	log.LogDebug(fmt.Sprintf("Setup saved provider %s and model %s\n", provider, model))
+
+	// Values of the local config take precedence over the global config
+	if apiKey != "" && config.Get("api_key") != "" {
+		settings["api_key"] = apiKey
+	}
+	for key, value := range settings {
+		if config.Get(key) != value {
+			fmt.Println(utils.ColoredText(fmt.Sprintf("Warning: %s is overridden by the config of this directory, remove it with: nca config unset %s", key, key), utils.ColorYellow))
+		}
+	}
+	fmt.Println(utils.ColoredText("Configuration saved", utils.ColorGreen))
+
+	client, err := api.NewClient()
+	if err != nil {
+		printClientErrorHelp(err)
+		return
+	}
+	fmt.Print("Sending a test request... ")
+	if err := testClient(client); err != nil {
+		fmt.Println(utils.ColoredText("failed", utils.ColorRed))
+		fmt.Println(utils.ColoredText("Error: "+err.Error(), utils.ColorRed))
+		fmt.Println("Check the API key, model and base URL, and run 'nca setup' again to change them.")
+		return
+	}
+	fmt.Println(utils.ColoredText("OK", utils.ColorGreen))
+}
+
+// testClient sends a short request to check the provider, API key and model
+func testClient(client *api.Client) error {
+	ctx, cancel := context.WithTimeout(context.Background(), setupTestTimeout)
+	defer cancel()
+
+	messages := []types.Message{{Role: "user", Content: "Reply with OK."}}
+	_, err := client.ChatStream(ctx, messages, func(string, string, bool) {})
+	return err
+}
+
+// promptChoice asks for one of the numbered options, by number or name. Other names are
+// accepted when allowOther is set. It returns an empty string when the input is cancelled.
+func promptChoice(reader *bufio.Reader, label string, options []string, defaultValue string, allowOther bool) string {
+	for {
+		fmt.Printf("%s [%s]: ", label, defaultValue)
+		input, err := reader.ReadString('\n')
+		if err != nil {
+			fmt.Println("\nSetup cancelled")
+			return ""
+		}
+		input = strings.TrimSpace(input)
+		if input == "" {
+			return defaultValue
+		}
+		if index, err := strconv.Atoi(input); err == nil && index >= 1 && index <= len(options) {
+			return options[index-1]
+		}
+		if allowOther || containsString(options, input) {
+			return input
+		}
+		fmt.Printf("Unknown %s '%s', enter a number between 1 and %d\n", strings.ToLower(label), input, len(options))
+	}
+}
+
+// containsString returns whether a list contains a string
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
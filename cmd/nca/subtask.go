@@ -0,0 +1,202 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pederhe/nca/internal/core"
+	"github.com/pederhe/nca/pkg/api"
+	"github.com/pederhe/nca/pkg/log"
+	"github.com/pederhe/nca/pkg/utils"
+)
+
+// runSubtask handles the spawn_subtask tool. The goal runs in an agent loop with its own
+// conversation, optionally with the summarizer model, and the summary of its final answer is
+// returned to the parent conversation.
+func runSubtask(toolUse map[string]interface{}) string {
+	subtask, errResult := core.ParseSubtask(toolUse)
+	if errResult != "" {
+		return errResult
+	}
+
+	var client *api.Client
+	var err error
+	if subtask.CheapModel {
+		client, err = api.NewSummarizerClient()
+	} else {
+		client, err = api.NewClientForRoute(taskRoute())
+	}
+	if err != nil {
+		return fmt.Sprintf("Error: Failed to create API client for the subtask: %s", err)
+	}
+
+	// Files the task changed before, the result lists the ones the subtask changed
+	changedBefore := make(map[string]bool)
+	for _, path := range checkpointManager.ChangedFiles() {
+		changedBefore[path] = true
+	}
+
+	fmt.Println(utils.ColoredText(fmt.Sprintf("Subtask started with %s: %s", client.GetModelInfo().Name, subtask.Goal), utils.ColorCyan))
+	log.LogDebug(fmt.Sprintf("SUBTASK STARTED: %s\n", subtask.Goal))
+
+	// The checklist belongs to the parent task, the subtask can't change it
+	var sections []core.EnvironmentSection
+	for _, section := range environmentSections() {
+		if section.Title != "Task Checklist" {
+			sections = append(sections, section)
+		}
+	}
+	conversation := []map[string]string{{
+		"role":    "user",
+		"content": core.FormatSubtaskPrompt(subtask) + core.FormatFullEnvironmentDetails(sections),
+	}}
+
+	summary, requests, err := runSubtaskLoop(client, &conversation)
+
+	var files []string
+	for _, path := range checkpointManager.ChangedFiles() {
+		if !changedBefore[path] {
+			files = append(files, path)
+		}
+	}
+
+	if err != nil {
+		fmt.Println(utils.ColoredText("Subtask failed: "+err.Error(), utils.ColorRed))
+		log.LogDebug(fmt.Sprintf("SUBTASK FAILED: %s\n", err))
+		result := fmt.Sprintf("Error: The subtask didn't finish after %d requests: %s", requests, err)
+		if len(files) > 0 {
+			result += "\nFiles changed by the subtask: " + strings.Join(files, ", ")
+		}
+		return result
+	}
+	fmt.Println(utils.ColoredText(fmt.Sprintf("Subtask finished after %d requests", requests), utils.ColorCyan))
+	log.LogDebug(fmt.Sprintf("SUBTASK FINISHED: %s\n", summary))
+	return core.FormatSubtaskResult(summary, requests, files)
+}
+
+// runSubtaskLoop requests responses and runs their tools until the subtask gives its final
+// answer, which is returned with the number of requests made
+func runSubtaskLoop(client *api.Client, conversation *[]map[string]string) (string, int, error) {
+	maxSteps := getMaxSteps()
+	currentDeletedRange := [2]int{0, 0}
+	noToolUseCount := 0
+	lastContent := ""
+
+	for requests := 0; ; {
+		if taskAbortRequested.Load() {
+			return "", requests, fmt.Errorf("the task was aborted by the user")
+		}
+		if requests >= maxSteps {
+			return "", requests, fmt.Errorf("the limit of %d requests was reached, its last response was: %s", maxSteps, lastContent)
+		}
+
+		response, err := callAPI(client, *conversation)
+		if err != nil {
+			return "", requests, err
+		}
+		debugPrintUsage(response.Usage)
+		requests++
+
+		// Drop the oldest messages when the context length is insufficient
+		if response.FinishReason == "length" {
+			newRange := core.GetNextTruncationRange(*conversation, currentDeletedRange, "quarter")
+			if newRange[1] <= newRange[0] {
+				return "", requests, fmt.Errorf("the context length was exceeded")
+			}
+			currentDeletedRange = newRange
+			core.TruncateConversation(conversation, newRange)
+			continue
+		}
+		lastContent = strings.TrimSpace(response.Content)
+
+		assistantMessage := map[string]string{
+			"role":    "assistant",
+			"content": response.Content,
+		}
+
+		var toolUse map[string]interface{}
+		var toolCallID string
+		useNativeTools := client.UseNativeTools()
+		if useNativeTools {
+			var toolCallErr error
+			toolUse, toolCallID, toolCallErr = extractToolCall(response.ToolCalls, assistantMessage)
+			if toolCallErr != nil {
+				*conversation = append(*conversation, assistantMessage, map[string]string{
+					"role":         "tool",
+					"tool_call_id": toolCallID,
+					"content":      fmt.Sprintf("Error: %s", toolCallErr),
+				})
+				continue
+			}
+			printToolCall(toolUse)
+		} else {
+			toolUse = extractToolUse(response.Content)
+		}
+		*conversation = append(*conversation, assistantMessage)
+
+		if toolUse == nil {
+			// With native tool calling a response without tool calls is the final answer
+			if useNativeTools {
+				fmt.Println()
+				return lastContent, requests, nil
+			}
+
+			noToolUseCount++
+			if noToolUseCount >= 3 {
+				return "", requests, fmt.Errorf("the model failed to use a tool after 3 attempts")
+			}
+			*conversation = append(*conversation, map[string]string{
+				"role":    "user",
+				"content": fmt.Sprintf("[ERROR] You did not use a tool in your previous response! Please retry with a tool use. (Attempt %d/3)", noToolUseCount),
+			})
+			fmt.Println(utils.ColoredText("No available tools found", utils.ColorRed))
+			continue
+		}
+		noToolUseCount = 0
+
+		// The final answer is the summary for the parent task, a command to show the result isn't run
+		toolName, _ := toolUse["tool"].(string)
+		switch toolName {
+		case "attempt_completion":
+			summary, _ := toolUse["result"].(string)
+			return summary, requests, nil
+		case "ask_mode_response":
+			summary, _ := toolUse["response"].(string)
+			return summary, requests, nil
+		}
+
+		log.LogDebug(fmt.Sprintf("SUBTASK TOOL USE: %v\n", toolUse))
+		result := core.CheckSubtaskTool(toolName)
+		if result != "" {
+			fmt.Println(utils.ColoredText(result, utils.ColorRed))
+		} else {
+			result = handleToolUse(toolUse)
+			if toolName == "replace_in_file" {
+				var display string
+				if result, display = core.SplitReplaceResult(result); display != "" {
+					fmt.Println(display)
+				}
+			}
+		}
+		log.LogDebug(fmt.Sprintf("SUBTASK TOOL RESULT: %s\n", result))
+
+		toolResultContent := fmt.Sprintf("%s Result:\n%s", formatToolDescription(toolUse), result)
+		if _, exists := toolUse["has_multiple_tools"]; exists {
+			toolResultContent += "\n\nOnly one tool may be used per message. You must assess the first tool's result before proceeding to use the next tool."
+		}
+		toolResultMessage := map[string]string{
+			"role":    "user",
+			"content": toolResultContent,
+		}
+		if toolCallID != "" {
+			toolResultMessage["role"] = "tool"
+			toolResultMessage["tool_call_id"] = toolCallID
+		}
+		if images := core.TakePendingImages(); len(images) > 0 {
+			toolResultMessage["images"] = strings.Join(images, ",")
+		}
+		*conversation = append(*conversation, toolResultMessage)
+
+		core.UpdateContextMessages(client.GetModelInfo(), conversation, &currentDeletedRange, response.Usage)
+	}
+}
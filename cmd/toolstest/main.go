@@ -20,22 +20,40 @@ Usage:
 Available tools:
   execute_command     - Execute command line commands
   read_file           - Read file contents
+  read_files          - Read multiple files at once
   write_file          - Write content to a file
+  write_files         - Write several files as one transaction
   replace_in_file     - Replace content in a file
+  apply_patch         - Apply a unified diff to one or more files
   search_files        - Search for content in files
   list_files          - List files in a directory
   list_definitions    - List code definition names
+  get_file_diff       - Show the diff of a file against HEAD or another commit
+  git_status          - Show the branch and the changed files of the repository
+  git_diff            - Show the changes of the repository against HEAD or another commit
+  git_log             - List recent commits
+  git_branch          - List the branches
+  git_stage_hunks     - List the unstaged hunks of a file or stage some of them
+  verify_build        - Check that the project compiles and list the errors
   find_files          - Find files matching a pattern
   fetch_web           - Fetch web content
+  download_file       - Download a file with optional sha256 verification
   use_mcp_tool        - Call a tool provided by an MCP server
+  describe_mcp_tool   - Show the input schema of a tool provided by an MCP server
   access_mcp_resource - Access a resource provided by an MCP server
 
 Examples:
   toolstest execute_command --command "ls -la"
   toolstest read_file --path "file.txt" --range "1-10"
+  toolstest read_file --path "generated.go" --offset 2000 --limit 500
   toolstest write_file --path "new.txt" --content "Hello World"
+  toolstest write_files --files '[{"path":"a.txt","content":"A"},{"path":"b.txt","content":"B"}]'
+  toolstest apply_patch --patch "$(git diff)"
   toolstest search_files --path "." --regex "function"
   toolstest list_files --path "." --recursive
+  toolstest get_file_diff --path "main.go" --base "main"
+  toolstest git_log --ref "main..HEAD" --count 10
+  toolstest verify_build --path "."
   toolstest use_mcp_tool --server_name "openai" --tool_name "dalle3" --arguments '{"prompt":"cat"}'
 `
 
@@ -61,8 +79,10 @@ func main() {
 		"read_file": {
 			Func: core.ReadFile,
 			ParamFlags: map[string]*string{
-				"path":  nil,
-				"range": nil,
+				"path":   nil,
+				"range":  nil,
+				"offset": nil,
+				"limit":  nil,
 			},
 		},
 		"write_file": {
@@ -72,6 +92,12 @@ func main() {
 				"content": nil,
 			},
 		},
+		"write_files": {
+			Func: writeFiles,
+			ParamFlags: map[string]*string{
+				"files": nil,
+			},
+		},
 		"replace_in_file": {
 			Func: core.ReplaceInFile,
 			ParamFlags: map[string]*string{
@@ -79,6 +105,12 @@ func main() {
 				"diff": nil,
 			},
 		},
+		"apply_patch": {
+			Func: core.ApplyPatch,
+			ParamFlags: map[string]*string{
+				"patch": nil,
+			},
+		},
 		"search_files": {
 			Func: core.SearchFiles,
 			ParamFlags: map[string]*string{
@@ -96,12 +128,68 @@ func main() {
 				"recursive": nil,
 			},
 		},
+		"read_files": {
+			Func: core.ReadFiles,
+			ParamFlags: map[string]*string{
+				"paths": nil,
+			},
+		},
 		"list_definitions": {
 			Func: core.ListCodeDefinitionNames,
 			ParamFlags: map[string]*string{
 				"path": nil,
 			},
 		},
+		"get_file_diff": {
+			Func: core.GetFileDiff,
+			ParamFlags: map[string]*string{
+				"path": nil,
+				"base": nil,
+			},
+		},
+		"git_status": {
+			Func: core.GitStatus,
+			ParamFlags: map[string]*string{
+				"path": nil,
+			},
+		},
+		"git_diff": {
+			Func: core.GitDiff,
+			ParamFlags: map[string]*string{
+				"base": nil,
+				"path": nil,
+			},
+			BoolFlags: map[string]*bool{
+				"staged": nil,
+			},
+		},
+		"git_log": {
+			Func: core.GitLog,
+			ParamFlags: map[string]*string{
+				"ref":   nil,
+				"path":  nil,
+				"count": nil,
+			},
+		},
+		"git_branch": {
+			Func: core.GitBranch,
+			BoolFlags: map[string]*bool{
+				"all": nil,
+			},
+		},
+		"git_stage_hunks": {
+			Func: core.StageHunks,
+			ParamFlags: map[string]*string{
+				"path":  nil,
+				"hunks": nil,
+			},
+		},
+		"verify_build": {
+			Func: core.VerifyBuild,
+			ParamFlags: map[string]*string{
+				"path": nil,
+			},
+		},
 		"find_files": {
 			Func: core.FindFiles,
 			ParamFlags: map[string]*string{
@@ -115,6 +203,14 @@ func main() {
 				"url": nil,
 			},
 		},
+		"download_file": {
+			Func: core.DownloadFile,
+			ParamFlags: map[string]*string{
+				"url":    nil,
+				"path":   nil,
+				"sha256": nil,
+			},
+		},
 		"use_mcp_tool": {
 			Func: core.UseMcpTool,
 			ParamFlags: map[string]*string{
@@ -123,6 +219,13 @@ func main() {
 				"arguments":   nil,
 			},
 		},
+		"describe_mcp_tool": {
+			Func: core.DescribeMcpTool,
+			ParamFlags: map[string]*string{
+				"server_name": nil,
+				"tool_name":   nil,
+			},
+		},
 		"access_mcp_resource": {
 			Func: core.AccessMcpResource,
 			ParamFlags: map[string]*string{
@@ -210,14 +313,21 @@ func main() {
 	// Check if required parameters are provided
 	if (toolName == "execute_command" && params["command"] == nil) ||
 		(toolName == "read_file" && params["path"] == nil) ||
+		(toolName == "read_files" && params["paths"] == nil) ||
 		(toolName == "write_file" && (params["path"] == nil || params["content"] == nil)) ||
+		(toolName == "write_files" && params["files"] == nil) ||
 		(toolName == "replace_in_file" && (params["path"] == nil || params["diff"] == nil)) ||
+		(toolName == "apply_patch" && params["patch"] == nil) ||
 		(toolName == "search_files" && (params["path"] == nil || params["regex"] == nil)) ||
 		(toolName == "list_files" && params["path"] == nil) ||
 		(toolName == "list_definitions" && params["path"] == nil) ||
+		(toolName == "get_file_diff" && params["path"] == nil) ||
+		(toolName == "git_stage_hunks" && params["path"] == nil) ||
 		(toolName == "find_files" && (params["path"] == nil || params["file_pattern"] == nil)) ||
 		(toolName == "fetch_web" && params["url"] == nil) ||
+		(toolName == "download_file" && (params["url"] == nil || params["path"] == nil)) ||
 		(toolName == "use_mcp_tool" && (params["server_name"] == nil || params["tool_name"] == nil || params["arguments"] == nil)) ||
+		(toolName == "describe_mcp_tool" && (params["server_name"] == nil || params["tool_name"] == nil)) ||
 		(toolName == "access_mcp_resource" && (params["server_name"] == nil || params["uri"] == nil)) {
 		fmt.Println("Error: Missing required parameters")
 		fmt.Printf("Required parameters: %s\n", strings.Join(getRequiredParams(toolName), ", "))
@@ -238,25 +348,54 @@ func getRequiredParams(toolName string) []string {
 		return []string{"command"}
 	case "read_file":
 		return []string{"path"}
+	case "read_files":
+		return []string{"paths"}
 	case "write_file":
 		return []string{"path", "content"}
+	case "write_files":
+		return []string{"files"}
 	case "replace_in_file":
 		return []string{"path", "diff"}
+	case "apply_patch":
+		return []string{"patch"}
 	case "search_files":
 		return []string{"path", "regex"}
 	case "list_files":
 		return []string{"path"}
 	case "list_definitions":
 		return []string{"path"}
+	case "get_file_diff", "git_stage_hunks":
+		return []string{"path"}
 	case "find_files":
 		return []string{"path", "file_pattern"}
 	case "fetch_web":
 		return []string{"url"}
+	case "download_file":
+		return []string{"url", "path"}
 	case "use_mcp_tool":
 		return []string{"server_name", "tool_name", "arguments"}
+	case "describe_mcp_tool":
+		return []string{"server_name", "tool_name"}
 	case "access_mcp_resource":
 		return []string{"server_name", "uri"}
 	default:
 		return []string{}
 	}
 }
+
+// writeFiles runs write_files with the files given as a JSON array of path and content objects
+func writeFiles(params map[string]interface{}) string {
+	data, ok := params["files"].(string)
+	if !ok {
+		// Passed with --json as an array
+		encoded, _ := json.Marshal(params["files"])
+		data = string(encoded)
+	}
+
+	var files []core.FileWrite
+	if err := json.Unmarshal([]byte(data), &files); err != nil {
+		return fmt.Sprintf("Error: Invalid files parameter: %s", err)
+	}
+	params["files"] = files
+	return core.WriteFiles(params)
+}
@@ -0,0 +1,192 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/pederhe/nca/pkg/config"
+	"github.com/pederhe/nca/pkg/utils"
+)
+
+// Session override of the auto_approve config, nil means the config value is used
+var (
+	sessionAutoApprove      *bool
+	sessionAutoApproveMutex sync.RWMutex
+)
+
+// Approval policies, set with --yes and --approval for runs nobody can answer prompts in, like CI.
+// Without a policy the user is asked, unless stdin isn't a terminal.
+const (
+	// ApprovalYes approves every action
+	ApprovalYes = "yes"
+	// ApprovalAutoSafe approves the actions checkpoints can undo, file writes and handoffs, and
+	// denies the others, like pull requests and comments others see
+	ApprovalAutoSafe = "auto-safe"
+	// ApprovalNever denies every action that needs approval
+	ApprovalNever = "never"
+	// ApprovalAlwaysAsk asks for every action, file writes and auto-approved ones included
+	ApprovalAlwaysAsk = "always-ask"
+)
+
+// Actions that need the user's approval, as named in the results of denied actions
+const (
+	approveCommand     = "command"
+	approveWrite       = "file write"
+	approveCommit      = "commit"
+	approveDownload    = "download"
+	approveMCPTool     = "MCP tool call"
+	approveNewTask     = "new task"
+	approveLockedEdit  = "edit of a file locked by another nca instance"
+	approvePullRequest = "pull request"
+	approvePRComment   = "pull request comment"
+)
+
+// How an action needing approval is handled
+type approvalDecision int
+
+const (
+	askUser approvalDecision = iota
+	approveAction
+	denyAction
+)
+
+var approvalPolicy string
+
+// SetApprovalPolicy sets how the actions needing approval are handled, "" asks the user
+func SetApprovalPolicy(policy string) error {
+	switch policy {
+	case "", ApprovalYes, ApprovalAutoSafe, ApprovalNever:
+	case ApprovalAlwaysAsk:
+		SetSessionAutoApprove(false)
+	default:
+		return fmt.Errorf("unknown approval policy '%s', use %s, %s or %s", policy, ApprovalNever, ApprovalAutoSafe, ApprovalAlwaysAsk)
+	}
+	approvalPolicy = policy
+	return nil
+}
+
+// decideApproval returns how the approval policy handles an action that needs approval. Without
+// a policy the user is asked if they can answer, a prompt on a pipe could wait forever.
+func decideApproval(action string) approvalDecision {
+	switch approvalPolicy {
+	case ApprovalYes:
+		if IsWorkspaceUntrusted() {
+			return denyAction
+		}
+		return approveAction
+	case ApprovalAutoSafe:
+		if action == approveWrite || action == approveNewTask {
+			return approveAction
+		}
+		return denyAction
+	case ApprovalNever:
+		return denyAction
+	case ApprovalAlwaysAsk:
+		return askUser
+	}
+	if !CanAskUser() {
+		return denyAction
+	}
+	return askUser
+}
+
+// CanAskUser returns whether the user can answer prompts: stdin is a terminal, the prompts aren't
+// written to a pipe and no approval policy answers for them
+func CanAskUser() bool {
+	if approvalPolicy != "" && approvalPolicy != ApprovalAlwaysAsk {
+		return false
+	}
+	if utils.IsOutputPiped() {
+		return false
+	}
+	stat, err := os.Stdin.Stat()
+	return err == nil && stat.Mode()&os.ModeCharDevice != 0
+}
+
+// approvalDenial returns the result for the model of an action the approval policy denied
+func approvalDenial(action string) string {
+	policy := approvalPolicy
+	if policy == "" {
+		policy = "no terminal to ask the user, run nca with --yes or --approval to allow actions"
+	}
+	return fmt.Sprintf("Error: The %s was blocked by the approval policy (%s), nobody can approve it in this run. "+
+		"Don't try to do it in another way, continue without it and mention it in your answer.", action, policy)
+}
+
+// IsWorkspaceUntrusted returns whether the user declined to trust the current directory.
+// Directories without a trust decision are not considered untrusted, but aren't trusted either.
+func IsWorkspaceUntrusted() bool {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return false
+	}
+	trusted, known := config.GetWorkspaceTrust(cwd)
+	return known && !trusted
+}
+
+// IsWorkspaceTrusted returns whether the user trusted the current directory. The project's
+// rules, commands, templates, allowlists and settings that run commands are only used in trusted
+// workspaces, undecided ones included: runs without a terminal never ask and stay undecided.
+func IsWorkspaceTrusted() bool {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return false
+	}
+	trusted, known := config.GetWorkspaceTrust(cwd)
+	return known && trusted
+}
+
+// getTrustedConfig returns a setting, from the config and env files of the project only in
+// trusted workspaces. Settings that run commands or lift restrictions are read with it, an
+// untrusted project could set them to anything.
+func getTrustedConfig(key string) string {
+	if IsWorkspaceTrusted() {
+		return config.Get(key)
+	}
+	return config.GetUser(key)
+}
+
+// IsAutoApprove returns whether tool approvals are skipped, always with --yes.
+// A session override set with SetSessionAutoApprove takes precedence over the auto_approve config.
+// Auto-approve is always off in untrusted workspaces, and the auto_approve config of the project
+// only applies in trusted ones.
+func IsAutoApprove() bool {
+	if IsWorkspaceUntrusted() {
+		return false
+	}
+	if approvalPolicy == ApprovalYes {
+		return true
+	}
+
+	sessionAutoApproveMutex.RLock()
+	override := sessionAutoApprove
+	sessionAutoApproveMutex.RUnlock()
+
+	if override != nil {
+		return *override
+	}
+	value := getTrustedConfig("auto_approve")
+	return value == "true" || value == "1"
+}
+
+// SetSessionAutoApprove overrides the auto_approve config for the rest of the session
+func SetSessionAutoApprove(enabled bool) {
+	sessionAutoApproveMutex.Lock()
+	defer sessionAutoApproveMutex.Unlock()
+	sessionAutoApprove = &enabled
+}
+
+// ClearSessionAutoApprove removes the session override so the auto_approve config applies again
+func ClearSessionAutoApprove() {
+	sessionAutoApproveMutex.Lock()
+	defer sessionAutoApproveMutex.Unlock()
+	sessionAutoApprove = nil
+}
+
+// ToggleAutoApprove flips the effective auto-approve state for the session and returns the new state
+func ToggleAutoApprove() bool {
+	enabled := !IsAutoApprove()
+	SetSessionAutoApprove(enabled)
+	return enabled
+}
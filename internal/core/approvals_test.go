@@ -0,0 +1,155 @@
+package core
+
+import (
+	"os"
+	"testing"
+
+	"github.com/pederhe/nca/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSessionAutoApprove(t *testing.T) {
+	tmpDir := t.TempDir()
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(originalDir)
+	os.Chdir(tmpDir)
+	t.Setenv("HOME", t.TempDir())
+	trustWorkspace(t)
+	defer ClearSessionAutoApprove()
+
+	assert.False(t, IsAutoApprove())
+
+	// The config value applies without an override
+	assert.NoError(t, config.Set("auto_approve", "true", false))
+	assert.True(t, IsAutoApprove())
+
+	// Toggling overrides the config for the session
+	assert.False(t, ToggleAutoApprove())
+	assert.False(t, IsAutoApprove())
+	assert.True(t, ToggleAutoApprove())
+	assert.True(t, IsAutoApprove())
+
+	SetSessionAutoApprove(false)
+	assert.False(t, IsAutoApprove())
+
+	// Clearing the override falls back to the config
+	ClearSessionAutoApprove()
+	assert.True(t, IsAutoApprove())
+}
+
+func TestUntrustedWorkspace(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	tmpDir := t.TempDir()
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(originalDir)
+	os.Chdir(tmpDir)
+	defer ClearSessionAutoApprove()
+
+	assert.NoError(t, config.Set("auto_approve", "true", false))
+
+	// Without a decision the workspace isn't untrusted, but the project's settings don't apply
+	assert.False(t, IsWorkspaceUntrusted())
+	assert.False(t, IsWorkspaceTrusted())
+	assert.False(t, IsAutoApprove())
+	assert.True(t, IsNetworkAllowed())
+	assert.NoError(t, config.Set("auto_approve", "true", true))
+	assert.True(t, IsAutoApprove())
+	assert.NoError(t, config.Unset("auto_approve", true))
+
+	// Untrusted workspaces never auto-approve and have no network access
+	cwd, _ := os.Getwd()
+	assert.NoError(t, config.SetWorkspaceTrust(cwd, false))
+	assert.True(t, IsWorkspaceUntrusted())
+	assert.False(t, IsAutoApprove())
+	SetSessionAutoApprove(true)
+	assert.False(t, IsAutoApprove())
+	assert.False(t, IsNetworkAllowed())
+
+	// Decisions apply to subdirectories
+	assert.NoError(t, os.Mkdir("sub", 0755))
+	trusted, known := config.GetWorkspaceTrust("sub")
+	assert.True(t, known)
+	assert.False(t, trusted)
+
+	// Trusting the workspace lifts the restrictions
+	assert.NoError(t, config.SetWorkspaceTrust(cwd, true))
+	assert.True(t, IsWorkspaceTrusted())
+	assert.True(t, IsAutoApprove())
+	assert.True(t, IsNetworkAllowed())
+
+	removed, err := config.RevokeWorkspaceTrust(cwd)
+	assert.NoError(t, err)
+	assert.True(t, removed)
+	_, known = config.GetWorkspaceTrust(cwd)
+	assert.False(t, known)
+}
+
+// trustWorkspace trusts the current directory, the test must use a temporary home
+func trustWorkspace(t *testing.T) {
+	t.Helper()
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := config.SetWorkspaceTrust(cwd, true); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestApprovalPolicy(t *testing.T) {
+	t.Chdir(t.TempDir())
+	defer SetApprovalPolicy("")
+	defer ClearSessionAutoApprove()
+
+	assert.Error(t, SetApprovalPolicy("sometimes"))
+
+	assert.NoError(t, SetApprovalPolicy(ApprovalYes))
+	assert.True(t, IsAutoApprove())
+	assert.Equal(t, approveAction, decideApproval(approveCommit))
+	assert.False(t, CanAskUser())
+
+	// auto-safe approves what checkpoints can undo
+	assert.NoError(t, SetApprovalPolicy(ApprovalAutoSafe))
+	assert.False(t, IsAutoApprove())
+	assert.Equal(t, approveAction, decideApproval(approveWrite))
+	assert.Equal(t, approveAction, decideApproval(approveNewTask))
+	assert.Equal(t, denyAction, decideApproval(approveCommand))
+	assert.Equal(t, denyAction, decideApproval(approveMCPTool))
+
+	// Denied actions are returned to the model instead of asking
+	assert.NoError(t, SetApprovalPolicy(ApprovalNever))
+	assert.Equal(t, denyAction, decideApproval(approveWrite))
+	result := ExecuteCommand(map[string]interface{}{"command": "touch created", "requires_approval": true})
+	assert.Contains(t, result, "Error: The command was blocked by the approval policy (never)")
+	assert.NoFileExists(t, "created")
+	assert.Contains(t, GitCommit(map[string]interface{}{"message": "Update", "files": []string{"a.go"}}), "blocked by the approval policy")
+
+	// always-ask overrides auto-approve and asks for file writes
+	assert.NoError(t, config.Set("auto_approve", "true", false))
+	assert.NoError(t, SetApprovalPolicy(ApprovalAlwaysAsk))
+	assert.False(t, IsAutoApprove())
+	assert.True(t, isWriteApprovalEnabled())
+}
+
+func TestCanAskUserWithPipedOutput(t *testing.T) {
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	defer writer.Close()
+	stdout := os.Stdout
+	os.Stdout = writer
+	defer func() { os.Stdout = stdout }()
+
+	// Prompts written to a pipe can't be seen, the actions are denied and the output isn't collapsed
+	assert.False(t, CanAskUser())
+	assert.Equal(t, denyAction, decideApproval(approveCommand))
+	assert.True(t, IsVerboseOutput())
+}
@@ -0,0 +1,292 @@
+package core
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pederhe/nca/pkg/api/types"
+	"github.com/pederhe/nca/pkg/utils"
+)
+
+// Artifact describes a piece of data stored outside the conversation
+type Artifact struct {
+	ID        string    `json:"id"`
+	Kind      string    `json:"kind"`   // "tool_result", "web_page", "command_log", "image", ...
+	Source    string    `json:"source"` // Tool name, URL or command that produced the data
+	Size      int       `json:"size"`
+	Lines     int       `json:"lines"`
+	MimeType  string    `json:"mime_type,omitempty"` // Only set for binary artifacts
+	File      string    `json:"file"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// IsBinary returns whether the artifact holds binary data such as an image
+func (a *Artifact) IsBinary() bool {
+	return a.MimeType != ""
+}
+
+// ArtifactStore saves large outputs to disk so they can be paged through on demand
+type ArtifactStore struct {
+	dir       string
+	mutex     sync.Mutex
+	nextID    int
+	artifacts map[string]*Artifact
+}
+
+// ArtifactStore instance for the current session
+var artifactStore *ArtifactStore
+
+// GetArtifactStore returns the artifact store of the current session
+func GetArtifactStore() *ArtifactStore {
+	if artifactStore == nil {
+		sessionID := time.Now().Format("20060102-150405")
+		artifactStore = NewArtifactStore(filepath.Join(".nca", "artifacts", sessionID))
+	}
+	return artifactStore
+}
+
+// NewArtifactStore creates an artifact store that saves its files in dir
+func NewArtifactStore(dir string) *ArtifactStore {
+	return &ArtifactStore{
+		dir:       dir,
+		nextID:    1,
+		artifacts: make(map[string]*Artifact),
+	}
+}
+
+// Dir returns the directory where artifacts are stored
+func (s *ArtifactStore) Dir() string {
+	return s.dir
+}
+
+// Save stores content as a new artifact and returns its metadata
+func (s *ArtifactStore) Save(kind string, source string, content string) (*Artifact, error) {
+	return s.save(&Artifact{
+		Kind:   kind,
+		Source: source,
+		Lines:  strings.Count(content, "\n") + 1,
+	}, []byte(content), ".txt")
+}
+
+// SaveBinary stores binary data such as an image as a new artifact and returns its metadata
+func (s *ArtifactStore) SaveBinary(kind string, source string, mimeType string, data []byte) (*Artifact, error) {
+	ext := ".bin"
+	if mimeType == "image/jpeg" {
+		ext = ".jpg"
+	} else if exts, err := mime.ExtensionsByType(mimeType); err == nil && len(exts) > 0 {
+		ext = exts[0]
+	}
+	return s.save(&Artifact{
+		Kind:     kind,
+		Source:   source,
+		MimeType: mimeType,
+	}, data, ext)
+}
+
+func (s *ArtifactStore) save(artifact *Artifact, data []byte, ext string) (*Artifact, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return nil, err
+	}
+
+	artifact.ID = fmt.Sprintf("art-%d", s.nextID)
+	artifact.Size = len(data)
+	artifact.File = filepath.Join(s.dir, artifact.ID+ext)
+	artifact.CreatedAt = time.Now()
+
+	if err := os.WriteFile(artifact.File, data, 0644); err != nil {
+		return nil, err
+	}
+
+	meta, err := json.MarshalIndent(artifact, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(s.metaPath(artifact.ID), meta, 0644); err != nil {
+		return nil, err
+	}
+
+	s.artifacts[artifact.ID] = artifact
+	s.nextID++
+
+	return artifact, nil
+}
+
+// artifactIDRegex matches the IDs of artifacts generated by Save
+var artifactIDRegex = regexp.MustCompile(`^art-[0-9]+$`)
+
+// Get returns the metadata and content of an artifact
+func (s *ArtifactStore) Get(id string) (*Artifact, string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	artifact, ok := s.artifacts[id]
+	if !ok {
+		// IDs come from the model, only generated ones may become paths
+		if !artifactIDRegex.MatchString(id) {
+			return nil, "", fmt.Errorf("artifact '%s' not found", id)
+		}
+		// The artifact may have been saved by an earlier store for the same directory
+		meta, err := os.ReadFile(s.metaPath(id))
+		if err != nil {
+			return nil, "", fmt.Errorf("artifact '%s' not found", id)
+		}
+		artifact = &Artifact{}
+		if err := json.Unmarshal(meta, artifact); err != nil {
+			return nil, "", fmt.Errorf("invalid metadata for artifact '%s': %w", id, err)
+		}
+	}
+
+	data, err := os.ReadFile(artifact.File)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read artifact '%s': %w", id, err)
+	}
+
+	return artifact, string(data), nil
+}
+
+// List returns all artifacts of the store, ordered by creation
+func (s *ArtifactStore) List() []*Artifact {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	list := make([]*Artifact, 0, len(s.artifacts))
+	for _, artifact := range s.artifacts {
+		list = append(list, artifact)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt.Before(list[j].CreatedAt)
+	})
+	return list
+}
+
+func (s *ArtifactStore) metaPath(id string) string {
+	return filepath.Join(s.dir, id+".json")
+}
+
+// GetArtifact returns the content of a stored artifact, optionally limited to a line range
+func GetArtifact(params map[string]interface{}) string {
+	id, ok := params["id"].(string)
+	if !ok || id == "" {
+		return "Error: Missing artifact id parameter"
+	}
+
+	artifact, content, err := GetArtifactStore().Get(id)
+	if err != nil {
+		return fmt.Sprintf("Error: %s", err)
+	}
+
+	if artifact.IsBinary() {
+		return fmt.Sprintf("Error: Artifact %s is binary data (%s, %d bytes) and cannot be read as text, it is saved at %s",
+			artifact.ID, artifact.MimeType, artifact.Size, artifact.File)
+	}
+
+	lines := strings.Split(content, "\n")
+	startLine, endLine := 1, len(lines)
+
+	if rangeStr, _ := params["range"].(string); rangeStr != "" {
+		parts := strings.Split(rangeStr, "-")
+		if len(parts) != 2 {
+			return "Error: Invalid range format. Expected format: start-end (e.g. 1-100)"
+		}
+		if startLine, err = strconv.Atoi(strings.TrimSpace(parts[0])); err != nil {
+			return "Error: Invalid start line number"
+		}
+		if endLine, err = strconv.Atoi(strings.TrimSpace(parts[1])); err != nil {
+			return "Error: Invalid end line number"
+		}
+	}
+
+	if startLine < 1 {
+		startLine = 1
+	}
+	if endLine == 0 || endLine > len(lines) {
+		endLine = len(lines)
+	}
+	if startLine > endLine {
+		return "Error: start line cannot be greater than end line"
+	}
+
+	// Never return more than the result limit, tell the model where to continue instead
+	maxChars := GetToolResultLimit("get_artifact") * charsPerToken
+	var result strings.Builder
+	lastLine := startLine - 1
+	for i := startLine - 1; i < endLine; i++ {
+		if maxChars > 0 && result.Len()+len(lines[i])+1 > maxChars && lastLine >= startLine {
+			break
+		}
+		result.WriteString(lines[i])
+		result.WriteString("\n")
+		lastLine = i + 1
+	}
+
+	header := fmt.Sprintf("[Artifact %s (%s from %s): lines %d-%d of %d]\n", artifact.ID, artifact.Kind, artifact.Source, startLine, lastLine, artifact.Lines)
+	if lastLine < endLine {
+		return header + result.String() + fmt.Sprintf("\n[Output limited, continue with range %d-%d]", lastLine+1, endLine)
+	}
+	return header + result.String()
+}
+
+// Images produced by the last tool call that can be passed to models with image support
+var (
+	pendingImages      []string
+	pendingImagesMutex sync.Mutex
+)
+
+// addPendingImage queues an image artifact for the next message to the model
+func addPendingImage(id string) {
+	pendingImagesMutex.Lock()
+	defer pendingImagesMutex.Unlock()
+	pendingImages = append(pendingImages, id)
+}
+
+// TakePendingImages returns the IDs of image artifacts produced since the last call and clears the queue
+func TakePendingImages() []string {
+	pendingImagesMutex.Lock()
+	defer pendingImagesMutex.Unlock()
+	ids := pendingImages
+	pendingImages = nil
+	return ids
+}
+
+// LoadArtifactImages loads image artifacts so they can be attached to a message
+func LoadArtifactImages(ids []string) []types.Image {
+	var images []types.Image
+	for _, id := range ids {
+		artifact, content, err := GetArtifactStore().Get(id)
+		if err != nil || artifact.Kind != "image" {
+			continue
+		}
+		images = append(images, types.Image{
+			MimeType: artifact.MimeType,
+			Data:     base64.StdEncoding.EncodeToString([]byte(content)),
+		})
+	}
+	return images
+}
+
+// SavePromptImages stores the images attached to a prompt as artifacts and returns their IDs,
+// which the message of the prompt references so they're sent with it
+func SavePromptImages(images []utils.PromptImage) ([]string, error) {
+	var ids []string
+	for _, image := range images {
+		artifact, err := GetArtifactStore().SaveBinary("image", image.Path, image.MimeType, image.Data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to save image %s: %w", image.Path, err)
+		}
+		ids = append(ids, artifact.ID)
+	}
+	return ids, nil
+}
@@ -0,0 +1,184 @@
+package core
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pederhe/nca/pkg/config"
+	"github.com/pederhe/nca/pkg/mcp/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestArtifactStore(t *testing.T) {
+	store := NewArtifactStore(filepath.Join(t.TempDir(), "artifacts"))
+
+	first, err := store.Save("tool_result", "search_files", "a\nb\nc")
+	assert.NoError(t, err)
+	assert.Equal(t, "art-1", first.ID)
+	assert.Equal(t, 3, first.Lines)
+
+	second, err := store.Save("web_page", "https://example.com", "page")
+	assert.NoError(t, err)
+	assert.Equal(t, "art-2", second.ID)
+
+	artifact, content, err := store.Get("art-1")
+	assert.NoError(t, err)
+	assert.Equal(t, "search_files", artifact.Source)
+	assert.Equal(t, "a\nb\nc", content)
+
+	// Artifacts saved to disk can be read by a new store for the same directory
+	reopened := NewArtifactStore(store.Dir())
+	artifact, content, err = reopened.Get("art-2")
+	assert.NoError(t, err)
+	assert.Equal(t, "web_page", artifact.Kind)
+	assert.Equal(t, "page", content)
+
+	_, _, err = store.Get("art-3")
+	assert.Error(t, err)
+
+	// IDs that aren't generated ones don't reach the file system
+	outside := filepath.Join(filepath.Dir(store.Dir()), "outside")
+	require.NoError(t, os.WriteFile(outside+".txt", []byte("secret"), 0644))
+	require.NoError(t, os.WriteFile(outside+".json", []byte(`{"id":"x","file":"`+filepath.ToSlash(outside)+`.txt"}`), 0644))
+	_, _, err = reopened.Get("../outside")
+	assert.EqualError(t, err, "artifact '../outside' not found")
+
+	assert.Len(t, store.List(), 2)
+}
+
+func TestGetArtifact(t *testing.T) {
+	tmpDir := t.TempDir()
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(originalDir)
+	os.Chdir(tmpDir)
+
+	var builder strings.Builder
+	for i := 1; i <= 100; i++ {
+		builder.WriteString("line of output\n")
+	}
+	artifact, err := GetArtifactStore().Save("command_log", "execute_command", strings.TrimSuffix(builder.String(), "\n"))
+	assert.NoError(t, err)
+
+	// Missing id
+	assert.Contains(t, GetArtifact(map[string]interface{}{}), "Error")
+
+	// Unknown id
+	assert.Contains(t, GetArtifact(map[string]interface{}{"id": "art-999"}), "not found")
+
+	// Range
+	result := GetArtifact(map[string]interface{}{"id": artifact.ID, "range": "10-20"})
+	assert.Contains(t, result, "lines 10-20 of 100")
+	assert.Equal(t, 11, strings.Count(result, "line of output"))
+
+	// Invalid range
+	assert.Contains(t, GetArtifact(map[string]interface{}{"id": artifact.ID, "range": "abc"}), "Error")
+
+	// Output is limited and tells where to continue
+	assert.NoError(t, config.Set("tool_result_limit.get_artifact", "50", false))
+	result = GetArtifact(map[string]interface{}{"id": artifact.ID})
+	assert.Contains(t, result, "continue with range")
+	assert.Less(t, strings.Count(result, "line of output"), 100)
+}
+
+func TestFormatToolResponseImages(t *testing.T) {
+	tmpDir := t.TempDir()
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(originalDir)
+	os.Chdir(tmpDir)
+	TakePendingImages()
+
+	imageData := []byte("\x89PNG fake image data")
+	response := &common.McpToolCallResponse{
+		Content: []common.ToolResponseContent{
+			{Type: "text", Text: "Generated image"},
+			{Type: "image", MimeType: "image/png", Data: base64.StdEncoding.EncodeToString(imageData)},
+		},
+	}
+
+	result := formatToolResponse(response)
+	assert.Contains(t, result, "Generated image")
+	assert.Contains(t, result, "Image with MIME type: image/png")
+	assert.NotContains(t, result, base64.StdEncoding.EncodeToString(imageData))
+
+	// The image is stored as a binary artifact and queued for the model
+	ids := TakePendingImages()
+	assert.Len(t, ids, 1)
+	assert.Empty(t, TakePendingImages())
+
+	artifact, content, err := GetArtifactStore().Get(ids[0])
+	assert.NoError(t, err)
+	assert.True(t, artifact.IsBinary())
+	assert.Equal(t, "image", artifact.Kind)
+	assert.Equal(t, string(imageData), content)
+	assert.Contains(t, GetArtifact(map[string]interface{}{"id": ids[0]}), "binary data")
+
+	images := LoadArtifactImages(ids)
+	assert.Len(t, images, 1)
+	assert.Equal(t, "image/png", images[0].MimeType)
+	assert.Equal(t, base64.StdEncoding.EncodeToString(imageData), images[0].Data)
+}
+
+func TestFormatResourceResponse(t *testing.T) {
+	tmpDir := t.TempDir()
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(originalDir)
+	os.Chdir(tmpDir)
+
+	response := &common.McpResourceResponse{
+		Contents: []common.ResourceContent{
+			{URI: "docs://page", MimeType: "text/html", Text: "<html><head><script>x()</script></head><body><h1>Title</h1><p>See <a href=\"https://example.com\">docs</a></p></body></html>"},
+			{URI: "docs://notes", MimeType: "text/plain", Blob: base64.StdEncoding.EncodeToString([]byte("plain notes"))},
+			{URI: "docs://file", MimeType: "application/octet-stream", Blob: base64.StdEncoding.EncodeToString([]byte("binary"))},
+		},
+	}
+
+	result := formatResourceResponse(response, 1024)
+	assert.Contains(t, result, "# Title")
+	assert.Contains(t, result, "[docs](https://example.com)")
+	assert.NotContains(t, result, "<h1>")
+	assert.NotContains(t, result, "x()")
+	assert.Contains(t, result, "plain notes")
+	assert.Contains(t, result, "Binary data with MIME type: application/octet-stream")
+
+	// Content beyond the maximum size is cut off and saved as an artifact
+	long := strings.Repeat("line of text\n", 200)
+	response = &common.McpResourceResponse{
+		Contents: []common.ResourceContent{
+			{URI: "docs://long", MimeType: "text/plain", Text: long},
+			{URI: "docs://large", MimeType: "image/png", Blob: base64.StdEncoding.EncodeToString([]byte(long))},
+		},
+	}
+	result = formatResourceResponse(response, 1024)
+	assert.Contains(t, result, "[Resource truncated: showing 1.0KB of")
+	assert.Contains(t, result, "Full content saved as artifact")
+	assert.Contains(t, result, "not saved because it exceeds the maximum size")
+	assert.Less(t, len(result), 2048)
+}
+
+func TestGetOptionalIntParam(t *testing.T) {
+	value, err := getOptionalIntParam(map[string]interface{}{}, "timeout", 600)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, value)
+
+	value, err = getOptionalIntParam(map[string]interface{}{"timeout": " 30 "}, "timeout", 600)
+	assert.NoError(t, err)
+	assert.Equal(t, 30, value)
+
+	_, err = getOptionalIntParam(map[string]interface{}{"timeout": "abc"}, "timeout", 600)
+	assert.Error(t, err)
+	_, err = getOptionalIntParam(map[string]interface{}{"timeout": "601"}, "timeout", 600)
+	assert.Error(t, err)
+}
@@ -0,0 +1,260 @@
+package core
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pederhe/nca/pkg/log"
+)
+
+// AuditEntry is a mutating action recorded in the audit log
+type AuditEntry struct {
+	Time     time.Time `json:"time"`
+	Tool     string    `json:"tool"`
+	Target   string    `json:"target"`              // File path, command, commit message or pull request
+	Approval string    `json:"approval"`            // approved, auto_approved, allowlisted, declined, blocked or not_required
+	Status   string    `json:"status"`              // success or error
+	DiffHash string    `json:"diff_hash,omitempty"` // sha256 of the written content, diff or committed files
+	CWD      string    `json:"cwd"`
+}
+
+// Tools whose calls are recorded in the audit log
+var auditedTools = map[string]bool{
+	"write_to_file":       true,
+	"write_files":         true,
+	"replace_in_file":     true,
+	"apply_patch":         true,
+	"execute_command":     true,
+	"verify_build":        true,
+	"git_commit":          true,
+	"download_file":       true,
+	"create_pull_request": true,
+	"comment_on_pr":       true,
+}
+
+// Tools that ask for approval with auto-approve too, only --yes skips the prompt
+var alwaysApprovedTools = map[string]bool{
+	"git_commit":          true,
+	"create_pull_request": true,
+	"comment_on_pr":       true,
+}
+
+// Results of tool calls the user declined
+var declinedResults = []string{
+	"Command execution cancelled",
+	"Commit cancelled",
+	"Download cancelled",
+	"File write cancelled",
+	"Pull request cancelled",
+	"Comment cancelled",
+}
+
+// getAuditLogPath returns the path of the audit log
+func getAuditLogPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".nca", "audit.jsonl"), nil
+}
+
+// hashAuditData returns the sha256 of audited content
+func hashAuditData(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
+
+// AuditBlocked is the approval of calls a check rejected before they ran
+const AuditBlocked = "blocked"
+
+// newAuditEntry creates the audit entry of a tool call from its parameters and result. The
+// approval is how the call was approved if the caller decided it, "" derives it from the tool.
+func newAuditEntry(toolName string, params map[string]interface{}, result string, approval string) AuditEntry {
+	entry := AuditEntry{
+		Time:     time.Now(),
+		Tool:     toolName,
+		Approval: "not_required",
+		Status:   "success",
+	}
+	entry.CWD, _ = os.Getwd()
+
+	switch toolName {
+	case "write_to_file":
+		entry.Target, _ = params["path"].(string)
+		if content, ok := params["content"].(string); ok {
+			entry.DiffHash = hashAuditData(content)
+		}
+		if isWriteApprovalEnabled() {
+			entry.Approval = "approved"
+		}
+	case "write_files":
+		if files, ok := params["files"].([]FileWrite); ok {
+			var paths, contents []string
+			for _, file := range files {
+				paths = append(paths, file.Path)
+				contents = append(contents, file.Path+"\n"+file.Content)
+			}
+			entry.Target = strings.Join(paths, ", ")
+			entry.DiffHash = hashAuditData(strings.Join(contents, "\n"))
+		}
+	case "replace_in_file":
+		entry.Target, _ = params["path"].(string)
+		if diff, ok := params["diff"].(string); ok {
+			entry.DiffHash = hashAuditData(diff)
+		}
+		if isWriteApprovalEnabled() {
+			entry.Approval = "approved"
+		}
+	case "apply_patch":
+		if patch, ok := params["patch"].(string); ok {
+			entry.Target = strings.Join(PatchFiles(patch), ", ")
+			entry.DiffHash = hashAuditData(patch)
+		}
+	case "execute_command":
+		entry.Target, _ = params["command"].(string)
+		if requiresApproval, _ := params["requires_approval"].(bool); requiresApproval {
+			entry.Approval = "approved"
+		}
+	case "verify_build":
+		if check, _, configured, errResult := findBuildCheck(params); errResult == "" {
+			entry.Target = check.command
+			if configured {
+				entry.Approval = "approved"
+			}
+		}
+	case "git_commit":
+		entry.Target, _ = params["message"].(string)
+		if files, ok := params["files"].([]string); ok {
+			entry.DiffHash = hashAuditData(strings.Join(files, "\n"))
+		}
+		entry.Approval = "approved"
+	case "download_file":
+		url, _ := params["url"].(string)
+		path, _ := params["path"].(string)
+		entry.Target = url + " -> " + path
+		entry.Approval = "approved"
+	case "create_pull_request":
+		entry.Target, _ = params["title"].(string)
+		if body, ok := params["body"].(string); ok {
+			entry.DiffHash = hashAuditData(body)
+		}
+		entry.Approval = "approved"
+	case "comment_on_pr":
+		entry.Target, _ = params["pr"].(string)
+		if body, ok := params["body"].(string); ok {
+			entry.DiffHash = hashAuditData(body)
+		}
+		entry.Approval = "approved"
+	}
+
+	// Approval prompts are skipped with auto-approve, except for commits and pull requests unless
+	// --yes is used
+	if entry.Approval == "approved" && (!alwaysApprovedTools[toolName] || approvalPolicy == ApprovalYes) && IsAutoApprove() {
+		entry.Approval = "auto_approved"
+	}
+
+	for _, declined := range declinedResults {
+		if strings.HasPrefix(result, declined) {
+			entry.Approval = "declined"
+			entry.Status = "cancelled"
+		}
+	}
+	if strings.HasPrefix(result, "Error") {
+		entry.Status = "error"
+		// Calls blocked by a pre hook, the command denylist or a file lock never ran
+		if strings.Contains(result, "blocked by") || strings.Contains(result, "another nca instance") {
+			entry.Approval = AuditBlocked
+		}
+	}
+	if approval != "" {
+		entry.Approval = approval
+	}
+	return entry
+}
+
+// RecordToolAudit appends a mutating tool call to the audit log (~/.nca/audit.jsonl), with the
+// approval of the call if the caller decided it: AuditBlocked for calls rejected before they ran,
+// or the approval of ExecuteCommandWithApproval. The log is only ever appended to, failures to
+// write it don't affect the tool call.
+func RecordToolAudit(toolName string, params map[string]interface{}, result string, approval string) {
+	if !auditedTools[toolName] {
+		return
+	}
+
+	path, err := getAuditLogPath()
+	if err != nil {
+		return
+	}
+	data, err := json.Marshal(newAuditEntry(toolName, params, result, approval))
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		log.LogDebug("Failed to create audit log directory: " + err.Error() + "\n")
+		return
+	}
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		log.LogDebug("Failed to open audit log: " + err.Error() + "\n")
+		return
+	}
+	defer file.Close()
+	file.Write(append(data, '\n'))
+}
+
+// ReadAuditLog returns the audit log entries recorded at or after since
+func ReadAuditLog(since time.Time) ([]AuditEntry, error) {
+	path, err := getAuditLogPath()
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []AuditEntry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+	for scanner.Scan() {
+		var entry AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+		if !entry.Time.Before(since) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, scanner.Err()
+}
+
+// ParseAuditSince parses the --since value of the audit command: a duration such as
+// 24h or 7d, a date (2006-01-02) or a RFC 3339 timestamp
+func ParseAuditSince(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if strings.HasSuffix(value, "d") {
+		if days, err := time.ParseDuration(strings.TrimSuffix(value, "d") + "h"); err == nil {
+			return time.Now().Add(-days * 24), nil
+		}
+	}
+	if duration, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-duration), nil
+	}
+	if date, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return date, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
@@ -0,0 +1,115 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordToolAudit(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	SetSessionAutoApprove(false)
+	defer ClearSessionAutoApprove()
+
+	RecordToolAudit("write_to_file", map[string]interface{}{"path": "main.go", "content": "package main"}, "File successfully written", "")
+	RecordToolAudit("execute_command", map[string]interface{}{"command": "rm -rf build", "requires_approval": true}, "Command execution cancelled", "")
+	RecordToolAudit("execute_command", map[string]interface{}{"command": "go test ./..."}, "Error: Tool call blocked by pre hook (exit status 1)", "")
+	// Calls rejected before they ran are blocked, whatever their parameters say
+	RecordToolAudit("execute_command", map[string]interface{}{"command": "make", "requires_approval": true},
+		"Error: The execute_command tool is disabled by policy (tools.disabled config) and can't be used.", AuditBlocked)
+	// Read-only tools are not recorded
+	RecordToolAudit("read_file", map[string]interface{}{"path": "main.go"}, "package main", "")
+
+	info, err := os.Stat(filepath.Join(home, ".nca", "audit.jsonl"))
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	entries, err := ReadAuditLog(time.Time{})
+	assert.NoError(t, err)
+	assert.Len(t, entries, 4)
+
+	assert.Equal(t, "write_to_file", entries[0].Tool)
+	assert.Equal(t, "main.go", entries[0].Target)
+	assert.Equal(t, "not_required", entries[0].Approval)
+	assert.Equal(t, "success", entries[0].Status)
+	assert.Equal(t, hashAuditData("package main"), entries[0].DiffHash)
+
+	assert.Equal(t, "declined", entries[1].Approval)
+	assert.Equal(t, "cancelled", entries[1].Status)
+
+	assert.Equal(t, "blocked", entries[2].Approval)
+	assert.Equal(t, "error", entries[2].Status)
+	assert.Equal(t, "blocked", entries[3].Approval)
+	assert.Equal(t, "error", entries[3].Status)
+
+	// Later entries are appended
+	SetSessionAutoApprove(true)
+	RecordToolAudit("execute_command", map[string]interface{}{"command": "make", "requires_approval": true}, "build ok", "")
+	entries, err = ReadAuditLog(time.Now().Add(-time.Minute))
+	assert.NoError(t, err)
+	assert.Len(t, entries, 5)
+	assert.Equal(t, "auto_approved", entries[4].Approval)
+
+	entries, err = ReadAuditLog(time.Now().Add(time.Minute))
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestRecordCommandApproval(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Chdir(t.TempDir())
+	trustWorkspace(t)
+	SetSessionAutoApprove(false)
+	defer ClearSessionAutoApprove()
+	defer SetApprovalPolicy("")
+	require.NoError(t, SetApprovalPolicy(ApprovalAlwaysAsk))
+	Input = strings.NewReader("a\n")
+	defer func() { Input = userInput{} }()
+
+	// A command allowed at the prompt is approved, later runs of it are allowlisted
+	for i := 0; i < 2; i++ {
+		params := map[string]interface{}{"command": "echo audit", "requires_approval": true}
+		result, approval := ExecuteCommandWithApproval(params)
+		RecordToolAudit("execute_command", params, result, approval)
+		// The approval isn't passed in the parameters, which hooks get
+		assert.Len(t, params, 2)
+	}
+	// Denied commands never ran
+	params := map[string]interface{}{"command": "git push -f"}
+	result, approval := ExecuteCommandWithApproval(params)
+	RecordToolAudit("execute_command", params, result, approval)
+
+	entries, err := ReadAuditLog(time.Time{})
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	assert.Equal(t, "approved", entries[0].Approval)
+	assert.Equal(t, "allowlisted", entries[1].Approval)
+	assert.Equal(t, "blocked", entries[2].Approval)
+}
+
+func TestParseAuditSince(t *testing.T) {
+	since, err := ParseAuditSince("")
+	assert.NoError(t, err)
+	assert.True(t, since.IsZero())
+
+	since, err = ParseAuditSince("7d")
+	assert.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(-7*24*time.Hour), since, time.Minute)
+
+	since, err = ParseAuditSince("90m")
+	assert.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(-90*time.Minute), since, time.Minute)
+
+	since, err = ParseAuditSince("2026-01-02")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2026, 1, 2, 0, 0, 0, 0, time.Local), since)
+
+	_, err = ParseAuditSince("yesterday")
+	assert.Error(t, err)
+}
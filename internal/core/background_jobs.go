@@ -0,0 +1,216 @@
+package core
+
+import (
+	"fmt"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Commands of execute_command with run_in_background keep running while the task goes on, like
+// dev servers and watchers. Their output is kept in a buffer that read_job_output and /logs read,
+// /jobs lists them and /kill stops them. Running jobs are stopped when NCA exits.
+
+const (
+	// Time a background command is given to fail at startup before it's reported as started
+	backgroundStartWait = time.Second
+	// Output kept of each background job
+	backgroundOutputSize = 64 * 1024
+)
+
+// BackgroundJob is a command running in the background
+type BackgroundJob struct {
+	ID      int
+	Command string
+	Dir     string
+	Started time.Time
+
+	cmd      *exec.Cmd
+	output   *tailBuffer
+	read     int // Bytes of output already returned by read_job_output
+	running  bool
+	exitCode int
+	exited   chan struct{}
+	mutex    sync.Mutex
+}
+
+var (
+	backgroundJobs      = make(map[int]*BackgroundJob)
+	nextBackgroundJobID = 1
+	backgroundJobsMutex sync.Mutex
+)
+
+// Write appends output of the job
+func (job *BackgroundJob) Write(p []byte) (int, error) {
+	job.mutex.Lock()
+	defer job.mutex.Unlock()
+	return job.output.Write(p)
+}
+
+// Status returns "running" or the exit code of the job
+func (job *BackgroundJob) Status() string {
+	job.mutex.Lock()
+	defer job.mutex.Unlock()
+	if job.running {
+		return "running"
+	}
+	return fmt.Sprintf("exited with code %d", job.exitCode)
+}
+
+// Output returns the kept output of the job
+func (job *BackgroundJob) Output() string {
+	job.mutex.Lock()
+	defer job.mutex.Unlock()
+	return MaskSecrets(job.output.String())
+}
+
+// newOutput returns the output written since the last call, with a notice if part of it was
+// dropped from the buffer
+func (job *BackgroundJob) newOutput() string {
+	job.mutex.Lock()
+	defer job.mutex.Unlock()
+	unread := job.output.total - job.read
+	job.read = job.output.total
+	if unread == 0 {
+		return ""
+	}
+	if unread > len(job.output.data) {
+		return fmt.Sprintf("[Output truncated, showing the last %d KB]\n%s", len(job.output.data)/1024, MaskSecrets(string(job.output.data)))
+	}
+	return MaskSecrets(string(job.output.data[len(job.output.data)-unread:]))
+}
+
+// startBackgroundJob starts a command in the background and returns the result for the model
+func startBackgroundJob(command string, parts []string) string {
+	job := &BackgroundJob{
+		Command: command,
+		Dir:     GetWorkingDir(),
+		Started: time.Now(),
+		output:  newTailBuffer(backgroundOutputSize),
+		running: true,
+		exited:  make(chan struct{}),
+	}
+	cmd := exec.Command(parts[0], parts[1:]...)
+	cmd.Stdout = job
+	cmd.Stderr = job
+	cmd.Env = GetCommandEnv()
+	cmd.Dir = job.Dir
+	cmd.SysProcAttr = commandProcessAttr()
+	cmd.WaitDelay = 2 * time.Second
+	if err := cmd.Start(); err != nil {
+		return fmt.Sprintf("Command execution error: %s", err)
+	}
+	job.cmd = cmd
+
+	backgroundJobsMutex.Lock()
+	job.ID = nextBackgroundJobID
+	nextBackgroundJobID++
+	backgroundJobs[job.ID] = job
+	backgroundJobsMutex.Unlock()
+
+	go func() {
+		cmd.Wait()
+		job.mutex.Lock()
+		job.running = false
+		job.exitCode = cmd.ProcessState.ExitCode()
+		job.mutex.Unlock()
+		close(job.exited)
+	}()
+
+	// A command that fails right away is reported like a command in the foreground
+	select {
+	case <-job.exited:
+		return fmt.Sprintf("Background job %d %s right after it started. Output:\n%s", job.ID, job.Status(), job.newOutput())
+	case <-time.After(backgroundStartWait):
+	}
+	result := fmt.Sprintf("Started background job %d (pid %d): %s\nUse read_job_output with job_id %d to read its output and stop it.", job.ID, cmd.Process.Pid, command, job.ID)
+	if output := job.newOutput(); output != "" {
+		result += "\nOutput so far:\n" + output
+	}
+	return result
+}
+
+// GetBackgroundJob returns a background job by its ID
+func GetBackgroundJob(id string) (*BackgroundJob, error) {
+	number, err := strconv.Atoi(strings.TrimPrefix(strings.TrimSpace(id), "%"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid job id '%s'", id)
+	}
+	backgroundJobsMutex.Lock()
+	defer backgroundJobsMutex.Unlock()
+	job, ok := backgroundJobs[number]
+	if !ok {
+		return nil, fmt.Errorf("background job %d doesn't exist", number)
+	}
+	return job, nil
+}
+
+// ListBackgroundJobs returns the background jobs of the session, the oldest first
+func ListBackgroundJobs() []*BackgroundJob {
+	backgroundJobsMutex.Lock()
+	defer backgroundJobsMutex.Unlock()
+	jobs := make([]*BackgroundJob, 0, len(backgroundJobs))
+	for _, job := range backgroundJobs {
+		jobs = append(jobs, job)
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].ID < jobs[j].ID })
+	return jobs
+}
+
+// Stop interrupts the job with the processes it started and waits for it to exit, it's killed if
+// it's still running after a grace period. It returns false if the job had already exited.
+func (job *BackgroundJob) Stop() bool {
+	select {
+	case <-job.exited:
+		return false
+	default:
+	}
+	interruptProcessGroup(job.cmd.Process)
+	select {
+	case <-job.exited:
+	case <-time.After(commandInterruptGrace):
+		killProcessGroup(job.cmd.Process)
+		<-job.exited
+	}
+	return true
+}
+
+// StopBackgroundJobs stops the running background jobs, when NCA exits
+func StopBackgroundJobs() {
+	for _, job := range ListBackgroundJobs() {
+		job.Stop()
+	}
+}
+
+// ReadJobOutput handles the read_job_output tool: it returns the status of a background job and
+// its output since the last read, and stops the job if requested
+func ReadJobOutput(params map[string]interface{}) string {
+	id, ok := params["job_id"].(string)
+	if !ok || id == "" {
+		return "Error: Missing job_id parameter"
+	}
+	job, err := GetBackgroundJob(id)
+	if err != nil {
+		return fmt.Sprintf("Error: %s", err)
+	}
+
+	stopped := false
+	if stop, _ := params["stop"].(bool); stop {
+		stopped = job.Stop()
+	}
+
+	var result strings.Builder
+	fmt.Fprintf(&result, "Background job %d (%s): %s\n", job.ID, job.Status(), job.Command)
+	if stopped {
+		result.WriteString("The job was stopped.\n")
+	}
+	if output := job.newOutput(); output != "" {
+		result.WriteString("New output:\n" + output)
+	} else {
+		result.WriteString("No new output since the last read.")
+	}
+	return result.String()
+}
@@ -0,0 +1,60 @@
+package core
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackgroundJob(t *testing.T) {
+	t.Chdir(t.TempDir())
+	defer StopBackgroundJobs()
+
+	result := ExecuteCommand(map[string]interface{}{
+		"command":           "echo started; sleep 30",
+		"run_in_background": true,
+	})
+	require.Contains(t, result, "Started background job")
+	assert.Contains(t, result, "started")
+
+	jobs := ListBackgroundJobs()
+	require.NotEmpty(t, jobs)
+	job := jobs[len(jobs)-1]
+	assert.Equal(t, "running", job.Status())
+
+	found, err := GetBackgroundJob("%" + strconv.Itoa(job.ID))
+	require.NoError(t, err)
+	assert.Same(t, job, found)
+
+	// The output returned at start isn't returned again
+	result = ReadJobOutput(map[string]interface{}{"job_id": strconv.Itoa(job.ID)})
+	assert.Contains(t, result, "(running)")
+	assert.Contains(t, result, "No new output since the last read.")
+
+	result = ReadJobOutput(map[string]interface{}{"job_id": strconv.Itoa(job.ID), "stop": true})
+	assert.Contains(t, result, "The job was stopped.")
+	assert.NotEqual(t, "running", job.Status())
+	assert.False(t, job.Stop())
+}
+
+func TestBackgroundJobExitsAtStart(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	start := time.Now()
+	result := ExecuteCommand(map[string]interface{}{
+		"command":           "echo failed; exit 3",
+		"run_in_background": true,
+	})
+	assert.Less(t, time.Since(start), backgroundStartWait)
+	assert.Contains(t, result, "exited with code 3 right after it started")
+	assert.Contains(t, result, "failed")
+}
+
+func TestReadJobOutputErrors(t *testing.T) {
+	assert.Equal(t, "Error: Missing job_id parameter", ReadJobOutput(map[string]interface{}{}))
+	assert.Equal(t, "Error: invalid job id 'abc'", ReadJobOutput(map[string]interface{}{"job_id": "abc"}))
+	assert.Equal(t, "Error: background job 9999 doesn't exist", ReadJobOutput(map[string]interface{}{"job_id": "9999"}))
+}
@@ -0,0 +1,98 @@
+package core
+
+// builtinTemplates are the templates nca new always offers, user templates with the same name replace them
+var builtinTemplates = map[string]*Template{
+	"go-cli": {
+		Name:        "go-cli",
+		Description: "Go command line tool",
+		Prompt:      "Implement the command line tool in main.go, add tests in main_test.go and make sure `go build ./...`, `go vet ./...` and `go test ./...` pass.",
+		Source:      "built-in",
+		Files: map[string]string{
+			"go.mod": "module {{name}}\n\ngo 1.21\n",
+			"main.go": `package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+func main() {
+	verbose := flag.Bool("v", false, "verbose output")
+	flag.Parse()
+
+	if err := run(flag.Args(), *verbose); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+}
+
+// run runs {{name}} with the command line arguments
+func run(args []string, verbose bool) error {
+	// TODO: implement {{name}}
+	return nil
+}
+`,
+			"README.md":  "# {{name}}\n\nTODO: describe {{name}}\n\n## Usage\n\n```\ngo run . [-v] [args]\n```\n",
+			".gitignore": "/{{name}}\n",
+		},
+	},
+	"python-package": {
+		Name:        "python-package",
+		Description: "Python package with pytest tests",
+		Prompt:      "Implement the package in src/{{package}}, add pytest tests in tests/ and describe the usage in README.md.",
+		Source:      "built-in",
+		Files: map[string]string{
+			"pyproject.toml": `[build-system]
+requires = ["setuptools>=61"]
+build-backend = "setuptools.build_meta"
+
+[project]
+name = "{{name}}"
+version = "0.1.0"
+description = "TODO: describe {{name}}"
+authors = [{ name = "{{author}}" }]
+requires-python = ">=3.9"
+
+[project.optional-dependencies]
+test = ["pytest"]
+
+[tool.setuptools.packages.find]
+where = ["src"]
+`,
+			"src/{{package}}/__init__.py": "\"\"\"{{name}}.\"\"\"\n\n__version__ = \"0.1.0\"\n",
+			"src/{{package}}/main.py":     "def main() -> None:\n    # TODO: implement {{name}}\n    pass\n\n\nif __name__ == \"__main__\":\n    main()\n",
+			"tests/test_main.py":          "from {{package}}.main import main\n\n\ndef test_main() -> None:\n    # TODO: test {{name}}\n    main()\n",
+			"README.md":                   "# {{name}}\n\nTODO: describe {{name}}\n\n## Development\n\n```\npip install -e '.[test]'\npytest\n```\n",
+			".gitignore":                  "__pycache__/\n*.egg-info/\n.venv/\n",
+		},
+	},
+	"web": {
+		Name:        "web",
+		Description: "Static website with HTML, CSS and JavaScript",
+		Prompt:      "Build the page in index.html, style it in style.css and add the behavior in script.js. It must work when index.html is opened in a browser, without a build step.",
+		Source:      "built-in",
+		Files: map[string]string{
+			"index.html": `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <meta name="viewport" content="width=device-width, initial-scale=1">
+  <title>{{name}}</title>
+  <link rel="stylesheet" href="style.css">
+</head>
+<body>
+  <main>
+    <h1>{{name}}</h1>
+    <!-- TODO: content of {{name}} -->
+  </main>
+  <script src="script.js"></script>
+</body>
+</html>
+`,
+			"style.css": "body {\n  margin: 0;\n  font-family: system-ui, sans-serif;\n}\n\nmain {\n  max-width: 960px;\n  margin: 0 auto;\n  padding: 1rem;\n}\n\n/* TODO: styles of {{name}} */\n",
+			"script.js": "document.addEventListener('DOMContentLoaded', () => {\n  // TODO: behavior of {{name}}\n});\n",
+			"README.md": "# {{name}}\n\nTODO: describe {{name}}\n\nOpen `index.html` in a browser.\n",
+		},
+	},
+}
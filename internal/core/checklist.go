@@ -0,0 +1,229 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pederhe/nca/pkg/utils"
+)
+
+// Statuses of a checklist step
+const (
+	StepPending    = "pending"
+	StepInProgress = "in_progress"
+	StepDone       = "done"
+	StepSkipped    = "skipped"
+)
+
+// Limits of the checklist of create_plan
+const (
+	maxChecklistSteps = 30
+	// Tool results between reminders of the checklist, so it isn't lost in a long task
+	checklistReminderInterval = 8
+)
+
+// ChecklistStep is a step of the checklist the model keeps for a multi-step task
+type ChecklistStep struct {
+	Description string
+	Status      string
+	Note        string
+}
+
+// The checklist of the current task, the tool results since the model last saw it and whether
+// a step was completed since TakeChecklistProgress was called
+var (
+	checklist           []ChecklistStep
+	checklistUnseen     int
+	checklistProgressed bool
+	checklistMutex      sync.Mutex
+)
+
+// parseChecklistSteps reads the steps parameter of create_plan, a list of strings (native tool
+// calling), a JSON array or one step per line. Leading list markers are removed.
+func parseChecklistSteps(value interface{}) ([]string, error) {
+	var steps []string
+	switch v := value.(type) {
+	case []string:
+		steps = v
+	case string:
+		v = strings.TrimSpace(v)
+		if strings.HasPrefix(v, "[") {
+			if err := json.Unmarshal([]byte(v), &steps); err != nil {
+				return nil, fmt.Errorf("steps must be a JSON array of strings or one step per line: %s", err)
+			}
+		} else {
+			steps = strings.Split(v, "\n")
+		}
+	}
+
+	var result []string
+	for _, step := range steps {
+		step = strings.TrimSpace(step)
+		step = strings.TrimSpace(strings.TrimLeft(step, "-*"))
+		if dot := strings.Index(step, ". "); dot > 0 {
+			if _, err := strconv.Atoi(step[:dot]); err == nil {
+				step = strings.TrimSpace(step[dot+2:])
+			}
+		}
+		if step != "" {
+			result = append(result, step)
+		}
+	}
+	if len(result) == 0 {
+		return nil, fmt.Errorf("no steps provided")
+	}
+	if len(result) > maxChecklistSteps {
+		return nil, fmt.Errorf("at most %d steps are allowed, got %d. Group related work into larger steps", maxChecklistSteps, len(result))
+	}
+	return result, nil
+}
+
+// CreatePlan handles the create_plan tool, it replaces the checklist of the task
+func CreatePlan(params map[string]interface{}) string {
+	descriptions, err := parseChecklistSteps(params["steps"])
+	if err != nil {
+		return fmt.Sprintf("Error: Invalid steps for create_plan tool: %s", err)
+	}
+
+	checklistMutex.Lock()
+	defer checklistMutex.Unlock()
+	checklist = make([]ChecklistStep, len(descriptions))
+	for i, description := range descriptions {
+		checklist[i] = ChecklistStep{Description: description, Status: StepPending}
+	}
+	checklistUnseen = 0
+	return "Checklist created:\n" + formatChecklist(checklist)
+}
+
+// UpdatePlanStep handles the update_plan_step tool, it changes the status of a step
+func UpdatePlanStep(params map[string]interface{}) string {
+	checklistMutex.Lock()
+	defer checklistMutex.Unlock()
+
+	if len(checklist) == 0 {
+		return "Error: There is no checklist, create one with create_plan first"
+	}
+	stepParam, _ := params["step"].(string)
+	number, err := strconv.Atoi(strings.TrimSpace(stepParam))
+	if err != nil || number < 1 || number > len(checklist) {
+		return fmt.Sprintf("Error: Invalid step '%s', the checklist has steps 1-%d", stepParam, len(checklist))
+	}
+	status, _ := params["status"].(string)
+	status = strings.TrimSpace(status)
+	switch status {
+	case StepPending, StepInProgress, StepDone, StepSkipped:
+	default:
+		return fmt.Sprintf("Error: Invalid status '%s', use %s, %s, %s or %s", status, StepPending, StepInProgress, StepDone, StepSkipped)
+	}
+
+	step := &checklist[number-1]
+	if status == StepDone && step.Status != StepDone {
+		checklistProgressed = true
+	}
+	step.Status = status
+	if note, ok := params["note"].(string); ok {
+		step.Note = strings.TrimSpace(note)
+	}
+	checklistUnseen = 0
+	return fmt.Sprintf("Step %d is %s.\n%s", number, strings.ReplaceAll(status, "_", " "), formatChecklist(checklist))
+}
+
+// formatChecklist renders a checklist for the model, one line per step with its status
+func formatChecklist(steps []ChecklistStep) string {
+	var builder strings.Builder
+	done := 0
+	for i, step := range steps {
+		mark := " "
+		switch step.Status {
+		case StepInProgress:
+			mark = "~"
+		case StepDone:
+			mark = "x"
+			done++
+		case StepSkipped:
+			mark = "-"
+			done++
+		}
+		builder.WriteString(fmt.Sprintf("[%s] %d. %s", mark, i+1, step.Description))
+		if step.Note != "" {
+			builder.WriteString(" (" + step.Note + ")")
+		}
+		builder.WriteString("\n")
+	}
+	builder.WriteString(fmt.Sprintf("%d of %d steps finished", done, len(steps)))
+	return builder.String()
+}
+
+// FormatChecklist returns the checklist of the task for the environment details, "" if there is none
+func FormatChecklist() string {
+	checklistMutex.Lock()
+	defer checklistMutex.Unlock()
+	if len(checklist) == 0 {
+		return ""
+	}
+	return formatChecklist(checklist)
+}
+
+// RenderChecklist returns the checklist colored for the terminal, "" if there is none
+func RenderChecklist() string {
+	checklistMutex.Lock()
+	defer checklistMutex.Unlock()
+	if len(checklist) == 0 {
+		return ""
+	}
+
+	lines := strings.Split(formatChecklist(checklist), "\n")
+	for i, step := range checklist {
+		switch step.Status {
+		case StepInProgress:
+			lines[i] = utils.ColoredText(lines[i], utils.ColorYellow)
+		case StepDone:
+			lines[i] = utils.ColoredText(lines[i], utils.ColorGreen)
+		}
+	}
+	last := len(lines) - 1
+	lines[last] = utils.ColoredText(lines[last], utils.ColorCyan)
+	return strings.Join(lines, "\n")
+}
+
+// ChecklistReminder returns the checklist to append to a tool result when the model hasn't seen
+// it for a while and steps are left, or ""
+func ChecklistReminder() string {
+	checklistMutex.Lock()
+	defer checklistMutex.Unlock()
+	if len(checklist) == 0 {
+		return ""
+	}
+	checklistUnseen++
+	if checklistUnseen < checklistReminderInterval {
+		return ""
+	}
+	for _, step := range checklist {
+		if step.Status == StepPending || step.Status == StepInProgress {
+			checklistUnseen = 0
+			return "\n\n[Checklist reminder] Keep the checklist up to date with update_plan_step:\n" + formatChecklist(checklist)
+		}
+	}
+	return ""
+}
+
+// TakeChecklistProgress returns whether a step was completed since the last call
+func TakeChecklistProgress() bool {
+	checklistMutex.Lock()
+	defer checklistMutex.Unlock()
+	progressed := checklistProgressed
+	checklistProgressed = false
+	return progressed
+}
+
+// ClearChecklist discards the checklist, e.g. when the conversation is cleared
+func ClearChecklist() {
+	checklistMutex.Lock()
+	defer checklistMutex.Unlock()
+	checklist = nil
+	checklistUnseen = 0
+	checklistProgressed = false
+}
@@ -0,0 +1,67 @@
+package core
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseChecklistSteps(t *testing.T) {
+	steps, err := parseChecklistSteps("1. Add the struct\n- Load it\n\n* Write tests\n")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Add the struct", "Load it", "Write tests"}, steps)
+
+	steps, err = parseChecklistSteps(`["Add the struct", "Load it"]`)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Add the struct", "Load it"}, steps)
+
+	steps, err = parseChecklistSteps([]string{"Add the struct", " "})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Add the struct"}, steps)
+
+	_, err = parseChecklistSteps("")
+	assert.Error(t, err)
+	_, err = parseChecklistSteps(strings.Repeat("step\n", maxChecklistSteps+1))
+	assert.ErrorContains(t, err, "at most")
+}
+
+func TestChecklistTools(t *testing.T) {
+	ClearChecklist()
+	defer ClearChecklist()
+
+	assert.Contains(t, UpdatePlanStep(map[string]interface{}{"step": "1", "status": "done"}), "Error: There is no checklist")
+	assert.Equal(t, "", FormatChecklist())
+
+	result := CreatePlan(map[string]interface{}{"steps": "Add the struct\nLoad it\nWrite tests"})
+	assert.Equal(t, "Checklist created:\n[ ] 1. Add the struct\n[ ] 2. Load it\n[ ] 3. Write tests\n0 of 3 steps finished", result)
+
+	assert.Contains(t, UpdatePlanStep(map[string]interface{}{"step": "4", "status": "done"}), "Error: Invalid step '4'")
+	assert.Contains(t, UpdatePlanStep(map[string]interface{}{"step": "1", "status": "finished"}), "Error: Invalid status 'finished'")
+
+	result = UpdatePlanStep(map[string]interface{}{"step": "1", "status": "done"})
+	assert.True(t, strings.HasPrefix(result, "Step 1 is done.\n[x] 1. Add the struct"))
+	assert.True(t, TakeChecklistProgress())
+	assert.False(t, TakeChecklistProgress())
+
+	UpdatePlanStep(map[string]interface{}{"step": "2", "status": "in_progress"})
+	UpdatePlanStep(map[string]interface{}{"step": "3", "status": "skipped", "note": "covered by existing tests"})
+	assert.False(t, TakeChecklistProgress(), "only finished steps are progress")
+	assert.Equal(t, "[x] 1. Add the struct\n[~] 2. Load it\n[-] 3. Write tests (covered by existing tests)\n2 of 3 steps finished", FormatChecklist())
+
+	// The checklist is repeated in tool results while steps are left
+	var reminders int
+	for i := 0; i < 2*checklistReminderInterval; i++ {
+		if reminder := ChecklistReminder(); reminder != "" {
+			assert.Contains(t, reminder, "[~] 2. Load it")
+			reminders++
+		}
+	}
+	assert.Equal(t, 2, reminders)
+
+	UpdatePlanStep(map[string]interface{}{"step": "2", "status": "done"})
+	for i := 0; i < 2*checklistReminderInterval; i++ {
+		assert.Equal(t, "", ChecklistReminder())
+	}
+}
@@ -7,6 +7,8 @@ import (
 	"path/filepath"
 	"strings"
 	"time"
+
+	"github.com/pederhe/nca/pkg/utils"
 )
 
 // FileOperation represents a file operation that can be undone/redone
@@ -20,16 +22,20 @@ type FileOperation struct {
 
 // Checkpoint represents a saved state that can be restored
 type Checkpoint struct {
-	ID         string          // Unique identifier for the checkpoint
-	UserPrompt string          // The user prompt that initiated this checkpoint
-	Timestamp  time.Time       // When the checkpoint was created
-	Operations []FileOperation // Operations performed after this checkpoint
+	ID          string          // Unique identifier for the checkpoint
+	UserPrompt  string          // The user prompt that initiated this checkpoint
+	Timestamp   time.Time       // When the checkpoint was created
+	Operations  []FileOperation // Operations performed after this checkpoint
+	Snapshot    string          // For snapshots before risky operations: the operation
+	GitSnapshot string          // Commit of all files in the shadow repository when the checkpoint was created
+	GitRoot     string          // Directory of the files of the commit
 }
 
 // CheckpointManager manages checkpoints
 type CheckpointManager struct {
 	Checkpoints       []Checkpoint // List of all checkpoints
 	CurrentCheckpoint *Checkpoint  // Current checkpoint being recorded
+	taskStart         time.Time    // When the current task started, later checkpoints belong to it
 }
 
 // NewCheckpointManager creates a new checkpoint manager
@@ -37,9 +43,92 @@ func NewCheckpointManager() *CheckpointManager {
 	return &CheckpointManager{
 		Checkpoints:       []Checkpoint{},
 		CurrentCheckpoint: nil,
+		taskStart:         time.Now(),
 	}
 }
 
+// StartTask starts a new task, files changed before it are no longer reported as changed
+func (cm *CheckpointManager) StartTask() {
+	cm.taskStart = time.Now()
+}
+
+// fileChange is a file touched during the current task and its state before the task
+type fileChange struct {
+	path     string
+	original string
+	existed  bool
+}
+
+// currentContent returns the content of the file and whether it differs from its state before the task
+func (c fileChange) currentContent() (string, bool) {
+	content, err := os.ReadFile(c.path)
+	exists := err == nil
+	return string(content), exists != c.existed || string(content) != c.original
+}
+
+// taskFileChanges returns the files touched during the current task, in the order they were first changed
+func (cm *CheckpointManager) taskFileChanges() []fileChange {
+	var checkpoints []Checkpoint
+	for _, cp := range cm.Checkpoints {
+		if !cp.Timestamp.Before(cm.taskStart) {
+			checkpoints = append(checkpoints, cp)
+		}
+	}
+	return fileChangesOf(checkpoints)
+}
+
+// fileChangesOf returns the files touched by the operations of checkpoints, in the order they were first changed
+func fileChangesOf(checkpoints []Checkpoint) []fileChange {
+	seen := map[string]bool{}
+	var changes []fileChange
+	for _, cp := range checkpoints {
+		for _, op := range cp.Operations {
+			if seen[op.Path] {
+				continue
+			}
+			seen[op.Path] = true
+
+			// The first operation on a file holds its content before the task
+			change := fileChange{path: op.Path}
+			switch op.Type {
+			case "replace":
+				change.original, change.existed = op.OldContent, true
+			case "delete":
+				change.original, change.existed = op.Content, true
+			}
+			changes = append(changes, change)
+		}
+	}
+	return changes
+}
+
+// ChangedFiles returns the files created, modified or deleted during the current task. Files
+// that are back to their state before the task, e.g. after a restored checkpoint, are left out.
+func (cm *CheckpointManager) ChangedFiles() []string {
+	var files []string
+	for _, change := range cm.taskFileChanges() {
+		if _, changed := change.currentContent(); changed {
+			files = append(files, change.path)
+		}
+	}
+	return files
+}
+
+// DiffChangedFiles returns the diff of the files changed during the current task
+func (cm *CheckpointManager) DiffChangedFiles() string {
+	var result strings.Builder
+	for _, change := range cm.taskFileChanges() {
+		if content, changed := change.currentContent(); changed {
+			result.WriteString(generateGitStyleDiff(change.path, change.original, content))
+		}
+	}
+
+	if result.Len() == 0 {
+		return "No files changed in this task."
+	}
+	return result.String()
+}
+
 // RecordFileOperation records a file operation for potential undo/redo
 func (cm *CheckpointManager) RecordFileOperation(operationType string, path string, content string, oldContent string) {
 	if cm.CurrentCheckpoint == nil {
@@ -57,25 +146,46 @@ func (cm *CheckpointManager) RecordFileOperation(operationType string, path stri
 	cm.CurrentCheckpoint.Operations = append(cm.CurrentCheckpoint.Operations, operation)
 }
 
-// CreateCheckpoint creates a new checkpoint with the given user prompt
+// CreateCheckpoint creates a new checkpoint with the given user prompt. It keeps a commit of all
+// files in the shadow repository, so restoring it also undoes the changes of commands.
 func (cm *CheckpointManager) CreateCheckpoint(userPrompt string) {
-	// Generate a unique ID based on timestamp
-	id := time.Now().Format("20060102-150405")
+	checkpoint := Checkpoint{UserPrompt: userPrompt}
+	if root, tree, err := gitSnapshotTree(); err != nil {
+		fmt.Printf("Warning: Failed to snapshot the files for the checkpoint, only file edits can be restored: %s\n", err)
+	} else if tree != "" {
+		if commit, err := commitGitSnapshot(root, tree, "nca checkpoint: "+userPrompt); err != nil {
+			fmt.Printf("Warning: Failed to snapshot the files for the checkpoint, only file edits can be restored: %s\n", err)
+		} else {
+			checkpoint.GitSnapshot, checkpoint.GitRoot = commit, root
+		}
+	}
 
-	// Create a new checkpoint
-	checkpoint := Checkpoint{
-		ID:         id,
-		UserPrompt: userPrompt,
-		Timestamp:  time.Now(),
-		Operations: []FileOperation{},
+	if err := cm.addCheckpoint(checkpoint); err != nil {
+		fmt.Printf("Warning: Failed to keep the snapshot of the checkpoint: %s\n", err)
+	}
+}
+
+// addCheckpoint adds a checkpoint and makes it the current one
+func (cm *CheckpointManager) addCheckpoint(checkpoint Checkpoint) error {
+	// Generate a unique ID based on timestamp, a snapshot may be taken in the same second as a checkpoint
+	id := time.Now().Format("20060102-150405")
+	for n := 2; cm.hasCheckpoint(id); n++ {
+		id = fmt.Sprintf("%s-%d", time.Now().Format("20060102-150405"), n)
 	}
 
+	checkpoint.ID = id
+	checkpoint.Timestamp = time.Now()
+	checkpoint.Operations = []FileOperation{}
+
 	// Add to the list of checkpoints
 	cm.Checkpoints = append(cm.Checkpoints, checkpoint)
 
 	// Limit the number of checkpoints to 6
 	if len(cm.Checkpoints) > 6 {
-		// Keep only the latest 6 checkpoints
+		// Keep only the latest 6 checkpoints, the snapshot commits of the others aren't needed anymore
+		for _, cp := range cm.Checkpoints[:len(cm.Checkpoints)-6] {
+			deleteGitSnapshot(cp)
+		}
 		cm.Checkpoints = cm.Checkpoints[len(cm.Checkpoints)-6:]
 	}
 
@@ -86,6 +196,21 @@ func (cm *CheckpointManager) CreateCheckpoint(userPrompt string) {
 	if err := cm.SaveCheckpoints(); err != nil {
 		fmt.Printf("Warning: Failed to save checkpoints after creating new checkpoint: %s\n", err)
 	}
+
+	if checkpoint.GitSnapshot != "" {
+		return setGitSnapshotRef(checkpoint)
+	}
+	return nil
+}
+
+// hasCheckpoint returns whether there is a checkpoint with the ID
+func (cm *CheckpointManager) hasCheckpoint(id string) bool {
+	for _, cp := range cm.Checkpoints {
+		if cp.ID == id {
+			return true
+		}
+	}
+	return false
 }
 
 // ListCheckpoints returns formatted information about all checkpoints
@@ -100,14 +225,15 @@ func (cm *CheckpointManager) ListCheckpoints() string {
 	result.WriteString("----------------------------------------------------------------\n")
 
 	for _, cp := range cm.Checkpoints {
-		// Truncate user prompt if it's too long
-		prompt := cp.UserPrompt
-		if len(prompt) > 45 {
-			prompt = prompt[:42] + "..."
+		// Truncate user prompt if it's too long, by display width so CJK text isn't split
+		label := cp.UserPrompt
+		if cp.Snapshot != "" {
+			label = fmt.Sprintf("[snapshot before %s] %s", cp.Snapshot, cp.UserPrompt)
 		}
+		prompt := utils.Ellipsize(strings.Join(strings.Fields(label), " "), 45)
 
 		// Format line with fixed width columns
-		result.WriteString(fmt.Sprintf("%-20s %-35s\n", cp.ID, prompt))
+		result.WriteString(fmt.Sprintf("%-20s %s\n", cp.ID, utils.PadRight(prompt, 35)))
 	}
 
 	return result.String()
@@ -188,6 +314,13 @@ func (cm *CheckpointManager) RestoreCheckpoint(checkpointID string) string {
 		}
 	}
 
+	// The snapshot also restores the changes of commands run after the checkpoint
+	if target := cm.Checkpoints[targetIndex]; target.GitSnapshot != "" {
+		if err := restoreGitSnapshot(target); err != nil {
+			errors = append(errors, fmt.Sprintf("Error restoring the files of checkpoint %s: %s", target.ID, err))
+		}
+	}
+
 	// Set current checkpoint
 	if len(cm.Checkpoints) > 0 {
 		cm.CurrentCheckpoint = &cm.Checkpoints[len(cm.Checkpoints)-1]
@@ -250,13 +383,25 @@ func (cm *CheckpointManager) RedoCheckpoint(checkpointID string) string {
 // HandleCheckpointCommand handles the /checkpoint command
 func (cm *CheckpointManager) HandleCheckpointCommand(args []string) string {
 	if len(args) == 0 {
-		return "Usage: /checkpoint [list|restore|redo] [checkpoint_id]"
+		return "Usage: /checkpoint [list|show|diff|restore|redo] [checkpoint_id]"
 	}
 
 	switch args[0] {
 	case "list":
 		return cm.ListCheckpoints()
 
+	case "show":
+		if len(args) < 2 {
+			return "Usage: /checkpoint show <checkpoint_id>"
+		}
+		return cm.ShowCheckpoint(args[1])
+
+	case "diff":
+		if len(args) < 2 {
+			return "Usage: /checkpoint diff <checkpoint_id>"
+		}
+		return cm.DiffCheckpoint(args[1])
+
 	case "restore":
 		if len(args) < 2 {
 			return "Usage: /checkpoint restore <checkpoint_id>"
@@ -270,7 +415,7 @@ func (cm *CheckpointManager) HandleCheckpointCommand(args []string) string {
 		return cm.RedoCheckpoint(args[1])
 
 	default:
-		return fmt.Sprintf("Unknown checkpoint command: %s\nUsage: /checkpoint [list|restore|redo] [checkpoint_id]", args[0])
+		return fmt.Sprintf("Unknown checkpoint command: %s\nUsage: /checkpoint [list|show|diff|restore|redo] [checkpoint_id]", args[0])
 	}
 }
 
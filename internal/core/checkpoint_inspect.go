@@ -0,0 +1,147 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pederhe/nca/pkg/utils"
+)
+
+// findCheckpoint returns the index of the checkpoint with the ID, or -1 if there is none
+func (cm *CheckpointManager) findCheckpoint(checkpointID string) int {
+	for i, cp := range cm.Checkpoints {
+		if cp.ID == checkpointID {
+			return i
+		}
+	}
+	return -1
+}
+
+// ShowCheckpoint describes a checkpoint and lists the files changed after it, until the next
+// checkpoint or until now for the latest one
+func (cm *CheckpointManager) ShowCheckpoint(checkpointID string) string {
+	index := cm.findCheckpoint(checkpointID)
+	if index == -1 {
+		return fmt.Sprintf("Error: Checkpoint '%s' not found", checkpointID)
+	}
+	cp := cm.Checkpoints[index]
+
+	var result strings.Builder
+	result.WriteString(fmt.Sprintf("Checkpoint: %s\n", cp.ID))
+	result.WriteString(fmt.Sprintf("Created:    %s\n", cp.Timestamp.Format("2006-01-02 15:04:05")))
+	if cp.Snapshot != "" {
+		result.WriteString(fmt.Sprintf("Snapshot:   before %s\n", cp.Snapshot))
+	}
+	result.WriteString(fmt.Sprintf("Prompt:     %s\n", strings.Join(strings.Fields(cp.UserPrompt), " ")))
+
+	until := "the next checkpoint"
+	if index == len(cm.Checkpoints)-1 {
+		until = "now"
+	}
+	files, err := cm.checkpointChangedFiles(index)
+	if err != nil {
+		return result.String() + fmt.Sprintf("\nError: Failed to list the changed files: %s", err)
+	}
+	if len(files) == 0 {
+		result.WriteString(fmt.Sprintf("\nNo files changed after it until %s.", until))
+		return result.String()
+	}
+	result.WriteString(fmt.Sprintf("\nFiles changed after it until %s:\n", until))
+	for _, file := range files {
+		result.WriteString("  " + file + "\n")
+	}
+	result.WriteString(fmt.Sprintf("\nUse /checkpoint diff %s to see the changes since it", cp.ID))
+	return result.String()
+}
+
+// checkpointChangedFiles returns the status (A, M or D) and path of the files changed after a
+// checkpoint until the next one. They come from the snapshots of the checkpoints, or from the
+// recorded file operations if there are no snapshots.
+func (cm *CheckpointManager) checkpointChangedFiles(index int) ([]string, error) {
+	cp := cm.Checkpoints[index]
+	if cp.GitSnapshot != "" {
+		var next string
+		if index < len(cm.Checkpoints)-1 {
+			if following := cm.Checkpoints[index+1]; following.GitSnapshot != "" && following.GitRoot == cp.GitRoot {
+				next = following.GitSnapshot
+			}
+		} else {
+			tree, err := writeShadowTree(cp.GitRoot)
+			if err != nil {
+				return nil, err
+			}
+			next = tree
+		}
+		if next != "" {
+			output, err := runShadowGit(cp.GitRoot, "diff-tree", "-r", "--no-renames", "--name-status", cp.GitSnapshot, next)
+			if err != nil {
+				return nil, err
+			}
+			var files []string
+			for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+				if fields := strings.SplitN(line, "\t", 2); len(fields) == 2 {
+					files = append(files, fields[0]+" "+fields[1])
+				}
+			}
+			return files, nil
+		}
+	}
+
+	// The first operation on a file tells whether it existed before, the last whether it does after
+	existsAfter := map[string]bool{}
+	for _, op := range cp.Operations {
+		existsAfter[op.Path] = op.Type != "delete"
+	}
+	statuses := map[string]string{}
+	for _, change := range fileChangesOf([]Checkpoint{cp}) {
+		switch {
+		case change.existed && existsAfter[change.path]:
+			statuses[change.path] = "M"
+		case change.existed:
+			statuses[change.path] = "D"
+		case existsAfter[change.path]:
+			statuses[change.path] = "A"
+		}
+	}
+	files := make([]string, 0, len(statuses))
+	for path, status := range statuses {
+		files = append(files, status+" "+path)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i][2:] < files[j][2:] })
+	return files, nil
+}
+
+// DiffCheckpoint returns the diff of the files at a checkpoint against their current content,
+// the changes restoring it would undo
+func (cm *CheckpointManager) DiffCheckpoint(checkpointID string) string {
+	index := cm.findCheckpoint(checkpointID)
+	if index == -1 {
+		return fmt.Sprintf("Error: Checkpoint '%s' not found", checkpointID)
+	}
+
+	var diff string
+	if cp := cm.Checkpoints[index]; cp.GitSnapshot != "" {
+		tree, err := writeShadowTree(cp.GitRoot)
+		if err != nil {
+			return fmt.Sprintf("Error: Failed to diff checkpoint '%s': %s", checkpointID, err)
+		}
+		diff, err = runShadowGit(cp.GitRoot, "diff", "--no-color", "--no-renames", cp.GitSnapshot, tree)
+		if err != nil {
+			return fmt.Sprintf("Error: Failed to diff checkpoint '%s': %s", checkpointID, err)
+		}
+	} else {
+		var result strings.Builder
+		for _, change := range fileChangesOf(cm.Checkpoints[index:]) {
+			if content, changed := change.currentContent(); changed {
+				result.WriteString(generateGitStyleDiff(change.path, change.original, content))
+			}
+		}
+		diff = result.String()
+	}
+
+	if strings.TrimSpace(diff) == "" {
+		return fmt.Sprintf("No files changed since checkpoint '%s'", checkpointID)
+	}
+	return utils.ColoredDiff(strings.TrimRight(diff, "\n"))
+}
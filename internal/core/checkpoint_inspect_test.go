@@ -0,0 +1,62 @@
+package core
+
+import (
+	"os"
+	"testing"
+
+	"github.com/pederhe/nca/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShowAndDiffCheckpoint(t *testing.T) {
+	dir := initGitRepo(t, map[string]string{"main.go": "package main\n", "old.txt": "old\n"})
+	t.Chdir(dir)
+	ResetWorkingDir()
+
+	cm := NewCheckpointManager()
+	cm.CreateCheckpoint("rework the files")
+	first := cm.CurrentCheckpoint.ID
+	require.NoError(t, os.WriteFile("main.go", []byte("package main // edited\n"), 0644))
+	require.NoError(t, os.Remove("old.txt"))
+	require.NoError(t, os.WriteFile("new.txt", []byte("new\n"), 0644))
+
+	shown := cm.ShowCheckpoint(first)
+	assert.Contains(t, shown, "Prompt:     rework the files")
+	assert.Contains(t, shown, "Files changed after it until now:\n  M main.go\n  A new.txt\n  D old.txt\n")
+
+	cm.CreateCheckpoint("add a readme")
+	require.NoError(t, os.WriteFile("README.md", []byte("readme\n"), 0644))
+	assert.Contains(t, cm.ShowCheckpoint(first), "Files changed after it until the next checkpoint:\n  M main.go\n  A new.txt\n  D old.txt\n")
+
+	diff := cm.DiffCheckpoint(first)
+	assert.Contains(t, diff, "+package main // edited")
+	assert.Contains(t, diff, "+readme")
+	assert.Contains(t, diff, "-old")
+
+	second := cm.CurrentCheckpoint.ID
+	require.NoError(t, os.Remove("README.md"))
+	assert.Equal(t, "No files changed since checkpoint '"+second+"'", cm.DiffCheckpoint(second))
+	assert.Contains(t, cm.ShowCheckpoint(second), "No files changed after it until now.")
+
+	assert.Contains(t, cm.ShowCheckpoint("missing"), "not found")
+	assert.Contains(t, cm.DiffCheckpoint("missing"), "not found")
+}
+
+func TestShowAndDiffCheckpointOperations(t *testing.T) {
+	t.Chdir(t.TempDir())
+	require.NoError(t, config.Set("checkpoint_snapshots", "false", false))
+	require.NoError(t, os.WriteFile("main.go", []byte("package main\n"), 0644))
+
+	cm := NewCheckpointManager()
+	cm.CreateCheckpoint("edit main.go")
+	require.NoError(t, os.WriteFile("main.go", []byte("package app\n"), 0644))
+	cm.RecordFileOperation("replace", "main.go", "package app\n", "package main\n")
+	require.NoError(t, os.WriteFile("util.go", []byte("package app\n"), 0644))
+	cm.RecordFileOperation("write", "util.go", "package app\n", "")
+
+	assert.Contains(t, cm.ShowCheckpoint(cm.CurrentCheckpoint.ID), "  M main.go\n  A util.go\n")
+	diff := cm.DiffCheckpoint(cm.CurrentCheckpoint.ID)
+	assert.Contains(t, diff, "-package main")
+	assert.Contains(t, diff, "+package app")
+}
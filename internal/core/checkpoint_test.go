@@ -2,7 +2,10 @@ package core
 
 import (
 	"os"
+	"strings"
 	"testing"
+
+	"github.com/pederhe/nca/pkg/config"
 )
 
 func TestCheckpointManager(t *testing.T) {
@@ -15,6 +18,11 @@ func TestCheckpointManager(t *testing.T) {
 	defer os.Chdir(originalDir)
 	os.Chdir(tmpDir)
 
+	// Test the recorded file operations, a snapshot of all files would restore them too
+	if err := config.Set("checkpoint_snapshots", "false", false); err != nil {
+		t.Fatal(err)
+	}
+
 	// Create new CheckpointManager
 	cm := NewCheckpointManager()
 
@@ -199,3 +207,55 @@ func TestFileOperations(t *testing.T) {
 		}
 	})
 }
+
+func TestChangedFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(originalDir)
+	os.Chdir(tmpDir)
+
+	os.WriteFile("old.txt", []byte("before task"), 0644)
+	cm := NewCheckpointManager()
+	cm.CreateCheckpoint("old task")
+	cm.RecordFileOperation("replace", "old.txt", "old task", "before task")
+	os.WriteFile("old.txt", []byte("old task"), 0644)
+
+	// Files changed by earlier tasks aren't reported
+	cm.StartTask()
+	if files := cm.ChangedFiles(); len(files) != 0 {
+		t.Errorf("Expected no changed files after starting a task, got %v", files)
+	}
+
+	os.WriteFile("edited.txt", []byte("original"), 0644)
+	os.WriteFile("reverted.txt", []byte("original"), 0644)
+	cm.CreateCheckpoint("new task")
+	cm.RecordFileOperation("write", "created.txt", "new", "")
+	os.WriteFile("created.txt", []byte("new"), 0644)
+	cm.RecordFileOperation("replace", "edited.txt", "first edit", "original")
+	cm.RecordFileOperation("replace", "edited.txt", "second edit", "first edit")
+	os.WriteFile("edited.txt", []byte("second edit"), 0644)
+	cm.RecordFileOperation("replace", "reverted.txt", "changed", "original")
+	os.WriteFile("reverted.txt", []byte("original"), 0644)
+
+	files := cm.ChangedFiles()
+	if len(files) != 2 || files[0] != "created.txt" || files[1] != "edited.txt" {
+		t.Errorf("Expected [created.txt edited.txt], got %v", files)
+	}
+
+	diff := cm.DiffChangedFiles()
+	if !strings.Contains(diff, "b/edited.txt") || !strings.Contains(diff, "second edit") || strings.Contains(diff, "reverted.txt") {
+		t.Errorf("Unexpected diff of changed files:\n%s", diff)
+	}
+
+	// Restoring the checkpoint of the task leaves no changed files
+	cm.RestoreCheckpoint(cm.CurrentCheckpoint.ID)
+	if files := cm.ChangedFiles(); len(files) != 0 {
+		t.Errorf("Expected no changed files after restoring the checkpoint, got %v", files)
+	}
+	if diff := cm.DiffChangedFiles(); diff != "No files changed in this task." {
+		t.Errorf("Expected no diff after restoring the checkpoint, got %s", diff)
+	}
+}
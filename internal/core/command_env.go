@@ -0,0 +1,127 @@
+package core
+
+import (
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/joho/godotenv"
+	"github.com/pederhe/nca/pkg/config"
+	"github.com/pederhe/nca/pkg/log"
+)
+
+// Project environment variables are loaded from the files in "env_files" (comma-separated,
+// e.g. ".env,.env.test") and injected into executed commands. "env_vars" restricts the
+// injected variables to a comma-separated list of names. Values of variables that look
+// like secrets are masked in the output of commands and in the results of the tools that
+// read files, which could read the env files themselves.
+
+// Variable names whose values are masked
+var secretEnvNameRegex = regexp.MustCompile(`(?i)(KEY|SECRET|TOKEN|PASSWORD|PASSWD|PASS|CREDENTIAL|PRIVATE|AUTH|DSN)`)
+
+// Secret values shorter than this are not masked, they would match too much unrelated output
+const minMaskedSecretLength = 4
+
+// Tools whose results may contain the contents of the env files
+var secretMaskedTools = map[string]bool{
+	"read_file":     true,
+	"read_files":    true,
+	"search_files":  true,
+	"get_file_diff": true,
+	"git_diff":      true,
+}
+
+// readProjectEnvFiles returns all variables of the configured env files
+func readProjectEnvFiles() map[string]string {
+	files := config.Get("env_files")
+	if strings.TrimSpace(files) == "" || !IsWorkspaceTrusted() {
+		return nil
+	}
+
+	var paths []string
+	for _, file := range strings.Split(files, ",") {
+		if file = strings.TrimSpace(file); file != "" {
+			paths = append(paths, file)
+		}
+	}
+
+	vars := map[string]string{}
+	for _, path := range paths {
+		fileVars, err := godotenv.Read(path)
+		if err != nil {
+			log.LogDebug("Failed to read env file " + path + ": " + err.Error() + "\n")
+			continue
+		}
+		// Later files override earlier ones
+		for name, value := range fileVars {
+			vars[name] = value
+		}
+	}
+	return vars
+}
+
+// loadProjectEnv reads the configured env files and returns the variables to inject
+func loadProjectEnv() map[string]string {
+	vars := readProjectEnvFiles()
+	if selected := strings.TrimSpace(config.Get("env_vars")); selected != "" {
+		filtered := map[string]string{}
+		for _, name := range strings.Split(selected, ",") {
+			name = strings.TrimSpace(name)
+			if value, ok := vars[name]; ok {
+				filtered[name] = value
+			}
+		}
+		vars = filtered
+	}
+	return vars
+}
+
+// GetCommandEnv returns the environment of executed commands, the process environment
+// extended with the project variables
+func GetCommandEnv() []string {
+	env := os.Environ()
+	vars := loadProjectEnv()
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		env = append(env, name+"="+vars[name])
+	}
+	return env
+}
+
+// MaskSecrets replaces values of secret variables of the env files in text with a placeholder,
+// the ones env_vars doesn't inject included
+func MaskSecrets(text string) string {
+	vars := readProjectEnvFiles()
+	if len(vars) == 0 {
+		return text
+	}
+
+	// Replace longer values first, so a value containing another one is masked completely
+	names := make([]string, 0, len(vars))
+	for name, value := range vars {
+		if secretEnvNameRegex.MatchString(name) && len(value) >= minMaskedSecretLength {
+			names = append(names, name)
+		}
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return len(vars[names[i]]) > len(vars[names[j]])
+	})
+
+	for _, name := range names {
+		text = strings.ReplaceAll(text, vars[name], "****("+name+")")
+	}
+	return text
+}
+
+// MaskToolResult masks the secrets of the env files in the result of a tool that reads files
+func MaskToolResult(toolName string, result string) string {
+	if !secretMaskedTools[toolName] {
+		return result
+	}
+	return MaskSecrets(result)
+}
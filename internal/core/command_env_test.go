@@ -0,0 +1,70 @@
+package core
+
+import (
+	"os"
+	"testing"
+
+	"github.com/pederhe/nca/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommandEnv(t *testing.T) {
+	tmpDir := t.TempDir()
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(originalDir)
+	os.Chdir(tmpDir)
+	t.Setenv("HOME", t.TempDir())
+	trustWorkspace(t)
+
+	assert.NoError(t, os.WriteFile(".env", []byte("APP_MODE=dev\nAPI_TOKEN=s3cr3t-token\nDB_PASSWORD=hunter22\n"), 0644))
+	assert.NoError(t, os.WriteFile(".env.test", []byte("APP_MODE=test\n"), 0644))
+
+	// Nothing is injected without env_files
+	result := ExecuteCommand(map[string]interface{}{"command": "bash -c 'echo mode=$APP_MODE;'"})
+	assert.Contains(t, result, "mode=\n")
+
+	// Later files override earlier ones, secrets are masked in the result
+	assert.NoError(t, config.Set("env_files", ".env, .env.test", false))
+	result = ExecuteCommand(map[string]interface{}{"command": "bash -c 'echo mode=$APP_MODE token=$API_TOKEN;'"})
+	assert.Contains(t, result, "mode=test token=****(API_TOKEN)")
+	assert.NotContains(t, result, "s3cr3t-token")
+
+	// env_vars selects the injected variables
+	assert.NoError(t, config.Set("env_vars", "APP_MODE", false))
+	result = ExecuteCommand(map[string]interface{}{"command": "bash -c 'echo mode=$APP_MODE password=$DB_PASSWORD;'"})
+	assert.Contains(t, result, "mode=test password=\n")
+
+	// Missing files are skipped
+	assert.NoError(t, config.Set("env_files", ".env.missing,.env", false))
+	assert.Contains(t, GetCommandEnv(), "APP_MODE=dev")
+}
+
+func TestMaskSecrets(t *testing.T) {
+	tmpDir := t.TempDir()
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(originalDir)
+	os.Chdir(tmpDir)
+	t.Setenv("HOME", t.TempDir())
+	trustWorkspace(t)
+
+	assert.NoError(t, os.WriteFile(".env", []byte("SECRET_KEY=abcdef\nLONG_SECRET=abcdef123\nSHORT_TOKEN=ab\nUSER_NAME=abcdef\n"), 0644))
+	assert.NoError(t, config.Set("env_files", ".env", false))
+
+	// Longer secrets are masked first, short values and non secret names are kept
+	assert.Equal(t, "****(LONG_SECRET) ****(SECRET_KEY) ab", MaskSecrets("abcdef123 abcdef ab"))
+
+	// Secrets that aren't injected are masked too, the file tools can read them from the env files
+	assert.NoError(t, config.Set("env_vars", "USER_NAME", false))
+	assert.Equal(t, "****(LONG_SECRET)", MaskSecrets("abcdef123"))
+	result := ReadFile(map[string]interface{}{"path": ".env"})
+	assert.Contains(t, MaskToolResult("read_file", result), "LONG_SECRET=****(LONG_SECRET)")
+	result = SearchFiles(map[string]interface{}{"path": ".", "regex": "SECRET"})
+	assert.Contains(t, MaskToolResult("search_files", result), "LONG_SECRET=****(LONG_SECRET)")
+	assert.Equal(t, "abcdef123", MaskToolResult("write_to_file", "abcdef123"))
+}
@@ -0,0 +1,55 @@
+package core
+
+import (
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// Time a command has to exit after an interrupt before its processes are killed
+const commandInterruptGrace = 2 * time.Second
+
+var (
+	runningCommand      *exec.Cmd
+	commandInterrupted  bool
+	runningCommandMutex sync.Mutex
+)
+
+// setRunningCommand records the command execute_command is running, so it can be interrupted
+func setRunningCommand(cmd *exec.Cmd) {
+	runningCommandMutex.Lock()
+	defer runningCommandMutex.Unlock()
+	runningCommand = cmd
+	commandInterrupted = false
+}
+
+// clearRunningCommand forgets the running command and returns whether it was interrupted
+func clearRunningCommand() bool {
+	runningCommandMutex.Lock()
+	defer runningCommandMutex.Unlock()
+	runningCommand = nil
+	return commandInterrupted
+}
+
+// InterruptCommand interrupts the command execute_command is running with the processes it
+// started, which are killed if they're still running after a grace period. It returns whether a
+// command was running.
+func InterruptCommand() bool {
+	runningCommandMutex.Lock()
+	defer runningCommandMutex.Unlock()
+	cmd := runningCommand
+	if cmd == nil || cmd.Process == nil {
+		return false
+	}
+	commandInterrupted = true
+	interruptProcessGroup(cmd.Process)
+
+	time.AfterFunc(commandInterruptGrace, func() {
+		runningCommandMutex.Lock()
+		defer runningCommandMutex.Unlock()
+		if runningCommand == cmd {
+			killProcessGroup(cmd.Process)
+		}
+	})
+	return true
+}
@@ -0,0 +1,66 @@
+package core
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/pederhe/nca/pkg/config"
+)
+
+const (
+	// defaultCommandTimeout is the maximum run time of execute_command, configurable with command_timeout
+	defaultCommandTimeout = 10 * time.Minute
+	// defaultCommandOutputTailKB is the size of the output tail returned to the model
+	defaultCommandOutputTailKB = 32
+)
+
+// getCommandTimeout returns the maximum run time of a command, set with command_timeout in seconds (0 disables it)
+func getCommandTimeout() time.Duration {
+	if value := config.Get("command_timeout"); value != "" {
+		if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+			return time.Duration(seconds) * time.Second
+		}
+	}
+	return defaultCommandTimeout
+}
+
+// getCommandOutputTailSize returns how many bytes of command output are kept, set with command_output_tail_kb
+func getCommandOutputTailSize() int {
+	if value := config.Get("command_output_tail_kb"); value != "" {
+		if kb, err := strconv.Atoi(value); err == nil && kb > 0 {
+			return kb * 1024
+		}
+	}
+	return defaultCommandOutputTailKB * 1024
+}
+
+// tailBuffer keeps the last bytes written to it, used to capture the output of long running commands
+type tailBuffer struct {
+	data  []byte
+	size  int
+	total int
+}
+
+// newTailBuffer creates a buffer keeping at most size bytes
+func newTailBuffer(size int) *tailBuffer {
+	return &tailBuffer{size: size}
+}
+
+// Write appends data and drops the oldest bytes beyond the buffer size
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.total += len(p)
+	b.data = append(b.data, p...)
+	if len(b.data) > b.size {
+		b.data = append([]byte(nil), b.data[len(b.data)-b.size:]...)
+	}
+	return len(p), nil
+}
+
+// String returns the kept output with a notice if older output was dropped
+func (b *tailBuffer) String() string {
+	if b.total <= b.size {
+		return string(b.data)
+	}
+	return fmt.Sprintf("[Output truncated, showing the last %d KB of %d KB]\n%s", b.size/1024, b.total/1024, string(b.data))
+}
@@ -0,0 +1,85 @@
+package core
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pederhe/nca/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTailBuffer(t *testing.T) {
+	buffer := newTailBuffer(4)
+	buffer.Write([]byte("ab"))
+	assert.Equal(t, "ab", buffer.String())
+
+	buffer.Write([]byte("cdef"))
+	assert.True(t, strings.HasSuffix(buffer.String(), "\ncdef"))
+	assert.Contains(t, buffer.String(), "[Output truncated")
+}
+
+func TestExecuteCommandExitCodeAndTimeout(t *testing.T) {
+	tmpDir := t.TempDir()
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(originalDir)
+	os.Chdir(tmpDir)
+
+	// Output of stdout and stderr is returned with the exit code
+	result := ExecuteCommand(map[string]interface{}{"command": "bash -c 'echo out; echo err >&2; exit 3'"})
+	assert.Contains(t, result, "Command execution error")
+	assert.Contains(t, result, "out\nerr\n")
+	assert.Contains(t, result, "[Exit code: 3]")
+
+	result = ExecuteCommand(map[string]interface{}{"command": "echo done"})
+	assert.Equal(t, "done\n\n[Exit code: 0]", result)
+
+	// Only the tail of long output is kept
+	assert.NoError(t, config.Set("command_output_tail_kb", "1", false))
+	result = ExecuteCommand(map[string]interface{}{"command": "seq 1 2000"})
+	assert.Contains(t, result, "[Output truncated, showing the last 1 KB of 8 KB]")
+	assert.Contains(t, result, "2000\n")
+	assert.NotContains(t, result, "\n10\n")
+
+	assert.NoError(t, config.Set("command_timeout", "1", false))
+	result = ExecuteCommand(map[string]interface{}{"command": "bash -c 'echo started; sleep 10'"})
+	assert.Contains(t, result, "Command timed out after 1s")
+	assert.Contains(t, result, "started")
+}
+
+func TestInterruptCommand(t *testing.T) {
+	t.Chdir(t.TempDir())
+	assert.False(t, InterruptCommand())
+
+	done := make(chan string)
+	go func() {
+		done <- ExecuteCommand(map[string]interface{}{"command": "echo started; sleep 30; echo finished"})
+	}()
+	// Wait for the command to start
+	for i := 0; i < 100; i++ {
+		runningCommandMutex.Lock()
+		started := runningCommand != nil && runningCommand.Process != nil
+		runningCommandMutex.Unlock()
+		if started {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	time.Sleep(100 * time.Millisecond)
+	assert.True(t, InterruptCommand())
+
+	// The shell and the sleep it started are stopped
+	select {
+	case result := <-done:
+		assert.Contains(t, result, "Command was interrupted by the user")
+		assert.Contains(t, result, "started")
+		assert.NotContains(t, result, "finished")
+	case <-time.After(5 * time.Second):
+		t.Fatal("the command wasn't interrupted")
+	}
+	assert.False(t, InterruptCommand())
+}
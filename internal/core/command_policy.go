@@ -0,0 +1,156 @@
+package core
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/pederhe/nca/pkg/config"
+)
+
+// CommandDecision is the result of checking a command against the command policy
+type CommandDecision int
+
+const (
+	// CommandAsk means the usual approval flow applies
+	CommandAsk CommandDecision = iota
+	// CommandAllowed means the command runs without asking for approval
+	CommandAllowed
+	// CommandDenied means the command must not run
+	CommandDenied
+)
+
+// Destructive commands that are never run, not even with auto-approve
+var hardDeniedCommands = []struct {
+	pattern *regexp.Regexp
+	reason  string
+}{
+	{regexp.MustCompile(`\bgit\s+push\b.*\s(--force|-f)(\s|$)`), "force push"},
+	{regexp.MustCompile(`\bmkfs(\.[a-z0-9]+)?\s`), "formatting a file system"},
+	{regexp.MustCompile(`\bdd\s+.*\bof=/dev/`), "writing to a device"},
+	{regexp.MustCompile(`>\s*/dev/(sd|nvme|hd|disk)`), "writing to a device"},
+	{regexp.MustCompile(`:\(\)\s*\{\s*:\s*\|\s*:\s*&\s*\}\s*;\s*:`), "fork bomb"},
+	{regexp.MustCompile(`\bchmod\s+(-[a-zA-Z]+\s+)*-R\s+[0-7]*777\s+/(\s|$)`), "recursive permission change of the root directory"},
+}
+
+// Reason of the denied removals of the root or home directory
+const rootRemovalReason = "recursive removal of the root or home directory"
+
+// Shell operators that chain or redirect commands. Allowlist entries only apply to plain
+// commands, otherwise "go test && rm -rf build" would be allowed by "go test".
+var shellOperatorRegex = regexp.MustCompile("[;&|<>`\n]|\\$\\(")
+
+// matchesCommandList checks whether the command equals or starts with a command of the comma-separated list
+func matchesCommandList(command string, list string) bool {
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.Join(strings.Fields(entry), " ")
+		if entry == "" {
+			continue
+		}
+		if command == entry || strings.HasPrefix(command, entry+" ") {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckCommandPolicy checks a command against the hard denylist and the "denied_commands" and
+// "allowed_commands" config keys, which take comma-separated command prefixes such as "go test,go build".
+// Allowlists are ignored in untrusted workspaces.
+func CheckCommandPolicy(command string) (CommandDecision, string) {
+	normalized := strings.Join(strings.Fields(command), " ")
+
+	if removesRootOrHome(command) {
+		return CommandDenied, rootRemovalReason
+	}
+	for _, denied := range hardDeniedCommands {
+		if denied.pattern.MatchString(normalized) {
+			return CommandDenied, denied.reason
+		}
+	}
+
+	// Chained commands are denied if any part is denied
+	for _, part := range shellOperatorRegex.Split(normalized, -1) {
+		if matchesCommandList(strings.TrimSpace(part), config.Get("denied_commands")) {
+			return CommandDenied, "denied by the denied_commands config"
+		}
+	}
+
+	if !IsWorkspaceTrusted() || shellOperatorRegex.MatchString(command) {
+		return CommandAsk, ""
+	}
+	if matchesCommandList(normalized, config.Get("allowed_commands")) {
+		return CommandAllowed, ""
+	}
+	return CommandAsk, ""
+}
+
+// removesRootOrHome returns whether a command runs rm with recursive and force flags, given in
+// any order and spelling, on the root or home directory
+func removesRootOrHome(command string) bool {
+	for _, part := range shellOperatorRegex.Split(command, -1) {
+		fields := strings.Fields(part)
+		for i, field := range fields {
+			// rm may follow sudo, env or a path like /bin/rm
+			if field != "rm" && !strings.HasSuffix(field, "/rm") {
+				continue
+			}
+			recursive, force, endOfFlags := false, false, false
+			var targets []string
+			for _, arg := range fields[i+1:] {
+				switch {
+				case endOfFlags || arg == "-" || !strings.HasPrefix(arg, "-"):
+					targets = append(targets, arg)
+				case arg == "--":
+					endOfFlags = true
+				case arg == "--recursive":
+					recursive = true
+				case arg == "--force":
+					force = true
+				case strings.HasPrefix(arg, "--"):
+					// Other long options, like --no-preserve-root
+				default:
+					recursive = recursive || strings.ContainsAny(arg, "rR")
+					force = force || strings.Contains(arg, "f")
+				}
+			}
+			if !recursive || !force {
+				continue
+			}
+			for _, target := range targets {
+				if isRootOrHome(target) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// isRootOrHome returns whether an argument of rm is the root or home directory, or all of its
+// files. Quotes don't change the directory, "$HOME" is the home directory too.
+func isRootOrHome(arg string) bool {
+	arg = strings.NewReplacer(`"`, "", "'", "").Replace(arg)
+	if arg == "" {
+		return false
+	}
+	arg = strings.TrimRight(strings.TrimSuffix(arg, "*"), "/")
+	return arg == "" || arg == "~" || arg == "$HOME" || arg == "${HOME}"
+}
+
+// AllowCommand adds a command to the allowed_commands of the project config
+func AllowCommand(command string) error {
+	command = strings.Join(strings.Fields(command), " ")
+	if strings.Contains(command, ",") {
+		return fmt.Errorf("commands containing ',' can't be added to allowed_commands")
+	}
+
+	allowed := config.Get("allowed_commands")
+	if matchesCommandList(command, allowed) {
+		return nil
+	}
+	if strings.TrimSpace(allowed) != "" {
+		command = allowed + "," + command
+	}
+	return config.Set("allowed_commands", command, false)
+}
@@ -0,0 +1,26 @@
+//go:build !windows
+
+package core
+
+import (
+	"os"
+	"syscall"
+)
+
+// commandProcessAttr starts a command in its own process group, so an interrupt or a timeout
+// reaches the processes it started as well
+func commandProcessAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{
+		Setpgid: true,
+	}
+}
+
+// interruptProcessGroup sends an interrupt to the process group of a command
+func interruptProcessGroup(process *os.Process) error {
+	return syscall.Kill(-process.Pid, syscall.SIGINT)
+}
+
+// killProcessGroup kills the process group of a command
+func killProcessGroup(process *os.Process) error {
+	return syscall.Kill(-process.Pid, syscall.SIGKILL)
+}
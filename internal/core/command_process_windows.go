@@ -0,0 +1,24 @@
+//go:build windows
+
+package core
+
+import (
+	"os"
+	"syscall"
+)
+
+// commandProcessAttr returns no attributes, Windows has no process groups like Unix
+func commandProcessAttr() *syscall.SysProcAttr {
+	return nil
+}
+
+// interruptProcessGroup kills the process of a command, Windows processes can't be sent an
+// interrupt
+func interruptProcessGroup(process *os.Process) error {
+	return process.Kill()
+}
+
+// killProcessGroup kills the process of a command
+func killProcessGroup(process *os.Process) error {
+	return process.Kill()
+}
@@ -0,0 +1,132 @@
+package core
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// Hooks of git commit that can reject a commit
+var commitHookNames = []string{"pre-commit", "prepare-commit-msg", "commit-msg"}
+
+// maxHookOutputChars limits the hook output returned to the model, linters can be verbose
+const maxHookOutputChars = 6000
+
+// installedCommitHooks returns the commit hooks git runs in the repository of the working
+// directory, also from core.hooksPath
+func installedCommitHooks() []string {
+	hooksDir, err := runGit(".", "rev-parse", "--git-path", "hooks")
+	if err != nil {
+		return nil
+	}
+	var hooks []string
+	for _, name := range commitHookNames {
+		info, err := os.Stat(filepath.Join(strings.TrimSpace(hooksDir), name))
+		// git ignores hooks that aren't executable, on Windows any file runs
+		if err != nil || info.IsDir() || (runtime.GOOS != "windows" && info.Mode()&0111 == 0) {
+			continue
+		}
+		hooks = append(hooks, name)
+	}
+	return hooks
+}
+
+// stagedSnapshot records the staged files in the working tree before a commit, so the files a
+// hook changed can be found after it failed
+type stagedSnapshot struct {
+	root     string
+	hashes   map[string][32]byte
+	unstaged map[string]bool // Files that also had unstaged changes
+}
+
+// takeStagedSnapshot records the content of the staged files
+func takeStagedSnapshot(files []stagedFile) (*stagedSnapshot, error) {
+	root, err := runGit(".", "rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, err
+	}
+	unstaged, err := runGit(".", "-c", "core.quotepath=off", "diff", "--name-only")
+	if err != nil {
+		return nil, err
+	}
+	snapshot := &stagedSnapshot{
+		root:     strings.TrimSpace(root),
+		hashes:   map[string][32]byte{},
+		unstaged: map[string]bool{},
+	}
+	for _, path := range strings.Split(strings.TrimSpace(unstaged), "\n") {
+		snapshot.unstaged[path] = true
+	}
+	for _, file := range files {
+		snapshot.hashes[file.path] = snapshot.hash(file.path)
+	}
+	return snapshot, nil
+}
+
+// hash returns the hash of a file in the working tree, deleted files have the hash of nothing
+func (s *stagedSnapshot) hash(path string) [32]byte {
+	content, _ := os.ReadFile(filepath.Join(s.root, filepath.FromSlash(path)))
+	return sha256.Sum256(content)
+}
+
+// restageHookFixes stages the files a hook changed again. Files that also had unstaged changes
+// aren't staged since that would add the other changes to the commit. It returns the staged and
+// the skipped files.
+func (s *stagedSnapshot) restageHookFixes() ([]string, []string, error) {
+	var restaged, skipped []string
+	for path, hash := range s.hashes {
+		if s.hash(path) == hash {
+			continue
+		}
+		if s.unstaged[path] {
+			skipped = append(skipped, path)
+		} else {
+			restaged = append(restaged, path)
+		}
+	}
+	sort.Strings(restaged)
+	sort.Strings(skipped)
+	if len(restaged) > 0 {
+		if _, err := runGit(s.root, append([]string{"add", "--"}, restaged...)...); err != nil {
+			return nil, skipped, err
+		}
+	}
+	return restaged, skipped, nil
+}
+
+// isHookFailure returns whether a failed commit was rejected by a hook rather than by git
+func isHookFailure(output string, hooks []string) bool {
+	if len(hooks) == 0 {
+		return false
+	}
+	for _, line := range strings.Split(output, "\n") {
+		if strings.HasPrefix(line, "fatal: ") {
+			return false
+		}
+	}
+	return true
+}
+
+// formatHookRejection describes a commit the hooks rejected for the model, with the output of
+// the hooks and the files they changed
+func formatHookRejection(output string, hooks []string, restaged []string, skipped []string) string {
+	var result strings.Builder
+	fmt.Fprintf(&result, "Error: The commit was rejected by a git hook (%s), nothing was committed and the staging area is as before.\n",
+		strings.Join(hooks, ", "))
+	if output = strings.TrimSpace(output); output != "" {
+		fmt.Fprintf(&result, "\nHook output:\n%s\n", truncateAtLine(output, maxHookOutputChars))
+	}
+	if len(restaged) > 0 {
+		fmt.Fprintf(&result, "\nThe hook changed %s, the commit was retried with these changes and rejected again.\n", strings.Join(restaged, ", "))
+	}
+	if len(skipped) > 0 {
+		fmt.Fprintf(&result, "\nThe hook changed %s, which also have changes that aren't part of the commit, so its changes weren't staged. Stage the hunks of the hook with git_stage_hunks and commit with staged_only.\n",
+			strings.Join(skipped, ", "))
+	}
+	result.WriteString("\nFix the problems the hook reported and call git_commit again, don't bypass the hook.")
+	return result.String()
+}
@@ -0,0 +1,64 @@
+//go:build !windows
+
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// initHookRepo creates a repository with a pre-commit hook and approves commits
+func initHookRepo(t *testing.T, files map[string]string, hook string) string {
+	dir := initGitRepo(t, files)
+	t.Chdir(dir)
+	for _, name := range []string{"GIT_AUTHOR_NAME", "GIT_COMMITTER_NAME"} {
+		t.Setenv(name, "Test")
+	}
+	for _, name := range []string{"GIT_AUTHOR_EMAIL", "GIT_COMMITTER_EMAIL"} {
+		t.Setenv(name, "test@example.com")
+	}
+	t.Cleanup(func() { SetApprovalPolicy("") })
+	require.NoError(t, SetApprovalPolicy(ApprovalYes))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ".git", "hooks", "pre-commit"), []byte("#!/bin/sh\n"+hook), 0755))
+	return dir
+}
+
+func TestGitCommitRestagesHookFixes(t *testing.T) {
+	// Like a formatter, the hook fixes the files and fails if it changed any
+	initHookRepo(t, map[string]string{"a.txt": "a\n"}, `for f in $(git diff --cached --name-only); do
+  if grep -q bad "$f"; then sed -i.bak s/bad/good/ "$f" && rm "$f.bak"; echo "fixed $f"; failed=1; fi
+done
+exit ${failed:-0}
+`)
+	require.NoError(t, os.WriteFile("a.txt", []byte("bad\n"), 0644))
+
+	result := GitCommit(map[string]interface{}{"message": "Update a", "files": []string{"a.txt"}})
+	assert.Equal(t, "Successfully committed changes with message: Update a\n"+
+		"The first attempt was rejected by a git hook that changed a.txt, the commit includes the changes of the hook.", result)
+	content, err := runGit(".", "show", "HEAD:a.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "good\n", content)
+}
+
+func TestGitCommitHookRejection(t *testing.T) {
+	initHookRepo(t, map[string]string{"a.txt": "a\n"}, "echo 'a.txt:1: line too short'\nexit 1\n")
+	require.NoError(t, os.WriteFile("a.txt", []byte("b\n"), 0644))
+
+	result := GitCommit(map[string]interface{}{"message": "Update a", "files": []string{"a.txt"}})
+	assert.Equal(t, "Error: The commit was rejected by a git hook (pre-commit), nothing was committed and the staging area is as before.\n\n"+
+		"Hook output:\na.txt:1: line too short\n\n"+
+		"Fix the problems the hook reported and call git_commit again, don't bypass the hook.", result)
+	status, err := runGit(".", "status", "--porcelain")
+	require.NoError(t, err)
+	assert.Equal(t, " M a.txt\n", status)
+}
+
+func TestIsHookFailure(t *testing.T) {
+	assert.True(t, isHookFailure("lint failed\n", []string{"pre-commit"}))
+	assert.False(t, isHookFailure("fatal: unable to auto-detect email address\n", []string{"pre-commit"}))
+	assert.False(t, isHookFailure("lint failed\n", nil))
+}
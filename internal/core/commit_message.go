@@ -0,0 +1,236 @@
+package core
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/pederhe/nca/pkg/config"
+)
+
+// git_commit reads the staged changes itself and formats the message in the style of the project.
+// With commit.style "conventional", or "auto" (the default) in a repository whose recent commits
+// follow Conventional Commits, messages become "type(scope): subject" laid out by commit.template,
+// with the type and the scope derived from the message and the staged files when it has none.
+
+// Styles of commit messages, set with commit.style
+const (
+	CommitStyleAuto         = "auto"
+	CommitStyleConventional = "conventional"
+	CommitStylePlain        = "plain"
+)
+
+// defaultCommitTemplate lays out conventional commit messages, commit.template replaces it
+const defaultCommitTemplate = "{{type}}({{scope}}): {{subject}}\n\n{{body}}"
+
+// Recent commits checked to detect the commit style of a repository
+const commitStyleSampleSize = 20
+
+// Matches the subject of a conventional commit, like "feat(api)!: add pagination"
+var conventionalCommitRegex = regexp.MustCompile(`^[a-z]+(\([^)]*\))?!?: \S`)
+
+// Directories too generic to be the scope of a commit
+var genericScopeDirs = map[string]bool{"src": true, "lib": true, "internal": true, "pkg": true, "app": true, "cmd": true}
+
+// Types of conventional commits by the first word of a message
+var commitTypeVerbs = map[string]string{
+	"fix": "fix", "fixes": "fix", "fixed": "fix", "correct": "fix", "resolve": "fix", "handle": "fix",
+	"add": "feat", "adds": "feat", "added": "feat", "implement": "feat", "introduce": "feat", "support": "feat", "create": "feat",
+	"refactor": "refactor", "rename": "refactor", "move": "refactor", "extract": "refactor", "simplify": "refactor", "clean": "refactor",
+	"document": "docs", "docs": "docs",
+	"test": "test", "tests": "test",
+	"optimize": "perf", "speed": "perf", "revert": "revert",
+	"bump": "build", "upgrade": "build",
+}
+
+// stagedFile is a file of the staged changes with its git status letter, like M or A
+type stagedFile struct {
+	status byte
+	path   string
+}
+
+// getStagedFiles returns the files with staged changes
+func getStagedFiles() ([]stagedFile, error) {
+	output, err := runGit(".", "-c", "core.quotepath=off", "diff", "--cached", "--name-status")
+	if err != nil {
+		return nil, err
+	}
+	var files []stagedFile
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Split(strings.TrimSpace(line), "\t")
+		if len(fields) < 2 || fields[0] == "" {
+			continue
+		}
+		// Renames and copies list the old and the new path
+		files = append(files, stagedFile{status: fields[0][0], path: fields[len(fields)-1]})
+	}
+	return files, nil
+}
+
+// useConventionalCommits returns whether commit messages are formatted as conventional commits
+func useConventionalCommits() bool {
+	switch strings.TrimSpace(config.Get("commit.style")) {
+	case CommitStyleConventional:
+		return true
+	case CommitStylePlain:
+		return false
+	}
+	output, err := runGit(".", "log", fmt.Sprintf("-%d", commitStyleSampleSize), "--format=%s")
+	if err != nil {
+		return false
+	}
+	total, conventional := 0, 0
+	for _, subject := range strings.Split(strings.TrimSpace(output), "\n") {
+		if subject == "" {
+			continue
+		}
+		total++
+		if conventionalCommitRegex.MatchString(subject) {
+			conventional++
+		}
+	}
+	// A few commits don't make a convention yet
+	return total >= 3 && conventional*2 > total
+}
+
+// proposeCommitMessage returns the message of a commit of the staged files. Conventional
+// messages get a type and a scope unless they have them, an empty message is made up from the
+// files.
+func proposeCommitMessage(message string, files []stagedFile) string {
+	message = strings.TrimSpace(message)
+	subject, body, _ := strings.Cut(message, "\n")
+	subject = strings.TrimSpace(subject)
+	body = strings.TrimSpace(body)
+
+	if !useConventionalCommits() {
+		if subject == "" {
+			return "Update " + describeStagedFiles(files)
+		}
+		return message
+	}
+	if conventionalCommitRegex.MatchString(subject) {
+		return message
+	}
+
+	commitType := inferCommitType(subject, files)
+	if subject == "" {
+		subject = "update " + describeStagedFiles(files)
+	}
+	// Conventional subjects are lower case and have no period, acronyms like "API" are kept
+	subject = strings.TrimSuffix(subject, ".")
+	if len(subject) > 1 && subject[0] >= 'A' && subject[0] <= 'Z' && !(subject[1] >= 'A' && subject[1] <= 'Z') {
+		subject = strings.ToLower(subject[:1]) + subject[1:]
+	}
+
+	template := config.Get("commit.template")
+	if strings.TrimSpace(template) == "" {
+		template = defaultCommitTemplate
+	}
+	template = strings.ReplaceAll(template, `\n`, "\n")
+	result := substituteVariables(template, map[string]string{
+		"type":    commitType,
+		"scope":   inferCommitScope(files),
+		"subject": subject,
+		"body":    body,
+	})
+	// Without a scope "feat(): x" becomes "feat: x"
+	result = strings.ReplaceAll(result, "()", "")
+	return strings.TrimSpace(result)
+}
+
+// inferCommitType returns the conventional commit type of a change: from the kind of the files
+// if they are all documentation, tests, CI or build files, otherwise from the first word of the
+// subject
+func inferCommitType(subject string, files []stagedFile) string {
+	kinds := map[string]bool{}
+	for _, file := range files {
+		kinds[commitFileKind(file.path)] = true
+	}
+	if len(kinds) == 1 {
+		for kind := range kinds {
+			if kind != "" {
+				return kind
+			}
+		}
+	}
+
+	if fields := strings.Fields(strings.ToLower(subject)); len(fields) > 0 {
+		if commitType, ok := commitTypeVerbs[strings.Trim(fields[0], ".,:")]; ok {
+			return commitType
+		}
+	}
+	for _, file := range files {
+		if file.status != 'A' {
+			return "chore"
+		}
+	}
+	// Only new files
+	return "feat"
+}
+
+// commitFileKind returns the commit type of the changes of a file if it only holds
+// documentation, tests, CI or build configuration, or "" for other files
+func commitFileKind(filePath string) string {
+	filePath = strings.ToLower(filePath)
+	name := path.Base(filePath)
+	switch {
+	case strings.HasPrefix(filePath, ".github/workflows/") || strings.HasPrefix(filePath, ".circleci/") || name == ".gitlab-ci.yml":
+		return "ci"
+	case strings.HasSuffix(name, "_test.go") || strings.Contains(name, ".test.") || strings.Contains(name, ".spec.") ||
+		strings.HasPrefix(name, "test_") || strings.HasPrefix(filePath, "test/") || strings.HasPrefix(filePath, "tests/") || strings.Contains(filePath, "/tests/"):
+		return "test"
+	case strings.HasSuffix(name, ".md") || strings.HasSuffix(name, ".rst") || strings.HasPrefix(filePath, "docs/"):
+		return "docs"
+	}
+	switch name {
+	case "go.mod", "go.sum", "package.json", "package-lock.json", "yarn.lock", "pnpm-lock.yaml", "cargo.toml", "cargo.lock",
+		"makefile", "dockerfile", "requirements.txt", "pyproject.toml":
+		return "build"
+	}
+	return ""
+}
+
+// inferCommitScope returns the scope of a change: the name of the closest directory all files
+// are in, or "" if they are in the root or a generic directory like src
+func inferCommitScope(files []stagedFile) string {
+	if len(files) == 0 {
+		return ""
+	}
+	common := path.Dir(files[0].path)
+	for _, file := range files[1:] {
+		dir := path.Dir(file.path)
+		for common != "." && dir != common && !strings.HasPrefix(dir, common+"/") {
+			common = path.Dir(common)
+		}
+	}
+	scope := path.Base(common)
+	if common == "." || genericScopeDirs[scope] {
+		return ""
+	}
+	return scope
+}
+
+// describeStagedFiles names the staged files for a commit subject
+func describeStagedFiles(files []stagedFile) string {
+	switch len(files) {
+	case 1:
+		return path.Base(files[0].path)
+	case 2:
+		return path.Base(files[0].path) + " and " + path.Base(files[1].path)
+	default:
+		return fmt.Sprintf("%d files", len(files))
+	}
+}
+
+// checkAmendable returns an error if the last commit can't be amended because it's pushed
+func checkAmendable() error {
+	output, err := runGit(".", "branch", "-r", "--contains", "HEAD")
+	if err != nil {
+		return err
+	}
+	if branches := strings.Fields(output); len(branches) > 0 {
+		return fmt.Errorf("the last commit is already pushed to %s, amending it would rewrite published history", branches[0])
+	}
+	return nil
+}
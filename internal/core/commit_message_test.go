@@ -0,0 +1,59 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProposeCommitMessage(t *testing.T) {
+	t.Chdir(t.TempDir())
+	t.Setenv("NCA_COMMIT_STYLE", CommitStyleConventional)
+	files := []stagedFile{{'M', "internal/core/tools.go"}, {'M', "internal/core/tools_test.go"}}
+
+	assert.Equal(t, "fix(core): handle empty diffs\n\nThe staged diff was not checked.",
+		proposeCommitMessage("Handle empty diffs.\n\nThe staged diff was not checked.", files))
+	assert.Equal(t, "feat(core): add the API client", proposeCommitMessage("Add the API client", files))
+	// Conventional messages are kept
+	assert.Equal(t, "perf: cache the diff", proposeCommitMessage("perf: cache the diff", files))
+	assert.Equal(t, "chore(core): update tools.go and tools_test.go", proposeCommitMessage("", files))
+
+	t.Setenv("NCA_COMMIT_TEMPLATE", `{{type}}: {{subject}} [{{scope}}]\n\n{{body}}`)
+	assert.Equal(t, "docs: describe the setup [docs]", proposeCommitMessage("Describe the setup", []stagedFile{{'M', "docs/setup.md"}}))
+
+	t.Setenv("NCA_COMMIT_STYLE", CommitStylePlain)
+	assert.Equal(t, "Handle empty diffs.", proposeCommitMessage("Handle empty diffs.", files))
+	assert.Equal(t, "Update tools.go and tools_test.go", proposeCommitMessage("", files))
+}
+
+func TestUseConventionalCommits(t *testing.T) {
+	dir := initGitRepo(t, map[string]string{"a.txt": "a\n"})
+	t.Chdir(dir)
+	assert.False(t, useConventionalCommits())
+
+	for _, message := range []string{"feat: add b", "fix(b): handle c", "docs: readme"} {
+		git(dir, "commit", "-q", "--allow-empty", "-m", message)
+	}
+	assert.True(t, useConventionalCommits())
+
+	t.Setenv("NCA_COMMIT_STYLE", CommitStylePlain)
+	assert.False(t, useConventionalCommits())
+}
+
+func TestInferCommitType(t *testing.T) {
+	assert.Equal(t, "test", inferCommitType("Add cases", []stagedFile{{'M', "pkg/a_test.go"}, {'A', "tests/b.py"}}))
+	assert.Equal(t, "ci", inferCommitType("Run on push", []stagedFile{{'M', ".github/workflows/ci.yml"}}))
+	assert.Equal(t, "build", inferCommitType("Bump x", []stagedFile{{'M', "go.mod"}, {'M', "go.sum"}}))
+	// Mixed kinds use the verb of the subject
+	assert.Equal(t, "refactor", inferCommitType("Rename Config", []stagedFile{{'M', "a.go"}, {'M', "README.md"}}))
+	assert.Equal(t, "feat", inferCommitType("Parser", []stagedFile{{'A', "parser.go"}}))
+	assert.Equal(t, "chore", inferCommitType("Parser", []stagedFile{{'M', "parser.go"}}))
+}
+
+func TestInferCommitScope(t *testing.T) {
+	assert.Equal(t, "core", inferCommitScope([]stagedFile{{'M', "internal/core/a.go"}, {'M', "internal/core/b.go"}}))
+	assert.Equal(t, "api", inferCommitScope([]stagedFile{{'M', "pkg/api/client.go"}, {'M', "pkg/api/types/types.go"}}))
+	// Generic directories and the root are no scope
+	assert.Equal(t, "", inferCommitScope([]stagedFile{{'M', "internal/core/a.go"}, {'M', "internal/services/b.go"}}))
+	assert.Equal(t, "", inferCommitScope([]stagedFile{{'M', "main.go"}, {'M', "internal/core/b.go"}}))
+}
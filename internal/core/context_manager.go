@@ -1,18 +1,59 @@
 package core
 
 import (
+	"fmt"
 	"math"
 	"strings"
 
 	"github.com/pederhe/nca/pkg/api/types"
+	"github.com/pederhe/nca/pkg/log"
 )
 
-// UpdateContextMessages updates the context messages if the total tokens exceed the max allowed size
+// maxSummaryMessageChars limits each removed message in the summary request, tool results
+// are often large and only their gist is needed
+const maxSummaryMessageChars = 4000
+
+// Tokens of the system prompt and tool definitions sent with the last request
+var systemPromptTokens int
+
+// contextSummarizer answers a summary request, usually with the cheaper summarizer model
+var contextSummarizer func(prompt string) (string, error)
+
+// SetContextSummarizer sets the function that summarizes messages removed from the context.
+// Without one the removed messages are dropped.
+func SetContextSummarizer(summarizer func(prompt string) (string, error)) {
+	contextSummarizer = summarizer
+}
+
+// SetSystemPromptTokens records the size of the system prompt, which is sent with every
+// request but isn't part of the conversation
+func SetSystemPromptTokens(tokens int) {
+	systemPromptTokens = tokens
+}
+
+// CountContextTokens returns the number of tokens the conversation takes up in the context
+// of the model, including the system prompt
+func CountContextTokens(modelInfo *types.ModelInfo, conversation []map[string]string) int {
+	modelName := ""
+	if modelInfo != nil {
+		modelName = modelInfo.Name
+	}
+	return systemPromptTokens + GetTokenCounter(modelName).CountMessages(conversation)
+}
+
+// UpdateContextMessages updates the context messages if the total tokens exceed the max allowed size.
+// The tokens of the conversation are counted before the next request, so large tool results are
+// truncated before the model rejects the request. The usage reported for the previous request is
+// used when it is larger, since counts without the tokenizer of the model are estimates.
 func UpdateContextMessages(modelInfo *types.ModelInfo, conversation *[]map[string]string, currentDeletedRange *[2]int, previousUsage *types.Usage) bool {
 	_, maxAllowedSize := getContextWindowInfo(modelInfo)
-	if previousUsage != nil && previousUsage.TotalTokens >= maxAllowedSize {
+	totalTokens := CountContextTokens(modelInfo, *conversation)
+	if previousUsage != nil && previousUsage.TotalTokens > totalTokens {
+		totalTokens = previousUsage.TotalTokens
+	}
+	if totalTokens >= maxAllowedSize {
 		keep := "half"
-		if previousUsage.TotalTokens/2 > maxAllowedSize {
+		if totalTokens/2 > maxAllowedSize {
 			keep = "quarter"
 		}
 		newRange := GetNextTruncationRange(*conversation, *currentDeletedRange, keep)
@@ -23,10 +64,7 @@ func UpdateContextMessages(modelInfo *types.ModelInfo, conversation *[]map[strin
 
 		// Update current deleted range
 		*currentDeletedRange = newRange
-
-		// Create new conversation slice with truncated messages
-		// Keep messages before the truncation range and after the truncation range
-		*conversation = append((*conversation)[:newRange[0]], (*conversation)[newRange[1]+1:]...)
+		TruncateConversation(conversation, newRange)
 
 		return true
 	}
@@ -34,6 +72,74 @@ func UpdateContextMessages(modelInfo *types.ModelInfo, conversation *[]map[strin
 	return false
 }
 
+// TruncateConversation removes the messages of a truncation range. If a summarizer is set they are
+// replaced with their summary, so the task can go on without losing what was done.
+func TruncateConversation(conversation *[]map[string]string, newRange [2]int) {
+	var replacement []map[string]string
+	if contextSummarizer != nil {
+		removed := (*conversation)[newRange[0] : newRange[1]+1]
+		summary, err := contextSummarizer(buildSummaryPrompt(removed))
+		if err != nil {
+			log.LogDebug(fmt.Sprintf("Failed to summarize removed messages: %s\n", err))
+		} else if summary != "" {
+			// The range starts with an assistant message and ends with a user message, the
+			// summary pair keeps the roles alternating
+			replacement = []map[string]string{
+				{"role": "assistant", "content": "Summary of the earlier conversation, its messages were removed to fit the context window:\n\n" + summary},
+				{"role": "user", "content": "Continue the task based on the summary."},
+			}
+		}
+	}
+
+	// Keep messages before the truncation range and after the truncation range
+	rest := append(replacement, (*conversation)[newRange[1]+1:]...)
+	*conversation = append((*conversation)[:newRange[0]], rest...)
+}
+
+// buildSummaryPrompt returns the request to summarize messages removed from the context
+func buildSummaryPrompt(messages []map[string]string) string {
+	var prompt strings.Builder
+	prompt.WriteString("The following messages of a conversation between a user and a coding agent are removed to fit the context window. " +
+		"Summarize them so the agent can continue the task: the requests of the user, what was done, the files that were read or changed, " +
+		"decisions, findings, errors and what remains to be done. Keep file paths, names and commands exact. Answer with the summary only, in at most 300 words.\n")
+	writeSummaryMessages(&prompt, messages)
+	return prompt.String()
+}
+
+// writeSummaryMessages adds the messages to summarize to a summary request
+func writeSummaryMessages(prompt *strings.Builder, messages []map[string]string) {
+	for _, message := range messages {
+		content := message["content"]
+		if len(content) > maxSummaryMessageChars {
+			content = content[:maxSummaryMessageChars] + "\n[...]"
+		}
+		prompt.WriteString(fmt.Sprintf("\n<%s>\n%s\n</%s>\n", message["role"], content, message["role"]))
+	}
+}
+
+// BuildCompactPrompt returns the request to summarize the whole conversation for /compact, the
+// instructions of the user tell what the summary should focus on
+func BuildCompactPrompt(messages []map[string]string, instructions string) string {
+	var prompt strings.Builder
+	prompt.WriteString("The following conversation between a user and a coding agent is replaced with a summary to free the context window. " +
+		"Write a short digest so the agent can continue working from it alone: the requests of the user, what was done, the files that were read or changed, " +
+		"decisions, findings, errors and what remains to be done. Keep file paths, names and commands exact. Answer with the summary only, in at most 500 words.\n")
+	if instructions = strings.TrimSpace(instructions); instructions != "" {
+		prompt.WriteString("Instructions of the user for the summary: " + instructions + "\n")
+	}
+	writeSummaryMessages(&prompt, messages)
+	return prompt.String()
+}
+
+// CompactConversation returns the conversation that replaces the history with its summary. The
+// summary is an exchange, so the next prompt of the user keeps the roles alternating.
+func CompactConversation(summary string) []map[string]string {
+	return []map[string]string{
+		{"role": "user", "content": "The earlier conversation was compacted to free the context window. Continue from its summary."},
+		{"role": "assistant", "content": "Summary of the earlier conversation:\n\n" + strings.TrimSpace(summary)},
+	}
+}
+
 // GetNextTruncationRange calculates the range of messages to be removed from the conversation history
 func GetNextTruncationRange(conversation []map[string]string, currentDeletedRange [2]int, keep string) [2]int {
 	// Always keep the first message
@@ -58,9 +164,9 @@ func GetNextTruncationRange(conversation []map[string]string, currentDeletedRang
 
 	rangeEndIndex := startOfRest + messagesToRemove - 1
 
-	// Make sure the last message being removed is a user message
+	// Make sure the last message being removed is a user message (or a tool result with native tool calling)
 	// This preserves the user-assistant-user-assistant structure
-	if rangeEndIndex < len(conversation) && conversation[rangeEndIndex]["role"] != "user" {
+	if rangeEndIndex < len(conversation) && conversation[rangeEndIndex]["role"] != "user" && conversation[rangeEndIndex]["role"] != "tool" {
 		rangeEndIndex--
 	}
 
@@ -76,7 +182,7 @@ func getContextWindowInfo(modelInfo *types.ModelInfo) (int, int) {
 	}
 
 	// Handle special cases like DeepSeek
-	if strings.Contains(strings.ToLower(modelInfo.Name), "deepseek") {
+	if modelInfo != nil && strings.Contains(strings.ToLower(modelInfo.Name), "deepseek") {
 		contextWindow = 64000
 	}
 
@@ -1,6 +1,8 @@
 package core
 
 import (
+	"errors"
+	"strings"
 	"testing"
 
 	"github.com/pederhe/nca/pkg/api/types"
@@ -304,3 +306,70 @@ func TestUpdateContextMessages(t *testing.T) {
 func intPtr(i int) *int {
 	return &i
 }
+
+func TestTruncateConversationSummary(t *testing.T) {
+	defer SetContextSummarizer(nil)
+	conversation := []map[string]string{
+		{"role": "user", "content": "Fix the login bug"},
+		{"role": "assistant", "content": "<read_file><path>auth.go</path></read_file>"},
+		{"role": "user", "content": "[read_file for 'auth.go'] Result: package auth"},
+		{"role": "assistant", "content": "The check is inverted"},
+		{"role": "user", "content": "Fix it"},
+		{"role": "assistant", "content": "Done"},
+	}
+
+	var prompt string
+	SetContextSummarizer(func(p string) (string, error) {
+		prompt = p
+		return "Read auth.go, the check is inverted", nil
+	})
+	truncated := append([]map[string]string(nil), conversation...)
+	TruncateConversation(&truncated, [2]int{1, 2})
+	if !strings.Contains(prompt, "<assistant>\n<read_file><path>auth.go</path></read_file>\n</assistant>") || strings.Contains(prompt, "The check is inverted") {
+		t.Errorf("Summary prompt should contain only the removed messages, got: %s", prompt)
+	}
+	// The summary replaces the removed messages as an assistant and user pair
+	if len(truncated) != 6 {
+		t.Fatalf("Expected 6 messages, got %d", len(truncated))
+	}
+	if truncated[1]["role"] != "assistant" || !strings.Contains(truncated[1]["content"], "Read auth.go, the check is inverted") {
+		t.Errorf("Expected the summary as the second message, got %v", truncated[1])
+	}
+	if truncated[2]["role"] != "user" || truncated[3]["content"] != "The check is inverted" {
+		t.Errorf("Expected the remaining messages after the summary, got %v", truncated[2:])
+	}
+
+	// Messages are dropped when the summary fails
+	SetContextSummarizer(func(string) (string, error) { return "", errors.New("rate limited") })
+	truncated = append([]map[string]string(nil), conversation...)
+	TruncateConversation(&truncated, [2]int{1, 2})
+	if len(truncated) != 4 || truncated[1]["content"] != "The check is inverted" {
+		t.Errorf("Expected the removed messages to be dropped, got %v", truncated)
+	}
+}
+
+func TestCompactConversation(t *testing.T) {
+	conversation := []map[string]string{
+		{"role": "user", "content": "Refactor the auth module"},
+		{"role": "assistant", "content": "<read_file><path>auth.go</path></read_file>"},
+		{"role": "user", "content": "[read_file for 'auth.go'] Result: " + strings.Repeat("x", maxSummaryMessageChars+100)},
+	}
+	prompt := BuildCompactPrompt(conversation, "  keep details about the auth refactor ")
+	if !strings.Contains(prompt, "Instructions of the user for the summary: keep details about the auth refactor\n") {
+		t.Errorf("Expected the instructions in the prompt, got: %s", prompt)
+	}
+	if !strings.Contains(prompt, "<user>\nRefactor the auth module\n</user>") || !strings.Contains(prompt, "\n[...]\n</user>") {
+		t.Errorf("Expected all messages with long ones cut off, got: %s", prompt)
+	}
+	if strings.Contains(BuildCompactPrompt(conversation, ""), "Instructions of the user") {
+		t.Error("Expected no instructions without them")
+	}
+
+	compacted := CompactConversation("Refactored auth.go\n")
+	if len(compacted) != 2 || compacted[0]["role"] != "user" || compacted[1]["role"] != "assistant" {
+		t.Fatalf("Expected a user and assistant pair, got %v", compacted)
+	}
+	if compacted[1]["content"] != "Summary of the earlier conversation:\n\nRefactored auth.go" {
+		t.Errorf("Expected the summary in the assistant message, got %q", compacted[1]["content"])
+	}
+}
@@ -0,0 +1,150 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// CustomCommand is a slash command of the REPL defined by the user in a markdown file of
+// .nca/commands or ~/.nca/commands, its prompt is sent as if the user typed it
+type CustomCommand struct {
+	Name        string
+	Description string
+	Prompt      string
+	// Source is the file the command is defined in
+	Source string
+}
+
+// Placeholders of custom command prompts
+var customCommandPlaceholderRegex = regexp.MustCompile(`\{(args|file|selection)\}`)
+
+// Matches the front matter of a command file, the description is the only field read from it
+var customCommandFrontMatterRegex = regexp.MustCompile(`^---\r?\n([\s\S]*?)\r?\n---\r?\n?`)
+
+// getCustomCommandDirs returns the directories of custom commands, project commands come first
+// so they take precedence over the global ones in ~/.nca/commands
+func getCustomCommandDirs() []string {
+	var dirs []string
+	// Project commands of untrusted workspaces could give the agent any task
+	if IsWorkspaceTrusted() {
+		dirs = append(dirs, filepath.Join(".nca", "commands"))
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		dirs = append(dirs, filepath.Join(home, ".nca", "commands"))
+	}
+	return dirs
+}
+
+// ListCustomCommands returns the custom commands sorted by name
+func ListCustomCommands() []*CustomCommand {
+	byName := make(map[string]*CustomCommand)
+	dirs := getCustomCommandDirs()
+	for i := len(dirs) - 1; i >= 0; i-- {
+		paths, _ := filepath.Glob(filepath.Join(dirs[i], "*.md"))
+		for _, path := range paths {
+			if command, err := loadCustomCommand(path); err == nil {
+				byName[command.Name] = command
+			}
+		}
+	}
+
+	commands := make([]*CustomCommand, 0, len(byName))
+	for _, command := range byName {
+		commands = append(commands, command)
+	}
+	sort.Slice(commands, func(i, j int) bool {
+		return commands[i].Name < commands[j].Name
+	})
+	return commands
+}
+
+// LoadCustomCommand returns the custom command with a name, or nil if there is none
+func LoadCustomCommand(name string) *CustomCommand {
+	if name == "" || strings.ContainsAny(name, `/\`) || strings.HasPrefix(name, ".") {
+		return nil
+	}
+	for _, dir := range getCustomCommandDirs() {
+		if command, err := loadCustomCommand(filepath.Join(dir, name+".md")); err == nil {
+			return command
+		}
+	}
+	return nil
+}
+
+// loadCustomCommand reads a command file. The description is set in front matter, or is the first
+// line of the prompt.
+func loadCustomCommand(path string) (*CustomCommand, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	command := &CustomCommand{
+		Name:   strings.TrimSuffix(filepath.Base(path), ".md"),
+		Prompt: string(data),
+		Source: path,
+	}
+	if match := customCommandFrontMatterRegex.FindStringSubmatch(command.Prompt); match != nil {
+		command.Prompt = command.Prompt[len(match[0]):]
+		for _, line := range strings.Split(match[1], "\n") {
+			if key, value, ok := strings.Cut(line, ":"); ok && strings.TrimSpace(key) == "description" {
+				command.Description = strings.Trim(strings.TrimSpace(value), `"'`)
+			}
+		}
+	}
+	command.Prompt = strings.TrimSpace(command.Prompt)
+	if command.Prompt == "" {
+		return nil, fmt.Errorf("command %s has no prompt", command.Name)
+	}
+	if command.Description == "" {
+		firstLine, _, _ := strings.Cut(command.Prompt, "\n")
+		command.Description = truncateAtLine(strings.TrimLeft(firstLine, "# "), 60)
+	}
+	return command, nil
+}
+
+// Expand returns the prompt of the command for the text the user typed after it. {args} is the
+// whole text, {file} the first argument naming a file and {selection} the content of that file or
+// of its lines with a range like main.go:10-20. Without placeholders the text is appended to the
+// prompt.
+func (c *CustomCommand) Expand(args string) (string, error) {
+	args = strings.TrimSpace(args)
+	var file, selection string
+	if strings.Contains(c.Prompt, "{file}") || strings.Contains(c.Prompt, "{selection}") {
+		for _, arg := range strings.Fields(args) {
+			path, lineRange := arg, ""
+			if match := pathRangeRegex.FindStringSubmatch(arg); match != nil {
+				path, lineRange = match[1], match[2]
+			}
+			if info, err := os.Stat(path); err != nil || info.IsDir() {
+				continue
+			}
+			file = path
+			selection = ReadFile(map[string]interface{}{"path": path, "range": lineRange})
+			if strings.HasPrefix(selection, "Error") {
+				return "", fmt.Errorf("%s", strings.TrimPrefix(selection, "Error: "))
+			}
+			break
+		}
+		if file == "" {
+			return "", fmt.Errorf("/%s needs a file, usage: /%s <file>[:start-end]", c.Name, c.Name)
+		}
+	}
+
+	prompt := customCommandPlaceholderRegex.ReplaceAllStringFunc(c.Prompt, func(placeholder string) string {
+		switch placeholder {
+		case "{args}":
+			return args
+		case "{file}":
+			return file
+		}
+		return selection
+	})
+	if !customCommandPlaceholderRegex.MatchString(c.Prompt) && args != "" {
+		prompt += "\n\n" + args
+	}
+	return prompt, nil
+}
@@ -0,0 +1,59 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListCustomCommands(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	t.Chdir(t.TempDir())
+	trustWorkspace(t)
+
+	global := filepath.Join(home, ".nca", "commands")
+	require.NoError(t, os.MkdirAll(global, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(global, "explain.md"), []byte("# Explain code\n\nExplain {file}."), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(global, "refactor.md"), []byte("Refactor it."), 0644))
+	require.NoError(t, os.MkdirAll(filepath.Join(".nca", "commands"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(".nca", "commands", "refactor.md"),
+		[]byte("---\ndescription: \"Refactor like the team does\"\n---\nRefactor {args} with small functions."), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(".nca", "commands", "empty.md"), []byte("---\ndescription: x\n---\n"), 0644))
+
+	commands := ListCustomCommands()
+	require.Len(t, commands, 2)
+	assert.Equal(t, "explain", commands[0].Name)
+	assert.Equal(t, "Explain code", commands[0].Description)
+	// Project commands replace global ones
+	assert.Equal(t, "refactor", commands[1].Name)
+	assert.Equal(t, "Refactor like the team does", commands[1].Description)
+	assert.Equal(t, "Refactor {args} with small functions.", commands[1].Prompt)
+
+	assert.Equal(t, commands[1].Source, LoadCustomCommand("refactor").Source)
+	assert.Nil(t, LoadCustomCommand("missing"))
+	assert.Nil(t, LoadCustomCommand("../refactor"))
+}
+
+func TestExpandCustomCommand(t *testing.T) {
+	t.Chdir(t.TempDir())
+	require.NoError(t, os.WriteFile("main.go", []byte("package main\n\nfunc main() {}\n"), 0644))
+
+	command := &CustomCommand{Name: "explain", Prompt: "Explain {selection} of {file}. {args}"}
+	prompt, err := command.Expand("main.go:3-3 briefly")
+	require.NoError(t, err)
+	assert.Equal(t, "Explain func main() {} of main.go. main.go:3-3 briefly", prompt)
+
+	_, err = command.Expand("briefly")
+	assert.EqualError(t, err, "/explain needs a file, usage: /explain <file>[:start-end]")
+
+	// Without placeholders the arguments are appended
+	command = &CustomCommand{Name: "write-tests", Prompt: "Write table driven tests."}
+	prompt, err = command.Expand("for the parser")
+	require.NoError(t, err)
+	assert.Equal(t, "Write table driven tests.\n\nfor the parser", prompt)
+}
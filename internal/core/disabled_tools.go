@@ -0,0 +1,88 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pederhe/nca/pkg/config"
+)
+
+// Tools that can't be disabled, a task can't end without them
+var requiredTools = map[string]bool{
+	"attempt_completion": true,
+	"ask_mode_response":  true,
+}
+
+// GetDisabledTools returns the tools disabled with the tools.disabled config, which is a JSON list
+// like ["execute_command", "fetch_web_content"] or a comma separated list
+func GetDisabledTools() map[string]bool {
+	value := strings.TrimSpace(config.Get("tools.disabled"))
+	if value == "" {
+		return nil
+	}
+
+	var names []string
+	if strings.HasPrefix(value, "[") {
+		if err := json.Unmarshal([]byte(value), &names); err != nil {
+			names = strings.Split(strings.Trim(value, "[]"), ",")
+		}
+	} else {
+		names = strings.Split(value, ",")
+	}
+
+	disabled := make(map[string]bool)
+	for _, name := range names {
+		name = strings.Trim(strings.TrimSpace(name), "\"'")
+		if name != "" && !requiredTools[name] {
+			disabled[name] = true
+		}
+	}
+	return disabled
+}
+
+// CheckToolEnabled returns an error result if a tool is disabled, or "" if it may run
+func CheckToolEnabled(toolName string) string {
+	if GetDisabledTools()[toolName] {
+		return fmt.Sprintf("Error: The %s tool is disabled by policy (tools.disabled config) and can't be used. Accomplish the task with the other tools or tell the user what they need to do themselves.", toolName)
+	}
+	return ""
+}
+
+// removeDisabledTools removes the documentation of disabled tools from the system prompt, so
+// they're neither described to the model nor sent as native tool definitions
+func removeDisabledTools(prompt string, disabled map[string]bool) string {
+	start := strings.Index(prompt, toolsMarker)
+	end := strings.Index(prompt, toolExamplesMarker)
+	if len(disabled) == 0 || start < 0 || end < start {
+		return prompt
+	}
+
+	start += len(toolsMarker)
+	blocks := strings.Split(prompt[start:end], "\n## ")
+	kept := blocks[:0]
+	for i, block := range blocks {
+		name := strings.TrimSpace(strings.SplitN(block, "\n", 2)[0])
+		if i > 0 && disabled[name] {
+			continue
+		}
+		kept = append(kept, block)
+	}
+	return prompt[:start] + strings.Join(kept, "\n## ") + prompt[end:]
+}
+
+// disabledToolsNotice tells the model which tools it must not use, other parts of the prompt may
+// still mention them
+func disabledToolsNotice(disabled map[string]bool) string {
+	if len(disabled) == 0 {
+		return ""
+	}
+	names := make([]string, 0, len(disabled))
+	for name := range disabled {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return "\n\n====\n\nDISABLED TOOLS\n\nThe following tools are disabled by policy in this environment and calls to them fail: " +
+		strings.Join(names, ", ") + ". Ignore any mention of them in these instructions."
+}
@@ -0,0 +1,49 @@
+package core
+
+import (
+	"os"
+	"testing"
+
+	"github.com/pederhe/nca/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDisabledTools(t *testing.T) {
+	tmpDir := t.TempDir()
+	originalDir, err := os.Getwd()
+	require.NoError(t, err)
+	defer os.Chdir(originalDir)
+	os.Chdir(tmpDir)
+	t.Setenv("HOME", t.TempDir())
+
+	assert.Empty(t, GetDisabledTools())
+	assert.Empty(t, CheckToolEnabled("execute_command"))
+	builtin, err := BuildSystemPrompt()
+	require.NoError(t, err)
+
+	// attempt_completion is needed to end a task and can't be disabled
+	require.NoError(t, config.Set("tools.disabled", `["execute_command", "fetch_web_content", "attempt_completion"]`, false))
+	assert.Equal(t, map[string]bool{"execute_command": true, "fetch_web_content": true}, GetDisabledTools())
+	assert.Contains(t, CheckToolEnabled("execute_command"), "Error: The execute_command tool is disabled by policy")
+	assert.Empty(t, CheckToolEnabled("read_file"))
+
+	prompt, err := BuildSystemPrompt()
+	require.NoError(t, err)
+	assert.NotContains(t, prompt, "## execute_command\n")
+	assert.NotContains(t, prompt, "## fetch_web_content\n")
+	assert.Contains(t, prompt, "## read_file\n")
+	assert.Contains(t, prompt, "## new_task\n")
+	assert.Contains(t, prompt, "disabled by policy in this environment and calls to them fail: execute_command, fetch_web_content.")
+
+	// Native tool definitions come from the same documentation
+	var names []string
+	for _, definition := range BuildToolDefinitions(prompt) {
+		names = append(names, definition.Function.Name)
+	}
+	assert.NotContains(t, names, "execute_command")
+	assert.Len(t, names, len(BuildToolDefinitions(builtin))-2)
+
+	require.NoError(t, config.Set("tools.disabled", "download_file, use_mcp_tool", false))
+	assert.Equal(t, map[string]bool{"download_file": true, "use_mcp_tool": true}, GetDisabledTools())
+}
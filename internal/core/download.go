@@ -0,0 +1,157 @@
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pederhe/nca/pkg/utils"
+)
+
+// progressWriter prints download progress while data is written through it
+type progressWriter struct {
+	total      int64
+	written    int64
+	lastUpdate time.Time
+}
+
+func (p *progressWriter) Write(data []byte) (int, error) {
+	p.written += int64(len(data))
+	if utils.IsOutputPiped() || time.Since(p.lastUpdate) < 200*time.Millisecond {
+		return len(data), nil
+	}
+	p.lastUpdate = time.Now()
+
+	if p.total > 0 {
+		fmt.Printf("\rDownloading... %s / %s (%d%%)", utils.FormatSize(p.written), utils.FormatSize(p.total), p.written*100/p.total)
+	} else {
+		fmt.Printf("\rDownloading... %s", utils.FormatSize(p.written))
+	}
+	return len(data), nil
+}
+
+// resolveWorkspacePath returns the absolute path of path and makes sure it is inside the workspace
+func resolveWorkspacePath(path string) (string, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	if !IsInWorkspace(absPath) {
+		return "", fmt.Errorf("path '%s' is outside the workspace", path)
+	}
+	return absPath, nil
+}
+
+// DownloadFile downloads a URL to a file inside the workspace, optionally verifying its sha256 checksum
+func DownloadFile(params map[string]interface{}) string {
+	urlStr, ok := params["url"].(string)
+	if !ok || urlStr == "" {
+		return "Error: Missing or empty URL parameter"
+	}
+
+	path, ok := params["path"].(string)
+	if !ok || path == "" {
+		return "Error: Missing destination path parameter"
+	}
+
+	expectedSum, _ := params["sha256"].(string)
+	expectedSum = strings.ToLower(strings.TrimSpace(expectedSum))
+	if expectedSum != "" {
+		if decoded, err := hex.DecodeString(expectedSum); err != nil || len(decoded) != sha256.Size {
+			return fmt.Sprintf("Error: Invalid sha256 checksum: %s", expectedSum)
+		}
+	}
+
+	if err := CheckNetworkPolicy(urlStr); err != nil {
+		return fmt.Sprintf("Error: %s", err)
+	}
+
+	absPath, err := resolveWorkspacePath(path)
+	if err != nil {
+		return fmt.Sprintf("Error: %s", err)
+	}
+
+	autoApprove := IsAutoApprove()
+	if !autoApprove {
+		if decideApproval(approveDownload) == denyAction {
+			return approvalDenial(approveDownload)
+		}
+		fmt.Printf("Need to download %s to %s\nContinue? (y/n): ",
+			utils.ColoredText(urlStr, utils.ColorYellow), utils.ColoredText(path, utils.ColorGreen))
+		var response string
+		fmt.Fscanln(Input, &response)
+		if strings.ToLower(response) != "y" {
+			return "Download cancelled"
+		}
+	}
+
+	client := &http.Client{
+		Timeout: 10 * time.Minute,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return fmt.Errorf("stopped after 10 redirects")
+			}
+			// Redirects may lead to a different host, which must be allowed as well
+			return CheckNetworkPolicy(req.URL.String())
+		},
+	}
+	resp, err := client.Get(urlStr)
+	if err != nil {
+		return fmt.Sprintf("Error downloading file: %s", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Sprintf("Error downloading file: HTTP status code %d", resp.StatusCode)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(absPath), 0755); err != nil {
+		return fmt.Sprintf("Error creating directory: %s", err)
+	}
+
+	// Stream to a temporary file next to the destination so a failed download never leaves a partial file
+	tmpFile, err := os.CreateTemp(filepath.Dir(absPath), ".nca-download-*")
+	if err != nil {
+		return fmt.Sprintf("Error creating file: %s", err)
+	}
+	tmpPath := tmpFile.Name()
+	defer os.Remove(tmpPath)
+
+	hash := sha256.New()
+	progress := &progressWriter{total: resp.ContentLength}
+	size, err := io.Copy(io.MultiWriter(tmpFile, hash, progress), resp.Body)
+	closeErr := tmpFile.Close()
+	if !utils.IsOutputPiped() {
+		fmt.Print("\r\033[K")
+	}
+	if err != nil {
+		return fmt.Sprintf("Error downloading file: %s", err)
+	}
+	if closeErr != nil {
+		return fmt.Sprintf("Error writing file: %s", closeErr)
+	}
+
+	actualSum := hex.EncodeToString(hash.Sum(nil))
+	if expectedSum != "" && actualSum != expectedSum {
+		return fmt.Sprintf("Error: Checksum mismatch for %s: expected sha256 %s, got %s. The file was not saved.", urlStr, expectedSum, actualSum)
+	}
+
+	if err := os.Chmod(tmpPath, 0644); err != nil {
+		return fmt.Sprintf("Error writing file: %s", err)
+	}
+	if err := os.Rename(tmpPath, absPath); err != nil {
+		return fmt.Sprintf("Error writing file: %s", err)
+	}
+
+	result := fmt.Sprintf("File successfully downloaded: %s (%s, sha256 %s)", path, utils.FormatSize(size), actualSum)
+	if expectedSum != "" {
+		result += "\nChecksum verified"
+	}
+	return result
+}
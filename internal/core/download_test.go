@@ -0,0 +1,83 @@
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/pederhe/nca/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDownloadFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(originalDir)
+	os.Chdir(tmpDir)
+	t.Setenv("HOME", t.TempDir())
+	trustWorkspace(t)
+
+	assert.NoError(t, config.Set("auto_approve", "true", false))
+
+	payload := []byte("downloaded file content")
+	sum := sha256.Sum256(payload)
+	checksum := hex.EncodeToString(sum[:])
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(payload)
+	}))
+	defer server.Close()
+
+	// Missing parameters
+	assert.Contains(t, DownloadFile(map[string]interface{}{"path": "a.txt"}), "Error")
+	assert.Contains(t, DownloadFile(map[string]interface{}{"url": server.URL}), "Error")
+
+	// Successful download with checksum verification
+	result := DownloadFile(map[string]interface{}{
+		"url":    server.URL + "/file",
+		"path":   "downloads/file.txt",
+		"sha256": checksum,
+	})
+	assert.Contains(t, result, "File successfully downloaded")
+	assert.Contains(t, result, "Checksum verified")
+	content, err := os.ReadFile("downloads/file.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, payload, content)
+
+	// Checksum mismatch does not leave a file behind
+	result = DownloadFile(map[string]interface{}{
+		"url":    server.URL + "/file",
+		"path":   "bad.txt",
+		"sha256": hex.EncodeToString(make([]byte, sha256.Size)),
+	})
+	assert.Contains(t, result, "Checksum mismatch")
+	_, err = os.Stat("bad.txt")
+	assert.True(t, os.IsNotExist(err))
+
+	// Invalid checksum format
+	result = DownloadFile(map[string]interface{}{"url": server.URL, "path": "x.txt", "sha256": "abc"})
+	assert.Contains(t, result, "Invalid sha256")
+
+	// Destination outside the workspace
+	result = DownloadFile(map[string]interface{}{"url": server.URL, "path": "../outside.txt"})
+	assert.Contains(t, result, "outside the workspace")
+
+	// HTTP errors
+	result = DownloadFile(map[string]interface{}{"url": server.URL + "/missing", "path": "missing.txt"})
+	assert.Contains(t, result, "404")
+
+	// Network policy is enforced
+	assert.NoError(t, config.Set("network_access", "off", false))
+	result = DownloadFile(map[string]interface{}{"url": server.URL, "path": "blocked.txt"})
+	assert.Contains(t, result, "network access is disabled")
+}
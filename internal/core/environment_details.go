@@ -0,0 +1,82 @@
+package core
+
+import (
+	"strings"
+	"sync"
+)
+
+// EnvironmentSection is a titled part of the environment details sent with user messages
+type EnvironmentSection struct {
+	Title   string
+	Content string
+}
+
+// The sections sent with the previous user message, nil if the next message starts a task
+var (
+	lastEnvironmentSections []EnvironmentSection
+	environmentMutex        sync.Mutex
+)
+
+// ResetEnvironmentDetails makes the next user message carry all sections again, e.g. when the
+// conversation is cleared or a message it was compared against is discarded
+func ResetEnvironmentDetails() {
+	environmentMutex.Lock()
+	defer environmentMutex.Unlock()
+	lastEnvironmentSections = nil
+}
+
+// FormatEnvironmentDetails returns the environment details of a user message. The first message of
+// a task gets all sections, later messages only the sections that changed or no longer apply since
+// the previous message, or nothing if none did.
+func FormatEnvironmentDetails(sections []EnvironmentSection) string {
+	environmentMutex.Lock()
+	defer environmentMutex.Unlock()
+
+	previous := lastEnvironmentSections
+	lastEnvironmentSections = append([]EnvironmentSection{}, sections...)
+	if previous == nil {
+		return wrapEnvironmentDetails(sections)
+	}
+
+	previousContent := make(map[string]string, len(previous))
+	for _, section := range previous {
+		previousContent[section.Title] = section.Content
+	}
+
+	var changed []EnvironmentSection
+	for _, section := range sections {
+		if content, ok := previousContent[section.Title]; !ok || content != section.Content {
+			changed = append(changed, section)
+		}
+		delete(previousContent, section.Title)
+	}
+	// Keep the order of the previous message for the sections that were removed
+	for _, section := range previous {
+		if _, removed := previousContent[section.Title]; removed {
+			changed = append(changed, EnvironmentSection{Title: section.Title, Content: "(no longer applies)"})
+		}
+	}
+	if len(changed) == 0 {
+		return ""
+	}
+
+	return wrapEnvironmentDetails(append([]EnvironmentSection{{
+		Title:   "Changes",
+		Content: "Only the sections that changed since the previous message are listed, the others still apply.",
+	}}, changed...))
+}
+
+// FormatFullEnvironmentDetails returns all sections as environment details without recording them,
+// for a conversation other than the one of the current task
+func FormatFullEnvironmentDetails(sections []EnvironmentSection) string {
+	return wrapEnvironmentDetails(sections)
+}
+
+// wrapEnvironmentDetails formats sections as an environment_details block
+func wrapEnvironmentDetails(sections []EnvironmentSection) string {
+	var details strings.Builder
+	for _, section := range sections {
+		details.WriteString("\n# " + section.Title + "\n" + section.Content + "\n")
+	}
+	return "\n\n<environment_details>\n" + details.String() + "\n</environment_details>"
+}
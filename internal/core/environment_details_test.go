@@ -0,0 +1,44 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatEnvironmentDetails(t *testing.T) {
+	defer ResetEnvironmentDetails()
+	ResetEnvironmentDetails()
+	sections := []EnvironmentSection{
+		{Title: "Current Mode", Content: "AGENT MODE"},
+		{Title: "Preferred Language", Content: "Speak in English"},
+	}
+
+	// The first message of a task gets all sections
+	details := FormatEnvironmentDetails(sections)
+	assert.Equal(t, "\n\n<environment_details>\n\n# Current Mode\nAGENT MODE\n\n# Preferred Language\nSpeak in English\n\n</environment_details>", details)
+
+	// Nothing is sent while nothing changes
+	assert.Empty(t, FormatEnvironmentDetails(sections))
+
+	details = FormatEnvironmentDetails([]EnvironmentSection{
+		{Title: "Current Mode", Content: "ASK MODE"},
+		{Title: "Preferred Language", Content: "Speak in English"},
+		{Title: "Plan Mode", Content: "Changes are planned"},
+	})
+	assert.Contains(t, details, "# Changes\n")
+	assert.Contains(t, details, "# Current Mode\nASK MODE\n")
+	assert.Contains(t, details, "# Plan Mode\nChanges are planned\n")
+	assert.NotContains(t, details, "Preferred Language")
+
+	// Removed sections are reported once
+	details = FormatEnvironmentDetails([]EnvironmentSection{
+		{Title: "Current Mode", Content: "ASK MODE"},
+		{Title: "Preferred Language", Content: "Speak in English"},
+	})
+	assert.Contains(t, details, "# Plan Mode\n(no longer applies)\n")
+	assert.NotContains(t, details, "Current Mode")
+
+	ResetEnvironmentDetails()
+	assert.Contains(t, FormatEnvironmentDetails(sections), "# Preferred Language\n")
+}
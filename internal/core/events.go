@@ -0,0 +1,62 @@
+package core
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/pederhe/nca/pkg/utils"
+)
+
+// EventWriter writes the progress of a one-off query as JSON lines, one event per line, so
+// `nca -p --output json` can be used from scripts and CI pipelines. Each event has a "type"
+// field: "assistant", "tool_call", "tool_result", "usage", "result" or "error".
+type EventWriter struct {
+	encoder *json.Encoder
+	mutex   sync.Mutex
+}
+
+// NewEventWriter creates an event writer that writes to w
+func NewEventWriter(w io.Writer) *EventWriter {
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	return &EventWriter{encoder: encoder}
+}
+
+// Emit writes an event with the given fields. Text fields are written without ANSI colors.
+func (w *EventWriter) Emit(eventType string, fields map[string]interface{}) {
+	event := map[string]interface{}{"type": eventType}
+	for key, value := range fields {
+		if text, ok := value.(string); ok {
+			value = utils.StripANSI(text)
+		}
+		event[key] = value
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.encoder.Encode(event)
+}
+
+// ToolCallParams returns the parameters of a tool use request without the fields added by the parser
+func ToolCallParams(toolUse map[string]interface{}) map[string]interface{} {
+	params := map[string]interface{}{}
+	for key, value := range toolUse {
+		if key == "tool" || key == "has_multiple_tools" {
+			continue
+		}
+		params[key] = value
+	}
+	return params
+}
+
+// AssistantText returns the text of an XML mode response before its tool use block
+func AssistantText(content string, toolName string) string {
+	if toolName != "" {
+		if idx := strings.Index(content, "<"+toolName+">"); idx >= 0 {
+			content = content[:idx]
+		}
+	}
+	return strings.TrimSpace(content)
+}
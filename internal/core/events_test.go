@@ -0,0 +1,48 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventWriter(t *testing.T) {
+	var buffer bytes.Buffer
+	writer := NewEventWriter(&buffer)
+
+	writer.Emit("tool_result", map[string]interface{}{"tool": "replace_in_file", "result": "\033[32m+added <line>\033[0m"})
+	writer.Emit("result", map[string]interface{}{"text": "Done", "files_changed": []string{"main.go"}})
+
+	lines := strings.Split(strings.TrimSpace(buffer.String()), "\n")
+	require.Len(t, lines, 2)
+	assert.Contains(t, lines[0], "<line>", "HTML characters are not escaped")
+
+	var event map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &event))
+	assert.Equal(t, "tool_result", event["type"])
+	assert.Equal(t, "+added <line>", event["result"])
+
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &event))
+	assert.Equal(t, "result", event["type"])
+	assert.Equal(t, []interface{}{"main.go"}, event["files_changed"])
+}
+
+func TestToolCallParams(t *testing.T) {
+	params := ToolCallParams(map[string]interface{}{
+		"tool":               "read_file",
+		"path":               "main.go",
+		"has_multiple_tools": true,
+	})
+	assert.Equal(t, map[string]interface{}{"path": "main.go"}, params)
+}
+
+func TestAssistantText(t *testing.T) {
+	content := "I'll read the file.\n\n<read_file>\n<path>main.go</path>\n</read_file>"
+	assert.Equal(t, "I'll read the file.", AssistantText(content, "read_file"))
+	assert.Equal(t, "", AssistantText("<read_file><path>a</path></read_file>", "read_file"))
+	assert.Equal(t, "Final answer", AssistantText(" Final answer\n", ""))
+}
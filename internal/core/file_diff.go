@@ -0,0 +1,143 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// GetFileDiff returns the unified diff of a file in the working tree against HEAD or another
+// commit, so the model can review changes without running git itself. Binary files are only
+// reported as changed, large diffs are limited like other tool results.
+func GetFileDiff(params map[string]interface{}) string {
+	path, ok := params["path"].(string)
+	if !ok || path == "" {
+		return "Error: Missing path parameter"
+	}
+	base, _ := params["base"].(string)
+	base = strings.TrimSpace(base)
+	if base == "" {
+		base = "HEAD"
+	}
+	// A base starting with - would be passed to git as an option
+	if strings.HasPrefix(base, "-") {
+		return fmt.Sprintf("Error: Invalid base %s", base)
+	}
+
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Sprintf("Error: %s", err)
+	}
+	// Run git in the directory of the file so files of other repositories work too
+	dir := filepath.Dir(absPath)
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		dir = GetWorkingDir()
+	}
+
+	if _, err := runGit(dir, "rev-parse", "--is-inside-work-tree"); err != nil {
+		return fmt.Sprintf("Error: %s is not inside a git repository", path)
+	}
+	if _, err := runGit(dir, "rev-parse", "--verify", "--quiet", base+"^{commit}"); err != nil {
+		return fmt.Sprintf("Error: %s is not a commit of the repository", base)
+	}
+
+	// Files git doesn't know yet are compared against an empty file
+	_, fileErr := os.Stat(absPath)
+	_, untrackedErr := runGit(dir, "ls-files", "--error-unmatch", "--", absPath)
+	untracked := untrackedErr != nil
+	if untracked && fileErr != nil {
+		if _, err := runGit(dir, "cat-file", "-e", base+":./"+filepath.Base(absPath)); err != nil {
+			return fmt.Sprintf("Error: File not found: %s", path)
+		}
+		// Deleted and no longer in the index, but still in the base commit
+		untracked = false
+	}
+
+	diffArgs := []string{"diff", "--no-color", "--no-ext-diff"}
+	if untracked {
+		diffArgs = append(diffArgs, "--no-index", "--", os.DevNull, absPath)
+	} else {
+		diffArgs = append(diffArgs, base, "--", absPath)
+	}
+
+	numstat, err := runGitDiff(dir, untracked, append([]string{diffArgs[0], "--numstat"}, diffArgs[1:]...)...)
+	if err != nil {
+		return fmt.Sprintf("Error getting diff of %s: %s", path, err)
+	}
+	if strings.TrimSpace(numstat) == "" {
+		return fmt.Sprintf("No changes in %s compared to %s", path, base)
+	}
+	// Binary files are listed with - instead of line counts
+	if strings.HasPrefix(numstat, "-\t-\t") {
+		return fmt.Sprintf("Binary file %s differs from %s, its diff is not shown", path, base)
+	}
+
+	diff, err := runGitDiff(dir, untracked, diffArgs...)
+	if err != nil {
+		return fmt.Sprintf("Error getting diff of %s: %s", path, err)
+	}
+	if untracked {
+		return fmt.Sprintf("%s is a new file that isn't tracked by git yet:\n\n%s", path, diff)
+	}
+	return fmt.Sprintf("Diff of %s against %s:\n\n%s", path, base, diff)
+}
+
+// runGit runs a git command in dir and returns its output
+func runGit(dir string, args ...string) (string, error) {
+	return runGitEnv(dir, nil, args...)
+}
+
+// runGitEnv runs a git command in dir with additional environment variables
+func runGitEnv(dir string, env []string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	output, err := cmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+			return "", fmt.Errorf("%s", strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return "", err
+	}
+	return string(output), nil
+}
+
+// runGitInput runs a git command in dir that reads input from stdin, like git apply
+func runGitInput(dir string, input string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Stdin = strings.NewReader(input)
+	output, err := cmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+			return "", fmt.Errorf("%s", strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return "", err
+	}
+	return string(output), nil
+}
+
+// runGitDiff runs git diff, with --no-index exit status 1 only means the files differ
+func runGitDiff(dir string, noIndex bool, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	output, err := cmd.Output()
+	var exitErr *exec.ExitError
+	if noIndex && errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+		return string(output), nil
+	}
+	if err != nil {
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+			return "", fmt.Errorf("%s", strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return "", err
+	}
+	return string(output), nil
+}
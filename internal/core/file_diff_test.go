@@ -0,0 +1,83 @@
+package core
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// initGitRepo creates a git repository with one commit of the given files
+func initGitRepo(t *testing.T, files map[string]string) string {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := t.TempDir()
+	for name, content := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	}
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"add", "-A"},
+		{"-c", "user.name=Test", "-c", "user.email=test@example.com", "commit", "-q", "-m", "Initial commit"},
+	} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		output, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(output))
+	}
+	return dir
+}
+
+func TestGetFileDiff(t *testing.T) {
+	dir := initGitRepo(t, map[string]string{
+		"main.go":   "package main\n\nfunc main() {}\n",
+		"same.txt":  "unchanged\n",
+		"image.bin": "\x00\x01\x02",
+	})
+	path := filepath.Join(dir, "main.go")
+	require.NoError(t, os.WriteFile(path, []byte("package main\n\nfunc main() {\n\tprintln(\"hi\")\n}\n"), 0644))
+
+	result := GetFileDiff(map[string]interface{}{"path": path})
+	assert.Contains(t, result, "Diff of "+path+" against HEAD")
+	assert.Contains(t, result, "-func main() {}")
+	assert.Contains(t, result, "+\tprintln(\"hi\")")
+
+	result = GetFileDiff(map[string]interface{}{"path": filepath.Join(dir, "same.txt")})
+	assert.Contains(t, result, "No changes in")
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "image.bin"), []byte("\x00\x03"), 0644))
+	result = GetFileDiff(map[string]interface{}{"path": filepath.Join(dir, "image.bin")})
+	assert.Contains(t, result, "Binary file")
+
+	// Deleted files show what was removed
+	require.NoError(t, os.Remove(filepath.Join(dir, "same.txt")))
+	result = GetFileDiff(map[string]interface{}{"path": filepath.Join(dir, "same.txt")})
+	assert.Contains(t, result, "-unchanged")
+}
+
+func TestGetFileDiffUntracked(t *testing.T) {
+	dir := initGitRepo(t, map[string]string{"main.go": "package main\n"})
+	path := filepath.Join(dir, "new.go")
+	require.NoError(t, os.WriteFile(path, []byte("package main\n\nvar x = 1\n"), 0644))
+
+	result := GetFileDiff(map[string]interface{}{"path": path})
+	assert.Contains(t, result, "is a new file that isn't tracked by git yet")
+	assert.Contains(t, result, "+var x = 1")
+}
+
+func TestGetFileDiffErrors(t *testing.T) {
+	dir := initGitRepo(t, map[string]string{"main.go": "package main\n"})
+
+	assert.Equal(t, "Error: Missing path parameter", GetFileDiff(map[string]interface{}{}))
+	assert.Contains(t, GetFileDiff(map[string]interface{}{"path": filepath.Join(dir, "missing.go")}), "Error: File not found")
+	assert.Contains(t, GetFileDiff(map[string]interface{}{"path": filepath.Join(dir, "main.go"), "base": "no-such-branch"}), "is not a commit")
+	assert.Contains(t, GetFileDiff(map[string]interface{}{"path": filepath.Join(dir, "main.go"), "base": "--output=/tmp/x"}), "Error: Invalid base")
+
+	outside := filepath.Join(t.TempDir(), "file.txt")
+	require.NoError(t, os.WriteFile(outside, []byte("text"), 0644))
+	assert.Contains(t, GetFileDiff(map[string]interface{}{"path": outside}), "is not inside a git repository")
+}
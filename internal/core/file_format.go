@@ -0,0 +1,76 @@
+package core
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/pederhe/nca/pkg/config"
+)
+
+// utf8BOM is the byte order mark some editors write at the start of UTF-8 files
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// fileFormat describes the line endings and byte order mark of a text file, so edits
+// keep them instead of rewriting every line of a Windows file
+type fileFormat struct {
+	crlf bool
+	bom  bool
+}
+
+// detectFileFormat detects the format of file content. Files with mixed line endings get
+// the line ending used by most lines.
+func detectFileFormat(content []byte) fileFormat {
+	crlfCount := bytes.Count(content, []byte("\r\n"))
+	lfCount := bytes.Count(content, []byte("\n")) - crlfCount
+	return fileFormat{
+		crlf: crlfCount > 0 && crlfCount >= lfCount,
+		bom:  bytes.HasPrefix(content, utf8BOM),
+	}
+}
+
+// getFileFormat returns the format used to write a file. Existing files keep their format,
+// new files use LF without a BOM. The "line_endings" (lf or crlf) and "utf8_bom" (add or
+// remove) config keys override the format of all written files.
+func getFileFormat(existing []byte, exists bool) fileFormat {
+	var format fileFormat
+	if exists {
+		format = detectFileFormat(existing)
+	}
+
+	switch strings.ToLower(config.Get("line_endings")) {
+	case "lf":
+		format.crlf = false
+	case "crlf":
+		format.crlf = true
+	}
+	switch strings.ToLower(config.Get("utf8_bom")) {
+	case "add":
+		format.bom = true
+	case "remove":
+		format.bom = false
+	}
+	return format
+}
+
+// decode returns the text of file content with LF line endings and without a BOM,
+// which is the form the model reads and writes
+func (f fileFormat) decode(content []byte) string {
+	content = bytes.TrimPrefix(content, utf8BOM)
+	if f.crlf {
+		content = bytes.ReplaceAll(content, []byte("\r\n"), []byte("\n"))
+	}
+	return string(content)
+}
+
+// encode returns the file content of text written by the model
+func (f fileFormat) encode(text string) []byte {
+	text = strings.TrimPrefix(text, string(utf8BOM))
+	if f.crlf {
+		text = strings.ReplaceAll(text, "\r\n", "\n")
+		text = strings.ReplaceAll(text, "\n", "\r\n")
+	}
+	if f.bom {
+		return append(append([]byte{}, utf8BOM...), text...)
+	}
+	return []byte(text)
+}
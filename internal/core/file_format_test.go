@@ -0,0 +1,60 @@
+package core
+
+import (
+	"os"
+	"testing"
+
+	"github.com/pederhe/nca/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetectFileFormat(t *testing.T) {
+	assert.Equal(t, fileFormat{}, detectFileFormat([]byte("a\nb\n")))
+	assert.Equal(t, fileFormat{crlf: true}, detectFileFormat([]byte("a\r\nb\r\n")))
+	assert.Equal(t, fileFormat{crlf: true, bom: true}, detectFileFormat([]byte("\xEF\xBB\xBFa\r\nb\r\nc\n")))
+	assert.Equal(t, fileFormat{}, detectFileFormat([]byte("a\r\nb\nc\n")))
+
+	format := fileFormat{crlf: true, bom: true}
+	assert.Equal(t, "a\nb\n", format.decode([]byte("\xEF\xBB\xBFa\r\nb\r\n")))
+	assert.Equal(t, []byte("\xEF\xBB\xBFa\r\nb\r\n"), format.encode("a\nb\r\n"))
+}
+
+func TestFileToolsPreserveFormat(t *testing.T) {
+	tmpDir := t.TempDir()
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(originalDir)
+	os.Chdir(tmpDir)
+	t.Setenv("HOME", t.TempDir())
+
+	original := "\xEF\xBB\xBFline 1\r\nline 2\r\nline 3\r\n"
+	assert.NoError(t, os.WriteFile("windows.txt", []byte(original), 0644))
+
+	// Replacing a line only changes that line
+	result := ReplaceInFile(map[string]interface{}{
+		"path": "windows.txt",
+		"diff": "<<<<<<< SEARCH\nline 2\n=======\nline two\n>>>>>>> REPLACE",
+	})
+	assert.Contains(t, result, "File successfully updated")
+	assert.Contains(t, result, "-line 2")
+	content, _ := os.ReadFile("windows.txt")
+	assert.Equal(t, "\xEF\xBB\xBFline 1\r\nline two\r\nline 3\r\n", string(content))
+
+	// Overwriting the file keeps its format
+	WriteToFile(map[string]interface{}{"path": "windows.txt", "content": "new 1\nnew 2\n"})
+	content, _ = os.ReadFile("windows.txt")
+	assert.Equal(t, "\xEF\xBB\xBFnew 1\r\nnew 2\r\n", string(content))
+
+	// New files use LF unless the config overrides it
+	WriteToFile(map[string]interface{}{"path": "new.txt", "content": "a\nb\n"})
+	content, _ = os.ReadFile("new.txt")
+	assert.Equal(t, "a\nb\n", string(content))
+
+	assert.NoError(t, config.Set("line_endings", "lf", false))
+	assert.NoError(t, config.Set("utf8_bom", "remove", false))
+	WriteToFile(map[string]interface{}{"path": "windows.txt", "content": "new 1\nnew 2\n"})
+	content, _ = os.ReadFile("windows.txt")
+	assert.Equal(t, "new 1\nnew 2\n", string(content))
+}
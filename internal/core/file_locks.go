@@ -0,0 +1,155 @@
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/pederhe/nca/pkg/config"
+)
+
+// FileLock records which nca instance is editing a file.
+// Locks are stored in .nca/locks of the workspace, one file per locked path.
+type FileLock struct {
+	Path       string    `json:"path"`
+	PID        int       `json:"pid"`
+	AcquiredAt time.Time `json:"acquired_at"`
+}
+
+// Files locked by the current task
+var (
+	taskLockedFiles = map[string]bool{}
+	fileLocksMutex  sync.Mutex
+)
+
+// getLockFilePath returns the lock file of an absolute path
+func getLockFilePath(absPath string) string {
+	sum := sha256.Sum256([]byte(absPath))
+	return filepath.Join(".nca", "locks", hex.EncodeToString(sum[:8])+".lock")
+}
+
+// isProcessAlive returns whether a process with the given pid is running
+func isProcessAlive(pid int) bool {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	// FindProcess only succeeds for running processes on Windows
+	if runtime.GOOS == "windows" {
+		return true
+	}
+	return process.Signal(syscall.Signal(0)) == nil
+}
+
+// readFileLock returns the lock of a file held by another running nca instance, stale locks are ignored
+func readFileLock(lockFile string) *FileLock {
+	data, err := os.ReadFile(lockFile)
+	if err != nil {
+		return nil
+	}
+	var lock FileLock
+	if err := json.Unmarshal(data, &lock); err != nil {
+		return nil
+	}
+	if lock.PID == os.Getpid() || !isProcessAlive(lock.PID) {
+		return nil
+	}
+	return &lock
+}
+
+// getFileLockMode returns how edits of files locked by another instance are handled:
+// "prompt" (default) asks the user, "warn" only prints a warning and "block" refuses the edit
+func getFileLockMode() string {
+	switch mode := strings.ToLower(config.Get("file_lock_mode")); mode {
+	case "warn", "block", "off":
+		return mode
+	default:
+		return "prompt"
+	}
+}
+
+// LockFileForEdit locks a file for the current task before it is modified.
+// If another nca instance in the workspace is editing the same file, the user is warned or asked
+// depending on file_lock_mode. It returns a message if the edit is blocked, otherwise an empty string.
+func LockFileForEdit(path string) string {
+	mode := getFileLockMode()
+	if mode == "off" {
+		return ""
+	}
+
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return ""
+	}
+
+	fileLocksMutex.Lock()
+	defer fileLocksMutex.Unlock()
+
+	if taskLockedFiles[absPath] {
+		return ""
+	}
+
+	lockFile := getLockFilePath(absPath)
+	if owner := readFileLock(lockFile); owner != nil {
+		message := fmt.Sprintf("%s is being edited by another nca instance (pid %d) since %s",
+			path, owner.PID, owner.AcquiredAt.Format("15:04:05"))
+		switch mode {
+		case "warn":
+			fmt.Println("Warning: " + message)
+		case "block":
+			return "Error: " + message + ". Wait until the other task is finished or edit a different file."
+		default:
+			// Edits without a prompt must not overwrite the work of the other instance
+			if IsAutoApprove() {
+				return "Error: " + message + ". Wait until the other task is finished or edit a different file."
+			}
+			if decideApproval(approveLockedEdit) == denyAction {
+				return "Error: " + message + ". Wait until the other task is finished or edit a different file."
+			}
+			fmt.Printf("Warning: %s\nEdit anyway? (y/n): ", message)
+			var response string
+			fmt.Fscanln(Input, &response)
+			if strings.ToLower(response) != "y" {
+				return "Error: The user declined to edit " + path + ", which is being edited by another nca instance"
+			}
+		}
+	}
+
+	// Take over the lock, a lock file that can't be written only disables the check
+	lock := FileLock{Path: absPath, PID: os.Getpid(), AcquiredAt: time.Now()}
+	if data, err := json.Marshal(lock); err == nil {
+		if err := os.MkdirAll(filepath.Dir(lockFile), 0755); err == nil {
+			os.WriteFile(lockFile, data, 0644)
+		}
+	}
+	taskLockedFiles[absPath] = true
+	return ""
+}
+
+// ReleaseFileLocks releases the locks of all files edited by the current task
+func ReleaseFileLocks() {
+	fileLocksMutex.Lock()
+	defer fileLocksMutex.Unlock()
+
+	for absPath := range taskLockedFiles {
+		lockFile := getLockFilePath(absPath)
+		// Don't remove a lock another instance took over after a prompt
+		data, err := os.ReadFile(lockFile)
+		if err != nil {
+			continue
+		}
+		var lock FileLock
+		if json.Unmarshal(data, &lock) == nil && lock.PID == os.Getpid() {
+			os.Remove(lockFile)
+		}
+	}
+	taskLockedFiles = map[string]bool{}
+}
@@ -0,0 +1,64 @@
+package core
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pederhe/nca/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// writeTestLock simulates a lock of another nca instance
+func writeTestLock(t *testing.T, path string, pid int) string {
+	absPath, err := filepath.Abs(path)
+	assert.NoError(t, err)
+	lockFile := getLockFilePath(absPath)
+	data, _ := json.Marshal(FileLock{Path: absPath, PID: pid, AcquiredAt: time.Now()})
+	assert.NoError(t, os.MkdirAll(filepath.Dir(lockFile), 0755))
+	assert.NoError(t, os.WriteFile(lockFile, data, 0644))
+	return lockFile
+}
+
+func TestLockFileForEdit(t *testing.T) {
+	tmpDir := t.TempDir()
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(originalDir)
+	os.Chdir(tmpDir)
+	defer ReleaseFileLocks()
+
+	// A free file is locked by the current instance and released at the end of the task
+	assert.Equal(t, "", LockFileForEdit("main.go"))
+	absPath, _ := filepath.Abs("main.go")
+	lockFile := getLockFilePath(absPath)
+	assert.FileExists(t, lockFile)
+	ReleaseFileLocks()
+	assert.NoFileExists(t, lockFile)
+
+	// Locks of processes that are no longer running are taken over
+	writeTestLock(t, "stale.go", 1<<30)
+	assert.Equal(t, "", LockFileForEdit("stale.go"))
+	ReleaseFileLocks()
+
+	// A lock of another running instance blocks the edit
+	assert.NoError(t, config.Set("file_lock_mode", "block", false))
+	otherLock := writeTestLock(t, "shared.go", os.Getppid())
+	result := LockFileForEdit("shared.go")
+	assert.Contains(t, result, "Error: shared.go is being edited by another nca instance")
+
+	// In warn mode the edit continues and the lock is taken over
+	assert.NoError(t, config.Set("file_lock_mode", "warn", false))
+	assert.Equal(t, "", LockFileForEdit("shared.go"))
+	ReleaseFileLocks()
+	assert.NoFileExists(t, otherLock)
+
+	// Checks can be disabled
+	assert.NoError(t, config.Set("file_lock_mode", "off", false))
+	writeTestLock(t, "shared.go", os.Getppid())
+	assert.Equal(t, "", LockFileForEdit("shared.go"))
+}
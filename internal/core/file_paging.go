@@ -0,0 +1,98 @@
+package core
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/pederhe/nca/pkg/utils"
+)
+
+// maxSuggestedRanges limits the line ranges suggested for the lines left out of a large file
+const maxSuggestedRanges = 15
+
+// maxReadFileChars returns how much of a file read_file returns at once, 0 means all of it. A tenth
+// of the result limit is left for the notices, so the result isn't truncated again.
+func maxReadFileChars() int {
+	return GetToolResultLimit("read_file") * charsPerToken * 9 / 10
+}
+
+// truncateFile returns the first and last lines of a file larger than maxChars, with a notice of
+// the lines left out and the ranges to read them in
+func truncateFile(path string, content string, maxChars int) string {
+	truncated, ok := utils.TruncateMiddle(content, maxChars)
+	if !ok {
+		return content
+	}
+
+	var notice strings.Builder
+	fmt.Fprintf(&notice, "\n[File truncated: lines %d-%d of %d are not shown (%s of %s). Read them with offset and limit, e.g. offset %d and limit %d, or with a range.",
+		truncated.FirstOmittedLine, truncated.LastOmittedLine, truncated.TotalLines,
+		utils.FormatSize(int64(len(content)-len(truncated.Head)-len(truncated.Tail))), utils.FormatSize(int64(len(content))),
+		truncated.FirstOmittedLine, linesPerPage(content, truncated.TotalLines, maxChars))
+	if ranges := definitionRanges(path, content, truncated.FirstOmittedLine, truncated.LastOmittedLine); len(ranges) > 0 {
+		notice.WriteString(" Definitions in the lines not shown:\n")
+		for _, r := range ranges {
+			fmt.Fprintf(&notice, "  %s\n", r)
+		}
+	}
+	notice.WriteString("]\n\n")
+	return truncated.Head + notice.String() + truncated.Tail
+}
+
+// linesPerPage estimates the number of lines of a file that fit in a read_file result
+func linesPerPage(content string, totalLines int, maxChars int) int {
+	lines := maxChars * totalLines / max(len(content), 1)
+	return max(lines, 1)
+}
+
+// definitionRanges returns the definitions of the code between two lines of a file, each with the
+// range of lines up to the next one, like "120-185: func parseHeader(line string)"
+func definitionRanges(path string, content string, firstLine int, lastLine int) []string {
+	ext := filepath.Ext(path)
+	if !isCodeFile(ext) {
+		return nil
+	}
+	lines := strings.Split(content, "\n")
+	type definition struct {
+		line int
+		name string
+	}
+	var definitions []definition
+	for number := firstLine; number <= lastLine && number <= len(lines); number++ {
+		if defs := extractDefinitions(lines[number-1], ext); len(defs) > 0 {
+			definitions = append(definitions, definition{number, defs[0]})
+		}
+	}
+
+	var ranges []string
+	for i, def := range definitions {
+		if i == maxSuggestedRanges {
+			ranges = append(ranges, fmt.Sprintf("... and %d more", len(definitions)-i))
+			break
+		}
+		end := lastLine
+		if i+1 < len(definitions) {
+			end = definitions[i+1].line - 1
+		}
+		ranges = append(ranges, fmt.Sprintf("%d-%d: %s", def.line, end, def.name))
+	}
+	return ranges
+}
+
+// pageFileLines returns the lines from start to end of a file, numbered from 1, as many as fit in
+// maxChars. If lines are left out, a notice tells the offset to continue from, with more set also
+// when lines follow after end.
+func pageFileLines(lines []string, start int, end int, maxChars int, more bool) string {
+	shown := start - 1
+	size := 0
+	for shown < end && (maxChars == 0 || shown == start-1 || size+len(lines[shown])+1 <= maxChars) {
+		size += len(lines[shown]) + 1
+		shown++
+	}
+	result := strings.Join(lines[start-1:shown], "\n")
+	if shown < end || (more && shown < len(lines)) {
+		result += fmt.Sprintf("\n\n[Showing lines %d-%d of %d. Continue with offset %d]", start, shown, len(lines), shown+1)
+	}
+	return result
+}
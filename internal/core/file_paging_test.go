@@ -0,0 +1,64 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/pederhe/nca/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeLargeFile writes a Go file of 100 numbered lines, with a function every 25 lines, and limits
+// read_file results to 200 characters
+func writeLargeFile(t *testing.T) []string {
+	t.Chdir(t.TempDir())
+	require.NoError(t, config.Set("tool_result_limit.read_file", "50", false))
+
+	lines := make([]string, 100)
+	for i := range lines {
+		lines[i] = fmt.Sprintf("// line %d", i+1)
+		if i%25 == 0 {
+			lines[i] = fmt.Sprintf("func f%d() {", i+1)
+		}
+	}
+	require.NoError(t, os.WriteFile("large.go", []byte(strings.Join(lines, "\n")+"\n"), 0644))
+	return lines
+}
+
+func TestReadFileTruncatesLargeFiles(t *testing.T) {
+	lines := writeLargeFile(t)
+
+	result := ReadFile(map[string]interface{}{"path": "large.go"})
+	assert.True(t, strings.HasPrefix(result, strings.Join(lines[:11], "\n")+"\n\n[File truncated: lines 12-95 of 100 are not shown"), result)
+	assert.Contains(t, result, "Read them with offset and limit, e.g. offset 12 and limit 16, or with a range. Definitions in the lines not shown:\n"+
+		"  26-50: func f26()\n  51-75: func f51()\n  76-95: func f76()\n]")
+	assert.True(t, strings.HasSuffix(result, strings.Join(lines[95:], "\n")+"\n"), result)
+
+	// Small files are returned whole
+	require.NoError(t, os.WriteFile("small.go", []byte("package main\n"), 0644))
+	assert.Equal(t, "package main\n", ReadFile(map[string]interface{}{"path": "small.go"}))
+}
+
+func TestReadFilePaging(t *testing.T) {
+	lines := writeLargeFile(t)
+
+	result := ReadFile(map[string]interface{}{"path": "large.go", "offset": "12", "limit": "5"})
+	assert.Equal(t, strings.Join(lines[11:16], "\n")+"\n\n[Showing lines 12-16 of 100. Continue with offset 17]", result)
+
+	// Without a limit as many lines as fit are returned
+	result = ReadFile(map[string]interface{}{"path": "large.go", "offset": "90"})
+	assert.Equal(t, strings.Join(lines[89:], "\n"), result)
+	result = ReadFile(map[string]interface{}{"path": "large.go", "offset": "20"})
+	assert.True(t, strings.HasSuffix(result, "\n\n[Showing lines 20-35 of 100. Continue with offset 36]"), result)
+
+	// Ranges larger than a result are cut too
+	result = ReadFile(map[string]interface{}{"path": "large.go", "range": "1-50"})
+	assert.True(t, strings.HasSuffix(result, "\n\n[Showing lines 1-17 of 100. Continue with offset 18]"), result)
+
+	assert.Equal(t, "Error: offset 101 is past the end of the file (100 lines)", ReadFile(map[string]interface{}{"path": "large.go", "offset": "101"}))
+	assert.Equal(t, "Error: Use either range or offset and limit, not both", ReadFile(map[string]interface{}{"path": "large.go", "range": "1-2", "offset": "1"}))
+	assert.Equal(t, "Error: Invalid limit parameter, expected a positive number", ReadFile(map[string]interface{}{"path": "large.go", "limit": "-1"}))
+}
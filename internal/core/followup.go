@@ -0,0 +1,113 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Maximum number of suggested answers of ask_followup_question
+const maxFollowupOptions = 4
+
+// Suggested answers of the last followup question, used to resolve the next user input
+var (
+	followupOptions      []string
+	followupOptionsMutex sync.Mutex
+)
+
+// parseFollowupOptions validates the options parameter of ask_followup_question.
+// It accepts a JSON array of strings (XML tool protocol) or a list of strings (native tool calling).
+func parseFollowupOptions(value interface{}) ([]string, error) {
+	var options []string
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case []string:
+		options = v
+	case string:
+		if strings.TrimSpace(v) == "" {
+			return nil, nil
+		}
+		if err := json.Unmarshal([]byte(v), &options); err != nil {
+			return nil, fmt.Errorf("options must be a JSON array of strings, e.g. [\"Option 1\", \"Option 2\"]: %s", err)
+		}
+	default:
+		return nil, fmt.Errorf("options must be a JSON array of strings")
+	}
+
+	if len(options) < 2 || len(options) > maxFollowupOptions {
+		return nil, fmt.Errorf("options must contain 2-%d suggested answers, got %d", maxFollowupOptions, len(options))
+	}
+	for i, option := range options {
+		options[i] = strings.TrimSpace(option)
+		if options[i] == "" {
+			return nil, fmt.Errorf("option %d is empty", i+1)
+		}
+	}
+	return options, nil
+}
+
+// FollowupQuestion handles the ask_followup_question tool, suggested answers are kept for the next user input
+func FollowupQuestion(params map[string]interface{}) string {
+	// Get the question from the tool use parameters
+	question, ok := params["question"].(string)
+	if !ok || question == "" {
+		return "Error: No question provided for ask_followup_question tool"
+	}
+
+	options, err := parseFollowupOptions(params["options"])
+	if err != nil {
+		return fmt.Sprintf("Error: Invalid options for ask_followup_question tool: %s", err)
+	}
+
+	followupOptionsMutex.Lock()
+	followupOptions = options
+	followupOptionsMutex.Unlock()
+
+	return ""
+}
+
+// FormatFollowupOptions returns the suggested answers of the last question as a numbered list
+func FormatFollowupOptions() string {
+	followupOptionsMutex.Lock()
+	defer followupOptionsMutex.Unlock()
+
+	if len(followupOptions) == 0 {
+		return ""
+	}
+
+	var builder strings.Builder
+	for i, option := range followupOptions {
+		builder.WriteString(fmt.Sprintf("  %d. %s\n", i+1, option))
+	}
+	builder.WriteString(fmt.Sprintf("Choose 1-%d or type your own answer", len(followupOptions)))
+	return builder.String()
+}
+
+// ResolveFollowupAnswer converts the reply to a question with suggested answers to the
+// format described in the tool documentation. Other input is returned unchanged.
+func ResolveFollowupAnswer(input string) string {
+	followupOptionsMutex.Lock()
+	options := followupOptions
+	followupOptions = nil
+	followupOptionsMutex.Unlock()
+
+	if len(options) == 0 {
+		return input
+	}
+
+	answer := strings.TrimSpace(input)
+	if index, err := strconv.Atoi(answer); err == nil && index >= 1 && index <= len(options) {
+		return fmt.Sprintf("Answer (option %d): %s", index, options[index-1])
+	}
+	return "Answer: " + answer
+}
+
+// ClearFollowupOptions discards the suggested answers of the last question
+func ClearFollowupOptions() {
+	followupOptionsMutex.Lock()
+	followupOptions = nil
+	followupOptionsMutex.Unlock()
+}
@@ -0,0 +1,72 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFollowupQuestionOptions(t *testing.T) {
+	defer ClearFollowupOptions()
+
+	result := FollowupQuestion(map[string]interface{}{
+		"question": "Which database should I use?",
+		"options":  `["PostgreSQL", "SQLite", "MySQL"]`,
+	})
+	assert.Equal(t, "", result)
+	assert.Equal(t, "  1. PostgreSQL\n  2. SQLite\n  3. MySQL\nChoose 1-3 or type your own answer", FormatFollowupOptions())
+
+	assert.Equal(t, "Answer (option 2): SQLite", ResolveFollowupAnswer(" 2 "))
+	// Options are only used for the reply to the question
+	assert.Equal(t, "", FormatFollowupOptions())
+	assert.Equal(t, "2", ResolveFollowupAnswer("2"))
+}
+
+func TestFollowupQuestionFreeText(t *testing.T) {
+	defer ClearFollowupOptions()
+
+	// Options from native tool calls are passed as a list
+	FollowupQuestion(map[string]interface{}{
+		"question": "Which database should I use?",
+		"options":  []string{"PostgreSQL", "SQLite"},
+	})
+	assert.Equal(t, "Answer: use DuckDB", ResolveFollowupAnswer("use DuckDB"))
+
+	FollowupQuestion(map[string]interface{}{
+		"question": "Which database should I use?",
+		"options":  `["PostgreSQL", "SQLite"]`,
+	})
+	assert.Equal(t, "Answer: 5", ResolveFollowupAnswer("5"))
+
+	// Without options the input is not changed
+	FollowupQuestion(map[string]interface{}{"question": "Which database should I use?"})
+	assert.Equal(t, "1", ResolveFollowupAnswer("1"))
+}
+
+func TestFollowupQuestionInvalidOptions(t *testing.T) {
+	defer ClearFollowupOptions()
+
+	tests := []struct {
+		name    string
+		options interface{}
+	}{
+		{"invalid JSON", `PostgreSQL, SQLite`},
+		{"not strings", `[1, 2]`},
+		{"too few", `["PostgreSQL"]`},
+		{"too many", `["a", "b", "c", "d", "e"]`},
+		{"empty option", `["PostgreSQL", " "]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := FollowupQuestion(map[string]interface{}{
+				"question": "Which database should I use?",
+				"options":  tt.options,
+			})
+			assert.Contains(t, result, "Error: Invalid options")
+			assert.Equal(t, "", FormatFollowupOptions())
+		})
+	}
+
+	assert.Contains(t, FollowupQuestion(map[string]interface{}{}), "Error: No question provided")
+}
@@ -0,0 +1,355 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Read-only git tools. They run git in the working directory and return a compact summary
+// instead of the raw output, so the model doesn't spend tokens on hints and decorations.
+
+const (
+	// defaultGitLogCount is the number of commits git_log returns by default
+	defaultGitLogCount = 20
+	// maxGitLogCount is the most commits git_log returns
+	maxGitLogCount = 100
+	// maxStatusStashes is the number of stashes listed by git_status
+	maxStatusStashes = 5
+)
+
+// Descriptions of the status letters of git status --porcelain
+var gitStatusNames = map[byte]string{
+	'M': "modified",
+	'T': "type changed",
+	'A': "added",
+	'D': "deleted",
+	'R': "renamed",
+	'C': "copied",
+}
+
+// Status letter pairs of files with merge conflicts
+var gitConflictStatuses = map[string]bool{"DD": true, "AU": true, "UD": true, "UA": true, "DU": true, "AA": true, "UU": true}
+
+// checkGitRepository returns an error result if dir is not inside a git repository
+func checkGitRepository(dir string) string {
+	if _, err := runGit(dir, "rev-parse", "--is-inside-work-tree"); err != nil {
+		return fmt.Sprintf("Error: %s is not inside a git repository", dir)
+	}
+	return ""
+}
+
+// GitStatus handles the git_status tool: it returns the branch and the staged, unstaged,
+// untracked and conflicting files
+func GitStatus(params map[string]interface{}) string {
+	dir := GetWorkingDir()
+	if result := checkGitRepository(dir); result != "" {
+		return result
+	}
+
+	args := []string{"-c", "core.quotepath=off", "status", "--porcelain=v1", "--branch", "--untracked-files=all"}
+	if path, _ := params["path"].(string); strings.TrimSpace(path) != "" {
+		args = append(args, "--", strings.TrimSpace(path))
+	}
+	output, err := runGit(dir, args...)
+	if err != nil {
+		return fmt.Sprintf("Error getting git status: %s", err)
+	}
+
+	var branch string
+	var staged, unstaged, untracked, conflicts []string
+	for _, line := range strings.Split(output, "\n") {
+		if strings.HasPrefix(line, "## ") {
+			branch = describeStatusBranch(strings.TrimPrefix(line, "## "))
+			continue
+		}
+		if len(line) < 4 {
+			continue
+		}
+		code, path := line[:2], line[3:]
+		switch {
+		case code == "??":
+			untracked = append(untracked, path)
+		case gitConflictStatuses[code]:
+			conflicts = append(conflicts, path)
+		default:
+			if name, ok := gitStatusNames[code[0]]; ok {
+				staged = append(staged, name+": "+path)
+			}
+			if name, ok := gitStatusNames[code[1]]; ok {
+				unstaged = append(unstaged, name+": "+path)
+			}
+		}
+	}
+
+	var result strings.Builder
+	result.WriteString(branch + "\n")
+	if operation := gitOperationInProgress(dir); operation != "" {
+		result.WriteString(operation + " in progress\n")
+	}
+	if len(staged)+len(unstaged)+len(untracked)+len(conflicts) == 0 {
+		result.WriteString("\nWorking tree clean\n")
+	}
+	writeStatusSection(&result, "Conflicts", conflicts)
+	writeStatusSection(&result, "Staged", staged)
+	writeStatusSection(&result, "Unstaged", unstaged)
+	writeStatusSection(&result, "Untracked", untracked)
+
+	// Stashes are easy to forget, mention them so the model doesn't lose work
+	if stashes, err := runGit(dir, "stash", "list", "--format=%gd: %s"); err == nil && strings.TrimSpace(stashes) != "" {
+		lines := strings.Split(strings.TrimSpace(stashes), "\n")
+		shown := lines
+		if len(shown) > maxStatusStashes {
+			shown = shown[:maxStatusStashes]
+		}
+		fmt.Fprintf(&result, "\nStashes (%d):\n  %s\n", len(lines), strings.Join(shown, "\n  "))
+		if len(lines) > len(shown) {
+			fmt.Fprintf(&result, "  ... and %d more\n", len(lines)-len(shown))
+		}
+	}
+	return strings.TrimRight(result.String(), "\n")
+}
+
+// describeStatusBranch describes the branch header of git status --porcelain --branch, like
+// "main...origin/main [ahead 1, behind 2]"
+func describeStatusBranch(header string) string {
+	if strings.HasPrefix(header, "No commits yet on ") {
+		return "On branch " + strings.TrimPrefix(header, "No commits yet on ") + ", no commits yet"
+	}
+	if strings.HasPrefix(header, "HEAD (no branch)") {
+		return "HEAD detached, not on a branch"
+	}
+	header, track, _ := strings.Cut(header, " [")
+	local, upstream, _ := strings.Cut(header, "...")
+	description := "On branch " + local
+	if upstream != "" {
+		description += ", tracking " + upstream
+	}
+	if track = strings.TrimSuffix(track, "]"); track != "" {
+		description += " (" + track + ")"
+	}
+	return description
+}
+
+// gitOperationInProgress returns the merge, rebase, cherry-pick or revert that is in progress
+func gitOperationInProgress(dir string) string {
+	for _, operation := range []struct{ ref, name string }{
+		{"MERGE_HEAD", "Merge"},
+		{"CHERRY_PICK_HEAD", "Cherry-pick"},
+		{"REVERT_HEAD", "Revert"},
+		{"REBASE_HEAD", "Rebase"},
+	} {
+		if _, err := runGit(dir, "rev-parse", "--verify", "--quiet", operation.ref); err == nil {
+			return operation.name
+		}
+	}
+	return ""
+}
+
+// writeStatusSection writes a list of files of git_status, limited like other listings
+func writeStatusSection(result *strings.Builder, title string, files []string) {
+	if len(files) == 0 {
+		return
+	}
+	fmt.Fprintf(result, "\n%s (%d):\n", title, len(files))
+	limit := getMaxResultEntries()
+	for i, file := range files {
+		if i == limit {
+			fmt.Fprintf(result, "  ... and %d more\n", len(files)-limit)
+			break
+		}
+		result.WriteString("  " + file + "\n")
+	}
+}
+
+// GitDiff handles the git_diff tool: it returns the changed files with their line counts
+// followed by the diff. The diff is against HEAD by default, so it covers staged and unstaged
+// changes, large diffs are limited like other tool results.
+func GitDiff(params map[string]interface{}) string {
+	dir := GetWorkingDir()
+	if result := checkGitRepository(dir); result != "" {
+		return result
+	}
+
+	base, _ := params["base"].(string)
+	base = strings.TrimSpace(base)
+	staged, _ := params["staged"].(bool)
+	// A base starting with - would be passed to git as an option
+	if strings.HasPrefix(base, "-") {
+		return fmt.Sprintf("Error: Invalid base %s", base)
+	}
+
+	args := []string{"-c", "core.quotepath=off", "diff", "--no-color", "--no-ext-diff"}
+	var description string
+	switch {
+	case strings.Contains(base, ".."):
+		args = append(args, base)
+		description = "the commits " + base
+	case staged:
+		if base == "" {
+			base = "HEAD"
+		}
+		args = append(args, "--cached", base)
+		description = "the staged changes against " + base
+	default:
+		if base == "" {
+			base = "HEAD"
+		}
+		args = append(args, base)
+		description = "the working tree against " + base
+	}
+	if !strings.Contains(base, "..") {
+		if _, err := runGit(dir, "rev-parse", "--verify", "--quiet", base+"^{commit}"); err != nil {
+			return fmt.Sprintf("Error: %s is not a commit of the repository", base)
+		}
+	}
+	args = append(args, "--")
+	if path, _ := params["path"].(string); strings.TrimSpace(path) != "" {
+		args = append(args, strings.TrimSpace(path))
+		description += " in " + strings.TrimSpace(path)
+	}
+
+	numstat, err := runGit(dir, append([]string{args[0], args[1], args[2], "--numstat"}, args[3:]...)...)
+	if err != nil {
+		return fmt.Sprintf("Error getting diff: %s", err)
+	}
+	if strings.TrimSpace(numstat) == "" {
+		return fmt.Sprintf("No changes in %s. Untracked files are not included, git_status lists them.", description)
+	}
+	diff, err := runGit(dir, args...)
+	if err != nil {
+		return fmt.Sprintf("Error getting diff: %s", err)
+	}
+
+	var files []string
+	added, deleted := 0, 0
+	for _, line := range strings.Split(strings.TrimSpace(numstat), "\n") {
+		fields := strings.SplitN(line, "\t", 3)
+		if len(fields) < 3 {
+			continue
+		}
+		// Binary files are listed with - instead of line counts
+		if fields[0] == "-" {
+			files = append(files, fields[2]+" (binary)")
+			continue
+		}
+		var fileAdded, fileDeleted int
+		fmt.Sscanf(fields[0], "%d", &fileAdded)
+		fmt.Sscanf(fields[1], "%d", &fileDeleted)
+		added += fileAdded
+		deleted += fileDeleted
+		files = append(files, fmt.Sprintf("%s (+%d -%d)", fields[2], fileAdded, fileDeleted))
+	}
+
+	var result strings.Builder
+	fmt.Fprintf(&result, "Diff of %s\n\nChanged files (%d, +%d -%d):\n", description, len(files), added, deleted)
+	for _, file := range files {
+		result.WriteString("  " + file + "\n")
+	}
+	result.WriteString("\n" + diff)
+	return strings.TrimRight(result.String(), "\n")
+}
+
+// GitLog handles the git_log tool: it returns recent commits, one line each
+func GitLog(params map[string]interface{}) string {
+	dir := GetWorkingDir()
+	if result := checkGitRepository(dir); result != "" {
+		return result
+	}
+
+	count, err := getOptionalIntParam(params, "count", maxGitLogCount)
+	if err != nil {
+		return fmt.Sprintf("Error: %s", err)
+	}
+	if count == 0 {
+		count = defaultGitLogCount
+	}
+	ref, _ := params["ref"].(string)
+	ref = strings.TrimSpace(ref)
+	if strings.HasPrefix(ref, "-") {
+		return fmt.Sprintf("Error: Invalid ref %s", ref)
+	}
+	if ref == "" {
+		ref = "HEAD"
+	}
+
+	args := []string{"log", fmt.Sprintf("-%d", count), "--date=short", "--format=%h %ad %an: %s", ref, "--"}
+	description := ref
+	if path, _ := params["path"].(string); strings.TrimSpace(path) != "" {
+		args = append(args, strings.TrimSpace(path))
+		description += " touching " + strings.TrimSpace(path)
+	}
+	output, err := runGit(dir, args...)
+	if err != nil {
+		return fmt.Sprintf("Error getting log of %s: %s", ref, err)
+	}
+	output = strings.TrimSpace(output)
+	if output == "" {
+		return fmt.Sprintf("No commits in %s", description)
+	}
+	commits := strings.Count(output, "\n") + 1
+	result := fmt.Sprintf("Commits of %s, newest first:\n%s", description, output)
+	if commits == count {
+		result += fmt.Sprintf("\n[Only the last %d commits are shown, use count for more]", count)
+	}
+	return result
+}
+
+// GitBranch handles the git_branch tool: it lists the branches, the current one first, with
+// their upstream and last commit
+func GitBranch(params map[string]interface{}) string {
+	dir := GetWorkingDir()
+	if result := checkGitRepository(dir); result != "" {
+		return result
+	}
+
+	refs := []string{"refs/heads"}
+	if all, _ := params["all"].(bool); all {
+		refs = append(refs, "refs/remotes")
+	}
+	format := "%(HEAD)%00%(refname:short)%00%(upstream:short)%00%(upstream:track)%00%(committerdate:short)%00%(subject)"
+	output, err := runGit(dir, append([]string{"for-each-ref", "--sort=-committerdate", "--format=" + format}, refs...)...)
+	if err != nil {
+		return fmt.Sprintf("Error listing branches: %s", err)
+	}
+
+	var current string
+	var branches []string
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		fields := strings.Split(line, "\x00")
+		if len(fields) < 6 || strings.HasSuffix(fields[1], "/HEAD") {
+			continue
+		}
+		branch := fields[1]
+		if fields[2] != "" {
+			branch += " -> " + fields[2]
+		}
+		if fields[3] != "" {
+			branch += " " + fields[3]
+		}
+		branch += fmt.Sprintf(", %s %s", fields[4], fields[5])
+		if fields[0] == "*" {
+			current = branch
+			continue
+		}
+		branches = append(branches, branch)
+	}
+	if current == "" && len(branches) == 0 {
+		return "No branches yet, the repository has no commits"
+	}
+
+	var result strings.Builder
+	if current != "" {
+		result.WriteString("* " + current + "\n")
+	} else {
+		result.WriteString("HEAD detached, not on a branch\n")
+	}
+	limit := getMaxResultEntries()
+	for i, branch := range branches {
+		if i == limit {
+			fmt.Fprintf(&result, "  ... and %d more\n", len(branches)-limit)
+			break
+		}
+		result.WriteString("  " + branch + "\n")
+	}
+	return strings.TrimRight(result.String(), "\n")
+}
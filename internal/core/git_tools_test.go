@@ -0,0 +1,106 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGitStatus(t *testing.T) {
+	dir := initGitRepo(t, map[string]string{"a.txt": "a\n", "b.txt": "b\n"})
+	t.Chdir(dir)
+
+	assert.Contains(t, GitStatus(map[string]interface{}{}), "Working tree clean")
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.txt"), []byte("changed\n"), 0644))
+	require.NoError(t, os.Remove(filepath.Join(dir, "b.txt")))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "new.txt"), []byte("new\n"), 0644))
+	git(dir, "rm", "-q", "b.txt")
+
+	result := GitStatus(map[string]interface{}{})
+	assert.Contains(t, result, "On branch ")
+	assert.Contains(t, result, "Staged (1):\n  deleted: b.txt")
+	assert.Contains(t, result, "Unstaged (1):\n  modified: a.txt")
+	assert.Contains(t, result, "Untracked (1):\n  new.txt")
+
+	// Limited to a path
+	result = GitStatus(map[string]interface{}{"path": "a.txt"})
+	assert.NotContains(t, result, "new.txt")
+	assert.Contains(t, result, "a.txt")
+}
+
+func TestDescribeStatusBranch(t *testing.T) {
+	assert.Equal(t, "On branch main, tracking origin/main (ahead 1, behind 2)", describeStatusBranch("main...origin/main [ahead 1, behind 2]"))
+	assert.Equal(t, "On branch feature", describeStatusBranch("feature"))
+	assert.Equal(t, "On branch main, no commits yet", describeStatusBranch("No commits yet on main"))
+	assert.Equal(t, "HEAD detached, not on a branch", describeStatusBranch("HEAD (no branch)"))
+}
+
+func TestGitDiff(t *testing.T) {
+	dir := initGitRepo(t, map[string]string{"a.txt": "one\ntwo\n", "b.txt": "b\n"})
+	t.Chdir(dir)
+
+	assert.Contains(t, GitDiff(map[string]interface{}{}), "No changes in the working tree against HEAD")
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.txt"), []byte("one\n2\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "b.txt"), []byte("b\nc\n"), 0644))
+	git(dir, "add", "b.txt")
+
+	result := GitDiff(map[string]interface{}{})
+	assert.Contains(t, result, "Diff of the working tree against HEAD\n\nChanged files (2, +2 -1):\n  a.txt (+1 -1)\n  b.txt (+1 -0)")
+	assert.Contains(t, result, "+2")
+
+	result = GitDiff(map[string]interface{}{"staged": true})
+	assert.Contains(t, result, "Diff of the staged changes against HEAD\n\nChanged files (1, +1 -0)")
+	assert.NotContains(t, result, "a.txt")
+
+	result = GitDiff(map[string]interface{}{"path": "a.txt"})
+	assert.Contains(t, result, "Diff of the working tree against HEAD in a.txt\n\nChanged files (1, +1 -1)")
+
+	assert.Contains(t, GitDiff(map[string]interface{}{"base": "no-such-branch"}), "is not a commit")
+	assert.Contains(t, GitDiff(map[string]interface{}{"base": "--output=/tmp/x"}), "Error: Invalid base")
+}
+
+func TestGitLog(t *testing.T) {
+	dir := initGitRepo(t, map[string]string{"a.txt": "a\n"})
+	t.Chdir(dir)
+	git(dir, "commit", "-q", "--allow-empty", "-m", "Second commit")
+
+	result := GitLog(map[string]interface{}{})
+	assert.Contains(t, result, "Commits of HEAD, newest first:")
+	assert.Regexp(t, `\n[0-9a-f]+ \d{4}-\d{2}-\d{2} Test: Second commit\n.* Test: Initial commit$`, result)
+
+	result = GitLog(map[string]interface{}{"count": "1"})
+	assert.Contains(t, result, "Second commit")
+	assert.NotContains(t, result, "Initial commit")
+	assert.Contains(t, result, "use count for more")
+
+	result = GitLog(map[string]interface{}{"path": "a.txt"})
+	assert.Contains(t, result, "Commits of HEAD touching a.txt, newest first:")
+
+	assert.Contains(t, GitLog(map[string]interface{}{"count": "500"}), "Error: Invalid count parameter, the maximum is 100")
+	assert.Contains(t, GitLog(map[string]interface{}{"ref": "no-such-branch"}), "Error getting log of no-such-branch")
+}
+
+func TestGitBranch(t *testing.T) {
+	dir := initGitRepo(t, map[string]string{"a.txt": "a\n"})
+	t.Chdir(dir)
+	git(dir, "branch", "feature")
+	git(dir, "checkout", "-q", "-b", "current")
+
+	result := GitBranch(map[string]interface{}{})
+	assert.Regexp(t, `^\* current, \d{4}-\d{2}-\d{2} Initial commit\n`, result)
+	assert.Contains(t, result, "\n  feature, ")
+
+	git(dir, "checkout", "-q", "--detach")
+	assert.Contains(t, GitBranch(map[string]interface{}{}), "HEAD detached")
+}
+
+func TestGitToolsOutsideRepository(t *testing.T) {
+	t.Chdir(t.TempDir())
+	assert.Contains(t, GitStatus(map[string]interface{}{}), "is not inside a git repository")
+	assert.Contains(t, GitLog(map[string]interface{}{}), "is not inside a git repository")
+}
@@ -0,0 +1,308 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pederhe/nca/pkg/utils"
+)
+
+// The GitHub tools run the GitHub CLI (gh) in the working directory, so they use the repository
+// of the project and the account of 'gh auth login'. GH_HOST selects a GitHub Enterprise host.
+
+// Matches the URL of a pull request, with the owner and the name of the repository
+var pullRequestURLRegex = regexp.MustCompile(`^https?://[^/]+/([^/]+)/([^/]+)/pull/(\d+)`)
+
+// checkGitHubCLI returns an error if gh isn't installed or the network policy blocks GitHub
+func checkGitHubCLI() error {
+	if _, err := exec.LookPath("gh"); err != nil {
+		return fmt.Errorf("the GitHub CLI (gh) is not installed, install it from https://cli.github.com and run 'gh auth login'")
+	}
+	host := os.Getenv("GH_HOST")
+	if host == "" {
+		host = "github.com"
+	}
+	return CheckNetworkPolicy("https://" + host)
+}
+
+// runGitHubCLI runs gh with the arguments and returns its output
+func runGitHubCLI(args ...string) (string, error) {
+	if err := checkGitHubCLI(); err != nil {
+		return "", err
+	}
+
+	cmd := exec.Command("gh", args...)
+	cmd.Dir = GetWorkingDir()
+	// gh must not wait for answers or color its output
+	cmd.Env = append(GetCommandEnv(), "GH_PROMPT_DISABLED=1", "NO_COLOR=1")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		message := strings.TrimSpace(stderr.String())
+		if message == "" {
+			message = err.Error()
+		}
+		return "", fmt.Errorf("gh %s failed: %s", strings.Join(args[:min(2, len(args))], " "), message)
+	}
+	return stdout.String(), nil
+}
+
+// githubUser is the author of an issue, a pull request or a comment
+type githubUser struct {
+	Login string `json:"login"`
+}
+
+// githubIssue is an issue as returned by gh issue view
+type githubIssue struct {
+	Number int        `json:"number"`
+	Title  string     `json:"title"`
+	Body   string     `json:"body"`
+	State  string     `json:"state"`
+	URL    string     `json:"url"`
+	Author githubUser `json:"author"`
+	Labels []struct {
+		Name string `json:"name"`
+	} `json:"labels"`
+	Comments []struct {
+		Author    githubUser `json:"author"`
+		Body      string     `json:"body"`
+		CreatedAt time.Time  `json:"createdAt"`
+	} `json:"comments"`
+}
+
+// ReadIssue handles the read_issue tool: it returns an issue with its comments
+func ReadIssue(params map[string]interface{}) string {
+	issue, _ := params["issue"].(string)
+	issue = strings.TrimPrefix(strings.TrimSpace(issue), "#")
+	if issue == "" {
+		return "Error: Missing issue parameter"
+	}
+
+	output, err := runGitHubCLI("issue", "view", issue, "--json", "number,title,body,state,url,author,labels,comments")
+	if err != nil {
+		return fmt.Sprintf("Error: %s", err)
+	}
+	var data githubIssue
+	if err := json.Unmarshal([]byte(output), &data); err != nil {
+		return fmt.Sprintf("Error: Failed to parse the issue: %s", err)
+	}
+
+	var result strings.Builder
+	fmt.Fprintf(&result, "Issue #%d: %s\nState: %s, author: %s", data.Number, data.Title, data.State, data.Author.Login)
+	if len(data.Labels) > 0 {
+		labels := make([]string, 0, len(data.Labels))
+		for _, label := range data.Labels {
+			labels = append(labels, label.Name)
+		}
+		fmt.Fprintf(&result, ", labels: %s", strings.Join(labels, ", "))
+	}
+	fmt.Fprintf(&result, "\nURL: %s\n\n%s\n", data.URL, strings.TrimSpace(data.Body))
+	if len(data.Comments) > 0 {
+		fmt.Fprintf(&result, "\nComments (%d):\n", len(data.Comments))
+		for _, comment := range data.Comments {
+			fmt.Fprintf(&result, "\n--- %s (%s):\n%s\n", comment.Author.Login, comment.CreatedAt.Format("2006-01-02"), strings.TrimSpace(comment.Body))
+		}
+	}
+	return result.String()
+}
+
+// CreatePullRequest handles the create_pull_request tool: it pushes the current branch and opens
+// a pull request from it
+func CreatePullRequest(params map[string]interface{}) string {
+	title, _ := params["title"].(string)
+	body, _ := params["body"].(string)
+	title = strings.TrimSpace(title)
+	if title == "" {
+		return "Error: Missing title parameter"
+	}
+	base, _ := params["base"].(string)
+	base = strings.TrimSpace(base)
+	draft, _ := params["draft"].(bool)
+
+	if err := checkGitHubCLI(); err != nil {
+		return fmt.Sprintf("Error: %s", err)
+	}
+	dir := GetWorkingDir()
+	branch, err := runGit(dir, "rev-parse", "--abbrev-ref", "HEAD")
+	if err != nil {
+		return fmt.Sprintf("Error: %s", err)
+	}
+	branch = strings.TrimSpace(branch)
+	if branch == "HEAD" {
+		return "Error: HEAD is detached, create a branch for the changes before opening a pull request"
+	}
+
+	switch decideApproval(approvePullRequest) {
+	case denyAction:
+		return approvalDenial(approvePullRequest)
+	case askUser:
+		target := "the default branch"
+		if base != "" {
+			target = base
+		}
+		fmt.Printf("Push %s and open a pull request into %s?\n%s\n%s\nContinue? (y/n): ",
+			utils.ColoredText(branch, utils.ColorGreen), target, utils.ColoredText(title, utils.ColorYellow), body)
+		var response string
+		fmt.Fscanln(Input, &response)
+		if strings.ToLower(response) != "y" {
+			return "Pull request cancelled"
+		}
+	}
+
+	if _, err := runGit(dir, "push", "--set-upstream", "origin", branch); err != nil {
+		return fmt.Sprintf("Error: Failed to push %s: %s", branch, err)
+	}
+	args := []string{"pr", "create", "--head", branch, "--title", title, "--body", body}
+	if base != "" {
+		args = append(args, "--base", base)
+	}
+	if draft {
+		args = append(args, "--draft")
+	}
+	output, err := runGitHubCLI(args...)
+	if err != nil {
+		return fmt.Sprintf("Error: %s", err)
+	}
+	return fmt.Sprintf("Pushed %s and opened the pull request: %s", branch, strings.TrimSpace(output))
+}
+
+// CommentOnPR handles the comment_on_pr tool: it adds a comment to a pull request, the one of
+// the current branch if none is given
+func CommentOnPR(params map[string]interface{}) string {
+	pr, _ := params["pr"].(string)
+	pr = strings.TrimPrefix(strings.TrimSpace(pr), "#")
+	body, _ := params["body"].(string)
+	if strings.TrimSpace(body) == "" {
+		return "Error: Missing body parameter"
+	}
+	if err := checkGitHubCLI(); err != nil {
+		return fmt.Sprintf("Error: %s", err)
+	}
+
+	switch decideApproval(approvePRComment) {
+	case denyAction:
+		return approvalDenial(approvePRComment)
+	case askUser:
+		target := "the pull request of the current branch"
+		if pr != "" {
+			target = "pull request " + pr
+		}
+		fmt.Printf("Comment on %s:\n%s\nContinue? (y/n): ", target, utils.ColoredText(body, utils.ColorYellow))
+		var response string
+		fmt.Fscanln(Input, &response)
+		if strings.ToLower(response) != "y" {
+			return "Comment cancelled"
+		}
+	}
+
+	args := []string{"pr", "comment"}
+	if pr != "" {
+		args = append(args, pr)
+	}
+	output, err := runGitHubCLI(append(args, "--body", body)...)
+	if err != nil {
+		return fmt.Sprintf("Error: %s", err)
+	}
+	return "Comment added: " + strings.TrimSpace(output)
+}
+
+// githubPullRequest is a pull request with its reviews as returned by gh pr view
+type githubPullRequest struct {
+	Number  int    `json:"number"`
+	Title   string `json:"title"`
+	URL     string `json:"url"`
+	Reviews []struct {
+		Author githubUser `json:"author"`
+		Body   string     `json:"body"`
+		State  string     `json:"state"`
+	} `json:"reviews"`
+}
+
+// githubReviewComment is a comment on a line of a pull request, from the REST API
+type githubReviewComment struct {
+	ID           int        `json:"id"`
+	Path         string     `json:"path"`
+	Line         *int       `json:"line"`
+	OriginalLine *int       `json:"original_line"`
+	Body         string     `json:"body"`
+	User         githubUser `json:"user"`
+	InReplyToID  int        `json:"in_reply_to_id"`
+}
+
+// ListPRReviewComments handles the list_pr_review_comments tool: it returns the reviews of a pull
+// request and the comments on its lines, of the pull request of the current branch if none is given
+func ListPRReviewComments(params map[string]interface{}) string {
+	pr, _ := params["pr"].(string)
+	pr = strings.TrimPrefix(strings.TrimSpace(pr), "#")
+
+	args := []string{"pr", "view"}
+	if pr != "" {
+		args = append(args, pr)
+	}
+	output, err := runGitHubCLI(append(args, "--json", "number,title,url,reviews")...)
+	if err != nil {
+		return fmt.Sprintf("Error: %s", err)
+	}
+	var data githubPullRequest
+	if err := json.Unmarshal([]byte(output), &data); err != nil {
+		return fmt.Sprintf("Error: Failed to parse the pull request: %s", err)
+	}
+	match := pullRequestURLRegex.FindStringSubmatch(data.URL)
+	if match == nil {
+		return fmt.Sprintf("Error: Unexpected pull request URL %s", data.URL)
+	}
+
+	output, err = runGitHubCLI("api", "--paginate", fmt.Sprintf("repos/%s/%s/pulls/%s/comments", match[1], match[2], match[3]))
+	if err != nil {
+		return fmt.Sprintf("Error: %s", err)
+	}
+	// Pages are concatenated JSON arrays
+	var comments []githubReviewComment
+	decoder := json.NewDecoder(strings.NewReader(output))
+	for decoder.More() {
+		var page []githubReviewComment
+		if err := decoder.Decode(&page); err != nil {
+			return fmt.Sprintf("Error: Failed to parse the review comments: %s", err)
+		}
+		comments = append(comments, page...)
+	}
+
+	var result strings.Builder
+	fmt.Fprintf(&result, "Pull request #%d: %s\nURL: %s\n", data.Number, data.Title, data.URL)
+	var reviews []string
+	for _, review := range data.Reviews {
+		if body := strings.TrimSpace(review.Body); body != "" || review.State == "CHANGES_REQUESTED" {
+			reviews = append(reviews, fmt.Sprintf("- %s (%s): %s", review.Author.Login, review.State, body))
+		}
+	}
+	if len(reviews) > 0 {
+		fmt.Fprintf(&result, "\nReviews:\n%s\n", strings.Join(reviews, "\n"))
+	}
+	if len(comments) == 0 {
+		result.WriteString("\nNo review comments on the lines of the pull request.")
+		return result.String()
+	}
+	fmt.Fprintf(&result, "\nReview comments (%d):\n", len(comments))
+	for _, comment := range comments {
+		location := comment.Path
+		switch {
+		case comment.Line != nil:
+			location = fmt.Sprintf("%s:%d", comment.Path, *comment.Line)
+		case comment.OriginalLine != nil:
+			location = fmt.Sprintf("%s:%d (outdated)", comment.Path, *comment.OriginalLine)
+		}
+		reply := ""
+		if comment.InReplyToID != 0 {
+			reply = fmt.Sprintf(", reply to %d", comment.InReplyToID)
+		}
+		fmt.Fprintf(&result, "\n[%d] %s by %s%s:\n%s\n", comment.ID, location, comment.User.Login, reply, strings.TrimSpace(comment.Body))
+	}
+	return result.String()
+}
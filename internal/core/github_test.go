@@ -0,0 +1,77 @@
+//go:build !windows
+
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeGitHubCLI puts a gh on the PATH that records its arguments in gh.args and prints the file
+// named after its first two arguments, like "issue view.json"
+func fakeGitHubCLI(t *testing.T, outputs map[string]string) string {
+	dir := t.TempDir()
+	script := "#!/bin/sh\necho \"$@\" >> \"" + filepath.Join(dir, "gh.args") + "\"\ncat \"" + dir + "/$1 $2.json\" 2>/dev/null\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "gh"), []byte(script), 0755))
+	for name, output := range outputs {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name+".json"), []byte(output), 0644))
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("HOME", t.TempDir())
+	return filepath.Join(dir, "gh.args")
+}
+
+func TestReadIssue(t *testing.T) {
+	t.Chdir(t.TempDir())
+	fakeGitHubCLI(t, map[string]string{
+		"issue view": `{"number": 42, "title": "Sessions never expire", "body": "They should.\n", "state": "OPEN",
+			"url": "https://github.com/acme/app/issues/42", "author": {"login": "alice"}, "labels": [{"name": "bug"}],
+			"comments": [{"author": {"login": "bob"}, "body": "Confirmed", "createdAt": "2026-03-01T10:00:00Z"}]}`,
+	})
+
+	assert.Equal(t, "Issue #42: Sessions never expire\nState: OPEN, author: alice, labels: bug\n"+
+		"URL: https://github.com/acme/app/issues/42\n\nThey should.\n\nComments (1):\n\n--- bob (2026-03-01):\nConfirmed\n",
+		ReadIssue(map[string]interface{}{"issue": "#42"}))
+	assert.Equal(t, "Error: Missing issue parameter", ReadIssue(map[string]interface{}{}))
+}
+
+func TestListPRReviewComments(t *testing.T) {
+	t.Chdir(t.TempDir())
+	argsFile := fakeGitHubCLI(t, map[string]string{
+		"pr view": `{"number": 57, "title": "Fix the session timeout", "url": "https://github.com/acme/app/pull/57",
+			"reviews": [{"author": {"login": "bob"}, "body": "", "state": "APPROVED"},
+				{"author": {"login": "carol"}, "body": "A few nits", "state": "CHANGES_REQUESTED"}]}`,
+		// Pages of --paginate follow each other
+		"api --paginate": `[{"id": 1, "path": "session.go", "line": 12, "body": "Use the config", "user": {"login": "carol"}}]
+[{"id": 2, "path": "session.go", "original_line": 30, "body": "Done", "user": {"login": "dave"}, "in_reply_to_id": 1}]`,
+	})
+
+	result := ListPRReviewComments(map[string]interface{}{})
+	assert.Equal(t, "Pull request #57: Fix the session timeout\nURL: https://github.com/acme/app/pull/57\n\n"+
+		"Reviews:\n- carol (CHANGES_REQUESTED): A few nits\n\nReview comments (2):\n\n"+
+		"[1] session.go:12 by carol:\nUse the config\n\n[2] session.go:30 (outdated) by dave, reply to 1:\nDone\n", result)
+
+	args, err := os.ReadFile(argsFile)
+	require.NoError(t, err)
+	assert.Equal(t, "pr view --json number,title,url,reviews\napi --paginate repos/acme/app/pulls/57/comments\n", string(args))
+}
+
+func TestCommentOnPR(t *testing.T) {
+	t.Chdir(t.TempDir())
+	defer SetApprovalPolicy("")
+	argsFile := fakeGitHubCLI(t, nil)
+
+	// Without a terminal the comment is denied and gh doesn't run
+	assert.Contains(t, CommentOnPR(map[string]interface{}{"pr": "57", "body": "Addressed"}), "blocked by the approval policy")
+	assert.NoFileExists(t, argsFile)
+
+	require.NoError(t, SetApprovalPolicy(ApprovalYes))
+	CommentOnPR(map[string]interface{}{"pr": "#57", "body": "Addressed"})
+	args, err := os.ReadFile(argsFile)
+	require.NoError(t, err)
+	assert.Equal(t, "pr comment 57 --body Addressed\n", string(args))
+}
@@ -0,0 +1,73 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Handoff context of an accepted new_task request, consumed by the REPL
+var (
+	pendingHandoff      string
+	pendingHandoffMutex sync.Mutex
+)
+
+// NewTask handles the new_task tool. The user confirms the handoff unless auto-approve is enabled,
+// the REPL then starts a new conversation with the context taken from TakeHandoff.
+func NewTask(params map[string]interface{}) string {
+	context, ok := params["context"].(string)
+	if !ok || strings.TrimSpace(context) == "" {
+		return "Error: No context provided for new_task tool"
+	}
+
+	if !IsAutoApprove() {
+		switch decideApproval(approveNewTask) {
+		case denyAction:
+			return approvalDenial(approveNewTask)
+		case askUser:
+			fmt.Print("Start a new task with this context? The current conversation will be archived. (y/n): ")
+			var response string
+			fmt.Fscanln(Input, &response)
+			if strings.ToLower(response) != "y" {
+				return "The user declined to start a new task, continue with the current task"
+			}
+		}
+	}
+
+	pendingHandoffMutex.Lock()
+	pendingHandoff = strings.TrimSpace(context)
+	pendingHandoffMutex.Unlock()
+
+	return "New task started"
+}
+
+// TakeHandoff returns the context of an accepted new_task request and clears it
+func TakeHandoff() (string, bool) {
+	pendingHandoffMutex.Lock()
+	defer pendingHandoffMutex.Unlock()
+
+	context := pendingHandoff
+	pendingHandoff = ""
+	return context, context != ""
+}
+
+// ArchiveConversation saves the conversation as a session before it is replaced by a new task
+func ArchiveConversation(conversation []map[string]string, agentMode bool, deletedRange [2]int) (string, error) {
+	session := &Session{
+		Name:         "handoff-" + time.Now().Format("20060102-150405"),
+		AgentMode:    agentMode,
+		DeletedRange: deletedRange,
+		Conversation: conversation,
+	}
+	if err := SaveSession(session); err != nil {
+		return "", err
+	}
+	return session.Name, nil
+}
+
+// FormatHandoffPrompt returns the first user message of a task started with new_task
+func FormatHandoffPrompt(context string) string {
+	return fmt.Sprintf("This task continues a previous task, which was ended to keep the context small. "+
+		"Continue the work based on the handoff summary of the previous task:\n\n<handoff>\n%s\n</handoff>", context)
+}
@@ -0,0 +1,46 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewTaskHandoff(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	SetSessionAutoApprove(true)
+	defer ClearSessionAutoApprove()
+
+	assert.Contains(t, NewTask(map[string]interface{}{"context": " "}), "Error: No context provided")
+	_, ok := TakeHandoff()
+	assert.False(t, ok)
+
+	assert.Equal(t, "New task started", NewTask(map[string]interface{}{"context": "Implement the parser\n"}))
+	handoff, ok := TakeHandoff()
+	assert.True(t, ok)
+	assert.Equal(t, "Implement the parser", handoff)
+
+	// The handoff is consumed once
+	_, ok = TakeHandoff()
+	assert.False(t, ok)
+
+	assert.Contains(t, FormatHandoffPrompt(handoff), "<handoff>\nImplement the parser\n</handoff>")
+}
+
+func TestArchiveConversation(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	conversation := []map[string]string{
+		{"role": "user", "content": "hello"},
+		{"role": "assistant", "content": "hi"},
+	}
+	name, err := ArchiveConversation(conversation, true, [2]int{1, 2})
+	assert.NoError(t, err)
+	assert.Regexp(t, `^handoff-\d{8}-\d{6}$`, name)
+
+	session, err := LoadSession(name)
+	assert.NoError(t, err)
+	assert.Equal(t, conversation, session.Conversation)
+	assert.True(t, session.AgentMode)
+	assert.Equal(t, [2]int{1, 2}, session.DeletedRange)
+}
@@ -0,0 +1,532 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pederhe/nca/pkg/config"
+	"github.com/pederhe/nca/pkg/log"
+	"github.com/pederhe/nca/pkg/utils"
+)
+
+// Tool hooks are shell commands configured per tool:
+//
+//	nca config set hooks.pre.execute_command "./scripts/check-command.sh"
+//	nca config set hooks.post.write_to_file "golangci-lint run {path}"
+//
+// Placeholders like {path} or {command} are replaced with the (shell quoted) tool
+// parameters, {tool} with the tool name. Parameters are also available to the hook
+// as NCA_TOOL and NCA_PARAM_<NAME> environment variables. A failing pre hook blocks
+// the tool call. Hook output is appended to the tool result unless
+// hooks.append_output is set to false. Hooks set in the config or env files of the
+// project only run once the workspace is trusted.
+//
+// The post_edit hook runs after every successful edit of write_to_file, replace_in_file,
+// write_files and apply_patch, once for each written file:
+//
+//	nca config set hooks.post_edit "gofmt -w {file} && golangci-lint run {file}"
+//
+// Scripts that decide about any tool call go in ~/.nca/hooks.json and run after the configured
+// hooks:
+//
+//	{
+//	  "pre_tool_use": [{"matcher": "execute_command", "command": "~/bin/check-command.sh"}],
+//	  "post_tool_use": [{"matcher": "write_to_file|replace_in_file", "command": "~/bin/notify.sh", "timeout": 10}]
+//	}
+//
+// They get the event, the tool and its parameters (and the result after the call) as JSON on
+// stdin. Exit code 2 blocks the tool call, with the output of the hook as the reason, other
+// failures are reported and the call goes on. On success the hook may print a JSON object with
+// "params" to change parameters of the call and "context" to add context for the model to the
+// tool result, other output is added as context as it is.
+
+const defaultHookTimeout = 60 * time.Second
+
+// Events of the hooks.json hooks
+const (
+	preToolUseEvent  = "pre_tool_use"
+	postToolUseEvent = "post_tool_use"
+)
+
+// Exit code of a hooks.json hook that blocks the tool call
+const hookBlockExitCode = 2
+
+// Matches placeholders such as {path}
+var hookPlaceholderRegex = regexp.MustCompile(`\{([a-z_]+)\}`)
+
+// getHookCommand returns the configured hook command for a stage ("pre" or "post") and tool.
+// Hooks of the project's config only run in trusted workspaces.
+func getHookCommand(stage string, toolName string) string {
+	return strings.TrimSpace(getTrustedConfig(fmt.Sprintf("hooks.%s.%s", stage, toolName)))
+}
+
+// getHookTimeout returns the maximum run time of a hook, configurable with hooks.timeout in seconds
+func getHookTimeout() time.Duration {
+	if value := config.Get("hooks.timeout"); value != "" {
+		if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+			return time.Duration(seconds) * time.Second
+		}
+	}
+	return defaultHookTimeout
+}
+
+// shouldAppendHookOutput returns whether hook output is added to the tool result
+func shouldAppendHookOutput() bool {
+	value := strings.ToLower(config.Get("hooks.append_output"))
+	return value != "false" && value != "0"
+}
+
+// shellQuote quotes a string for safe use as a single argument of the command shell
+func shellQuote(value string) string {
+	_, kind := utils.GetCommandShell()
+	return quoteForShell(kind, value)
+}
+
+// quoteForShell quotes a string as a single argument of a shell of the kind
+func quoteForShell(kind string, value string) string {
+	switch kind {
+	case utils.ShellKindPowerShell:
+		return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+	case utils.ShellKindCmd:
+		return `"` + strings.ReplaceAll(value, `"`, `""`) + `"`
+	}
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
+
+// hookParamString converts a tool parameter to the string passed to hooks
+func hookParamString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case []string:
+		return strings.Join(v, " ")
+	case []FileWrite:
+		// The paths of the written files, their content would be too large
+		paths := make([]string, 0, len(v))
+		for _, file := range v {
+			paths = append(paths, file.Path)
+		}
+		return strings.Join(paths, " ")
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+// expandHookCommand replaces placeholders in a hook command with tool parameters
+func expandHookCommand(command string, toolName string, params map[string]interface{}) string {
+	return hookPlaceholderRegex.ReplaceAllStringFunc(command, func(match string) string {
+		name := match[1 : len(match)-1]
+		if name == "tool" {
+			return shellQuote(toolName)
+		}
+		// {file} is accepted as an alias for {path}
+		if name == "file" {
+			name = "path"
+		}
+		if value, ok := params[name]; ok {
+			return shellQuote(hookParamString(value))
+		}
+		return match
+	})
+}
+
+// ToolHook is a shell command that runs before or after the calls of the matching tools
+type ToolHook struct {
+	Matcher string `json:"matcher"`           // Regular expression of the tool names, all tools if empty or "*"
+	Command string `json:"command"`           // Shell command of the hook
+	Timeout int    `json:"timeout,omitempty"` // In seconds, hooks.timeout by default
+}
+
+// ToolHooks are the hooks of hooks.json by event
+type ToolHooks struct {
+	PreToolUse  []ToolHook `json:"pre_tool_use"`
+	PostToolUse []ToolHook `json:"post_tool_use"`
+}
+
+// toolHookOutput is the JSON output of a hooks.json hook
+type toolHookOutput struct {
+	Params  map[string]json.RawMessage `json:"params"`
+	Context string                     `json:"context"`
+}
+
+// PreToolHookResult is the outcome of the pre hooks of a tool call
+type PreToolHookResult struct {
+	Blocked string // The result for the model if a hook blocked the call, "" otherwise
+	Changed bool   // Whether hooks changed parameters of the call
+	Context string // Context for the model from the hooks, added to the tool result
+}
+
+// hookRun is the outcome of a hook
+type hookRun struct {
+	stdout string
+	stderr string
+	output string // stdout and stderr in the order they were written
+	err    error  // Why the hook failed, nil if it exited with 0
+}
+
+// exitCode returns the exit code of a hook, -1 if it didn't run to its end
+func (r hookRun) exitCode() int {
+	var exitErr *exec.ExitError
+	if r.err == nil {
+		return 0
+	} else if errors.As(r.err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	return -1
+}
+
+// hookParams returns the parameters of a tool call passed to hooks, without internal fields
+func hookParams(params map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(params))
+	for name, value := range params {
+		if name == "tool" || name == "has_multiple_tools" || name == "detected_tools" {
+			continue
+		}
+		result[name] = value
+	}
+	return result
+}
+
+// runHook runs a hook through the shell with the input on stdin. Every hook gets the tool and
+// its parameters as environment variables, and placeholders in its command are expanded.
+func runHook(hook ToolHook, stage string, toolName string, params map[string]interface{}, input string) hookRun {
+	timeout := getHookTimeout()
+	if hook.Timeout > 0 {
+		timeout = time.Duration(hook.Timeout) * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	args := utils.ShellCommand(expandHookCommand(hook.Command, toolName, params))
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	// hooks.json documents the stage as NCA_HOOK_EVENT
+	cmd.Env = append(os.Environ(), "NCA_TOOL="+toolName, "NCA_HOOK_STAGE="+stage, "NCA_HOOK_EVENT="+stage)
+	for name, value := range hookParams(params) {
+		cmd.Env = append(cmd.Env, "NCA_PARAM_"+strings.ToUpper(name)+"="+hookParamString(value))
+	}
+	if input != "" {
+		cmd.Stdin = strings.NewReader(input)
+	}
+
+	var stdout, stderr, output bytes.Buffer
+	cmd.Stdout = io.MultiWriter(&stdout, &output)
+	cmd.Stderr = io.MultiWriter(&stderr, &output)
+
+	err := cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		err = fmt.Errorf("hook timed out after %s", timeout)
+	}
+	log.LogDebug(fmt.Sprintf("%s hook for %s: %s\nOutput: %s\nError: %v\n", stage, toolName, hook.Command, output.String(), err))
+
+	return hookRun{
+		stdout: strings.TrimSpace(stdout.String()),
+		stderr: strings.TrimSpace(stderr.String()),
+		output: strings.TrimSpace(output.String()),
+		err:    err,
+	}
+}
+
+// toolHooksPath returns the path of hooks.json
+func toolHooksPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".nca", "hooks.json")
+}
+
+// loadToolHooks reads hooks.json, which is optional
+func loadToolHooks() (ToolHooks, error) {
+	var hooks ToolHooks
+	path := toolHooksPath()
+	if path == "" {
+		return hooks, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return hooks, nil
+	} else if err != nil {
+		return hooks, err
+	}
+	if err := json.Unmarshal(data, &hooks); err != nil {
+		return hooks, fmt.Errorf("invalid %s: %w", path, err)
+	}
+	return hooks, nil
+}
+
+// matches returns whether the hook runs for a tool
+func (h ToolHook) matches(toolName string) bool {
+	if h.Matcher == "" || h.Matcher == "*" {
+		return true
+	}
+	re, err := regexp.Compile("^(?:" + h.Matcher + ")$")
+	if err != nil {
+		log.LogDebug(fmt.Sprintf("Invalid hook matcher %q: %s\n", h.Matcher, err))
+		return false
+	}
+	return re.MatchString(toolName)
+}
+
+// matchingToolHooks returns the hooks.json hooks of an event that run for a tool
+func matchingToolHooks(event string, toolName string) []ToolHook {
+	hooks, err := loadToolHooks()
+	if err != nil {
+		fmt.Println(utils.ColoredText("Warning: "+err.Error(), utils.ColorYellow))
+		return nil
+	}
+	all := hooks.PreToolUse
+	if event == postToolUseEvent {
+		all = hooks.PostToolUse
+	}
+
+	var matching []ToolHook
+	for _, hook := range all {
+		if strings.TrimSpace(hook.Command) != "" && hook.matches(toolName) {
+			matching = append(matching, hook)
+		}
+	}
+	return matching
+}
+
+// toolHookInput returns the JSON input of a hooks.json hook, the result is only passed after the call
+func toolHookInput(event string, toolName string, params map[string]interface{}, result string) (string, error) {
+	input := map[string]interface{}{"event": event, "tool": toolName, "params": hookParams(params)}
+	if event == postToolUseEvent {
+		input["result"] = result
+	}
+	data, err := json.Marshal(input)
+	return string(data), err
+}
+
+// parseToolHookOutput reads the output of a successful hook, which is a JSON object or plain context
+func parseToolHookOutput(stdout string) toolHookOutput {
+	var output toolHookOutput
+	if strings.HasPrefix(stdout, "{") && json.Unmarshal([]byte(stdout), &output) == nil {
+		return output
+	}
+	return toolHookOutput{Context: stdout}
+}
+
+// applyHookParams changes the parameters of a tool call to the ones returned by a hook. A changed
+// parameter keeps its type, the tool name can't be changed. Nothing is changed if a parameter is
+// invalid.
+func applyHookParams(params map[string]interface{}, changes map[string]json.RawMessage) error {
+	values := make(map[string]interface{}, len(changes))
+	for name, raw := range changes {
+		if name == "tool" {
+			return fmt.Errorf("the tool of a call can't be changed")
+		}
+		var value reflect.Value
+		if existing := params[name]; existing != nil {
+			value = reflect.New(reflect.TypeOf(existing))
+		} else {
+			value = reflect.New(reflect.TypeOf((*interface{})(nil)).Elem())
+		}
+		if err := json.Unmarshal(raw, value.Interface()); err != nil {
+			return fmt.Errorf("invalid parameter %s: %w", name, err)
+		}
+		values[name] = value.Elem().Interface()
+	}
+	for name, value := range values {
+		params[name] = value
+	}
+	return nil
+}
+
+// reportToolHookFailure tells the user that a hooks.json hook failed, the tool call isn't affected
+func reportToolHookFailure(hook ToolHook, err error, stderr string) {
+	message := fmt.Sprintf("Hook %s failed (%s)", hook.Command, err)
+	if stderr != "" {
+		message += "\n" + stderr
+	}
+	fmt.Println(utils.ColoredText(message, utils.ColorYellow))
+}
+
+// RunPreToolHooks runs the hooks before a tool call: the hooks.pre.<tool> command, which blocks
+// the call when it fails, then the pre_tool_use hooks of hooks.json, which block it with exit
+// code 2 and may change its parameters in place
+func RunPreToolHooks(toolName string, params map[string]interface{}) PreToolHookResult {
+	if command := getHookCommand("pre", toolName); command != "" {
+		if run := runHook(ToolHook{Command: command}, "pre", toolName, params, ""); run.err != nil {
+			message := fmt.Sprintf("Error: Tool call blocked by pre hook (%s)", run.err)
+			if run.output != "" {
+				message += ":\n" + run.output
+			}
+			return PreToolHookResult{Blocked: message}
+		}
+	}
+
+	var result PreToolHookResult
+	var contexts []string
+	for _, hook := range matchingToolHooks(preToolUseEvent, toolName) {
+		input, err := toolHookInput(preToolUseEvent, toolName, params, "")
+		if err != nil {
+			reportToolHookFailure(hook, err, "")
+			continue
+		}
+		run := runHook(hook, preToolUseEvent, toolName, params, input)
+		if run.exitCode() == hookBlockExitCode {
+			reason := strings.TrimSpace(run.stderr + "\n" + run.stdout)
+			if reason == "" {
+				reason = "no reason given"
+			}
+			result.Blocked = fmt.Sprintf("Error: Tool call blocked by hook %s:\n%s", hook.Command, reason)
+			return result
+		} else if run.err != nil {
+			reportToolHookFailure(hook, run.err, run.stderr)
+			continue
+		}
+
+		output := parseToolHookOutput(run.stdout)
+		if len(output.Params) > 0 {
+			if err := applyHookParams(params, output.Params); err != nil {
+				reportToolHookFailure(hook, err, "")
+			} else {
+				result.Changed = true
+			}
+		}
+		if output.Context != "" {
+			contexts = append(contexts, output.Context)
+		}
+	}
+	result.Context = strings.Join(contexts, "\n")
+	return result
+}
+
+// RunPostToolHooks runs the hooks after a tool call and returns its result with their output: the
+// hooks.post.<tool> command, which gets the result on stdin, hooks.post_edit for each file the
+// call wrote, and the post_tool_use hooks of hooks.json, whose context is added with the context
+// of the pre hooks
+func RunPostToolHooks(toolName string, params map[string]interface{}, result string, preContext string) string {
+	var text strings.Builder
+	if command := getHookCommand("post", toolName); command != "" {
+		run := runHook(ToolHook{Command: command}, "post", toolName, params, result)
+		status := "succeeded"
+		if run.err != nil {
+			status = fmt.Sprintf("failed (%s)", run.err)
+		}
+		text.WriteString(fmt.Sprintf("\n\n[Post hook %s]", status))
+		if run.output != "" {
+			text.WriteString("\n" + run.output)
+		}
+	}
+	text.WriteString(runPostEditHooks(toolName, params, result))
+	if !shouldAppendHookOutput() {
+		text.Reset()
+	}
+
+	var contexts []string
+	if preContext != "" {
+		contexts = append(contexts, preContext)
+	}
+	for _, hook := range matchingToolHooks(postToolUseEvent, toolName) {
+		input, err := toolHookInput(postToolUseEvent, toolName, params, result)
+		if err != nil {
+			reportToolHookFailure(hook, err, "")
+			continue
+		}
+		run := runHook(hook, postToolUseEvent, toolName, params, input)
+		if run.err != nil {
+			reportToolHookFailure(hook, run.err, run.stderr)
+			continue
+		}
+		if context := parseToolHookOutput(run.stdout).Context; context != "" {
+			contexts = append(contexts, context)
+		}
+	}
+	if len(contexts) > 0 {
+		text.WriteString("\n\n[Hook context]\n" + strings.Join(contexts, "\n"))
+	}
+
+	if text.Len() == 0 {
+		return result
+	}
+	return appendToToolResult(toolName, result, text.String())
+}
+
+// appendToToolResult appends text for the model to a tool result. The diff at the end of a
+// replace_in_file result is only shown to the user, so the text goes before it.
+func appendToToolResult(toolName string, result string, text string) string {
+	if toolName == "replace_in_file" {
+		if summary, display := SplitReplaceResult(result); display != "" {
+			return summary + text + "\n" + display
+		}
+	}
+	return result + text
+}
+
+// editedFiles returns the files written by a successful call of an edit tool, nil for other
+// tools and failed calls
+func editedFiles(toolName string, params map[string]interface{}, result string) []string {
+	switch toolName {
+	case "write_to_file", "replace_in_file":
+		if path, _ := params["path"].(string); path != "" && strings.HasPrefix(result, "File successfully") {
+			return []string{path}
+		}
+	case "write_files", "apply_patch":
+		// The written files are listed as "- path" lines after the first line of the result
+		lines := strings.Split(result, "\n")
+		if !strings.Contains(lines[0], "successfully") {
+			return nil
+		}
+		var files []string
+		for _, line := range lines[1:] {
+			path, ok := strings.CutPrefix(line, "- ")
+			if !ok {
+				break
+			}
+			if strings.HasSuffix(path, " (deleted)") {
+				continue
+			}
+			path = strings.TrimSuffix(path, " (created)")
+			if i := strings.Index(path, " (renamed from "); i >= 0 {
+				path = path[:i]
+			}
+			files = append(files, path)
+		}
+		return files
+	}
+	return nil
+}
+
+// runPostEditHooks runs the hooks.post_edit command for each file written by an edit tool and
+// returns its output for the tool result, so formatting and lint problems are reported without
+// another request
+func runPostEditHooks(toolName string, params map[string]interface{}, result string) string {
+	command := strings.TrimSpace(getTrustedConfig("hooks.post_edit"))
+	if command == "" {
+		return ""
+	}
+
+	var text strings.Builder
+	for _, file := range editedFiles(toolName, params, result) {
+		before, _ := os.ReadFile(file)
+		run := runHook(ToolHook{Command: command}, "post_edit", toolName, map[string]interface{}{"path": file}, "")
+		after, _ := os.ReadFile(file)
+
+		status := "succeeded"
+		if run.err != nil {
+			status = fmt.Sprintf("failed (%s)", run.err)
+		}
+		text.WriteString(fmt.Sprintf("\n\n[Post edit hook for %s %s]", file, status))
+		if run.output != "" {
+			text.WriteString("\n" + run.output)
+		}
+		if !bytes.Equal(before, after) {
+			text.WriteString("\nThe hook changed the file, read it before editing it again.")
+		}
+	}
+	return text.String()
+}
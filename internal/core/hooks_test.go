@@ -0,0 +1,216 @@
+package core
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pederhe/nca/pkg/config"
+	"github.com/pederhe/nca/pkg/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpandHookCommand(t *testing.T) {
+	params := map[string]interface{}{
+		"path":    "src/it's here.go",
+		"command": "ls -la",
+	}
+
+	assert.Equal(t, `gofmt -l 'src/it'\''s here.go'`, expandHookCommand("gofmt -l {path}", "write_to_file", params))
+	assert.Equal(t, `lint 'src/it'\''s here.go'`, expandHookCommand("lint {file}", "write_to_file", params))
+	assert.Equal(t, `echo 'execute_command' 'ls -la'`, expandHookCommand("echo {tool} {command}", "execute_command", params))
+	// Unknown placeholders are left untouched
+	assert.Equal(t, "echo {unknown}", expandHookCommand("echo {unknown}", "read_file", params))
+}
+
+func TestQuoteForShell(t *testing.T) {
+	assert.Equal(t, `'it'\''s'`, quoteForShell(utils.ShellKindPOSIX, "it's"))
+	assert.Equal(t, `'it''s'`, quoteForShell(utils.ShellKindPowerShell, "it's"))
+	assert.Equal(t, `"say ""hi"""`, quoteForShell(utils.ShellKindCmd, `say "hi"`))
+}
+
+func TestToolHooks(t *testing.T) {
+	tmpDir := t.TempDir()
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(originalDir)
+	os.Chdir(tmpDir)
+	t.Setenv("HOME", t.TempDir())
+
+	params := map[string]interface{}{"path": "main.go"}
+
+	// No hooks configured
+	assert.Equal(t, "", RunPreToolHooks("write_to_file", params).Blocked)
+	assert.Equal(t, "result", RunPostToolHooks("write_to_file", params, "result", ""))
+
+	// Hooks of the project only run in trusted workspaces, the user's own always run
+	assert.NoError(t, config.Set("hooks.pre.write_to_file", `echo "no writes to $NCA_PARAM_PATH"; exit 1`, false))
+	assert.Equal(t, "", RunPreToolHooks("write_to_file", params).Blocked)
+	assert.NoError(t, config.Set("hooks.pre.write_to_file", "exit 1", true))
+	assert.Contains(t, RunPreToolHooks("write_to_file", params).Blocked, "blocked by pre hook")
+	assert.NoError(t, config.Unset("hooks.pre.write_to_file", true))
+	trustWorkspace(t)
+
+	// A failing pre hook blocks the tool
+	blocked := RunPreToolHooks("write_to_file", params).Blocked
+	assert.Contains(t, blocked, "blocked by pre hook")
+	assert.Contains(t, blocked, "no writes to main.go")
+
+	assert.NoError(t, config.Set("hooks.pre.write_to_file", "true", false))
+	assert.Equal(t, "", RunPreToolHooks("write_to_file", params).Blocked)
+
+	// Post hook output is appended, the tool result is available on stdin
+	assert.NoError(t, config.Set("hooks.post.write_to_file", "echo checked {path}; wc -c", false))
+	result := RunPostToolHooks("write_to_file", params, "done", "")
+	assert.Contains(t, result, "done\n\n[Post hook succeeded]")
+	assert.Contains(t, result, "checked main.go")
+	assert.Contains(t, result, "4")
+
+	assert.NoError(t, config.Set("hooks.post.write_to_file", "exit 3", false))
+	assert.Contains(t, RunPostToolHooks("write_to_file", params, "done", ""), "[Post hook failed")
+
+	// Output can be kept out of the result
+	assert.NoError(t, config.Set("hooks.append_output", "false", false))
+	assert.Equal(t, "done", RunPostToolHooks("write_to_file", params, "done", ""))
+}
+
+func TestEditedFiles(t *testing.T) {
+	params := map[string]interface{}{"path": "main.go"}
+	assert.Equal(t, []string{"main.go"}, editedFiles("write_to_file", params, "File successfully written: main.go"))
+	assert.Equal(t, []string{"main.go"}, editedFiles("replace_in_file", params, "File successfully updated: main.go\n--- a/main.go"))
+	assert.Nil(t, editedFiles("replace_in_file", params, "File write cancelled: the user rejected the change"))
+	assert.Nil(t, editedFiles("read_file", params, "package main"))
+
+	assert.Equal(t, []string{"a.go", "b.go"}, editedFiles("write_files", nil, "2 files successfully written:\n- a.go\n- b.go"))
+	assert.Equal(t, []string{"new.go", "moved.go", "kept.go"}, editedFiles("apply_patch", nil,
+		"Patch successfully applied to 4 files:\n- new.go (created)\n- old.go (deleted)\n- moved.go (renamed from old_name.go)\n- kept.go\n\nSome hunks didn't match exactly, check that they were applied at the right place:\n- kept.go: hunk 2 at line 10"))
+	assert.Nil(t, editedFiles("apply_patch", nil, "Error: Invalid patch: no files"))
+}
+
+func TestPostEditHook(t *testing.T) {
+	t.Chdir(t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	assert.NoError(t, os.WriteFile("main.go", []byte("package  main\n"), 0644))
+	params := map[string]interface{}{"path": "main.go"}
+
+	assert.Equal(t, "File successfully written: main.go", RunPostToolHooks("write_to_file", params, "File successfully written: main.go", ""))
+
+	// The post edit hook of an untrusted project doesn't run
+	assert.NoError(t, config.Set("hooks.post_edit", "echo formatting {file}", false))
+	assert.Equal(t, "File successfully written: main.go", RunPostToolHooks("write_to_file", params, "File successfully written: main.go", ""))
+	trustWorkspace(t)
+
+	// The output of the hook is attached, and the model is told when the hook changed the file
+	assert.NoError(t, config.Set("hooks.post_edit", `echo formatting {file}; printf 'package main\n' > {file}`, false))
+	result := RunPostToolHooks("write_to_file", params, "File successfully written: main.go", "")
+	assert.Equal(t, "File successfully written: main.go\n\n[Post edit hook for main.go succeeded]\nformatting main.go\nThe hook changed the file, read it before editing it again.", result)
+
+	// The output goes before the diff of replace_in_file, which is only shown to the user
+	assert.NoError(t, config.Set("hooks.post_edit", "echo lint: unused variable; exit 1", false))
+	result = RunPostToolHooks("replace_in_file", params, "File successfully updated: main.go\n--- a/main.go\n+++ b/main.go\n", "")
+	summary, display := SplitReplaceResult(result)
+	assert.Equal(t, "File successfully updated: main.go\n\n[Post edit hook for main.go failed (exit status 1)]\nlint: unused variable", summary)
+	assert.Equal(t, "--- a/main.go\n+++ b/main.go\n", display)
+
+	// Failed edits don't run the hook
+	assert.Equal(t, "Error: Missing file path parameter", RunPostToolHooks("write_to_file", map[string]interface{}{}, "Error: Missing file path parameter", ""))
+}
+
+// writeToolHooks writes hooks.json to a temporary home directory
+func writeToolHooks(t *testing.T, hooks ToolHooks) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	data, err := json.Marshal(hooks)
+	require.NoError(t, err)
+	require.NoError(t, os.MkdirAll(filepath.Join(home, ".nca"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(home, ".nca", "hooks.json"), data, 0644))
+}
+
+func TestToolHookMatcher(t *testing.T) {
+	assert.True(t, ToolHook{}.matches("read_file"))
+	assert.True(t, ToolHook{Matcher: "*"}.matches("read_file"))
+	assert.True(t, ToolHook{Matcher: "write_to_file|replace_in_file"}.matches("replace_in_file"))
+	assert.False(t, ToolHook{Matcher: "write_to_file"}.matches("write_to_file_v2"))
+	assert.True(t, ToolHook{Matcher: "mcp_.*"}.matches("mcp_github_create_issue"))
+	assert.False(t, ToolHook{Matcher: "("}.matches("read_file"))
+}
+
+func TestApplyHookParams(t *testing.T) {
+	params := map[string]interface{}{"tool": "write_files", "path": "a.go", "recursive": true, "files": []FileWrite{{Path: "a.go"}}}
+	require.NoError(t, applyHookParams(params, map[string]json.RawMessage{
+		"path":      json.RawMessage(`"b.go"`),
+		"recursive": json.RawMessage(`false`),
+		"files":     json.RawMessage(`[{"path": "c.go", "content": "package c"}]`),
+		"new":       json.RawMessage(`"value"`),
+	}))
+	assert.Equal(t, "b.go", params["path"])
+	assert.Equal(t, false, params["recursive"])
+	assert.Equal(t, []FileWrite{{Path: "c.go", Content: "package c"}}, params["files"])
+	assert.Equal(t, "value", params["new"])
+
+	// Invalid changes change nothing
+	assert.Error(t, applyHookParams(params, map[string]json.RawMessage{"path": json.RawMessage(`"d.go"`), "recursive": json.RawMessage(`"yes"`)}))
+	assert.Equal(t, "b.go", params["path"])
+	assert.Error(t, applyHookParams(params, map[string]json.RawMessage{"tool": json.RawMessage(`"execute_command"`)}))
+}
+
+func TestPreToolUseHooks(t *testing.T) {
+	t.Chdir(t.TempDir())
+	writeToolHooks(t, ToolHooks{PreToolUse: []ToolHook{
+		{Matcher: "execute_command", Command: `grep -q '"rm -rf' && { echo "rm -rf is not allowed" >&2; exit 2; }; exit 0`},
+		{Matcher: "execute_command", Command: `echo '{"params": {"command": "make test"}, "context": "Commands run in the CI container"}'`},
+		{Matcher: "read_file", Command: "exit 1"},
+	}})
+	trustWorkspace(t)
+
+	params := map[string]interface{}{"tool": "execute_command", "command": "rm -rf /tmp/x"}
+	result := RunPreToolHooks("execute_command", params)
+	assert.Contains(t, result.Blocked, "Error: Tool call blocked by hook")
+	assert.Contains(t, result.Blocked, "rm -rf is not allowed")
+
+	// A failing hooks.pre.<tool> command blocks the call before hooks.json runs
+	assert.NoError(t, config.Set("hooks.pre.execute_command", "exit 1", false))
+	result = RunPreToolHooks("execute_command", map[string]interface{}{"tool": "execute_command", "command": "go test ./..."})
+	assert.Equal(t, "Error: Tool call blocked by pre hook (exit status 1)", result.Blocked)
+	assert.NoError(t, config.Set("hooks.pre.execute_command", "", false))
+
+	params = map[string]interface{}{"tool": "execute_command", "command": "go test ./..."}
+	result = RunPreToolHooks("execute_command", params)
+	assert.Empty(t, result.Blocked)
+	assert.True(t, result.Changed)
+	assert.Equal(t, "make test", params["command"])
+	assert.Equal(t, "Commands run in the CI container", result.Context)
+
+	// Failing hooks don't block the call
+	result = RunPreToolHooks("read_file", map[string]interface{}{"path": "a.go"})
+	assert.Equal(t, PreToolHookResult{}, result)
+}
+
+func TestPostToolUseHooks(t *testing.T) {
+	t.Chdir(t.TempDir())
+	writeToolHooks(t, ToolHooks{PostToolUse: []ToolHook{
+		{Matcher: "write_to_file", Command: `grep -q 'File successfully written' && echo "Remember to update CHANGELOG.md"`},
+	}})
+	trustWorkspace(t)
+
+	params := map[string]interface{}{"tool": "write_to_file", "path": "a.go"}
+	assert.Equal(t, "File successfully written: a.go\n\n[Hook context]\nchecked\nRemember to update CHANGELOG.md",
+		RunPostToolHooks("write_to_file", params, "File successfully written: a.go", "checked"))
+	assert.Equal(t, "contents", RunPostToolHooks("read_file", params, "contents", ""))
+
+	// The output of the configured hooks comes before the context of hooks.json
+	assert.NoError(t, config.Set("hooks.post.write_to_file", "echo linted", false))
+	assert.Equal(t, "File successfully written: a.go\n\n[Post hook succeeded]\nlinted\n\n[Hook context]\nRemember to update CHANGELOG.md",
+		RunPostToolHooks("write_to_file", params, "File successfully written: a.go", ""))
+}
+
+func TestToolHooksWithoutConfig(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	params := map[string]interface{}{"tool": "read_file", "path": "a.go"}
+	assert.Equal(t, PreToolHookResult{}, RunPreToolHooks("read_file", params))
+	assert.Equal(t, "contents", RunPostToolHooks("read_file", params, "contents", ""))
+}
@@ -0,0 +1,128 @@
+package core
+
+import (
+	"bufio"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/pederhe/nca/pkg/utils"
+)
+
+// Marks the last line of a text without newline in diff lines, see splitDiffLines
+const noNewlineMarker = "\n\\ No newline at end of file"
+
+// reviewHunks shows the hunks of a change one by one and asks the user to accept, reject or edit
+// each of them, like git add -p. Only the accepted and edited hunks are written, the rejected ones
+// are returned in the review for the model.
+func reviewHunks(path string, original string, content string, reader *bufio.Reader) writeReview {
+	ops := diffLines(splitDiffLines(original), splitDiffLines(content))
+	hunks := diffHunks(ops)
+
+	// The lines that replace the old lines of each hunk
+	replacements := make([][]string, len(hunks))
+	review := writeReview{}
+	for i, hunk := range hunks {
+		hunkOps := ops[hunk[0]:hunk[1]]
+		fmt.Println(utils.ColoredDiff(strings.TrimRight(formatHunk(hunkOps), "\n")))
+
+	prompt:
+		for {
+			fmt.Printf("Apply hunk %d/%d to %s? (y)es/(n)o/(e)dit: ", i+1, len(hunks), utils.ColoredText(path, utils.ColorGreen))
+			response, err := reader.ReadString('\n')
+			switch strings.ToLower(strings.TrimSpace(response)) {
+			case "y", "yes":
+				replacements[i] = hunkSide(hunkOps, '-')
+				break prompt
+			case "n", "no":
+				replacements[i] = hunkSide(hunkOps, '+')
+				review.rejected = append(review.rejected, formatHunk(hunkOps))
+				break prompt
+			case "e", "edit":
+				edited, err := editTextAs(joinDiffLines(hunkSide(hunkOps, '-')), filepath.Ext(path))
+				if err != nil {
+					fmt.Println(utils.ColoredText("Failed to edit the hunk: "+err.Error(), utils.ColorRed))
+					continue
+				}
+				replacements[i] = splitDiffLines(edited)
+				// Only the end of the file can lack a newline
+				if last := len(replacements[i]) - 1; last >= 0 && hunk[1] < len(ops) {
+					replacements[i][last] = strings.TrimSuffix(replacements[i][last], noNewlineMarker)
+				}
+				review.edited = true
+				break prompt
+			}
+			if err != nil {
+				// Without input the hunk is rejected
+				replacements[i] = hunkSide(hunkOps, '+')
+				review.rejected = append(review.rejected, formatHunk(hunkOps))
+				break prompt
+			}
+		}
+	}
+
+	if len(review.rejected) > 0 {
+		fmt.Print("Reason for the model (optional): ")
+		reason, _ := reader.ReadString('\n')
+		review.reason = strings.TrimSpace(reason)
+		if len(review.rejected) == len(hunks) {
+			return writeReview{refusal: formatWriteRefusal(path, review.reason)}
+		}
+	}
+	review.content = applyHunks(ops, hunks, replacements)
+	return review
+}
+
+// hunkSide returns the lines of a hunk without the lines of the given kind, '+' for the old lines
+// and '-' for the new ones
+func hunkSide(ops []diffOp, without byte) []string {
+	var lines []string
+	for _, op := range ops {
+		if op.kind != without {
+			lines = append(lines, op.line)
+		}
+	}
+	return lines
+}
+
+// applyHunks returns the text of a diff with each hunk replaced by its replacement lines, the
+// lines outside the hunks are unchanged
+func applyHunks(ops []diffOp, hunks [][2]int, replacements [][]string) string {
+	var lines []string
+	i := 0
+	for h, hunk := range hunks {
+		for ; i < hunk[0]; i++ {
+			lines = append(lines, ops[i].line)
+		}
+		lines = append(lines, replacements[h]...)
+		i = hunk[1]
+	}
+	for ; i < len(ops); i++ {
+		lines = append(lines, ops[i].line)
+	}
+	return joinDiffLines(lines)
+}
+
+// joinDiffLines joins lines split by splitDiffLines back into a text
+func joinDiffLines(lines []string) string {
+	var text strings.Builder
+	for _, line := range lines {
+		if strings.HasSuffix(line, noNewlineMarker) {
+			text.WriteString(strings.TrimSuffix(line, noNewlineMarker))
+			continue
+		}
+		text.WriteString(line + "\n")
+	}
+	return text.String()
+}
+
+// formatRejectedHunks tells the model which hunks of its change the user rejected and why, the
+// other hunks were written
+func formatRejectedHunks(rejected []string, reason string) string {
+	if reason == "" {
+		reason = "(none given)"
+	}
+	return fmt.Sprintf("The user rejected %d hunk(s) of your change, they weren't written. Reason: %s. "+
+		"Read the file before changing it again and don't repeat the rejected hunks:\n%s",
+		len(rejected), reason, strings.Join(rejected, ""))
+}
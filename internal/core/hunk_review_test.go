@@ -0,0 +1,89 @@
+package core
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func numberedLines(from int, to int, changed map[int]string) string {
+	var lines []string
+	for i := from; i <= to; i++ {
+		if line, ok := changed[i]; ok {
+			lines = append(lines, line)
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("line %d", i))
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+func TestReviewHunks(t *testing.T) {
+	original := numberedLines(1, 30, nil)
+	content := numberedLines(1, 30, map[int]string{2: "second", 15: "fifteenth", 29: "twenty-nine"})
+
+	// Only the accepted hunks are written, the rejected ones are returned for the model
+	review := reviewHunks("a.txt", original, content, bufio.NewReader(strings.NewReader("y\nn\ny\nnot this one\n")))
+	assert.Empty(t, review.refusal)
+	assert.Equal(t, numberedLines(1, 30, map[int]string{2: "second", 29: "twenty-nine"}), review.content)
+	assert.Len(t, review.rejected, 1)
+	assert.Contains(t, review.rejected[0], "-line 15\n+fifteenth\n")
+	assert.Equal(t, "not this one", review.reason)
+
+	result := formatRejectedHunks(review.rejected, review.reason)
+	assert.Contains(t, result, "The user rejected 1 hunk(s) of your change, they weren't written. Reason: not this one.")
+	assert.Contains(t, result, "@@ -12,7 +12,7 @@")
+
+	// Invalid answers ask again
+	review = reviewHunks("a.txt", original, content, bufio.NewReader(strings.NewReader("maybe\ny\ny\ny\n")))
+	assert.Equal(t, content, review.content)
+	assert.Empty(t, review.rejected)
+
+	// Rejecting every hunk rejects the change
+	review = reviewHunks("a.txt", original, content, bufio.NewReader(strings.NewReader("n\nn\nn\n\n")))
+	assert.Empty(t, review.content)
+	assert.Contains(t, review.refusal, "File write cancelled: the user rejected the change")
+}
+
+func TestApplyHunksWithoutNewlineAtEnd(t *testing.T) {
+	original := "a\nb\nc"
+	content := "A\nb\nc\nd"
+	ops := diffLines(splitDiffLines(original), splitDiffLines(content))
+	hunks := diffHunks(ops)
+	assert.Len(t, hunks, 1)
+
+	assert.Equal(t, content, applyHunks(ops, hunks, [][]string{hunkSide(ops[hunks[0][0]:hunks[0][1]], '-')}))
+	assert.Equal(t, original, applyHunks(ops, hunks, [][]string{hunkSide(ops[hunks[0][0]:hunks[0][1]], '+')}))
+}
+
+func TestSplitReplaceResult(t *testing.T) {
+	summary, display := SplitReplaceResult("File successfully updated: a.txt\nThe user rejected 1 hunk(s)\n@@ -1 +1 @@\n-a\n+b\n--- a/a.txt\n+++ b/a.txt\n@@ -1 +1 @@\n")
+	assert.Equal(t, "File successfully updated: a.txt\nThe user rejected 1 hunk(s)\n@@ -1 +1 @@\n-a\n+b", summary)
+	assert.True(t, strings.HasPrefix(display, "--- a/a.txt\n"))
+
+	// Without a diff the rejected hunks stay in the part for the model
+	summary, display = SplitReplaceResult("File successfully updated: a.txt\nThe user rejected 1 hunk(s)\n@@ -1 +1 @@\n-a\n+b\nNo changes detected")
+	assert.Equal(t, "File successfully updated: a.txt\nThe user rejected 1 hunk(s)\n@@ -1 +1 @@\n-a\n+b", summary)
+	assert.Equal(t, "No changes detected", display)
+
+	summary, display = SplitReplaceResult("Error: No match found\nfor the SEARCH block")
+	assert.Equal(t, "Error: No match found\nfor the SEARCH block", summary)
+	assert.Empty(t, display)
+
+	// The notes of blocks that didn't match exactly are for the model
+	path := filepath.Join(t.TempDir(), "notes.txt")
+	require.NoError(t, os.WriteFile(path, []byte("first\nsecond\n"), 0644))
+	summary, display = SplitReplaceResult(ReplaceInFile(map[string]interface{}{
+		"path": path,
+		"diff": "<<<<<<< SEARCH\nfirst  \nsecond\n=======\n1st\n2nd\n>>>>>>> REPLACE",
+	}))
+	assert.Contains(t, summary, "Block #1 matched lines 1-2 ignoring trailing whitespace")
+	assert.True(t, strings.HasPrefix(display, "--- a/"+toPosix(path)+"\n"))
+	assert.NotContains(t, display, "Block #1")
+}
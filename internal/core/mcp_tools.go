@@ -0,0 +1,165 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pederhe/nca/internal/services/mcp"
+	"github.com/pederhe/nca/pkg/config"
+	"github.com/pederhe/nca/pkg/mcp/common"
+	"github.com/pederhe/nca/pkg/utils"
+)
+
+const (
+	// defaultMcpSchemaTokenBudget is the default number of tokens of MCP tool input schemas
+	// included in the system prompt
+	defaultMcpSchemaTokenBudget = 4000
+	// maxMcpToolSummaryLength is the maximum length of a tool description in the compact listing
+	maxMcpToolSummaryLength = 120
+)
+
+// getMcpSchemaTokenBudget returns the token budget for MCP tool schemas in the system prompt,
+// set with the "mcp_schema_token_budget" config key. 0 lists only tool names and summaries.
+func getMcpSchemaTokenBudget() int {
+	if value := config.Get("mcp_schema_token_budget"); value != "" {
+		if budget, err := strconv.Atoi(value); err == nil && budget >= 0 {
+			return budget
+		}
+	}
+	return defaultMcpSchemaTokenBudget
+}
+
+// mcpToolKey identifies a tool of a server
+func mcpToolKey(serverName string, toolName string) string {
+	return serverName + "/" + toolName
+}
+
+// formatMcpToolSchema returns the indented input schema of a tool
+func formatMcpToolSchema(tool common.McpTool) string {
+	schemaBytes, _ := json.MarshalIndent(tool.InputSchema, "    ", "  ")
+	return "    Input Schema:\n    " + string(schemaBytes) + "\n"
+}
+
+// selectMcpToolSchemas chooses the tools whose input schemas fit into the token budget.
+// Auto-approved tools come first since the user runs them routinely, then smaller schemas
+// are preferred so as many tools as possible can be called without describe_mcp_tool.
+func selectMcpToolSchemas(servers []common.McpServer, budget int) map[string]bool {
+	type candidate struct {
+		key         string
+		tokens      int
+		autoApprove bool
+	}
+
+	var candidates []candidate
+	for _, server := range servers {
+		for _, tool := range server.Tools {
+			if tool.InputSchema == nil {
+				continue
+			}
+			candidates = append(candidates, candidate{
+				key:         mcpToolKey(server.Name, tool.Name),
+				tokens:      EstimateTokens(formatMcpToolSchema(tool)),
+				autoApprove: tool.AutoApprove,
+			})
+		}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].autoApprove != candidates[j].autoApprove {
+			return candidates[i].autoApprove
+		}
+		return candidates[i].tokens < candidates[j].tokens
+	})
+
+	selected := map[string]bool{}
+	for _, c := range candidates {
+		if c.tokens <= budget {
+			selected[c.key] = true
+			budget -= c.tokens
+		}
+	}
+	return selected
+}
+
+// summarizeMcpToolDescription shortens a tool description to its first line
+func summarizeMcpToolDescription(description string) string {
+	summary := strings.TrimSpace(description)
+	if idx := strings.Index(summary, "\n"); idx >= 0 {
+		summary = strings.TrimSpace(summary[:idx])
+	}
+	return utils.Ellipsize(summary, maxMcpToolSummaryLength)
+}
+
+// formatMcpServerTools writes the tool listing of a server for the system prompt. Tools
+// whose schema isn't selected are listed with a one-line description only.
+func formatMcpServerTools(server common.McpServer, schemas map[string]bool) string {
+	var builder strings.Builder
+	for _, tool := range server.Tools {
+		if schemas[mcpToolKey(server.Name, tool.Name)] {
+			builder.WriteString(fmt.Sprintf("- %s: %s\n", tool.Name, tool.Description))
+			builder.WriteString(formatMcpToolSchema(tool))
+			continue
+		}
+		builder.WriteString(fmt.Sprintf("- %s: %s\n", tool.Name, summarizeMcpToolDescription(tool.Description)))
+		if tool.InputSchema != nil {
+			builder.WriteString("    (Input schema omitted, use describe_mcp_tool to get it)\n")
+		}
+	}
+	return builder.String()
+}
+
+// DescribeMcpTool returns the full description and input schema of a tool provided by a connected MCP server
+func DescribeMcpTool(params map[string]interface{}) string {
+	serverName, ok := params["server_name"].(string)
+	if !ok || serverName == "" {
+		return "Error: Missing or invalid server_name parameter"
+	}
+
+	toolName, ok := params["tool_name"].(string)
+	if !ok || toolName == "" {
+		return "Error: Missing or invalid tool_name parameter"
+	}
+
+	mcpHub := mcp.GetMcpHub()
+
+	// Check if MCP is enabled
+	if mcpHub.GetMode() == "off" {
+		return "Error: MCP is disabled. Enable it in settings to use MCP tools."
+	}
+
+	for _, server := range mcpHub.GetServers() {
+		if server.Name != serverName || server.Status != "connected" {
+			continue
+		}
+
+		var toolNames []string
+		for _, tool := range server.Tools {
+			if tool.Name == toolName {
+				return formatMcpToolDescription(serverName, tool)
+			}
+			toolNames = append(toolNames, tool.Name)
+		}
+		return fmt.Sprintf("Error: Server %s has no tool named %s. Available tools: %s", serverName, toolName, strings.Join(toolNames, ", "))
+	}
+
+	return fmt.Sprintf("Error: No connected MCP server named %s", serverName)
+}
+
+// formatMcpToolDescription formats the full description of a tool
+func formatMcpToolDescription(serverName string, tool common.McpTool) string {
+	var builder strings.Builder
+	builder.WriteString(fmt.Sprintf("Tool: %s (server: %s)\n", tool.Name, serverName))
+	if tool.Description != "" {
+		builder.WriteString(fmt.Sprintf("Description: %s\n", tool.Description))
+	}
+	if tool.InputSchema != nil {
+		schemaBytes, _ := json.MarshalIndent(tool.InputSchema, "", "  ")
+		builder.WriteString("Input Schema:\n" + string(schemaBytes) + "\n")
+	} else {
+		builder.WriteString("The tool takes no arguments.\n")
+	}
+	return builder.String()
+}
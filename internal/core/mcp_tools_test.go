@@ -0,0 +1,60 @@
+package core
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pederhe/nca/pkg/mcp/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSelectMcpToolSchemas(t *testing.T) {
+	largeSchema := map[string]interface{}{
+		"type":        "object",
+		"description": strings.Repeat("x", 2000),
+	}
+	smallSchema := map[string]interface{}{"type": "object"}
+
+	servers := []common.McpServer{
+		{Name: "files", Tools: []common.McpTool{
+			{Name: "large", InputSchema: largeSchema},
+			{Name: "small", InputSchema: smallSchema},
+			{Name: "none"},
+		}},
+		{Name: "web", Tools: []common.McpTool{
+			{Name: "approved", InputSchema: largeSchema, AutoApprove: true},
+		}},
+	}
+
+	// Auto-approved tools are preferred, then smaller schemas
+	selected := selectMcpToolSchemas(servers, 600)
+	assert.Equal(t, map[string]bool{"web/approved": true, "files/small": true}, selected)
+
+	assert.Empty(t, selectMcpToolSchemas(servers, 0))
+	assert.Len(t, selectMcpToolSchemas(servers, 100000), 3)
+
+	listing := formatMcpServerTools(servers[0], selected)
+	assert.Contains(t, listing, "- large: \n    (Input schema omitted, use describe_mcp_tool to get it)")
+	assert.Contains(t, listing, "- small: \n    Input Schema:")
+	assert.NotContains(t, listing, "- none: \n    (Input schema omitted")
+}
+
+func TestSummarizeMcpToolDescription(t *testing.T) {
+	assert.Equal(t, "Search the web", summarizeMcpToolDescription("  Search the web\n\nArgs:\n  query: the query"))
+
+	summary := summarizeMcpToolDescription(strings.Repeat("a", 200))
+	assert.Len(t, summary, maxMcpToolSummaryLength)
+	assert.True(t, strings.HasSuffix(summary, "..."))
+}
+
+func TestFormatMcpToolDescription(t *testing.T) {
+	tool := common.McpTool{
+		Name:        "search",
+		Description: "Search the web",
+		InputSchema: map[string]interface{}{"type": "object"},
+	}
+	assert.Equal(t, "Tool: search (server: web)\nDescription: Search the web\nInput Schema:\n{\n  \"type\": \"object\"\n}\n",
+		formatMcpToolDescription("web", tool))
+
+	assert.Contains(t, DescribeMcpTool(map[string]interface{}{"server_name": "web"}), "Error: Missing or invalid tool_name parameter")
+}
@@ -0,0 +1,247 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/pederhe/nca/pkg/api/types"
+)
+
+// JSON schema types of tool parameters that are not plain strings
+var nativeToolParamSchemas = map[string]map[string]interface{}{
+	"requires_approval": {"type": "boolean"},
+	"run_in_background": {"type": "boolean"},
+	"stop":              {"type": "boolean"},
+	"job_id":            {"type": "integer"},
+	"recursive":         {"type": "boolean"},
+	"cheap_model":       {"type": "boolean"},
+	"draft":             {"type": "boolean"},
+	"amend":             {"type": "boolean"},
+	"staged_only":       {"type": "boolean"},
+	"staged":            {"type": "boolean"},
+	"all":               {"type": "boolean"},
+	"count":             {"type": "integer"},
+	"offset":            {"type": "integer"},
+	"limit":             {"type": "integer"},
+	"files":             {"type": "array", "items": map[string]interface{}{"type": "string"}},
+	"paths":             {"type": "array", "items": map[string]interface{}{"type": "string"}},
+	"options":           {"type": "array", "items": map[string]interface{}{"type": "string"}, "maxItems": maxFollowupOptions},
+	"arguments":         {"type": "object"},
+	"timeout":           {"type": "integer"},
+	"max_size":          {"type": "integer"},
+	"steps":             {"type": "array", "items": map[string]interface{}{"type": "string"}, "maxItems": maxChecklistSteps},
+	"step":              {"type": "integer"},
+	"status":            {"type": "string", "enum": []string{StepPending, StepInProgress, StepDone, StepSkipped}},
+}
+
+// JSON schema types of parameters whose type depends on the tool
+var nativeToolParamSchemasByTool = map[string]map[string]map[string]interface{}{
+	"write_files": {
+		"files": {
+			"type": "array",
+			"items": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"path":    map[string]interface{}{"type": "string"},
+					"content": map[string]interface{}{"type": "string"},
+				},
+				"required": []string{"path", "content"},
+			},
+		},
+	},
+}
+
+// Matches a parameter line of the tool documentation, e.g. "- path: (required) The path..."
+var toolParamLineRegex = regexp.MustCompile(`^- ([a-z_]+): \((required|optional)\) (.*)$`)
+
+// Section markers of the tool documentation in the system prompt
+const (
+	toolFormattingMarker = "# Tool Use Formatting"
+	toolsMarker          = "# Tools\n"
+	toolExamplesMarker   = "# Tool Use Examples"
+	toolGuidelinesMarker = "# Tool Use Guidelines"
+)
+
+// nativeToolInstructions replaces the XML tool documentation when tools are sent as function definitions
+const nativeToolInstructions = `# Tool Calling
+
+Tools are provided to you as functions. Call exactly one function per message, the result of the call will be returned to you in the next message. Never write tool calls as XML tags in your response.
+
+`
+
+// BuildToolDefinitions builds function definitions for native tool calling from the
+// tool documentation of the system prompt, so both protocols share one description.
+func BuildToolDefinitions(systemPrompt string) []types.ToolDefinition {
+	start := strings.Index(systemPrompt, toolsMarker)
+	end := strings.Index(systemPrompt, toolExamplesMarker)
+	if start < 0 || end < start {
+		return nil
+	}
+
+	var definitions []types.ToolDefinition
+	for _, block := range strings.Split(systemPrompt[start+len(toolsMarker):end], "\n## ") {
+		block = strings.TrimPrefix(strings.TrimSpace(block), "## ")
+		if block == "" {
+			continue
+		}
+		if definition, ok := parseToolDocumentation(block); ok {
+			definitions = append(definitions, definition)
+		}
+	}
+	return definitions
+}
+
+// parseToolDocumentation converts the documentation of one tool to a function definition
+func parseToolDocumentation(block string) (types.ToolDefinition, bool) {
+	lines := strings.Split(block, "\n")
+	name := strings.TrimSpace(lines[0])
+
+	var description strings.Builder
+	properties := map[string]interface{}{}
+	required := []string{}
+
+	section := "description"
+	var currentParam string
+	var currentDescription strings.Builder
+	flushParam := func() {
+		if currentParam == "" {
+			return
+		}
+		schema := map[string]interface{}{"type": "string"}
+		custom, ok := nativeToolParamSchemasByTool[name][currentParam]
+		if !ok {
+			custom, ok = nativeToolParamSchemas[currentParam]
+		}
+		if ok {
+			schema = map[string]interface{}{}
+			for key, value := range custom {
+				schema[key] = value
+			}
+		}
+		schema["description"] = strings.TrimSpace(currentDescription.String())
+		properties[currentParam] = schema
+		currentParam = ""
+		currentDescription.Reset()
+	}
+
+	for _, line := range lines[1:] {
+		switch {
+		case strings.HasPrefix(line, "Description: "):
+			section = "description"
+			description.WriteString(strings.TrimPrefix(line, "Description: "))
+		case line == "Parameters:":
+			section = "parameters"
+		case line == "Usage:":
+			flushParam()
+			section = "usage"
+		case section == "description":
+			description.WriteString("\n" + line)
+		case section == "parameters":
+			if match := toolParamLineRegex.FindStringSubmatch(line); match != nil {
+				flushParam()
+				currentParam = match[1]
+				if match[2] == "required" {
+					required = append(required, currentParam)
+				}
+				currentDescription.WriteString(match[3])
+			} else if currentParam != "" {
+				currentDescription.WriteString("\n" + line)
+			}
+		}
+	}
+	flushParam()
+
+	if name == "" || description.Len() == 0 {
+		return types.ToolDefinition{}, false
+	}
+
+	return types.ToolDefinition{
+		Type: "function",
+		Function: types.FunctionDefinition{
+			Name:        name,
+			Description: strings.TrimSpace(description.String()),
+			Parameters: map[string]interface{}{
+				"type":       "object",
+				"properties": properties,
+				"required":   required,
+			},
+		},
+	}, true
+}
+
+// AdaptSystemPromptForNativeTools removes the XML tool documentation from the system prompt,
+// the tools are described by their function definitions instead.
+func AdaptSystemPromptForNativeTools(systemPrompt string) string {
+	start := strings.Index(systemPrompt, toolFormattingMarker)
+	end := strings.Index(systemPrompt, toolGuidelinesMarker)
+	if start < 0 || end < start {
+		return systemPrompt
+	}
+
+	prompt := systemPrompt[:start] + nativeToolInstructions + systemPrompt[end:]
+	return strings.Replace(prompt, "Formulate your tool use using the XML format specified for each tool.",
+		"Call tools with the provided functions.", 1)
+}
+
+// ParseToolCall converts a native tool call to the tool use format returned by ParseToolUse
+func ParseToolCall(call types.ToolCall) (map[string]interface{}, error) {
+	params := map[string]interface{}{
+		"tool": call.Function.Name,
+	}
+
+	arguments := map[string]interface{}{}
+	if strings.TrimSpace(call.Function.Arguments) != "" {
+		if err := json.Unmarshal([]byte(call.Function.Arguments), &arguments); err != nil {
+			return nil, fmt.Errorf("invalid arguments for tool %s: %w", call.Function.Name, err)
+		}
+	}
+
+	for name, value := range arguments {
+		switch v := value.(type) {
+		case string:
+			if nativeToolParamSchemas[name]["type"] == "boolean" {
+				params[name] = v == "true"
+			} else if name == "files" {
+				params[name] = strings.Fields(v)
+			} else {
+				params[name] = v
+			}
+		case bool:
+			params[name] = v
+		case []interface{}:
+			if call.Function.Name == "write_files" && name == "files" {
+				params[name] = parseNativeFileWrites(v)
+				continue
+			}
+			items := make([]string, 0, len(v))
+			for _, item := range v {
+				items = append(items, fmt.Sprintf("%v", item))
+			}
+			params[name] = items
+		case map[string]interface{}:
+			// Nested objects such as MCP tool arguments are passed on as JSON
+			data, _ := json.Marshal(v)
+			params[name] = string(data)
+		case nil:
+			continue
+		default:
+			params[name] = fmt.Sprintf("%v", v)
+		}
+	}
+
+	return params, nil
+}
+
+// parseNativeFileWrites converts the files argument of a native write_files call
+func parseNativeFileWrites(items []interface{}) []FileWrite {
+	files := make([]FileWrite, 0, len(items))
+	for _, item := range items {
+		fields, _ := item.(map[string]interface{})
+		path, _ := fields["path"].(string)
+		content, _ := fields["content"].(string)
+		files = append(files, FileWrite{Path: strings.TrimSpace(path), Content: content})
+	}
+	return files
+}
@@ -0,0 +1,92 @@
+package core
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pederhe/nca/pkg/api/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildToolDefinitions(t *testing.T) {
+	prompt, err := BuildSystemPrompt()
+	assert.NoError(t, err)
+
+	definitions := BuildToolDefinitions(prompt)
+	byName := map[string]types.FunctionDefinition{}
+	for _, definition := range definitions {
+		assert.Equal(t, "function", definition.Type)
+		byName[definition.Function.Name] = definition.Function
+	}
+
+	for _, name := range []string{"execute_command", "read_file", "write_to_file", "replace_in_file", "attempt_completion", "git_commit"} {
+		assert.Contains(t, byName, name)
+	}
+
+	command := byName["execute_command"]
+	assert.NotEmpty(t, command.Description)
+	properties := command.Parameters["properties"].(map[string]interface{})
+	assert.Equal(t, "string", properties["command"].(map[string]interface{})["type"])
+	assert.Equal(t, "boolean", properties["requires_approval"].(map[string]interface{})["type"])
+	assert.Equal(t, []string{"command", "requires_approval"}, command.Parameters["required"])
+
+	// Multi-line parameter descriptions are kept
+	diff := byName["replace_in_file"].Parameters["properties"].(map[string]interface{})["diff"].(map[string]interface{})
+	assert.Contains(t, diff["description"], "SEARCH/REPLACE")
+	assert.Contains(t, diff["description"], "Critical rules")
+
+	files := byName["git_commit"].Parameters["properties"].(map[string]interface{})["files"].(map[string]interface{})
+	assert.Equal(t, "array", files["type"])
+}
+
+func TestAdaptSystemPromptForNativeTools(t *testing.T) {
+	prompt, err := BuildSystemPrompt()
+	assert.NoError(t, err)
+
+	adapted := AdaptSystemPromptForNativeTools(prompt)
+	assert.Less(t, len(adapted), len(prompt))
+	assert.Contains(t, adapted, "# Tool Calling")
+	assert.NotContains(t, adapted, "<read_file>")
+	assert.Contains(t, adapted, "# Tool Use Guidelines")
+	assert.False(t, strings.Contains(adapted, "XML format specified for each tool"))
+}
+
+func TestParseToolCall(t *testing.T) {
+	toolUse, err := ParseToolCall(types.ToolCall{
+		ID:   "call_1",
+		Type: "function",
+		Function: types.FunctionCall{
+			Name:      "execute_command",
+			Arguments: `{"command": "ls -la", "requires_approval": false}`,
+		},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "execute_command", toolUse["tool"])
+	assert.Equal(t, "ls -la", toolUse["command"])
+	assert.Equal(t, false, toolUse["requires_approval"])
+
+	toolUse, err = ParseToolCall(types.ToolCall{Function: types.FunctionCall{
+		Name:      "git_commit",
+		Arguments: `{"message": "Fix bug", "files": ["a.go", "b.go"]}`,
+	}})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a.go", "b.go"}, toolUse["files"])
+
+	toolUse, err = ParseToolCall(types.ToolCall{Function: types.FunctionCall{
+		Name:      "use_mcp_tool",
+		Arguments: `{"server_name": "github", "tool_name": "create_issue", "arguments": {"title": "Bug"}}`,
+	}})
+	assert.NoError(t, err)
+	assert.Equal(t, `{"title":"Bug"}`, toolUse["arguments"])
+
+	// Booleans sent as strings are converted
+	toolUse, err = ParseToolCall(types.ToolCall{Function: types.FunctionCall{
+		Name:      "list_files",
+		Arguments: `{"path": ".", "recursive": "true"}`,
+	}})
+	assert.NoError(t, err)
+	assert.Equal(t, true, toolUse["recursive"])
+
+	_, err = ParseToolCall(types.ToolCall{Function: types.FunctionCall{Name: "read_file", Arguments: "{invalid"}})
+	assert.Error(t, err)
+}
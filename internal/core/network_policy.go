@@ -0,0 +1,73 @@
+package core
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/pederhe/nca/pkg/config"
+)
+
+// IsNetworkAllowed returns whether network tools are enabled.
+// Network access can be disabled with the config key "network_access" set to "off",
+// and is always disabled in untrusted workspaces. The project's config can turn it off, but
+// only turn it back on in trusted workspaces.
+func IsNetworkAllowed() bool {
+	if IsWorkspaceUntrusted() {
+		return false
+	}
+	return isNetworkAccessOn(getTrustedConfig("network_access")) && isNetworkAccessOn(config.Get("network_access"))
+}
+
+// isNetworkAccessOn returns whether a network_access value allows network access
+func isNetworkAccessOn(value string) bool {
+	value = strings.ToLower(value)
+	return value != "off" && value != "false" && value != "0"
+}
+
+// CheckNetworkPolicy returns an error if the URL is not allowed by the network policy.
+// The config keys "network_allowed_hosts" and "network_blocked_hosts" take comma-separated
+// host names; a host also matches all of its subdomains.
+func CheckNetworkPolicy(rawURL string) error {
+	if !IsNetworkAllowed() {
+		return fmt.Errorf("network access is disabled by the network policy")
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("invalid URL: %s", rawURL)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("unsupported URL scheme: %s", u.Scheme)
+	}
+
+	host := strings.ToLower(u.Hostname())
+	if host == "" {
+		return fmt.Errorf("invalid URL: %s", rawURL)
+	}
+
+	if matchesHostList(host, config.Get("network_blocked_hosts")) {
+		return fmt.Errorf("host '%s' is blocked by the network policy", host)
+	}
+
+	allowed := config.Get("network_allowed_hosts")
+	if strings.TrimSpace(allowed) != "" && !matchesHostList(host, allowed) {
+		return fmt.Errorf("host '%s' is not in the allowed hosts of the network policy", host)
+	}
+
+	return nil
+}
+
+// matchesHostList checks whether host equals or is a subdomain of a host in the comma-separated list
+func matchesHostList(host string, list string) bool {
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if entry == "" {
+			continue
+		}
+		if entry == "*" || host == entry || strings.HasSuffix(host, "."+entry) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,57 @@
+package core
+
+import (
+	"os"
+	"testing"
+
+	"github.com/pederhe/nca/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckNetworkPolicy(t *testing.T) {
+	tmpDir := t.TempDir()
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(originalDir)
+	os.Chdir(tmpDir)
+
+	// Everything is allowed by default
+	assert.NoError(t, CheckNetworkPolicy("https://example.com/file"))
+	assert.Error(t, CheckNetworkPolicy("ftp://example.com/file"))
+	assert.Error(t, CheckNetworkPolicy("file:///etc/passwd"))
+
+	// Blocked hosts include subdomains
+	assert.NoError(t, config.Set("network_blocked_hosts", "bad.com", false))
+	assert.Error(t, CheckNetworkPolicy("https://bad.com/x"))
+	assert.Error(t, CheckNetworkPolicy("https://cdn.bad.com/x"))
+	assert.NoError(t, CheckNetworkPolicy("https://notbad.com/x"))
+
+	// Only allowed hosts can be reached once the list is set
+	assert.NoError(t, config.Set("network_allowed_hosts", "github.com, golang.org", false))
+	assert.NoError(t, CheckNetworkPolicy("https://github.com/x"))
+	assert.NoError(t, CheckNetworkPolicy("https://objects.github.com/x"))
+	assert.Error(t, CheckNetworkPolicy("https://example.com/x"))
+
+	// Network access can be disabled entirely
+	assert.NoError(t, config.Set("network_access", "off", false))
+	assert.False(t, IsNetworkAllowed())
+	assert.Error(t, CheckNetworkPolicy("https://github.com/x"))
+}
+
+func TestNetworkAccessTrust(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Chdir(t.TempDir())
+
+	// The project's config can turn network access off
+	assert.NoError(t, config.Set("network_access", "off", false))
+	assert.False(t, IsNetworkAllowed())
+
+	// but only turns it on against the user's config in trusted workspaces
+	assert.NoError(t, config.Set("network_access", "off", true))
+	assert.NoError(t, config.Set("network_access", "on", false))
+	assert.False(t, IsNetworkAllowed())
+	trustWorkspace(t)
+	assert.True(t, IsNetworkAllowed())
+}
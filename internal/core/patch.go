@@ -0,0 +1,516 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// The most context lines a hunk may lose at its start and end when it doesn't match otherwise,
+// like the fuzz factor of patch
+const maxPatchFuzz = 2
+
+// Matches a hunk header, the line numbers are optional since models often leave them out
+var hunkHeaderRegex = regexp.MustCompile(`^@@(?: -(\d+)(?:,\d+)? \+\d+(?:,\d+)? @@)?`)
+
+// filePatch is the part of a unified diff that changes one file
+type filePatch struct {
+	oldPath string // "" for a new file
+	newPath string // "" for a deleted file
+	hunks   []patchHunk
+}
+
+// patchHunk is one @@ section of a file patch
+type patchHunk struct {
+	header   string
+	oldStart int // 1-based line number, 0 if the header has none
+	lines    []patchLine
+}
+
+// patchLine is a line of a hunk, op is ' ' for context, '-' for a removed and '+' for an added line
+type patchLine struct {
+	op   byte
+	text string
+}
+
+// patchedFile is the result of applying a file patch
+type patchedFile struct {
+	path    string
+	oldPath string // Set if the file was renamed
+	content string
+	created bool
+	deleted bool
+}
+
+// parsePatch parses the files of a unified diff. Line counts in hunk headers are ignored, a
+// hunk ends at the next hunk or file header, so hunks with wrong counts still apply.
+func parsePatch(text string) ([]filePatch, error) {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	// The final newline of the patch doesn't start another line
+	if len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	var patches []filePatch
+	var current *filePatch
+	var hunk *patchHunk
+	// Empty lines at the end of a hunk separate it from the next file rather than being context
+	bareEmptyLines := 0
+	endHunk := func() {
+		if hunk != nil {
+			hunk.lines = hunk.lines[:len(hunk.lines)-bareEmptyLines]
+		}
+		hunk = nil
+		bareEmptyLines = 0
+	}
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		if strings.HasPrefix(line, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ ") {
+			endHunk()
+			patches = append(patches, filePatch{
+				oldPath: parsePatchPath(line[4:], "a/"),
+				newPath: parsePatchPath(lines[i+1][4:], "b/"),
+			})
+			current = &patches[len(patches)-1]
+			i++
+			continue
+		}
+		if match := hunkHeaderRegex.FindStringSubmatch(line); match != nil {
+			if current == nil {
+				return nil, fmt.Errorf("hunk %q comes before a --- and +++ file header", line)
+			}
+			endHunk()
+			current.hunks = append(current.hunks, patchHunk{header: line})
+			hunk = &current.hunks[len(current.hunks)-1]
+			if match[1] != "" {
+				hunk.oldStart, _ = strconv.Atoi(match[1])
+			}
+			continue
+		}
+		if hunk == nil {
+			// Lines between files like "diff --git" and "index" carry nothing needed
+			continue
+		}
+		switch {
+		case line == "":
+			// Editors and models often strip the space of empty context lines
+			hunk.lines = append(hunk.lines, patchLine{' ', ""})
+			bareEmptyLines++
+		case line[0] == ' ' || line[0] == '-' || line[0] == '+':
+			hunk.lines = append(hunk.lines, patchLine{line[0], line[1:]})
+			bareEmptyLines = 0
+		case line[0] == '\\':
+			// "\ No newline at end of file"
+		default:
+			endHunk()
+		}
+	}
+	endHunk()
+
+	if len(patches) == 0 {
+		return nil, fmt.Errorf("no files found, the patch needs --- and +++ headers for every file")
+	}
+	for _, patch := range patches {
+		if len(patch.hunks) == 0 {
+			return nil, fmt.Errorf("no hunks found for %s", patch.displayPath())
+		}
+		if patch.oldPath == "" && patch.newPath == "" {
+			return nil, fmt.Errorf("a file patch needs a path")
+		}
+	}
+	return patches, nil
+}
+
+// parsePatchPath returns the path of a --- or +++ header without the a/ or b/ prefix of git
+// and a trailing timestamp, or "" for /dev/null
+func parsePatchPath(header string, prefix string) string {
+	path := header
+	if tab := strings.Index(path, "\t"); tab >= 0 {
+		path = path[:tab]
+	}
+	path = strings.TrimSpace(path)
+	if path == "/dev/null" {
+		return ""
+	}
+	if strings.HasPrefix(path, prefix) {
+		path = path[len(prefix):]
+	}
+	return path
+}
+
+// displayPath returns the path a file patch is reported with
+func (p filePatch) displayPath() string {
+	if p.newPath != "" {
+		return p.newPath
+	}
+	return p.oldPath
+}
+
+// PatchFiles returns the paths a unified diff changes, relative to the working directory, or nil
+// if the patch can't be parsed
+func PatchFiles(patch string) []string {
+	patches, err := parsePatch(unescapeXML(patch))
+	if err != nil {
+		return nil
+	}
+	var paths []string
+	seen := make(map[string]bool)
+	for _, p := range patches {
+		for _, path := range []string{p.oldPath, p.newPath} {
+			if path != "" && !seen[path] {
+				seen[path] = true
+				paths = append(paths, ResolvePath(path))
+			}
+		}
+	}
+	return paths
+}
+
+// applyFilePatch applies the hunks of a file patch to the content of the file. It returns the new
+// content, notes about hunks that only matched at another line or inexactly, and the hunks that
+// didn't match.
+func applyFilePatch(patch filePatch, content string) (string, []string, []string) {
+	var lines []string
+	if content != "" {
+		lines = strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	}
+	path := patch.displayPath()
+
+	var notes, conflicts []string
+	// Hunks are applied in order, each one after the lines of the previous one
+	offset, minLine := 0, 0
+	for i, hunk := range patch.hunks {
+		expected := hunk.oldStart - 1 + offset
+		if hunk.oldStart == 0 {
+			expected = minLine
+		}
+		// A hunk without old lines adds lines at its position, e.g. to an empty file
+		var oldLines []string
+		for _, line := range hunk.lines {
+			if line.op != '+' {
+				oldLines = append(oldLines, line.text)
+			}
+		}
+		if len(oldLines) == 0 {
+			// The header of such a hunk has the line the lines are added after
+			pos := expected
+			if hunk.oldStart != 0 {
+				pos = hunk.oldStart + offset
+			}
+			if pos < minLine {
+				pos = minLine
+			}
+			if pos > len(lines) {
+				pos = len(lines)
+			}
+			added := hunkNewLines(hunk.lines, nil)
+			lines = append(lines[:pos], append(added, lines[pos:]...)...)
+			offset += len(added)
+			minLine = pos + len(added)
+			continue
+		}
+
+		pos, fuzz, mode := findHunk(lines, hunk.lines, expected, minLine)
+		if pos < 0 {
+			conflicts = append(conflicts, fmt.Sprintf("Hunk #%d (%s) of %s doesn't match, these lines weren't found:\n%s",
+				i+1, hunk.header, path, strings.Join(oldLines, "\n")))
+			continue
+		}
+
+		hunkLines := hunk.lines[fuzz[0] : len(hunk.lines)-fuzz[1]]
+		matched := 0
+		for _, line := range hunkLines {
+			if line.op != '+' {
+				matched++
+			}
+		}
+		replacement := hunkNewLines(hunkLines, lines[pos:pos+matched])
+		lines = append(lines[:pos], append(replacement, lines[pos+matched:]...)...)
+
+		var how []string
+		if hunk.oldStart != 0 && pos-fuzz[0] != hunk.oldStart-1+offset {
+			how = append(how, fmt.Sprintf("at line %d instead of %d", pos-fuzz[0]+1, hunk.oldStart))
+		}
+		if mode != "" {
+			how = append(how, mode)
+		}
+		if fuzz[0]+fuzz[1] > 0 {
+			how = append(how, fmt.Sprintf("without %d context lines", fuzz[0]+fuzz[1]))
+		}
+		if len(how) > 0 {
+			notes = append(notes, fmt.Sprintf("Hunk #%d of %s applied %s", i+1, path, strings.Join(how, ", ")))
+		}
+		offset += len(replacement) - matched
+		minLine = pos + len(replacement)
+	}
+
+	if len(lines) == 0 {
+		return "", notes, conflicts
+	}
+	return strings.Join(lines, "\n") + "\n", notes, conflicts
+}
+
+// hunkNewLines returns the lines a hunk results in. Context lines are taken from the file when
+// they were matched inexactly, so only the removed and added lines change.
+func hunkNewLines(hunkLines []patchLine, fileLines []string) []string {
+	var result []string
+	fileIndex := 0
+	for _, line := range hunkLines {
+		switch line.op {
+		case ' ':
+			if fileIndex < len(fileLines) {
+				result = append(result, fileLines[fileIndex])
+			} else {
+				result = append(result, line.text)
+			}
+			fileIndex++
+		case '-':
+			fileIndex++
+		case '+':
+			result = append(result, line.text)
+		}
+	}
+	return result
+}
+
+// findHunk finds the lines a hunk changes. Exact matches are tried first, then matches that ignore
+// whitespace, then matches without some of the leading and trailing context lines. Among the
+// matches of a kind the one closest to the expected line wins. It returns the line the matched
+// lines start at or -1, the context lines left out at the start and end, and how the lines were
+// compared if not exactly.
+func findHunk(lines []string, hunkLines []patchLine, expected int, minLine int) (int, [2]int, string) {
+	compares := []struct {
+		mode  string
+		equal func(a, b string) bool
+	}{
+		{"", func(a, b string) bool { return a == b }},
+		{"ignoring trailing whitespace", func(a, b string) bool {
+			return strings.TrimRight(a, " \t") == strings.TrimRight(b, " \t")
+		}},
+		{"ignoring whitespace", func(a, b string) bool {
+			return strings.Join(strings.Fields(a), " ") == strings.Join(strings.Fields(b), " ")
+		}},
+	}
+
+	for fuzz := 0; fuzz <= maxPatchFuzz; fuzz++ {
+		for _, trim := range fuzzTrims(hunkLines, fuzz) {
+			var oldLines []string
+			for _, line := range hunkLines[trim[0] : len(hunkLines)-trim[1]] {
+				if line.op != '+' {
+					oldLines = append(oldLines, line.text)
+				}
+			}
+			// Context alone could match anywhere
+			if len(oldLines) == 0 || (fuzz > 0 && len(oldLines) < 2) {
+				continue
+			}
+			for _, compare := range compares {
+				if pos := closestMatch(lines, oldLines, expected+trim[0], minLine, compare.equal); pos >= 0 {
+					return pos, trim, compare.mode
+				}
+			}
+		}
+	}
+	return -1, [2]int{}, ""
+}
+
+// fuzzTrims returns the ways to leave out fuzz context lines in total from the start and end of a
+// hunk. Only context lines are left out, never removed or added lines.
+func fuzzTrims(hunkLines []patchLine, fuzz int) [][2]int {
+	leading, trailing := 0, 0
+	for leading < len(hunkLines) && hunkLines[leading].op == ' ' {
+		leading++
+	}
+	for trailing < len(hunkLines)-leading && hunkLines[len(hunkLines)-1-trailing].op == ' ' {
+		trailing++
+	}
+
+	var trims [][2]int
+	for start := 0; start <= fuzz; start++ {
+		end := fuzz - start
+		if start <= leading && end <= trailing {
+			trims = append(trims, [2]int{start, end})
+		}
+	}
+	return trims
+}
+
+// closestMatch returns the start of the match of want in lines closest to expected, not starting
+// before minLine, or -1
+func closestMatch(lines []string, want []string, expected int, minLine int, equal func(a, b string) bool) int {
+	matchesAt := func(pos int) bool {
+		for i, line := range want {
+			if !equal(lines[pos+i], line) {
+				return false
+			}
+		}
+		return true
+	}
+
+	last := len(lines) - len(want)
+	if expected < minLine {
+		expected = minLine
+	}
+	if expected > last {
+		expected = last
+	}
+	for distance := 0; expected-distance >= minLine || expected+distance <= last; distance++ {
+		if pos := expected - distance; pos >= minLine && pos <= last && matchesAt(pos) {
+			return pos
+		}
+		if pos := expected + distance; distance > 0 && pos >= minLine && pos <= last && matchesAt(pos) {
+			return pos
+		}
+	}
+	return -1
+}
+
+// applyPatchContents applies the file patches to the contents read with readFile, which returns
+// false for missing files. Nothing is written. Sections for a path patched by an earlier section
+// apply to its result, so a patch may change a file in several sections.
+func applyPatchContents(patches []filePatch, readFile func(path string) (string, bool, error)) ([]patchedFile, []string, []string) {
+	var paths []string
+	patched := make(map[string]*patchedFile)
+	renamed := make(map[string]bool)
+	read := func(path string) (string, bool, error) {
+		if renamed[path] {
+			return "", false, nil
+		}
+		if earlier, ok := patched[path]; ok {
+			return earlier.content, !earlier.deleted, nil
+		}
+		return readFile(path)
+	}
+
+	var notes, conflicts []string
+	for _, patch := range patches {
+		result := patchedFile{path: ResolvePath(patch.newPath)}
+		source := patch.oldPath
+		if source == "" {
+			result.created = true
+			source = patch.newPath
+		}
+		if patch.newPath == "" {
+			result.path = ResolvePath(patch.oldPath)
+			result.deleted = true
+		} else if patch.oldPath != "" && patch.oldPath != patch.newPath {
+			result.oldPath = ResolvePath(patch.oldPath)
+		}
+
+		content, exists, err := read(ResolvePath(source))
+		if err != nil {
+			conflicts = append(conflicts, fmt.Sprintf("Can't read %s: %s", source, err))
+			continue
+		}
+		if result.created && exists {
+			conflicts = append(conflicts, fmt.Sprintf("%s is a new file in the patch but already exists", patch.newPath))
+			continue
+		}
+		if !result.created && !exists {
+			conflicts = append(conflicts, fmt.Sprintf("%s doesn't exist", source))
+			continue
+		}
+
+		newContent, fileNotes, fileConflicts := applyFilePatch(patch, content)
+		notes = append(notes, fileNotes...)
+		conflicts = append(conflicts, fileConflicts...)
+		if result.deleted && len(fileConflicts) == 0 && newContent != "" {
+			conflicts = append(conflicts, fmt.Sprintf("%s is deleted in the patch but has lines the patch doesn't remove", patch.oldPath))
+		}
+		result.content = newContent
+
+		// A file patched before is changed once, as it is on disk before the patch
+		if earlier, ok := patched[result.path]; ok {
+			result.created = earlier.created
+			if result.oldPath == "" {
+				result.oldPath = earlier.oldPath
+			}
+		} else {
+			paths = append(paths, result.path)
+		}
+		patched[result.path] = &result
+		delete(renamed, result.path)
+		if result.oldPath != "" {
+			renamed[result.oldPath] = true
+		}
+	}
+
+	var results []patchedFile
+	for _, path := range paths {
+		// Files created and deleted again by the patch are left alone
+		if result := patched[path]; !(result.created && result.deleted) {
+			results = append(results, *result)
+		}
+	}
+	return results, notes, conflicts
+}
+
+// ApplyPatch applies a unified diff that may change several files. Hunks are found near their
+// line numbers and may match with changed whitespace or missing context lines. If a hunk doesn't
+// match, no file is changed and the conflicting hunks are reported.
+func ApplyPatch(params map[string]interface{}) string {
+	patchText, ok := params["patch"].(string)
+	if !ok || strings.TrimSpace(patchText) == "" {
+		return "Error: Missing patch parameter"
+	}
+
+	patches, err := parsePatch(unescapeXML(patchText))
+	if err != nil {
+		return fmt.Sprintf("Error: Invalid patch: %s", err)
+	}
+
+	results, notes, conflicts := applyPatchContents(patches, func(path string) (string, bool, error) {
+		data, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			return "", false, nil
+		}
+		if err != nil {
+			return "", false, err
+		}
+		return getFileFormat(data, true).decode(data), true, nil
+	})
+	if len(conflicts) > 0 {
+		return fmt.Sprintf("Error: The patch doesn't apply, no files were changed.\n\n%s\n\nRead the files again and create the patch from their current content.",
+			strings.Join(conflicts, "\n\n"))
+	}
+
+	var changed []originalFile
+	for _, result := range results {
+		var original originalFile
+		if result.deleted {
+			original, err = removeFileOfTransaction(result.path)
+		} else {
+			original, err = writeFileOfTransaction(result.path, result.content)
+		}
+		if err == nil && result.oldPath != "" {
+			changed = append(changed, original)
+			original, err = removeFileOfTransaction(result.oldPath)
+		}
+		if err != nil {
+			rollbackFileWrites(changed)
+			return fmt.Sprintf("Error writing file %s: %s. No files were changed.", result.path, err)
+		}
+		changed = append(changed, original)
+	}
+
+	var output strings.Builder
+	output.WriteString(fmt.Sprintf("Patch successfully applied to %d files:", len(results)))
+	for _, result := range results {
+		switch {
+		case result.created:
+			output.WriteString("\n- " + result.path + " (created)")
+		case result.deleted:
+			output.WriteString("\n- " + result.path + " (deleted)")
+		case result.oldPath != "":
+			output.WriteString(fmt.Sprintf("\n- %s (renamed from %s)", result.path, result.oldPath))
+		default:
+			output.WriteString("\n- " + result.path)
+		}
+	}
+	if len(notes) > 0 {
+		output.WriteString("\n\nSome hunks didn't match exactly, check that they were applied at the right place:\n" + strings.Join(notes, "\n"))
+	}
+	return output.String()
+}
@@ -0,0 +1,142 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyPatch(t *testing.T) {
+	dir := t.TempDir()
+	mainPath := filepath.Join(dir, "main.go")
+	oldPath := filepath.Join(dir, "old.txt")
+	require.NoError(t, os.WriteFile(mainPath, []byte("package main\n\nimport \"fmt\"\n\nfunc main() {\n\tfmt.Println(\"hello\")\n}\n"), 0644))
+	require.NoError(t, os.WriteFile(oldPath, []byte("obsolete\n"), 0644))
+
+	patch := `diff --git a/main.go b/main.go
+--- a/` + mainPath + `
++++ b/` + mainPath + `
+@@ -5,3 +5,4 @@ import "fmt"
+ func main() {
+-	fmt.Println("hello")
++	fmt.Println("hello, world")
++	fmt.Println("bye")
+ }
+--- /dev/null
++++ ` + filepath.Join(dir, "docs", "notes.md") + `
+@@ -0,0 +1,2 @@
++# Notes
++a &amp; b
+--- ` + oldPath + `
++++ /dev/null
+@@ -1 +0,0 @@
+-obsolete
+`
+	result := ApplyPatch(map[string]interface{}{"patch": patch})
+	assert.Contains(t, result, "Patch successfully applied to 3 files")
+	assert.Contains(t, result, "notes.md (created)")
+	assert.Contains(t, result, "old.txt (deleted)")
+	assert.NotContains(t, result, "didn't match exactly")
+
+	content, err := os.ReadFile(mainPath)
+	require.NoError(t, err)
+	assert.Equal(t, "package main\n\nimport \"fmt\"\n\nfunc main() {\n\tfmt.Println(\"hello, world\")\n\tfmt.Println(\"bye\")\n}\n", string(content))
+	content, err = os.ReadFile(filepath.Join(dir, "docs", "notes.md"))
+	require.NoError(t, err)
+	assert.Equal(t, "# Notes\na & b\n", string(content))
+	assert.NoFileExists(t, oldPath)
+}
+
+func TestApplyPatchFuzzy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.py")
+	require.NoError(t, os.WriteFile(path, []byte("# Settings\r\n\r\nDEBUG = False\r\nPORT = 8080  \r\nHOST = 'localhost'\r\n"), 0644))
+
+	// Wrong line numbers, a missing trailing space, a context line that changed and no line counts
+	patch := "--- a/" + path + "\n+++ b/" + path + "\n@@ -10,4 +10,4 @@\n DEBUG = False\n-PORT = 8080\n+PORT = 9090\n HOST = '0.0.0.0'\n"
+	result := ApplyPatch(map[string]interface{}{"patch": patch})
+	assert.Contains(t, result, "Patch successfully applied to 1 files")
+	assert.Contains(t, result, "Hunk #1 of "+path+" applied at line 3 instead of 10, ignoring trailing whitespace, without 1 context lines")
+
+	// Line endings of the file are kept and unmatched context isn't changed
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "# Settings\r\n\r\nDEBUG = False\r\nPORT = 9090\r\nHOST = 'localhost'\r\n", string(content))
+
+	patch = "--- " + path + "\n+++ " + path + "\n@@\n-    DEBUG   = False\n+DEBUG = True\n"
+	result = ApplyPatch(map[string]interface{}{"patch": patch})
+	assert.Contains(t, result, "ignoring whitespace")
+	content, err = os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(content), "DEBUG = True\r\n")
+}
+
+func TestApplyPatchSamePath(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "list.txt")
+	created := filepath.Join(dir, "new.txt")
+	require.NoError(t, os.WriteFile(path, []byte("one\ntwo\nthree\nfour\nfive\n"), 0644))
+
+	// Later sections of a file apply to the result of the earlier ones, none of their hunks is lost
+	patch := "--- " + path + "\n+++ " + path + "\n@@ -1,2 +1,2 @@\n-one\n+1\n two\n" +
+		"--- /dev/null\n+++ " + created + "\n@@ -0,0 +1 @@\n+first\n" +
+		"--- " + path + "\n+++ " + path + "\n@@ -4,2 +4,2 @@\n four\n-five\n+5\n" +
+		"--- " + created + "\n+++ " + created + "\n@@ -1 +1,2 @@\n first\n+second\n"
+	result := ApplyPatch(map[string]interface{}{"patch": patch})
+	assert.Contains(t, result, "Patch successfully applied to 2 files")
+	assert.Contains(t, result, "new.txt (created)")
+
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "1\ntwo\nthree\nfour\n5\n", string(content))
+	content, err = os.ReadFile(created)
+	require.NoError(t, err)
+	assert.Equal(t, "first\nsecond\n", string(content))
+
+	// A file renamed by an earlier section no longer exists for later ones
+	renamed := filepath.Join(dir, "renamed.txt")
+	patch = "--- " + path + "\n+++ " + renamed + "\n@@ -1 +1 @@\n-1\n+one\n" +
+		"--- " + path + "\n+++ " + path + "\n@@ -2 +2 @@\n-two\n+2\n"
+	assert.Contains(t, ApplyPatch(map[string]interface{}{"patch": patch}), path+" doesn't exist")
+	assert.FileExists(t, path)
+	assert.NoFileExists(t, renamed)
+}
+
+func TestApplyPatchConflicts(t *testing.T) {
+	dir := t.TempDir()
+	first := filepath.Join(dir, "first.txt")
+	second := filepath.Join(dir, "second.txt")
+	require.NoError(t, os.WriteFile(first, []byte("one\ntwo\nthree\n"), 0644))
+	require.NoError(t, os.WriteFile(second, []byte("alpha\nbeta\n"), 0644))
+
+	// The first file would apply, but nothing is changed because the second doesn't
+	patch := "--- " + first + "\n+++ " + first + "\n@@ -1,3 +1,3 @@\n one\n-two\n+2\n three\n" +
+		"--- " + second + "\n+++ " + second + "\n@@ -1,2 +1,2 @@\n alpha\n-gamma\n+delta\n"
+	result := ApplyPatch(map[string]interface{}{"patch": patch})
+	assert.Contains(t, result, "Error: The patch doesn't apply, no files were changed")
+	assert.Contains(t, result, "Hunk #1 (@@ -1,2 +1,2 @@) of "+second+" doesn't match")
+	assert.Contains(t, result, "gamma")
+	content, err := os.ReadFile(first)
+	require.NoError(t, err)
+	assert.Equal(t, "one\ntwo\nthree\n", string(content))
+
+	patch = "--- /dev/null\n+++ " + first + "\n@@ -0,0 +1 @@\n+new\n"
+	assert.Contains(t, ApplyPatch(map[string]interface{}{"patch": patch}), "is a new file in the patch but already exists")
+
+	assert.Equal(t, "Error: Missing patch parameter", ApplyPatch(map[string]interface{}{}))
+	assert.Contains(t, ApplyPatch(map[string]interface{}{"patch": "just text"}), "Error: Invalid patch: no files found")
+	assert.Contains(t, ApplyPatch(map[string]interface{}{"patch": "@@ -1 +1 @@\n-a\n+b\n"}), "comes before a --- and +++ file header")
+}
+
+func TestPatchFiles(t *testing.T) {
+	patch := "diff --git a/a.go b/b.go\n--- a/a.go\n+++ b/b.go\n@@ -1 +1 @@\n-x\n+y\n\n--- a/c.go\n+++ b/c.go\n@@ -1 +1 @@\n-x\n+y\n"
+	assert.Equal(t, []string{"a.go", "b.go", "c.go"}, PatchFiles(patch))
+
+	// The empty line between the files isn't context of the first hunk
+	patches, err := parsePatch(patch)
+	require.NoError(t, err)
+	assert.Len(t, patches[0].hunks[0].lines, 2)
+	assert.Nil(t, PatchFiles("not a patch"))
+}
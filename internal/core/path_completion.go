@@ -0,0 +1,166 @@
+package core
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Maximum number of paths completed at once
+const maxPathCompletions = 20
+
+// completionPath returns the form of a path used in prompts: relative to the working directory,
+// with forward slashes
+func completionPath(path string) string {
+	if rel, err := filepath.Rel(GetWorkingDir(), path); err == nil {
+		return toPosix(rel)
+	}
+	return toPosix(path)
+}
+
+// CompletePathPrefix returns the entries of the directory of a partial path whose names start
+// with the rest of it, like a shell completes paths. Directories end with "/", hidden entries are
+// only returned if the name starts with ".".
+func CompletePathPrefix(partial string) []string {
+	dir, prefix := path.Split(filepath.ToSlash(partial))
+	searchDir := dir
+	if searchDir == "" {
+		searchDir = "."
+	}
+	if !filepath.IsAbs(searchDir) {
+		searchDir = filepath.Join(GetWorkingDir(), searchDir)
+	}
+	entries, err := os.ReadDir(searchDir)
+	if err != nil {
+		return nil
+	}
+
+	var matches []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, prefix) || (strings.HasPrefix(name, ".") && !strings.HasPrefix(prefix, ".")) {
+			continue
+		}
+		if entry.IsDir() {
+			name += "/"
+		}
+		matches = append(matches, dir+name)
+		if len(matches) >= maxPathCompletions {
+			break
+		}
+	}
+	sort.Strings(matches)
+	return matches
+}
+
+// CompleteGitMention returns the git: mentions of prompts that start with a partial one: staged
+// for the staged changes, diff for the uncommitted changes, and the local branches for the
+// changes since them
+func CompleteGitMention(partial string) []string {
+	targets := []string{"staged", "diff"}
+	if branches, err := runGit(GetWorkingDir(), "for-each-ref", "--format=%(refname:short)", "refs/heads"); err == nil {
+		targets = append(targets, strings.Fields(branches)...)
+	}
+	var matches []string
+	for _, target := range targets {
+		if strings.HasPrefix(target, partial) && len(matches) < maxPathCompletions {
+			matches = append(matches, target)
+		}
+	}
+	return matches
+}
+
+// FuzzyFindFiles returns the files of the workspace whose paths contain the characters of the
+// query in order, the best matches first. Hidden files and dependency or build output
+// directories are left out like in the repository map.
+func FuzzyFindFiles(query string) []string {
+	query = strings.ToLower(filepath.ToSlash(query))
+	if query == "" {
+		return nil
+	}
+
+	type match struct {
+		path  string
+		score int
+	}
+	var matches []match
+	walked := 0
+	for _, root := range GetWorkspaceRoots() {
+		filepath.WalkDir(root, func(file string, entry fs.DirEntry, err error) error {
+			if err != nil || file == root {
+				return nil
+			}
+			if skipRepoMapEntry(entry) {
+				if entry.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if entry.IsDir() {
+				return nil
+			}
+			if walked++; walked > maxRepoMapFiles {
+				return filepath.SkipAll
+			}
+			candidate := completionPath(file)
+			if score, ok := fuzzyScore(candidate, query); ok {
+				matches = append(matches, match{candidate, score})
+			}
+			return nil
+		})
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].score != matches[j].score {
+			return matches[i].score > matches[j].score
+		}
+		if len(matches[i].path) != len(matches[j].path) {
+			return len(matches[i].path) < len(matches[j].path)
+		}
+		return matches[i].path < matches[j].path
+	})
+	var result []string
+	for i := 0; i < len(matches) && i < maxPathCompletions; i++ {
+		result = append(result, matches[i].path)
+	}
+	return result
+}
+
+// fuzzyScore returns how well a path matches a lower case query whose characters it contains in
+// order. Consecutive characters, characters at the start of a word and matches in the file name
+// score higher.
+func fuzzyScore(candidate string, query string) (int, bool) {
+	lower := strings.ToLower(candidate)
+	base := strings.LastIndex(lower, "/") + 1
+	score := 0
+	previous := -2
+	position := 0
+	for _, char := range query {
+		index := strings.IndexRune(lower[position:], char)
+		if index < 0 {
+			return 0, false
+		}
+		index += position
+		switch {
+		case index == previous+1:
+			score += 5
+		case index == 0 || !unicode.IsLetter(rune(lower[index-1])) && !unicode.IsDigit(rune(lower[index-1])):
+			score += 3
+		default:
+			score++
+		}
+		if index >= base {
+			score += 2
+		}
+		previous = index
+		position = index + len(string(char))
+	}
+	if strings.Contains(lower[base:], query) {
+		score += 10
+	}
+	return score, true
+}
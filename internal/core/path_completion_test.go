@@ -0,0 +1,84 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func createCompletionFiles(t *testing.T) string {
+	root := t.TempDir()
+	t.Chdir(root)
+	for _, path := range []string{
+		"cmd/nca/main.go",
+		"cmd/nca/commands.go",
+		"internal/core/checkpoint.go",
+		"internal/core/path_completion.go",
+		"README.md",
+		".env",
+		"node_modules/lib/main.js",
+	} {
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte("x\n"), 0644))
+	}
+	return root
+}
+
+func TestCompletePathPrefix(t *testing.T) {
+	createCompletionFiles(t)
+
+	assert.Equal(t, []string{"cmd/"}, CompletePathPrefix("c"))
+	assert.Equal(t, []string{"cmd/nca/commands.go"}, CompletePathPrefix("cmd/nca/co"))
+	assert.Equal(t, []string{"internal/core/checkpoint.go", "internal/core/path_completion.go"}, CompletePathPrefix("internal/core/"))
+	assert.Equal(t, []string{"README.md", "cmd/", "internal/", "node_modules/"}, CompletePathPrefix(""))
+	assert.Equal(t, []string{".env"}, CompletePathPrefix(".e"))
+	assert.Nil(t, CompletePathPrefix("missing/"))
+}
+
+func TestFuzzyFindFiles(t *testing.T) {
+	root := createCompletionFiles(t)
+	defer SetWorkspaceRoots(nil)
+	require.NoError(t, SetWorkspaceRoots([]string{root}))
+
+	matches := FuzzyFindFiles("main")
+	assert.Equal(t, []string{"cmd/nca/main.go"}, matches)
+
+	matches = FuzzyFindFiles("pathcomp")
+	require.NotEmpty(t, matches)
+	assert.Equal(t, "internal/core/path_completion.go", matches[0])
+
+	matches = FuzzyFindFiles("ccmd")
+	require.NotEmpty(t, matches)
+	assert.Equal(t, "cmd/nca/commands.go", matches[0])
+
+	assert.Nil(t, FuzzyFindFiles("xyz"))
+	assert.Nil(t, FuzzyFindFiles(""))
+}
+
+func TestFuzzyScore(t *testing.T) {
+	_, ok := fuzzyScore("cmd/nca/main.go", "mn")
+	assert.True(t, ok)
+	_, ok = fuzzyScore("cmd/nca/main.go", "nm")
+	assert.True(t, ok)
+	_, ok = fuzzyScore("main.go", "gm")
+	assert.False(t, ok)
+
+	consecutive, _ := fuzzyScore("src/main.go", "main")
+	scattered, _ := fuzzyScore("src/my_admin.go", "main")
+	assert.Greater(t, consecutive, scattered)
+}
+
+func TestCompleteGitMention(t *testing.T) {
+	dir := initGitRepo(t, map[string]string{"a.txt": "a\n"})
+	t.Chdir(dir)
+	_, err := runGit(dir, "branch", "feature")
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"staged"}, CompleteGitMention("s"))
+	assert.Equal(t, []string{"feature"}, CompleteGitMention("fe"))
+	assert.Contains(t, CompleteGitMention(""), "diff")
+	assert.Nil(t, CompleteGitMention("missing"))
+}
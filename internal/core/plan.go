@@ -0,0 +1,257 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// PlannedAction is a tool call that plan mode recorded instead of executing
+type PlannedAction struct {
+	Tool    string
+	Params  map[string]interface{}
+	Summary string // One line describing what the call does
+	Preview string // The diff or command shown to the user
+}
+
+// Plan mode state. plannedContents holds the contents files will have after the planned
+// edits, so a later edit of the same file applies to its planned content.
+var (
+	planMode        bool
+	plannedActions  []PlannedAction
+	plannedContents = make(map[string]string)
+	planMutex       sync.Mutex
+)
+
+// SetPlanMode turns plan mode on or off. The recorded plan is kept until it's applied or cleared.
+func SetPlanMode(enabled bool) {
+	planMutex.Lock()
+	defer planMutex.Unlock()
+	planMode = enabled
+}
+
+// IsPlanMode returns whether mutating tool calls are recorded instead of executed
+func IsPlanMode() bool {
+	planMutex.Lock()
+	defer planMutex.Unlock()
+	return planMode
+}
+
+// GetPlan returns the recorded actions in the order they were planned
+func GetPlan() []PlannedAction {
+	planMutex.Lock()
+	defer planMutex.Unlock()
+	return append([]PlannedAction(nil), plannedActions...)
+}
+
+// ClearPlan discards the recorded actions
+func ClearPlan() {
+	planMutex.Lock()
+	defer planMutex.Unlock()
+	plannedActions = nil
+	plannedContents = make(map[string]string)
+}
+
+// PlanToolCall records a tool call that would change files, commit or run a command that needs
+// approval. It returns the result given to the model and whether the call was recorded, other
+// calls aren't recorded and run as usual. Commands that don't require approval still run so the
+// model can explore the project while planning.
+func PlanToolCall(toolName string, params map[string]interface{}) (string, bool) {
+	planMutex.Lock()
+	defer planMutex.Unlock()
+
+	var summary, preview string
+	switch toolName {
+	case "write_to_file":
+		path, _ := params["path"].(string)
+		content, ok := params["content"].(string)
+		if path == "" || !ok {
+			return "", false
+		}
+		summary, preview = planFileWrite(path, unescapeXML(content))
+	case "write_files":
+		files, _ := params["files"].([]FileWrite)
+		if len(files) == 0 {
+			return "", false
+		}
+		var paths, previews []string
+		for _, file := range files {
+			if file.Path == "" {
+				return "", false
+			}
+			_, filePreview := planFileWrite(file.Path, unescapeXML(file.Content))
+			paths = append(paths, file.Path)
+			previews = append(previews, filePreview)
+		}
+		summary = fmt.Sprintf("Write %d files: %s", len(files), strings.Join(paths, ", "))
+		preview = strings.Join(previews, "\n")
+	case "replace_in_file":
+		path, _ := params["path"].(string)
+		diff, ok := params["diff"].(string)
+		if path == "" || !ok {
+			return "", false
+		}
+		original, err := plannedContent(path)
+		if err != nil {
+			return fmt.Sprintf("Error reading file: %s", err), true
+		}
+		diff = strings.ReplaceAll(unescapeXML(diff), "\r\n", "\n")
+		updated, _, err := applySearchReplaceBlocks(original, diff)
+		if err != nil {
+			return fmt.Sprintf("Error: %s", err), true
+		}
+		plannedContents[planKey(path)] = updated
+		summary = "Edit " + path
+		preview = generateGitStyleDiff(path, original, updated)
+	case "apply_patch":
+		patchText, _ := params["patch"].(string)
+		patches, err := parsePatch(unescapeXML(patchText))
+		if err != nil {
+			return fmt.Sprintf("Error: Invalid patch: %s", err), true
+		}
+		results, _, conflicts := applyPatchContents(patches, func(path string) (string, bool, error) {
+			content, err := plannedContent(path)
+			if os.IsNotExist(err) {
+				return "", false, nil
+			}
+			return content, err == nil, err
+		})
+		if len(conflicts) > 0 {
+			return fmt.Sprintf("Error: The patch doesn't apply, no files were changed.\n\n%s", strings.Join(conflicts, "\n\n")), true
+		}
+		var paths, previews []string
+		for _, result := range results {
+			source := result.path
+			if result.oldPath != "" {
+				source = result.oldPath
+			}
+			original, _ := plannedContent(source)
+			// Deleted and renamed files are planned as empty
+			plannedContents[planKey(source)] = ""
+			plannedContents[planKey(result.path)] = result.content
+			paths = append(paths, result.path)
+			previews = append(previews, generateGitStyleDiff(result.path, original, result.content))
+		}
+		summary = "Patch " + strings.Join(paths, ", ")
+		preview = strings.Join(previews, "\n")
+	case "download_file":
+		url, _ := params["url"].(string)
+		path, _ := params["path"].(string)
+		if url == "" || path == "" {
+			return "", false
+		}
+		summary = fmt.Sprintf("Download %s to %s", url, path)
+		preview = summary
+	case "git_commit":
+		message, _ := params["message"].(string)
+		files, _ := params["files"].([]string)
+		stagedOnly, _ := params["staged_only"].(bool)
+		amend, _ := params["amend"].(bool)
+		if len(files) == 0 && !stagedOnly && !amend {
+			return "", false
+		}
+		what := strings.Join(files, ", ")
+		if stagedOnly || len(files) == 0 {
+			what = "the staged changes"
+		}
+		if message == "" {
+			message = "(proposed from the staged changes)"
+		}
+		summary = "Commit " + what
+		if amend {
+			summary = "Amend the last commit with " + what
+		}
+		preview = fmt.Sprintf("git commit of %s with message:\n%s", what, message)
+	case "git_stage_hunks":
+		path, _ := params["path"].(string)
+		hunks, _ := params["hunks"].(string)
+		// Listing the hunks changes nothing
+		if path == "" || hunks == "" {
+			return "", false
+		}
+		summary = fmt.Sprintf("Stage hunks %s of %s", hunks, path)
+		preview = summary
+	case "create_pull_request":
+		title, _ := params["title"].(string)
+		if title == "" {
+			return "", false
+		}
+		body, _ := params["body"].(string)
+		summary = fmt.Sprintf("Open pull request '%s'", title)
+		preview = fmt.Sprintf("Push the current branch and open pull request '%s':\n%s", title, body)
+	case "comment_on_pr":
+		body, _ := params["body"].(string)
+		if body == "" {
+			return "", false
+		}
+		pr, _ := params["pr"].(string)
+		if pr == "" {
+			pr = "of the current branch"
+		}
+		summary = "Comment on pull request " + pr
+		preview = fmt.Sprintf("%s:\n%s", summary, body)
+	case "execute_command":
+		command, _ := params["command"].(string)
+		requiresApproval, _ := params["requires_approval"].(bool)
+		if command == "" || !requiresApproval {
+			return "", false
+		}
+		summary = "Run " + command
+		preview = "$ " + command
+	default:
+		return "", false
+	}
+
+	plannedActions = append(plannedActions, PlannedAction{
+		Tool:    toolName,
+		Params:  copyParams(params),
+		Summary: summary,
+		Preview: preview,
+	})
+	return fmt.Sprintf("Plan mode: not executed, recorded as step %d of the plan: %s. Continue as if it succeeded.",
+		len(plannedActions), summary), true
+}
+
+// planFileWrite records the new content of a file and returns the summary and diff of the write.
+// The caller holds planMutex.
+func planFileWrite(path string, content string) (string, string) {
+	original, err := plannedContent(path)
+	summary := "Write " + path
+	if err != nil {
+		summary = "Create " + path
+	}
+	plannedContents[planKey(path)] = content
+	return summary, generateGitStyleDiff(path, original, content)
+}
+
+// plannedContent returns the planned content of a file, or its content on disk if no edit of it
+// was planned. The caller holds planMutex.
+func plannedContent(path string) (string, error) {
+	if content, ok := plannedContents[planKey(path)]; ok {
+		return content, nil
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return getFileFormat(content, true).decode(content), nil
+}
+
+// planKey identifies a file in the planned contents regardless of how its path was written
+func planKey(path string) string {
+	if absPath, err := filepath.Abs(path); err == nil {
+		return absPath
+	}
+	return path
+}
+
+// copyParams copies the parameters of a tool call, the caller may change the original map
+func copyParams(params map[string]interface{}) map[string]interface{} {
+	copied := make(map[string]interface{}, len(params))
+	for key, value := range params {
+		copied[key] = value
+	}
+	return copied
+}
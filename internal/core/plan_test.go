@@ -0,0 +1,86 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlanToolCall(t *testing.T) {
+	defer ClearPlan()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "main.go")
+	require.NoError(t, os.WriteFile(path, []byte("package main\n\nfunc main() {}\n"), 0644))
+
+	result, planned := PlanToolCall("replace_in_file", map[string]interface{}{
+		"path": path,
+		"diff": "<<<<<<< SEARCH\nfunc main() {}\n=======\nfunc main() {\n\tprintln(\"hi\")\n}\n>>>>>>> REPLACE",
+	})
+	assert.True(t, planned)
+	assert.Contains(t, result, "recorded as step 1 of the plan")
+
+	// A later edit applies to the planned content, the file itself is unchanged
+	result, planned = PlanToolCall("replace_in_file", map[string]interface{}{
+		"path": path,
+		"diff": "<<<<<<< SEARCH\n\"hi\"\n=======\n\"hello\"\n>>>>>>> REPLACE",
+	})
+	assert.True(t, planned)
+	assert.Contains(t, result, "step 2")
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "package main\n\nfunc main() {}\n", string(content))
+
+	_, planned = PlanToolCall("write_to_file", map[string]interface{}{"path": filepath.Join(dir, "new.txt"), "content": "a &amp; b\n"})
+	assert.True(t, planned)
+	assert.NoFileExists(t, filepath.Join(dir, "new.txt"))
+
+	_, planned = PlanToolCall("git_commit", map[string]interface{}{"message": "Say hello", "files": []string{path}})
+	assert.True(t, planned)
+
+	plan := GetPlan()
+	require.Len(t, plan, 4)
+	assert.Equal(t, "Edit "+path, plan[1].Summary)
+	assert.Contains(t, plan[1].Preview, "\"hello\"")
+	assert.Equal(t, "Create "+filepath.Join(dir, "new.txt"), plan[2].Summary)
+	assert.Contains(t, plan[2].Preview, "a & b")
+	assert.Contains(t, plan[3].Preview, "Say hello")
+
+	ClearPlan()
+	assert.Empty(t, GetPlan())
+}
+
+func TestPlanToolCallCommands(t *testing.T) {
+	defer ClearPlan()
+
+	// Commands that don't need approval run while planning
+	_, planned := PlanToolCall("execute_command", map[string]interface{}{"command": "ls", "requires_approval": false})
+	assert.False(t, planned)
+	_, planned = PlanToolCall("read_file", map[string]interface{}{"path": "main.go"})
+	assert.False(t, planned)
+
+	result, planned := PlanToolCall("execute_command", map[string]interface{}{"command": "rm -rf build", "requires_approval": true})
+	assert.True(t, planned)
+	assert.Contains(t, result, "Run rm -rf build")
+	assert.Equal(t, "$ rm -rf build", GetPlan()[0].Preview)
+}
+
+func TestPlanToolCallErrors(t *testing.T) {
+	defer ClearPlan()
+	path := filepath.Join(t.TempDir(), "main.go")
+	require.NoError(t, os.WriteFile(path, []byte("package main\n"), 0644))
+
+	// Failing edits are reported to the model and not recorded
+	result, planned := PlanToolCall("replace_in_file", map[string]interface{}{
+		"path": path,
+		"diff": "<<<<<<< SEARCH\nmissing\n=======\nfound\n>>>>>>> REPLACE",
+	})
+	assert.True(t, planned)
+	assert.Contains(t, result, "Error: 1 of 1 SEARCH blocks didn't match")
+
+	result, _ = PlanToolCall("replace_in_file", map[string]interface{}{"path": path + ".missing", "diff": "x"})
+	assert.Contains(t, result, "Error reading file")
+	assert.Empty(t, GetPlan())
+}
@@ -0,0 +1,167 @@
+package core
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/pederhe/nca/pkg/config"
+	"github.com/pederhe/nca/pkg/log"
+)
+
+// The ways a system prompt file changes the built-in system prompt
+const (
+	SystemPromptReplace = "replace"
+	SystemPromptAppend  = "append"
+)
+
+// builtinPromptVariant names the system prompt when no system prompt file is used
+const builtinPromptVariant = "built-in"
+
+// The system prompt file given on the command line, which takes precedence over the config, and
+// the variant of the last built system prompt, "" until the first one is built
+var (
+	systemPromptFile    string
+	systemPromptMode    string
+	systemPromptVariant string
+	systemPromptMutex   sync.Mutex
+)
+
+// SetSystemPromptFile makes the system prompt come from a template file, which replaces the
+// built-in prompt or is appended to it depending on mode. An empty mode replaces the prompt.
+func SetSystemPromptFile(path string, mode string) error {
+	if mode == "" {
+		mode = SystemPromptReplace
+	}
+	if mode != SystemPromptReplace && mode != SystemPromptAppend {
+		return fmt.Errorf("unknown system prompt mode '%s', use %s or %s", mode, SystemPromptReplace, SystemPromptAppend)
+	}
+
+	systemPromptMutex.Lock()
+	defer systemPromptMutex.Unlock()
+	systemPromptFile = path
+	systemPromptMode = mode
+	return nil
+}
+
+// GetSystemPromptVariant describes the system prompt the last request used, the built-in one or
+// the file, its mode and a hash of its content, so experiments can tell sessions apart
+func GetSystemPromptVariant() string {
+	systemPromptMutex.Lock()
+	defer systemPromptMutex.Unlock()
+	if systemPromptVariant == "" {
+		return builtinPromptVariant
+	}
+	return systemPromptVariant
+}
+
+// getSystemPromptFile returns the system prompt file and mode of the command line, or of the
+// config. The config of an untrusted workspace could replace the whole prompt, so it's ignored.
+func getSystemPromptFile() (string, string) {
+	systemPromptMutex.Lock()
+	path, mode := systemPromptFile, systemPromptMode
+	systemPromptMutex.Unlock()
+	if path != "" {
+		return path, mode
+	}
+
+	path = strings.TrimSpace(config.Get("system_prompt_file"))
+	if path == "" || !IsWorkspaceTrusted() {
+		return "", ""
+	}
+	mode = strings.TrimSpace(config.Get("system_prompt_mode"))
+	if mode != SystemPromptAppend {
+		mode = SystemPromptReplace
+	}
+	return path, mode
+}
+
+// applySystemPromptFile replaces or extends the built-in prompt with the configured system prompt
+// file. The file is a template with the variables of the built-in prompt, plus Tools for the tool
+// documentation, ToolNames for the names of the tools and DefaultPrompt for the built-in prompt.
+// The file is read for every request, so changes apply without restarting.
+func applySystemPromptFile(prompt string, data map[string]interface{}) (string, error) {
+	path, mode := getSystemPromptFile()
+	if path == "" {
+		setSystemPromptVariant(builtinPromptVariant)
+		return prompt, nil
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("reading system prompt file: %s", err)
+	}
+	tmpl, err := template.New("system_prompt_file").Option("missingkey=error").Parse(string(content))
+	if err != nil {
+		return "", fmt.Errorf("parsing system prompt file %s: %s", path, err)
+	}
+
+	tools := extractToolDocumentation(prompt)
+	fileData := make(map[string]interface{}, len(data)+3)
+	for key, value := range data {
+		fileData[key] = value
+	}
+	fileData["Tools"] = tools
+	fileData["ToolNames"] = strings.Join(toolNames(tools), ", ")
+	fileData["DefaultPrompt"] = prompt
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, fileData); err != nil {
+		return "", fmt.Errorf("executing system prompt file %s: %s", path, err)
+	}
+
+	hash := sha256.Sum256(content)
+	setSystemPromptVariant(fmt.Sprintf("%s %s (sha256 %s)", mode, path, hex.EncodeToString(hash[:])[:12]))
+	if mode == SystemPromptAppend {
+		return prompt + "\n\n====\n\n" + strings.TrimSpace(buf.String()), nil
+	}
+	return buf.String(), nil
+}
+
+// setSystemPromptVariant records the variant of the system prompt, logging when it changes
+func setSystemPromptVariant(variant string) {
+	systemPromptMutex.Lock()
+	defer systemPromptMutex.Unlock()
+	if variant != systemPromptVariant {
+		log.LogDebug(fmt.Sprintf("System prompt variant: %s\n", variant))
+	}
+	systemPromptVariant = variant
+}
+
+// extractToolDocumentation returns the part of the built-in prompt that explains how to use tools,
+// from their format and documentation to the guidelines. It contains all section markers, so the
+// tools also work with native tool calling.
+func extractToolDocumentation(prompt string) string {
+	start := strings.Index(prompt, toolFormattingMarker)
+	guidelines := strings.Index(prompt, toolGuidelinesMarker)
+	if start < 0 || guidelines < start {
+		return ""
+	}
+	section := prompt[start:]
+	if end := strings.Index(prompt[guidelines:], "\n===="); end >= 0 {
+		section = prompt[start : guidelines+end]
+	}
+	return strings.TrimSpace(section)
+}
+
+// toolNames returns the names of the tools documented in the tool documentation
+func toolNames(tools string) []string {
+	start := strings.Index(tools, toolsMarker)
+	end := strings.Index(tools, toolExamplesMarker)
+	if start < 0 || end < start {
+		return nil
+	}
+
+	var names []string
+	for _, line := range strings.Split(tools[start:end], "\n") {
+		if strings.HasPrefix(line, "## ") {
+			names = append(names, strings.TrimSpace(strings.TrimPrefix(line, "## ")))
+		}
+	}
+	return names
+}
@@ -0,0 +1,63 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSystemPromptFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	originalDir, err := os.Getwd()
+	require.NoError(t, err)
+	defer os.Chdir(originalDir)
+	os.Chdir(tmpDir)
+	t.Setenv("HOME", t.TempDir())
+	defer SetSystemPromptFile("", "")
+
+	builtin, err := BuildSystemPrompt()
+	require.NoError(t, err)
+	assert.Equal(t, "built-in", GetSystemPromptVariant())
+
+	path := filepath.Join(tmpDir, "prompt.md")
+	require.NoError(t, os.WriteFile(path, []byte("You are terse. Work in {{.CWD}}.\nTools: {{.ToolNames}}\n\n{{.Tools}}\n"), 0644))
+	require.NoError(t, SetSystemPromptFile(path, ""))
+	prompt, err := BuildSystemPrompt()
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(prompt, "You are terse. Work in "+toPosix(tmpDir)+"."))
+	assert.Contains(t, prompt, "Tools: execute_command, read_file, ")
+	assert.Contains(t, prompt, "## replace_in_file\nDescription:")
+	assert.NotContains(t, prompt, "# Identity and Tone")
+	assert.Contains(t, GetSystemPromptVariant(), "replace "+path+" (sha256 ")
+
+	// The tools documented in the file still work with native tool calling
+	assert.Len(t, BuildToolDefinitions(prompt), len(BuildToolDefinitions(builtin)))
+	assert.Contains(t, AdaptSystemPromptForNativeTools(prompt), "# Tool Calling")
+
+	require.NoError(t, os.WriteFile(path, []byte("Always answer in haiku.\n"), 0644))
+	require.NoError(t, SetSystemPromptFile(path, SystemPromptAppend))
+	prompt, err = BuildSystemPrompt()
+	require.NoError(t, err)
+	assert.Equal(t, builtin+"\n\n====\n\nAlways answer in haiku.", prompt)
+	assert.Contains(t, GetSystemPromptVariant(), "append ")
+}
+
+func TestSystemPromptFileErrors(t *testing.T) {
+	defer SetSystemPromptFile("", "")
+
+	assert.Error(t, SetSystemPromptFile("prompt.md", "prepend"))
+
+	require.NoError(t, SetSystemPromptFile(filepath.Join(t.TempDir(), "missing.md"), ""))
+	_, err := BuildSystemPrompt()
+	assert.ErrorContains(t, err, "reading system prompt file")
+
+	path := filepath.Join(t.TempDir(), "prompt.md")
+	require.NoError(t, os.WriteFile(path, []byte("Hello {{.Unknown}}"), 0644))
+	require.NoError(t, SetSystemPromptFile(path, ""))
+	_, err = BuildSystemPrompt()
+	assert.ErrorContains(t, err, "executing system prompt file")
+}
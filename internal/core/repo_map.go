@@ -0,0 +1,427 @@
+package core
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pederhe/nca/pkg/config"
+	"github.com/pederhe/nca/pkg/log"
+)
+
+// Limits of the repository map in the environment details
+const (
+	// Files indexed per workspace root, larger repositories are only partly indexed
+	maxRepoMapFiles = 20000
+	// Larger files are counted but not read
+	maxRepoMapFileSize  = 512 * 1024
+	maxRepoMapLanguages = 8
+	maxRepoMapDirs      = 30
+	maxRepoMapKeyFiles  = 20
+	// Characters of the code definition index, definitions of more files are left out
+	maxRepoMapDefinitionChars = 6000
+	maxRepoMapFileDefinitions = 12
+)
+
+// Languages of the repository map by file extension
+var repoMapLanguages = map[string]string{
+	".go":    "Go",
+	".js":    "JavaScript",
+	".jsx":   "JavaScript",
+	".mjs":   "JavaScript",
+	".ts":    "TypeScript",
+	".tsx":   "TypeScript",
+	".py":    "Python",
+	".java":  "Java",
+	".kt":    "Kotlin",
+	".c":     "C",
+	".h":     "C",
+	".cpp":   "C++",
+	".cc":    "C++",
+	".hpp":   "C++",
+	".cs":    "C#",
+	".php":   "PHP",
+	".rb":    "Ruby",
+	".rs":    "Rust",
+	".swift": "Swift",
+	".lua":   "Lua",
+	".sh":    "Shell",
+	".html":  "HTML",
+	".css":   "CSS",
+	".scss":  "CSS",
+	".vue":   "Vue",
+	".sql":   "SQL",
+}
+
+// Files that describe how a project is built, configured or started, listed as key files
+var repoMapKeyFiles = map[string]bool{
+	"README.md": true, "README": true, "CONTRIBUTING.md": true, "AGENTS.md": true,
+	"go.mod": true, "package.json": true, "Cargo.toml": true, "pyproject.toml": true, "setup.py": true,
+	"requirements.txt": true, "pom.xml": true, "build.gradle": true, "build.gradle.kts": true,
+	"CMakeLists.txt": true, "Makefile": true, "Dockerfile": true, "docker-compose.yml": true,
+	"tsconfig.json": true, "main.go": true, "main.py": true, "__main__.py": true, "app.py": true,
+	"main.rs": true, "lib.rs": true, "index.js": true, "index.ts": true, "main.ts": true,
+}
+
+// Patterns of the names of definitions, tried in order on the definitions of extractDefinitions
+var (
+	goMethodRegex       = regexp.MustCompile(`^func \(\w*\s*\*?(\w+)(?:\[[^\]]*\])?\)\s*(\w+)`)
+	goDefinitionRegex   = regexp.MustCompile(`^(?:func|type)\s+(\w+)`)
+	keywordNameRegex    = regexp.MustCompile(`\b(?:class|interface|enum|function|table)\s+([\w.:$]+)`)
+	callableNameRegex   = regexp.MustCompile(`([\w.:$]+)\s*(?:=\s*function\s*)?\(`)
+	repoMapTestFileName = regexp.MustCompile(`(_test\.go|\.(test|spec)\.[jt]sx?|^test_.*\.py|_test\.py)$`)
+)
+
+// repoFile is what the repository map knows about a file
+type repoFile struct {
+	language    string
+	lines       int
+	definitions []string // Names of the definitions of code files
+	// The file is scanned again when these change
+	modTime time.Time
+	size    int64
+}
+
+// repoIndex is the index of the files of a workspace root the repository map is built from
+type repoIndex struct {
+	root      string
+	files     map[string]*repoFile // By path relative to the root, with forward slashes
+	truncated bool                 // Whether the root has more files than were indexed
+}
+
+// The indexes of the workspace roots, built for the first prompt of the session and updated
+// for the later ones
+var (
+	repoIndexes  []*repoIndex
+	repoMapMutex sync.Mutex
+)
+
+// isRepoMapEnabled returns whether the repository map is sent, it can be turned off with the repo_map config
+func isRepoMapEnabled() bool {
+	return config.Get("repo_map") != "false"
+}
+
+// GetRepoMap returns the repository map of the workspace: its languages, top-level directories,
+// key files and an index of its code definitions. The map is built on the first call of the
+// session, so the model knows the layout of the project without exploring it. Later calls only
+// scan the files that changed since, so the map stays fresh during long sessions.
+func GetRepoMap() string {
+	if !isRepoMapEnabled() {
+		return ""
+	}
+	repoMapMutex.Lock()
+	defer repoMapMutex.Unlock()
+
+	if repoIndexes == nil {
+		for _, root := range GetWorkspaceRoots() {
+			repoIndexes = append(repoIndexes, buildRepoIndex(root))
+		}
+	} else {
+		for _, index := range repoIndexes {
+			if scanned, removed := index.update(); scanned+removed > 0 {
+				log.LogDebug(fmt.Sprintf("Repository map of %s updated: %d files scanned, %d removed\n", index.root, scanned, removed))
+			}
+		}
+	}
+
+	var sections []string
+	for _, index := range repoIndexes {
+		if repoMap := index.format(len(repoIndexes) > 1); repoMap != "" {
+			sections = append(sections, repoMap)
+		}
+	}
+	return strings.Join(sections, "\n\n")
+}
+
+// ResetRepoMap discards the indexes, the next GetRepoMap builds them again
+func ResetRepoMap() {
+	repoMapMutex.Lock()
+	defer repoMapMutex.Unlock()
+	repoIndexes = nil
+}
+
+// skipRepoMapEntry returns whether a file or directory is left out of the repository map, like
+// the workspace file map leaves out hidden files and dependency or build output directories
+func skipRepoMapEntry(entry fs.DirEntry) bool {
+	return strings.HasPrefix(entry.Name(), ".") || (entry.IsDir() && workspaceMapSkipDirs[entry.Name()])
+}
+
+// buildRepoIndex indexes the files of a workspace root
+func buildRepoIndex(root string) *repoIndex {
+	index := &repoIndex{root: root, files: make(map[string]*repoFile)}
+	index.update()
+	return index
+}
+
+// update brings the index up to date with the files of the root. Only new files and files whose
+// modification time or size changed are scanned, the others keep their entries. It returns the
+// number of files scanned and removed.
+func (index *repoIndex) update() (int, int) {
+	scanned := 0
+	seen := make(map[string]bool, len(index.files))
+	index.truncated = false
+	filepath.WalkDir(index.root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || path == index.root {
+			return nil
+		}
+		if skipRepoMapEntry(entry) {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if entry.IsDir() || !entry.Type().IsRegular() {
+			return nil
+		}
+		if len(seen) >= maxRepoMapFiles {
+			index.truncated = true
+			return filepath.SkipAll
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil
+		}
+		rel, _ := filepath.Rel(index.root, path)
+		rel = toPosix(rel)
+		seen[rel] = true
+		if file := index.files[rel]; file == nil || !file.modTime.Equal(info.ModTime()) || file.size != info.Size() {
+			index.files[rel] = scanRepoFile(path, info)
+			scanned++
+		}
+		return nil
+	})
+
+	removed := 0
+	for rel := range index.files {
+		if !seen[rel] {
+			delete(index.files, rel)
+			removed++
+		}
+	}
+	return scanned, removed
+}
+
+// scanRepoFile reads the language, line count and definitions of a file
+func scanRepoFile(path string, info fs.FileInfo) *repoFile {
+	file := &repoFile{modTime: info.ModTime(), size: info.Size()}
+	ext := strings.ToLower(filepath.Ext(path))
+	file.language = repoMapLanguages[ext]
+	if file.language == "" || info.Size() > maxRepoMapFileSize {
+		return file
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return file
+	}
+	content := string(data)
+	file.lines = strings.Count(content, "\n")
+	if content != "" && !strings.HasSuffix(content, "\n") {
+		file.lines++
+	}
+	if isCodeFile(ext) && !repoMapTestFileName.MatchString(filepath.Base(path)) {
+		for _, definition := range extractDefinitions(content, ext) {
+			if name := definitionName(definition); name != "" {
+				file.definitions = append(file.definitions, name)
+			}
+		}
+	}
+	return file
+}
+
+// definitionName shortens a definition line of extractDefinitions to its name, e.g.
+// "func (c *Client) Send(msg string) error" to "Client.Send", or "" if it has no name
+func definitionName(definition string) string {
+	// A block of Go types has no name of its own
+	if definition == "type (" {
+		return ""
+	}
+	if match := goMethodRegex.FindStringSubmatch(definition); match != nil {
+		return match[1] + "." + match[2]
+	}
+	for _, regex := range []*regexp.Regexp{goDefinitionRegex, keywordNameRegex, callableNameRegex} {
+		if match := regex.FindStringSubmatch(definition); match != nil {
+			return match[1]
+		}
+	}
+	if len(definition) > 60 {
+		return definition[:60] + "..."
+	}
+	return definition
+}
+
+// format returns the repository map of the root, with the root as heading if the workspace has several
+func (index *repoIndex) format(withRoot bool) string {
+	if len(index.files) == 0 {
+		return ""
+	}
+	paths := make([]string, 0, len(index.files))
+	for path := range index.files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var result strings.Builder
+	if withRoot {
+		result.WriteString(toPosix(index.root) + "/\n")
+	}
+	result.WriteString(index.formatLanguages())
+	result.WriteString(index.formatDirectories(paths))
+	result.WriteString(index.formatKeyFiles(paths))
+	result.WriteString(index.formatDefinitions(paths))
+	return strings.TrimRight(result.String(), "\n")
+}
+
+// formatLanguages lists the languages of the root by their share of the lines of code
+func (index *repoIndex) formatLanguages() string {
+	lines := make(map[string]int)
+	files := make(map[string]int)
+	total := 0
+	for _, file := range index.files {
+		if file.language != "" {
+			lines[file.language] += file.lines
+			files[file.language]++
+			total += file.lines
+		}
+	}
+	if len(files) == 0 {
+		return ""
+	}
+
+	languages := make([]string, 0, len(files))
+	for language := range files {
+		languages = append(languages, language)
+	}
+	sort.Slice(languages, func(i, j int) bool {
+		if lines[languages[i]] != lines[languages[j]] {
+			return lines[languages[i]] > lines[languages[j]]
+		}
+		return languages[i] < languages[j]
+	})
+	if len(languages) > maxRepoMapLanguages {
+		languages = languages[:maxRepoMapLanguages]
+	}
+
+	var parts []string
+	for _, language := range languages {
+		share := 0.0
+		if total > 0 {
+			share = float64(lines[language]) * 100 / float64(total)
+		}
+		parts = append(parts, fmt.Sprintf("%s %.0f%% (%d files, %d lines)", language, share, files[language], lines[language]))
+	}
+	summary := fmt.Sprintf("Languages: %s\n", strings.Join(parts, ", "))
+	if index.truncated {
+		summary += fmt.Sprintf("(only the first %d files were indexed)\n", maxRepoMapFiles)
+	}
+	return summary
+}
+
+// formatDirectories lists the top-level directories with their number of files and main language
+func (index *repoIndex) formatDirectories(paths []string) string {
+	type dirStats struct {
+		files     int
+		languages map[string]int
+	}
+	var dirs []string
+	stats := make(map[string]*dirStats)
+	for _, path := range paths {
+		slash := strings.Index(path, "/")
+		if slash < 0 {
+			continue
+		}
+		dir := path[:slash]
+		if stats[dir] == nil {
+			stats[dir] = &dirStats{languages: make(map[string]int)}
+			dirs = append(dirs, dir)
+		}
+		stats[dir].files++
+		if language := index.files[path].language; language != "" {
+			stats[dir].languages[language] += index.files[path].lines
+		}
+	}
+	if len(dirs) == 0 {
+		return ""
+	}
+
+	var result strings.Builder
+	result.WriteString("\nTop-level directories:\n")
+	for i, dir := range dirs {
+		if i == maxRepoMapDirs {
+			result.WriteString(fmt.Sprintf("  ... and %d more\n", len(dirs)-maxRepoMapDirs))
+			break
+		}
+		result.WriteString(fmt.Sprintf("  %s/ (%d files", dir, stats[dir].files))
+		mainLanguage, mainLines := "", 0
+		for language, lines := range stats[dir].languages {
+			if lines > mainLines || (lines == mainLines && language < mainLanguage) {
+				mainLanguage, mainLines = language, lines
+			}
+		}
+		if mainLanguage != "" {
+			result.WriteString(", mostly " + mainLanguage)
+		}
+		result.WriteString(")\n")
+	}
+	return result.String()
+}
+
+// formatKeyFiles lists the files that describe how the project is built and started, up to three
+// levels deep
+func (index *repoIndex) formatKeyFiles(paths []string) string {
+	var keyFiles []string
+	for _, file := range paths {
+		if strings.Count(file, "/") < 3 && repoMapKeyFiles[path.Base(file)] {
+			keyFiles = append(keyFiles, file)
+		}
+	}
+	if len(keyFiles) == 0 {
+		return ""
+	}
+	// Shallow files first, they describe the whole project
+	sort.SliceStable(keyFiles, func(i, j int) bool {
+		return strings.Count(keyFiles[i], "/") < strings.Count(keyFiles[j], "/")
+	})
+	if len(keyFiles) > maxRepoMapKeyFiles {
+		keyFiles = keyFiles[:maxRepoMapKeyFiles]
+	}
+	return "\nKey files: " + strings.Join(keyFiles, ", ") + "\n"
+}
+
+// formatDefinitions lists the names of the definitions of the code files, within a budget of
+// characters. Tests are left out.
+func (index *repoIndex) formatDefinitions(paths []string) string {
+	var result strings.Builder
+	left := 0
+	for _, path := range paths {
+		definitions := index.files[path].definitions
+		if len(definitions) == 0 {
+			continue
+		}
+		line := "  " + path + ": "
+		if len(definitions) > maxRepoMapFileDefinitions {
+			line += strings.Join(definitions[:maxRepoMapFileDefinitions], ", ") + fmt.Sprintf(", ... (%d more)", len(definitions)-maxRepoMapFileDefinitions)
+		} else {
+			line += strings.Join(definitions, ", ")
+		}
+		if left > 0 || result.Len()+len(line) > maxRepoMapDefinitionChars {
+			left++
+			continue
+		}
+		result.WriteString(line + "\n")
+	}
+	if result.Len() == 0 {
+		return ""
+	}
+	if left > 0 {
+		result.WriteString(fmt.Sprintf("  ... definitions of %d more files left out, use list_code_definition_names\n", left))
+	}
+	return "\nCode definitions:\n" + result.String()
+}
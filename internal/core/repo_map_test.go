@@ -0,0 +1,94 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pederhe/nca/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDefinitionName(t *testing.T) {
+	assert.Equal(t, "Client.Send", definitionName("func (c *Client) Send(msg string) error"))
+	assert.Equal(t, "List.Len", definitionName("func (l List[T]) Len() int"))
+	assert.Equal(t, "NewClient", definitionName("func NewClient(url string) *Client"))
+	assert.Equal(t, "Client", definitionName("type Client struct"))
+	assert.Equal(t, "", definitionName("type ("))
+	assert.Equal(t, "UserService", definitionName("export class UserService extends Base"))
+	assert.Equal(t, "handleRequest", definitionName("function handleRequest(req, res)"))
+	assert.Equal(t, "main", definitionName("public static void main(String[] args)"))
+	assert.Equal(t, "M.update", definitionName("function M.update(dt)"))
+}
+
+func TestGetRepoMap(t *testing.T) {
+	root := t.TempDir()
+	t.Chdir(root)
+	defer SetWorkspaceRoots(nil)
+	defer ResetRepoMap()
+	ResetRepoMap()
+
+	files := map[string]string{
+		"go.mod":                       "module example\n",
+		"README.md":                    "# Example\n",
+		"cmd/app/main.go":              "package main\n\nfunc main() {\n\trun()\n}\n\nfunc run() {}\n",
+		"internal/store/store.go":      "package store\n\ntype Store struct {\n}\n\nfunc (s *Store) Get(key string) string {\n\treturn key\n}\n",
+		"internal/store/store_test.go": "package store\n\nfunc TestGet(t *testing.T) {}\n",
+		"web/app.js":                   "function render() {}\n",
+		"node_modules/lib/x.js":        "function hidden() {}\n",
+		".git/config":                  "[core]\n",
+	}
+	for path, content := range files {
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+	require.NoError(t, SetWorkspaceRoots([]string{root}))
+
+	assert.Equal(t, `Languages: Go 95% (3 files, 18 lines), JavaScript 5% (1 files, 1 lines)
+
+Top-level directories:
+  cmd/ (1 files, mostly Go)
+  internal/ (2 files, mostly Go)
+  web/ (1 files, mostly JavaScript)
+
+Key files: README.md, go.mod, cmd/app/main.go
+
+Code definitions:
+  cmd/app/main.go: main, run
+  internal/store/store.go: Store, Store.Get
+  web/app.js: render`, GetRepoMap())
+
+	// Later calls see the changed files
+	require.NoError(t, os.WriteFile("web/more.js", []byte("function later() {}\n"), 0644))
+	require.NoError(t, os.Remove("cmd/app/main.go"))
+	repoMap := GetRepoMap()
+	assert.Contains(t, repoMap, "web/more.js: later")
+	assert.NotContains(t, repoMap, "cmd/")
+
+	require.NoError(t, config.Set("repo_map", "false", false))
+	assert.Empty(t, GetRepoMap())
+}
+
+func TestRepoIndexUpdate(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(root, "a.go"), []byte("package a\n\nfunc A() {}\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "b.go"), []byte("package a\n\nfunc B() {}\n"), 0644))
+	index := buildRepoIndex(root)
+	assert.Equal(t, []string{"A"}, index.files["a.go"].definitions)
+
+	// Unchanged files aren't scanned again
+	scanned, removed := index.update()
+	assert.Equal(t, 0, scanned)
+	assert.Equal(t, 0, removed)
+
+	require.NoError(t, os.WriteFile(filepath.Join(root, "a.go"), []byte("package a\n\nfunc A() {}\n\nfunc A2() {}\n"), 0644))
+	require.NoError(t, os.Remove(filepath.Join(root, "b.go")))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "c.go"), []byte("package a\n\ntype C struct{}\n"), 0644))
+	scanned, removed = index.update()
+	assert.Equal(t, 2, scanned)
+	assert.Equal(t, 1, removed)
+	assert.Equal(t, []string{"A", "A2"}, index.files["a.go"].definitions)
+	assert.Equal(t, []string{"C"}, index.files["c.go"].definitions)
+	assert.Nil(t, index.files["b.go"])
+}
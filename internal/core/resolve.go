@@ -0,0 +1,195 @@
+package core
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// maxResolveOutputChars limits the build or test output given to the agent
+const maxResolveOutputChars = 16 * 1024
+
+// Git operations that stop on conflicts and the file git keeps in the git directory while they run
+var mergeOperationFiles = []struct {
+	operation string
+	file      string
+}{
+	{"rebase", "rebase-merge"},
+	{"rebase", "rebase-apply"},
+	{"cherry-pick", "CHERRY_PICK_HEAD"},
+	{"revert", "REVERT_HEAD"},
+	{"merge", "MERGE_HEAD"},
+}
+
+// DetectMergeOperation returns the unfinished git operation of the repository in the current
+// directory: merge, rebase, cherry-pick or revert, or "" if there is none
+func DetectMergeOperation() string {
+	for _, entry := range mergeOperationFiles {
+		path, err := runGit(".", "rev-parse", "--git-path", entry.file)
+		if err != nil {
+			return ""
+		}
+		if _, err := os.Stat(strings.TrimSpace(path)); err == nil {
+			return entry.operation
+		}
+	}
+	return ""
+}
+
+// GetConflictedFiles returns the files with unresolved conflicts, relative to the current directory
+func GetConflictedFiles() ([]string, error) {
+	root, err := runGit(".", "rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, fmt.Errorf("not a git repository: %w", err)
+	}
+	output, err := runGit(".", "-c", "core.quotepath=off", "diff", "--name-only", "--diff-filter=U")
+	if err != nil {
+		return nil, err
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	// git reports the root without symlinks, e.g. /private/var instead of /var on macOS
+	if resolvedCwd, err := filepath.EvalSymlinks(cwd); err == nil {
+		cwd = resolvedCwd
+	}
+	var files []string
+	for _, line := range strings.Split(output, "\n") {
+		if line = strings.TrimSpace(line); line == "" {
+			continue
+		}
+		path := filepath.Join(strings.TrimSpace(root), filepath.FromSlash(line))
+		if rel, err := filepath.Rel(cwd, path); err == nil {
+			path = rel
+		}
+		files = append(files, path)
+	}
+	return files, nil
+}
+
+// HasConflictMarkers returns whether a file still contains conflict markers
+func HasConflictMarkers(path string) (bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 10*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		// ======= alone is a valid line in many formats, the outer markers are not
+		if strings.HasPrefix(line, "<<<<<<< ") || strings.HasPrefix(line, ">>>>>>> ") || line == "<<<<<<<" || line == ">>>>>>>" {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
+
+// describeConflictSides explains which change the sides of a conflict come from. During a rebase
+// "ours" is the branch rebased onto and "theirs" the commit being replayed, the opposite of a merge.
+func describeConflictSides(operation string) string {
+	branch, _ := runGit(".", "rev-parse", "--abbrev-ref", "HEAD")
+	branch = strings.TrimSpace(branch)
+	subject := func(ref string) string {
+		output, err := runGit(".", "log", "-1", "--format=%h %s", ref)
+		if err != nil {
+			return ref
+		}
+		return strings.TrimSpace(output)
+	}
+
+	switch operation {
+	case "merge":
+		return fmt.Sprintf("A merge into %s is in progress. The first side of each conflict (ours) is %s, the second side (theirs) is the merged commit %s.",
+			branch, branch, subject("MERGE_HEAD"))
+	case "rebase":
+		return fmt.Sprintf("A rebase is in progress. The first side of each conflict (ours) is the branch being rebased onto, at %s, the second side (theirs) is the commit being replayed, %s.",
+			subject("HEAD"), subject("REBASE_HEAD"))
+	case "cherry-pick":
+		return fmt.Sprintf("A cherry-pick onto %s is in progress. The first side of each conflict (ours) is %s, the second side (theirs) is the picked commit %s.",
+			branch, branch, subject("CHERRY_PICK_HEAD"))
+	case "revert":
+		return fmt.Sprintf("A revert of %s is in progress. The second side of each conflict (theirs) undoes that commit.", subject("REVERT_HEAD"))
+	default:
+		return "The file has conflicts, e.g. from a stash that was applied."
+	}
+}
+
+// BuildResolvePrompt returns the task that lets the agent resolve the conflicts of one file
+func BuildResolvePrompt(operation string, file string, index int, total int) string {
+	var prompt strings.Builder
+	prompt.WriteString(fmt.Sprintf("Resolve the merge conflicts in %s (file %d of %d with conflicts).\n\n", toPosix(file), index, total))
+	prompt.WriteString(describeConflictSides(operation) + "\n\n")
+	prompt.WriteString(`1. Read the whole file and find every conflict block: the lines between <<<<<<< and ======= are the first side, the lines between ======= and >>>>>>> the second side. With diff3 style the lines after ||||||| are the common ancestor.
+2. Understand the intent of both sides before editing. ` + fmt.Sprintf("`git log --merge -p -- %s`", toPosix(file)) + ` shows the commits that changed the file on both sides, and read the code that uses the conflicting parts when needed.
+3. Keep the changes of both sides when they are compatible, e.g. both added imports or functions. When they contradict each other, keep the behavior the second side intended on top of the first side's code, unless that breaks the first side, and explain the choice.
+4. Edit the file with replace_in_file so no conflict markers are left. Don't change code outside the conflicts unless the resolution requires it, e.g. a renamed function that is called in the resolved code.
+5. Don't stage or commit the file and don't run git merge, rebase or cherry-pick with --continue, --skip or --abort. The files are staged and the build and tests run after all conflicts are resolved.
+
+Finish with attempt_completion and list how each conflict was resolved.`)
+	return prompt.String()
+}
+
+// BuildResolveFixPrompt returns the task that lets the agent fix the build or tests after resolving conflicts
+func BuildResolveFixPrompt(command string, output string, files []string) string {
+	posixFiles := make([]string, len(files))
+	for i, file := range files {
+		posixFiles[i] = toPosix(file)
+	}
+	// The end of the output has the summary and the failures
+	if len(output) > maxResolveOutputChars {
+		output = "...\n" + output[len(output)-maxResolveOutputChars:]
+	}
+	return fmt.Sprintf("Merge conflicts were resolved in %s, but `%s` fails afterwards:\n\n```\n%s\n```\n\nFind out whether the resolutions caused the failure and fix it, the fix most likely belongs in the resolved files. Don't stage or commit files and don't continue or abort the merge. Run `%s` again to confirm the fix and finish with attempt_completion.",
+		strings.Join(posixFiles, ", "), command, strings.TrimSpace(output), command)
+}
+
+// DetectTestCommand guesses the command that builds and tests the project in the current directory
+func DetectTestCommand() string {
+	candidates := []struct {
+		file    string
+		command string
+	}{
+		{"go.mod", "go build ./... && go test ./..."},
+		{"Cargo.toml", "cargo test"},
+		{"package.json", "npm test"},
+		{"pyproject.toml", "pytest"},
+		{"setup.py", "pytest"},
+		{"pom.xml", "mvn -q test"},
+		{"build.gradle", "gradle test"},
+		{"build.gradle.kts", "gradle test"},
+		{"Makefile", "make test"},
+	}
+	for _, candidate := range candidates {
+		if _, err := os.Stat(candidate.file); err == nil {
+			return candidate.command
+		}
+	}
+	return ""
+}
+
+// GetResolveTestCommand returns the command nca resolve runs after the conflicts are resolved if
+// none is given with --test: resolve.test_command of the config, which is only read from the
+// project's config in trusted workspaces, or the detected one
+func GetResolveTestCommand() string {
+	if command := strings.TrimSpace(getTrustedConfig("resolve.test_command")); command != "" {
+		return command
+	}
+	return DetectTestCommand()
+}
+
+// RunResolveTestCommand runs the build and test command of nca resolve like execute_command and
+// records it in the audit log. Commands the user didn't give with --test go through the command
+// policy and approval, since the project can choose them. It returns false if the command didn't run.
+func RunResolveTestCommand(command string, explicit bool) (string, bool) {
+	params := map[string]interface{}{"command": command, "requires_approval": !explicit}
+	result, approval := ExecuteCommandWithApproval(params)
+	RecordToolAudit("execute_command", params, result, approval)
+	return result, approval != AuditBlocked && approval != "declined"
+}
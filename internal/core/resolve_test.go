@@ -0,0 +1,124 @@
+package core
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pederhe/nca/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// git runs a git command in dir, the result isn't checked since merges with conflicts fail
+func git(dir string, args ...string) {
+	cmd := exec.Command("git", append([]string{"-c", "user.name=Test", "-c", "user.email=test@example.com"}, args...)...)
+	cmd.Dir = dir
+	cmd.Run()
+}
+
+func TestResolveConflicts(t *testing.T) {
+	dir := initGitRepo(t, map[string]string{
+		"main.go":  "package main\n\nconst greeting = \"hello\"\n",
+		"other.go": "package main\n",
+	})
+	git(dir, "checkout", "-q", "-b", "feature")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n\nconst greeting = \"hi\"\n"), 0644))
+	git(dir, "commit", "-q", "-am", "Shorter greeting")
+	git(dir, "checkout", "-q", "-")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n\nconst greeting = \"hello world\"\n"), 0644))
+	git(dir, "commit", "-q", "-am", "Longer greeting")
+	git(dir, "merge", "feature")
+
+	originalDir, err := os.Getwd()
+	require.NoError(t, err)
+	defer os.Chdir(originalDir)
+	require.NoError(t, os.Chdir(dir))
+
+	assert.Equal(t, "merge", DetectMergeOperation())
+	files, err := GetConflictedFiles()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"main.go"}, files)
+
+	hasMarkers, err := HasConflictMarkers("main.go")
+	require.NoError(t, err)
+	assert.True(t, hasMarkers)
+
+	prompt := BuildResolvePrompt("merge", "main.go", 1, 1)
+	assert.Contains(t, prompt, "Resolve the merge conflicts in main.go (file 1 of 1")
+	assert.Contains(t, prompt, "Shorter greeting")
+	assert.Contains(t, prompt, "git log --merge -p -- main.go")
+
+	// A resolved file is no longer reported once it's staged
+	require.NoError(t, os.WriteFile("main.go", []byte("package main\n\nconst greeting = \"hi world\"\n"), 0644))
+	hasMarkers, err = HasConflictMarkers("main.go")
+	require.NoError(t, err)
+	assert.False(t, hasMarkers)
+	git(dir, "add", "main.go")
+	files, err = GetConflictedFiles()
+	require.NoError(t, err)
+	assert.Empty(t, files)
+}
+
+func TestHasConflictMarkers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "README.md")
+
+	// A setext heading underline isn't a conflict
+	require.NoError(t, os.WriteFile(path, []byte("Title\n=======\n"), 0644))
+	hasMarkers, err := HasConflictMarkers(path)
+	require.NoError(t, err)
+	assert.False(t, hasMarkers)
+
+	require.NoError(t, os.WriteFile(path, []byte("<<<<<<< HEAD\na\n=======\nb\n>>>>>>> feature\n"), 0644))
+	hasMarkers, err = HasConflictMarkers(path)
+	require.NoError(t, err)
+	assert.True(t, hasMarkers)
+}
+
+func TestDetectTestCommand(t *testing.T) {
+	inTempWorkspace(t)
+	assert.Empty(t, DetectTestCommand())
+
+	require.NoError(t, os.WriteFile("Makefile", []byte("test:\n"), 0644))
+	assert.Equal(t, "make test", DetectTestCommand())
+
+	// Project manifests come before a Makefile that may only wrap them
+	require.NoError(t, os.WriteFile("go.mod", []byte("module example\n"), 0644))
+	assert.Equal(t, "go build ./... && go test ./...", DetectTestCommand())
+}
+
+func TestResolveTestCommand(t *testing.T) {
+	inTempWorkspace(t)
+	SetSessionAutoApprove(false)
+	defer ClearSessionAutoApprove()
+	defer SetApprovalPolicy("")
+	require.NoError(t, SetApprovalPolicy(ApprovalAlwaysAsk))
+	require.NoError(t, os.WriteFile("Makefile", []byte("test:\n"), 0644))
+	require.NoError(t, config.Set("resolve.test_command", "touch pwned", false))
+
+	// The project's command isn't used before the workspace is trusted
+	assert.Equal(t, "make test", GetResolveTestCommand())
+	trustWorkspace(t)
+	assert.Equal(t, "touch pwned", GetResolveTestCommand())
+
+	// Commands not given with --test need approval and are audited
+	Input = strings.NewReader("n\n")
+	defer func() { Input = userInput{} }()
+	result, ran := RunResolveTestCommand("touch pwned", false)
+	assert.False(t, ran)
+	assert.Equal(t, "Command execution cancelled", result)
+	assert.NoFileExists(t, "pwned")
+
+	_, ran = RunResolveTestCommand("touch explicit", true)
+	assert.True(t, ran)
+	assert.FileExists(t, "explicit")
+
+	entries, err := ReadAuditLog(time.Time{})
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "declined", entries[0].Approval)
+	assert.Equal(t, "not_required", entries[1].Approval)
+}
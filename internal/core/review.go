@@ -0,0 +1,384 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pederhe/nca/pkg/utils"
+)
+
+// nca review gives the diff of the working tree, the staged changes, a branch or a pull request to
+// the model with a review system prompt. The model answers with JSON findings, which are shown in
+// the terminal, as a Markdown report or as a GitHub review that can be posted to the pull request.
+
+// maxReviewDiffChars limits the diff given to the model
+const maxReviewDiffChars = 256 * 1024
+
+// Severities of review findings, from the most to the least severe
+const (
+	SeverityCritical = "critical"
+	SeverityMajor    = "major"
+	SeverityMinor    = "minor"
+	SeverityNit      = "nit"
+)
+
+var reviewSeverities = []string{SeverityCritical, SeverityMajor, SeverityMinor, SeverityNit}
+
+// Matches the new side of a hunk header
+var reviewHunkRegex = regexp.MustCompile(`^@@ -\d+(?:,\d+)? \+(\d+)(?:,\d+)? @@`)
+
+// ReviewFinding is an issue the review found on a line of the changes
+type ReviewFinding struct {
+	File       string `json:"file"`
+	Line       int    `json:"line"`
+	Severity   string `json:"severity"`
+	Message    string `json:"message"`
+	Suggestion string `json:"suggestion,omitempty"`
+}
+
+// Review is the answer of the model to a review prompt
+type Review struct {
+	Summary  string          `json:"summary"`
+	Findings []ReviewFinding `json:"findings"`
+}
+
+// ReviewTarget is the diff a review is about
+type ReviewTarget struct {
+	Description string // e.g. "the staged changes" or "pull request #57"
+	Diff        string
+	Context     string // Title and description of a pull request
+	PullRequest string // URL of the pull request, its review comments can be posted
+	HeadSHA     string // Commit of the pull request the comments refer to
+	// Lines of the new side of each file that are in the diff, GitHub only accepts comments on them
+	lines map[string]map[int]bool
+}
+
+// GetReviewTarget returns the diff to review: the uncommitted changes without a target, the
+// staged changes, the changes of a pull request given by its URL, or the changes since a ref,
+// e.g. the changes of the current branch since it forked from main for "main"
+func GetReviewTarget(target string, staged bool) (*ReviewTarget, error) {
+	review := &ReviewTarget{}
+	var diff string
+	var err error
+	switch {
+	case staged:
+		review.Description = "the staged changes"
+		diff, err = runGit(".", "diff", "--cached")
+	case pullRequestURLRegex.MatchString(target):
+		diff, err = review.loadPullRequest(target)
+	case strings.Contains(target, ".."):
+		review.Description = "the changes of " + target
+		diff, err = runGit(".", "diff", target)
+	case target != "":
+		review.Description = "the changes since " + target
+		diff, err = runGit(".", "diff", target+"...HEAD")
+	default:
+		review.Description = "the uncommitted changes"
+		diff, err = runGit(".", "diff", "HEAD")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(diff) == "" {
+		return nil, fmt.Errorf("nothing to review in %s", review.Description)
+	}
+	review.Diff, review.lines = numberDiffLines(diff)
+	return review, nil
+}
+
+// loadPullRequest reads a pull request with gh and returns its diff
+func (review *ReviewTarget) loadPullRequest(url string) (string, error) {
+	output, err := runGitHubCLI("pr", "view", url, "--json", "number,title,body,headRefOid")
+	if err != nil {
+		return "", err
+	}
+	var data struct {
+		Number     int    `json:"number"`
+		Title      string `json:"title"`
+		Body       string `json:"body"`
+		HeadRefOid string `json:"headRefOid"`
+	}
+	if err := json.Unmarshal([]byte(output), &data); err != nil {
+		return "", fmt.Errorf("failed to parse the pull request: %w", err)
+	}
+	review.Description = fmt.Sprintf("pull request #%d", data.Number)
+	review.Context = fmt.Sprintf("Title: %s\n\n%s", data.Title, strings.TrimSpace(data.Body))
+	review.PullRequest = url
+	review.HeadSHA = data.HeadRefOid
+	return runGitHubCLI("pr", "diff", url)
+}
+
+// numberDiffLines returns a diff with the line numbers of the new side in front of the added and
+// unchanged lines, so the model doesn't have to count them, and the numbered lines of each file
+func numberDiffLines(diff string) (string, map[string]map[int]bool) {
+	lines := make(map[string]map[int]bool)
+	var result strings.Builder
+	file, oldFile := "", ""
+	line := 0
+	inHunk := false
+	for _, text := range strings.Split(strings.TrimRight(diff, "\n"), "\n") {
+		switch {
+		case strings.HasPrefix(text, "diff --git "):
+			inHunk = false
+			result.WriteString("\n" + text + "\n")
+			continue
+		case !inHunk && strings.HasPrefix(text, "--- "):
+			oldFile = parsePatchPath(text[4:], "a/")
+		case !inHunk && strings.HasPrefix(text, "+++ "):
+			// Deleted files are commented on the old side
+			file = parsePatchPath(text[4:], "b/")
+			if file == "" {
+				file = oldFile
+			}
+		case strings.HasPrefix(text, "@@"):
+			if match := reviewHunkRegex.FindStringSubmatch(text); match != nil {
+				line, _ = strconv.Atoi(match[1])
+				inHunk = true
+			}
+		case inHunk && (strings.HasPrefix(text, "+") || strings.HasPrefix(text, " ") || text == ""):
+			if lines[file] == nil {
+				lines[file] = make(map[int]bool)
+			}
+			lines[file][line] = true
+			fmt.Fprintf(&result, "%5d %s\n", line, text)
+			line++
+			continue
+		case inHunk && strings.HasPrefix(text, "-"):
+			fmt.Fprintf(&result, "      %s\n", text)
+			continue
+		}
+		result.WriteString(text + "\n")
+	}
+	return strings.TrimLeft(result.String(), "\n"), lines
+}
+
+// BuildReviewPrompt returns the system prompt and the user prompt of a review
+func BuildReviewPrompt(target *ReviewTarget, language string) (string, string) {
+	var system strings.Builder
+	system.WriteString(`You are NCA, a senior software engineer reviewing code changes. Find the problems a careful reviewer would point out before the changes are merged: bugs, unhandled errors and edge cases, security issues, race conditions, performance problems, missing tests and code that is hard to maintain or doesn't follow the conventions of the project. Don't comment on what is correct, and don't repeat the same finding for every occurrence.
+
+The diff has the line number of the new version of the file in front of every added and unchanged line. Removed lines have no number.
+
+Answer with a JSON object only, without any text around it:
+{
+  "summary": "One or two sentences on the changes and their overall quality",
+  "findings": [
+    {
+      "file": "path/of/the/file as in the diff",
+      "line": 42,
+      "severity": "critical, major, minor or nit",
+      "message": "What is wrong and why it matters",
+      "suggestion": "How to fix it, with code if it helps (optional)"
+    }
+  ]
+}
+
+Severities:
+- critical: breaks functionality, loses data or opens a security hole, must be fixed before merging
+- major: a bug or a problem that should be fixed before merging
+- minor: a problem worth fixing that doesn't block merging
+- nit: style and naming
+
+The line of a finding must be a numbered line of the diff. Answer with an empty findings list if the changes have no problems.`)
+	fmt.Fprintf(&system, "\n\nWrite the summary, messages and suggestions in %s.", language)
+	if rules := loadRules(); rules != "" {
+		system.WriteString("\n\n====\n\nPROJECT RULES\n\nThe changes should follow these instructions of the user:\n\n")
+		system.WriteString(rules)
+	}
+
+	var user strings.Builder
+	fmt.Fprintf(&user, "Review %s.\n\n", target.Description)
+	if target.Context != "" {
+		fmt.Fprintf(&user, "Description of the changes:\n%s\n\n", target.Context)
+	}
+	diff := target.Diff
+	if len(diff) > maxReviewDiffChars {
+		diff = truncateAtLine(diff, maxReviewDiffChars) + fmt.Sprintf("\n[Diff truncated to %d KB, review only the part above]", maxReviewDiffChars/1024)
+	}
+	fmt.Fprintf(&user, "Diff:\n%s\n", diff)
+	return system.String(), user.String()
+}
+
+// ParseReview parses the answer of the model to a review prompt. Findings are sorted by severity,
+// unknown severities count as minor.
+func ParseReview(answer string) (*Review, error) {
+	// Models often wrap the JSON in a code block or add a sentence anyway
+	start := strings.Index(answer, "{")
+	end := strings.LastIndex(answer, "}")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("the answer has no JSON object")
+	}
+	var review Review
+	if err := json.Unmarshal([]byte(answer[start:end+1]), &review); err != nil {
+		return nil, fmt.Errorf("failed to parse the review: %w", err)
+	}
+
+	findings := review.Findings[:0]
+	for _, finding := range review.Findings {
+		if strings.TrimSpace(finding.Message) == "" {
+			continue
+		}
+		finding.Severity = strings.ToLower(strings.TrimSpace(finding.Severity))
+		if severityRank(finding.Severity) == len(reviewSeverities) {
+			finding.Severity = SeverityMinor
+		}
+		findings = append(findings, finding)
+	}
+	sort.SliceStable(findings, func(i, j int) bool {
+		return severityRank(findings[i].Severity) < severityRank(findings[j].Severity)
+	})
+	review.Findings = findings
+	return &review, nil
+}
+
+// severityRank returns the position of a severity in reviewSeverities
+func severityRank(severity string) int {
+	for i, known := range reviewSeverities {
+		if severity == known {
+			return i
+		}
+	}
+	return len(reviewSeverities)
+}
+
+// location returns the file and line of a finding
+func (finding ReviewFinding) location() string {
+	if finding.Line > 0 {
+		return fmt.Sprintf("%s:%d", finding.File, finding.Line)
+	}
+	return finding.File
+}
+
+// FormatReview formats a review for the terminal
+func FormatReview(target *ReviewTarget, review *Review) string {
+	var result strings.Builder
+	fmt.Fprintf(&result, "%s\n\n%s\n", utils.ColoredText(fmt.Sprintf("Review of %s: %d findings", target.Description, len(review.Findings)), utils.ColorBold), review.Summary)
+	colors := map[string]string{SeverityCritical: utils.ColorRed, SeverityMajor: utils.ColorYellow, SeverityMinor: utils.ColorCyan, SeverityNit: utils.ColorGray}
+	for _, finding := range review.Findings {
+		fmt.Fprintf(&result, "\n%s %s\n  %s\n", utils.ColoredText("["+finding.Severity+"]", colors[finding.Severity]), finding.location(),
+			strings.ReplaceAll(strings.TrimSpace(finding.Message), "\n", "\n  "))
+		if suggestion := strings.TrimSpace(finding.Suggestion); suggestion != "" {
+			fmt.Fprintf(&result, "  Suggestion: %s\n", strings.ReplaceAll(suggestion, "\n", "\n  "))
+		}
+	}
+	return result.String()
+}
+
+// FormatReviewMarkdown formats a review as a Markdown report
+func FormatReviewMarkdown(target *ReviewTarget, review *Review) string {
+	var result strings.Builder
+	fmt.Fprintf(&result, "# Code review of %s\n\n%s\n", target.Description, strings.TrimSpace(review.Summary))
+	if len(review.Findings) == 0 {
+		result.WriteString("\nNo findings.\n")
+		return result.String()
+	}
+	counts := make([]string, 0, len(reviewSeverities))
+	for _, severity := range reviewSeverities {
+		count := 0
+		for _, finding := range review.Findings {
+			if finding.Severity == severity {
+				count++
+			}
+		}
+		if count > 0 {
+			counts = append(counts, fmt.Sprintf("%d %s", count, severity))
+		}
+	}
+	fmt.Fprintf(&result, "\n## Findings (%s)\n", strings.Join(counts, ", "))
+	for i, finding := range review.Findings {
+		fmt.Fprintf(&result, "\n### %d. %s `%s`\n\n%s\n", i+1, finding.Severity, finding.location(), strings.TrimSpace(finding.Message))
+		if suggestion := strings.TrimSpace(finding.Suggestion); suggestion != "" {
+			fmt.Fprintf(&result, "\n**Suggestion:** %s\n", suggestion)
+		}
+	}
+	return result.String()
+}
+
+// GitHubReviewComment is a comment on a line of a pull request
+type GitHubReviewComment struct {
+	Path string `json:"path"`
+	Line int    `json:"line"`
+	Side string `json:"side"`
+	Body string `json:"body"`
+}
+
+// GitHubReview is the body of a request that creates a pull request review
+type GitHubReview struct {
+	CommitID string                `json:"commit_id,omitempty"`
+	Body     string                `json:"body"`
+	Event    string                `json:"event"`
+	Comments []GitHubReviewComment `json:"comments"`
+}
+
+// NewGitHubReview converts a review to a GitHub review. Findings on lines that aren't in the diff
+// can't be line comments, they are listed in the body of the review.
+func NewGitHubReview(target *ReviewTarget, review *Review) GitHubReview {
+	result := GitHubReview{CommitID: target.HeadSHA, Event: "COMMENT", Comments: []GitHubReviewComment{}}
+	var body strings.Builder
+	body.WriteString(strings.TrimSpace(review.Summary))
+	var other []string
+	for _, finding := range review.Findings {
+		comment := fmt.Sprintf("**%s:** %s", finding.Severity, strings.TrimSpace(finding.Message))
+		if suggestion := strings.TrimSpace(finding.Suggestion); suggestion != "" {
+			comment += "\n\n**Suggestion:** " + suggestion
+		}
+		if target.lines[finding.File][finding.Line] {
+			result.Comments = append(result.Comments, GitHubReviewComment{Path: finding.File, Line: finding.Line, Side: "RIGHT", Body: comment})
+			continue
+		}
+		other = append(other, fmt.Sprintf("- `%s` %s", finding.location(), strings.ReplaceAll(comment, "\n", "\n  ")))
+	}
+	if len(other) > 0 {
+		fmt.Fprintf(&body, "\n\n%s", strings.Join(other, "\n"))
+	}
+	result.Body = body.String()
+	return result
+}
+
+// PostReview posts a review to the pull request of the target after the user approves it
+func PostReview(target *ReviewTarget, review *Review) (string, error) {
+	match := pullRequestURLRegex.FindStringSubmatch(target.PullRequest)
+	if match == nil {
+		return "", fmt.Errorf("only the reviews of pull requests given by their URL can be posted")
+	}
+	githubReview := NewGitHubReview(target, review)
+
+	switch decideApproval(approvePRComment) {
+	case denyAction:
+		return "", fmt.Errorf("%s", strings.TrimPrefix(approvalDenial(approvePRComment), "Error: "))
+	case askUser:
+		fmt.Printf("Post the review with %d line comments to %s? (y/n): ", len(githubReview.Comments), target.Description)
+		var response string
+		fmt.Fscanln(Input, &response)
+		if strings.ToLower(response) != "y" {
+			return "Review not posted", nil
+		}
+	}
+
+	data, err := json.Marshal(githubReview)
+	if err != nil {
+		return "", err
+	}
+	file, err := os.CreateTemp("", "nca-review-*.json")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(file.Name())
+	_, err = file.Write(data)
+	file.Close()
+	if err != nil {
+		return "", err
+	}
+
+	output, err := runGitHubCLI("api", "--method", "POST", fmt.Sprintf("repos/%s/%s/pulls/%s/reviews", match[1], match[2], match[3]),
+		"--input", file.Name(), "--jq", ".html_url")
+	if err != nil {
+		return "", err
+	}
+	return "Posted the review: " + strings.TrimSpace(output), nil
+}
@@ -0,0 +1,101 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetReviewTarget(t *testing.T) {
+	dir := initGitRepo(t, map[string]string{"main.go": "package main\n\nfunc main() {\n}\n"})
+	t.Chdir(dir)
+
+	_, err := GetReviewTarget("", false)
+	assert.EqualError(t, err, "nothing to review in the uncommitted changes")
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n\nfunc main() {\n\tpanic(nil)\n}\n"), 0644))
+	target, err := GetReviewTarget("", false)
+	require.NoError(t, err)
+	assert.Equal(t, "the uncommitted changes", target.Description)
+	assert.Contains(t, target.Diff, "    3  func main() {\n    4 +\tpanic(nil)\n    5  }\n")
+
+	// Only staged changes are in the staged diff
+	_, err = GetReviewTarget("", true)
+	assert.Error(t, err)
+	git(dir, "add", "main.go")
+	target, err = GetReviewTarget("", true)
+	require.NoError(t, err)
+	assert.Equal(t, "the staged changes", target.Description)
+
+	// A ref reviews the changes of the branch since it forked
+	base, err := runGit(dir, "rev-parse", "--abbrev-ref", "HEAD")
+	require.NoError(t, err)
+	git(dir, "checkout", "-q", "-b", "feature")
+	git(dir, "commit", "-q", "-m", "Panic")
+	target, err = GetReviewTarget(strings.TrimSpace(base), false)
+	require.NoError(t, err)
+	assert.Equal(t, "the changes since "+strings.TrimSpace(base), target.Description)
+	assert.Contains(t, target.Diff, "panic(nil)")
+}
+
+func TestNumberDiffLines(t *testing.T) {
+	diff := "diff --git a/app.go b/app.go\n--- a/app.go\n+++ b/app.go\n@@ -10,3 +10,3 @@ func run() {\n a := 1\n--- b := 2\n+++ b := 3\n \n" +
+		"diff --git a/old.go b/old.go\ndeleted file mode 100644\n--- a/old.go\n+++ /dev/null\n@@ -1 +0,0 @@\n-package old\n"
+	numbered, lines := numberDiffLines(diff)
+	assert.Equal(t, "diff --git a/app.go b/app.go\n--- a/app.go\n+++ b/app.go\n@@ -10,3 +10,3 @@ func run() {\n"+
+		"   10  a := 1\n      --- b := 2\n   11 +++ b := 3\n   12  \n\n"+
+		"diff --git a/old.go b/old.go\ndeleted file mode 100644\n--- a/old.go\n+++ /dev/null\n@@ -1 +0,0 @@\n      -package old\n", numbered)
+	assert.Equal(t, map[string]map[int]bool{"app.go": {10: true, 11: true, 12: true}}, lines)
+}
+
+func TestParseReview(t *testing.T) {
+	answer := "Here is the review:\n```json\n" + `{"summary": "Adds a panic.", "findings": [
+		{"file": "main.go", "line": 4, "severity": "Minor", "message": "Unclear"},
+		{"file": "main.go", "line": 4, "severity": "blocker", "message": "Unknown severity"},
+		{"file": "main.go", "line": 5, "severity": "nit", "message": " "},
+		{"file": "main.go", "line": 4, "severity": "critical", "message": "Panics on start", "suggestion": "Remove it"}]}` + "\n```"
+	review, err := ParseReview(answer)
+	require.NoError(t, err)
+	assert.Equal(t, "Adds a panic.", review.Summary)
+	assert.Equal(t, []ReviewFinding{
+		{File: "main.go", Line: 4, Severity: SeverityCritical, Message: "Panics on start", Suggestion: "Remove it"},
+		{File: "main.go", Line: 4, Severity: SeverityMinor, Message: "Unclear"},
+		{File: "main.go", Line: 4, Severity: SeverityMinor, Message: "Unknown severity"},
+	}, review.Findings)
+
+	_, err = ParseReview("No problems found.")
+	assert.Error(t, err)
+}
+
+func TestFormatReviewMarkdown(t *testing.T) {
+	target := &ReviewTarget{Description: "the staged changes"}
+	review := &Review{Summary: "Adds a panic.", Findings: []ReviewFinding{
+		{File: "main.go", Line: 4, Severity: SeverityCritical, Message: "Panics on start", Suggestion: "Remove it"},
+		{File: "go.mod", Severity: SeverityNit, Message: "Old Go version"},
+	}}
+	assert.Equal(t, "# Code review of the staged changes\n\nAdds a panic.\n\n## Findings (1 critical, 1 nit)\n\n"+
+		"### 1. critical `main.go:4`\n\nPanics on start\n\n**Suggestion:** Remove it\n\n"+
+		"### 2. nit `go.mod`\n\nOld Go version\n", FormatReviewMarkdown(target, review))
+
+	assert.Equal(t, "# Code review of the staged changes\n\nLooks good.\n\nNo findings.\n", FormatReviewMarkdown(target, &Review{Summary: "Looks good."}))
+}
+
+func TestNewGitHubReview(t *testing.T) {
+	target := &ReviewTarget{HeadSHA: "abc123", lines: map[string]map[int]bool{"main.go": {4: true}}}
+	review := &Review{Summary: "Adds a panic.", Findings: []ReviewFinding{
+		{File: "main.go", Line: 4, Severity: SeverityCritical, Message: "Panics on start", Suggestion: "Remove it"},
+		{File: "main.go", Line: 40, Severity: SeverityMinor, Message: "Outside of the diff"},
+	}}
+
+	// Comments can only be on lines of the diff, the others go to the body
+	assert.Equal(t, GitHubReview{
+		CommitID: "abc123",
+		Body:     "Adds a panic.\n\n- `main.go:40` **minor:** Outside of the diff",
+		Event:    "COMMENT",
+		Comments: []GitHubReviewComment{{Path: "main.go", Line: 4, Side: "RIGHT", Body: "**critical:** Panics on start\n\n**Suggestion:** Remove it"}},
+	}, NewGitHubReview(target, review))
+}
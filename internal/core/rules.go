@@ -0,0 +1,58 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pederhe/nca/pkg/log"
+)
+
+// maxRulesFileSize limits how much of a rules file is added to the system prompt
+const maxRulesFileSize = 32 * 1024
+
+// getRulesFiles returns the rules files added to the system prompt: the global
+// ~/.nca/rules.md and the rules.md in .nca of the workspace
+func getRulesFiles() []string {
+	var files []string
+	if home, err := os.UserHomeDir(); err == nil {
+		files = append(files, filepath.Join(home, ".nca", "rules.md"))
+	}
+	// Project rules of untrusted workspaces could instruct the model to run anything
+	if IsWorkspaceTrusted() {
+		files = append(files, filepath.Join(".nca", "rules.md"))
+	}
+	return files
+}
+
+// loadRules reads the rules files, project rules come last so they can refine the global ones
+func loadRules() string {
+	var sections []string
+	seen := map[string]bool{}
+	for _, file := range getRulesFiles() {
+		absPath, err := filepath.Abs(file)
+		if err != nil || seen[absPath] {
+			continue
+		}
+		seen[absPath] = true
+
+		data, err := os.ReadFile(file)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				log.LogDebug("Failed to read rules file " + file + ": " + err.Error() + "\n")
+			}
+			continue
+		}
+
+		rules := strings.TrimSpace(string(data))
+		if rules == "" {
+			continue
+		}
+		if len(rules) > maxRulesFileSize {
+			rules = truncateAtLine(rules, maxRulesFileSize) + fmt.Sprintf("\n[Rules truncated to %d KB]", maxRulesFileSize/1024)
+		}
+		sections = append(sections, fmt.Sprintf("# Rules from %s\n\n%s", toPosix(file), rules))
+	}
+	return strings.Join(sections, "\n\n")
+}
@@ -0,0 +1,48 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadRules(t *testing.T) {
+	tmpDir := t.TempDir()
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(originalDir)
+	os.Chdir(tmpDir)
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	assert.Empty(t, loadRules())
+
+	assert.NoError(t, os.MkdirAll(filepath.Join(home, ".nca"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(home, ".nca", "rules.md"), []byte("Use British English.\n"), 0644))
+	assert.NoError(t, os.MkdirAll(".nca", 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(".nca", "rules.md"), []byte("Never run `make deploy`. {{.CWD}}\n"), 0644))
+
+	// Project rules are only read in trusted workspaces
+	rules := loadRules()
+	assert.Contains(t, rules, "Use British English.")
+	assert.NotContains(t, rules, "make deploy")
+	trustWorkspace(t)
+
+	rules = loadRules()
+	assert.Contains(t, rules, "Use British English.")
+	assert.Contains(t, rules, "# Rules from .nca/rules.md\n\nNever run `make deploy`.")
+
+	// Global rules come first, project rules refine them
+	assert.Less(t, strings.Index(rules, "British"), strings.Index(rules, "make deploy"))
+
+	// Rules are appended verbatim, not executed as a template
+	prompt, err := BuildSystemPrompt()
+	assert.NoError(t, err)
+	assert.Contains(t, prompt, "USER'S CUSTOM INSTRUCTIONS")
+	assert.Contains(t, prompt, "Never run `make deploy`. {{.CWD}}")
+}
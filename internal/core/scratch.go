@@ -0,0 +1,84 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// The scratch directory of the current task, for experiments, downloaded files and generated
+// assets that don't belong in the project. It is created in .nca/scratch of the workspace, so
+// download_file can write to it, and removed when the task ends unless nca runs with --keep-scratch.
+var (
+	scratchDir   string
+	keepScratch  bool
+	scratchMutex sync.Mutex
+)
+
+// scratchRoot is the directory holding the scratch directories of all tasks
+var scratchRoot = filepath.Join(".nca", "scratch")
+
+// SetKeepScratch sets whether scratch directories are kept when a task ends
+func SetKeepScratch(keep bool) {
+	scratchMutex.Lock()
+	defer scratchMutex.Unlock()
+	keepScratch = keep
+}
+
+// GetScratchDir returns the absolute path of the scratch directory of the current task,
+// creating it on first use
+func GetScratchDir() (string, error) {
+	scratchMutex.Lock()
+	defer scratchMutex.Unlock()
+
+	if scratchDir != "" {
+		if _, err := os.Stat(scratchDir); err == nil {
+			return scratchDir, nil
+		}
+	}
+
+	root, err := filepath.Abs(scratchRoot)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return "", err
+	}
+	// Keep scratch files out of git status without touching the project's .gitignore
+	gitignore := filepath.Join(root, ".gitignore")
+	if _, err := os.Stat(gitignore); os.IsNotExist(err) {
+		os.WriteFile(gitignore, []byte("*\n"), 0644)
+	}
+
+	dir := filepath.Join(root, fmt.Sprintf("%s-%d", time.Now().Format("20060102-150405"), os.Getpid()))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	scratchDir = dir
+	return scratchDir, nil
+}
+
+// CleanupScratchDir ends the scratch directory of the current task. The directory is removed
+// unless scratch directories are kept, the next task gets a new one.
+// It returns the path of a kept directory.
+func CleanupScratchDir() string {
+	scratchMutex.Lock()
+	defer scratchMutex.Unlock()
+
+	dir := scratchDir
+	scratchDir = ""
+	if dir == "" {
+		return ""
+	}
+	if keepScratch {
+		return dir
+	}
+	os.RemoveAll(dir)
+	// Remove the root as well when no other instance uses it
+	if entries, err := os.ReadDir(filepath.Dir(dir)); err == nil && len(entries) == 1 && entries[0].Name() == ".gitignore" {
+		os.RemoveAll(filepath.Dir(dir))
+	}
+	return ""
+}
@@ -0,0 +1,44 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScratchDir(t *testing.T) {
+	tmpDir := t.TempDir()
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(originalDir)
+	os.Chdir(tmpDir)
+	defer SetKeepScratch(false)
+
+	dir, err := GetScratchDir()
+	assert.NoError(t, err)
+	assert.True(t, filepath.IsAbs(dir))
+	assert.DirExists(t, dir)
+	assert.FileExists(t, filepath.Join(".nca", "scratch", ".gitignore"))
+
+	// The directory is reused within a task
+	again, err := GetScratchDir()
+	assert.NoError(t, err)
+	assert.Equal(t, dir, again)
+
+	// Ending the task removes it
+	assert.Empty(t, CleanupScratchDir())
+	assert.NoDirExists(t, dir)
+	assert.NoDirExists(t, filepath.Join(".nca", "scratch"))
+
+	// Kept directories survive the end of the task
+	SetKeepScratch(true)
+	dir, err = GetScratchDir()
+	assert.NoError(t, err)
+	assert.Equal(t, dir, CleanupScratchDir())
+	assert.DirExists(t, dir)
+	assert.Empty(t, CleanupScratchDir())
+}
@@ -0,0 +1,257 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// How similar, from 0 to 1, the closest lines to an unmatched SEARCH block must be to be shown
+const minClosestMatchSimilarity = 0.5
+
+// searchReplaceBlock is one SEARCH/REPLACE block of a replace_in_file diff
+type searchReplaceBlock struct {
+	search  string
+	replace string
+	// The indentation of the first lines, which the patterns don't include in search and replace
+	searchIndentation  string
+	replaceIndentation string
+}
+
+// parseSearchReplaceBlocks returns the SEARCH/REPLACE blocks of a replace_in_file diff
+func parseSearchReplaceBlocks(diff string) ([]searchReplaceBlock, error) {
+	// Parse SEARCH/REPLACE blocks - more flexible regex to handle different line endings
+	// This regex makes newlines optional around the markers to be more flexible
+	re := regexp.MustCompile(`<{7}\s*SEARCH\s*\n?([\s\S]*?)\n?\s*={7}\s*\n?([\s\S]*?)\n?\s*>{7}\s*REPLACE`)
+	matches := re.FindAllStringSubmatchIndex(diff, -1)
+
+	if len(matches) == 0 {
+		// Fall back to the original regex if the flexible one doesn't match
+		reOriginal := regexp.MustCompile(`<<<<<<< SEARCH\n([\s\S]*?)\n=======\n([\s\S]*?)\n>>>>>>> REPLACE`)
+		matches = reOriginal.FindAllStringSubmatchIndex(diff, -1)
+
+		if len(matches) == 0 {
+			// Try one more regex that doesn't require newlines
+			reLastAttempt := regexp.MustCompile(`<<<<<<< SEARCH([\s\S]*?)=======([\s\S]*?)>>>>>>> REPLACE`)
+			matches = reLastAttempt.FindAllStringSubmatchIndex(diff, -1)
+
+			if len(matches) == 0 {
+				return nil, errors.New("No valid SEARCH/REPLACE blocks found. Format should be:\n<<<<<<< SEARCH\ntext to search\n=======\ntext to replace with\n>>>>>>> REPLACE")
+			}
+		}
+	}
+
+	blocks := make([]searchReplaceBlock, 0, len(matches))
+	for _, match := range matches {
+		blocks = append(blocks, searchReplaceBlock{
+			search:             diff[match[2]:match[3]],
+			replace:            diff[match[4]:match[5]],
+			searchIndentation:  indentationBefore(diff, match[2]),
+			replaceIndentation: indentationBefore(diff, match[4]),
+		})
+	}
+	return blocks, nil
+}
+
+// indentationBefore returns the spaces and tabs before pos in text if they start a line
+func indentationBefore(text string, pos int) string {
+	start := pos
+	for start > 0 && (text[start-1] == ' ' || text[start-1] == '\t') {
+		start--
+	}
+	if start > 0 && text[start-1] != '\n' {
+		return ""
+	}
+	return text[start:pos]
+}
+
+// applySearchReplaceBlocks applies the SEARCH/REPLACE blocks of a replace_in_file diff to content.
+// A block whose SEARCH text isn't found exactly may still match ignoring whitespace, the returned
+// notes say which blocks did. If any block doesn't match at all, the error lists every block that
+// didn't with the closest lines of the content, and none of the blocks are applied.
+func applySearchReplaceBlocks(fileContent string, diff string) (string, []string, error) {
+	blocks, err := parseSearchReplaceBlocks(diff)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var notes, failures []string
+	for i, block := range blocks {
+		// Trim any leading/trailing whitespace to make the matching more robust
+		search := strings.TrimSpace(block.search)
+		if search == "" {
+			failures = append(failures, fmt.Sprintf("Block #%d has an empty SEARCH section. Use write_to_file to write a whole file.", i+1))
+			continue
+		}
+
+		if strings.Contains(fileContent, search) {
+			fileContent = strings.Replace(fileContent, search, block.replace, 1)
+			continue
+		}
+
+		// Compare whole lines instead
+		searchLines := strings.Split(strings.Trim(strings.TrimRight(block.search, " \t\n"), "\n"), "\n")
+		lines := strings.Split(fileContent, "\n")
+		if pos, mode := findSearchLines(lines, searchLines); pos >= 0 {
+			// An empty REPLACE section removes the matched lines
+			var replaceLines []string
+			if strings.TrimSpace(block.replace) != "" {
+				replaceLines = reindentReplaceLines(block, strings.Split(strings.Trim(block.replace, "\n"), "\n"), lines[pos:pos+len(searchLines)])
+			}
+			lines = append(lines[:pos], append(replaceLines, lines[pos+len(searchLines):]...)...)
+			fileContent = strings.Join(lines, "\n")
+			notes = append(notes, fmt.Sprintf("Block #%d matched lines %d-%d %s", i+1, pos+1, pos+len(searchLines), mode))
+			continue
+		}
+
+		failures = append(failures, describeUnmatchedBlock(i+1, lines, searchLines))
+	}
+
+	if len(failures) > 0 {
+		return "", nil, fmt.Errorf("%d of %d SEARCH blocks didn't match, the file was not changed.\n\n%s\n\nThe SEARCH text must match the current file content, read the file again if it may have changed and send all blocks again with the failing ones fixed.",
+			len(failures), len(blocks), strings.Join(failures, "\n\n"))
+	}
+	return fileContent, notes, nil
+}
+
+// findSearchLines returns the first position where searchLines match lines ignoring trailing or
+// all whitespace, and how they matched, or -1
+func findSearchLines(lines []string, searchLines []string) (int, string) {
+	compares := []struct {
+		mode  string
+		equal func(a, b string) bool
+	}{
+		{"ignoring trailing whitespace", func(a, b string) bool {
+			return strings.TrimRight(a, " \t") == strings.TrimRight(b, " \t")
+		}},
+		{"ignoring whitespace", func(a, b string) bool {
+			return strings.Join(strings.Fields(a), " ") == strings.Join(strings.Fields(b), " ")
+		}},
+	}
+
+	if len(searchLines) > len(lines) {
+		return -1, ""
+	}
+	for _, compare := range compares {
+		if pos := closestMatch(lines, searchLines, 0, 0, compare.equal); pos >= 0 {
+			return pos, compare.mode
+		}
+	}
+	return -1, ""
+}
+
+// leadingWhitespace returns the indentation of a line
+func leadingWhitespace(line string) string {
+	return line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+}
+
+// reindentReplaceLines changes the indentation of the REPLACE lines of a block whose first SEARCH
+// line matched a line of the file with other indentation. The part of the block's indentation
+// that differs from the file's is replaced in every line, so nested lines keep their depth.
+func reindentReplaceLines(block searchReplaceBlock, replaceLines []string, matched []string) []string {
+	blockIndentation, fileIndentation := block.searchIndentation, leadingWhitespace(matched[0])
+	same := 0
+	for same < len(blockIndentation) && same < len(fileIndentation) &&
+		blockIndentation[len(blockIndentation)-1-same] == fileIndentation[len(fileIndentation)-1-same] {
+		same++
+	}
+	removed, added := blockIndentation[:len(blockIndentation)-same], fileIndentation[:len(fileIndentation)-same]
+
+	replaceLines[0] = block.replaceIndentation + replaceLines[0]
+	for i, line := range replaceLines {
+		if strings.TrimSpace(line) != "" && strings.HasPrefix(line, removed) {
+			rest := line[len(removed):]
+			replaceLines[i] = added + convertIndentation(leadingWhitespace(rest), removed, added) + strings.TrimLeft(rest, " \t")
+		}
+	}
+	return replaceLines
+}
+
+// convertIndentation converts the indentation of a nested line from spaces to tabs or back, if
+// the block indents with spaces where the file has tabs or the other way around. The width of a
+// tab is the one of the first lines.
+func convertIndentation(indentation string, from string, to string) string {
+	isAll := func(text string, char string) bool {
+		return text != "" && strings.Trim(text, char) == ""
+	}
+	switch {
+	case isAll(from, " ") && isAll(to, "\t") && len(from)%len(to) == 0 && isAll(indentation, " "):
+		width := len(from) / len(to)
+		return strings.Repeat("\t", len(indentation)/width) + strings.Repeat(" ", len(indentation)%width)
+	case isAll(from, "\t") && isAll(to, " ") && len(to)%len(from) == 0 && isAll(indentation, "\t"):
+		return strings.Repeat(" ", len(indentation)*len(to)/len(from))
+	}
+	return indentation
+}
+
+// describeUnmatchedBlock explains which SEARCH block didn't match and shows the lines of the
+// content most similar to it, so the model can correct the block
+func describeUnmatchedBlock(number int, lines []string, searchLines []string) string {
+	description := fmt.Sprintf("Block #%d didn't match, these lines weren't found:\n%s", number, strings.Join(searchLines, "\n"))
+
+	pos, similarity := mostSimilarLines(lines, searchLines)
+	if pos < 0 || similarity < minClosestMatchSimilarity {
+		return description + "\n\nNo similar lines were found in the file."
+	}
+
+	end := pos + len(searchLines)
+	if end > len(lines) {
+		end = len(lines)
+	}
+	var closest strings.Builder
+	for i := pos; i < end; i++ {
+		closest.WriteString(fmt.Sprintf("%4d: %s\n", i+1, lines[i]))
+	}
+	return fmt.Sprintf("%s\n\nThe closest match is lines %d-%d (%.0f%% similar):\n%s",
+		description, pos+1, end, similarity*100, strings.TrimRight(closest.String(), "\n"))
+}
+
+// mostSimilarLines returns the start of the window of lines most similar to searchLines and its
+// similarity from 0 to 1, or -1 if there are no lines
+func mostSimilarLines(lines []string, searchLines []string) (int, float64) {
+	best, bestSimilarity := -1, 0.0
+	last := len(lines) - len(searchLines)
+	if last < 0 {
+		last = 0
+	}
+	for pos := 0; pos <= last && pos < len(lines); pos++ {
+		total := 0.0
+		for i, searchLine := range searchLines {
+			if pos+i < len(lines) {
+				total += lineSimilarity(lines[pos+i], searchLine)
+			}
+		}
+		if similarity := total / float64(len(searchLines)); best < 0 || similarity > bestSimilarity {
+			best, bestSimilarity = pos, similarity
+		}
+	}
+	return best, bestSimilarity
+}
+
+// lineSimilarity compares two lines ignoring surrounding whitespace by the Dice coefficient of
+// their character pairs, 1 for equal lines and 0 for lines without common pairs
+func lineSimilarity(a, b string) float64 {
+	a, b = strings.TrimSpace(a), strings.TrimSpace(b)
+	if a == b {
+		return 1
+	}
+	aRunes, bRunes := []rune(a), []rune(b)
+	if len(aRunes) < 2 || len(bRunes) < 2 {
+		return 0
+	}
+
+	pairs := make(map[[2]rune]int, len(aRunes)-1)
+	for i := 0; i < len(aRunes)-1; i++ {
+		pairs[[2]rune{aRunes[i], aRunes[i+1]}]++
+	}
+	common := 0
+	for i := 0; i < len(bRunes)-1; i++ {
+		pair := [2]rune{bRunes[i], bRunes[i+1]}
+		if pairs[pair] > 0 {
+			pairs[pair]--
+			common++
+		}
+	}
+	return 2 * float64(common) / float64(len(aRunes)-1+len(bRunes)-1)
+}
@@ -0,0 +1,97 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplySearchReplaceBlocks(t *testing.T) {
+	content := "func main() {\n\tx := 1  \n\tif x > 0 {\n\t\tprintln(x)\n\t}\n}\n"
+
+	// Exact matches are applied in order
+	updated, notes, err := applySearchReplaceBlocks(content, "<<<<<<< SEARCH\nx := 1\n=======\nx := 2\n>>>>>>> REPLACE\n<<<<<<< SEARCH\nprintln(x)\n=======\nprint(x)\n>>>>>>> REPLACE")
+	require.NoError(t, err)
+	assert.Empty(t, notes)
+	assert.Equal(t, "func main() {\n\tx := 2  \n\tif x > 0 {\n\t\tprint(x)\n\t}\n}\n", updated)
+
+	// Lines that only differ in whitespace still match
+	updated, notes, err = applySearchReplaceBlocks(content, "<<<<<<< SEARCH\n\tx := 1\n    if x > 0 {\n=======\n\tx := 3\n\tif x > 1 {\n>>>>>>> REPLACE")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Block #1 matched lines 2-3 ignoring whitespace"}, notes)
+	assert.Equal(t, "func main() {\n\tx := 3\n\tif x > 1 {\n\t\tprintln(x)\n\t}\n}\n", updated)
+}
+
+func TestApplySearchReplaceBlocksIndentation(t *testing.T) {
+	// Every REPLACE line gets the file's indentation, nested ones converted to its tabs
+	content := "func main() {\n\tif ok {\n\t\trun()\n\t}\n}\n"
+	updated, notes, err := applySearchReplaceBlocks(content, "<<<<<<< SEARCH\n    if ok {\n        run()\n    }\n=======\n    if ok {\n        run()\n        done()\n    }\n>>>>>>> REPLACE")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Block #1 matched lines 2-4 ignoring whitespace"}, notes)
+	assert.Equal(t, "func main() {\n\tif ok {\n\t\trun()\n\t\tdone()\n\t}\n}\n", updated)
+
+	// A block indented less than the file is indented like it
+	content = "class A:\n    def f(self):\n        return 1\n"
+	updated, _, err = applySearchReplaceBlocks(content, "<<<<<<< SEARCH\ndef f(self):\n    return 1\n=======\ndef f(self):\n    x = 1\n    return x\n>>>>>>> REPLACE")
+	require.NoError(t, err)
+	assert.Equal(t, "class A:\n    def f(self):\n        x = 1\n        return x\n", updated)
+
+	// An empty REPLACE section removes the matched lines
+	updated, notes, err = applySearchReplaceBlocks("a\n    b  \n    c\nd\n", "<<<<<<< SEARCH\nb\nc\n=======\n>>>>>>> REPLACE")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Block #1 matched lines 2-3 ignoring whitespace"}, notes)
+	assert.Equal(t, "a\nd\n", updated)
+}
+
+func TestApplySearchReplaceBlocksFailures(t *testing.T) {
+	content := "package main\n\nfunc add(a, b int) int {\n\treturn a + b\n}\n"
+
+	// Every block that doesn't match is reported, with the closest lines when there are any
+	diff := "<<<<<<< SEARCH\nfunc add(a, b int) int {\n=======\nfunc add(a, b int64) int64 {\n>>>>>>> REPLACE\n" +
+		"<<<<<<< SEARCH\nfunc add(a, b int) int {\n\treturn a - b\n=======\nfunc sub(a, b int) int {\n>>>>>>> REPLACE\n" +
+		"<<<<<<< SEARCH\nimport \"os\"\n=======\n>>>>>>> REPLACE\n" +
+		"<<<<<<< SEARCH\n\n=======\nx\n>>>>>>> REPLACE"
+	_, _, err := applySearchReplaceBlocks(content, diff)
+	require.Error(t, err)
+	message := err.Error()
+	assert.Contains(t, message, "3 of 4 SEARCH blocks didn't match, the file was not changed")
+	assert.NotContains(t, message, "Block #1")
+	assert.Contains(t, message, "Block #2 didn't match, these lines weren't found:\nfunc add(a, b int) int {\n\treturn a - b")
+	assert.Contains(t, message, "The closest match is lines 3-4 (")
+	assert.Contains(t, message, "   4: \treturn a + b")
+	assert.Contains(t, message, "Block #3 didn't match, these lines weren't found:\nimport \"os\"\n\nNo similar lines were found in the file.")
+	assert.Contains(t, message, "Block #4 has an empty SEARCH section")
+}
+
+func TestReplaceInFileUnmatchedBlock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notes.txt")
+	require.NoError(t, os.WriteFile(path, []byte("first\nsecond\n"), 0644))
+
+	// The matching block isn't applied either
+	result := ReplaceInFile(map[string]interface{}{
+		"path": path,
+		"diff": "<<<<<<< SEARCH\nfirst\n=======\n1st\n>>>>>>> REPLACE\n<<<<<<< SEARCH\nthird\n=======\n3rd\n>>>>>>> REPLACE",
+	})
+	assert.Contains(t, result, "Error: 1 of 2 SEARCH blocks didn't match")
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "first\nsecond\n", string(content))
+
+	result = ReplaceInFile(map[string]interface{}{
+		"path": path,
+		"diff": "<<<<<<< SEARCH\nfirst  \nsecond\n=======\n1st\n2nd\n>>>>>>> REPLACE",
+	})
+	assert.Contains(t, result, "File successfully updated")
+	assert.Contains(t, result, "Block #1 matched lines 1-2 ignoring trailing whitespace")
+}
+
+func TestLineSimilarity(t *testing.T) {
+	assert.Equal(t, 1.0, lineSimilarity("  return a + b", "return a + b"))
+	assert.Equal(t, 0.0, lineSimilarity("abc", "xyz"))
+	similarity := lineSimilarity("return a + b", "return a - b")
+	assert.Greater(t, similarity, 0.5)
+	assert.Less(t, similarity, 1.0)
+}
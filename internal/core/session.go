@@ -0,0 +1,169 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Session is a saved REPL conversation that can be resumed later
+type Session struct {
+	Name         string              `json:"name"`
+	Title        string              `json:"title,omitempty"`         // Generated from the conversation when it's saved
+	SystemPrompt string              `json:"system_prompt,omitempty"` // The system prompt variant the session used
+	CWD          string              `json:"cwd"`
+	SavedAt      time.Time           `json:"saved_at"`
+	AgentMode    bool                `json:"agent_mode"`
+	DeletedRange [2]int              `json:"deleted_range"`
+	Conversation []map[string]string `json:"conversation"`
+}
+
+// Valid session names, used as file names
+var sessionNameRegex = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// maxTitlePromptChars limits the conversation given to the model to generate a session title
+const maxTitlePromptChars = 4000
+
+// getSessionsDir returns the directory where sessions are stored
+func getSessionsDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".nca", "sessions"), nil
+}
+
+// getSessionPath returns the file path of a session
+func getSessionPath(name string) (string, error) {
+	if !sessionNameRegex.MatchString(name) {
+		return "", fmt.Errorf("invalid session name '%s', use letters, digits, '.', '_' or '-'", name)
+	}
+	dir, err := getSessionsDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, name+".json"), nil
+}
+
+// SaveSession writes a session to ~/.nca/sessions, a timestamp is used if it has no name. Only the
+// user can read sessions, the conversation may hold secrets from command output and files.
+func SaveSession(session *Session) error {
+	if session.Name == "" {
+		session.Name = time.Now().Format("20060102-150405")
+	}
+	path, err := getSessionPath(session.Name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	// MkdirAll keeps the mode of an existing directory
+	if err := os.Chmod(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	if session.CWD == "" {
+		session.CWD, _ = os.Getwd()
+	}
+	session.SavedAt = time.Now()
+
+	data, err := json.MarshalIndent(session, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return err
+	}
+	// WriteFile keeps the mode of an existing file
+	return os.Chmod(path, 0600)
+}
+
+// BuildTitlePrompt returns the request to generate the title of a conversation from its first
+// user messages, or "" if the conversation has none
+func BuildTitlePrompt(conversation []map[string]string) string {
+	var requests strings.Builder
+	for _, message := range conversation {
+		if message["role"] == "user" && requests.Len() < maxTitlePromptChars {
+			requests.WriteString(message["content"] + "\n")
+		}
+	}
+	if requests.Len() == 0 {
+		return ""
+	}
+	text := requests.String()
+	if len(text) > maxTitlePromptChars {
+		text = text[:maxTitlePromptChars]
+	}
+	return "Write a title of at most 8 words for a coding session that starts with these requests. Answer with the title only, without quotes.\n\n" + text
+}
+
+// LoadSession reads a saved session, the most recent session is loaded if name is empty
+func LoadSession(name string) (*Session, error) {
+	if name == "" {
+		sessions, err := ListSessions()
+		if err != nil {
+			return nil, err
+		}
+		if len(sessions) == 0 {
+			return nil, fmt.Errorf("no saved sessions found")
+		}
+		return sessions[0], nil
+	}
+
+	path, err := getSessionPath(name)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("session '%s' not found", name)
+		}
+		return nil, err
+	}
+
+	var session Session
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, fmt.Errorf("failed to parse session '%s': %w", name, err)
+	}
+	return &session, nil
+}
+
+// ListSessions returns all saved sessions, most recent first
+func ListSessions() ([]*Session, error) {
+	dir, err := getSessionsDir()
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var sessions []*Session
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		session, err := LoadSession(strings.TrimSuffix(entry.Name(), ".json"))
+		if err != nil {
+			continue
+		}
+		sessions = append(sessions, session)
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].SavedAt.After(sessions[j].SavedAt)
+	})
+	return sessions, nil
+}
@@ -0,0 +1,77 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSaveAndLoadSession(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	// No sessions yet
+	_, err := LoadSession("")
+	assert.Error(t, err)
+
+	first := &Session{
+		Name:         "first",
+		AgentMode:    false,
+		DeletedRange: [2]int{2, 5},
+		Conversation: []map[string]string{
+			{"role": "user", "content": "hello"},
+			{"role": "assistant", "content": "hi"},
+		},
+	}
+	assert.NoError(t, SaveSession(first))
+
+	// Only the user can read sessions
+	info, err := os.Stat(filepath.Join(home, ".nca", "sessions"))
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0700), info.Mode().Perm())
+	info, err = os.Stat(filepath.Join(home, ".nca", "sessions", "first.json"))
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	loaded, err := LoadSession("first")
+	assert.NoError(t, err)
+	assert.Equal(t, first.Conversation, loaded.Conversation)
+	assert.Equal(t, [2]int{2, 5}, loaded.DeletedRange)
+	assert.False(t, loaded.AgentMode)
+	assert.NotEmpty(t, loaded.CWD)
+
+	// Sessions without a name get a timestamp name
+	time.Sleep(10 * time.Millisecond)
+	second := &Session{AgentMode: true}
+	assert.NoError(t, SaveSession(second))
+	assert.NotEmpty(t, second.Name)
+
+	// The most recent session is loaded by default
+	latest, err := LoadSession("")
+	assert.NoError(t, err)
+	assert.Equal(t, second.Name, latest.Name)
+
+	sessions, err := ListSessions()
+	assert.NoError(t, err)
+	assert.Len(t, sessions, 2)
+
+	// Invalid and unknown names
+	assert.Error(t, SaveSession(&Session{Name: "../escape"}))
+	_, err = LoadSession("missing")
+	assert.Error(t, err)
+}
+
+func TestBuildTitlePrompt(t *testing.T) {
+	assert.Empty(t, BuildTitlePrompt(nil))
+
+	prompt := BuildTitlePrompt([]map[string]string{
+		{"role": "user", "content": "Add a health check endpoint"},
+		{"role": "assistant", "content": "I'll read the router first"},
+		{"role": "user", "content": "Also log requests"},
+	})
+	assert.Contains(t, prompt, "Add a health check endpoint\nAlso log requests")
+	assert.NotContains(t, prompt, "router")
+}
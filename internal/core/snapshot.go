@@ -0,0 +1,266 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pederhe/nca/pkg/config"
+)
+
+// Commands that may lose uncommitted changes, a snapshot is taken before them
+var riskyCommands = []struct {
+	pattern *regexp.Regexp
+	reason  string
+}{
+	{regexp.MustCompile(`\brm\s+(-[a-zA-Z-]*\s+)*-[a-zA-Z]*[rR]`), "recursive removal"},
+	{regexp.MustCompile(`(?i)\b(rmdir|rd|del)\s.*/s\b`), "recursive removal"},
+	{regexp.MustCompile(`(?i)\bremove-item\b.*\s-recurse\b`), "recursive removal"},
+	{regexp.MustCompile(`\bfind\s.*\s-delete\b`), "find -delete"},
+	{regexp.MustCompile(`\bgit\s+reset\s(.*\s)?--hard\b`), "git reset --hard"},
+	{regexp.MustCompile(`\bgit\s+checkout\s(.*\s)?(--|\.)(\s|$)`), "git checkout of files"},
+	{regexp.MustCompile(`\bgit\s+restore\b`), "git restore"},
+	{regexp.MustCompile(`\bgit\s+clean\b`), "git clean"},
+}
+
+// Default number of files a single edit must change to take a snapshot before it, configurable
+// with auto_snapshot_min_files
+const DEFAULT_SNAPSHOT_MIN_FILES = 3
+
+// Most files a snapshot adds to the shadow repository at once, more are likely build output or
+// dependencies that aren't ignored
+const maxSnapshotNewFiles = 20000
+
+// isAutoSnapshotEnabled returns whether snapshots are taken before risky operations, which is
+// enabled with the auto_snapshot config
+func isAutoSnapshotEnabled() bool {
+	value := config.Get("auto_snapshot")
+	return value == "true" || value == "1"
+}
+
+// getSnapshotMinFiles returns how many files an edit must change to take a snapshot before it
+func getSnapshotMinFiles() int {
+	if value, err := strconv.Atoi(config.Get("auto_snapshot_min_files")); err == nil && value > 0 {
+		return value
+	}
+	return DEFAULT_SNAPSHOT_MIN_FILES
+}
+
+// RiskyOperation returns why a snapshot should be taken before a tool call, or "" if the call
+// isn't risky or auto_snapshot is off. Risky are commands that may lose uncommitted changes and
+// edits of several files at once.
+func RiskyOperation(toolName string, params map[string]interface{}) string {
+	if !isAutoSnapshotEnabled() {
+		return ""
+	}
+
+	switch toolName {
+	case "execute_command":
+		command, _ := params["command"].(string)
+		normalized := strings.Join(strings.Fields(command), " ")
+		for _, risky := range riskyCommands {
+			if risky.pattern.MatchString(normalized) {
+				return risky.reason
+			}
+		}
+	case "write_files", "apply_patch":
+		if files := workspaceToolPaths(toolName, params); len(files) >= getSnapshotMinFiles() {
+			return fmt.Sprintf("editing %d files", len(files))
+		}
+	}
+	return ""
+}
+
+// CreateSnapshot takes a snapshot of the workspace before a risky operation, a checkpoint of the
+// current task. Like every checkpoint it keeps a commit of all files in the shadow repository, so
+// restoring it also undoes the changes of commands. It returns nil if nothing changed since the
+// last snapshot.
+func (cm *CheckpointManager) CreateSnapshot(reason string) (*Checkpoint, error) {
+	task := ""
+	if cm.CurrentCheckpoint != nil {
+		task = cm.CurrentCheckpoint.UserPrompt
+	}
+
+	root, tree, err := gitSnapshotTree()
+	if err != nil {
+		return nil, fmt.Errorf("taking a snapshot: %s", err)
+	}
+	if last := cm.CurrentCheckpoint; last != nil && len(last.Operations) == 0 {
+		if (last.Snapshot != "" && last.GitSnapshot == "") || (tree != "" && gitTreeOf(last) == tree) {
+			return nil, nil
+		}
+	}
+
+	snapshot := Checkpoint{UserPrompt: task, Snapshot: reason}
+	if tree != "" {
+		commit, err := commitGitSnapshot(root, tree, fmt.Sprintf("nca snapshot before %s: %s", reason, task))
+		if err != nil {
+			return nil, fmt.Errorf("taking a snapshot: %s", err)
+		}
+		snapshot.GitSnapshot, snapshot.GitRoot = commit, root
+	}
+	if err := cm.addCheckpoint(snapshot); err != nil {
+		return nil, fmt.Errorf("taking a snapshot: %s", err)
+	}
+	return cm.CurrentCheckpoint, nil
+}
+
+// TaskSnapshots returns the snapshots taken during the current task
+func (cm *CheckpointManager) TaskSnapshots() []Checkpoint {
+	var snapshots []Checkpoint
+	for _, cp := range cm.Checkpoints {
+		if cp.Snapshot != "" && !cp.Timestamp.Before(cm.taskStart) {
+			snapshots = append(snapshots, cp)
+		}
+	}
+	return snapshots
+}
+
+// isGitSnapshotEnabled returns whether checkpoints keep a commit of all files in the shadow
+// repository, which can be turned off with the checkpoint_snapshots config
+func isGitSnapshotEnabled() bool {
+	return config.Get("checkpoint_snapshots") != "false"
+}
+
+// gitSnapshotRef returns the ref of the commit of a snapshot
+func gitSnapshotRef(id string) string {
+	return "refs/nca/snapshots/" + id
+}
+
+// shadowGitDir returns the shadow repository in the .nca directory, which keeps the commits of
+// the checkpoints apart from the repository of the project
+func shadowGitDir() string {
+	dir, err := filepath.Abs(filepath.Join(".nca", "shadow-git"))
+	if err != nil {
+		return filepath.Join(".nca", "shadow-git")
+	}
+	return dir
+}
+
+// runShadowGit runs a git command of the shadow repository with root as its work tree
+func runShadowGit(root string, args ...string) (string, error) {
+	return runGitEnv(root, []string{"GIT_DIR=" + shadowGitDir(), "GIT_WORK_TREE=" + root}, args...)
+}
+
+// snapshotRoot returns the directory whose files are snapshotted: the git repository of the
+// workspace, so commands changing any file of it can be undone, or the workspace itself
+func snapshotRoot() string {
+	roots := GetWorkspaceRoots()
+	if len(roots) == 0 {
+		return ""
+	}
+	if top, err := runGit(roots[0], "rev-parse", "--show-toplevel"); err == nil {
+		return filepath.Clean(strings.TrimSpace(top))
+	}
+	return roots[0]
+}
+
+// initShadowGit creates the shadow repository if it doesn't exist yet. Besides the ignore files of
+// the project, the directories of nca and of dependencies are left out of the snapshots.
+func initShadowGit() error {
+	dir := shadowGitDir()
+	if _, err := os.Stat(filepath.Join(dir, "HEAD")); err == nil {
+		return nil
+	}
+	if _, err := runGit(".", "init", "--quiet", "--bare", dir); err != nil {
+		return err
+	}
+	exclude := ".nca/\nnode_modules/\n__pycache__/\n"
+	if err := os.MkdirAll(filepath.Join(dir, "info"), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, "info", "exclude"), []byte(exclude), 0644)
+}
+
+// gitSnapshotTree stages all files of the snapshot root that aren't ignored in the index of the
+// shadow repository and writes their tree. It returns empty strings if snapshots are off, git
+// isn't available or the root is the home or root directory, which would be too large.
+func gitSnapshotTree() (string, string, error) {
+	root := snapshotRoot()
+	home, _ := os.UserHomeDir()
+	if !isGitSnapshotEnabled() || root == "" || root == home || filepath.Dir(root) == root {
+		return "", "", nil
+	}
+	if _, err := exec.LookPath("git"); err != nil {
+		return "", "", nil
+	}
+	if err := initShadowGit(); err != nil {
+		return "", "", err
+	}
+
+	// Only the files added since the last snapshot have to be hashed
+	untracked, err := runShadowGit(root, "ls-files", "--others", "--exclude-standard", "-z")
+	if err != nil {
+		return "", "", err
+	}
+	if count := strings.Count(untracked, "\x00"); count > maxSnapshotNewFiles {
+		return "", "", fmt.Errorf("%d new files in %s, more than the %d a snapshot takes", count, root, maxSnapshotNewFiles)
+	}
+
+	tree, err := writeShadowTree(root)
+	if err != nil {
+		return "", "", err
+	}
+	return root, tree, nil
+}
+
+// writeShadowTree stages the current files of root in the index of the shadow repository and
+// returns their tree
+func writeShadowTree(root string) (string, error) {
+	if _, err := runShadowGit(root, "add", "-A", "--", "."); err != nil {
+		return "", err
+	}
+	tree, err := runShadowGit(root, "write-tree")
+	return strings.TrimSpace(tree), err
+}
+
+// commitGitSnapshot commits a snapshot tree in the shadow repository
+func commitGitSnapshot(root string, tree string, message string) (string, error) {
+	// The snapshot doesn't need the identity of the user, which may not be configured
+	env := []string{"GIT_DIR=" + shadowGitDir(), "GIT_WORK_TREE=" + root,
+		"GIT_AUTHOR_NAME=nca", "GIT_AUTHOR_EMAIL=nca@localhost", "GIT_COMMITTER_NAME=nca", "GIT_COMMITTER_EMAIL=nca@localhost"}
+	commit, err := runGitEnv(root, env, "commit-tree", tree, "-m", message)
+	return strings.TrimSpace(commit), err
+}
+
+// gitTreeOf returns the tree of the commit of a snapshot
+func gitTreeOf(snapshot *Checkpoint) string {
+	if snapshot.GitSnapshot == "" {
+		return ""
+	}
+	tree, err := runShadowGit(snapshot.GitRoot, "rev-parse", snapshot.GitSnapshot+"^{tree}")
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(tree)
+}
+
+// restoreGitSnapshot brings the files of the snapshot root back to the commit of a snapshot: the
+// changed and deleted files are restored and the files created after it are removed. Ignored
+// files are left as they are.
+func restoreGitSnapshot(snapshot Checkpoint) error {
+	// The current files are staged first, so they can be switched to the snapshot like a branch
+	current, err := writeShadowTree(snapshot.GitRoot)
+	if err != nil {
+		return err
+	}
+	_, err = runShadowGit(snapshot.GitRoot, "read-tree", "-m", "-u", current, snapshot.GitSnapshot)
+	return err
+}
+
+// setGitSnapshotRef keeps the commit of a snapshot from being pruned, it isn't reachable from a branch
+func setGitSnapshotRef(snapshot Checkpoint) error {
+	_, err := runShadowGit(snapshot.GitRoot, "update-ref", gitSnapshotRef(snapshot.ID), snapshot.GitSnapshot)
+	return err
+}
+
+// deleteGitSnapshot deletes the ref of the commit of a snapshot
+func deleteGitSnapshot(snapshot Checkpoint) {
+	if snapshot.GitSnapshot != "" {
+		runShadowGit(snapshot.GitRoot, "update-ref", "-d", gitSnapshotRef(snapshot.ID))
+	}
+}
@@ -0,0 +1,138 @@
+package core
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/pederhe/nca/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRiskyOperation(t *testing.T) {
+	t.Chdir(t.TempDir())
+	command := func(command string) string {
+		return RiskyOperation("execute_command", map[string]interface{}{"command": command})
+	}
+
+	assert.Equal(t, "", command("rm -rf build"), "snapshots are off by default")
+	require.NoError(t, config.Set("auto_snapshot", "true", false))
+
+	assert.Equal(t, "recursive removal", command("rm -rf build"))
+	assert.Equal(t, "recursive removal", command("rm -v -r build"))
+	assert.Equal(t, "git reset --hard", command("git reset --hard HEAD~1"))
+	assert.Equal(t, "git checkout of files", command("git checkout -- ."))
+	assert.Equal(t, "git clean", command("git clean -fd"))
+	assert.Equal(t, "recursive removal", command(`rmdir /s /q build`))
+	assert.Equal(t, "", command("rm main.go"))
+	assert.Equal(t, "", command("git checkout main"))
+	assert.Equal(t, "", command("go test ./..."))
+
+	files := []FileWrite{{Path: "a.go"}, {Path: "b.go"}}
+	assert.Equal(t, "", RiskyOperation("write_files", map[string]interface{}{"files": files}))
+	files = append(files, FileWrite{Path: "c.go"})
+	assert.Equal(t, "editing 3 files", RiskyOperation("write_files", map[string]interface{}{"files": files}))
+	require.NoError(t, config.Set("auto_snapshot_min_files", "4", false))
+	assert.Equal(t, "", RiskyOperation("write_files", map[string]interface{}{"files": files}))
+}
+
+func TestCreateSnapshotGit(t *testing.T) {
+	dir := initGitRepo(t, map[string]string{"main.go": "package main\n"})
+	t.Chdir(dir)
+	ResetWorkingDir()
+
+	cm := NewCheckpointManager()
+	cm.CreateCheckpoint("clean up the repository")
+	require.NotEmpty(t, cm.CurrentCheckpoint.GitSnapshot)
+
+	// Nothing changed since the checkpoint
+	again, err := cm.CreateSnapshot("git clean")
+	require.NoError(t, err)
+	assert.Nil(t, again)
+
+	require.NoError(t, os.WriteFile("main.go", []byte("package main // edited\n"), 0644))
+	require.NoError(t, os.WriteFile("notes.txt", []byte("untracked\n"), 0644))
+	snapshot, err := cm.CreateSnapshot("git clean")
+	require.NoError(t, err)
+	require.NotNil(t, snapshot)
+	assert.Equal(t, "clean up the repository", snapshot.UserPrompt)
+	assert.NotEmpty(t, snapshot.GitSnapshot)
+	assert.Len(t, cm.TaskSnapshots(), 1)
+
+	// The repository of the user isn't changed
+	status, err := exec.Command("git", "status", "--porcelain").Output()
+	require.NoError(t, err)
+	assert.Equal(t, " M main.go\n?? .nca/\n?? notes.txt\n", string(status))
+	refs, err := exec.Command("git", "for-each-ref", "refs/nca").Output()
+	require.NoError(t, err)
+	assert.Empty(t, string(refs))
+
+	for _, args := range [][]string{{"checkout", "--", "."}, {"clean", "-fdq", "-e", ".nca"}} {
+		require.NoError(t, exec.Command("git", args...).Run())
+	}
+	require.NoError(t, os.WriteFile("new.txt", []byte("created later\n"), 0644))
+
+	// Restoring brings back the changes undone by the commands and removes the new file
+	assert.Contains(t, cm.RestoreCheckpoint(snapshot.ID), "successfully restored")
+	content, err := os.ReadFile("main.go")
+	require.NoError(t, err)
+	assert.Equal(t, "package main // edited\n", string(content))
+	assert.FileExists(t, "notes.txt")
+	assert.NoFileExists(t, "new.txt")
+	assert.FileExists(t, filepath.Join(".nca", "checkpoints.json"))
+
+	assert.Contains(t, cm.RestoreCheckpoint(cm.Checkpoints[0].ID), "successfully restored")
+	content, err = os.ReadFile("main.go")
+	require.NoError(t, err)
+	assert.Equal(t, "package main\n", string(content))
+	assert.NoFileExists(t, "notes.txt")
+}
+
+func TestCheckpointSnapshotWithoutGitRepository(t *testing.T) {
+	t.Chdir(t.TempDir())
+	ResetWorkingDir()
+	require.NoError(t, os.MkdirAll("docs", 0755))
+	require.NoError(t, os.WriteFile(filepath.Join("docs", "guide.md"), []byte("guide\n"), 0644))
+	require.NoError(t, os.WriteFile(".gitignore", []byte("*.log\n"), 0644))
+
+	cm := NewCheckpointManager()
+	cm.CreateCheckpoint("rewrite the docs")
+	require.NotEmpty(t, cm.CurrentCheckpoint.GitSnapshot)
+
+	// Changes of commands aren't recorded as file operations
+	require.NoError(t, os.RemoveAll("docs"))
+	require.NoError(t, os.MkdirAll("site", 0755))
+	require.NoError(t, os.WriteFile(filepath.Join("site", "index.html"), []byte("<html>\n"), 0644))
+	require.NoError(t, os.WriteFile("build.log", []byte("ignored\n"), 0644))
+
+	assert.Contains(t, cm.RestoreCheckpoint(cm.Checkpoints[0].ID), "successfully restored")
+	content, err := os.ReadFile(filepath.Join("docs", "guide.md"))
+	require.NoError(t, err)
+	assert.Equal(t, "guide\n", string(content))
+	assert.NoDirExists(t, "site")
+	assert.FileExists(t, "build.log", "ignored files are kept")
+}
+
+func TestCreateSnapshotWithoutGitSnapshots(t *testing.T) {
+	t.Chdir(t.TempDir())
+	ResetWorkingDir()
+	require.NoError(t, config.Set("checkpoint_snapshots", "false", false))
+
+	cm := NewCheckpointManager()
+	cm.CreateCheckpoint("rewrite the docs")
+	snapshot, err := cm.CreateSnapshot("editing 3 files")
+	require.NoError(t, err)
+	require.NotNil(t, snapshot)
+	assert.Empty(t, snapshot.GitSnapshot)
+	assert.NotEqual(t, cm.Checkpoints[0].ID, snapshot.ID)
+	assert.Contains(t, cm.ListCheckpoints(), "[snapshot before editing 3 files]")
+	assert.NoDirExists(t, filepath.Join(".nca", "shadow-git"))
+
+	// Edits after the snapshot are undone when it's restored
+	require.NoError(t, os.WriteFile("README.md", []byte("new\n"), 0644))
+	cm.RecordFileOperation("write", "README.md", "new\n", "")
+	assert.Contains(t, cm.RestoreCheckpoint(snapshot.ID), "successfully restored")
+	assert.NoFileExists(t, "README.md")
+}
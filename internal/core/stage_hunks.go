@@ -0,0 +1,165 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// parseHunkSelection returns the indexes of the hunks selected for git_stage_hunks, numbers and
+// ranges like "1,3-4" or "all", out of total hunks
+func parseHunkSelection(selection string, total int) ([]int, error) {
+	if strings.TrimSpace(selection) == "all" {
+		indexes := make([]int, total)
+		for i := range indexes {
+			indexes[i] = i
+		}
+		return indexes, nil
+	}
+
+	selected := map[int]bool{}
+	for _, part := range strings.Split(selection, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		startText, endText, isRange := strings.Cut(part, "-")
+		start, err := strconv.Atoi(strings.TrimSpace(startText))
+		end := start
+		if err == nil && isRange {
+			end, err = strconv.Atoi(strings.TrimSpace(endText))
+		}
+		if err != nil || start < 1 || end < start {
+			return nil, fmt.Errorf("invalid hunks %q, expected numbers and ranges like 1,3-4", part)
+		}
+		if end > total {
+			return nil, fmt.Errorf("there is no hunk %d, the file has %d unstaged hunks", end, total)
+		}
+		for number := start; number <= end; number++ {
+			selected[number-1] = true
+		}
+	}
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("no hunks selected")
+	}
+
+	indexes := make([]int, 0, len(selected))
+	for index := range selected {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+	return indexes, nil
+}
+
+// unstagedHunks returns the header of the unstaged diff of a file and its hunks. Binary files
+// and mode changes have a header but no hunks.
+func unstagedHunks(dir string, path string) (string, []string, error) {
+	// Explicit prefixes so diff.noprefix and similar settings don't break git apply
+	diff, err := runGit(dir, "diff", "--no-color", "--no-ext-diff", "--src-prefix=a/", "--dst-prefix=b/", "--", path)
+	if err != nil {
+		return "", nil, err
+	}
+	var header strings.Builder
+	var hunks []string
+	for _, line := range strings.SplitAfter(diff, "\n") {
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "@@ "):
+			hunks = append(hunks, line)
+		case len(hunks) > 0:
+			hunks[len(hunks)-1] += line
+		default:
+			header.WriteString(line)
+		}
+	}
+	return header.String(), hunks, nil
+}
+
+// StageHunks handles the git_stage_hunks tool. Without hunks it lists the numbered unstaged hunks
+// of a file, with hunks it stages only those, so unrelated changes of the file stay out of the
+// next commit.
+func StageHunks(params map[string]interface{}) string {
+	path, _ := params["path"].(string)
+	path = strings.TrimSpace(path)
+	if path == "" {
+		return "Error: Missing path parameter"
+	}
+	selection, _ := params["hunks"].(string)
+	selection = strings.TrimSpace(selection)
+
+	dir := GetWorkingDir()
+	if result := checkGitRepository(dir); result != "" {
+		return result
+	}
+	absPath := path
+	if !filepath.IsAbs(absPath) {
+		absPath = filepath.Join(dir, path)
+	}
+
+	// New files have no hunks yet, they can only be staged whole
+	if _, err := runGit(dir, "ls-files", "--error-unmatch", "--", path); err != nil {
+		if _, err := os.Stat(absPath); err != nil {
+			return fmt.Sprintf("Error: File not found: %s", path)
+		}
+		if selection != "all" {
+			return fmt.Sprintf("%s is a new file that isn't tracked by git yet, it can only be staged whole with all as hunks", path)
+		}
+		if _, err := runGit(dir, "add", "--", path); err != nil {
+			return fmt.Sprintf("Error staging %s: %s", path, err)
+		}
+		return fmt.Sprintf("Staged the new file %s", path)
+	}
+
+	header, hunks, err := unstagedHunks(dir, path)
+	if err != nil {
+		return fmt.Sprintf("Error getting diff of %s: %s", path, err)
+	}
+	if strings.TrimSpace(header) == "" {
+		return fmt.Sprintf("No unstaged changes in %s", path)
+	}
+	if len(hunks) == 0 {
+		// Binary files, deletions of empty files and mode changes
+		if selection != "all" {
+			return fmt.Sprintf("The changes of %s have no hunks, e.g. a binary file or a mode change, they can only be staged whole with all as hunks", path)
+		}
+		if _, err := runGit(dir, "add", "--", path); err != nil {
+			return fmt.Sprintf("Error staging %s: %s", path, err)
+		}
+		return fmt.Sprintf("Staged all changes of %s", path)
+	}
+
+	if selection == "" {
+		var result strings.Builder
+		fmt.Fprintf(&result, "Unstaged hunks of %s (%d):\n", path, len(hunks))
+		for i, hunk := range hunks {
+			fmt.Fprintf(&result, "\nHunk %d:\n%s", i+1, hunk)
+		}
+		return strings.TrimRight(result.String(), "\n")
+	}
+
+	indexes, err := parseHunkSelection(selection, len(hunks))
+	if err != nil {
+		return fmt.Sprintf("Error: %s", err)
+	}
+	// The old line numbers of each hunk refer to the index, so any subset applies to it
+	patch := header
+	numbers := make([]string, 0, len(indexes))
+	for _, index := range indexes {
+		patch += hunks[index]
+		numbers = append(numbers, strconv.Itoa(index+1))
+	}
+	if _, err := runGitInput(dir, patch, "apply", "--cached", "--whitespace=nowarn", "-"); err != nil {
+		return fmt.Sprintf("Error staging hunks of %s: %s", path, err)
+	}
+
+	result := fmt.Sprintf("Staged hunks %s of %s", strings.Join(numbers, ", "), path)
+	if _, remaining, err := unstagedHunks(dir, path); err == nil && len(remaining) > 0 {
+		result += fmt.Sprintf(". Unstaged hunks left: %d, they are numbered from 1 again, call git_stage_hunks without hunks to list them.", len(remaining))
+	} else {
+		result += ", no unstaged changes are left in the file."
+	}
+	return result
+}
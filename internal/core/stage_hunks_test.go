@@ -0,0 +1,79 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStageHunks(t *testing.T) {
+	lines := make([]string, 30)
+	for i := range lines {
+		lines[i] = "line"
+	}
+	original := strings.Join(lines, "\n") + "\n"
+	dir := initGitRepo(t, map[string]string{"main.txt": original})
+	t.Chdir(dir)
+
+	// Three changes far enough apart to be separate hunks
+	changed := append([]string{}, lines...)
+	changed[0] = "first"
+	changed[15] = "middle"
+	changed = append(changed, "last")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "main.txt"), []byte(strings.Join(changed, "\n")+"\n"), 0644))
+
+	result := StageHunks(map[string]interface{}{"path": "main.txt"})
+	assert.Contains(t, result, "Unstaged hunks of main.txt (3):")
+	assert.Contains(t, result, "Hunk 1:\n@@ -1,")
+	assert.Contains(t, result, "+middle")
+	assert.Contains(t, result, "Hunk 3:")
+
+	result = StageHunks(map[string]interface{}{"path": "main.txt", "hunks": "1,3"})
+	assert.Equal(t, "Staged hunks 1, 3 of main.txt. Unstaged hunks left: 1, they are numbered from 1 again, call git_stage_hunks without hunks to list them.", result)
+
+	staged, err := runGit(dir, "diff", "--cached")
+	require.NoError(t, err)
+	assert.Contains(t, staged, "+first")
+	assert.Contains(t, staged, "+last")
+	assert.NotContains(t, staged, "+middle")
+
+	result = StageHunks(map[string]interface{}{"path": "main.txt", "hunks": "1"})
+	assert.Equal(t, "Staged hunks 1 of main.txt, no unstaged changes are left in the file.", result)
+	assert.Equal(t, "No unstaged changes in main.txt", StageHunks(map[string]interface{}{"path": "main.txt"}))
+}
+
+func TestStageHunksNewFile(t *testing.T) {
+	dir := initGitRepo(t, map[string]string{"main.txt": "a\n"})
+	t.Chdir(dir)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "new.txt"), []byte("new\n"), 0644))
+
+	assert.Contains(t, StageHunks(map[string]interface{}{"path": "new.txt"}), "can only be staged whole")
+	assert.Equal(t, "Staged the new file new.txt", StageHunks(map[string]interface{}{"path": "new.txt", "hunks": "all"}))
+	staged, err := runGit(dir, "diff", "--cached", "--name-only")
+	require.NoError(t, err)
+	assert.Equal(t, "new.txt\n", staged)
+
+	assert.Equal(t, "Error: File not found: missing.txt", StageHunks(map[string]interface{}{"path": "missing.txt"}))
+	assert.Equal(t, "Error: Missing path parameter", StageHunks(map[string]interface{}{}))
+}
+
+func TestParseHunkSelection(t *testing.T) {
+	indexes, err := parseHunkSelection("3, 1-2,2", 4)
+	require.NoError(t, err)
+	assert.Equal(t, []int{0, 1, 2}, indexes)
+
+	indexes, err = parseHunkSelection("all", 2)
+	require.NoError(t, err)
+	assert.Equal(t, []int{0, 1}, indexes)
+
+	_, err = parseHunkSelection("5", 4)
+	assert.EqualError(t, err, "there is no hunk 5, the file has 4 unstaged hunks")
+	_, err = parseHunkSelection("2-1", 4)
+	assert.Error(t, err)
+	_, err = parseHunkSelection("x", 4)
+	assert.Error(t, err)
+}
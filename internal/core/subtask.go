@@ -0,0 +1,75 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Tools a subtask can't use: it can't start further subtasks or hand off its conversation, has
+// nobody to ask questions and doesn't change the checklist of the parent task
+var subtaskBlockedTools = map[string]bool{
+	"spawn_subtask":         true,
+	"new_task":              true,
+	"ask_followup_question": true,
+	"create_plan":           true,
+	"update_plan_step":      true,
+}
+
+// Subtask is a part of a task delegated with spawn_subtask to an agent with its own conversation
+type Subtask struct {
+	Goal       string
+	Context    string
+	CheapModel bool
+}
+
+// ParseSubtask reads the parameters of the spawn_subtask tool, the error result is "" if they're valid
+func ParseSubtask(params map[string]interface{}) (Subtask, string) {
+	goal, _ := params["goal"].(string)
+	if strings.TrimSpace(goal) == "" {
+		return Subtask{}, "Error: No goal provided for spawn_subtask tool"
+	}
+	context, _ := params["context"].(string)
+	cheapModel, _ := params["cheap_model"].(bool)
+	return Subtask{
+		Goal:       strings.TrimSpace(goal),
+		Context:    strings.TrimSpace(context),
+		CheapModel: cheapModel,
+	}, ""
+}
+
+// CheckSubtaskTool returns an error result if a subtask may not use a tool, or "" if it may
+func CheckSubtaskTool(toolName string) string {
+	if subtaskBlockedTools[toolName] {
+		return fmt.Sprintf("Error: The %s tool can't be used in a subtask. Work on the goal with the other tools and report anything the parent task must decide in your attempt_completion summary.", toolName)
+	}
+	return ""
+}
+
+// FormatSubtaskPrompt returns the first user message of a subtask, which only sees its goal and
+// context, not the conversation of the parent task
+func FormatSubtaskPrompt(subtask Subtask) string {
+	var prompt strings.Builder
+	prompt.WriteString("You are working on a subtask delegated by an agent that is working on a larger task. ")
+	prompt.WriteString("Only work on the goal below, the other agent continues the larger task with your result.\n\n")
+	prompt.WriteString("<goal>\n" + subtask.Goal + "\n</goal>\n\n")
+	if subtask.Context != "" {
+		prompt.WriteString("<context>\n" + subtask.Context + "\n</context>\n\n")
+	}
+	prompt.WriteString("When the goal is achieved, or if it can't be, use attempt_completion with a concise summary for the other agent: ")
+	prompt.WriteString("what you did, which files you changed, and the findings or problems it needs to know about. ")
+	prompt.WriteString("You can't ask the user questions, start other subtasks or change the task checklist.")
+	return prompt.String()
+}
+
+// FormatSubtaskResult returns the result of spawn_subtask from the summary of the subtask, the
+// number of requests it made and the files it changed
+func FormatSubtaskResult(summary string, requests int, files []string) string {
+	if strings.TrimSpace(summary) == "" {
+		summary = "(the subtask gave no summary)"
+	}
+	result := fmt.Sprintf("The subtask finished after %d requests.\n\nSummary:\n%s", requests, strings.TrimSpace(summary))
+	if len(files) > 0 {
+		result += "\n\nFiles changed by the subtask: " + strings.Join(files, ", ")
+	}
+	return result
+}
@@ -0,0 +1,45 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSubtask(t *testing.T) {
+	subtask, errResult := ParseSubtask(map[string]interface{}{
+		"goal":        " Write tests for pkg/utils ",
+		"context":     "Use testify",
+		"cheap_model": true,
+	})
+	assert.Empty(t, errResult)
+	assert.Equal(t, Subtask{Goal: "Write tests for pkg/utils", Context: "Use testify", CheapModel: true}, subtask)
+
+	_, errResult = ParseSubtask(map[string]interface{}{"goal": " "})
+	assert.Contains(t, errResult, "No goal provided")
+}
+
+func TestCheckSubtaskTool(t *testing.T) {
+	assert.Empty(t, CheckSubtaskTool("read_file"))
+	assert.Empty(t, CheckSubtaskTool("write_to_file"))
+	assert.Contains(t, CheckSubtaskTool("spawn_subtask"), "can't be used in a subtask")
+	assert.Contains(t, CheckSubtaskTool("ask_followup_question"), "can't be used in a subtask")
+	assert.Contains(t, CheckSubtaskTool("update_plan_step"), "can't be used in a subtask")
+}
+
+func TestFormatSubtaskPrompt(t *testing.T) {
+	prompt := FormatSubtaskPrompt(Subtask{Goal: "Write tests", Context: "Use testify"})
+	assert.Contains(t, prompt, "<goal>\nWrite tests\n</goal>")
+	assert.Contains(t, prompt, "<context>\nUse testify\n</context>")
+	assert.Contains(t, prompt, "attempt_completion")
+
+	assert.NotContains(t, FormatSubtaskPrompt(Subtask{Goal: "Write tests"}), "<context>")
+}
+
+func TestFormatSubtaskResult(t *testing.T) {
+	result := FormatSubtaskResult("Added 4 tests\n", 3, []string{"pkg/utils/strings_test.go"})
+	assert.Equal(t, "The subtask finished after 3 requests.\n\nSummary:\nAdded 4 tests\n\nFiles changed by the subtask: pkg/utils/strings_test.go", result)
+
+	assert.Contains(t, FormatSubtaskResult("", 1, nil), "(the subtask gave no summary)")
+	assert.NotContains(t, FormatSubtaskResult("Nothing to do", 1, nil), "Files changed")
+}
@@ -0,0 +1,261 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// templateConfigFile describes a user template, it isn't copied to the new project
+const templateConfigFile = "template.json"
+
+// Template scaffolds a new project, see the built-in templates in builtin_templates.go
+type Template struct {
+	Name        string
+	Description string
+	// Prompt is the task given to the agent after the files are created, it completes the
+	// parts the template leaves open
+	Prompt string
+	// Files are the contents of the files by path relative to the project directory. Paths and
+	// contents can use {{variable}} placeholders.
+	Files map[string]string
+	// Source is "built-in" or the directory of a user template
+	Source string
+}
+
+// templateConfig is the template.json of a user template
+type templateConfig struct {
+	Description string `json:"description"`
+	Prompt      string `json:"prompt"`
+}
+
+// Characters that can't be part of the package variable
+var nonIdentifierChars = regexp.MustCompile(`[^a-z0-9_]+`)
+
+// Placeholders of template variables
+var templateVariableRegex = regexp.MustCompile(`\{\{([A-Za-z_][A-Za-z0-9_]*)\}\}`)
+
+// getTemplateDirs returns the directories of user templates, project templates come first so
+// they take precedence over the global ones in ~/.nca/templates
+func getTemplateDirs() []string {
+	var dirs []string
+	// Project templates of untrusted workspaces could give the agent any task
+	if IsWorkspaceTrusted() {
+		dirs = append(dirs, filepath.Join(".nca", "templates"))
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		dirs = append(dirs, filepath.Join(home, ".nca", "templates"))
+	}
+	return dirs
+}
+
+// ListTemplates returns the user and built-in templates sorted by name. A user template
+// with the name of a built-in one replaces it.
+func ListTemplates() []*Template {
+	byName := make(map[string]*Template)
+	for name, template := range builtinTemplates {
+		byName[name] = template
+	}
+	dirs := getTemplateDirs()
+	for i := len(dirs) - 1; i >= 0; i-- {
+		entries, err := os.ReadDir(dirs[i])
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				continue
+			}
+			if template, err := loadUserTemplate(filepath.Join(dirs[i], entry.Name())); err == nil {
+				byName[template.Name] = template
+			}
+		}
+	}
+
+	templates := make([]*Template, 0, len(byName))
+	for _, template := range byName {
+		templates = append(templates, template)
+	}
+	sort.Slice(templates, func(i, j int) bool {
+		return templates[i].Name < templates[j].Name
+	})
+	return templates
+}
+
+// LoadTemplate returns the template with a name, user templates take precedence over built-in ones
+func LoadTemplate(name string) (*Template, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) || name == "." || name == ".." {
+		return nil, fmt.Errorf("invalid template name: %s", name)
+	}
+	for _, dir := range getTemplateDirs() {
+		path := filepath.Join(dir, name)
+		if info, err := os.Stat(path); err == nil && info.IsDir() {
+			return loadUserTemplate(path)
+		}
+	}
+	if template, ok := builtinTemplates[name]; ok {
+		return template, nil
+	}
+	return nil, fmt.Errorf("template '%s' not found", name)
+}
+
+// loadUserTemplate reads a template directory, all files except template.json belong to the template
+func loadUserTemplate(dir string) (*Template, error) {
+	template := &Template{
+		Name:   filepath.Base(dir),
+		Files:  make(map[string]string),
+		Source: dir,
+	}
+
+	if data, err := os.ReadFile(filepath.Join(dir, templateConfigFile)); err == nil {
+		var config templateConfig
+		if err := json.Unmarshal(data, &config); err != nil {
+			return nil, fmt.Errorf("invalid %s of template %s: %w", templateConfigFile, template.Name, err)
+		}
+		template.Description = config.Description
+		template.Prompt = config.Prompt
+	}
+
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		relPath, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if relPath == templateConfigFile {
+			return nil
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		template.Files[filepath.ToSlash(relPath)] = string(content)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return template, nil
+}
+
+// TemplateVariables returns the variables of a new project: name, package (the name as an
+// identifier), year and author (the git user). vars are added and override them.
+func TemplateVariables(projectName string, vars map[string]string) map[string]string {
+	variables := map[string]string{
+		"name":    projectName,
+		"package": strings.Trim(nonIdentifierChars.ReplaceAllString(strings.ToLower(projectName), "_"), "_"),
+		"year":    fmt.Sprintf("%d", time.Now().Year()),
+		"author":  "",
+	}
+	if output, err := exec.Command("git", "config", "user.name").Output(); err == nil {
+		variables["author"] = strings.TrimSpace(string(output))
+	}
+	for key, value := range vars {
+		variables[key] = value
+	}
+	return variables
+}
+
+// substituteVariables replaces the {{variable}} placeholders, unknown ones are kept
+func substituteVariables(text string, variables map[string]string) string {
+	return templateVariableRegex.ReplaceAllStringFunc(text, func(placeholder string) string {
+		if value, ok := variables[placeholder[2:len(placeholder)-2]]; ok {
+			return value
+		}
+		return placeholder
+	})
+}
+
+// Render creates the files of the template in dir and returns their paths sorted. dir must not
+// exist or be empty, on failure the files created so far are removed again.
+func (t *Template) Render(dir string, variables map[string]string) ([]string, error) {
+	if entries, err := os.ReadDir(dir); err == nil && len(entries) > 0 {
+		return nil, fmt.Errorf("directory %s already exists and is not empty", dir)
+	}
+	_, statErr := os.Stat(dir)
+	createdDir := os.IsNotExist(statErr)
+
+	var paths []string
+	for path := range t.Files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var created []string
+	for _, path := range paths {
+		content := t.Files[path]
+		// Binary files like images are copied as they are
+		if utf8.ValidString(content) && !strings.ContainsRune(content, 0) {
+			content = substituteVariables(content, variables)
+		}
+
+		target := filepath.Join(dir, filepath.FromSlash(substituteVariables(path, variables)))
+		if !isPathInside(target, dir) {
+			return nil, t.removeRendered(dir, createdDir, created, fmt.Errorf("template file %s is outside the project directory", path))
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return nil, t.removeRendered(dir, createdDir, created, err)
+		}
+		if err := os.WriteFile(target, []byte(content), 0644); err != nil {
+			return nil, t.removeRendered(dir, createdDir, created, err)
+		}
+		created = append(created, target)
+	}
+	sort.Strings(created)
+	return created, nil
+}
+
+// removeRendered removes what Render created before it failed and returns err
+func (t *Template) removeRendered(dir string, createdDir bool, created []string, err error) error {
+	if createdDir {
+		os.RemoveAll(dir)
+		return err
+	}
+	for _, path := range created {
+		os.Remove(path)
+	}
+	return err
+}
+
+// isPathInside returns whether path is dir or inside it
+func isPathInside(path string, dir string) bool {
+	relPath, err := filepath.Rel(dir, path)
+	return err == nil && relPath != ".." && !strings.HasPrefix(relPath, ".."+string(filepath.Separator))
+}
+
+// TemplateTask returns the task that lets the agent complete a project created from the template.
+// It's empty if neither the template nor the user describe anything to do.
+func (t *Template) TemplateTask(dir string, files []string, variables map[string]string, description string) string {
+	prompt := strings.TrimSpace(substituteVariables(t.Prompt, variables))
+	description = strings.TrimSpace(description)
+	if prompt == "" && description == "" {
+		return ""
+	}
+
+	var task strings.Builder
+	task.WriteString(fmt.Sprintf("The project %s was created in the directory %s from the %s template with these files:\n", variables["name"], toPosix(dir), t.Name))
+	for _, file := range files {
+		task.WriteString("- " + toPosix(file) + "\n")
+	}
+	task.WriteString("\nComplete the project. Keep the structure of the template, fill in the parts it leaves open (marked with TODO) and don't recreate the files that already exist.\n")
+	if prompt != "" {
+		task.WriteString("\nTemplate instructions:\n" + prompt + "\n")
+	}
+	if description != "" {
+		task.WriteString("\nWhat the project should do:\n" + description + "\n")
+	}
+	return task.String()
+}
@@ -0,0 +1,107 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// inTempWorkspace runs a test in an empty workspace with an empty home directory
+func inTempWorkspace(t *testing.T) string {
+	originalDir, err := os.Getwd()
+	require.NoError(t, err)
+	t.Cleanup(func() { os.Chdir(originalDir) })
+	require.NoError(t, os.Chdir(t.TempDir()))
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	return home
+}
+
+func TestRenderBuiltinTemplate(t *testing.T) {
+	inTempWorkspace(t)
+
+	template, err := LoadTemplate("python-package")
+	require.NoError(t, err)
+	variables := TemplateVariables("My Tool", map[string]string{"author": "Jane"})
+	assert.Equal(t, "my_tool", variables["package"])
+
+	files, err := template.Render("mytool", variables)
+	require.NoError(t, err)
+	assert.Contains(t, files, filepath.Join("mytool", "src", "my_tool", "main.py"))
+
+	content, err := os.ReadFile(filepath.Join("mytool", "pyproject.toml"))
+	require.NoError(t, err)
+	assert.Contains(t, string(content), `name = "My Tool"`)
+	assert.Contains(t, string(content), `authors = [{ name = "Jane" }]`)
+
+	// A project isn't created over existing files
+	_, err = template.Render("mytool", variables)
+	assert.Error(t, err)
+}
+
+func TestUserTemplate(t *testing.T) {
+	home := inTempWorkspace(t)
+	trustWorkspace(t)
+
+	dir := filepath.Join(".nca", "templates", "go-cli")
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "cmd", "{{name}}"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "template.json"), []byte(`{"description": "Our Go service", "prompt": "Add a /health endpoint to {{name}}"}`), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "cmd", "{{name}}", "main.go"), []byte("package main // {{name}} {{unknown}}\n"), 0644))
+	globalDir := filepath.Join(home, ".nca", "templates", "docs")
+	require.NoError(t, os.MkdirAll(globalDir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(globalDir, "index.md"), []byte("# {{name}}\n"), 0644))
+
+	// Project templates replace built-in ones of the same name
+	template, err := LoadTemplate("go-cli")
+	require.NoError(t, err)
+	assert.Equal(t, "Our Go service", template.Description)
+	assert.Equal(t, dir, template.Source)
+
+	names := []string{}
+	for _, template := range ListTemplates() {
+		names = append(names, template.Name)
+	}
+	assert.Equal(t, []string{"docs", "go-cli", "python-package", "web"}, names)
+
+	variables := TemplateVariables("api", nil)
+	files, err := template.Render("api", variables)
+	require.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join("api", "cmd", "api", "main.go")}, files)
+	content, err := os.ReadFile(files[0])
+	require.NoError(t, err)
+	assert.Equal(t, "package main // api {{unknown}}\n", string(content))
+
+	task := template.TemplateTask("api", files, variables, "")
+	assert.Contains(t, task, "Add a /health endpoint to api")
+	assert.Contains(t, task, "- api/cmd/api/main.go")
+}
+
+func TestTemplateTask(t *testing.T) {
+	template := &Template{Name: "empty", Files: map[string]string{}}
+	variables := map[string]string{"name": "demo"}
+
+	// Without instructions there is nothing for the agent to do
+	assert.Empty(t, template.TemplateTask("demo", nil, variables, ""))
+
+	task := template.TemplateTask("demo", nil, variables, "A todo list app")
+	assert.Contains(t, task, "What the project should do:\nA todo list app")
+}
+
+func TestTemplateInvalidPaths(t *testing.T) {
+	inTempWorkspace(t)
+
+	_, err := LoadTemplate("../secret")
+	assert.Error(t, err)
+	_, err = LoadTemplate("missing")
+	assert.Error(t, err)
+
+	// Files can't be written outside the project directory
+	template := &Template{Name: "bad", Files: map[string]string{"ok.txt": "ok", "{{name}}/../../escape.txt": "bad"}}
+	_, err = template.Render("project", map[string]string{"name": ".."})
+	assert.Error(t, err)
+	assert.NoFileExists(t, "escape.txt")
+	assert.NoDirExists(t, "project")
+}
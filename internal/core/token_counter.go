@@ -0,0 +1,199 @@
+package core
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pederhe/nca/pkg/config"
+	"github.com/pederhe/nca/pkg/log"
+)
+
+// Pre-tokenization pattern of the tiktoken cl100k and o200k encodings. Go's regexp has no
+// lookahead, so runs of spaces before a word are split off in splitTokenPieces instead.
+var tokenPieceRegex = regexp.MustCompile(`(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+`)
+
+const (
+	// tokensPerMessage is the overhead of the role and separators of each chat message
+	tokensPerMessage = 4
+	// maxCachedTokenPieces limits the memory used for counts of repeated pieces
+	maxCachedTokenPieces = 100000
+)
+
+// TokenCounter counts the tokens of text. With the BPE ranks of a tiktoken encoding
+// (a .tiktoken file, set with the "tokenizer_file" config key) the counts match the
+// tokenizer of the model, otherwise they are estimated from the same pre-tokenization.
+type TokenCounter struct {
+	ranks map[string]int
+	cache map[string]int
+	mutex sync.Mutex
+}
+
+// Token counters by ranks file, loading a file takes a while
+var (
+	tokenCounters      = map[string]*TokenCounter{}
+	tokenCountersMutex sync.Mutex
+)
+
+// NewTokenCounter creates a token counter from a tiktoken ranks file, each line holds a
+// base64 encoded token and its rank. An empty path creates an estimating counter.
+func NewTokenCounter(ranksFile string) (*TokenCounter, error) {
+	counter := &TokenCounter{cache: map[string]int{}}
+	if ranksFile == "" {
+		return counter, nil
+	}
+
+	file, err := os.Open(ranksFile)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	counter.ranks = map[string]int{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		token, err := base64.StdEncoding.DecodeString(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid token in %s: %s", ranksFile, fields[0])
+		}
+		rank, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid rank in %s: %s", ranksFile, fields[1])
+		}
+		counter.ranks[string(token)] = rank
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(counter.ranks) == 0 {
+		return nil, fmt.Errorf("no tokens found in %s", ranksFile)
+	}
+	return counter, nil
+}
+
+// GetTokenCounter returns the token counter of the configured tokenizer. A ranks file
+// can be set per model with "tokenizer_file.<model>", or for all models with "tokenizer_file".
+func GetTokenCounter(modelName string) *TokenCounter {
+	ranksFile := config.Get("tokenizer_file." + modelName)
+	if ranksFile == "" {
+		ranksFile = config.Get("tokenizer_file")
+	}
+
+	tokenCountersMutex.Lock()
+	defer tokenCountersMutex.Unlock()
+
+	if counter, ok := tokenCounters[ranksFile]; ok {
+		return counter
+	}
+	counter, err := NewTokenCounter(ranksFile)
+	if err != nil {
+		log.LogDebug("Failed to load tokenizer file " + ranksFile + ": " + err.Error() + "\n")
+		counter, _ = NewTokenCounter("")
+	}
+	tokenCounters[ranksFile] = counter
+	return counter
+}
+
+// IsExact returns whether the counter uses the BPE ranks of a tokenizer
+func (c *TokenCounter) IsExact() bool {
+	return c.ranks != nil
+}
+
+// Count returns the number of tokens of text
+func (c *TokenCounter) Count(text string) int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	total := 0
+	for _, piece := range splitTokenPieces(text) {
+		if count, ok := c.cache[piece]; ok {
+			total += count
+			continue
+		}
+		var count int
+		if c.ranks != nil {
+			count = c.countBPE(piece)
+		} else {
+			count = estimatePieceTokens(piece)
+		}
+		if len(c.cache) < maxCachedTokenPieces {
+			c.cache[piece] = count
+		}
+		total += count
+	}
+	return total
+}
+
+// CountMessages returns the number of tokens of the conversation messages
+func (c *TokenCounter) CountMessages(conversation []map[string]string) int {
+	total := 0
+	for _, message := range conversation {
+		total += tokensPerMessage + c.Count(message["content"]) + c.Count(message["tool_calls"])
+	}
+	return total
+}
+
+// countBPE returns the number of tokens of a piece by merging its bytes in rank order
+func (c *TokenCounter) countBPE(piece string) int {
+	if _, ok := c.ranks[piece]; ok {
+		return 1
+	}
+
+	parts := make([]string, len(piece))
+	for i := 0; i < len(piece); i++ {
+		parts[i] = piece[i : i+1]
+	}
+	for len(parts) > 1 {
+		best, bestRank := -1, 0
+		for i := 0; i < len(parts)-1; i++ {
+			if rank, ok := c.ranks[parts[i]+parts[i+1]]; ok && (best < 0 || rank < bestRank) {
+				best, bestRank = i, rank
+			}
+		}
+		if best < 0 {
+			break
+		}
+		parts[best] += parts[best+1]
+		parts = append(parts[:best+1], parts[best+2:]...)
+	}
+	return len(parts)
+}
+
+// estimatePieceTokens estimates the tokens of a piece without the tokenizer: common words
+// with their leading space are one token, longer pieces about one token per four bytes
+func estimatePieceTokens(piece string) int {
+	if len(piece) <= 6 {
+		return 1
+	}
+	return (len(piece) + charsPerToken - 1) / charsPerToken
+}
+
+// splitTokenPieces splits text like the tiktoken pre-tokenizer. A run of spaces before
+// a word or punctuation leaves its last space to the word, as the tokenizer does.
+func splitTokenPieces(text string) []string {
+	pieces := tokenPieceRegex.FindAllString(text, -1)
+	for i := 0; i < len(pieces)-1; i++ {
+		piece := pieces[i]
+		if len(piece) < 2 || strings.Trim(piece, " ") != "" {
+			continue
+		}
+		next, _ := utf8.DecodeRuneInString(pieces[i+1])
+		if unicode.IsSpace(next) || unicode.IsNumber(next) {
+			continue
+		}
+		pieces[i] = piece[:len(piece)-1]
+		pieces[i+1] = " " + pieces[i+1]
+	}
+	return pieces
+}
@@ -0,0 +1,81 @@
+package core
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pederhe/nca/pkg/api/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitTokenPieces(t *testing.T) {
+	assert.Equal(t, []string{"Hello", ",", " world", "!"}, splitTokenPieces("Hello, world!"))
+	assert.Equal(t, []string{"func", " main", "()", " {\n", "\treturn", " ", "123", "4", "\n", "}"},
+		splitTokenPieces("func main() {\n\treturn 1234\n}"))
+	// The last space of a run belongs to the following word
+	assert.Equal(t, []string{"a", "  ", " b", "'s"}, splitTokenPieces("a   b's"))
+	assert.Equal(t, "a   b's", strings.Join(splitTokenPieces("a   b's"), ""))
+}
+
+func TestTokenCounterBPE(t *testing.T) {
+	var ranks strings.Builder
+	for rank, token := range []string{"a", "b", "c", " ", "ab", "abc", " ab"} {
+		ranks.WriteString(fmt.Sprintf("%s %d\n", base64.StdEncoding.EncodeToString([]byte(token)), rank))
+	}
+	ranksFile := filepath.Join(t.TempDir(), "test.tiktoken")
+	assert.NoError(t, os.WriteFile(ranksFile, []byte(ranks.String()), 0644))
+
+	counter, err := NewTokenCounter(ranksFile)
+	assert.NoError(t, err)
+	assert.True(t, counter.IsExact())
+
+	assert.Equal(t, 1, counter.Count("abc"))
+	assert.Equal(t, 2, counter.Count("abcab"))   // "abc" + "ab"
+	assert.Equal(t, 3, counter.Count("abc abc")) // "abc" + " " "abc", "abc" has a lower rank than " ab"
+	assert.Equal(t, 3, counter.Count("cba"))     // no merges
+
+	_, err = NewTokenCounter(filepath.Join(t.TempDir(), "missing.tiktoken"))
+	assert.Error(t, err)
+}
+
+func TestTokenCounterEstimate(t *testing.T) {
+	counter, err := NewTokenCounter("")
+	assert.NoError(t, err)
+	assert.False(t, counter.IsExact())
+
+	assert.Equal(t, 0, counter.Count(""))
+	assert.Equal(t, 4, counter.Count("Hello, world!"))
+	assert.Equal(t, 6, counter.Count(" internationalization"))
+
+	conversation := []map[string]string{
+		{"role": "user", "content": "Hello, world!"},
+		{"role": "assistant", "content": ""},
+	}
+	assert.Equal(t, 4+tokensPerMessage*2, counter.CountMessages(conversation))
+}
+
+func TestUpdateContextMessagesCountsTokens(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	defer SetSystemPromptTokens(0)
+
+	modelInfo := &types.ModelInfo{Name: "test-model", ContextWindow: intPtr(128000)}
+	conversation := []map[string]string{
+		{"role": "user", "content": "task"},
+		{"role": "assistant", "content": "reply"},
+		{"role": "user", "content": "result"},
+		{"role": "assistant", "content": "reply"},
+		{"role": "user", "content": "result"},
+		{"role": "assistant", "content": "reply"},
+		{"role": "user", "content": strings.Repeat("large tool result ", 40000)},
+	}
+	currentDeletedRange := [2]int{0, 0}
+
+	// The large tool result is truncated before the next request, without a reported usage
+	SetSystemPromptTokens(10000)
+	assert.True(t, UpdateContextMessages(modelInfo, &conversation, &currentDeletedRange, nil))
+	assert.Less(t, len(conversation), 7)
+}
@@ -0,0 +1,118 @@
+package core
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pederhe/nca/pkg/config"
+)
+
+// Default maximum result size (in tokens) for each tool
+var defaultToolResultTokens = map[string]int{
+	"search_files":    8000,
+	"read_file":       16000,
+	"read_files":      32000,
+	"execute_command": 4000,
+	"get_file_diff":   8000,
+	"git_diff":        8000,
+}
+
+const (
+	// defaultResultTokens is used for tools without a specific default
+	defaultResultTokens = 8000
+	// defaultMaxResultEntries is the default number of entries returned by listing tools
+	defaultMaxResultEntries = 200
+	// charsPerToken is a rough estimate used to convert tokens to characters
+	charsPerToken = 4
+)
+
+// Tools whose results are never limited because they are shown to the user, not the model,
+// or because they already page their own output
+var unlimitedResultTools = map[string]bool{
+	"attempt_completion":    true,
+	"ask_followup_question": true,
+	"ask_mode_response":     true,
+	"get_artifact":          true,
+}
+
+// GetToolResultLimit returns the maximum result size in tokens for a tool.
+// It can be overridden with the config key "tool_result_limit.<tool>", 0 means unlimited.
+func GetToolResultLimit(toolName string) int {
+	if value := config.Get("tool_result_limit." + toolName); value != "" {
+		if limit, err := strconv.Atoi(value); err == nil && limit >= 0 {
+			return limit
+		}
+	}
+
+	if limit, ok := defaultToolResultTokens[toolName]; ok {
+		return limit
+	}
+	return defaultResultTokens
+}
+
+// getMaxResultEntries returns the maximum number of entries returned by listing and search tools
+func getMaxResultEntries() int {
+	if value := config.Get("tool_max_result_entries"); value != "" {
+		if limit, err := strconv.Atoi(value); err == nil && limit > 0 {
+			return limit
+		}
+	}
+	return defaultMaxResultEntries
+}
+
+// EstimateTokens returns a rough token count for the given text
+func EstimateTokens(text string) int {
+	return (len(text) + charsPerToken - 1) / charsPerToken
+}
+
+// LimitToolResult enforces the configured result size limit for a tool.
+// Oversized results are truncated and the full output is saved as an artifact so
+// the model can page through it with get_artifact.
+func LimitToolResult(toolName string, result string) string {
+	if unlimitedResultTools[toolName] {
+		return result
+	}
+
+	limit := GetToolResultLimit(toolName)
+	if limit == 0 || EstimateTokens(result) <= limit {
+		return result
+	}
+
+	kind := "tool_result"
+	if toolName == "execute_command" {
+		kind = "command_log"
+	}
+	return truncateToArtifact(kind, toolName, result, limit)
+}
+
+// truncateToArtifact cuts text down to limit tokens and saves the full text as an artifact
+func truncateToArtifact(kind string, source string, text string, limit int) string {
+	maxChars := limit * charsPerToken
+	truncated := truncateAtLine(text, maxChars)
+	totalLines := strings.Count(text, "\n") + 1
+	shownLines := strings.Count(truncated, "\n") + 1
+
+	var notice string
+	if artifact, err := GetArtifactStore().Save(kind, source, text); err == nil {
+		notice = fmt.Sprintf("\n\n[Output truncated: showing %d of %d lines (limit %d tokens). Full output saved as artifact %s, use get_artifact with a range to view the rest]",
+			shownLines, totalLines, limit, artifact.ID)
+	} else {
+		notice = fmt.Sprintf("\n\n[Output truncated: showing %d of %d lines (limit %d tokens)]", shownLines, totalLines, limit)
+	}
+
+	return truncated + notice
+}
+
+// truncateAtLine cuts text to at most maxChars, preferring to end on a line boundary
+func truncateAtLine(text string, maxChars int) string {
+	if len(text) <= maxChars {
+		return text
+	}
+
+	cut := text[:maxChars]
+	if idx := strings.LastIndex(cut, "\n"); idx > maxChars/2 {
+		cut = cut[:idx]
+	}
+	return strings.ToValidUTF8(cut, "")
+}
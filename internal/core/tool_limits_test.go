@@ -0,0 +1,75 @@
+package core
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/pederhe/nca/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetToolResultLimit(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	tmpDir := t.TempDir()
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(originalDir)
+	os.Chdir(tmpDir)
+
+	// Defaults
+	assert.Equal(t, 16000, GetToolResultLimit("read_file"))
+	assert.Equal(t, 8000, GetToolResultLimit("search_files"))
+	assert.Equal(t, 4000, GetToolResultLimit("execute_command"))
+	assert.Equal(t, defaultResultTokens, GetToolResultLimit("list_files"))
+
+	// Config override
+	assert.NoError(t, config.Set("tool_result_limit.read_file", "100", false))
+	assert.Equal(t, 100, GetToolResultLimit("read_file"))
+
+	// Invalid values fall back to the default
+	assert.NoError(t, config.Set("tool_result_limit.read_file", "abc", false))
+	assert.Equal(t, 16000, GetToolResultLimit("read_file"))
+}
+
+func TestLimitToolResult(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	tmpDir := t.TempDir()
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(originalDir)
+	os.Chdir(tmpDir)
+
+	// Small results are returned unchanged
+	assert.Equal(t, "short output", LimitToolResult("execute_command", "short output"))
+
+	// Large results are truncated and the full output is stored
+	assert.NoError(t, config.Set("tool_result_limit.execute_command", "10", false))
+	var builder strings.Builder
+	for i := 0; i < 100; i++ {
+		builder.WriteString("line of command output\n")
+	}
+	output := builder.String()
+
+	result := LimitToolResult("execute_command", output)
+	assert.Less(t, len(result), len(output))
+	assert.Contains(t, result, "[Output truncated")
+	assert.Contains(t, result, "get_artifact")
+
+	list := GetArtifactStore().List()
+	assert.NotEmpty(t, list)
+	_, saved, err := GetArtifactStore().Get(list[len(list)-1].ID)
+	assert.NoError(t, err)
+	assert.Equal(t, output, saved)
+
+	// A limit of 0 disables truncation
+	assert.NoError(t, config.Set("tool_result_limit.execute_command", "0", false))
+	assert.Equal(t, output, LimitToolResult("execute_command", output))
+
+	// Interactive tools are never limited
+	assert.Equal(t, output, LimitToolResult("attempt_completion", output))
+}
@@ -0,0 +1,122 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/pederhe/nca/pkg/utils"
+)
+
+// Large tool outputs are collapsed in the terminal: results are shown as a one-line summary and
+// commands stream only their first lines. /expand shows the full output of the last tool, and
+// verbose output (--verbose) always shows everything.
+
+// Lines of command output streamed to the terminal before the rest is collapsed
+const collapsedOutputLines = 20
+
+var (
+	verboseOutput      bool
+	lastToolOutput     string
+	lastToolDesc       string
+	lastToolOutputLock sync.Mutex
+)
+
+// SetVerboseOutput sets whether the full output of tools is shown
+func SetVerboseOutput(verbose bool) {
+	verboseOutput = verbose
+}
+
+// IsVerboseOutput returns whether the full output of tools is shown, always when the output is
+// piped since it can't be expanded there
+func IsVerboseOutput() bool {
+	return verboseOutput || utils.IsOutputPiped()
+}
+
+// SetLastToolOutput records the output of the last tool for /expand
+func SetLastToolOutput(description, output string) {
+	lastToolOutputLock.Lock()
+	defer lastToolOutputLock.Unlock()
+	lastToolDesc = description
+	lastToolOutput = output
+}
+
+// LastToolOutput returns the description and the output of the last tool, if a tool has run
+func LastToolOutput() (string, string, bool) {
+	lastToolOutputLock.Lock()
+	defer lastToolOutputLock.Unlock()
+	return lastToolDesc, lastToolOutput, lastToolDesc != ""
+}
+
+// SummarizeToolOutput returns a one-line summary of a tool output: a single short line is shown
+// as it is, longer outputs as their first line with the number of lines and the size
+func SummarizeToolOutput(output string) string {
+	output = strings.TrimRight(output, "\n")
+	lines := strings.Split(output, "\n")
+	first := utils.TruncateToWidth(strings.TrimSpace(lines[0]), 80)
+	if len(lines) == 1 && first == strings.TrimSpace(lines[0]) {
+		return first
+	}
+	size := utils.FormatSize(int64(len(output)))
+	if len(lines) > 1 {
+		size = fmt.Sprintf("%d lines, %s", len(lines), size)
+	}
+	return fmt.Sprintf("%s (%s, /expand to show)", first, size)
+}
+
+// collapsingWriter writes the first lines of an output and counts the lines it leaves out
+type collapsingWriter struct {
+	out      io.Writer
+	maxLines int // 0 writes everything
+	lines    int
+	hidden   int
+	partial  bool // Whether the last hidden line has no newline yet
+}
+
+// newCollapsingWriter creates a writer showing at most maxLines lines of the output, 0 shows all
+func newCollapsingWriter(out io.Writer, maxLines int) *collapsingWriter {
+	return &collapsingWriter{out: out, maxLines: maxLines}
+}
+
+// Write writes the data up to the line limit and counts the lines after it
+func (w *collapsingWriter) Write(p []byte) (int, error) {
+	if w.maxLines <= 0 {
+		return w.out.Write(p)
+	}
+	data := p
+	for len(data) > 0 && w.lines < w.maxLines {
+		end := bytes.IndexByte(data, '\n')
+		if end < 0 {
+			end = len(data) - 1
+		} else {
+			w.lines++
+		}
+		if _, err := w.out.Write(data[:end+1]); err != nil {
+			return 0, err
+		}
+		data = data[end+1:]
+	}
+	if len(data) > 0 {
+		w.hidden += bytes.Count(data, []byte{'\n'})
+		w.partial = data[len(data)-1] != '\n'
+	}
+	return len(p), nil
+}
+
+// HiddenLines returns the number of lines that weren't written
+func (w *collapsingWriter) HiddenLines() int {
+	if w.partial {
+		return w.hidden + 1
+	}
+	return w.hidden
+}
+
+// collapsedCommandLines returns how many lines of command output are streamed, 0 for all
+func collapsedCommandLines() int {
+	if IsVerboseOutput() {
+		return 0
+	}
+	return collapsedOutputLines
+}
@@ -0,0 +1,64 @@
+package core
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCollapsingWriter(t *testing.T) {
+	var out bytes.Buffer
+	writer := newCollapsingWriter(&out, 2)
+	writer.Write([]byte("one\ntw"))
+	writer.Write([]byte("o\nthree\nfour"))
+	assert.Equal(t, "one\ntwo\n", out.String())
+	assert.Equal(t, 2, writer.HiddenLines())
+
+	writer.Write([]byte(" more\n"))
+	assert.Equal(t, 2, writer.HiddenLines())
+
+	// Without a limit everything is written
+	out.Reset()
+	writer = newCollapsingWriter(&out, 0)
+	writer.Write([]byte("a\nb\nc\n"))
+	assert.Equal(t, "a\nb\nc\n", out.String())
+	assert.Equal(t, 0, writer.HiddenLines())
+}
+
+func TestSummarizeToolOutput(t *testing.T) {
+	assert.Equal(t, "File written successfully", SummarizeToolOutput("File written successfully\n"))
+
+	output := "package main\n" + strings.Repeat("x\n", 99)
+	assert.Equal(t, "package main (100 lines, 210B, /expand to show)", SummarizeToolOutput(output))
+
+	long := strings.Repeat("a", 100)
+	summary := SummarizeToolOutput(long)
+	assert.True(t, strings.HasSuffix(summary, "(100B, /expand to show)"), summary)
+}
+
+func TestLastToolOutput(t *testing.T) {
+	defer SetLastToolOutput("", "")
+	SetLastToolOutput("", "")
+	_, _, ok := LastToolOutput()
+	assert.False(t, ok)
+
+	SetLastToolOutput("[read_file for 'main.go']", "package main\n")
+	description, output, ok := LastToolOutput()
+	assert.True(t, ok)
+	assert.Equal(t, "[read_file for 'main.go']", description)
+	assert.Equal(t, "package main\n", output)
+}
+
+func TestExecuteCommandCollapsesOutput(t *testing.T) {
+	t.Chdir(t.TempDir())
+	defer SetVerboseOutput(false)
+
+	// The model gets the full output whether or not the terminal shows it
+	result := ExecuteCommand(map[string]interface{}{"command": "seq 1 50"})
+	assert.Contains(t, result, "\n50\n")
+
+	SetVerboseOutput(true)
+	assert.Equal(t, 0, collapsedCommandLines())
+}
@@ -3,14 +3,22 @@ package core
 import (
 	"bufio"
 	"bytes"
+	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"regexp"
+	"runtime"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/pederhe/nca/internal/services/mcp"
 	"github.com/pederhe/nca/pkg/config"
@@ -20,45 +28,149 @@ import (
 
 // ExecuteCommand executes a command line command
 func ExecuteCommand(params map[string]interface{}) string {
+	result, _ := ExecuteCommandWithApproval(params)
+	return result
+}
+
+// ExecuteCommandWithApproval executes a command line command and returns how it was approved for
+// the audit log: not_required, auto_approved, allowlisted, approved, declined or blocked
+func ExecuteCommandWithApproval(params map[string]interface{}) (string, string) {
 	command, ok := params["command"].(string)
 	if !ok {
-		return "Error: Missing command parameter"
+		return "Error: Missing command parameter", AuditBlocked
 	}
-
-	autoApprove := config.Get("auto_approve") == "true" || config.Get("auto_approve") == "1"
 	requiresApproval, _ := params["requires_approval"].(bool)
-	if !autoApprove && requiresApproval {
-		fmt.Printf("Need to execute command: %s\nContinue? (y/n): ", utils.ColoredText(command, utils.ColorYellow))
-		var response string
-		fmt.Scanln(&response)
-		if strings.ToLower(response) != "y" {
-			return "Command execution cancelled"
+	approval, blocked := approveCommandRun(command, requiresApproval)
+	if blocked != "" {
+		return blocked, approval
+	}
+	return runCommand(command, params), approval
+}
+
+// approveCommandRun checks a command against the command policy and asks the user to approve it
+// if needed. It returns how the command was approved, and the result for the model if it must
+// not run.
+func approveCommandRun(command string, requiresApproval bool) (string, string) {
+	decision, reason := CheckCommandPolicy(command)
+	if decision == CommandDenied {
+		return AuditBlocked, fmt.Sprintf("Error: Command blocked by the command denylist (%s). Do not try to run it in another way.", reason)
+	}
+	if !requiresApproval {
+		return "not_required", ""
+	}
+	if decision == CommandAllowed {
+		return "allowlisted", ""
+	}
+	if IsAutoApprove() {
+		return "auto_approved", ""
+	}
+
+	if decideApproval(approveCommand) == denyAction {
+		return AuditBlocked, approvalDenial(approveCommand)
+	}
+	fmt.Printf("Need to execute command: %s\nContinue? (y/n/a = always allow in this project): ", utils.ColoredText(command, utils.ColorYellow))
+	var response string
+	fmt.Fscanln(Input, &response)
+	switch strings.ToLower(response) {
+	case "y":
+	case "a":
+		if err := AllowCommand(command); err != nil {
+			fmt.Println(utils.ColoredText("Failed to allow command: "+err.Error(), utils.ColorRed))
 		}
+	default:
+		return "declined", "Command execution cancelled"
 	}
+	return "approved", ""
+}
 
+// runCommand runs an approved command and returns its output for the model
+func runCommand(command string, params map[string]interface{}) string {
 	// Split command and arguments
+	var dirFile string
 	parts := strings.Fields(command)
 	if len(parts) == 0 {
 		return "Error: Empty command"
 	}
-	// If the command contains semicolons, execute it through bash
-	// This allows for command chaining like "cd /tmp; ls -la"
-	if strings.Contains(command, ";") {
-		parts = []string{"bash", "-c", command}
+	// If the command chains commands or changes the directory, execute it through the shell
+	// This allows for command chaining like "cd /tmp; ls -la". Most commands on Windows are
+	// built into the shell, so they always run through it there.
+	background, _ := params["run_in_background"].(bool)
+	changesDir := changeDirRegex.MatchString(command)
+	if changesDir || shellOperatorRegex.MatchString(command) || runtime.GOOS == "windows" {
+		shell, kind := utils.GetCommandShell()
+
+		// The directory of the shell is written to a file when it exits, so a "cd" applies to later
+		// tool calls. A "cd" of a background command only applies to the command.
+		if changesDir && !background {
+			if file, err := os.CreateTemp("", "nca-cwd-"); err == nil {
+				file.Close()
+				dirFile = file.Name()
+				defer os.Remove(dirFile)
+				command = trackWorkingDir(kind, command)
+			}
+		}
+		parts = utils.ShellArgs(shell, kind, command)
+	}
+	if background {
+		return startBackgroundJob(command, parts)
+	}
+
+	ctx := context.Background()
+	timeout := getCommandTimeout()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	// Stream the first lines of the output to the terminal while keeping its tail for the model.
+	// Stdout and stderr share one writer, so their output stays in order.
+	output := newTailBuffer(getCommandOutputTailSize())
+	display := newCollapsingWriter(os.Stdout, collapsedCommandLines())
+	writer := io.MultiWriter(display, output)
+	cmd := exec.CommandContext(ctx, parts[0], parts[1:]...)
+	cmd.Stdout = writer
+	cmd.Stderr = writer
+	cmd.Env = GetCommandEnv()
+	cmd.Dir = GetWorkingDir()
+	if dirFile != "" {
+		cmd.Env = append(cmd.Env, "NCA_CWD_FILE="+dirFile)
+	}
+	// The command runs in its own process group, a timeout kills the processes it started too
+	cmd.SysProcAttr = commandProcessAttr()
+	cmd.Cancel = func() error {
+		return killProcessGroup(cmd.Process)
+	}
+	// Don't wait for child processes that keep the output open after the command was killed
+	cmd.WaitDelay = 2 * time.Second
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Sprintf("Command execution error: %s", err)
+	}
+	setRunningCommand(cmd)
+	err := cmd.Wait()
+	interrupted := clearRunningCommand()
+	if hidden := display.HiddenLines(); hidden > 0 {
+		fmt.Println(utils.ColoredText(fmt.Sprintf("... %d more lines, /expand shows the output", hidden), utils.ColorGray))
+	}
+
+	if dirFile != "" {
+		if data, readErr := os.ReadFile(dirFile); readErr == nil && len(data) > 0 {
+			setWorkingDir(strings.TrimSpace(string(data)))
+		}
 	}
 
-	cmd := exec.Command(parts[0], parts[1:]...)
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-	cmd.Env = os.Environ()
-
-	err := cmd.Run()
-	if err != nil || stderr.Len() > 0 {
-		return fmt.Sprintf("Command execution error: %s\n%s", err, stderr.String())
+	if interrupted {
+		return fmt.Sprintf("Command was interrupted by the user. Output:\n%s", MaskSecrets(output.String()))
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Sprintf("Command timed out after %s and was terminated. Output:\n%s", timeout, MaskSecrets(output.String()))
+	}
+	if err != nil {
+		return fmt.Sprintf("Command execution error: %s\n%s\n[Exit code: %d]", err, MaskSecrets(output.String()), cmd.ProcessState.ExitCode())
 	}
 
-	return stdout.String()
+	return fmt.Sprintf("%s\n[Exit code: 0]", MaskSecrets(output.String()))
 }
 
 // ReadFile reads the contents of a file
@@ -72,6 +184,19 @@ func ReadFile(params map[string]interface{}) string {
 	rangeStr, _ := params["range"].(string)
 	var startLine, endLine int
 
+	// Large files are paged with offset and limit
+	offset, err := getOptionalIntParam(params, "offset", 0)
+	if err != nil {
+		return fmt.Sprintf("Error: %s", err)
+	}
+	limit, err := getOptionalIntParam(params, "limit", 0)
+	if err != nil {
+		return fmt.Sprintf("Error: %s", err)
+	}
+	if rangeStr != "" && (offset > 0 || limit > 0) {
+		return "Error: Use either range or offset and limit, not both"
+	}
+
 	// Parse range if provided
 	if rangeStr != "" {
 		parts := strings.Split(rangeStr, "-")
@@ -79,7 +204,6 @@ func ReadFile(params map[string]interface{}) string {
 			return "Error: Invalid range format. Expected format: start-end (e.g. 1-100)"
 		}
 
-		var err error
 		startLine, err = strconv.Atoi(parts[0])
 		if err != nil {
 			return "Error: Invalid start line number"
@@ -100,9 +224,28 @@ func ReadFile(params map[string]interface{}) string {
 	content := string(data)
 	lines := strings.Split(content, "\n")
 
-	// If no range specified, return entire file
+	// If no range specified, return entire file, or its first and last lines if it's too large
+	if rangeStr == "" && offset == 0 && limit == 0 {
+		return truncateFile(path, content, maxReadFileChars())
+	}
+
+	// A final newline doesn't start another line
+	if len(lines) > 1 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
 	if rangeStr == "" {
-		return content
+		if offset == 0 {
+			offset = 1
+		}
+		if offset > len(lines) {
+			return fmt.Sprintf("Error: offset %d is past the end of the file (%d lines)", offset, len(lines))
+		}
+		end := len(lines)
+		if limit > 0 {
+			end = min(offset+limit-1, len(lines))
+		}
+		return pageFileLines(lines, offset, end, maxReadFileChars(), true)
 	}
 
 	// Validate line numbers
@@ -116,12 +259,72 @@ func ReadFile(params map[string]interface{}) string {
 		return "Error: start line cannot be greater than end line"
 	}
 
-	// Adjust to 0-based index
-	startLine--
-	endLine--
+	// Return specified line range, as much of it as fits
+	return pageFileLines(lines, startLine, endLine, maxReadFileChars(), false)
+}
+
+// Maximum number of files read by one read_files call
+const maxReadFiles = 20
+
+// Matches a path with a line range suffix, e.g. main.go:10-50
+var pathRangeRegex = regexp.MustCompile(`^(.+):(\d+-\d+)$`)
+
+// ReadFiles reads multiple files in parallel and returns their contents in one result.
+// Each path may have a line range suffix like main.go:10-50.
+func ReadFiles(params map[string]interface{}) string {
+	var entries []string
+	switch paths := params["paths"].(type) {
+	case []string:
+		entries = paths
+	case string:
+		entries = strings.Split(paths, "\n")
+	}
+
+	var files []map[string]interface{}
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		file := map[string]interface{}{"path": entry}
+		if match := pathRangeRegex.FindStringSubmatch(entry); match != nil {
+			file["path"] = match[1]
+			file["range"] = match[2]
+		}
+		files = append(files, file)
+	}
+
+	if len(files) == 0 {
+		return "Error: Missing paths parameter"
+	}
+	if len(files) > maxReadFiles {
+		return fmt.Sprintf("Error: Too many files, read at most %d files per call", maxReadFiles)
+	}
+
+	results := make([]string, len(files))
+	var wg sync.WaitGroup
+	for i, file := range files {
+		wg.Add(1)
+		go func(i int, file map[string]interface{}) {
+			defer wg.Done()
+			results[i] = ReadFile(file)
+		}(i, file)
+	}
+	wg.Wait()
 
-	// Return specified line range
-	return strings.Join(lines[startLine:endLine+1], "\n")
+	var builder strings.Builder
+	for i, file := range files {
+		if i > 0 {
+			builder.WriteString("\n\n")
+		}
+		if rangeStr, ok := file["range"].(string); ok {
+			builder.WriteString(fmt.Sprintf("--- %s (lines %s) ---\n", file["path"], rangeStr))
+		} else {
+			builder.WriteString(fmt.Sprintf("--- %s ---\n", file["path"]))
+		}
+		builder.WriteString(results[i])
+	}
+	return builder.String()
 }
 
 // WriteToFile writes content to a file
@@ -137,17 +340,30 @@ func WriteToFile(params map[string]interface{}) string {
 	}
 	content = unescapeXML(content)
 
+	// Keep the line endings and byte order mark of an existing file
+	existing, err := os.ReadFile(path)
+	format := getFileFormat(existing, err == nil)
+
+	review := reviewFileWrite(path, format.decode(existing), err == nil, content, false)
+	if review.refusal != "" {
+		return review.refusal
+	}
+
 	// Ensure directory exists
 	dir := filepath.Dir(path)
 	if err := os.MkdirAll(dir, 0755); err != nil {
 		return fmt.Sprintf("Error creating directory: %s", err)
 	}
 
-	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+	if err := os.WriteFile(path, format.encode(review.content), 0644); err != nil {
 		return fmt.Sprintf("Error writing file: %s", err)
 	}
 
-	return fmt.Sprintf("File successfully written: %s", path)
+	result := fmt.Sprintf("File successfully written: %s", path)
+	if review.edited {
+		result += ". " + userEditNote
+	}
+	return result
 }
 
 func unescapeXML(content string) string {
@@ -178,99 +394,73 @@ func ReplaceInFile(params map[string]interface{}) string {
 		return fmt.Sprintf("Error reading file: %s", err)
 	}
 
-	originalContent := string(content)
-	fileContent := originalContent
-
-	// Parse and apply SEARCH/REPLACE blocks - more flexible regex to handle different line endings
-	// This regex makes newlines optional around the markers to be more flexible
-	re := regexp.MustCompile(`<{7}\s*SEARCH\s*\n?([\s\S]*?)\n?\s*={7}\s*\n?([\s\S]*?)\n?\s*>{7}\s*REPLACE`)
-	matches := re.FindAllStringSubmatch(diff, -1)
-
-	if len(matches) == 0 {
-		// Fall back to the original regex if the flexible one doesn't match
-		reOriginal := regexp.MustCompile(`<<<<<<< SEARCH\n([\s\S]*?)\n=======\n([\s\S]*?)\n>>>>>>> REPLACE`)
-		matches = reOriginal.FindAllStringSubmatch(diff, -1)
+	// Edit the text with LF line endings and without a byte order mark, the format
+	// of the file is restored when it is written
+	format := getFileFormat(content, true)
+	originalContent := format.decode(content)
+	diff = strings.ReplaceAll(diff, "\r\n", "\n")
 
-		if len(matches) == 0 {
-			// Try one more regex that doesn't require newlines
-			reLastAttempt := regexp.MustCompile(`<<<<<<< SEARCH([\s\S]*?)=======([\s\S]*?)>>>>>>> REPLACE`)
-			matches = reLastAttempt.FindAllStringSubmatch(diff, -1)
-
-			if len(matches) == 0 {
-				return "Error: No valid SEARCH/REPLACE blocks found. Format should be:\n<<<<<<< SEARCH\ntext to search\n=======\ntext to replace with\n>>>>>>> REPLACE"
-			}
-		}
+	fileContent, notes, err := applySearchReplaceBlocks(originalContent, diff)
+	if err != nil {
+		return fmt.Sprintf("Error: %s", err)
 	}
 
-	// Apply each SEARCH/REPLACE block
-	for _, match := range matches {
-		search := match[1]
-		replace := match[2]
-
-		// Trim any leading/trailing whitespace to make the matching more robust
-		search = strings.TrimSpace(search)
-
-		// Do the replacement
-		if strings.Contains(fileContent, search) {
-			fileContent = strings.Replace(fileContent, search, replace, 1)
-		} else {
-			return fmt.Sprintf("Error: Could not find text to replace: '%s'", search)
-		}
+	review := reviewFileWrite(path, originalContent, true, fileContent, true)
+	if review.refusal != "" {
+		return review.refusal
 	}
 
+	// Generate diff output in git style
+	diffOutput := generateGitStyleDiff(path, originalContent, review.content)
+
 	// Write back to file
-	if err := os.WriteFile(path, []byte(fileContent), 0644); err != nil {
+	if err := os.WriteFile(path, format.encode(review.content), 0644); err != nil {
 		return fmt.Sprintf("Error writing file: %s", err)
 	}
 
-	// Generate diff output in git style
-	diffOutput := generateGitStyleDiff(path, originalContent, fileContent)
-
-	return fmt.Sprintf("File successfully updated: %s\n%s", path, diffOutput)
-}
-
-// generateGitStyleDiff generates a git-style diff between original and new content
-func generateGitStyleDiff(filename string, originalContent, newContent string) string {
-	// Create temporary files to store original and new content
-	tempDir, err := os.MkdirTemp("", "nca-diff")
-	if err != nil {
-		return fmt.Sprintf("Error creating temp directory: %s", err)
+	// The diff comes last and is only shown to the user, see SplitReplaceResult
+	result := fmt.Sprintf("File successfully updated: %s", path)
+	if review.edited {
+		result += ". " + userEditNote
 	}
-	defer os.RemoveAll(tempDir)
-
-	originalFile := filepath.Join(tempDir, "original")
-	newFile := filepath.Join(tempDir, "new")
-
-	if err := os.WriteFile(originalFile, []byte(originalContent), 0644); err != nil {
-		return fmt.Sprintf("Error writing temp file: %s", err)
+	if len(review.rejected) > 0 {
+		result += "\n" + formatRejectedHunks(review.rejected, review.reason)
 	}
-
-	if err := os.WriteFile(newFile, []byte(newContent), 0644); err != nil {
-		return fmt.Sprintf("Error writing temp file: %s", err)
+	if len(notes) > 0 {
+		result += "\n\nSome SEARCH blocks didn't match exactly, check that the right lines were changed:\n" + strings.Join(notes, "\n")
 	}
+	result += "\n" + diffOutput
+	return result
+}
 
-	// Use external diff command to generate standard diff output
-	cmd := exec.Command("diff", "-u", originalFile, newFile)
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-
-	// diff command returns non-zero exit code when differences are found, which is normal
-	_ = cmd.Run()
+// SplitReplaceResult splits a successful result of replace_in_file into the part for the model and
+// the diff of the change at its end, which is only shown to the user
+func SplitReplaceResult(result string) (string, string) {
+	firstLine, _, _ := strings.Cut(result, "\n")
+	path, ok := strings.CutPrefix(firstLine, "File successfully updated: ")
+	if !ok {
+		return result, ""
+	}
+	path = strings.TrimSuffix(path, ". "+userEditNote)
 
-	if stderr.Len() > 0 {
-		return fmt.Sprintf("Error generating diff: %s", stderr.String())
+	// The header of the diff names the file, lines of rejected hunks before it can look like one
+	header := "\n--- a/" + toPosix(path) + "\n+++ b/" + toPosix(path) + "\n"
+	if i := strings.Index(result, header); i >= 0 {
+		return result[:i], result[i+1:]
+	}
+	if summary, ok := strings.CutSuffix(result, "\nNo changes detected"); ok {
+		return summary, "No changes detected"
 	}
+	return result, ""
+}
 
-	diffOutput := stdout.String()
+// generateGitStyleDiff generates a git-style diff between original and new content
+func generateGitStyleDiff(filename string, originalContent, newContent string) string {
+	diffOutput := unifiedDiff("a/"+toPosix(filename), "b/"+toPosix(filename), originalContent, newContent)
 	if diffOutput == "" {
 		return "No changes detected"
 	}
 
-	// Process diff output, replace temporary file paths with actual file path
-	diffOutput = strings.ReplaceAll(diffOutput, "--- "+originalFile, "--- a/"+filename)
-	diffOutput = strings.ReplaceAll(diffOutput, "+++ "+newFile, "+++ b/"+filename)
-
 	// Add colors
 	var coloredOutput strings.Builder
 	scanner := bufio.NewScanner(strings.NewReader(diffOutput))
@@ -307,10 +497,9 @@ func SearchFiles(params map[string]interface{}) string {
 		filePattern = "*"
 	}
 
-	limit := 200
+	limit := getMaxResultEntries()
 	// Check if ripgrep is available
-	rgCmd := exec.Command("rg", "--version")
-	if err := rgCmd.Run(); err == nil {
+	if _, err := exec.LookPath("rg"); err == nil {
 		// ripgrep is available, use it for searching
 		var stdout, stderr bytes.Buffer
 		args := []string{
@@ -344,7 +533,9 @@ func SearchFiles(params map[string]interface{}) string {
 		count := 0
 		for scanner.Scan() {
 			line := scanner.Text()
-			// ripgrep match output format: file:line:content
+			// ripgrep match output format: file:line:content, a drive letter of the file isn't a separator
+			volume := filepath.VolumeName(line)
+			line = line[len(volume):]
 			parts := strings.SplitN(line, ":", 3)
 			if len(parts) == 3 {
 				if count >= limit {
@@ -352,11 +543,11 @@ func SearchFiles(params map[string]interface{}) string {
 					break
 				}
 
-				file := parts[0]
+				file := volume + parts[0]
 				if file != currentFile {
 					currentFile = file
 					relPath, _ := filepath.Rel(path, file)
-					results.WriteString(fmt.Sprintf("File: %s\n", relPath))
+					results.WriteString(fmt.Sprintf("File: %s\n", toPosix(relPath)))
 				}
 
 				lineNum := parts[1]
@@ -371,11 +562,11 @@ func SearchFiles(params map[string]interface{}) string {
 				}
 				parts = strings.SplitN(line, "-", 2)
 				if len(parts) == 2 {
-					file := parts[0]
+					file := volume + parts[0]
 					if file != currentFile {
 						currentFile = file
 						relPath, _ := filepath.Rel(path, file)
-						results.WriteString(fmt.Sprintf("File: %s\n", relPath))
+						results.WriteString(fmt.Sprintf("File: %s\n", toPosix(relPath)))
 					}
 					results.WriteString(fmt.Sprintf("  %s\n", parts[1]))
 				}
@@ -399,10 +590,10 @@ func SearchFiles(params map[string]interface{}) string {
 	var results strings.Builder
 	results.WriteString(fmt.Sprintf("Searching for '%s' in '%s' (pattern: %s) using raw search\n\n", regexStr, path, filePattern))
 
-	// For ripgrep compatibility, convert glob pattern to regex
-	filePattern = strings.ReplaceAll(filePattern, ".", "\\.")
-	filePattern = strings.ReplaceAll(filePattern, "*", ".*")
-	filePattern = "^" + filePattern + "$"
+	// Like the globs of ripgrep, the pattern matches the file names
+	if _, err := filepath.Match(filePattern, ""); err != nil {
+		return fmt.Sprintf("Error: Invalid file pattern '%s': %s", filePattern, err)
+	}
 	// Walk through directory
 	count := 0
 	err = filepath.Walk(path, func(filePath string, info os.FileInfo, err error) error {
@@ -420,8 +611,7 @@ func SearchFiles(params map[string]interface{}) string {
 		}
 
 		// Check if file matches pattern
-		globRegex, err := regexp.Compile(filePattern)
-		if err != nil || !globRegex.MatchString(filePath) {
+		if matched, _ := filepath.Match(filePattern, info.Name()); !matched {
 			return nil
 		}
 
@@ -438,7 +628,7 @@ func SearchFiles(params map[string]interface{}) string {
 		matches := re.FindAllStringIndex(fileContent, -1)
 		if len(matches) > 0 {
 			relPath, _ := filepath.Rel(path, filePath)
-			results.WriteString(fmt.Sprintf("File: %s\n", relPath))
+			results.WriteString(fmt.Sprintf("File: %s\n", toPosix(relPath)))
 
 			for _, match := range matches {
 				start, end := match[0], match[1]
@@ -485,6 +675,9 @@ func SearchFiles(params map[string]interface{}) string {
 	return results.String()
 }
 
+// errWalkLimit stops a directory walk when the result limit is reached
+var errWalkLimit = errors.New("result limit reached")
+
 // ListFiles lists files in a directory
 func ListFiles(params map[string]interface{}) string {
 	path, ok := params["path"].(string)
@@ -502,51 +695,53 @@ func ListFiles(params map[string]interface{}) string {
 	}
 	files.WriteString(fmt.Sprintf("Listing files in '%s'%s:\n\n", path, recursiveText))
 
-	// Use find command to list files
-	findCmd := fmt.Sprintf("find %s -type f -not -name '.*' -o -type d -not -path '*/.*'", path)
-	if !recursive {
-		findCmd += " -maxdepth 1"
-	}
-
-	cmd := exec.Command("bash", "-c", findCmd)
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-
-	err := cmd.Run()
-	if err != nil && err.Error() != "exit status 1" {
-		return fmt.Sprintf("Error listing files: %s\n%s", err, stderr.String())
-	}
-
-	limit := 200
+	// Walk the directory in lexical order, leaving out hidden files and directories
+	limit := getMaxResultEntries()
 	count := 0
-	scanner := bufio.NewScanner(&stdout)
-	for scanner.Scan() {
+	err := filepath.WalkDir(path, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if filePath == path {
+				return err
+			}
+			return nil
+		}
+		if filePath == path {
+			return nil
+		}
+		if strings.HasPrefix(entry.Name(), ".") {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
 		if count >= limit {
 			files.WriteString(fmt.Sprintf("\n... and more (showing first %d results)\n", limit))
-			break
-		}
-
-		filePath := scanner.Text()
-
-		info, err := os.Stat(filePath)
-		if err != nil {
-			continue
+			return errWalkLimit
 		}
 
 		relPath, _ := filepath.Rel(path, filePath)
-		if strings.HasPrefix(relPath, ".") {
-			continue
-		}
-		if info.IsDir() {
+		relPath = filepath.ToSlash(relPath)
+		if entry.IsDir() {
 			files.WriteString(fmt.Sprintf("%s/\n", relPath))
-		} else {
-			files.WriteString(fmt.Sprintf("%s (%d bytes)\n", relPath, info.Size()))
+			count++
+			if !recursive {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil
 		}
+		files.WriteString(fmt.Sprintf("%s (%d bytes)\n", relPath, info.Size()))
 		count++
+		return nil
+	})
+	if err != nil && err != errWalkLimit {
+		return fmt.Sprintf("Error listing files: %s", err)
 	}
 
-	if files.Len() == 0 {
+	if count == 0 {
 		return "No files found"
 	}
 
@@ -570,7 +765,7 @@ func ListCodeDefinitionNames(params map[string]interface{}) string {
 		return fmt.Sprintf("Error listing definitions: %s", err)
 	}
 
-	limit := 200
+	limit := getMaxResultEntries()
 	count := 0
 	for _, entry := range entries {
 		if entry.IsDir() {
@@ -714,16 +909,6 @@ func extractDefinitions(content, ext string) []string {
 	return definitions
 }
 
-func FollowupQuestion(params map[string]interface{}) string {
-	// Get the question from the tool use parameters
-	question, ok := params["question"].(string)
-	if !ok || question == "" {
-		return "Error: No question provided for ask_followup_question tool"
-	}
-
-	return ""
-}
-
 // AskModeResponse handles responses in plan mode
 func AskModeResponse(params map[string]interface{}) string {
 	// Get the response content from the tool use parameters
@@ -737,46 +922,154 @@ func AskModeResponse(params map[string]interface{}) string {
 
 // GitCommit handles the git_commit tool functionality
 func GitCommit(params map[string]interface{}) string {
-	// Extract parameters
-	commitMessage, ok := params["message"].(string)
-	if !ok || commitMessage == "" {
-		return "Error: message parameter is required for git_commit"
-	}
+	// Extract parameters, without a message one is proposed from the staged changes
+	commitMessage, _ := params["message"].(string)
+	amend, _ := params["amend"].(bool)
+	stagedOnly, _ := params["staged_only"].(bool)
 
-	// Extract files parameter
+	// Extract files parameter, with staged_only the changes already staged are committed
 	var modifiedFiles []string
-	if filesParam, ok := params["files"].([]string); ok && len(filesParam) > 0 {
+	if filesParam, ok := params["files"].([]string); ok && len(filesParam) > 0 && !stagedOnly {
 		modifiedFiles = filesParam
 	}
 
 	// Validate parameters
-	if len(modifiedFiles) == 0 {
-		return "Error: files parameter is required for git_commit"
+	if len(modifiedFiles) == 0 && !stagedOnly && !amend {
+		return "Error: files parameter is required for git_commit, no files were changed in this task"
+	}
+	// Commits are confirmed even with auto-approve, only --yes approves them
+	decision := decideApproval(approveCommit)
+	if decision == denyAction {
+		return approvalDenial(approveCommit)
+	}
+	if amend {
+		if err := checkAmendable(); err != nil {
+			return fmt.Sprintf("Error: %s", err)
+		}
+	}
+
+	// The index is restored if the commit doesn't happen, so declining leaves nothing staged
+	index, err := runGit(".", "write-tree")
+	if err != nil {
+		return fmt.Sprintf("Error: Failed to read the staging area: %s", err)
+	}
+	restoreIndex := func() {
+		runGit(".", "read-tree", strings.TrimSpace(index))
+	}
+
+	if len(modifiedFiles) > 0 {
+		if err := utils.GitAdd(modifiedFiles); err != nil {
+			restoreIndex()
+			return fmt.Sprintf("Error adding files to staging area: %s", err)
+		}
+	}
+
+	// Check that there is something to commit before asking
+	staged, err := getStagedFiles()
+	if err != nil {
+		restoreIndex()
+		return fmt.Sprintf("Error: Failed to read the staged changes: %s", err)
+	}
+	if len(staged) == 0 && !amend {
+		restoreIndex()
+		if stagedOnly {
+			return "Error: No changes are staged, stage them with git add or list the files to commit"
+		}
+		return fmt.Sprintf("Error: No changes to commit, %s have no changes against the last commit", strings.Join(modifiedFiles, ", "))
+	}
+
+	if strings.TrimSpace(commitMessage) == "" && amend {
+		// Amending without a message keeps the message of the last commit
+		lastMessage, err := runGit(".", "log", "-1", "--format=%B")
+		if err != nil {
+			restoreIndex()
+			return fmt.Sprintf("Error: %s", err)
+		}
+		commitMessage = strings.TrimSpace(lastMessage)
+	} else {
+		commitMessage = proposeCommitMessage(commitMessage, staged)
 	}
 
 	// Display files to be committed
-	fmt.Println("Files to be committed:")
-	for _, file := range modifiedFiles {
-		fmt.Printf("  %s%s%s\n", utils.ColorGreen, file, utils.ColorReset)
+	if amend {
+		fmt.Println("Amending the last commit with:")
+	} else {
+		fmt.Println("Files to be committed:")
+	}
+	for _, file := range staged {
+		fmt.Printf("  %c %s\n", file.status, utils.ColoredText(file.path, utils.ColorGreen))
+	}
+
+	if decision == askUser {
+		var confirmed bool
+		if commitMessage, confirmed = confirmCommit(commitMessage); !confirmed {
+			restoreIndex()
+			return "Commit cancelled"
+		}
 	}
 
+	// Hooks like formatters may fix the staged files and reject the commit, the fixes are
+	// staged and the commit is retried once
+	hooks := installedCommitHooks()
+	var snapshot *stagedSnapshot
+	if len(hooks) > 0 {
+		snapshot, _ = takeStagedSnapshot(staged)
+	}
+
+	// Commit changes
+	output, err := utils.GitCommit(commitMessage, amend)
+	var restaged []string
+	if err != nil && isHookFailure(output, hooks) {
+		fmt.Println(utils.ColoredText(strings.TrimSpace(output), utils.ColorRed))
+		var skipped []string
+		if snapshot != nil {
+			restaged, skipped, _ = snapshot.restageHookFixes()
+		}
+		if len(restaged) > 0 {
+			fmt.Printf("The hook changed %s, committing again with the changes\n", strings.Join(restaged, ", "))
+			output, err = utils.GitCommit(commitMessage, amend)
+		}
+		if err != nil {
+			restoreIndex()
+			return formatHookRejection(output, hooks, restaged, skipped)
+		}
+	}
+	if err != nil {
+		restoreIndex()
+		return fmt.Sprintf("Error committing changes: %s", err)
+	}
+
+	result := fmt.Sprintf("Successfully committed changes with message: %s", commitMessage)
+	if amend {
+		result = fmt.Sprintf("Successfully amended the last commit with message: %s", commitMessage)
+	}
+	if len(restaged) > 0 {
+		result += fmt.Sprintf("\nThe first attempt was rejected by a git hook that changed %s, the commit includes the changes of the hook.",
+			strings.Join(restaged, ", "))
+	}
+	return result
+}
+
+// confirmCommit asks the user to confirm the files and the message of a commit, the user can
+// write another message. It returns the message and whether the commit was confirmed.
+func confirmCommit(commitMessage string) (string, bool) {
 	// Ask for confirmation to proceed with these files
 	fmt.Print("Do you want to proceed with these files? (y/n): ")
 	var response string
-	fmt.Scanln(&response)
+	fmt.Fscanln(Input, &response)
 	if strings.ToLower(response) != "y" {
-		return "Commit cancelled"
+		return "", false
 	}
 
-	fmt.Printf("Commit message: %s%s%s\n", utils.ColorYellow, commitMessage, utils.ColorReset)
+	fmt.Printf("Commit message: %s\n", utils.ColoredText(commitMessage, utils.ColorYellow))
 	fmt.Print("Do you want to use this message? (y/n/custom): ")
 
-	reader := bufio.NewReader(os.Stdin)
+	reader := bufio.NewReader(Input)
 	response, _ = reader.ReadString('\n')
 	response = strings.TrimSpace(response)
 
 	if strings.ToLower(response) == "n" {
-		return "Commit cancelled"
+		return "", false
 	} else if strings.ToLower(response) != "y" {
 		// User wants to provide a custom message
 		fmt.Print("Enter your custom commit message: ")
@@ -787,20 +1080,7 @@ func GitCommit(params map[string]interface{}) string {
 			commitMessage = customMessage
 		}
 	}
-
-	// Now execute the add and commit operations
-	err := utils.GitAdd(modifiedFiles) // Add specified files
-	if err != nil {
-		return fmt.Sprintf("Error adding files to staging area: %s", err)
-	}
-
-	// Commit changes
-	err = utils.GitCommit(commitMessage)
-	if err != nil {
-		return fmt.Sprintf("Error committing changes: %s", err)
-	}
-
-	return fmt.Sprintf("Successfully committed changes with message: %s", commitMessage)
+	return commitMessage, true
 }
 
 // FetchWebContent fetches the content of a web page
@@ -815,6 +1095,10 @@ func FetchWebContent(params map[string]interface{}) string {
 		return fmt.Sprintf("Error: Invalid URL format: %s", url)
 	}
 
+	if err := CheckNetworkPolicy(url); err != nil {
+		return fmt.Sprintf("Error: %s", err)
+	}
+
 	fmt.Printf("Fetching web content from: %s\n", utils.ColoredText(url, utils.ColorYellow))
 
 	// Fetch web content
@@ -823,6 +1107,11 @@ func FetchWebContent(params map[string]interface{}) string {
 		return fmt.Sprintf("Error fetching web content: %s", err)
 	}
 
+	// Keep large pages out of the conversation, the model can page through the artifact
+	if limit := GetToolResultLimit("fetch_web_content"); limit > 0 && EstimateTokens(content) > limit {
+		content = truncateToArtifact("web_page", url, content, limit)
+	}
+
 	// Format the result
 	var result strings.Builder
 	result.WriteString(fmt.Sprintf("Web content from %s:\n\n", url))
@@ -842,45 +1131,54 @@ func FindFiles(params map[string]interface{}) string {
 	if !ok {
 		return "Error: Missing file pattern parameter"
 	}
+	if _, err := filepath.Match(filePattern, ""); err != nil {
+		return fmt.Sprintf("Error: Invalid file pattern '%s': %s", filePattern, err)
+	}
 
 	var results strings.Builder
 	results.WriteString(fmt.Sprintf("Finding files in '%s' (pattern: %s)\n\n", path, filePattern))
 
-	findCmd := fmt.Sprintf("find %s -type f", path)
-	if filePattern != "*" {
-		findCmd += fmt.Sprintf(" -name '%s'", filePattern)
-	}
-
-	cmd := exec.Command("bash", "-c", findCmd)
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-
-	err := cmd.Run()
-	if err != nil && err.Error() != "exit status 1" {
-		return fmt.Sprintf("Error finding files: %s\n%s", err, stderr.String())
-	}
-
-	limit := 200
+	// Walk the directory in lexical order, the git database is never of interest
+	limit := getMaxResultEntries()
 	count := 0
-	scanner := bufio.NewScanner(&stdout)
-	for scanner.Scan() {
+	err := filepath.WalkDir(path, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if filePath == path {
+				return err
+			}
+			return nil
+		}
+		if entry.IsDir() {
+			if entry.Name() == ".git" && filePath != path {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if matched, _ := filepath.Match(filePattern, entry.Name()); !matched {
+			return nil
+		}
 		if count >= limit {
 			results.WriteString(fmt.Sprintf("\n... and more (showing first %d results)\n", limit))
-			break
+			return errWalkLimit
 		}
-		filePath := scanner.Text()
-		info, err := os.Stat(filePath)
+
+		info, err := entry.Info()
 		if err != nil {
-			continue
+			return nil
 		}
-
 		relPath, _ := filepath.Rel(path, filePath)
-		results.WriteString(fmt.Sprintf("%s (%d bytes)\n", relPath, info.Size()))
+		if relPath == "." {
+			relPath = entry.Name()
+		}
+		results.WriteString(fmt.Sprintf("%s (%d bytes)\n", filepath.ToSlash(relPath), info.Size()))
 		count++
+		return nil
+	})
+	if err != nil && err != errWalkLimit {
+		return fmt.Sprintf("Error finding files: %s", err)
 	}
 
-	if results.Len() == 0 {
+	if count == 0 {
 		return "No matching files found"
 	}
 
@@ -917,20 +1215,78 @@ func UseMcpTool(params map[string]interface{}) string {
 		return "Error: MCP is disabled. Enable it in settings to use MCP tools."
 	}
 
+	// Tools in the autoApprove list of the server run without asking
+	if !IsAutoApprove() && !mcpHub.IsToolAutoApproved(serverName, toolName) {
+		if decideApproval(approveMCPTool) == denyAction {
+			return approvalDenial(approveMCPTool)
+		}
+		fmt.Printf("Need to use MCP tool %s of server %s with arguments: %s\nContinue? (y/n/a = always allow this tool): ",
+			utils.ColoredText(toolName, utils.ColorYellow), serverName, argsRaw)
+		var response string
+		fmt.Fscanln(Input, &response)
+		switch strings.ToLower(response) {
+		case "y":
+		case "a":
+			if err := mcpHub.AutoApproveTool(serverName, toolName); err != nil {
+				fmt.Println(utils.ColoredText("Failed to allow MCP tool: "+err.Error(), utils.ColorRed))
+			}
+		default:
+			return "MCP tool use cancelled"
+		}
+	}
+
 	// Call the tool
+	span := StartSpan("mcp.call_tool "+toolName, SpanKindClient, map[string]interface{}{"mcp.server": serverName, "mcp.tool": toolName})
 	response, err := mcpHub.CallTool(serverName, toolName, arguments)
 	if err != nil {
+		span.End(err.Error())
 		return fmt.Sprintf("Error calling MCP tool %s on server %s: %s", toolName, serverName, err)
 	}
 
 	// Format and return the response
 	if response.IsError {
+		span.End("tool returned an error")
 		return fmt.Sprintf("MCP tool error: %s", formatToolResponse(response))
 	}
+	span.End("")
 
 	return formatToolResponse(response)
 }
 
+const (
+	// defaultMcpResourceMaxKB is the default maximum size of a resource read, in KB
+	defaultMcpResourceMaxKB = 1024
+	// maxMcpResourceTimeoutSeconds is the longest timeout a resource read may request
+	maxMcpResourceTimeoutSeconds = 600
+)
+
+// getMcpResourceMaxSize returns the maximum size of a resource read in bytes, set with
+// the "mcp_resource_max_kb" config key. The max_size parameter can only lower it.
+func getMcpResourceMaxSize() int {
+	if value := config.Get("mcp_resource_max_kb"); value != "" {
+		if kb, err := strconv.Atoi(value); err == nil && kb > 0 {
+			return kb * 1024
+		}
+	}
+	return defaultMcpResourceMaxKB * 1024
+}
+
+// getOptionalIntParam returns a positive integer parameter of a tool call, or 0 if it isn't set
+func getOptionalIntParam(params map[string]interface{}, name string, max int) (int, error) {
+	value, _ := params[name].(string)
+	if value = strings.TrimSpace(value); value == "" {
+		return 0, nil
+	}
+	number, err := strconv.Atoi(value)
+	if err != nil || number <= 0 {
+		return 0, fmt.Errorf("Invalid %s parameter, expected a positive number", name)
+	}
+	if max > 0 && number > max {
+		return 0, fmt.Errorf("Invalid %s parameter, the maximum is %d", name, max)
+	}
+	return number, nil
+}
+
 // AccessMcpResource accesses a resource provided by a connected MCP server
 func AccessMcpResource(params map[string]interface{}) string {
 	serverName, ok := params["server_name"].(string)
@@ -950,17 +1306,33 @@ func AccessMcpResource(params map[string]interface{}) string {
 		return "Error: MCP is disabled. Enable it in settings to use MCP resources."
 	}
 
+	timeout, err := getOptionalIntParam(params, "timeout", maxMcpResourceTimeoutSeconds)
+	if err != nil {
+		return "Error: " + err.Error()
+	}
+	maxSize := getMcpResourceMaxSize()
+	if maxKB, err := getOptionalIntParam(params, "max_size", maxSize/1024); err != nil {
+		return "Error: " + err.Error()
+	} else if maxKB > 0 {
+		maxSize = maxKB * 1024
+	}
+
 	// Read the resource
-	response, err := mcpHub.ReadResource(serverName, uri)
+	span := StartSpan("mcp.read_resource", SpanKindClient, map[string]interface{}{"mcp.server": serverName, "mcp.resource": uri})
+	response, err := mcpHub.ReadResource(serverName, uri, time.Duration(timeout)*time.Second)
 	if err != nil {
+		span.End(err.Error())
 		return fmt.Sprintf("Error accessing MCP resource %s on server %s: %s", uri, serverName, err)
 	}
 
+	span.End("")
+
 	// Format and return the response
-	return formatResourceResponse(response)
+	return formatResourceResponse(response, maxSize)
 }
 
-// formatToolResponse formats a tool response for output
+// formatToolResponse formats a tool response for output.
+// Images and binary data are saved as artifacts instead of being inlined.
 func formatToolResponse(response *common.McpToolCallResponse) string {
 	var result strings.Builder
 
@@ -968,17 +1340,18 @@ func formatToolResponse(response *common.McpToolCallResponse) string {
 		switch content.Type {
 		case "text":
 			result.WriteString(content.Text)
-		case "data":
-			if content.MimeType != "" {
-				result.WriteString(fmt.Sprintf("[Data with MIME type: %s]\n", content.MimeType))
+		case "image", "data":
+			if content.MimeType == "" && content.Type == "data" {
+				result.WriteString(content.Data)
+				break
 			}
-			result.WriteString(content.Data)
+			result.WriteString(saveBinaryContent("use_mcp_tool", content.MimeType, content.Data))
 		case "resource":
 			result.WriteString(fmt.Sprintf("[Resource: %s]\n", content.Resource.URI))
 			if content.Resource.Text != "" {
 				result.WriteString(content.Resource.Text)
 			} else if content.Resource.Blob != "" {
-				result.WriteString(fmt.Sprintf("[Binary data with MIME type: %s]", content.Resource.MimeType))
+				result.WriteString(saveBinaryContent("use_mcp_tool", content.Resource.MimeType, content.Resource.Blob))
 			}
 		default:
 			result.WriteString(fmt.Sprintf("[Unknown content type: %s]", content.Type))
@@ -989,23 +1362,100 @@ func formatToolResponse(response *common.McpToolCallResponse) string {
 	return result.String()
 }
 
-// formatResourceResponse formats a resource response for output
-func formatResourceResponse(response *common.McpResourceResponse) string {
+// saveBinaryContent stores base64 encoded data from an MCP response as an artifact.
+// Images are shown inline when the terminal supports it and queued for the model.
+func saveBinaryContent(source string, mimeType string, encoded string) string {
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return fmt.Sprintf("[Binary data with MIME type: %s, invalid base64 encoding]", mimeType)
+	}
+
+	kind, label := "binary", "Binary data"
+	if strings.HasPrefix(mimeType, "image/") {
+		kind, label = "image", "Image"
+	}
+
+	artifact, err := GetArtifactStore().SaveBinary(kind, source, mimeType, data)
+	if err != nil {
+		return fmt.Sprintf("[Binary data with MIME type: %s, %d bytes, failed to save: %s]", mimeType, len(data), err)
+	}
+
+	if kind == "image" {
+		utils.DisplayInlineImage(data, filepath.Base(artifact.File), mimeType)
+		addPendingImage(artifact.ID)
+	}
+
+	return fmt.Sprintf("[%s with MIME type: %s, %s, saved as artifact %s at %s]",
+		label, mimeType, utils.FormatSize(int64(len(data))), artifact.ID, artifact.File)
+}
+
+// formatResourceResponse formats a resource response for output.
+// HTML is converted to markdown and binary data is saved as an artifact. Content beyond
+// maxSize bytes is cut off, the full text is saved as an artifact.
+func formatResourceResponse(response *common.McpResourceResponse, maxSize int) string {
 	var result strings.Builder
 
+	remaining := maxSize
 	for _, content := range response.Contents {
 		result.WriteString(fmt.Sprintf("[Resource: %s]\n", content.URI))
 		if content.MimeType != "" {
 			result.WriteString(fmt.Sprintf("MIME type: %s\n", content.MimeType))
 		}
 
-		if content.Text != "" {
-			result.WriteString(content.Text)
-		} else if content.Blob != "" {
-			result.WriteString("[Binary data]")
+		text := content.Text
+		if text == "" && content.Blob != "" {
+			if !isTextMimeType(content.MimeType) {
+				// Base64 is a third larger than the decoded data
+				if size := base64.StdEncoding.DecodedLen(len(content.Blob)); size > remaining {
+					result.WriteString(fmt.Sprintf("[Binary data with MIME type: %s, %s, not saved because it exceeds the maximum size of %s]\n",
+						content.MimeType, utils.FormatSize(int64(size)), utils.FormatSize(int64(maxSize))))
+					continue
+				}
+				result.WriteString(saveBinaryContent("access_mcp_resource", content.MimeType, content.Blob))
+				result.WriteString("\n")
+				continue
+			}
+			data, err := base64.StdEncoding.DecodeString(content.Blob)
+			if err != nil {
+				result.WriteString(fmt.Sprintf("[Text with MIME type: %s, invalid base64 encoding]\n", content.MimeType))
+				continue
+			}
+			text = string(data)
+		}
+
+		if strings.HasPrefix(content.MimeType, "text/html") || strings.HasPrefix(content.MimeType, "application/xhtml") {
+			if markdown, err := utils.HTMLToMarkdown(text); err == nil {
+				text = markdown
+			}
+		}
+		if len(text) > remaining {
+			result.WriteString(truncateAtLine(text, remaining))
+			notice := fmt.Sprintf("\n[Resource truncated: showing %s of %s (maximum size %s)",
+				utils.FormatSize(int64(remaining)), utils.FormatSize(int64(len(text))), utils.FormatSize(int64(maxSize)))
+			if artifact, err := GetArtifactStore().Save("mcp_resource", content.URI, text); err == nil {
+				notice += fmt.Sprintf(". Full content saved as artifact %s, use get_artifact with a range to view the rest", artifact.ID)
+			}
+			result.WriteString(notice + "]\n")
+			remaining = 0
+			continue
 		}
+		remaining -= len(text)
+		result.WriteString(text)
 		result.WriteString("\n")
 	}
 
 	return result.String()
 }
+
+// isTextMimeType returns whether data of a MIME type is readable text
+func isTextMimeType(mimeType string) bool {
+	mimeType = strings.ToLower(strings.TrimSpace(strings.Split(mimeType, ";")[0]))
+	if strings.HasPrefix(mimeType, "text/") {
+		return true
+	}
+	switch mimeType {
+	case "application/json", "application/xml", "application/xhtml+xml", "application/javascript", "application/yaml", "application/x-yaml":
+		return true
+	}
+	return strings.HasSuffix(mimeType, "+json") || strings.HasSuffix(mimeType, "+xml")
+}
@@ -5,9 +5,11 @@ import (
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // Setup test environment with temporary directory and files
@@ -99,6 +101,39 @@ func TestReadFile(t *testing.T) {
 	assert.Contains(t, result, "Error reading file")
 }
 
+// Test ReadFiles function
+func TestReadFiles(t *testing.T) {
+	tempDir, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	testFilePath := filepath.Join(tempDir, "test_file.txt")
+	linesFilePath := filepath.Join(tempDir, "lines.txt")
+	err := os.WriteFile(linesFilePath, []byte("one\ntwo\nthree\nfour"), 0644)
+	assert.NoError(t, err)
+
+	// Files are returned in order, ranges and errors are reported per file
+	params := map[string]interface{}{
+		"paths": []string{testFilePath, linesFilePath + ":2-3", filepath.Join(tempDir, "missing.txt")},
+	}
+	result := ReadFiles(params)
+	expected := "--- " + testFilePath + " ---\nThis is a test file content\n\n" +
+		"--- " + linesFilePath + " (lines 2-3) ---\ntwo\nthree\n\n" +
+		"--- " + filepath.Join(tempDir, "missing.txt") + " ---\nError reading file"
+	assert.True(t, strings.HasPrefix(result, expected), result)
+
+	// Paths can also be passed as lines of a string
+	result = ReadFiles(map[string]interface{}{"paths": testFilePath + "\n\n" + linesFilePath})
+	assert.Contains(t, result, "--- "+linesFilePath+" ---\none\ntwo\nthree\nfour")
+
+	// Missing or too many paths
+	assert.Contains(t, ReadFiles(map[string]interface{}{}), "Error: Missing paths parameter")
+	tooMany := make([]string, maxReadFiles+1)
+	for i := range tooMany {
+		tooMany[i] = testFilePath
+	}
+	assert.Contains(t, ReadFiles(map[string]interface{}{"paths": tooMany}), "Error: Too many files")
+}
+
 // Test WriteToFile function
 func TestWriteToFile(t *testing.T) {
 	tempDir, cleanup := setupTestEnv(t)
@@ -241,6 +276,35 @@ func TestListFiles(t *testing.T) {
 	assert.Contains(t, result, "subfile.txt")
 }
 
+func TestListFilesWalk(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "my project; rm -rf x")
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "sub dir", "deep"), 0755))
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, ".git"), 0755))
+	for _, file := range []string{"b.txt", "a file.txt", ".env", "sub dir/c.go", "sub dir/deep/d.go", ".git/HEAD"} {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, file), []byte("data"), 0644))
+	}
+
+	// Paths with spaces and shell characters work, hidden entries are left out and the order is sorted
+	result := ListFiles(map[string]interface{}{"path": dir})
+	assert.Contains(t, result, "a file.txt (4 bytes)\nb.txt (4 bytes)\nsub dir/\n")
+	assert.NotContains(t, result, "c.go")
+	assert.NotContains(t, result, ".env")
+	assert.NotContains(t, result, "HEAD")
+
+	result = ListFiles(map[string]interface{}{"path": dir, "recursive": true})
+	assert.Contains(t, result, "sub dir/c.go (4 bytes)\nsub dir/deep/\nsub dir/deep/d.go (4 bytes)")
+
+	result = FindFiles(map[string]interface{}{"path": dir, "file_pattern": "*.go"})
+	assert.Contains(t, result, "sub dir/c.go (4 bytes)\nsub dir/deep/d.go (4 bytes)")
+	assert.NotContains(t, result, "b.txt")
+	assert.NotContains(t, FindFiles(map[string]interface{}{"path": dir, "file_pattern": "*"}), "HEAD")
+
+	assert.Contains(t, FindFiles(map[string]interface{}{"path": dir, "file_pattern": "[a-"}), "Error: Invalid file pattern")
+	assert.Contains(t, ListFiles(map[string]interface{}{"path": filepath.Join(dir, "missing")}), "Error listing files")
+	assert.Contains(t, FindFiles(map[string]interface{}{"path": filepath.Join(dir, "missing"), "file_pattern": "*"}), "Error finding files")
+	assert.Equal(t, "No matching files found", FindFiles(map[string]interface{}{"path": dir, "file_pattern": "*.rs"}))
+}
+
 // Test ListCodeDefinitionNames function
 func TestListCodeDefinitionNames(t *testing.T) {
 	tempDir, cleanup := setupTestEnv(t)
@@ -362,23 +426,66 @@ func TestFetchWebContent(t *testing.T) {
 
 // Test GitCommit function
 func TestGitCommit(t *testing.T) {
-	// Since GitCommit needs actual git repository and user interaction, we only test parameter validation here
-
-	// Test missing message parameter
+	// Test missing files parameter
 	params := map[string]interface{}{
-		"files": []string{"file1.txt", "file2.txt"},
+		"message": "Test commit message",
 	}
 
 	result := GitCommit(params)
-	assert.Contains(t, result, "Error: message parameter is required")
+	assert.Contains(t, result, "Error: files parameter is required")
 
-	// Test missing files parameter
-	params = map[string]interface{}{
-		"message": "Test commit message",
+	dir := initGitRepo(t, map[string]string{"main.go": "package main\n", "README.md": "# App\n"})
+	t.Chdir(dir)
+	for _, name := range []string{"GIT_AUTHOR_NAME", "GIT_COMMITTER_NAME"} {
+		t.Setenv(name, "Test")
 	}
+	for _, name := range []string{"GIT_AUTHOR_EMAIL", "GIT_COMMITTER_EMAIL"} {
+		t.Setenv(name, "test@example.com")
+	}
+	defer SetApprovalPolicy("")
+	require.NoError(t, SetApprovalPolicy(ApprovalYes))
+
+	// Files without changes are not committed
+	result = GitCommit(map[string]interface{}{"message": "Update", "files": []string{"main.go"}})
+	assert.Equal(t, "Error: No changes to commit, main.go have no changes against the last commit", result)
+
+	// Only the listed files are committed, a missing message is proposed from them
+	require.NoError(t, os.WriteFile("main.go", []byte("package main\n\nfunc main() {}\n"), 0644))
+	require.NoError(t, os.WriteFile("README.md", []byte("# App\n\nUsage\n"), 0644))
+	result = GitCommit(map[string]interface{}{"files": []string{"main.go"}})
+	assert.Equal(t, "Successfully committed changes with message: Update main.go", result)
+	status, err := runGit(".", "status", "--porcelain")
+	require.NoError(t, err)
+	assert.Equal(t, " M README.md\n", status)
+
+	// Amending keeps the message of the last commit without a new one
+	result = GitCommit(map[string]interface{}{"files": []string{"README.md"}, "amend": true})
+	assert.Equal(t, "Successfully amended the last commit with message: Update main.go", result)
+	files, err := runGit(".", "show", "--name-only", "--format=", "HEAD")
+	require.NoError(t, err)
+	assert.Equal(t, "README.md\nmain.go\n", files)
+
+	// staged_only commits the index as it is
+	result = GitCommit(map[string]interface{}{"staged_only": true})
+	assert.Equal(t, "Error: No changes are staged, stage them with git add or list the files to commit", result)
+}
 
-	result = GitCommit(params)
-	assert.Contains(t, result, "Error: files parameter is required")
+func TestGitCommitRestoresIndex(t *testing.T) {
+	dir := initGitRepo(t, map[string]string{"a.txt": "a\n", "b.txt": "b\n"})
+	t.Chdir(dir)
+	require.NoError(t, os.WriteFile("a.txt", []byte("a2\n"), 0644))
+	require.NoError(t, os.WriteFile("b.txt", []byte("b2\n"), 0644))
+	git(dir, "add", "a.txt")
+
+	// Declining the commit leaves the staging area as it was
+	Input = strings.NewReader("n\n")
+	defer func() { Input = userInput{} }()
+	defer SetApprovalPolicy("")
+	require.NoError(t, SetApprovalPolicy(ApprovalAlwaysAsk))
+	assert.Equal(t, "Commit cancelled", GitCommit(map[string]interface{}{"message": "Update", "files": []string{"b.txt"}}))
+	status, err := runGit(".", "status", "--porcelain")
+	require.NoError(t, err)
+	assert.Equal(t, "M  a.txt\n M b.txt\n", status)
 }
 
 // Test FollowupQuestion function
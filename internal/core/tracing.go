@@ -0,0 +1,330 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pederhe/nca/pkg/config"
+	"github.com/pederhe/nca/pkg/log"
+	"github.com/pederhe/nca/pkg/utils"
+)
+
+// Traces of the tasks, with spans of their API requests, tool calls and MCP calls, are exported
+// to an OpenTelemetry collector with OTLP over HTTP (JSON encoding) when otel.endpoint is set:
+//
+//	nca config set otel.endpoint http://localhost:4318
+//	nca config set otel.headers "Authorization=Bearer <token>"
+//
+// Spans are exported in batches in the background, FlushTraces exports the rest before exit.
+
+// SpanKind is the OTLP kind of a span
+type SpanKind int
+
+const (
+	SpanKindInternal SpanKind = 1
+	SpanKindClient   SpanKind = 3
+)
+
+// Limits of the trace exporter
+const (
+	traceBatchSize     = 64
+	traceExportTimeout = 10 * time.Second
+	// Spans kept when the collector can't be reached, older spans are dropped
+	maxPendingSpans = 2048
+)
+
+// Span is a timed operation of a trace
+type Span struct {
+	traceID    string
+	spanID     string
+	parentID   string
+	name       string
+	kind       SpanKind
+	start      time.Time
+	end        time.Time
+	attributes map[string]interface{}
+	err        string
+}
+
+var (
+	// Spans that have started and not ended, the last one is the parent of new spans
+	activeSpans []*Span
+	// Ended spans that haven't been exported yet
+	pendingSpans   []*Span
+	tracingMutex   sync.Mutex
+	traceExports   sync.WaitGroup
+	serviceVersion = "dev"
+	// Whether the user was told that the export failed, which is only reported once
+	traceExportFailed bool
+)
+
+// SetTraceServiceVersion sets the version of NCA reported in the exported traces
+func SetTraceServiceVersion(version string) {
+	serviceVersion = version
+}
+
+// getTraceEndpoint returns the URL the traces are posted to, or "" if tracing is off. The traces
+// have the session's metadata, so the project's config can only set it in trusted workspaces.
+func getTraceEndpoint() string {
+	endpoint := strings.TrimRight(strings.TrimSpace(getTrustedConfig("otel.endpoint")), "/")
+	if endpoint == "" || strings.HasSuffix(endpoint, "/v1/traces") {
+		return endpoint
+	}
+	return endpoint + "/v1/traces"
+}
+
+// IsTracingEnabled returns whether traces are exported
+func IsTracingEnabled() bool {
+	return getTraceEndpoint() != ""
+}
+
+// getTraceHeaders returns the headers of the export requests, set with otel.headers as
+// comma-separated key=value pairs
+func getTraceHeaders() map[string]string {
+	headers := make(map[string]string)
+	for _, pair := range strings.Split(getTrustedConfig("otel.headers"), ",") {
+		key, value, found := strings.Cut(pair, "=")
+		if found && strings.TrimSpace(key) != "" {
+			headers[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+	}
+	return headers
+}
+
+// newTraceID returns a random hex ID of the given number of bytes
+func newTraceID(size int) string {
+	id := make([]byte, size)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// StartSpan starts a span now, see StartSpanAt
+func StartSpan(name string, kind SpanKind, attributes map[string]interface{}) *Span {
+	return StartSpanAt(name, kind, time.Now(), attributes)
+}
+
+// StartSpanAt starts a span at the given time, as a child of the innermost active span or as the
+// root of a new trace. It returns nil if tracing is off, the methods of a nil span do nothing.
+func StartSpanAt(name string, kind SpanKind, start time.Time, attributes map[string]interface{}) *Span {
+	if !IsTracingEnabled() {
+		return nil
+	}
+	span := &Span{
+		spanID:     newTraceID(8),
+		name:       name,
+		kind:       kind,
+		start:      start,
+		attributes: make(map[string]interface{}, len(attributes)),
+	}
+	for key, value := range attributes {
+		span.attributes[key] = value
+	}
+
+	tracingMutex.Lock()
+	defer tracingMutex.Unlock()
+	if len(activeSpans) > 0 {
+		parent := activeSpans[len(activeSpans)-1]
+		span.traceID, span.parentID = parent.traceID, parent.spanID
+	} else {
+		span.traceID = newTraceID(16)
+	}
+	activeSpans = append(activeSpans, span)
+	return span
+}
+
+// SetAttribute sets an attribute of the span
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	tracingMutex.Lock()
+	defer tracingMutex.Unlock()
+	s.attributes[key] = value
+}
+
+// End ends the span, with an error status if errMessage isn't empty. A root span exports the
+// spans of its trace, other spans are exported when a batch is full.
+func (s *Span) End(errMessage string) {
+	if s == nil {
+		return
+	}
+	tracingMutex.Lock()
+	s.end = time.Now()
+	s.err = errMessage
+	for i := len(activeSpans) - 1; i >= 0; i-- {
+		if activeSpans[i] == s {
+			activeSpans = append(activeSpans[:i], activeSpans[i+1:]...)
+			break
+		}
+	}
+	pendingSpans = append(pendingSpans, s)
+	if len(pendingSpans) > maxPendingSpans {
+		pendingSpans = pendingSpans[len(pendingSpans)-maxPendingSpans:]
+	}
+	var batch []*Span
+	if s.parentID == "" || len(pendingSpans) >= traceBatchSize {
+		batch, pendingSpans = pendingSpans, nil
+	}
+	tracingMutex.Unlock()
+
+	if len(batch) > 0 {
+		traceExports.Add(1)
+		go func() {
+			defer traceExports.Done()
+			exportSpans(batch)
+		}()
+	}
+}
+
+// FlushTraces ends the spans that are still active and exports all spans, it waits for the
+// exports that are in progress
+func FlushTraces() {
+	tracingMutex.Lock()
+	active := append([]*Span(nil), activeSpans...)
+	tracingMutex.Unlock()
+	for i := len(active) - 1; i >= 0; i-- {
+		active[i].End("interrupted")
+	}
+
+	traceExports.Wait()
+	tracingMutex.Lock()
+	batch := pendingSpans
+	pendingSpans = nil
+	tracingMutex.Unlock()
+	if len(batch) > 0 {
+		exportSpans(batch)
+	}
+}
+
+// exportSpans posts spans to the collector, failed exports are dropped
+func exportSpans(spans []*Span) {
+	endpoint := getTraceEndpoint()
+	if endpoint == "" {
+		return
+	}
+	data, err := json.Marshal(encodeSpans(spans))
+	if err == nil {
+		err = postTraces(endpoint, data)
+	}
+	if err == nil {
+		return
+	}
+
+	log.LogDebug(fmt.Sprintf("Failed to export %d spans to %s: %s\n", len(spans), endpoint, err))
+	tracingMutex.Lock()
+	report := !traceExportFailed
+	traceExportFailed = true
+	tracingMutex.Unlock()
+	if report {
+		fmt.Println(utils.ColoredText(fmt.Sprintf("Warning: Failed to export traces to %s: %s", endpoint, err), utils.ColorYellow))
+	}
+}
+
+// postTraces sends an OTLP export request
+func postTraces(endpoint string, data []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), traceExportTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range getTraceHeaders() {
+		req.Header.Set(key, value)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("collector responded with %s", resp.Status)
+	}
+	return nil
+}
+
+// encodeSpans returns the body of an OTLP/HTTP JSON export request with the spans
+func encodeSpans(spans []*Span) map[string]interface{} {
+	tracingMutex.Lock()
+	defer tracingMutex.Unlock()
+
+	serviceName := config.Get("otel.service_name")
+	if serviceName == "" {
+		serviceName = "nca"
+	}
+	encoded := make([]map[string]interface{}, 0, len(spans))
+	for _, span := range spans {
+		value := map[string]interface{}{
+			"traceId":           span.traceID,
+			"spanId":            span.spanID,
+			"name":              span.name,
+			"kind":              int(span.kind),
+			"startTimeUnixNano": strconv.FormatInt(span.start.UnixNano(), 10),
+			"endTimeUnixNano":   strconv.FormatInt(span.end.UnixNano(), 10),
+			"attributes":        encodeAttributes(span.attributes),
+		}
+		if span.parentID != "" {
+			value["parentSpanId"] = span.parentID
+		}
+		if span.err != "" {
+			value["status"] = map[string]interface{}{"code": 2, "message": span.err}
+		}
+		encoded = append(encoded, value)
+	}
+
+	return map[string]interface{}{
+		"resourceSpans": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{
+				"attributes": encodeAttributes(map[string]interface{}{
+					"service.name":    serviceName,
+					"service.version": serviceVersion,
+				}),
+			},
+			"scopeSpans": []interface{}{map[string]interface{}{
+				"scope": map[string]interface{}{"name": "nca", "version": serviceVersion},
+				"spans": encoded,
+			}},
+		}},
+	}
+}
+
+// encodeAttributes returns attributes as OTLP key-values, sorted by key
+func encodeAttributes(attributes map[string]interface{}) []map[string]interface{} {
+	keys := make([]string, 0, len(attributes))
+	for key := range attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	encoded := make([]map[string]interface{}, 0, len(keys))
+	for _, key := range keys {
+		var value map[string]interface{}
+		switch v := attributes[key].(type) {
+		case string:
+			value = map[string]interface{}{"stringValue": v}
+		case bool:
+			value = map[string]interface{}{"boolValue": v}
+		case int:
+			// 64-bit integers are strings in OTLP JSON
+			value = map[string]interface{}{"intValue": strconv.Itoa(v)}
+		case int64:
+			value = map[string]interface{}{"intValue": strconv.FormatInt(v, 10)}
+		case float64:
+			value = map[string]interface{}{"doubleValue": v}
+		default:
+			value = map[string]interface{}{"stringValue": fmt.Sprint(v)}
+		}
+		encoded = append(encoded, map[string]interface{}{"key": key, "value": value})
+	}
+	return encoded
+}
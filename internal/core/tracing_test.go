@@ -0,0 +1,105 @@
+package core
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/pederhe/nca/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncodeAttributes(t *testing.T) {
+	encoded := encodeAttributes(map[string]interface{}{
+		"b.count": 3,
+		"a.name":  "nca",
+		"c.cost":  0.25,
+		"d.ok":    true,
+	})
+	data, err := json.Marshal(encoded)
+	require.NoError(t, err)
+	assert.JSONEq(t, `[
+		{"key": "a.name", "value": {"stringValue": "nca"}},
+		{"key": "b.count", "value": {"intValue": "3"}},
+		{"key": "c.cost", "value": {"doubleValue": 0.25}},
+		{"key": "d.ok", "value": {"boolValue": true}}
+	]`, string(data))
+}
+
+func TestTracing(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Chdir(t.TempDir())
+
+	// Without an endpoint spans are nil and do nothing
+	assert.False(t, IsTracingEnabled())
+	span := StartSpan("nca.task", SpanKindInternal, nil)
+	assert.Nil(t, span)
+	span.SetAttribute("key", "value")
+	span.End("")
+
+	var mutex sync.Mutex
+	var requests []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/traces", r.URL.Path)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		body, _ := io.ReadAll(r.Body)
+		var request map[string]interface{}
+		assert.NoError(t, json.Unmarshal(body, &request))
+		mutex.Lock()
+		requests = append(requests, request)
+		mutex.Unlock()
+	}))
+	defer server.Close()
+	require.NoError(t, config.Set("otel.endpoint", server.URL+"/", false))
+	require.NoError(t, config.Set("otel.headers", "Authorization=Bearer secret", false))
+	// The project's config only turns on the export in trusted workspaces
+	assert.False(t, IsTracingEnabled())
+	assert.Empty(t, getTraceHeaders())
+	trustWorkspace(t)
+	assert.Equal(t, server.URL+"/v1/traces", getTraceEndpoint())
+
+	task := StartSpan("nca.task", SpanKindInternal, map[string]interface{}{"nca.mode": "agent"})
+	require.NotNil(t, task)
+	tool := StartSpan("execute_tool use_mcp_tool", SpanKindInternal, nil)
+	call := StartSpan("mcp.call_tool search", SpanKindClient, map[string]interface{}{"mcp.server": "docs"})
+	call.End("server not connected")
+	tool.End("Error calling MCP tool")
+	// Spans are exported when the root span of the trace ends
+	task.End("")
+	FlushTraces()
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	require.Len(t, requests, 1)
+	resourceSpans := requests[0]["resourceSpans"].([]interface{})[0].(map[string]interface{})
+	assert.Contains(t, resourceSpans["resource"].(map[string]interface{})["attributes"],
+		map[string]interface{}{"key": "service.name", "value": map[string]interface{}{"stringValue": "nca"}})
+	spans := resourceSpans["scopeSpans"].([]interface{})[0].(map[string]interface{})["spans"].([]interface{})
+	require.Len(t, spans, 3)
+
+	callSpan, toolSpan, taskSpan := spans[0].(map[string]interface{}), spans[1].(map[string]interface{}), spans[2].(map[string]interface{})
+	assert.Equal(t, "mcp.call_tool search", callSpan["name"])
+	assert.Equal(t, float64(SpanKindClient), callSpan["kind"])
+	assert.Equal(t, map[string]interface{}{"code": float64(2), "message": "server not connected"}, callSpan["status"])
+	assert.Equal(t, toolSpan["spanId"], callSpan["parentSpanId"])
+	assert.Equal(t, taskSpan["spanId"], toolSpan["parentSpanId"])
+	assert.NotContains(t, taskSpan, "parentSpanId")
+	assert.NotContains(t, taskSpan, "status")
+	assert.Len(t, taskSpan["traceId"], 32)
+	assert.Len(t, taskSpan["spanId"], 16)
+	for _, span := range spans {
+		assert.Equal(t, taskSpan["traceId"], span.(map[string]interface{})["traceId"])
+	}
+
+	// A new root span starts a new trace
+	next := StartSpan("nca.task", SpanKindInternal, nil)
+	assert.NotEqual(t, taskSpan["traceId"], next.traceID)
+	assert.Empty(t, next.parentID)
+	next.End("")
+	FlushTraces()
+}
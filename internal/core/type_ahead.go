@@ -0,0 +1,172 @@
+package core
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pederhe/nca/pkg/utils"
+)
+
+// While a task runs in the REPL the lines the user types are read in the background and passed to
+// a handler, which queues them as follow-up prompts. Prompts of tools read their answers from
+// Input, so a line typed while a prompt waits answers it instead of being queued. Stdin is read in
+// non-blocking mode so the reads can be cancelled, before an editor takes the terminal and when
+// the task ends.
+
+// Input is where the prompts of tools read the user's answers
+var Input io.Reader = userInput{}
+
+// typeAheadReader reads the lines typed while a task runs
+type typeAheadReader struct {
+	file    *os.File
+	restore func()
+	handler func(line string)
+	lines   chan string  // Lines for a prompt waiting for input
+	waiting atomic.Int32 // Prompts waiting for input
+	done    chan struct{}
+}
+
+var (
+	typeAhead        *typeAheadReader
+	typeAheadHandler func(line string)
+	typeAheadMutex   sync.Mutex
+	pendingInput     []byte // Rest of a line longer than the buffer of a prompt read
+)
+
+// StartTypeAhead reads the lines typed from now on in the background and passes them to handler,
+// until the returned function is called. It does nothing where stdin can't be read in the
+// background, like on Windows.
+func StartTypeAhead(handler func(line string)) func() {
+	typeAheadMutex.Lock()
+	defer typeAheadMutex.Unlock()
+	typeAheadHandler = handler
+	resumeTypeAhead()
+	return func() {
+		typeAheadMutex.Lock()
+		defer typeAheadMutex.Unlock()
+		suspendTypeAhead()
+		typeAheadHandler = nil
+	}
+}
+
+// resumeTypeAhead starts reading stdin in the background if a handler is set, the caller holds
+// typeAheadMutex
+func resumeTypeAhead() {
+	if typeAheadHandler == nil || typeAhead != nil {
+		return
+	}
+	file, restore, err := openCancelableStdin()
+	if err != nil {
+		return
+	}
+	reader := &typeAheadReader{
+		file:    file,
+		restore: restore,
+		handler: typeAheadHandler,
+		lines:   make(chan string),
+		done:    make(chan struct{}),
+	}
+	typeAhead = reader
+	go reader.run()
+}
+
+// suspendTypeAhead stops reading stdin and restores it for other readers, the caller holds
+// typeAheadMutex
+func suspendTypeAhead() {
+	reader := typeAhead
+	if reader == nil {
+		return
+	}
+	typeAhead = nil
+	reader.file.SetReadDeadline(time.Now())
+	<-reader.done
+	reader.file.Close()
+	reader.restore()
+}
+
+// run passes the lines read to a waiting prompt or to the handler, until the reads are cancelled
+// or stdin is closed
+func (r *typeAheadReader) run() {
+	defer close(r.done)
+	// Lines of a terminal in canonical mode are read whole, a line started when the reads are
+	// cancelled stays in the terminal for the next reader
+	scanner := bufio.NewReader(r.file)
+	for {
+		line, err := scanner.ReadString('\n')
+		if line != "" && err == nil {
+			if r.waiting.Load() > 0 {
+				r.lines <- line
+			} else {
+				r.handler(line)
+			}
+		}
+		if err != nil {
+			if !errors.Is(err, os.ErrDeadlineExceeded) {
+				// At the end of input the prompts read stdin themselves
+				close(r.lines)
+			}
+			return
+		}
+	}
+}
+
+// SuspendTypeAhead stops reading stdin in the background while another program uses the terminal,
+// the returned function resumes it
+func SuspendTypeAhead() func() {
+	typeAheadMutex.Lock()
+	suspendTypeAhead()
+	typeAheadMutex.Unlock()
+	return func() {
+		typeAheadMutex.Lock()
+		defer typeAheadMutex.Unlock()
+		resumeTypeAhead()
+	}
+}
+
+// editTextAs opens text in the user's editor, which reads the terminal while it runs
+func editTextAs(text string, ext string) (string, error) {
+	defer SuspendTypeAhead()()
+	return utils.EditTextAs(text, ext)
+}
+
+// userInput reads the user's input, from the background reader while a task runs and from stdin
+// otherwise. Reads return at most a line, like a terminal, so a prompt doesn't take the answers
+// of the next ones.
+type userInput struct{}
+
+func (userInput) Read(p []byte) (int, error) {
+	typeAheadMutex.Lock()
+	reader := typeAhead
+	if len(pendingInput) > 0 {
+		n := copy(p, pendingInput)
+		pendingInput = pendingInput[n:]
+		typeAheadMutex.Unlock()
+		return n, nil
+	}
+	typeAheadMutex.Unlock()
+
+	if reader == nil {
+		return os.Stdin.Read(p)
+	}
+	reader.waiting.Add(1)
+	defer reader.waiting.Add(-1)
+	select {
+	case line, ok := <-reader.lines:
+		if !ok {
+			return os.Stdin.Read(p)
+		}
+		n := copy(p, line)
+		typeAheadMutex.Lock()
+		pendingInput = append(pendingInput, line[n:]...)
+		typeAheadMutex.Unlock()
+		return n, nil
+	case <-reader.done:
+		// The reads were suspended, a line typed since is read from stdin
+		return os.Stdin.Read(p)
+	}
+}
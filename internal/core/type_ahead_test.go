@@ -0,0 +1,53 @@
+//go:build !windows
+
+package core
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTypeAhead(t *testing.T) {
+	reader, writer, err := os.Pipe()
+	require.NoError(t, err)
+	defer writer.Close()
+	stdin := os.Stdin
+	os.Stdin = reader
+	defer func() { os.Stdin = stdin }()
+
+	queued := make(chan string, 1)
+	stop := StartTypeAhead(func(line string) { queued <- line })
+
+	// Lines typed while no prompt waits go to the handler
+	writer.WriteString("use the other API\n")
+	select {
+	case line := <-queued:
+		assert.Equal(t, "use the other API\n", line)
+	case <-time.After(time.Second):
+		t.Fatal("the line wasn't queued")
+	}
+
+	// A prompt waiting for input gets the next line
+	answer := make(chan string)
+	go func() {
+		var response string
+		fmt.Fscanln(Input, &response)
+		answer <- response
+	}()
+	require.Eventually(t, func() bool { return typeAhead.waiting.Load() > 0 }, time.Second, 5*time.Millisecond)
+	writer.WriteString("y\n")
+	assert.Equal(t, "y", <-answer)
+	assert.Empty(t, queued)
+
+	// Once stopped, stdin is read directly again
+	stop()
+	writer.WriteString("n\n")
+	var response string
+	fmt.Fscanln(Input, &response)
+	assert.Equal(t, "n", response)
+}
@@ -0,0 +1,32 @@
+//go:build !windows
+
+package core
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// openCancelableStdin returns a copy of stdin in non-blocking mode, whose reads can be cancelled
+// with a deadline, and a function restoring the blocking mode other programs expect
+func openCancelableStdin() (*os.File, func(), error) {
+	fd := int(os.Stdin.Fd())
+	dup, err := syscall.Dup(fd)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := syscall.SetNonblock(dup, true); err != nil {
+		syscall.Close(dup)
+		return nil, nil, err
+	}
+	restore := func() { syscall.SetNonblock(fd, false) }
+	file := os.NewFile(uintptr(dup), "stdin")
+	// Terminals that can't be polled don't support deadlines
+	if err := file.SetReadDeadline(time.Time{}); err != nil {
+		file.Close()
+		restore()
+		return nil, nil, err
+	}
+	return file, restore, nil
+}
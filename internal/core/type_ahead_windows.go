@@ -0,0 +1,13 @@
+//go:build windows
+
+package core
+
+import (
+	"errors"
+	"os"
+)
+
+// openCancelableStdin fails, reads of the Windows console can't be cancelled
+func openCancelableStdin() (*os.File, func(), error) {
+	return nil, nil, errors.New("reading the console in the background isn't supported on Windows")
+}
@@ -0,0 +1,238 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Lines of unchanged context around the changes of a unified diff
+const diffContextLines = 3
+
+// Above this amount of state the changed middle of two texts isn't compared line by line, the
+// old lines are all removed and the new ones added instead. It's reached when thousands of lines
+// differ.
+const maxDiffCells = 4_000_000
+
+// diffOp is a line of a diff, kind is ' ' for unchanged, '-' for removed and '+' for added lines.
+// oldLine and newLine are the positions in the texts before the line.
+type diffOp struct {
+	kind    byte
+	line    string
+	oldLine int
+	newLine int
+}
+
+// unifiedDiff returns the unified diff of two texts in the format of diff -u. It returns "" if the
+// texts are equal.
+func unifiedDiff(oldName string, newName string, oldText string, newText string) string {
+	ops := diffLines(splitDiffLines(oldText), splitDiffLines(newText))
+	hunks := diffHunks(ops)
+	if len(hunks) == 0 {
+		return ""
+	}
+
+	var out strings.Builder
+	out.WriteString(fmt.Sprintf("--- %s\n+++ %s\n", oldName, newName))
+	for _, hunk := range hunks {
+		out.WriteString(formatHunk(ops[hunk[0]:hunk[1]]))
+	}
+	return out.String()
+}
+
+// diffHunks returns the start and end of the hunks of a diff in its operations, the changes with
+// their context lines
+func diffHunks(ops []diffOp) [][2]int {
+	var hunks [][2]int
+	for start := 0; start < len(ops); {
+		first := start
+		for first < len(ops) && ops[first].kind == ' ' {
+			first++
+		}
+		if first == len(ops) {
+			break
+		}
+
+		// Changes closer than twice the context share a hunk
+		last := first
+		for {
+			next := last + 1
+			for next < len(ops) && ops[next].kind == ' ' {
+				next++
+			}
+			if next == len(ops) || next-last-1 > 2*diffContextLines {
+				break
+			}
+			last = next
+		}
+		hunkStart := max(first-diffContextLines, start)
+		hunkEnd := min(last+1+diffContextLines, len(ops))
+		hunks = append(hunks, [2]int{hunkStart, hunkEnd})
+		start = hunkEnd
+	}
+	return hunks
+}
+
+// formatHunk returns a hunk of a unified diff with its header
+func formatHunk(ops []diffOp) string {
+	oldCount, newCount := 0, 0
+	for _, op := range ops {
+		if op.kind != '+' {
+			oldCount++
+		}
+		if op.kind != '-' {
+			newCount++
+		}
+	}
+
+	var out strings.Builder
+	out.WriteString(fmt.Sprintf("@@ -%s +%s @@\n", hunkRange(ops[0].oldLine, oldCount), hunkRange(ops[0].newLine, newCount)))
+	for _, op := range ops {
+		out.WriteString(string(op.kind) + op.line + "\n")
+	}
+	return out.String()
+}
+
+// hunkRange formats the start and length of a hunk side like diff, which leaves out a length of 1
+// and gives the line before an empty range
+func hunkRange(start int, count int) string {
+	switch count {
+	case 0:
+		return fmt.Sprintf("%d,0", start)
+	case 1:
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+// splitDiffLines splits a text into lines, a last line without newline is marked like diff does
+func splitDiffLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	lines := strings.Split(text, "\n")
+	if lines[len(lines)-1] == "" {
+		return lines[:len(lines)-1]
+	}
+	lines[len(lines)-1] += "\n\\ No newline at end of file"
+	return lines
+}
+
+// diffLines returns the operations that turn the old lines into the new ones
+func diffLines(oldLines []string, newLines []string) []diffOp {
+	prefix := 0
+	for prefix < len(oldLines) && prefix < len(newLines) && oldLines[prefix] == newLines[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(oldLines)-prefix && suffix < len(newLines)-prefix &&
+		oldLines[len(oldLines)-1-suffix] == newLines[len(newLines)-1-suffix] {
+		suffix++
+	}
+
+	var ops []diffOp
+	for i := 0; i < prefix; i++ {
+		ops = append(ops, diffOp{' ', oldLines[i], i, i})
+	}
+	oldMiddle, newMiddle := oldLines[prefix:len(oldLines)-suffix], newLines[prefix:len(newLines)-suffix]
+	for _, op := range diffMiddle(oldMiddle, newMiddle) {
+		op.oldLine += prefix
+		op.newLine += prefix
+		ops = append(ops, op)
+	}
+	for i := 0; i < suffix; i++ {
+		oldLine, newLine := len(oldLines)-suffix+i, len(newLines)-suffix+i
+		ops = append(ops, diffOp{' ', oldLines[oldLine], oldLine, newLine})
+	}
+	return ops
+}
+
+// diffMiddle compares the changed lines between the common prefix and suffix of two texts with
+// the algorithm of Myers, which finds the fewest removed and added lines
+func diffMiddle(oldLines []string, newLines []string) []diffOp {
+	n, m := len(oldLines), len(newLines)
+	offset := n + m + 1
+	// furthest[k+offset] is the furthest old line reached on diagonal k, where k is old minus new line
+	furthest := make([]int, 2*offset+1)
+	// trace[d] holds the diagonals -d-1 to d+1 of furthest before round d, to find the path back
+	var trace [][]int
+	cells := 0
+
+	for d := 0; d <= n+m; d++ {
+		cells += 2*d + 3
+		if cells > maxDiffCells {
+			return replaceAllLines(oldLines, newLines)
+		}
+		trace = append(trace, append([]int(nil), furthest[offset-d-1:offset+d+2]...))
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && furthest[offset+k-1] < furthest[offset+k+1]) {
+				x = furthest[offset+k+1] // a line added
+			} else {
+				x = furthest[offset+k-1] + 1 // a line removed
+			}
+			y := x - k
+			for x < n && y < m && oldLines[x] == newLines[y] {
+				x++
+				y++
+			}
+			furthest[offset+k] = x
+			if x >= n && y >= m {
+				return backtrackDiff(oldLines, newLines, trace)
+			}
+		}
+	}
+	return replaceAllLines(oldLines, newLines)
+}
+
+// backtrackDiff follows the path of the last round of diffMiddle back to the start and returns
+// its operations
+func backtrackDiff(oldLines []string, newLines []string, trace [][]int) []diffOp {
+	var ops []diffOp
+	x, y := len(oldLines), len(newLines)
+	for d := len(trace) - 1; d > 0; d-- {
+		furthest := func(k int) int { return trace[d][k+d+1] }
+		k := x - y
+		previousK := k - 1
+		if k == -d || (k != d && furthest(k-1) < furthest(k+1)) {
+			previousK = k + 1
+		}
+		previousX := furthest(previousK)
+		previousY := previousX - previousK
+
+		for x > previousX && y > previousY {
+			x--
+			y--
+			ops = append(ops, diffOp{' ', oldLines[x], x, y})
+		}
+		if x == previousX {
+			y--
+			ops = append(ops, diffOp{'+', newLines[y], x, y})
+		} else {
+			x--
+			ops = append(ops, diffOp{'-', oldLines[x], x, y})
+		}
+	}
+	for x > 0 && y > 0 {
+		x--
+		y--
+		ops = append(ops, diffOp{' ', oldLines[x], x, y})
+	}
+
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops
+}
+
+// replaceAllLines removes all old lines and adds all new ones, for texts too different to compare
+func replaceAllLines(oldLines []string, newLines []string) []diffOp {
+	var ops []diffOp
+	for i, line := range oldLines {
+		ops = append(ops, diffOp{'-', line, i, 0})
+	}
+	for j, line := range newLines {
+		ops = append(ops, diffOp{'+', line, len(oldLines), j})
+	}
+	return ops
+}
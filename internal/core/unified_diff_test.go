@@ -0,0 +1,113 @@
+package core
+
+import (
+	"math/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	assert.Equal(t, "", unifiedDiff("a/f", "b/f", "one\ntwo\n", "one\ntwo\n"))
+
+	assert.Equal(t, "--- a/f\n+++ b/f\n@@ -1,3 +1,3 @@\n one\n-two\n+TWO\n three\n",
+		unifiedDiff("a/f", "b/f", "one\ntwo\nthree\n", "one\nTWO\nthree\n"))
+
+	// New and emptied files
+	assert.Equal(t, "--- a/f\n+++ b/f\n@@ -0,0 +1,2 @@\n+one\n+two\n", unifiedDiff("a/f", "b/f", "", "one\ntwo\n"))
+	assert.Equal(t, "--- a/f\n+++ b/f\n@@ -1 +0,0 @@\n-one\n", unifiedDiff("a/f", "b/f", "one\n", ""))
+
+	// A missing newline at the end is a change
+	assert.Equal(t, "--- a/f\n+++ b/f\n@@ -1 +1 @@\n-one\n\\ No newline at end of file\n+one\n",
+		unifiedDiff("a/f", "b/f", "one", "one\n"))
+
+	// Distant changes get their own hunks
+	var lines []string
+	for i := 1; i <= 20; i++ {
+		lines = append(lines, strings.Repeat("x", i))
+	}
+	original := strings.Join(lines, "\n") + "\n"
+	lines[1], lines[17] = "changed", "changed"
+	diff := unifiedDiff("a/f", "b/f", original, strings.Join(lines, "\n")+"\n")
+	assert.Equal(t, 2, strings.Count(diff, "@@ -"))
+	assert.Contains(t, diff, "@@ -1,5 +1,5 @@")
+	assert.Contains(t, diff, "@@ -15,6 +15,6 @@")
+}
+
+func TestDiffLinesRoundTrip(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	randomLines := func() []string {
+		lines := make([]string, random.Intn(30))
+		for i := range lines {
+			lines[i] = string(rune('a' + random.Intn(4)))
+		}
+		return lines
+	}
+
+	for i := 0; i < 200; i++ {
+		oldLines, newLines := randomLines(), randomLines()
+		var rebuiltOld, rebuiltNew []string
+		for _, op := range diffLines(oldLines, newLines) {
+			if op.kind != '+' {
+				assert.Equal(t, len(rebuiltOld), op.oldLine)
+				rebuiltOld = append(rebuiltOld, op.line)
+			}
+			if op.kind != '-' {
+				assert.Equal(t, len(rebuiltNew), op.newLine)
+				rebuiltNew = append(rebuiltNew, op.line)
+			}
+		}
+		assert.Equal(t, strings.Join(oldLines, "\n"), strings.Join(rebuiltOld, "\n"))
+		assert.Equal(t, strings.Join(newLines, "\n"), strings.Join(rebuiltNew, "\n"))
+	}
+}
+
+func TestDiffLinesLargeFile(t *testing.T) {
+	var lines []string
+	for i := 0; i < 50000; i++ {
+		lines = append(lines, strconv.Itoa(i))
+	}
+	changed := append([]string(nil), lines...)
+	changed[100], changed[40000] = "changed", "changed"
+
+	removed, added := 0, 0
+	for _, op := range diffLines(lines, changed) {
+		switch op.kind {
+		case '-':
+			removed++
+		case '+':
+			added++
+		}
+	}
+	assert.Equal(t, 2, removed)
+	assert.Equal(t, 2, added)
+}
+
+func TestUnifiedDiffMatchesDiff(t *testing.T) {
+	if _, err := exec.LookPath("diff"); err != nil {
+		t.Skip("diff is not installed")
+	}
+
+	cases := [][2]string{
+		{"a\nb\nc\nd\ne\nf\ng\nh\ni\nj\n", "a\nB\nc\nd\ne\nf\ng\nh\nI\nj\nk\n"},
+		{"func main() {\n\tfmt.Println(1)\n}\n", "package main\n\nfunc main() {\n\tfmt.Println(2)\n}"},
+		{"one\ntwo\nthree\n", "zero\none\nthree\nfour\n"},
+	}
+	dir := t.TempDir()
+	for _, c := range cases {
+		oldFile, newFile := filepath.Join(dir, "old"), filepath.Join(dir, "new")
+		require.NoError(t, os.WriteFile(oldFile, []byte(c[0]), 0644))
+		require.NoError(t, os.WriteFile(newFile, []byte(c[1]), 0644))
+		output, _ := exec.Command("diff", "-u", oldFile, newFile).Output()
+		// Leave out the headers, they contain the modification times
+		expected := strings.SplitN(string(output), "\n", 3)[2]
+		actual := strings.SplitN(unifiedDiff("old", "new", c[0], c[1]), "\n", 3)[2]
+		assert.Equal(t, expected, actual)
+	}
+}
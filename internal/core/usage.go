@@ -0,0 +1,109 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/pederhe/nca/pkg/api/types"
+)
+
+// SessionUsage is the token usage of the requests made in this session
+type SessionUsage struct {
+	Requests         int
+	PromptTokens     int
+	CompletionTokens int
+	CacheReadTokens  int
+	CacheWriteTokens int
+	// Cost is estimated from the prices of the models, requests of models without prices
+	// are counted in UnpricedRequests instead
+	Cost             float64
+	UnpricedRequests int
+}
+
+var (
+	sessionUsage      SessionUsage
+	sessionUsageMutex sync.Mutex
+)
+
+// RecordUsage adds the usage of a request made with a model to the session usage
+func RecordUsage(modelInfo *types.ModelInfo, usage *types.Usage) {
+	if usage == nil {
+		return
+	}
+	sessionUsageMutex.Lock()
+	defer sessionUsageMutex.Unlock()
+
+	sessionUsage.Requests++
+	sessionUsage.PromptTokens += usage.PromptTokens
+	sessionUsage.CompletionTokens += usage.CompletionTokens
+	sessionUsage.CacheReadTokens += usage.CacheReadTokens
+	sessionUsage.CacheWriteTokens += usage.CacheWriteTokens
+	if cost, ok := RequestCost(modelInfo, usage); ok {
+		sessionUsage.Cost += cost
+	} else {
+		sessionUsage.UnpricedRequests++
+	}
+}
+
+// GetSessionUsage returns the usage of the requests made in this session
+func GetSessionUsage() SessionUsage {
+	sessionUsageMutex.Lock()
+	defer sessionUsageMutex.Unlock()
+	return sessionUsage
+}
+
+// ResetSessionUsage clears the session usage
+func ResetSessionUsage() {
+	sessionUsageMutex.Lock()
+	defer sessionUsageMutex.Unlock()
+	sessionUsage = SessionUsage{}
+}
+
+// RequestCost estimates the cost of a request from the prices per million tokens of its model,
+// false if the model has no prices. Prompt tokens read from or written to the cache have their
+// own prices.
+func RequestCost(modelInfo *types.ModelInfo, usage *types.Usage) (float64, bool) {
+	if modelInfo == nil || usage == nil || modelInfo.InputPrice == nil || modelInfo.OutputPrice == nil {
+		return 0, false
+	}
+	price := func(p *float64, fallback float64) float64 {
+		if p == nil {
+			return fallback
+		}
+		return *p
+	}
+
+	uncachedTokens := usage.PromptTokens - usage.CacheReadTokens - usage.CacheWriteTokens
+	if uncachedTokens < 0 {
+		uncachedTokens = 0
+	}
+	cost := float64(uncachedTokens)*(*modelInfo.InputPrice) +
+		float64(usage.CacheReadTokens)*price(modelInfo.CacheReadsPrice, *modelInfo.InputPrice) +
+		float64(usage.CacheWriteTokens)*price(modelInfo.CacheWritesPrice, *modelInfo.InputPrice) +
+		float64(usage.CompletionTokens)*(*modelInfo.OutputPrice)
+	return cost / 1_000_000, true
+}
+
+// FormatSessionUsage formats the session usage for the /cost command
+func FormatSessionUsage(usage SessionUsage) string {
+	if usage.Requests == 0 {
+		return "No requests have been made in this session"
+	}
+
+	var result strings.Builder
+	result.WriteString(fmt.Sprintf("Requests:          %d\n", usage.Requests))
+	result.WriteString(fmt.Sprintf("Prompt tokens:     %d\n", usage.PromptTokens))
+	result.WriteString(fmt.Sprintf("  Cache hits:      %d", usage.CacheReadTokens))
+	if usage.PromptTokens > 0 {
+		result.WriteString(fmt.Sprintf(" (%.1f%%)", float64(usage.CacheReadTokens)*100/float64(usage.PromptTokens)))
+	}
+	result.WriteString("\n")
+	result.WriteString(fmt.Sprintf("  Cache writes:    %d\n", usage.CacheWriteTokens))
+	result.WriteString(fmt.Sprintf("Completion tokens: %d\n", usage.CompletionTokens))
+	result.WriteString(fmt.Sprintf("Estimated cost:    $%.4f", usage.Cost))
+	if usage.UnpricedRequests > 0 {
+		result.WriteString(fmt.Sprintf(" (without %d requests of models with unknown prices)", usage.UnpricedRequests))
+	}
+	return result.String()
+}
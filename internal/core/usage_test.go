@@ -0,0 +1,78 @@
+package core
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/pederhe/nca/pkg/api/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUsageCacheTokens(t *testing.T) {
+	// DeepSeek reports the cache hits and misses of the prompt
+	var usage types.Usage
+	require.NoError(t, json.Unmarshal([]byte(`{"prompt_tokens":1000,"completion_tokens":50,"total_tokens":1050,"prompt_cache_hit_tokens":800,"prompt_cache_miss_tokens":200}`), &usage))
+	assert.Equal(t, types.Usage{PromptTokens: 1000, CompletionTokens: 50, TotalTokens: 1050, CacheReadTokens: 800, CacheWriteTokens: 200}, usage)
+
+	// OpenAI reports the cached tokens in the details of the prompt
+	usage = types.Usage{}
+	require.NoError(t, json.Unmarshal([]byte(`{"prompt_tokens":1000,"completion_tokens":50,"total_tokens":1050,"prompt_tokens_details":{"cached_tokens":512}}`), &usage))
+	assert.Equal(t, types.Usage{PromptTokens: 1000, CompletionTokens: 50, TotalTokens: 1050, CacheReadTokens: 512}, usage)
+
+	usage = types.Usage{}
+	require.NoError(t, json.Unmarshal([]byte(`{"prompt_tokens":10,"completion_tokens":5,"total_tokens":15}`), &usage))
+	assert.Equal(t, types.Usage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15}, usage)
+}
+
+func TestRequestCost(t *testing.T) {
+	price := func(p float64) *float64 { return &p }
+	model := &types.ModelInfo{
+		InputPrice:       price(3.0),
+		OutputPrice:      price(15.0),
+		CacheWritesPrice: price(3.75),
+		CacheReadsPrice:  price(0.3),
+	}
+
+	cost, ok := RequestCost(model, &types.Usage{PromptTokens: 1_000_000, CompletionTokens: 100_000})
+	require.True(t, ok)
+	assert.InDelta(t, 4.5, cost, 1e-9)
+
+	// Cached prompt tokens have the cache prices
+	cost, ok = RequestCost(model, &types.Usage{PromptTokens: 1_000_000, CacheReadTokens: 600_000, CacheWriteTokens: 200_000})
+	require.True(t, ok)
+	assert.InDelta(t, 0.6+0.18+0.75, cost, 1e-9)
+
+	_, ok = RequestCost(&types.ModelInfo{}, &types.Usage{PromptTokens: 10})
+	assert.False(t, ok)
+	_, ok = RequestCost(nil, &types.Usage{PromptTokens: 10})
+	assert.False(t, ok)
+}
+
+func TestSessionUsage(t *testing.T) {
+	ResetSessionUsage()
+	defer ResetSessionUsage()
+	assert.Equal(t, "No requests have been made in this session", FormatSessionUsage(GetSessionUsage()))
+
+	price := func(p float64) *float64 { return &p }
+	model := &types.ModelInfo{InputPrice: price(0.0), OutputPrice: price(1.1), CacheWritesPrice: price(0.27), CacheReadsPrice: price(0.07)}
+	RecordUsage(model, &types.Usage{PromptTokens: 1000, CompletionTokens: 100, CacheReadTokens: 0, CacheWriteTokens: 1000})
+	RecordUsage(model, &types.Usage{PromptTokens: 1200, CompletionTokens: 100, CacheReadTokens: 1000, CacheWriteTokens: 200})
+	RecordUsage(nil, &types.Usage{PromptTokens: 500, CompletionTokens: 10})
+	RecordUsage(model, nil)
+
+	usage := GetSessionUsage()
+	assert.Equal(t, 3, usage.Requests)
+	assert.Equal(t, 2700, usage.PromptTokens)
+	assert.Equal(t, 210, usage.CompletionTokens)
+	assert.Equal(t, 1000, usage.CacheReadTokens)
+	assert.Equal(t, 1200, usage.CacheWriteTokens)
+	assert.Equal(t, 1, usage.UnpricedRequests)
+	assert.InDelta(t, (1200*0.27+1000*0.07+200*1.1)/1_000_000, usage.Cost, 1e-12)
+
+	formatted := FormatSessionUsage(usage)
+	assert.Contains(t, formatted, "Prompt tokens:     2700")
+	assert.Contains(t, formatted, "Cache hits:      1000 (37.0%)")
+	assert.Contains(t, formatted, "Cache writes:    1200")
+	assert.Contains(t, formatted, "without 1 requests of models with unknown prices")
+}
@@ -0,0 +1,176 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pederhe/nca/pkg/config"
+	"github.com/pederhe/nca/pkg/utils"
+)
+
+// Limits of the verify_build tool
+const (
+	defaultBuildTimeout = 5 * time.Minute
+	maxBuildErrors      = 50
+	// Lines of output returned when a failed build reports no errors in a known format
+	buildOutputTailLines = 30
+)
+
+// buildCheck is the command that checks a kind of project and the lines of its output that are errors
+type buildCheck struct {
+	marker  string // The file that marks the root of the project
+	command string
+	errors  *regexp.Regexp
+}
+
+// The checks in the order they are detected, the first marker found in a directory wins
+var buildChecks = []buildCheck{
+	// main.go:12:2: undefined: foo, or module errors such as "go: updates to go.mod needed"
+	{"go.mod", "go build ./...", regexp.MustCompile(`^(\S+\.go:\d+(:\d+)?: |go: )`)},
+	// src/main.rs:2:5: error[E0425]: cannot find value `x` in this scope
+	{"Cargo.toml", "cargo check --message-format short", regexp.MustCompile(`^\S+:\d+:\d+: error(\[\w+\])?: `)},
+	// src/app.ts(3,7): error TS2322: Type 'string' is not assignable to type 'number'.
+	{"tsconfig.json", "npx tsc --noEmit --pretty false", regexp.MustCompile(`error TS\d+: `)},
+}
+
+// detectBuildCheck finds the check of the project containing dir, looking in dir and its parents.
+// The directory returned is the root of the project, where the command runs.
+func detectBuildCheck(dir string) (buildCheck, string, bool) {
+	for {
+		for _, check := range buildChecks {
+			if _, err := os.Stat(filepath.Join(dir, check.marker)); err == nil {
+				return check, dir, true
+			}
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return buildCheck{}, "", false
+		}
+		dir = parent
+	}
+}
+
+// getBuildTimeout returns the maximum run time of the build, configurable with verify_build.timeout in seconds
+func getBuildTimeout() time.Duration {
+	if value := config.Get("verify_build.timeout"); value != "" {
+		if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+			return time.Duration(seconds) * time.Second
+		}
+	}
+	return defaultBuildTimeout
+}
+
+// findBuildCheck returns the check verify_build runs for a call and the directory it runs in, or
+// the result for the model if there is none. configured is true for the verify_build.command of
+// the config, which is only read from the project's config in trusted workspaces.
+func findBuildCheck(params map[string]interface{}) (check buildCheck, root string, configured bool, errResult string) {
+	dir, _ := params["path"].(string)
+	if dir == "" {
+		dir = GetWorkingDir()
+	}
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return buildCheck{}, "", false, fmt.Sprintf("Error: Invalid path %s: %s", dir, err)
+	}
+	if info, err := os.Stat(absDir); err != nil || !info.IsDir() {
+		return buildCheck{}, "", false, fmt.Sprintf("Error: %s is not a directory", dir)
+	}
+
+	if command := strings.TrimSpace(getTrustedConfig("verify_build.command")); command != "" {
+		// A configured command runs in the given directory, its errors can't be told apart
+		return buildCheck{command: command}, absDir, true, ""
+	}
+	check, root, found := detectBuildCheck(absDir)
+	if !found {
+		return buildCheck{}, "", false, "Error: No supported project found (go.mod, Cargo.toml or tsconfig.json). Set the command with `nca config set verify_build.command <command>`, or build the project with execute_command."
+	}
+	return check, root, false, ""
+}
+
+// VerifyBuild handles the verify_build tool. It runs the build check of the project and returns
+// only the errors it reports, so broken code is found right after an edit.
+func VerifyBuild(params map[string]interface{}) string {
+	result, _ := VerifyBuildWithApproval(params)
+	return result
+}
+
+// VerifyBuildWithApproval handles the verify_build tool and returns how the build command was
+// approved for the audit log. A configured command can be anything, so it goes through the
+// command policy and approval of execute_command, the detected ones don't need approval.
+func VerifyBuildWithApproval(params map[string]interface{}) (string, string) {
+	check, root, configured, errResult := findBuildCheck(params)
+	if errResult != "" {
+		return errResult, ""
+	}
+	approval, blocked := approveCommandRun(check.command, configured)
+	if blocked != "" {
+		return blocked, approval
+	}
+	return runBuildCheck(check, root), approval
+}
+
+// runBuildCheck runs the command of a build check in root and returns its errors
+func runBuildCheck(check buildCheck, root string) string {
+	timeout := getBuildTimeout()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	args := utils.ShellCommand(check.command)
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Dir = root
+	cmd.Env = GetCommandEnv()
+	cmd.WaitDelay = 2 * time.Second
+	output, err := cmd.CombinedOutput()
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Sprintf("Error: `%s` timed out after %s", check.command, timeout)
+	}
+
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		return fmt.Sprintf("Error: Failed to run `%s`: %s", check.command, err)
+	}
+	if err == nil {
+		return fmt.Sprintf("Build succeeded: `%s` in %s reported no errors", check.command, toPosix(root))
+	}
+	return formatBuildErrors(check, root, MaskSecrets(string(output)))
+}
+
+// formatBuildErrors returns the result of a failed build with only the error lines of its output,
+// or the end of the output if no lines look like errors
+func formatBuildErrors(check buildCheck, root string, output string) string {
+	var errorLines []string
+	seen := make(map[string]bool)
+	if check.errors != nil {
+		for _, line := range strings.Split(strings.ReplaceAll(output, "\r\n", "\n"), "\n") {
+			line = strings.TrimRight(line, " \t")
+			if check.errors.MatchString(line) && !seen[line] {
+				seen[line] = true
+				errorLines = append(errorLines, line)
+			}
+		}
+	}
+
+	if len(errorLines) == 0 {
+		lines := strings.Split(strings.TrimSpace(output), "\n")
+		if len(lines) > buildOutputTailLines {
+			lines = append([]string{"..."}, lines[len(lines)-buildOutputTailLines:]...)
+		}
+		return fmt.Sprintf("Build failed: `%s` in %s failed with this output:\n%s", check.command, toPosix(root), strings.Join(lines, "\n"))
+	}
+
+	result := fmt.Sprintf("Build failed: `%s` in %s reported %d error(s):\n", check.command, toPosix(root), len(errorLines))
+	if len(errorLines) > maxBuildErrors {
+		result += strings.Join(errorLines[:maxBuildErrors], "\n")
+		result += fmt.Sprintf("\n... and %d more errors, fix these first", len(errorLines)-maxBuildErrors)
+	} else {
+		result += strings.Join(errorLines, "\n")
+	}
+	return result
+}
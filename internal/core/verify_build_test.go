@@ -0,0 +1,103 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pederhe/nca/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetectBuildCheck(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "cmd", "app"), 0755))
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "web", "src"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "go.mod"), []byte("module example\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "web", "tsconfig.json"), []byte("{}"), 0644))
+
+	check, dir, found := detectBuildCheck(filepath.Join(root, "cmd", "app"))
+	require.True(t, found)
+	assert.Equal(t, "go build ./...", check.command)
+	assert.Equal(t, root, dir)
+
+	// The closest project wins
+	check, dir, found = detectBuildCheck(filepath.Join(root, "web", "src"))
+	require.True(t, found)
+	assert.Equal(t, "npx tsc --noEmit --pretty false", check.command)
+	assert.Equal(t, filepath.Join(root, "web"), dir)
+}
+
+func TestFormatBuildErrors(t *testing.T) {
+	goOutput := "# example/cmd/app\ncmd/app/main.go:12:2: undefined: foo\ncmd/app/main.go:14:9: cannot use x (variable of type int) as string value in return statement\n"
+	result := formatBuildErrors(buildChecks[0], "/src/example", goOutput)
+	assert.Equal(t, "Build failed: `go build ./...` in /src/example reported 2 error(s):\n"+
+		"cmd/app/main.go:12:2: undefined: foo\n"+
+		"cmd/app/main.go:14:9: cannot use x (variable of type int) as string value in return statement", result)
+
+	// Warnings and the summary of cargo are left out
+	cargoOutput := "    Checking app v0.1.0 (/src/app)\nsrc/lib.rs:3:9: warning: unused variable: `y`\nsrc/main.rs:2:5: error[E0425]: cannot find value `x` in this scope\nerror: could not compile `app` (bin \"app\") due to 1 previous error\n"
+	result = formatBuildErrors(buildChecks[1], "/src/app", cargoOutput)
+	assert.Equal(t, "Build failed: `cargo check --message-format short` in /src/app reported 1 error(s):\nsrc/main.rs:2:5: error[E0425]: cannot find value `x` in this scope", result)
+
+	tscOutput := "src/app.ts(3,7): error TS2322: Type 'string' is not assignable to type 'number'.\r\nsrc/app.ts(3,7): error TS2322: Type 'string' is not assignable to type 'number'.\r\n"
+	result = formatBuildErrors(buildChecks[2], "/src/web", tscOutput)
+	assert.Equal(t, "Build failed: `npx tsc --noEmit --pretty false` in /src/web reported 1 error(s):\nsrc/app.ts(3,7): error TS2322: Type 'string' is not assignable to type 'number'.", result)
+
+	// Output without known errors is returned from its end
+	var lines []string
+	for i := 1; i <= 40; i++ {
+		lines = append(lines, "line")
+	}
+	result = formatBuildErrors(buildChecks[0], "/src/example", strings.Join(lines, "\n"))
+	assert.True(t, strings.HasPrefix(result, "Build failed: `go build ./...` in /src/example failed with this output:\n...\nline\n"))
+	assert.Len(t, strings.Split(result, "\n"), buildOutputTailLines+2)
+
+	// Many errors are cut off
+	lines = nil
+	for i := 1; i <= maxBuildErrors+5; i++ {
+		lines = append(lines, "main.go:"+strings.Repeat("1", i)+": error")
+	}
+	result = formatBuildErrors(buildChecks[0], "/src/example", strings.Join(lines, "\n"))
+	assert.Contains(t, result, "reported 55 error(s)")
+	assert.True(t, strings.HasSuffix(result, "\n... and 5 more errors, fix these first"))
+}
+
+func TestVerifyBuild(t *testing.T) {
+	t.Chdir(t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	assert.Contains(t, VerifyBuild(map[string]interface{}{}), "Error: No supported project found")
+	assert.Contains(t, VerifyBuild(map[string]interface{}{"path": "missing"}), "Error: missing is not a directory")
+
+	require.NoError(t, os.WriteFile("go.mod", []byte("module example\n\ngo 1.21\n"), 0644))
+	require.NoError(t, os.WriteFile("main.go", []byte("package main\n\nfunc main() {\n\tundefinedFunction()\n}\n"), 0644))
+	result := VerifyBuild(map[string]interface{}{})
+	assert.Contains(t, result, "Build failed: `go build ./...`")
+	assert.Contains(t, result, "main.go:4:2: undefined: undefinedFunction")
+	assert.NotContains(t, result, "# example")
+
+	require.NoError(t, os.WriteFile("main.go", []byte("package main\n\nfunc main() {}\n"), 0644))
+	assert.Contains(t, VerifyBuild(map[string]interface{}{"path": "."}), "Build succeeded: `go build ./...`")
+
+	// The command of an untrusted project's config is ignored
+	require.NoError(t, config.Set("verify_build.command", "echo broken && exit 1", false))
+	assert.Contains(t, VerifyBuild(map[string]interface{}{}), "Build succeeded: `go build ./...`")
+	trustWorkspace(t)
+
+	// A configured command replaces the detected one, it needs approval like execute_command
+	result, approval := VerifyBuildWithApproval(map[string]interface{}{})
+	assert.Contains(t, result, "blocked by the approval policy")
+	assert.Equal(t, AuditBlocked, approval)
+	SetSessionAutoApprove(true)
+	defer ClearSessionAutoApprove()
+	result, approval = VerifyBuildWithApproval(map[string]interface{}{})
+	assert.True(t, strings.HasPrefix(result, "Build failed: `echo broken && exit 1` in "), result)
+	assert.True(t, strings.HasSuffix(result, " failed with this output:\nbroken"), result)
+	assert.Equal(t, "auto_approved", approval)
+
+	// The denylist applies to it with auto-approve too
+	require.NoError(t, config.Set("verify_build.command", "rm -rf /", false))
+	assert.Contains(t, VerifyBuild(map[string]interface{}{}), "Error: Command blocked by the command denylist")
+}
@@ -0,0 +1,136 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/pederhe/nca/pkg/utils"
+)
+
+// The working directory of the model. A "cd" in an executed command changes it for later
+// commands and relative paths of the file tools, the directory of the nca process itself
+// (and so .nca of the workspace) stays the same.
+var (
+	workingDir      string
+	workingDirMutex sync.Mutex
+)
+
+// Commands that change the directory of the shell
+var changeDirRegex = regexp.MustCompile(`(^|[;&|(\n]\s*)(cd|pushd|popd)(\s|$|;|&|\|)`)
+
+// trackWorkingDir extends a command line so a shell of the kind writes its directory to the file
+// in NCA_CWD_FILE when the command finished. With cmd a failing command exits with 1 instead of
+// its own exit code.
+func trackWorkingDir(kind string, command string) string {
+	switch kind {
+	case utils.ShellKindPowerShell:
+		return command + "\n$ncaSucceeded = $?\n(Get-Location).Path | Set-Content -LiteralPath $env:NCA_CWD_FILE\nif (-not $ncaSucceeded) { exit 1 }"
+	case utils.ShellKindCmd:
+		return "(" + command + `) && (cd > "%NCA_CWD_FILE%") || (cd > "%NCA_CWD_FILE%" & exit /b 1)`
+	}
+	return "trap 'pwd > \"$NCA_CWD_FILE\"' EXIT\n" + command
+}
+
+// GetWorkingDir returns the absolute working directory of executed commands
+func GetWorkingDir() string {
+	workingDirMutex.Lock()
+	defer workingDirMutex.Unlock()
+	if workingDir != "" {
+		return workingDir
+	}
+	cwd, _ := os.Getwd()
+	return cwd
+}
+
+// setWorkingDir changes the working directory, a directory that doesn't exist is ignored
+func setWorkingDir(dir string) {
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return
+	}
+	workingDirMutex.Lock()
+	defer workingDirMutex.Unlock()
+	if cwd, err := os.Getwd(); err == nil && cwd == dir {
+		workingDir = ""
+		return
+	}
+	workingDir = dir
+}
+
+// ResetWorkingDir changes the working directory back to the directory nca was started in
+func ResetWorkingDir() {
+	workingDirMutex.Lock()
+	defer workingDirMutex.Unlock()
+	workingDir = ""
+}
+
+// IsWorkingDirChanged returns whether a command changed the working directory
+func IsWorkingDirChanged() bool {
+	workingDirMutex.Lock()
+	defer workingDirMutex.Unlock()
+	return workingDir != ""
+}
+
+// ResolvePath resolves a path relative to the working directory. Paths inside the
+// directory nca was started in are returned relative to it, so checkpoints and
+// workspace checks keep working.
+func ResolvePath(path string) string {
+	workingDirMutex.Lock()
+	dir := workingDir
+	workingDirMutex.Unlock()
+	if dir == "" || path == "" || filepath.IsAbs(path) || strings.HasPrefix(path, "~") {
+		return path
+	}
+
+	resolved := filepath.Join(dir, path)
+	if cwd, err := os.Getwd(); err == nil {
+		if rel, err := filepath.Rel(cwd, resolved); err == nil && !strings.HasPrefix(rel, "..") {
+			return rel
+		}
+	}
+	return resolved
+}
+
+// ResolveToolPaths resolves the path parameters of a tool call against the working directory
+func ResolveToolPaths(params map[string]interface{}) {
+	if path, ok := params["path"].(string); ok {
+		params["path"] = ResolvePath(path)
+	}
+
+	switch paths := params["paths"].(type) {
+	case []string:
+		for i, path := range paths {
+			paths[i] = resolvePathWithRange(strings.TrimSpace(path))
+		}
+	case string:
+		lines := strings.Split(paths, "\n")
+		for i, line := range lines {
+			lines[i] = resolvePathWithRange(strings.TrimSpace(line))
+		}
+		params["paths"] = strings.Join(lines, "\n")
+	}
+
+	switch files := params["files"].(type) {
+	case []string:
+		for i, file := range files {
+			files[i] = ResolvePath(file)
+		}
+	case []FileWrite:
+		for i := range files {
+			files[i].Path = ResolvePath(files[i].Path)
+		}
+	}
+}
+
+// resolvePathWithRange resolves a read_files entry, which may end with a line range
+func resolvePathWithRange(entry string) string {
+	if entry == "" {
+		return entry
+	}
+	if match := pathRangeRegex.FindStringSubmatch(entry); match != nil {
+		return ResolvePath(match[1]) + ":" + match[2]
+	}
+	return ResolvePath(entry)
+}
@@ -0,0 +1,70 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pederhe/nca/pkg/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWorkingDirTracking(t *testing.T) {
+	tmpDir := t.TempDir()
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(originalDir)
+	os.Chdir(tmpDir)
+	defer ResetWorkingDir()
+
+	assert.NoError(t, os.MkdirAll(filepath.Join("sub", "dir"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join("sub", "dir", "file.txt"), []byte("content"), 0644))
+	cwd, _ := os.Getwd()
+
+	// Plain commands don't change the directory
+	ExecuteCommand(map[string]interface{}{"command": "ls"})
+	assert.False(t, IsWorkingDirChanged())
+
+	// A cd applies to later commands
+	result := ExecuteCommand(map[string]interface{}{"command": "cd sub && pwd"})
+	assert.Contains(t, result, "[Exit code: 0]")
+	assert.True(t, IsWorkingDirChanged())
+	assert.Equal(t, filepath.Join(cwd, "sub"), GetWorkingDir())
+
+	result = ExecuteCommand(map[string]interface{}{"command": "cat dir/file.txt"})
+	assert.Equal(t, "content\n[Exit code: 0]", result)
+
+	// Relative paths of file tools are resolved against it
+	params := map[string]interface{}{
+		"path":  "dir/file.txt",
+		"paths": "dir/file.txt:1-1\n/etc/hosts",
+		"files": []string{"dir/file.txt"},
+	}
+	ResolveToolPaths(params)
+	assert.Equal(t, filepath.Join("sub", "dir", "file.txt"), params["path"])
+	assert.Equal(t, filepath.Join("sub", "dir", "file.txt")+":1-1\n/etc/hosts", params["paths"])
+	assert.Equal(t, []string{filepath.Join("sub", "dir", "file.txt")}, params["files"])
+	assert.Equal(t, "content", ReadFile(map[string]interface{}{"path": params["path"]}))
+
+	// Paths outside the start directory stay absolute
+	ExecuteCommand(map[string]interface{}{"command": "cd ../.."})
+	assert.Equal(t, filepath.Join(filepath.Dir(cwd), "x"), ResolvePath("x"))
+
+	// Changing back to the start directory clears the tracked directory
+	ExecuteCommand(map[string]interface{}{"command": "cd " + cwd})
+	assert.False(t, IsWorkingDirChanged())
+	assert.Equal(t, "x", ResolvePath("x"))
+
+	// A failed cd keeps the directory
+	ExecuteCommand(map[string]interface{}{"command": "cd missing"})
+	assert.False(t, IsWorkingDirChanged())
+}
+
+func TestTrackWorkingDir(t *testing.T) {
+	assert.Equal(t, "trap 'pwd > \"$NCA_CWD_FILE\"' EXIT\ncd src", trackWorkingDir(utils.ShellKindPOSIX, "cd src"))
+	assert.Equal(t, `(cd src && dir) && (cd > "%NCA_CWD_FILE%") || (cd > "%NCA_CWD_FILE%" & exit /b 1)`,
+		trackWorkingDir(utils.ShellKindCmd, "cd src && dir"))
+	assert.Contains(t, trackWorkingDir(utils.ShellKindPowerShell, "cd src"), "cd src\n$ncaSucceeded = $?\n")
+}
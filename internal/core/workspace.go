@@ -0,0 +1,231 @@
+package core
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Files and directories that mark the root of a project, .git may also be a file in a worktree
+var projectRootMarkers = []string{".git", "go.mod", "package.json"}
+
+// Directories left out of the workspace file map, they are large and rarely edited
+var workspaceMapSkipDirs = map[string]bool{
+	"node_modules": true,
+	"vendor":       true,
+	"dist":         true,
+	"build":        true,
+	"target":       true,
+	"__pycache__":  true,
+}
+
+// Limits of the workspace file map in the environment details
+const (
+	workspaceMapDepth      = 2
+	maxWorkspaceMapEntries = 200
+)
+
+// The roots given with --workspace, the detected project root is used when there are none
+var (
+	workspaceRoots []string
+	workspaceMutex sync.Mutex
+)
+
+// DetectProjectRoot returns the closest directory at or above dir that contains a .git, go.mod or
+// package.json, or dir if there is none. The search stops below the home directory, so a
+// repository of dotfiles in it doesn't make everything a project.
+func DetectProjectRoot(dir string) string {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return dir
+	}
+	home, _ := os.UserHomeDir()
+
+	for current := dir; ; current = filepath.Dir(current) {
+		if current == home && current != dir {
+			break
+		}
+		for _, marker := range projectRootMarkers {
+			if _, err := os.Stat(filepath.Join(current, marker)); err == nil {
+				return current
+			}
+		}
+		if filepath.Dir(current) == current {
+			break
+		}
+	}
+	return dir
+}
+
+// SetWorkspaceRoots sets the directories the file tools work in, instead of the detected project
+// root. An empty list goes back to the detected root.
+func SetWorkspaceRoots(dirs []string) error {
+	var roots []string
+	seen := map[string]bool{}
+	for _, dir := range dirs {
+		absDir, err := filepath.Abs(dir)
+		if err != nil {
+			return err
+		}
+		if info, err := os.Stat(absDir); err != nil || !info.IsDir() {
+			return fmt.Errorf("workspace '%s' is not a directory", dir)
+		}
+		if !seen[absDir] {
+			seen[absDir] = true
+			roots = append(roots, absDir)
+		}
+	}
+
+	workspaceMutex.Lock()
+	defer workspaceMutex.Unlock()
+	workspaceRoots = roots
+	return nil
+}
+
+// GetWorkspaceRoots returns the absolute roots of the workspace
+func GetWorkspaceRoots() []string {
+	workspaceMutex.Lock()
+	roots := append([]string(nil), workspaceRoots...)
+	workspaceMutex.Unlock()
+	if len(roots) > 0 {
+		return roots
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil
+	}
+	return []string{DetectProjectRoot(cwd)}
+}
+
+// isWorkspaceRestricted returns whether the file tools are limited to the workspace, which can be
+// turned off with the workspace.restrict_files config. The project's config and env files only
+// turn it off in trusted workspaces, an untrusted project could lift its own sandbox.
+func isWorkspaceRestricted() bool {
+	return getTrustedConfig("workspace.restrict_files") != "false"
+}
+
+// IsInWorkspace returns whether a path is inside one of the workspace roots or the scratch directory
+func IsInWorkspace(path string) bool {
+	if strings.HasPrefix(path, "~") {
+		if home, err := os.UserHomeDir(); err == nil {
+			path = filepath.Join(home, strings.TrimPrefix(path, "~"))
+		}
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+
+	dirs := GetWorkspaceRoots()
+	if scratch, err := filepath.Abs(scratchRoot); err == nil {
+		dirs = append(dirs, scratch)
+	}
+	for _, dir := range dirs {
+		if isPathInside(absPath, dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckWorkspacePaths returns an error result if a file tool call uses a path outside the
+// workspace, or "" if the call may run. Commands aren't checked, they may cd anywhere.
+func CheckWorkspacePaths(toolName string, params map[string]interface{}) string {
+	if !isWorkspaceRestricted() {
+		return ""
+	}
+
+	for _, path := range workspaceToolPaths(toolName, params) {
+		if path != "" && !IsInWorkspace(path) {
+			return fmt.Sprintf("Error: '%s' is outside the workspace (%s). File tools only work inside the workspace, ask the user to start nca with --workspace for other directories.",
+				path, strings.Join(GetWorkspaceRoots(), ", "))
+		}
+	}
+	return ""
+}
+
+// workspaceToolPaths returns the paths a file tool call reads or writes
+func workspaceToolPaths(toolName string, params map[string]interface{}) []string {
+	switch toolName {
+	case "read_file", "write_to_file", "replace_in_file", "search_files", "find_files", "list_files",
+		"list_code_definition_names", "download_file", "verify_build", "git_stage_hunks", "get_file_diff":
+		path, _ := params["path"].(string)
+		return []string{path}
+	case "read_files":
+		var paths []string
+		var entries []string
+		switch value := params["paths"].(type) {
+		case []string:
+			entries = value
+		case string:
+			entries = strings.Split(value, "\n")
+		}
+		for _, entry := range entries {
+			entry = strings.TrimSpace(entry)
+			if match := pathRangeRegex.FindStringSubmatch(entry); match != nil {
+				entry = match[1]
+			}
+			paths = append(paths, entry)
+		}
+		return paths
+	case "write_files":
+		files, _ := params["files"].([]FileWrite)
+		var paths []string
+		for _, file := range files {
+			paths = append(paths, file.Path)
+		}
+		return paths
+	case "apply_patch":
+		patch, _ := params["patch"].(string)
+		return PatchFiles(patch)
+	}
+	return nil
+}
+
+// BuildWorkspaceMap lists the directories and files of the workspace roots up to two levels deep,
+// leaving out hidden files and dependency or build output directories
+func BuildWorkspaceMap() string {
+	var workspaceMap strings.Builder
+	entries := 0
+	for _, root := range GetWorkspaceRoots() {
+		var paths []string
+		filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil || path == root {
+				return nil
+			}
+			rel, _ := filepath.Rel(root, path)
+			if strings.HasPrefix(entry.Name(), ".") || (entry.IsDir() && workspaceMapSkipDirs[entry.Name()]) {
+				if entry.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if entry.IsDir() {
+				paths = append(paths, toPosix(rel)+"/")
+				if strings.Count(rel, string(filepath.Separator)) >= workspaceMapDepth-1 {
+					return filepath.SkipDir
+				}
+			} else {
+				paths = append(paths, toPosix(rel))
+			}
+			return nil
+		})
+		sort.Strings(paths)
+
+		workspaceMap.WriteString(toPosix(root) + "/\n")
+		for _, path := range paths {
+			if entries >= maxWorkspaceMapEntries {
+				workspaceMap.WriteString(fmt.Sprintf("  ... (map truncated to %d entries, use list_files for more)\n", maxWorkspaceMapEntries))
+				return strings.TrimRight(workspaceMap.String(), "\n")
+			}
+			workspaceMap.WriteString("  " + path + "\n")
+			entries++
+		}
+	}
+	return strings.TrimRight(workspaceMap.String(), "\n")
+}
@@ -0,0 +1,79 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pederhe/nca/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetectProjectRoot(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "services", "api", "internal"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "package.json"), []byte("{}"), 0644))
+
+	assert.Equal(t, root, DetectProjectRoot(filepath.Join(root, "services", "api", "internal")))
+
+	// The closest marker wins, e.g. a Go module in a monorepo
+	require.NoError(t, os.WriteFile(filepath.Join(root, "services", "api", "go.mod"), []byte("module api\n"), 0644))
+	assert.Equal(t, filepath.Join(root, "services", "api"), DetectProjectRoot(filepath.Join(root, "services", "api", "internal")))
+
+	// Without markers the directory itself is the root
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	require.NoError(t, os.MkdirAll(filepath.Join(home, ".git"), 0755))
+	require.NoError(t, os.MkdirAll(filepath.Join(home, "notes"), 0755))
+	assert.Equal(t, filepath.Join(home, "notes"), DetectProjectRoot(filepath.Join(home, "notes")))
+}
+
+func TestCheckWorkspacePaths(t *testing.T) {
+	tmpDir := t.TempDir()
+	originalDir, err := os.Getwd()
+	require.NoError(t, err)
+	defer os.Chdir(originalDir)
+	require.NoError(t, os.MkdirAll(filepath.Join(tmpDir, "svc-a"), 0755))
+	require.NoError(t, os.MkdirAll(filepath.Join(tmpDir, "svc-b"), 0755))
+	require.NoError(t, os.MkdirAll(filepath.Join(tmpDir, "svc-c"), 0755))
+	os.Chdir(filepath.Join(tmpDir, "svc-a"))
+	t.Setenv("HOME", t.TempDir())
+	defer SetWorkspaceRoots(nil)
+
+	// By default the workspace is the detected root, the scratch directory is always allowed
+	assert.Empty(t, CheckWorkspacePaths("read_file", map[string]interface{}{"path": "main.go"}))
+	assert.Empty(t, CheckWorkspacePaths("write_to_file", map[string]interface{}{"path": filepath.Join(".nca", "scratch", "x", "out.txt")}))
+	assert.Contains(t, CheckWorkspacePaths("read_file", map[string]interface{}{"path": "../svc-b/main.go"}), "is outside the workspace")
+
+	require.NoError(t, SetWorkspaceRoots([]string{".", "../svc-b", "../svc-b/"}))
+	assert.Equal(t, []string{filepath.Join(tmpDir, "svc-a"), filepath.Join(tmpDir, "svc-b")}, GetWorkspaceRoots())
+	assert.Empty(t, CheckWorkspacePaths("read_files", map[string]interface{}{"paths": "main.go:1-10\n../svc-b/main.go"}))
+	assert.Contains(t, CheckWorkspacePaths("read_files", map[string]interface{}{"paths": []string{"main.go", "../svc-c/main.go:1-5"}}), "'../svc-c/main.go' is outside")
+	assert.Contains(t, CheckWorkspacePaths("write_files", map[string]interface{}{"files": []FileWrite{{Path: "/etc/hosts"}}}), "outside the workspace")
+	assert.Contains(t, CheckWorkspacePaths("apply_patch", map[string]interface{}{"patch": "--- a/../svc-c/x\n+++ b/../svc-c/x\n@@\n-a\n+b\n"}), "outside the workspace")
+	assert.Empty(t, CheckWorkspacePaths("execute_command", map[string]interface{}{"command": "cat /etc/hosts"}))
+	assert.Contains(t, CheckWorkspacePaths("get_file_diff", map[string]interface{}{"path": "/etc/hosts"}), "outside the workspace")
+
+	assert.Error(t, SetWorkspaceRoots([]string{"../missing"}))
+
+	// The restriction can be turned off, by the project's config only in trusted workspaces
+	require.NoError(t, config.Set("workspace.restrict_files", "false", false))
+	assert.Contains(t, CheckWorkspacePaths("read_file", map[string]interface{}{"path": "/etc/hosts"}), "outside the workspace")
+	trustWorkspace(t)
+	assert.Empty(t, CheckWorkspacePaths("read_file", map[string]interface{}{"path": "/etc/hosts"}))
+}
+
+func TestBuildWorkspaceMap(t *testing.T) {
+	root := t.TempDir()
+	defer SetWorkspaceRoots(nil)
+	for _, dir := range []string{"cmd/app/internal", "node_modules/lib", ".git"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(root, dir), 0755))
+	}
+	for _, file := range []string{"go.mod", "cmd/app/main.go", "cmd/app/internal/deep.go", ".env"} {
+		require.NoError(t, os.WriteFile(filepath.Join(root, file), []byte("x"), 0644))
+	}
+	require.NoError(t, SetWorkspaceRoots([]string{root}))
+
+	assert.Equal(t, toPosix(root)+"/\n  cmd/\n  cmd/app/\n  go.mod", BuildWorkspaceMap())
+}
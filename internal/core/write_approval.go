@@ -0,0 +1,114 @@
+package core
+
+import (
+	"bufio"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/pederhe/nca/pkg/config"
+	"github.com/pederhe/nca/pkg/utils"
+)
+
+// The most lines of a new file shown when its creation is approved
+const maxWritePreviewLines = 40
+
+// isWriteApprovalEnabled returns whether write_to_file and replace_in_file ask for approval, which
+// is turned on by setting the auto_approve_edits config to false, or with the older
+// approve_file_writes config, and always with --approval always-ask
+func isWriteApprovalEnabled() bool {
+	if approvalPolicy == ApprovalAlwaysAsk {
+		return true
+	}
+	if value := config.Get("auto_approve_edits"); value == "false" || value == "0" {
+		return true
+	}
+	value := config.Get("approve_file_writes")
+	return value == "true" || value == "1"
+}
+
+// writeReview is the decision of the user on a file write
+type writeReview struct {
+	content  string   // The content to write, the user may have edited it
+	edited   bool     // Whether the user edited the content
+	refusal  string   // The result for the model if the user rejected the write, "" otherwise
+	rejected []string // The hunks the user rejected when the others are written
+	reason   string   // The reason the user gave for rejecting hunks
+}
+
+// reviewFileWrite shows the change of a file write and asks the user to accept, reject or edit
+// it, unless approval isn't required. With byHunk the changes of an existing file are reviewed
+// hunk by hunk.
+func reviewFileWrite(path string, original string, exists bool, content string, byHunk bool) writeReview {
+	if !isWriteApprovalEnabled() || IsAutoApprove() {
+		return writeReview{content: content}
+	}
+	switch decideApproval(approveWrite) {
+	case approveAction:
+		return writeReview{content: content}
+	case denyAction:
+		return writeReview{refusal: approvalDenial(approveWrite)}
+	}
+
+	reader := bufio.NewReader(Input)
+	if byHunk && exists && original != content {
+		return reviewHunks(path, original, content, reader)
+	}
+	fmt.Println(formatWritePreview(path, original, exists, content))
+	for {
+		fmt.Printf("Apply this change to %s? (y)es/(n)o/(e)dit: ", utils.ColoredText(path, utils.ColorGreen))
+		response, _ := reader.ReadString('\n')
+		switch strings.ToLower(strings.TrimSpace(response)) {
+		case "y", "yes":
+			return writeReview{content: content}
+		case "e", "edit":
+			edited, err := editTextAs(content, filepath.Ext(path))
+			if err != nil {
+				fmt.Println(utils.ColoredText("Failed to edit the change: "+err.Error(), utils.ColorRed))
+				continue
+			}
+			return writeReview{content: edited, edited: edited != content}
+		case "n", "no":
+			fmt.Print("Reason for the model (optional): ")
+			reason, _ := reader.ReadString('\n')
+			return writeReview{refusal: formatWriteRefusal(path, strings.TrimSpace(reason))}
+		}
+	}
+}
+
+// formatWriteRefusal returns the result of a file write the user rejected, it tells the model
+// why, so it can propose another change instead of repeating it
+func formatWriteRefusal(path string, reason string) string {
+	if reason == "" {
+		reason = "(none given)"
+	}
+	return fmt.Sprintf("File write cancelled: the user rejected the change\nPath: %s\nReason: %s\n"+
+		"The file was not changed. Don't repeat the same change: propose an alternative that addresses the reason, "+
+		"or use ask_followup_question if it's unclear what the user wants.", path, reason)
+}
+
+// userEditNote tells the model that the user edited a change before it was written, so it works
+// with the content of the file instead of its own proposal
+const userEditNote = "The user edited your change before it was written, read the file before changing it again."
+
+// formatWritePreview returns the colored diff of a change, or the beginning of a new file
+func formatWritePreview(path string, original string, exists bool, content string) string {
+	if exists {
+		if original == content {
+			return "No changes to " + path
+		}
+		return utils.ColoredDiff(strings.TrimRight(generateGitStyleDiff(path, original, content), "\n"))
+	}
+
+	lines := strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	var preview strings.Builder
+	preview.WriteString(utils.ColoredText(fmt.Sprintf("New file %s (%d lines):", path, len(lines)), utils.ColorYellow))
+	for i, line := range lines {
+		if i == maxWritePreviewLines {
+			preview.WriteString(fmt.Sprintf("\n... %d more lines", len(lines)-maxWritePreviewLines))
+			break
+		}
+		preview.WriteString("\n" + utils.ColoredText("+"+line, utils.ColorGreen))
+	}
+	return preview.String()
+}
@@ -0,0 +1,81 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/pederhe/nca/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormatWritePreview(t *testing.T) {
+	// Existing files show the diff of the change
+	preview := formatWritePreview("main.go", "package main\n\nfunc main() {}\n", true, "package main\n\nfunc main() {\n\tprintln(1)\n}\n")
+	assert.Contains(t, preview, "-func main() {}")
+	assert.Contains(t, preview, "+\tprintln(1)")
+	assert.Equal(t, "No changes to main.go", formatWritePreview("main.go", "x\n", true, "x\n"))
+
+	// New files show their first lines
+	var lines []string
+	for i := 1; i <= 50; i++ {
+		lines = append(lines, fmt.Sprintf("line %d", i))
+	}
+	preview = formatWritePreview("new.txt", "", false, strings.Join(lines, "\n")+"\n")
+	assert.Contains(t, preview, "New file new.txt (50 lines):")
+	assert.Contains(t, preview, "+line 40\n... 10 more lines")
+	assert.NotContains(t, preview, "line 41")
+}
+
+func TestReviewFileWrite(t *testing.T) {
+	tmpDir := t.TempDir()
+	originalDir, err := os.Getwd()
+	require.NoError(t, err)
+	defer os.Chdir(originalDir)
+	os.Chdir(tmpDir)
+
+	// Writes only ask when approve_file_writes is on and auto-approve is off
+	assert.Equal(t, writeReview{content: "a"}, reviewFileWrite("a.txt", "", false, "a", false))
+	require.NoError(t, config.Set("approve_file_writes", "true", false))
+	SetSessionAutoApprove(true)
+	defer ClearSessionAutoApprove()
+	assert.Equal(t, writeReview{content: "a"}, reviewFileWrite("a.txt", "", false, "a", false))
+	assert.Equal(t, "auto_approved", newAuditEntry("write_to_file", map[string]interface{}{"path": "a.txt"}, "File successfully written: a.txt", "").Approval)
+	assert.Equal(t, "declined", newAuditEntry("replace_in_file", map[string]interface{}{"path": "a.txt"}, formatWriteRefusal("a.txt", ""), "").Approval)
+
+	// auto_approve_edits false turns approval on as well
+	require.NoError(t, config.Set("approve_file_writes", "false", false))
+	assert.False(t, isWriteApprovalEnabled())
+	require.NoError(t, config.Set("auto_approve_edits", "false", false))
+	assert.True(t, isWriteApprovalEnabled())
+}
+
+func TestFormatWriteRefusal(t *testing.T) {
+	refusal := formatWriteRefusal("main.go", "use a constant instead")
+	assert.True(t, strings.HasPrefix(refusal, "File write cancelled: the user rejected the change\n"))
+	assert.Contains(t, refusal, "Path: main.go\nReason: use a constant instead\n")
+	assert.Contains(t, refusal, "propose an alternative")
+	assert.Contains(t, formatWriteRefusal("main.go", ""), "Reason: (none given)")
+}
+
+func TestWriteToFileEditedByUser(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Chdir(t.TempDir())
+	SetSessionAutoApprove(false)
+	defer ClearSessionAutoApprove()
+	defer SetApprovalPolicy("")
+	require.NoError(t, SetApprovalPolicy(ApprovalAlwaysAsk))
+	require.NoError(t, config.Set("approve_file_writes", "true", true))
+	t.Setenv("EDITOR", "sed -i s/proposed/edited/")
+	Input = strings.NewReader("e\n")
+	defer func() { Input = userInput{} }()
+
+	// The model is told about the edit, without a colored diff in its result
+	result := WriteToFile(map[string]interface{}{"path": "a.txt", "content": "proposed\n"})
+	assert.Equal(t, "File successfully written: a.txt. "+userEditNote, result)
+	content, err := os.ReadFile("a.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "edited\n", string(content))
+}
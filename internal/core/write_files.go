@@ -0,0 +1,145 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// FileWrite is one file of a write_files call
+type FileWrite struct {
+	Path    string `json:"path"`
+	Content string `json:"content"`
+}
+
+// Match the <file> entries of a write_files call and their parameters
+var (
+	fileWriteRegex        = regexp.MustCompile(`<file>([\s\S]*?)</file>`)
+	fileWritePathRegex    = regexp.MustCompile(`<path>([\s\S]*?)</path>`)
+	fileWriteContentRegex = regexp.MustCompile(`<content>([\s\S]*?)</content>`)
+)
+
+// parseFileWrites extracts the files of a write_files tool block
+func parseFileWrites(toolBlock string) []FileWrite {
+	var files []FileWrite
+	for _, match := range fileWriteRegex.FindAllStringSubmatch(toolBlock, -1) {
+		var file FileWrite
+		if pathMatch := fileWritePathRegex.FindStringSubmatch(match[1]); len(pathMatch) > 1 {
+			file.Path = strings.TrimSpace(pathMatch[1])
+		}
+		if contentMatch := fileWriteContentRegex.FindStringSubmatch(match[1]); len(contentMatch) > 1 {
+			file.Content = contentMatch[1] // Don't trim content to preserve formatting
+		}
+		files = append(files, file)
+	}
+	return files
+}
+
+// originalFile is the state of a file before write_files changed it
+type originalFile struct {
+	path       string
+	content    []byte
+	existed    bool
+	createdDir string // The first directory created for the file, removed on rollback
+}
+
+// WriteFiles writes several files as one transaction. If a file can't be written, the
+// files written before it are restored, so either all files are written or none.
+func WriteFiles(params map[string]interface{}) string {
+	files, ok := params["files"].([]FileWrite)
+	if !ok || len(files) == 0 {
+		return "Error: Missing files parameter"
+	}
+
+	seen := make(map[string]bool)
+	for _, file := range files {
+		if file.Path == "" {
+			return "Error: Every file needs a path"
+		}
+		if seen[file.Path] {
+			return fmt.Sprintf("Error: File %s is listed more than once", file.Path)
+		}
+		seen[file.Path] = true
+	}
+
+	var written []originalFile
+	for _, file := range files {
+		original, err := writeFileOfTransaction(file.Path, unescapeXML(file.Content))
+		if err != nil {
+			rollbackFileWrites(written)
+			return fmt.Sprintf("Error writing file %s: %s. No files were written.", file.Path, err)
+		}
+		written = append(written, original)
+	}
+
+	var result strings.Builder
+	result.WriteString(fmt.Sprintf("%d files successfully written:", len(files)))
+	for _, file := range files {
+		result.WriteString("\n- " + file.Path)
+	}
+	return result.String()
+}
+
+// writeFileOfTransaction writes one file of a transaction and returns its original state
+func writeFileOfTransaction(path string, content string) (originalFile, error) {
+	original := originalFile{path: path}
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		return original, fmt.Errorf("path is a directory")
+	}
+	if existing, err := os.ReadFile(path); err == nil {
+		original.content = existing
+		original.existed = true
+	}
+
+	// Remember the first missing directory so a rollback removes the directories it created
+	for dir := filepath.Dir(path); ; dir = filepath.Dir(dir) {
+		if _, err := os.Stat(dir); err == nil {
+			break
+		}
+		original.createdDir = dir
+		if dir == filepath.Dir(dir) {
+			break
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return original, fmt.Errorf("creating directory: %w", err)
+	}
+
+	// Keep the line endings and byte order mark of an existing file
+	format := getFileFormat(original.content, original.existed)
+	if err := os.WriteFile(path, format.encode(content), 0644); err != nil {
+		if original.createdDir != "" {
+			os.RemoveAll(original.createdDir)
+		}
+		return original, err
+	}
+	return original, nil
+}
+
+// removeFileOfTransaction removes one file of a transaction and returns its original state
+func removeFileOfTransaction(path string) (originalFile, error) {
+	original := originalFile{path: path, existed: true}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return original, err
+	}
+	original.content = content
+	return original, os.Remove(path)
+}
+
+// rollbackFileWrites restores the files written or removed in a transaction, in reverse order
+func rollbackFileWrites(written []originalFile) {
+	for i := len(written) - 1; i >= 0; i-- {
+		original := written[i]
+		if original.existed {
+			os.WriteFile(original.path, original.content, 0644)
+			continue
+		}
+		os.Remove(original.path)
+		if original.createdDir != "" {
+			os.RemoveAll(original.createdDir)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pederhe/nca/pkg/api/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteFiles(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "README.md")
+	require.NoError(t, os.WriteFile(existing, []byte("old\r\n"), 0644))
+
+	result := WriteFiles(map[string]interface{}{"files": []FileWrite{
+		{Path: filepath.Join(dir, "pkg", "store", "store.go"), Content: "package store\n"},
+		{Path: filepath.Join(dir, "pkg", "store", "store_test.go"), Content: "package store\n"},
+		{Path: existing, Content: "new &amp; improved\n"},
+	}})
+	assert.Contains(t, result, "3 files successfully written")
+
+	content, err := os.ReadFile(filepath.Join(dir, "pkg", "store", "store.go"))
+	require.NoError(t, err)
+	assert.Equal(t, "package store\n", string(content))
+
+	// Existing files keep their line endings, content is unescaped like write_to_file
+	content, err = os.ReadFile(existing)
+	require.NoError(t, err)
+	assert.Equal(t, "new & improved\r\n", string(content))
+}
+
+func TestWriteFilesRollback(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "main.go")
+	require.NoError(t, os.WriteFile(existing, []byte("package main\n"), 0644))
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "taken"), 0755))
+
+	// The last file can't be written because its path is a directory
+	result := WriteFiles(map[string]interface{}{"files": []FileWrite{
+		{Path: existing, Content: "package changed\n"},
+		{Path: filepath.Join(dir, "new", "sub", "file.go"), Content: "package sub\n"},
+		{Path: filepath.Join(dir, "taken"), Content: "data"},
+	}})
+	assert.Contains(t, result, "Error writing file")
+	assert.Contains(t, result, "No files were written")
+
+	// The files written before the failure are restored and created directories removed
+	content, err := os.ReadFile(existing)
+	require.NoError(t, err)
+	assert.Equal(t, "package main\n", string(content))
+	assert.NoDirExists(t, filepath.Join(dir, "new"))
+	assert.DirExists(t, filepath.Join(dir, "taken"))
+}
+
+func TestWriteFilesInvalidParams(t *testing.T) {
+	assert.Equal(t, "Error: Missing files parameter", WriteFiles(map[string]interface{}{}))
+	assert.Equal(t, "Error: Every file needs a path", WriteFiles(map[string]interface{}{"files": []FileWrite{{Content: "x"}}}))
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a.txt")
+	result := WriteFiles(map[string]interface{}{"files": []FileWrite{{Path: path, Content: "1"}, {Path: path, Content: "2"}}})
+	assert.Contains(t, result, "listed more than once")
+	assert.NoFileExists(t, path)
+}
+
+func TestParseToolUse_WriteFiles(t *testing.T) {
+	content := `I'll create the package.
+
+<write_files>
+<file>
+<path>pkg/a.go</path>
+<content>
+package pkg
+</content>
+</file>
+<file>
+<path>pkg/b.go</path>
+<content>
+package pkg
+
+func B() {}
+</content>
+</file>
+</write_files>`
+
+	result := ParseToolUse(content)
+	assert.Equal(t, "write_files", result["tool"])
+	assert.NotContains(t, result, "path")
+	assert.Equal(t, []FileWrite{
+		{Path: "pkg/a.go", Content: "\npackage pkg\n"},
+		{Path: "pkg/b.go", Content: "\npackage pkg\n\nfunc B() {}\n"},
+	}, result["files"])
+}
+
+func TestParseToolCall_WriteFiles(t *testing.T) {
+	toolUse, err := ParseToolCall(types.ToolCall{
+		ID:   "call_1",
+		Type: "function",
+		Function: types.FunctionCall{
+			Name:      "write_files",
+			Arguments: `{"files": [{"path": "a.go", "content": "package a\n"}, {"path": " b.go ", "content": "package b\n"}]}`,
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []FileWrite{{Path: "a.go", Content: "package a\n"}, {Path: "b.go", Content: "package b\n"}}, toolUse["files"])
+
+	// The files parameter of write_files is an array of objects, not of strings like the one of git_commit
+	prompt, err := BuildSystemPrompt()
+	require.NoError(t, err)
+	for _, definition := range BuildToolDefinitions(prompt) {
+		if definition.Function.Name != "write_files" {
+			continue
+		}
+		files := definition.Function.Parameters["properties"].(map[string]interface{})["files"].(map[string]interface{})
+		assert.Equal(t, "object", files["items"].(map[string]interface{})["type"])
+		return
+	}
+	t.Fatal("write_files has no tool definition")
+}
@@ -15,10 +15,11 @@ type XMLTagFilter struct {
 	inToolTag     bool
 	inSubTag      bool
 	currentSubTag string
-	inDiffTag     bool            // Whether inside a diff tag
-	inContentTag  bool            // Whether inside a content tag
-	pendingBuffer strings.Builder // Buffer for storing potential tag start sequences
-	showThinking  bool            // Controls whether to show thinking tags and content, defaults to false
+	inDiffTag     bool                    // Whether inside a diff tag
+	inContentTag  bool                    // Whether inside a content tag
+	pendingBuffer strings.Builder         // Buffer for storing potential tag start sequences
+	showThinking  bool                    // Controls whether to show thinking tags and content, defaults to false
+	markdown      *utils.MarkdownRenderer // Renders the text outside tool tags, nil for raw text
 }
 
 // Create a new XML tag filter
@@ -48,6 +49,39 @@ func (f *XMLTagFilter) GetShowThinking() bool {
 	return f.showThinking
 }
 
+// SetMarkdownRenderer renders the Markdown of the text outside tool tags, the content of tool
+// tags like files and commands stays raw
+func (f *XMLTagFilter) SetMarkdownRenderer(renderer *utils.MarkdownRenderer) {
+	f.markdown = renderer
+}
+
+// Flush returns the text held back by the Markdown renderer, at the end of a response
+func (f *XMLTagFilter) Flush() string {
+	if f.markdown == nil {
+		return ""
+	}
+	return f.markdown.Flush()
+}
+
+// isProse returns whether the output is text of the assistant rather than the content of a tool tag
+func (f *XMLTagFilter) isProse() bool {
+	return !f.inToolTag && !f.inDiffTag && !f.inContentTag
+}
+
+// renderSegment writes the output since start, rendered if it's text of the assistant. The
+// renderer is flushed before the content of a tool tag is written.
+func (f *XMLTagFilter) renderSegment(out *strings.Builder, start int, prose bool) {
+	text := f.buffer.String()[start:]
+	if !prose {
+		out.WriteString(text)
+		return
+	}
+	out.WriteString(f.markdown.Render(text))
+	if !f.isProse() {
+		out.WriteString(f.markdown.Flush())
+	}
+}
+
 // Process a chunk of text and filter out XML tool tags
 func (f *XMLTagFilter) ProcessChunk(chunk string) string {
 	f.buffer.Reset()
@@ -58,9 +92,20 @@ func (f *XMLTagFilter) ProcessChunk(chunk string) string {
 		f.pendingBuffer.Reset()
 	}
 
+	// With a Markdown renderer the output is split into segments of text and tool content
+	var rendered strings.Builder
+	prose := f.isProse()
+	segmentStart := 0
+
 	for i := 0; i < len(chunk); i++ {
 		c := chunk[i]
 
+		if f.markdown != nil && f.isProse() != prose {
+			f.renderSegment(&rendered, segmentStart, prose)
+			segmentStart = f.buffer.Len()
+			prose = !prose
+		}
+
 		// Handle special tags (diff, content) that don't filter their content
 		if processed, newIndex := f.handleSpecialTags(chunk, i); processed {
 			i = newIndex
@@ -119,7 +164,11 @@ func (f *XMLTagFilter) ProcessChunk(chunk string) string {
 		}
 	}
 
-	return f.buffer.String()
+	if f.markdown == nil {
+		return f.buffer.String()
+	}
+	f.renderSegment(&rendered, segmentStart, prose)
+	return rendered.String()
 }
 
 // Handle special tags like diff and content that don't filter their content
@@ -329,14 +378,26 @@ func toolTagPrefix(tool string, tag string) string {
 		if tag == "path" {
 			return "Read "
 		}
+	case "read_files":
+		if tag == "paths" {
+			return "Read files:\n"
+		}
 	case "write_to_file":
 		if tag == "path" {
 			return "Write "
 		}
+	case "write_files":
+		if tag == "file" {
+			return "Write file:"
+		}
 	case "replace_in_file":
 		if tag == "path" {
 			return "Replace "
 		}
+	case "apply_patch":
+		if tag == "patch" {
+			return "Apply patch:"
+		}
 	case "search_files":
 		if tag == "path" {
 			return "Search "
@@ -349,10 +410,75 @@ func toolTagPrefix(tool string, tag string) string {
 		if tag == "path" {
 			return "Code "
 		}
+	case "get_file_diff":
+		if tag == "path" {
+			return "Diff "
+		}
+		if tag == "base" {
+			return "Against "
+		}
+	case "verify_build":
+		if tag == "path" {
+			return "Build "
+		}
+	case "read_job_output":
+		if tag == "job_id" {
+			return "Job "
+		}
+	case "git_status":
+		if tag == "path" {
+			return "Git status of "
+		}
+	case "git_diff":
+		if tag == "path" {
+			return "Git diff of "
+		}
+		if tag == "base" {
+			return "Against "
+		}
+	case "git_log":
+		if tag == "ref" {
+			return "Git log of "
+		}
+		if tag == "path" {
+			return "Touching "
+		}
+	case "git_stage_hunks":
+		if tag == "path" {
+			return "Stage hunks of "
+		}
+		if tag == "hunks" {
+			return "Hunks "
+		}
 	case "git_commit":
 		if tag == "message" {
 			return "Git commit:\n"
 		}
+	case "read_issue":
+		if tag == "issue" {
+			return "Issue "
+		}
+	case "create_pull_request":
+		if tag == "title" {
+			return "Pull request: "
+		}
+		if tag == "body" {
+			return "\n"
+		}
+		if tag == "base" {
+			return "Into "
+		}
+	case "comment_on_pr":
+		if tag == "pr" {
+			return "Pull request "
+		}
+		if tag == "body" {
+			return "Comment:\n"
+		}
+	case "list_pr_review_comments":
+		if tag == "pr" {
+			return "Review comments of "
+		}
 	case "fetch_web_content":
 		if tag == "url" {
 			return "Fetch "
@@ -361,6 +487,28 @@ func toolTagPrefix(tool string, tag string) string {
 		if tag == "path" {
 			return "Find "
 		}
+	case "download_file":
+		if tag == "url" {
+			return "Download "
+		}
+		if tag == "path" {
+			return "To "
+		}
+	case "get_artifact":
+		if tag == "id" {
+			return "Artifact "
+		}
+	case "new_task":
+		if tag == "context" {
+			return "New task:\n"
+		}
+	case "spawn_subtask":
+		if tag == "goal" {
+			return "Subtask: "
+		}
+		if tag == "context" {
+			return "Context:\n"
+		}
 	case "attempt_completion":
 		return ""
 	case "ask_followup_question":
@@ -374,17 +522,38 @@ func isToolTag(tag string) bool {
 	toolTags := []string{
 		"execute_command",
 		"read_file",
+		"read_files",
 		"write_to_file",
+		"write_files",
 		"replace_in_file",
+		"apply_patch",
 		"search_files",
 		"list_files",
 		"list_code_definition_names",
+		"get_file_diff",
+		"verify_build",
+		"read_job_output",
 		"attempt_completion",
 		"ask_followup_question",
 		"ask_mode_response",
+		"git_status",
+		"git_diff",
+		"git_log",
+		"git_branch",
+		"git_stage_hunks",
 		"git_commit",
+		"read_issue",
+		"create_pull_request",
+		"comment_on_pr",
+		"list_pr_review_comments",
 		"fetch_web_content",
 		"find_files",
+		"get_artifact",
+		"download_file",
+		"new_task",
+		"create_plan",
+		"update_plan_step",
+		"spawn_subtask",
 	}
 
 	for _, toolTag := range toolTags {
@@ -398,7 +567,7 @@ func isToolTag(tag string) bool {
 
 // Check if a tag should be hidden
 func isHiddenTag(tag string) bool {
-	hiddenTags := []string{"requires_approval", "recursive"}
+	hiddenTags := []string{"requires_approval", "run_in_background", "stop", "recursive", "options", "timeout", "max_size", "steps", "step", "status", "note", "cheap_model", "draft", "amend", "staged_only", "staged", "count", "all", "offset", "limit"}
 	for _, hiddenTag := range hiddenTags {
 		if tag == hiddenTag {
 			return true
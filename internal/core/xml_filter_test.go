@@ -3,6 +3,8 @@ package core
 import (
 	"strings"
 	"testing"
+
+	"github.com/pederhe/nca/pkg/utils"
 )
 
 func TestXMLTagFilter_ProcessChunk_NoTags(t *testing.T) {
@@ -208,6 +210,27 @@ func TestXMLTagFilter_ProcessChunk_SpecialTagsWithPartialInput(t *testing.T) {
 }
 
 // Test the isToolTag function
+func TestXMLTagFilter_ProcessChunk_Markdown(t *testing.T) {
+	filter := NewXMLTagFilter()
+	filter.SetMarkdownRenderer(utils.NewMarkdownRenderer())
+	input := "# Plan\n<write_to_file>\n<path>notes.md</path>\n<content># raw\n</content>\n</write_to_file>\nDone **now**"
+
+	// Stream the input one character at a time
+	var result strings.Builder
+	for i := 0; i < len(input); i++ {
+		result.WriteString(filter.ProcessChunk(input[i : i+1]))
+	}
+	result.WriteString(filter.Flush())
+
+	// The text of the assistant is rendered, the content of the tool stays raw
+	output := result.String()
+	for _, expected := range []string{utils.ColorBold + utils.ColorCyan + "Plan" + utils.ColorReset, "# raw", "Done " + utils.ColorReset + utils.ColorBold + "now" + utils.ColorReset} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("Expected result to contain %q, got %q", expected, output)
+		}
+	}
+}
+
 func TestIsToolTag(t *testing.T) {
 	testCases := []struct {
 		tag      string
@@ -12,19 +12,41 @@ func ParseToolUse(content string) map[string]interface{} {
 	rootTools := []string{
 		"execute_command",
 		"read_file",
+		"read_files",
 		"write_to_file",
+		"write_files",
 		"replace_in_file",
+		"apply_patch",
 		"search_files",
 		"list_files",
 		"list_code_definition_names",
+		"get_file_diff",
+		"verify_build",
+		"read_job_output",
 		"attempt_completion",
 		"ask_followup_question",
 		"ask_mode_response",
+		"git_status",
+		"git_diff",
+		"git_log",
+		"git_branch",
+		"git_stage_hunks",
 		"git_commit",
+		"read_issue",
+		"create_pull_request",
+		"comment_on_pr",
+		"list_pr_review_comments",
 		"fetch_web_content",
 		"find_files",
 		"use_mcp_tool",
+		"describe_mcp_tool",
 		"access_mcp_resource",
+		"get_artifact",
+		"download_file",
+		"new_task",
+		"create_plan",
+		"update_plan_step",
+		"spawn_subtask",
 	}
 
 	// Find all root tool tags
@@ -124,6 +146,56 @@ func ParseToolUse(content string) map[string]interface{} {
 			params["requires_approval"] = approvalValue == "true"
 		}
 
+		backgroundMatch := regexp.MustCompile(`<run_in_background>([\s\S]*?)</run_in_background>`).FindStringSubmatch(toolBlock)
+		if len(backgroundMatch) > 1 {
+			params["run_in_background"] = strings.TrimSpace(backgroundMatch[1]) == "true"
+		}
+
+	case "read_job_output":
+		jobMatch := regexp.MustCompile(`<job_id>([\s\S]*?)</job_id>`).FindStringSubmatch(toolBlock)
+		if len(jobMatch) > 1 {
+			params["job_id"] = strings.TrimSpace(jobMatch[1])
+		}
+
+		stopMatch := regexp.MustCompile(`<stop>([\s\S]*?)</stop>`).FindStringSubmatch(toolBlock)
+		if len(stopMatch) > 1 {
+			params["stop"] = strings.TrimSpace(stopMatch[1]) == "true"
+		}
+
+	case "get_file_diff", "git_diff":
+		baseMatch := regexp.MustCompile(`<base>([\s\S]*?)</base>`).FindStringSubmatch(toolBlock)
+		if len(baseMatch) > 1 {
+			params["base"] = strings.TrimSpace(baseMatch[1])
+		}
+
+		stagedMatch := regexp.MustCompile(`<staged>([\s\S]*?)</staged>`).FindStringSubmatch(toolBlock)
+		if len(stagedMatch) > 1 {
+			params["staged"] = strings.TrimSpace(stagedMatch[1]) == "true"
+		}
+
+	case "git_log":
+		refMatch := regexp.MustCompile(`<ref>([\s\S]*?)</ref>`).FindStringSubmatch(toolBlock)
+		if len(refMatch) > 1 {
+			params["ref"] = strings.TrimSpace(refMatch[1])
+		}
+
+		countMatch := regexp.MustCompile(`<count>([\s\S]*?)</count>`).FindStringSubmatch(toolBlock)
+		if len(countMatch) > 1 {
+			params["count"] = strings.TrimSpace(countMatch[1])
+		}
+
+	case "git_branch":
+		allMatch := regexp.MustCompile(`<all>([\s\S]*?)</all>`).FindStringSubmatch(toolBlock)
+		if len(allMatch) > 1 {
+			params["all"] = strings.TrimSpace(allMatch[1]) == "true"
+		}
+
+	case "git_stage_hunks":
+		hunksMatch := regexp.MustCompile(`<hunks>([\s\S]*?)</hunks>`).FindStringSubmatch(toolBlock)
+		if len(hunksMatch) > 1 {
+			params["hunks"] = strings.TrimSpace(hunksMatch[1])
+		}
+
 	case "git_commit":
 		// Extract message parameter - required
 		messageMatch := regexp.MustCompile(`<message>([\s\S]*?)</message>`).FindStringSubmatch(toolBlock)
@@ -148,6 +220,54 @@ func ParseToolUse(content string) map[string]interface{} {
 			}
 		}
 
+		amendMatch := regexp.MustCompile(`<amend>([\s\S]*?)</amend>`).FindStringSubmatch(toolBlock)
+		if len(amendMatch) > 1 {
+			params["amend"] = strings.TrimSpace(amendMatch[1]) == "true"
+		}
+
+		stagedMatch := regexp.MustCompile(`<staged_only>([\s\S]*?)</staged_only>`).FindStringSubmatch(toolBlock)
+		if len(stagedMatch) > 1 {
+			params["staged_only"] = strings.TrimSpace(stagedMatch[1]) == "true"
+		}
+
+	case "read_issue":
+		issueMatch := regexp.MustCompile(`<issue>([\s\S]*?)</issue>`).FindStringSubmatch(toolBlock)
+		if len(issueMatch) > 1 {
+			params["issue"] = strings.TrimSpace(issueMatch[1])
+		}
+
+	case "create_pull_request":
+		titleMatch := regexp.MustCompile(`<title>([\s\S]*?)</title>`).FindStringSubmatch(toolBlock)
+		if len(titleMatch) > 1 {
+			params["title"] = strings.TrimSpace(titleMatch[1])
+		}
+
+		bodyMatch := regexp.MustCompile(`<body>([\s\S]*?)</body>`).FindStringSubmatch(toolBlock)
+		if len(bodyMatch) > 1 {
+			params["body"] = strings.TrimSpace(bodyMatch[1])
+		}
+
+		baseMatch := regexp.MustCompile(`<base>([\s\S]*?)</base>`).FindStringSubmatch(toolBlock)
+		if len(baseMatch) > 1 {
+			params["base"] = strings.TrimSpace(baseMatch[1])
+		}
+
+		draftMatch := regexp.MustCompile(`<draft>([\s\S]*?)</draft>`).FindStringSubmatch(toolBlock)
+		if len(draftMatch) > 1 {
+			params["draft"] = strings.TrimSpace(draftMatch[1]) == "true"
+		}
+
+	case "comment_on_pr", "list_pr_review_comments":
+		prMatch := regexp.MustCompile(`<pr>([\s\S]*?)</pr>`).FindStringSubmatch(toolBlock)
+		if len(prMatch) > 1 {
+			params["pr"] = strings.TrimSpace(prMatch[1])
+		}
+
+		bodyMatch := regexp.MustCompile(`<body>([\s\S]*?)</body>`).FindStringSubmatch(toolBlock)
+		if len(bodyMatch) > 1 {
+			params["body"] = strings.TrimSpace(bodyMatch[1])
+		}
+
 	case "read_file":
 		// path is already handled above
 		rangeMatch := regexp.MustCompile(`<range>([\s\S]*?)</range>`).FindStringSubmatch(toolBlock)
@@ -155,18 +275,51 @@ func ParseToolUse(content string) map[string]interface{} {
 			params["range"] = strings.TrimSpace(rangeMatch[1])
 		}
 
+		offsetMatch := regexp.MustCompile(`<offset>([\s\S]*?)</offset>`).FindStringSubmatch(toolBlock)
+		if len(offsetMatch) > 1 {
+			params["offset"] = strings.TrimSpace(offsetMatch[1])
+		}
+
+		limitMatch := regexp.MustCompile(`<limit>([\s\S]*?)</limit>`).FindStringSubmatch(toolBlock)
+		if len(limitMatch) > 1 {
+			params["limit"] = strings.TrimSpace(limitMatch[1])
+		}
+
+	case "read_files":
+		pathsMatch := regexp.MustCompile(`<paths>([\s\S]*?)</paths>`).FindStringSubmatch(toolBlock)
+		if len(pathsMatch) > 1 {
+			pathsList := []string{}
+			for _, path := range strings.Split(pathsMatch[1], "\n") {
+				if trimmedPath := strings.TrimSpace(path); trimmedPath != "" {
+					pathsList = append(pathsList, trimmedPath)
+				}
+			}
+			params["paths"] = pathsList
+		}
+
 	case "write_to_file":
 		contentMatch := regexp.MustCompile(`<content>([\s\S]*?)</content>`).FindStringSubmatch(toolBlock)
 		if len(contentMatch) > 1 {
 			params["content"] = contentMatch[1] // Don't trim content to preserve formatting
 		}
 
+	case "write_files":
+		// The paths belong to the files, not to the tool
+		delete(params, "path")
+		params["files"] = parseFileWrites(toolBlock)
+
 	case "replace_in_file":
 		diffMatch := regexp.MustCompile(`<diff>([\s\S]*?)</diff>`).FindStringSubmatch(toolBlock)
 		if len(diffMatch) > 1 {
 			params["diff"] = diffMatch[1] // Don't trim diff to preserve formatting
 		}
 
+	case "apply_patch":
+		patchMatch := regexp.MustCompile(`<patch>([\s\S]*?)</patch>`).FindStringSubmatch(toolBlock)
+		if len(patchMatch) > 1 {
+			params["patch"] = patchMatch[1] // Don't trim patch to preserve formatting
+		}
+
 	case "search_files":
 		regexMatch := regexp.MustCompile(`<regex>([\s\S]*?)</regex>`).FindStringSubmatch(toolBlock)
 		if len(regexMatch) > 1 {
@@ -190,6 +343,29 @@ func ParseToolUse(content string) map[string]interface{} {
 			params["url"] = strings.TrimSpace(urlMatch[1])
 		}
 
+	case "download_file":
+		// path is already handled above
+		urlMatch := regexp.MustCompile(`<url>([\s\S]*?)</url>`).FindStringSubmatch(toolBlock)
+		if len(urlMatch) > 1 {
+			params["url"] = strings.TrimSpace(urlMatch[1])
+		}
+
+		sha256Match := regexp.MustCompile(`<sha256>([\s\S]*?)</sha256>`).FindStringSubmatch(toolBlock)
+		if len(sha256Match) > 1 {
+			params["sha256"] = strings.TrimSpace(sha256Match[1])
+		}
+
+	case "get_artifact":
+		idMatch := regexp.MustCompile(`<id>([\s\S]*?)</id>`).FindStringSubmatch(toolBlock)
+		if len(idMatch) > 1 {
+			params["id"] = strings.TrimSpace(idMatch[1])
+		}
+
+		rangeMatch := regexp.MustCompile(`<range>([\s\S]*?)</range>`).FindStringSubmatch(toolBlock)
+		if len(rangeMatch) > 1 {
+			params["range"] = strings.TrimSpace(rangeMatch[1])
+		}
+
 	case "attempt_completion":
 		// Extract result content if available
 		resultRegex := regexp.MustCompile(`<r>([\s\S]*?)</r>`)
@@ -205,12 +381,78 @@ func ParseToolUse(content string) map[string]interface{} {
 			params["command"] = commandMatch[1]
 		}
 
+	case "ask_followup_question":
+		questionMatch := regexp.MustCompile(`<question>([\s\S]*?)</question>`).FindStringSubmatch(toolBlock)
+		if len(questionMatch) > 1 {
+			params["question"] = strings.TrimSpace(questionMatch[1])
+		}
+
+		optionsMatch := regexp.MustCompile(`<options>([\s\S]*?)</options>`).FindStringSubmatch(toolBlock)
+		if len(optionsMatch) > 1 {
+			params["options"] = strings.TrimSpace(optionsMatch[1])
+		}
+
+	case "new_task":
+		contextMatch := regexp.MustCompile(`<context>([\s\S]*?)</context>`).FindStringSubmatch(toolBlock)
+		if len(contextMatch) > 1 {
+			params["context"] = strings.TrimSpace(contextMatch[1])
+		}
+
+	case "create_plan":
+		stepsMatch := regexp.MustCompile(`<steps>([\s\S]*?)</steps>`).FindStringSubmatch(toolBlock)
+		if len(stepsMatch) > 1 {
+			params["steps"] = strings.TrimSpace(stepsMatch[1])
+		}
+
+	case "update_plan_step":
+		stepMatch := regexp.MustCompile(`<step>([\s\S]*?)</step>`).FindStringSubmatch(toolBlock)
+		if len(stepMatch) > 1 {
+			params["step"] = strings.TrimSpace(stepMatch[1])
+		}
+
+		statusMatch := regexp.MustCompile(`<status>([\s\S]*?)</status>`).FindStringSubmatch(toolBlock)
+		if len(statusMatch) > 1 {
+			params["status"] = strings.TrimSpace(statusMatch[1])
+		}
+
+		noteMatch := regexp.MustCompile(`<note>([\s\S]*?)</note>`).FindStringSubmatch(toolBlock)
+		if len(noteMatch) > 1 {
+			params["note"] = strings.TrimSpace(noteMatch[1])
+		}
+
+	case "spawn_subtask":
+		goalMatch := regexp.MustCompile(`<goal>([\s\S]*?)</goal>`).FindStringSubmatch(toolBlock)
+		if len(goalMatch) > 1 {
+			params["goal"] = strings.TrimSpace(goalMatch[1])
+		}
+
+		contextMatch := regexp.MustCompile(`<context>([\s\S]*?)</context>`).FindStringSubmatch(toolBlock)
+		if len(contextMatch) > 1 {
+			params["context"] = strings.TrimSpace(contextMatch[1])
+		}
+
+		cheapModelMatch := regexp.MustCompile(`<cheap_model>([\s\S]*?)</cheap_model>`).FindStringSubmatch(toolBlock)
+		if len(cheapModelMatch) > 1 {
+			params["cheap_model"] = strings.TrimSpace(cheapModelMatch[1]) == "true"
+		}
+
 	case "ask_mode_response":
 		responseMatch := regexp.MustCompile(`<response>([\s\S]*?)</response>`).FindStringSubmatch(toolBlock)
 		if len(responseMatch) > 1 {
 			params["response"] = responseMatch[1]
 		}
 
+	case "describe_mcp_tool":
+		serverNameMatch := regexp.MustCompile(`<server_name>([\s\S]*?)</server_name>`).FindStringSubmatch(toolBlock)
+		if len(serverNameMatch) > 1 {
+			params["server_name"] = strings.TrimSpace(serverNameMatch[1])
+		}
+
+		toolNameMatch := regexp.MustCompile(`<tool_name>([\s\S]*?)</tool_name>`).FindStringSubmatch(toolBlock)
+		if len(toolNameMatch) > 1 {
+			params["tool_name"] = strings.TrimSpace(toolNameMatch[1])
+		}
+
 	case "use_mcp_tool":
 		serverNameMatch := regexp.MustCompile(`<server_name>([\s\S]*?)</server_name>`).FindStringSubmatch(toolBlock)
 		if len(serverNameMatch) > 1 {
@@ -237,6 +479,16 @@ func ParseToolUse(content string) map[string]interface{} {
 		if len(uriMatch) > 1 {
 			params["uri"] = strings.TrimSpace(uriMatch[1])
 		}
+
+		timeoutMatch := regexp.MustCompile(`<timeout>([\s\S]*?)</timeout>`).FindStringSubmatch(toolBlock)
+		if len(timeoutMatch) > 1 {
+			params["timeout"] = strings.TrimSpace(timeoutMatch[1])
+		}
+
+		maxSizeMatch := regexp.MustCompile(`<max_size>([\s\S]*?)</max_size>`).FindStringSubmatch(toolBlock)
+		if len(maxSizeMatch) > 1 {
+			params["max_size"] = strings.TrimSpace(maxSizeMatch[1])
+		}
 	}
 
 	return params
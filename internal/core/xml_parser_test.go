@@ -311,3 +311,121 @@ func main() {
 		t.Errorf("Expected diff to be '%s', got '%v'", expectedDiff, result["diff"])
 	}
 }
+
+func TestParseToolUse_FollowupQuestion(t *testing.T) {
+	// Test case for ask_followup_question with suggested answers
+	content := `<ask_followup_question>
+<question>Which database should I use?</question>
+<options>
+["PostgreSQL", "SQLite"]
+</options>
+</ask_followup_question>
+`
+	result := ParseToolUse(content)
+
+	if result["question"] != "Which database should I use?" {
+		t.Errorf("Expected question to be 'Which database should I use?', got %v", result["question"])
+	}
+
+	if result["options"] != `["PostgreSQL", "SQLite"]` {
+		t.Errorf("Expected options to be the JSON array, got %v", result["options"])
+	}
+}
+
+func TestParseToolUse_UpdatePlanStep(t *testing.T) {
+	content := `The struct is added.
+
+<update_plan_step>
+<step>1</step>
+<status>done</status>
+<note>added to config.go</note>
+</update_plan_step>
+`
+	result := ParseToolUse(content)
+
+	expected := map[string]interface{}{
+		"tool":   "update_plan_step",
+		"step":   "1",
+		"status": "done",
+		"note":   "added to config.go",
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected %v, got %v", expected, result)
+	}
+}
+
+func TestParseToolUse_SpawnSubtask(t *testing.T) {
+	content := `<spawn_subtask>
+<goal>Write tests for pkg/utils</goal>
+<context>
+Tests use testify
+</context>
+<cheap_model>true</cheap_model>
+</spawn_subtask>`
+	result := ParseToolUse(content)
+
+	expected := map[string]interface{}{
+		"tool":        "spawn_subtask",
+		"goal":        "Write tests for pkg/utils",
+		"context":     "Tests use testify",
+		"cheap_model": true,
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected %v, got %v", expected, result)
+	}
+}
+
+func TestParseToolUse_CreatePullRequest(t *testing.T) {
+	content := `<create_pull_request>
+<title>Fix the session timeout</title>
+<body>Fixes #42</body>
+<draft>true</draft>
+</create_pull_request>`
+	result := ParseToolUse(content)
+
+	expected := map[string]interface{}{
+		"tool":  "create_pull_request",
+		"title": "Fix the session timeout",
+		"body":  "Fixes #42",
+		"draft": true,
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected %v, got %v", expected, result)
+	}
+}
+
+func TestParseToolUse_GitDiff(t *testing.T) {
+	result := ParseToolUse(`<git_diff>
+<base>main</base>
+<staged>true</staged>
+<path>internal</path>
+</git_diff>`)
+
+	expected := map[string]interface{}{
+		"tool":   "git_diff",
+		"base":   "main",
+		"staged": true,
+		"path":   "internal",
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected %v, got %v", expected, result)
+	}
+}
+
+func TestParseToolUse_ReadFilePaging(t *testing.T) {
+	result := ParseToolUse(`<read_file>
+<path>vendor/generated.go</path>
+<offset>2000</offset>
+<limit>500</limit>
+</read_file>`)
+
+	expected := map[string]interface{}{
+		"tool":   "read_file",
+		"path":   "vendor/generated.go",
+		"offset": "2000",
+		"limit":  "500",
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected %v, got %v", expected, result)
+	}
+}
@@ -0,0 +1,173 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pederhe/nca/pkg/mcp/client"
+	"github.com/pederhe/nca/pkg/mcp/common"
+	"github.com/pederhe/nca/pkg/utils"
+)
+
+// How long a login waits for the user to authorize in the browser
+const OAUTH_LOGIN_TIMEOUT = 5 * time.Minute
+
+// getTokenDir gets the directory the OAuth tokens of MCP servers are stored in
+func getTokenDir() string {
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".nca", "mcp", "tokens")
+}
+
+// newOAuthClientProvider creates the OAuth client of a server. Its tokens are stored encrypted,
+// with the key kept in the OS keyring. redirectURL is only needed to log in.
+func newOAuthClientProvider(name string, redirectURL string, redirect func(*url.URL) error) (*client.DefaultOAuthClientProvider, *client.FileTokenStorage, error) {
+	dir := getTokenDir()
+	key, err := client.LoadTokenKey(filepath.Join(dir, ".key"))
+	if err != nil {
+		return nil, nil, err
+	}
+	storage, err := client.NewFileTokenStorage(dir, name, key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	metadata := &common.OAuthClientMetadata{
+		RedirectURIs:            []string{redirectURL},
+		TokenEndpointAuthMethod: "none",
+		GrantTypes:              []string{"authorization_code", "refresh_token"},
+		ResponseTypes:           []string{"code"},
+		ClientName:              "NCA",
+	}
+	return client.NewDefaultOAuthClientProvider(redirectURL, metadata, storage, redirect), storage, nil
+}
+
+// newOAuthProvider creates the provider that adds the stored token of a server to its requests
+func newOAuthProvider(name string, serverURL string) (*client.StandardOAuthProvider, error) {
+	clientProvider, _, err := newOAuthClientProvider(name, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	return client.NewStandardOAuthProvider(clientProvider, serverURL), nil
+}
+
+// Login authorizes with an SSE server using OAuth and reconnects to it. The authorization page
+// is opened in the browser and the authorization code is received by a local callback server.
+// The server is switched to OAuth in the MCP settings file if it isn't yet.
+func (h *McpHub) Login(name string) error {
+	settings, err := loadSettingsFile(h.getMcpSettingsFilePath())
+	if err != nil {
+		return err
+	}
+	config, exists := settings.McpServers[name]
+	if !exists {
+		return fmt.Errorf("server '%s' not found", name)
+	}
+	if config.TransportType != TransportTypeSSE {
+		return fmt.Errorf("server '%s' doesn't use sse transport, only sse servers support OAuth", name)
+	}
+
+	_, storage, err := newOAuthClientProvider(name, "", nil)
+	if err != nil {
+		return fmt.Errorf("failed to load OAuth tokens: %w", err)
+	}
+	// The callback server gets a new port on every login, a client registered with a loopback
+	// redirect URL is still valid for it. Other registrations are replaced.
+	reuseClient := hasLoopbackClient(storage)
+	if !reuseClient {
+		if err := storage.SaveClientInfo(nil); err != nil {
+			return err
+		}
+	}
+
+	err = authorizeWithBrowser(name, config.URL)
+	if reuseClient && errors.Is(err, client.ErrClientRejected) {
+		fmt.Printf("MCP server %s rejected the stored OAuth client, registering it again\n", name)
+		if err := storage.SaveClientInfo(nil); err != nil {
+			return err
+		}
+		err = authorizeWithBrowser(name, config.URL)
+	}
+	if err != nil {
+		return err
+	}
+
+	return h.reconnectWithOAuth(name)
+}
+
+// hasLoopbackClient returns whether the stored client of a server was registered with loopback
+// redirect URLs only
+func hasLoopbackClient(storage *client.FileTokenStorage) bool {
+	info, err := storage.LoadClientInfo()
+	if err != nil || info == nil {
+		return false
+	}
+	redirectURIs, err := storage.LoadClientRedirectURIs()
+	if err != nil || len(redirectURIs) == 0 {
+		return false
+	}
+	for _, redirectURI := range redirectURIs {
+		if !client.IsLoopbackRedirectURL(redirectURI) {
+			return false
+		}
+	}
+	return true
+}
+
+// authorizeWithBrowser opens the authorization page of a server in the browser and stores the
+// tokens once the callback server receives the code
+func authorizeWithBrowser(name string, serverURL string) error {
+	callback, err := client.NewCallbackServer()
+	if err != nil {
+		return err
+	}
+	defer callback.Close()
+
+	provider, _, err := newOAuthClientProvider(name, callback.RedirectURL(), func(authURL *url.URL) error {
+		authURL = callback.AuthorizationURL(authURL)
+		fmt.Printf("Opening the browser to authorize MCP server %s. If it doesn't open, visit:\n%s\n", name, authURL.String())
+		utils.OpenBrowser(authURL.String())
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to load OAuth tokens: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), OAUTH_LOGIN_TIMEOUT)
+	defer cancel()
+	return client.AuthorizeWithCallback(ctx, provider, serverURL, callback)
+}
+
+// Logout removes the stored OAuth tokens of a server
+func (h *McpHub) Logout(name string) error {
+	_, storage, err := newOAuthClientProvider(name, "", nil)
+	if err != nil {
+		return err
+	}
+	return storage.Clear()
+}
+
+// reconnectWithOAuth enables OAuth for a server and connects to it with the new tokens
+func (h *McpHub) reconnectWithOAuth(name string) error {
+	settings, err := h.editSettings(func(settings *McpSettings) error {
+		config, exists := settings.McpServers[name]
+		if !exists {
+			return fmt.Errorf("server '%s' not found", name)
+		}
+		config.OAuth = true
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// An unchanged config isn't reconnected by updateServerConnections
+	if err := h.deleteConnection(name); err != nil {
+		return err
+	}
+	return h.updateServerConnections(settings.McpServers)
+}
@@ -0,0 +1,167 @@
+package mcp
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pederhe/nca/pkg/config"
+	"github.com/pederhe/nca/pkg/mcp/common"
+)
+
+// Default time the tool, resource and template lists of a server are cached before they are
+// fetched again, configurable with mcp_cache_ttl in seconds
+const DEFAULT_CAPABILITY_TTL = 5 * time.Minute
+
+// Notifications of servers whose lists changed, they refresh the cache right away
+const (
+	toolsListChangedNotification     = "notifications/tools/list_changed"
+	resourcesListChangedNotification = "notifications/resources/list_changed"
+)
+
+// capabilityCache tracks the refreshes of the capability lists of a connection. Its mutex also
+// guards the lists in the server of the connection.
+type capabilityCache struct {
+	mutex       sync.Mutex
+	refreshedAt time.Time
+	refreshing  bool // a background refresh is running
+	pending     bool // a refresh was requested while one was running
+	refreshes   int
+	failures    int
+	lastError   string
+}
+
+// CapabilityStats are the cache metrics of a server shown by /mcp list
+type CapabilityStats struct {
+	Tools       int
+	Resources   int
+	Templates   int
+	RefreshedAt time.Time
+	Refreshes   int
+	Failures    int
+	LastError   string
+}
+
+// getCapabilityTTL returns how long capability lists are cached, 0 caches them until a server
+// reports a change
+func getCapabilityTTL() time.Duration {
+	if value := config.Get("mcp_cache_ttl"); value != "" {
+		if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+			return time.Duration(seconds) * time.Second
+		}
+	}
+	return DEFAULT_CAPABILITY_TTL
+}
+
+// refreshCapabilities fetches the tool, resource and template lists of a connection and returns
+// the errors of the lists that couldn't be fetched, their cached versions are kept
+func (h *McpHub) refreshCapabilities(connection *McpConnection) []string {
+	name := connection.Server.Name
+	var errs []string
+
+	tools, toolsErr := h.fetchToolsList(name)
+	if toolsErr != nil {
+		errs = append(errs, "Failed to fetch tools: "+toolsErr.Error())
+	}
+	resources, resourcesErr := h.fetchResourcesList(name)
+	if resourcesErr != nil {
+		errs = append(errs, "Failed to fetch resources: "+resourcesErr.Error())
+	}
+	templates, templatesErr := h.fetchResourceTemplatesList(name)
+	if templatesErr != nil {
+		errs = append(errs, "Failed to fetch resource templates: "+templatesErr.Error())
+	}
+
+	cache := &connection.cache
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	if toolsErr == nil {
+		connection.Server.Tools = tools
+	}
+	if resourcesErr == nil {
+		connection.Server.Resources = resources
+	}
+	if templatesErr == nil {
+		connection.Server.ResourceTemplates = templates
+	}
+	cache.refreshedAt = time.Now()
+	cache.refreshes++
+	if len(errs) > 0 {
+		cache.failures++
+		cache.lastError = strings.Join(errs, "; ")
+	}
+	return errs
+}
+
+// scheduleRefresh refreshes the capabilities of a connection in the background. Only one refresh
+// runs at a time, requests while it runs are combined into one more refresh afterwards, so a
+// server that sends many change notifications doesn't cause as many requests.
+func (h *McpHub) scheduleRefresh(connection *McpConnection) {
+	cache := &connection.cache
+	cache.mutex.Lock()
+	if cache.refreshing {
+		cache.pending = true
+		cache.mutex.Unlock()
+		return
+	}
+	cache.refreshing = true
+	cache.mutex.Unlock()
+
+	go func() {
+		for {
+			if connection.Server.Status == "connected" {
+				h.refreshCapabilities(connection)
+			}
+
+			cache.mutex.Lock()
+			if !cache.pending || connection.Server.Status != "connected" {
+				cache.refreshing = false
+				cache.pending = false
+				cache.mutex.Unlock()
+				return
+			}
+			cache.pending = false
+			cache.mutex.Unlock()
+		}
+	}()
+}
+
+// cachedServer returns a copy of the server of a connection and starts a background refresh if
+// its capability lists are older than the TTL, the cached lists are returned meanwhile
+func (h *McpHub) cachedServer(connection *McpConnection) common.McpServer {
+	cache := &connection.cache
+	cache.mutex.Lock()
+	server := connection.Server
+	ttl := getCapabilityTTL()
+	expired := server.Status == "connected" && ttl > 0 && !cache.refreshing && !cache.refreshedAt.IsZero() &&
+		time.Since(cache.refreshedAt) > ttl
+	cache.mutex.Unlock()
+
+	if expired {
+		h.scheduleRefresh(connection)
+	}
+	return server
+}
+
+// GetCapabilityStats returns the cache metrics of a server, false if there's no such server
+func (h *McpHub) GetCapabilityStats(name string) (CapabilityStats, bool) {
+	for _, conn := range h.connections {
+		if conn.Server.Name != name {
+			continue
+		}
+		cache := &conn.cache
+		cache.mutex.Lock()
+		defer cache.mutex.Unlock()
+		return CapabilityStats{
+			Tools:       len(conn.Server.Tools),
+			Resources:   len(conn.Server.Resources),
+			Templates:   len(conn.Server.ResourceTemplates),
+			RefreshedAt: cache.refreshedAt,
+			Refreshes:   cache.refreshes,
+			Failures:    cache.failures,
+			LastError:   cache.lastError,
+		}, true
+	}
+	return CapabilityStats{}, false
+}
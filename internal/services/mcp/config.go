@@ -4,6 +4,9 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 )
 
 // Constants definition
@@ -26,6 +29,11 @@ type ServerConfig struct {
 
 	// SSE specific configuration
 	URL string `json:"url,omitempty"`
+	// HTTP headers sent with every request, e.g. for authentication. ${VAR} references in the
+	// values are replaced with environment variables so tokens don't have to be stored in the file
+	Headers map[string]string `json:"headers,omitempty"`
+	// Authorize with OAuth, see McpHub.Login. The tokens are stored encrypted in ~/.nca/mcp/tokens/
+	OAuth bool `json:"oauth,omitempty"`
 }
 
 // Validate checks if the configuration is valid
@@ -37,6 +45,10 @@ func (c *ServerConfig) Validate() error {
 		return fmt.Errorf("timeout must be at least %d seconds", MIN_MCP_TIMEOUT_SECONDS)
 	}
 
+	if c.OAuth && c.TransportType != TransportTypeSSE {
+		return errors.New("oauth is only supported for sse transport")
+	}
+
 	// Validate transport type specific configuration
 	switch c.TransportType {
 	case TransportTypeStdio:
@@ -47,6 +59,9 @@ func (c *ServerConfig) Validate() error {
 		if c.URL == "" {
 			return errors.New("url is required for sse transport")
 		}
+		if !strings.HasPrefix(c.URL, "http://") && !strings.HasPrefix(c.URL, "https://") {
+			return fmt.Errorf("url must start with http:// or https://: %s", c.URL)
+		}
 	default:
 		return fmt.Errorf("unsupported transport type: %s", c.TransportType)
 	}
@@ -79,3 +94,27 @@ func ParseSettings(content []byte) (*McpSettings, error) {
 
 	return &settings, nil
 }
+
+// loadSettingsFile reads the MCP settings file, a missing file has no servers
+func loadSettingsFile(path string) (*McpSettings, error) {
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &McpSettings{McpServers: make(map[string]*ServerConfig)}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ParseSettings(content)
+}
+
+// saveSettingsFile writes the MCP settings file
+func saveSettingsFile(path string, settings *McpSettings) error {
+	content, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(content, '\n'), 0600)
+}
@@ -5,7 +5,9 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net/http"
 	"net/url"
+	"os"
 	"time"
 
 	"github.com/pederhe/nca/pkg/mcp/client"
@@ -49,12 +51,25 @@ func (h *McpHub) connectToServer(name string, config *ServerConfig) error {
 		Client: mcpClient,
 	}
 
+	// Refresh the cached lists when the server reports that they changed
+	for _, method := range []string{toolsListChangedNotification, resourcesListChangedNotification} {
+		mcpClient.SetNotificationHandler(method, func(common.JSONRPCMessage) error {
+			h.scheduleRefresh(connection)
+			return nil
+		})
+	}
+
 	// Add to connections list
 	h.connections = append(h.connections, connection)
 
+	// Disabled servers are listed but not started
+	if config.Disabled {
+		connection.Server.Status = "disabled"
+		return nil
+	}
+
 	// Create transport object based on different transport types
 	var transport common.Transport
-	var err error
 
 	ctx := context.Background()
 
@@ -80,9 +95,12 @@ func (h *McpHub) connectToServer(name string, config *ServerConfig) error {
 			connection.Server.Status = "disconnected"
 		})
 
-		// Set close handler
+		// Set close handler, restart the server if its process exited by itself
 		stdioTransport.SetCloseHandler(func() {
 			connection.Server.Status = "disconnected"
+			if !stdioTransport.Closed() {
+				h.scheduleRestart(connection)
+			}
 		})
 
 		transport = stdioTransport
@@ -98,6 +116,21 @@ func (h *McpHub) connectToServer(name string, config *ServerConfig) error {
 		}
 
 		sseOptions := &client.SSEClientTransportOptions{}
+		if len(config.Headers) > 0 {
+			sseOptions.RequestHeaders = make(http.Header)
+			for key, value := range config.Headers {
+				sseOptions.RequestHeaders.Set(key, os.ExpandEnv(value))
+			}
+		}
+		if config.OAuth {
+			authProvider, err := newOAuthProvider(name, config.URL)
+			if err != nil {
+				connection.Server.Status = "disconnected"
+				h.appendErrorMessage(connection, fmt.Sprintf("failed to load OAuth tokens: %v", err))
+				return err
+			}
+			sseOptions.AuthProvider = authProvider
+		}
 		sseTransport := client.NewSSEClientTransport(sseURL, sseOptions)
 
 		// Set error handler
@@ -125,33 +158,21 @@ func (h *McpHub) connectToServer(name string, config *ServerConfig) error {
 	if err := mcpClient.Connect(ctx, transport); err != nil {
 		connection.Server.Status = "disconnected"
 		h.appendErrorMessage(connection, err.Error())
+		var unauthorized *client.UnauthorizedError
+		if config.OAuth && errors.As(err, &unauthorized) {
+			h.appendErrorMessage(connection, fmt.Sprintf("Run /mcp login %s to authorize", name))
+		}
 		return err
 	}
 
 	// Set status after successful connection
 	connection.Server.Status = "connected"
 	connection.Server.Error = ""
+	connection.connectedAt = time.Now()
 
 	// Initially fetch tools and resources lists
-	tools, err := h.fetchToolsList(name)
-	if err != nil {
-		h.appendErrorMessage(connection, fmt.Sprintf("Failed to fetch tools: %v", err))
-	} else {
-		connection.Server.Tools = tools
-	}
-
-	resources, err := h.fetchResourcesList(name)
-	if err != nil {
-		h.appendErrorMessage(connection, fmt.Sprintf("Failed to fetch resources: %v", err))
-	} else {
-		connection.Server.Resources = resources
-	}
-
-	templates, err := h.fetchResourceTemplatesList(name)
-	if err != nil {
-		h.appendErrorMessage(connection, fmt.Sprintf("Failed to fetch resource templates: %v", err))
-	} else {
-		connection.Server.ResourceTemplates = templates
+	for _, errMsg := range h.refreshCapabilities(connection) {
+		h.appendErrorMessage(connection, errMsg)
 	}
 
 	return nil
@@ -263,6 +284,44 @@ func (h *McpHub) RestartConnection(serverName string) error {
 	return nil
 }
 
+// scheduleRestart restarts a stdio server whose process exited unexpectedly, waiting longer
+// after every attempt and giving up after MAX_STDIO_RESTARTS attempts in a row
+func (h *McpHub) scheduleRestart(connection *McpConnection) {
+	name := connection.Server.Name
+	if h.restarts == nil {
+		h.restarts = make(map[string]int)
+	}
+	if !connection.connectedAt.IsZero() && time.Since(connection.connectedAt) >= STDIO_STABLE_DURATION {
+		h.restarts[name] = 0
+	}
+	if h.restarts[name] >= MAX_STDIO_RESTARTS {
+		h.appendErrorMessage(connection, fmt.Sprintf("Server process exited, giving up after %d restarts", MAX_STDIO_RESTARTS))
+		return
+	}
+	h.restarts[name]++
+	delay := STDIO_RESTART_DELAY << (h.restarts[name] - 1)
+
+	go func() {
+		time.Sleep(delay)
+
+		// The connection may have been removed or replaced in the meantime
+		if !h.hasConnection(connection) || connection.Server.Disabled {
+			return
+		}
+		h.RestartConnection(name)
+	}()
+}
+
+// hasConnection returns whether the connection is still managed by the hub
+func (h *McpHub) hasConnection(connection *McpConnection) bool {
+	for _, conn := range h.connections {
+		if conn == connection {
+			return true
+		}
+	}
+	return false
+}
+
 // deleteConnection deletes connection with specified name
 func (h *McpHub) deleteConnection(name string) error {
 	for i, conn := range h.connections {
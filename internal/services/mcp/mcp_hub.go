@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/pederhe/nca/pkg/config"
 	"github.com/pederhe/nca/pkg/mcp/client"
@@ -22,16 +23,29 @@ const (
 // Default timeout for internal MCP data requests (in milliseconds)
 const DEFAULT_REQUEST_TIMEOUT_MS = 5000
 
+const (
+	// Maximum number of restarts of a stdio server process that keeps exiting
+	MAX_STDIO_RESTARTS = 3
+	// Delay before the first restart, doubled on every further attempt
+	STDIO_RESTART_DELAY = time.Second
+	// A server that ran this long is considered stable and gets all restarts again
+	STDIO_STABLE_DURATION = time.Minute
+)
+
 // McpConnection represents a connection to an MCP server
 type McpConnection struct {
 	Server    common.McpServer
 	Client    *client.Client
 	Transport interface{} // Can be either StdioClientTransport or SSEClientTransport
+
+	connectedAt time.Time
+	cache       capabilityCache
 }
 
 // McpHub manages multiple MCP server connections
 type McpHub struct {
 	connections []*McpConnection
+	restarts    map[string]int // restart attempts of stdio servers that exited unexpectedly
 }
 
 // McpHub instance
@@ -41,6 +55,7 @@ func GetMcpHub() *McpHub {
 	if hub == nil {
 		hub = &McpHub{
 			connections: make([]*McpConnection, 0),
+			restarts:    make(map[string]int),
 		}
 		go hub.initializeMcpServers()
 	}
@@ -48,12 +63,12 @@ func GetMcpHub() *McpHub {
 	return hub
 }
 
-// GetServers returns all enabled servers
+// GetServers returns all enabled servers with their cached capabilities
 func (h *McpHub) GetServers() []common.McpServer {
 	servers := make([]common.McpServer, 0)
 	for _, conn := range h.connections {
 		if !conn.Server.Disabled {
-			servers = append(servers, conn.Server)
+			servers = append(servers, h.cachedServer(conn))
 		}
 	}
 	return servers
@@ -72,7 +87,8 @@ func (h *McpHub) GetMode() string {
 func (h *McpHub) getMcpSettingsFilePath() string {
 	path := config.Get("mcp_settings_file")
 	if path == "" {
-		path = filepath.Join(os.Getenv("HOME"), ".nca", "mcp_settings.json")
+		home, _ := os.UserHomeDir()
+		path = filepath.Join(home, ".nca", "mcp_settings.json")
 	}
 	return path
 }
@@ -131,6 +147,14 @@ func (h *McpHub) printConnections() {
 			fmt.Printf("  Error: %s\n", conn.Server.Error)
 		}
 		fmt.Printf("  Transport: %s\n", conn.Server.Config)
+		if stats, ok := h.GetCapabilityStats(conn.Server.Name); ok && stats.Refreshes > 0 {
+			fmt.Printf("  Cache: %d tools, %d resources, %d templates, refreshed %s ago (%d refreshes, %d failed)\n",
+				stats.Tools, stats.Resources, stats.Templates, time.Since(stats.RefreshedAt).Round(time.Second),
+				stats.Refreshes, stats.Failures)
+			if stats.LastError != "" {
+				fmt.Printf("  Last refresh error: %s\n", stats.LastError)
+			}
+		}
 
 		// Print tools information
 		if len(conn.Server.Tools) > 0 {
@@ -148,7 +172,7 @@ func (h *McpHub) printConnections() {
 func (h *McpHub) PrintConnections() {
 	if len(h.connections) == 0 {
 		fmt.Println("\nNo MCP servers currently connected")
-		fmt.Println("To add MCP servers, edit the MCP settings file at:")
+		fmt.Println("To add MCP servers, use /mcp add or edit the MCP settings file at:")
 		fmt.Println(h.getMcpSettingsFilePath())
 		fmt.Println("\nMCP mode:", h.GetMode())
 		return
@@ -157,6 +181,24 @@ func (h *McpHub) PrintConnections() {
 	// Show MCP mode
 	fmt.Println("\nMCP mode:", utils.ColoredText(h.GetMode(), utils.ColorYellow))
 
+	// Show totals over all servers
+	connected, tools, failures := 0, 0, 0
+	for _, conn := range h.connections {
+		if conn.Server.Status == "connected" {
+			connected++
+		}
+		if stats, ok := h.GetCapabilityStats(conn.Server.Name); ok {
+			tools += stats.Tools
+			failures += stats.Failures
+		}
+	}
+	ttl := "until servers report changes"
+	if value := getCapabilityTTL(); value > 0 {
+		ttl = value.String()
+	}
+	fmt.Printf("Servers: %d of %d connected, %d tools, %d failed refreshes, capabilities cached %s\n",
+		connected, len(h.connections), tools, failures, ttl)
+
 	// Call the internal print function
 	h.printConnections()
 }
@@ -0,0 +1,124 @@
+package mcp
+
+import (
+	"fmt"
+)
+
+// AddServer adds a server to the MCP settings file and connects to it
+func (h *McpHub) AddServer(name string, config *ServerConfig) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+
+	settings, err := h.editSettings(func(settings *McpSettings) error {
+		if _, exists := settings.McpServers[name]; exists {
+			return fmt.Errorf("server '%s' already exists", name)
+		}
+		settings.McpServers[name] = config
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return h.updateServerConnections(settings.McpServers)
+}
+
+// RemoveServer removes a server from the MCP settings file and closes its connection
+func (h *McpHub) RemoveServer(name string) error {
+	settings, err := h.editSettings(func(settings *McpSettings) error {
+		if _, exists := settings.McpServers[name]; !exists {
+			return fmt.Errorf("server '%s' not found", name)
+		}
+		delete(settings.McpServers, name)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return h.updateServerConnections(settings.McpServers)
+}
+
+// SetServerDisabled enables or disables a server in the MCP settings file.
+// Disabled servers are not started and their tools can't be used.
+func (h *McpHub) SetServerDisabled(name string, disabled bool) error {
+	settings, err := h.editSettings(func(settings *McpSettings) error {
+		config, exists := settings.McpServers[name]
+		if !exists {
+			return fmt.Errorf("server '%s' not found", name)
+		}
+		config.Disabled = disabled
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return h.updateServerConnections(settings.McpServers)
+}
+
+// AutoApproveTool adds a tool to the auto-approve list of a server in the MCP settings file.
+// The server keeps running, only the tool of its connection is marked as auto-approved.
+func (h *McpHub) AutoApproveTool(serverName string, toolName string) error {
+	settings, err := h.editSettings(func(settings *McpSettings) error {
+		config, exists := settings.McpServers[serverName]
+		if !exists {
+			return fmt.Errorf("server '%s' not found", serverName)
+		}
+		for _, name := range config.AutoApprove {
+			if name == toolName {
+				return nil
+			}
+		}
+		config.AutoApprove = append(config.AutoApprove, toolName)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, conn := range h.connections {
+		if conn.Server.Name != serverName {
+			continue
+		}
+		// Keep the config of the connection in sync so a reload doesn't restart the server
+		conn.Server.Config = string(mustMarshalJSON(settings.McpServers[serverName]))
+		for i := range conn.Server.Tools {
+			if conn.Server.Tools[i].Name == toolName {
+				conn.Server.Tools[i].AutoApprove = true
+			}
+		}
+	}
+	return nil
+}
+
+// IsToolAutoApproved returns whether a tool of a server is in its auto-approve list
+func (h *McpHub) IsToolAutoApproved(serverName string, toolName string) bool {
+	for _, conn := range h.connections {
+		if conn.Server.Name != serverName {
+			continue
+		}
+		for _, tool := range conn.Server.Tools {
+			if tool.Name == toolName {
+				return tool.AutoApprove
+			}
+		}
+	}
+	return false
+}
+
+// editSettings changes the MCP settings file and returns the new settings
+func (h *McpHub) editSettings(edit func(settings *McpSettings) error) (*McpSettings, error) {
+	path := h.getMcpSettingsFilePath()
+	settings, err := loadSettingsFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := edit(settings); err != nil {
+		return nil, err
+	}
+
+	if err := saveSettingsFile(path, settings); err != nil {
+		return nil, fmt.Errorf("failed to save MCP settings: %w", err)
+	}
+	return settings, nil
+}
@@ -200,7 +200,7 @@ func (h *McpHub) fetchResourceTemplatesList(serverName string) ([]common.McpReso
 }
 
 // ReadResource reads the content of a resource
-func (h *McpHub) ReadResource(serverName string, uri string) (*common.McpResourceResponse, error) {
+func (h *McpHub) ReadResource(serverName string, uri string, timeout time.Duration) (*common.McpResourceResponse, error) {
 	var connection *McpConnection
 	for _, conn := range h.connections {
 		if conn.Server.Name == serverName {
@@ -217,14 +217,26 @@ func (h *McpHub) ReadResource(serverName string, uri string) (*common.McpResourc
 		return nil, fmt.Errorf("server \"%s\" is disabled", serverName)
 	}
 
+	// Use the timeout of the server unless the call sets its own
+	if timeout <= 0 {
+		timeout = time.Duration(connection.Server.Timeout) * time.Second
+	}
+	if timeout <= 0 {
+		timeout = DEFAULT_MCP_TIMEOUT_SECONDS * time.Second
+	}
+
 	// Create context
-	ctx := context.Background()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
 
 	// Call the ReadResource method
 	response, err := connection.Client.ReadResource(ctx, map[string]interface{}{
 		"uri": uri,
 	})
 	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, fmt.Errorf("reading the resource timed out after %s", timeout)
+		}
 		return nil, err
 	}
 
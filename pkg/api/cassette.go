@@ -0,0 +1,283 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/pederhe/nca/pkg/api/types"
+)
+
+// A cassette records the streamed responses of the providers to a JSON file, and replays them in
+// the same order instead of calling the API. Tests of the tool loop use them to run without API
+// keys and get the same responses every time.
+
+// Cassette is a recording of API requests and their streamed responses
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+
+	path      string
+	replaying bool
+	// Index of the next interaction to replay
+	next  int
+	mutex sync.Mutex
+}
+
+// Interaction is a recorded request and its response
+type Interaction struct {
+	Provider string          `json:"provider"`
+	Model    string          `json:"model"`
+	Request  RecordedRequest `json:"request"`
+	// Chunks are the calls of the stream callback, in order
+	Chunks   []StreamChunk             `json:"chunks"`
+	Response *types.ChatStreamResponse `json:"response,omitempty"`
+	Error    string                    `json:"error,omitempty"`
+}
+
+// RecordedRequest is the part of a request that is recorded, to tell the interactions apart
+type RecordedRequest struct {
+	Messages []RecordedMessage `json:"messages"`
+	Tools    []string          `json:"tools,omitempty"` // Names of the tool definitions
+}
+
+// RecordedMessage is a message of a request, without the data of its images
+type RecordedMessage struct {
+	Role       string           `json:"role"`
+	Content    string           `json:"content"`
+	Images     int              `json:"images,omitempty"`
+	ToolCalls  []types.ToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string           `json:"tool_call_id,omitempty"`
+}
+
+// StreamChunk is a call of the stream callback
+type StreamChunk struct {
+	Reasoning string `json:"reasoning,omitempty"`
+	Content   string `json:"content,omitempty"`
+	Done      bool   `json:"done,omitempty"`
+}
+
+// The cassette the providers created by this package record to or replay from, if any
+var activeCassette *Cassette
+
+// NewCassette creates an empty cassette that is saved to path after every recorded interaction
+func NewCassette(path string) *Cassette {
+	return &Cassette{path: path}
+}
+
+// LoadCassette reads a recorded cassette for replaying it
+func LoadCassette(path string) (*Cassette, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cassette := &Cassette{path: path, replaying: true}
+	if err := json.Unmarshal(data, cassette); err != nil {
+		return nil, fmt.Errorf("invalid cassette %s: %w", path, err)
+	}
+	return cassette, nil
+}
+
+// RecordCassette makes the providers created afterwards record their responses to path
+func RecordCassette(path string) {
+	activeCassette = NewCassette(path)
+}
+
+// ReplayCassette makes the providers created afterwards replay the responses recorded in path
+// instead of calling the API, no API key is needed
+func ReplayCassette(path string) error {
+	cassette, err := LoadCassette(path)
+	if err != nil {
+		return err
+	}
+	activeCassette = cassette
+	return nil
+}
+
+// Save writes the cassette to its file
+func (c *Cassette) Save() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.save()
+}
+
+func (c *Cassette) save() error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	if dir := filepath.Dir(c.path); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	return os.WriteFile(c.path, append(data, '\n'), 0644)
+}
+
+// record appends an interaction and saves the cassette, so it survives an interrupted session
+func (c *Cassette) record(interaction Interaction) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.Interactions = append(c.Interactions, interaction)
+	return c.save()
+}
+
+// nextInteraction returns the next interaction to replay
+func (c *Cassette) nextInteraction() (Interaction, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.next >= len(c.Interactions) {
+		return Interaction{}, fmt.Errorf("cassette %s has no recorded response for request %d", c.path, c.next+1)
+	}
+	c.next++
+	return c.Interactions[c.next-1], nil
+}
+
+// NewRecordingProvider returns a provider that calls provider and records its responses to the
+// cassette
+func NewRecordingProvider(provider types.Provider, cassette *Cassette) types.Provider {
+	return wrapCassetteProvider(&cassetteProvider{provider: provider, cassette: cassette})
+}
+
+// NewReplayProvider returns a provider that replays the responses of the cassette. The name and
+// model info are the ones of provider, which is never called, or of the recording if it's nil.
+func NewReplayProvider(provider types.Provider, cassette *Cassette) types.Provider {
+	return wrapCassetteProvider(&cassetteProvider{provider: provider, cassette: cassette, replay: true})
+}
+
+// useActiveCassette wraps a provider to record to or replay from the active cassette
+func useActiveCassette(provider types.Provider) types.Provider {
+	if activeCassette == nil {
+		return provider
+	}
+	if activeCassette.replaying {
+		return NewReplayProvider(provider, activeCassette)
+	}
+	return NewRecordingProvider(provider, activeCassette)
+}
+
+// cassetteProvider records or replays the responses of a provider
+type cassetteProvider struct {
+	provider types.Provider
+	cassette *Cassette
+	replay   bool
+}
+
+// cassetteToolProvider is a cassetteProvider of a provider that supports native tool calling
+type cassetteToolProvider struct {
+	*cassetteProvider
+}
+
+// wrapCassetteProvider keeps whether the provider supports native tool calling
+func wrapCassetteProvider(p *cassetteProvider) types.Provider {
+	if _, ok := p.provider.(types.ToolCallingProvider); ok || (p.provider == nil && p.replay) {
+		return &cassetteToolProvider{p}
+	}
+	return p
+}
+
+// GetName returns the name of the provider
+func (p *cassetteProvider) GetName() string {
+	if p.provider != nil {
+		return p.provider.GetName()
+	}
+	if len(p.cassette.Interactions) > 0 {
+		return p.cassette.Interactions[0].Provider
+	}
+	return "replay"
+}
+
+// GetModelInfo returns information about the model
+func (p *cassetteProvider) GetModelInfo() *types.ModelInfo {
+	if p.provider != nil {
+		return p.provider.GetModelInfo()
+	}
+	modelInfo := &types.ModelInfo{Name: "replay"}
+	if len(p.cassette.Interactions) > 0 {
+		modelInfo.Name = p.cassette.Interactions[0].Model
+	}
+	return modelInfo
+}
+
+// ChatStream records or replays a conversation request
+func (p *cassetteProvider) ChatStream(ctx context.Context, messages []types.Message, callback func(string, string, bool)) (*types.ChatStreamResponse, error) {
+	return p.chatStream(ctx, messages, nil, callback, func(callback func(string, string, bool)) (*types.ChatStreamResponse, error) {
+		return p.provider.ChatStream(ctx, messages, callback)
+	})
+}
+
+// ChatStreamWithTools records or replays a conversation request with tool definitions
+func (p *cassetteToolProvider) ChatStreamWithTools(ctx context.Context, messages []types.Message, tools []types.ToolDefinition, callback func(string, string, bool)) (*types.ChatStreamResponse, error) {
+	return p.chatStream(ctx, messages, tools, callback, func(callback func(string, string, bool)) (*types.ChatStreamResponse, error) {
+		return p.provider.(types.ToolCallingProvider).ChatStreamWithTools(ctx, messages, tools, callback)
+	})
+}
+
+// chatStream replays the next interaction, or sends the request with send and records it
+func (p *cassetteProvider) chatStream(ctx context.Context, messages []types.Message, tools []types.ToolDefinition, callback func(string, string, bool), send func(func(string, string, bool)) (*types.ChatStreamResponse, error)) (*types.ChatStreamResponse, error) {
+	if p.replay {
+		return p.replayStream(ctx, callback)
+	}
+
+	interaction := Interaction{
+		Provider: p.provider.GetName(),
+		Model:    p.provider.GetModelInfo().Name,
+		Request:  recordRequest(messages, tools),
+	}
+	response, err := send(func(reasoning string, content string, done bool) {
+		interaction.Chunks = append(interaction.Chunks, StreamChunk{Reasoning: reasoning, Content: content, Done: done})
+		callback(reasoning, content, done)
+	})
+	interaction.Response = response
+	if err != nil {
+		interaction.Error = err.Error()
+	}
+	if recordErr := p.cassette.record(interaction); recordErr != nil {
+		fmt.Printf("Warning: Failed to save cassette %s: %s\n", p.cassette.path, recordErr)
+	}
+	return response, err
+}
+
+// replayStream calls the callback with the recorded chunks of the next interaction and returns its
+// response
+func (p *cassetteProvider) replayStream(ctx context.Context, callback func(string, string, bool)) (*types.ChatStreamResponse, error) {
+	interaction, err := p.cassette.nextInteraction()
+	if err != nil {
+		return nil, err
+	}
+	for _, chunk := range interaction.Chunks {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		callback(chunk.Reasoning, chunk.Content, chunk.Done)
+	}
+	if interaction.Error != "" {
+		return interaction.Response, errors.New(interaction.Error)
+	}
+	if interaction.Response == nil {
+		return &types.ChatStreamResponse{}, nil
+	}
+	response := *interaction.Response
+	return &response, nil
+}
+
+// recordRequest returns the recorded form of a request
+func recordRequest(messages []types.Message, tools []types.ToolDefinition) RecordedRequest {
+	request := RecordedRequest{Messages: make([]RecordedMessage, 0, len(messages))}
+	for _, message := range messages {
+		request.Messages = append(request.Messages, RecordedMessage{
+			Role:       message.Role,
+			Content:    message.Content,
+			Images:     len(message.Images),
+			ToolCalls:  message.ToolCalls,
+			ToolCallID: message.ToolCallID,
+		})
+	}
+	for _, tool := range tools {
+		request.Tools = append(request.Tools, tool.Function.Name)
+	}
+	return request
+}
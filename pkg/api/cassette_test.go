@@ -0,0 +1,124 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/pederhe/nca/pkg/api/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeProvider streams its responses in order
+type fakeProvider struct {
+	responses []*types.ChatStreamResponse
+	calls     int
+}
+
+func (p *fakeProvider) ChatStream(ctx context.Context, messages []types.Message, callback func(string, string, bool)) (*types.ChatStreamResponse, error) {
+	if p.calls >= len(p.responses) {
+		return nil, errors.New("rate limit exceeded")
+	}
+	response := p.responses[p.calls]
+	p.calls++
+	callback(response.ReasoningContent, "", false)
+	callback("", response.Content, false)
+	callback("", "", true)
+	return response, nil
+}
+
+func (p *fakeProvider) ChatStreamWithTools(ctx context.Context, messages []types.Message, tools []types.ToolDefinition, callback func(string, string, bool)) (*types.ChatStreamResponse, error) {
+	return p.ChatStream(ctx, messages, callback)
+}
+
+func (p *fakeProvider) GetName() string { return "fake" }
+
+func (p *fakeProvider) GetModelInfo() *types.ModelInfo { return &types.ModelInfo{Name: "fake-model"} }
+
+// collectStream returns the streamed reasoning and content of a request
+func collectStream(t *testing.T, client *Client, messages []types.Message, tools []types.ToolDefinition) (string, string, *types.ChatStreamResponse, error) {
+	t.Helper()
+	var reasoning, content string
+	response, err := client.ChatStreamWithTools(context.Background(), messages, tools, func(r string, c string, done bool) {
+		reasoning += r
+		content += c
+	})
+	return reasoning, content, response, err
+}
+
+func TestCassetteRecordAndReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fixtures", "task.json")
+	provider := &fakeProvider{responses: []*types.ChatStreamResponse{
+		{ReasoningContent: "Look at the file", Content: "<read_file><path>main.go</path></read_file>", FinishReason: "stop"},
+		{Content: "Done", Usage: &types.Usage{PromptTokens: 10, CompletionTokens: 2}},
+	}}
+	messages := []types.Message{{Role: "user", Content: "Fix main.go", Images: []types.Image{{MimeType: "image/png", Data: "AAAA"}}}}
+	tools := []types.ToolDefinition{{Type: "function", Function: types.FunctionDefinition{Name: "read_file"}}}
+
+	// Recording keeps native tool calling and the name and model of the provider
+	recorder := NewClientFromProvider(NewRecordingProvider(provider, NewCassette(path)))
+	assert.Equal(t, "fake", recorder.GetName())
+	for i := 0; i < 3; i++ {
+		_, _, _, err := collectStream(t, recorder, messages, tools)
+		if i < 2 {
+			require.NoError(t, err)
+		} else {
+			assert.EqualError(t, err, "rate limit exceeded")
+		}
+	}
+
+	cassette, err := LoadCassette(path)
+	require.NoError(t, err)
+	require.Len(t, cassette.Interactions, 3)
+	first := cassette.Interactions[0]
+	assert.Equal(t, "fake", first.Provider)
+	assert.Equal(t, "fake-model", first.Model)
+	assert.Equal(t, []RecordedMessage{{Role: "user", Content: "Fix main.go", Images: 1}}, first.Request.Messages)
+	assert.Equal(t, []string{"read_file"}, first.Request.Tools)
+	assert.Len(t, first.Chunks, 3)
+	assert.Equal(t, "rate limit exceeded", cassette.Interactions[2].Error)
+
+	// Replaying streams the same chunks and responses in order, without a provider
+	player := NewClientFromProvider(NewReplayProvider(nil, cassette))
+	assert.Equal(t, "fake", player.GetName())
+	assert.Equal(t, "fake-model", player.GetModelInfo().Name)
+
+	reasoning, content, response, err := collectStream(t, player, messages, tools)
+	require.NoError(t, err)
+	assert.Equal(t, "Look at the file", reasoning)
+	assert.Equal(t, "<read_file><path>main.go</path></read_file>", content)
+	assert.Equal(t, "stop", response.FinishReason)
+
+	_, content, response, err = collectStream(t, player, messages, tools)
+	require.NoError(t, err)
+	assert.Equal(t, "Done", content)
+	assert.Equal(t, 10, response.Usage.PromptTokens)
+
+	_, _, _, err = collectStream(t, player, messages, tools)
+	assert.EqualError(t, err, "rate limit exceeded")
+	_, _, _, err = collectStream(t, player, messages, tools)
+	assert.ErrorContains(t, err, "has no recorded response for request 4")
+}
+
+func TestReplayCassetteWithoutAPIKey(t *testing.T) {
+	t.Chdir(t.TempDir())
+	cassette := NewCassette("cassette.json")
+	require.NoError(t, cassette.record(Interaction{Provider: "openai", Model: "gpt-4o", Chunks: []StreamChunk{{Content: "Hi"}},
+		Response: &types.ChatStreamResponse{Content: "Hi"}}))
+
+	require.NoError(t, ReplayCassette("cassette.json"))
+	defer func() { activeCassette = nil }()
+
+	provider, err := newProvider(OpenAIProvider, "", "", "gpt-4o")
+	require.NoError(t, err)
+	_, ok := provider.(types.ToolCallingProvider)
+	assert.True(t, ok)
+	answer, err := NewClientFromProvider(provider).Complete(context.Background(), "Hello")
+	require.NoError(t, err)
+	assert.Equal(t, "Hi", answer)
+
+	_, err = LoadCassette("missing.json")
+	assert.Error(t, err)
+}
@@ -2,8 +2,11 @@ package api
 
 import (
 	"context"
+	"fmt"
+	"strings"
 
 	"github.com/pederhe/nca/pkg/api/types"
+	"github.com/pederhe/nca/pkg/config"
 )
 
 // Client is a wrapper around the AI provider
@@ -35,6 +38,48 @@ func NewClientWithProvider(providerType ProviderType) (*Client, error) {
 	}, nil
 }
 
+// NewClientFromProvider creates a new API client with a provider instance, e.g. a replay provider
+// in tests
+func NewClientFromProvider(provider types.Provider) *Client {
+	return &Client{
+		provider: provider,
+	}
+}
+
+// NewSummarizerClient creates a client for auxiliary calls like summaries and titles. It uses the
+// model of the summarize route, the cheaper model configured with "summarizer_model", or the main
+// model if neither is configured.
+func NewSummarizerClient() (*Client, error) {
+	return NewClientForRoute(RouteSummarize)
+}
+
+// newSummarizerModelClient creates a client with the model configured with "summarizer_model", or
+// the main model if none is configured
+func newSummarizerModelClient() (*Client, error) {
+	provider, configured, err := GetSummarizerProvider()
+	if !configured {
+		return NewClient()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("summarizer model: %w", err)
+	}
+
+	return &Client{
+		provider: provider,
+	}, nil
+}
+
+// Complete sends a single prompt and returns the text of the answer, for auxiliary calls that
+// don't stream their output to the user
+func (c *Client) Complete(ctx context.Context, prompt string) (string, error) {
+	messages := []types.Message{{Role: "user", Content: prompt}}
+	response, err := c.provider.ChatStream(ctx, messages, func(string, string, bool) {})
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(response.Content), nil
+}
+
 // ChatStream sends a streaming conversation request to the AI API
 func (c *Client) ChatStream(ctx context.Context, messages []types.Message, callback func(string, string, bool)) (*types.ChatStreamResponse, error) {
 	return c.provider.ChatStream(ctx, messages, callback)
@@ -47,3 +92,23 @@ func (c *Client) GetModelInfo() *types.ModelInfo {
 func (c *Client) GetName() string {
 	return c.provider.GetName()
 }
+
+// UseNativeTools returns whether tools are sent as function definitions instead of being described
+// in the system prompt. It is enabled with the config "tool_protocol" set to "native" for providers
+// that support function calling.
+func (c *Client) UseNativeTools() bool {
+	if config.Get("tool_protocol") != "native" {
+		return false
+	}
+	_, ok := c.provider.(types.ToolCallingProvider)
+	return ok
+}
+
+// ChatStreamWithTools sends a streaming conversation request with tool definitions to the AI API
+func (c *Client) ChatStreamWithTools(ctx context.Context, messages []types.Message, tools []types.ToolDefinition, callback func(string, string, bool)) (*types.ChatStreamResponse, error) {
+	provider, ok := c.provider.(types.ToolCallingProvider)
+	if !ok {
+		return nil, fmt.Errorf("provider %s does not support native tool calling", c.provider.GetName())
+	}
+	return provider.ChatStreamWithTools(ctx, messages, tools, callback)
+}
@@ -1,7 +1,9 @@
 package api
 
 import (
+	"errors"
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -20,13 +22,145 @@ const (
 	QwenProvider ProviderType = "qwen"
 	// DouBaoProvider is the DouBao AI provider
 	DouBaoProvider ProviderType = "doubao"
+	// AnthropicProvider is the Anthropic (Claude) AI provider
+	AnthropicProvider ProviderType = "anthropic"
+	// OpenAIProvider is the OpenAI provider, also used for OpenAI compatible APIs
+	OpenAIProvider ProviderType = "openai"
 )
 
+// Providers lists the supported providers
+var Providers = []ProviderType{DeepSeekProvider, QwenProvider, DouBaoProvider, AnthropicProvider, OpenAIProvider}
+
+// Configuration errors of the providers, NewClient wraps them so callers can guide the user
+var (
+	ErrMissingAPIKey       = errors.New("API key not set")
+	ErrUnsupportedProvider = errors.New("unsupported provider type")
+)
+
+// IsSupportedProvider returns whether a provider type is supported
+func IsSupportedProvider(providerType ProviderType) bool {
+	for _, supported := range Providers {
+		if supported == providerType {
+			return true
+		}
+	}
+	return false
+}
+
+// GetProviderModels returns the known models of a provider, starting with its default model.
+// OpenAI compatible endpoints accept other models as well.
+func GetProviderModels(providerType ProviderType) []string {
+	var defaultModel string
+	var models []string
+	switch providerType {
+	case DeepSeekProvider:
+		defaultModel = string(types.DeepSeekDefaultModelID)
+		for id := range types.DeepSeekModels {
+			models = append(models, string(id))
+		}
+	case QwenProvider:
+		defaultModel = string(types.MainlandQwenDefaultModelID)
+		seen := map[types.QwenModelID]bool{}
+		for _, qwenModels := range []map[types.QwenModelID]types.ModelInfo{types.MainlandQwenModels, types.InternationalQwenModels} {
+			for id := range qwenModels {
+				if !seen[id] {
+					seen[id] = true
+					models = append(models, string(id))
+				}
+			}
+		}
+	case DouBaoProvider:
+		defaultModel = string(types.DoubaoDefaultModelID)
+		for id := range types.DoubaoModels {
+			models = append(models, string(id))
+		}
+	case AnthropicProvider:
+		defaultModel = string(types.AnthropicDefaultModelID)
+		for id := range types.AnthropicModels {
+			models = append(models, string(id))
+		}
+	case OpenAIProvider:
+		defaultModel = string(types.OpenAIDefaultModelID)
+		for id := range types.OpenAIModels {
+			models = append(models, string(id))
+		}
+	default:
+		return nil
+	}
+
+	sort.Strings(models)
+	result := []string{defaultModel}
+	for _, model := range models {
+		if model != defaultModel {
+			result = append(result, model)
+		}
+	}
+	return result
+}
+
 // GetProvider returns a provider based on the provider type
 func GetProvider(providerType ProviderType) (types.Provider, error) {
+	if !IsSupportedProvider(providerType) {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedProvider, providerType)
+	}
+
+	// The api_key config takes precedence over the key stored for the provider by nca setup
 	apiKey := config.Get("api_key")
-	apiBaseURL := config.Get("api_base_url")
-	model := config.Get("model")
+	if apiKey == "" {
+		apiKey = config.GetCredential("api_key." + string(providerType))
+	}
+	return newProvider(providerType, apiKey, config.Get("api_base_url"), config.Get("model"))
+}
+
+// GetSummarizerProvider returns the provider of the model configured with "summarizer_model" for
+// auxiliary calls like summaries and titles, and false if none is configured. Its provider is set
+// with "summarizer_provider" or derived from the model name. The API key and base URL of the main
+// provider are only used if the summarizer uses the same provider.
+func GetSummarizerProvider() (types.Provider, bool, error) {
+	model := config.Get("summarizer_model")
+	if model == "" {
+		return nil, false, nil
+	}
+
+	mainProviderType := GetDefaultProviderType()
+	providerType := ProviderType(config.Get("summarizer_provider"))
+	if providerType == "" {
+		providerType = modelProviderType(model)
+	}
+	if providerType == "" {
+		providerType = mainProviderType
+	}
+	if !IsSupportedProvider(providerType) {
+		return nil, true, fmt.Errorf("%w: %s", ErrUnsupportedProvider, providerType)
+	}
+
+	apiKey := config.Get("summarizer_api_key")
+	apiBaseURL := config.Get("summarizer_api_base_url")
+	if providerType == mainProviderType {
+		if apiKey == "" {
+			apiKey = config.Get("api_key")
+		}
+		if apiBaseURL == "" {
+			apiBaseURL = config.Get("api_base_url")
+		}
+	}
+	if apiKey == "" {
+		apiKey = config.GetCredential("api_key." + string(providerType))
+	}
+	provider, err := newProvider(providerType, apiKey, apiBaseURL, model)
+	return provider, true, err
+}
+
+// newProvider creates a provider for a model, the other settings are shared by all models. It
+// records to or replays from the active cassette, if any.
+func newProvider(providerType ProviderType, apiKey string, apiBaseURL string, model string) (types.Provider, error) {
+	if activeCassette != nil && activeCassette.replaying && apiKey == "" {
+		// The API isn't called
+		apiKey = "replay"
+	}
+	if apiKey == "" {
+		return nil, fmt.Errorf("%w for %s provider", ErrMissingAPIKey, providerType)
+	}
 	temperatureStr := config.Get("temperature")
 
 	temperature := 0.0
@@ -52,41 +186,64 @@ func GetProvider(providerType ProviderType) (types.Provider, error) {
 		DisableStreamTimeout: disableStreamTimeout,
 	}
 
+	var provider types.Provider
+	var err error
 	switch providerType {
 	case DeepSeekProvider:
-		return providers.NewDeepSeekProvider(providerConfig)
+		provider, err = providers.NewDeepSeekProvider(providerConfig)
 	case QwenProvider:
-		return providers.NewQwenProvider(providerConfig)
+		provider, err = providers.NewQwenProvider(providerConfig)
 	case DouBaoProvider:
-		return providers.NewDouBaoProvider(providerConfig)
+		provider, err = providers.NewDouBaoProvider(providerConfig)
+	case AnthropicProvider:
+		provider, err = providers.NewAnthropicProvider(providerConfig)
+	case OpenAIProvider:
+		provider, err = providers.NewOpenAIProvider(providerConfig)
 	default:
 		return nil, fmt.Errorf("unsupported provider type: %s", providerType)
 	}
+	if err != nil {
+		return nil, err
+	}
+	return useActiveCassette(provider), nil
 }
 
-// GetDefaultProvider returns the default provider based on configuration
-func GetDefaultProvider() (types.Provider, error) {
+// GetDefaultProviderType returns the configured provider, or the provider of the configured model
+func GetDefaultProviderType() ProviderType {
 	providerName := config.Get("provider")
 	if providerName != "" {
-		return GetProvider(ProviderType(providerName))
+		return ProviderType(providerName)
 	}
 
 	// Determine provider based on model name keywords
-	model := config.Get("model")
-	if model != "" {
-		if strings.Contains(strings.ToLower(model), "deepseek") {
-			providerName = string(DeepSeekProvider)
-		} else if strings.Contains(strings.ToLower(model), "qwen") {
-			providerName = string(QwenProvider)
-		} else if strings.Contains(strings.ToLower(model), "doubao") {
-			providerName = string(DouBaoProvider)
-		}
-		// Additional model matching logic can be added here
+	if providerType := modelProviderType(config.Get("model")); providerType != "" {
+		return providerType
 	}
+	return DeepSeekProvider // Default to DeepSeek
+}
 
-	if providerName == "" {
-		providerName = string(DeepSeekProvider) // Default to DeepSeek
+// modelProviderType returns the provider of a model based on keywords in its name, or "" if unknown
+func modelProviderType(model string) ProviderType {
+	model = strings.ToLower(model)
+	switch {
+	case model == "":
+		return ""
+	case strings.Contains(model, "deepseek"):
+		return DeepSeekProvider
+	case strings.Contains(model, "qwen"):
+		return QwenProvider
+	case strings.Contains(model, "doubao"):
+		return DouBaoProvider
+	case strings.Contains(model, "claude"):
+		return AnthropicProvider
+	case strings.HasPrefix(model, "gpt-") || strings.HasPrefix(model, "o3") || strings.HasPrefix(model, "o4"):
+		return OpenAIProvider
 	}
+	// Additional model matching logic can be added here
+	return ""
+}
 
-	return GetProvider(ProviderType(providerName))
+// GetDefaultProvider returns the default provider based on configuration
+func GetDefaultProvider() (types.Provider, error) {
+	return GetProvider(GetDefaultProviderType())
 }
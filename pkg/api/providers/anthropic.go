@@ -0,0 +1,469 @@
+package providers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/pederhe/nca/pkg/api/types"
+)
+
+// Version of the Anthropic Messages API
+const anthropicAPIVersion = "2023-06-01"
+
+// Beta header enabling prompt caching
+const anthropicPromptCachingBeta = "prompt-caching-2024-07-31"
+
+// AnthropicProvider implements the Provider interface for Anthropic Claude models
+type AnthropicProvider struct {
+	apiKey               string
+	apiBaseURL           string
+	model                string
+	temperature          float64
+	disableStreamTimeout bool
+}
+
+// anthropicCacheControl marks the end of a cacheable prompt prefix
+type anthropicCacheControl struct {
+	Type string `json:"type"`
+}
+
+// anthropicContentBlock is a content block of a message or of the system prompt
+type anthropicContentBlock struct {
+	Type         string                 `json:"type"`
+	Text         string                 `json:"text,omitempty"`
+	Source       *anthropicImageSource  `json:"source,omitempty"`
+	ID           string                 `json:"id,omitempty"`
+	Name         string                 `json:"name,omitempty"`
+	Input        json.RawMessage        `json:"input,omitempty"`
+	ToolUseID    string                 `json:"tool_use_id,omitempty"`
+	Content      string                 `json:"content,omitempty"`
+	CacheControl *anthropicCacheControl `json:"cache_control,omitempty"`
+}
+
+// anthropicImageSource is the source of an image content block
+type anthropicImageSource struct {
+	Type      string `json:"type"`
+	MediaType string `json:"media_type"`
+	Data      string `json:"data"`
+}
+
+// anthropicMessage is a message of the Messages API
+type anthropicMessage struct {
+	Role    string                  `json:"role"`
+	Content []anthropicContentBlock `json:"content"`
+}
+
+// anthropicTool is a tool definition of the Messages API
+type anthropicTool struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	InputSchema map[string]interface{} `json:"input_schema"`
+}
+
+// anthropicChatRequest represents a request to the Anthropic Messages API
+type anthropicChatRequest struct {
+	Model       string                  `json:"model"`
+	System      []anthropicContentBlock `json:"system,omitempty"`
+	Messages    []anthropicMessage      `json:"messages"`
+	MaxTokens   int                     `json:"max_tokens"`
+	Stream      bool                    `json:"stream"`
+	Temperature float64                 `json:"temperature,omitempty"`
+	Tools       []anthropicTool         `json:"tools,omitempty"`
+}
+
+// anthropicUsage is the token usage reported by the Messages API
+type anthropicUsage struct {
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+}
+
+// anthropicStreamEvent represents a server-sent event of a streaming response
+type anthropicStreamEvent struct {
+	Type    string `json:"type"`
+	Index   int    `json:"index"`
+	Message *struct {
+		Usage anthropicUsage `json:"usage"`
+	} `json:"message,omitempty"`
+	ContentBlock *struct {
+		Type string `json:"type"`
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"content_block,omitempty"`
+	Delta *struct {
+		Type        string `json:"type"`
+		Text        string `json:"text"`
+		Thinking    string `json:"thinking"`
+		PartialJSON string `json:"partial_json"`
+		StopReason  string `json:"stop_reason"`
+	} `json:"delta,omitempty"`
+	Usage *anthropicUsage `json:"usage,omitempty"`
+	Error *struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+// NewAnthropicProvider creates a new Anthropic provider
+func NewAnthropicProvider(config types.ProviderConfig) (*AnthropicProvider, error) {
+	// Set default values if not provided
+	baseURL := config.APIBaseURL
+	if baseURL == "" {
+		baseURL = "https://api.anthropic.com/v1"
+	}
+
+	model := config.Model
+	if model == "" {
+		model = string(types.AnthropicDefaultModelID)
+	}
+
+	provider := &AnthropicProvider{
+		apiKey:               config.APIKey,
+		apiBaseURL:           strings.TrimSuffix(baseURL, "/"),
+		model:                model,
+		temperature:          config.Temperature,
+		disableStreamTimeout: config.DisableStreamTimeout,
+	}
+
+	if provider.GetModelInfo() == nil {
+		return nil, fmt.Errorf("%w: %s", types.ErrModelNotFound, model)
+	}
+
+	return provider, nil
+}
+
+// GetName returns the name of the provider
+func (p *AnthropicProvider) GetName() string {
+	return "anthropic"
+}
+
+// GetModelInfo returns information about the model
+func (p *AnthropicProvider) GetModelInfo() *types.ModelInfo {
+	modelInfo, ok := types.AnthropicModels[types.AnthropicModelID(p.model)]
+	if !ok {
+		return nil
+	}
+	modelInfo.Name = p.model
+	return &modelInfo
+}
+
+// convertAnthropicMessages converts messages to the Messages API format.
+// System messages become the system prompt, tool results are sent as user messages
+// and consecutive messages of the same role are merged, as the API requires alternating roles.
+// With cache the stable prefix of the prompt is marked as cacheable.
+func convertAnthropicMessages(messages []types.Message, cache bool) ([]anthropicContentBlock, []anthropicMessage) {
+	var system []anthropicContentBlock
+	var result []anthropicMessage
+
+	for _, msg := range messages {
+		if msg.Role == "system" {
+			system = append(system, anthropicContentBlock{Type: "text", Text: msg.Content})
+			continue
+		}
+
+		role := msg.Role
+		var blocks []anthropicContentBlock
+		switch {
+		case msg.Role == "tool":
+			role = "user"
+			blocks = append(blocks, anthropicContentBlock{Type: "tool_result", ToolUseID: msg.ToolCallID, Content: msg.Content})
+		case msg.Content != "":
+			blocks = append(blocks, anthropicContentBlock{Type: "text", Text: msg.Content})
+		}
+		for _, image := range msg.Images {
+			blocks = append(blocks, anthropicContentBlock{
+				Type:   "image",
+				Source: &anthropicImageSource{Type: "base64", MediaType: image.MimeType, Data: image.Data},
+			})
+		}
+		for _, call := range msg.ToolCalls {
+			input := json.RawMessage(call.Function.Arguments)
+			if !json.Valid(input) {
+				input = json.RawMessage("{}")
+			}
+			blocks = append(blocks, anthropicContentBlock{Type: "tool_use", ID: call.ID, Name: call.Function.Name, Input: input})
+		}
+		if len(blocks) == 0 {
+			continue
+		}
+
+		if len(result) > 0 && result[len(result)-1].Role == role {
+			last := &result[len(result)-1]
+			last.Content = append(last.Content, blocks...)
+			continue
+		}
+		result = append(result, anthropicMessage{Role: role, Content: blocks})
+	}
+
+	if !cache {
+		return system, result
+	}
+
+	// Cache the system prompt and the conversation up to the last user message,
+	// so the next request of an agent loop reads them from the cache
+	if len(system) > 0 {
+		system[len(system)-1].CacheControl = &anthropicCacheControl{Type: "ephemeral"}
+	}
+	for i := len(result) - 1; i >= 0; i-- {
+		if result[i].Role == "user" {
+			content := result[i].Content
+			content[len(content)-1].CacheControl = &anthropicCacheControl{Type: "ephemeral"}
+			break
+		}
+	}
+
+	return system, result
+}
+
+// convertAnthropicTools converts tool definitions to the Messages API format
+func convertAnthropicTools(tools []types.ToolDefinition) []anthropicTool {
+	if len(tools) == 0 {
+		return nil
+	}
+	result := make([]anthropicTool, 0, len(tools))
+	for _, tool := range tools {
+		result = append(result, anthropicTool{
+			Name:        tool.Function.Name,
+			Description: tool.Function.Description,
+			InputSchema: tool.Function.Parameters,
+		})
+	}
+	return result
+}
+
+// convertAnthropicStopReason maps a stop reason to the OpenAI style finish reason used by the other providers
+func convertAnthropicStopReason(stopReason string) string {
+	switch stopReason {
+	case "end_turn", "stop_sequence":
+		return "stop"
+	case "max_tokens":
+		return "length"
+	case "tool_use":
+		return "tool_calls"
+	default:
+		return stopReason
+	}
+}
+
+// ChatStream sends a streaming conversation request to the Anthropic API
+func (p *AnthropicProvider) ChatStream(ctx context.Context, messages []types.Message, callback func(string, string, bool)) (*types.ChatStreamResponse, error) {
+	return p.ChatStreamWithTools(ctx, messages, nil, callback)
+}
+
+// ChatStreamWithTools sends a streaming conversation request with tool definitions to the Anthropic API
+func (p *AnthropicProvider) ChatStreamWithTools(ctx context.Context, messages []types.Message, tools []types.ToolDefinition, callback func(string, string, bool)) (*types.ChatStreamResponse, error) {
+	if p.apiKey == "" {
+		return nil, fmt.Errorf("API key not set for Anthropic provider")
+	}
+
+	modelInfo := p.GetModelInfo()
+	maxTokens := 8192
+	if modelInfo.MaxTokens != nil {
+		maxTokens = *modelInfo.MaxTokens
+	}
+
+	system, anthropicMessages := convertAnthropicMessages(messages, modelInfo.SupportsPromptCache)
+	reqBody := anthropicChatRequest{
+		Model:       p.model,
+		System:      system,
+		Messages:    anthropicMessages,
+		MaxTokens:   maxTokens,
+		Stream:      true,
+		Temperature: p.temperature,
+		Tools:       convertAnthropicTools(tools),
+	}
+
+	jsonData, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create request with context
+	req, err := http.NewRequestWithContext(ctx, "POST", p.apiBaseURL+"/messages", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-api-key", p.apiKey)
+	req.Header.Set("anthropic-version", anthropicAPIVersion)
+	req.Header.Set("anthropic-beta", anthropicPromptCachingBeta)
+	req.Header.Set("Accept", "text/event-stream")
+
+	// Create an HTTP client for streaming requests
+	var streamClient *http.Client
+
+	if p.disableStreamTimeout {
+		// HTTP client without timeout
+		streamClient = &http.Client{
+			Timeout: 0, // 0 means no timeout
+		}
+	} else {
+		// Use a longer timeout for streaming
+		streamClient = &http.Client{
+			Timeout: types.StreamingTimeout,
+		}
+	}
+
+	resp, err := streamClient.Do(req)
+	if err != nil {
+		// Check if the error is due to context cancellation
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		// A prompt exceeding the context window is reported as an error
+		if strings.Contains(string(body), "prompt is too long") {
+			return &types.ChatStreamResponse{FinishReason: "length"}, nil
+		}
+		return nil, fmt.Errorf("Anthropic API error: %s", string(body))
+	}
+
+	reader := bufio.NewReader(resp.Body)
+	var fullContent strings.Builder
+	var fullReasoningContent strings.Builder
+	var usage anthropicUsage
+	var finishReason string
+	var toolCalls toolCallAccumulator
+
+	// Create a channel for handling context cancellation
+	done := make(chan struct{})
+	defer close(done)
+
+	// Monitor context cancellation in a goroutine
+	go func() {
+		select {
+		case <-ctx.Done():
+			// Context was cancelled, close the response body
+			resp.Body.Close()
+		case <-done:
+			// Normal completion, do nothing
+		}
+	}()
+
+	partialResponse := func() *types.ChatStreamResponse {
+		return &types.ChatStreamResponse{
+			ReasoningContent: fullReasoningContent.String(),
+			Content:          fullContent.String(),
+			Usage:            usage.toUsage(),
+			FinishReason:     finishReason,
+		}
+	}
+
+	for {
+		// Check if context has been cancelled
+		select {
+		case <-ctx.Done():
+			return partialResponse(), ctx.Err()
+		default:
+			// Continue processing
+		}
+
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			// Check if the error is due to context cancellation
+			if ctx.Err() != nil {
+				return partialResponse(), ctx.Err()
+			}
+			return partialResponse(), err
+		}
+
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "data: ") {
+			// Skip empty lines and "event:" lines, the event type is repeated in the data
+			continue
+		}
+
+		var event anthropicStreamEvent
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event); err != nil {
+			continue
+		}
+
+		switch event.Type {
+		case "message_start":
+			if event.Message != nil {
+				usage = event.Message.Usage
+			}
+		case "content_block_start":
+			if event.ContentBlock != nil && event.ContentBlock.Type == "tool_use" {
+				delta := types.ToolCallDelta{Index: event.Index, ID: event.ContentBlock.ID, Type: "function"}
+				delta.Function.Name = event.ContentBlock.Name
+				toolCalls.add([]types.ToolCallDelta{delta})
+			}
+		case "content_block_delta":
+			if event.Delta == nil {
+				continue
+			}
+			switch event.Delta.Type {
+			case "text_delta":
+				fullContent.WriteString(event.Delta.Text)
+				callback("", event.Delta.Text, false)
+			case "thinking_delta":
+				fullReasoningContent.WriteString(event.Delta.Thinking)
+				callback(event.Delta.Thinking, "", false)
+			case "input_json_delta":
+				delta := types.ToolCallDelta{Index: event.Index}
+				delta.Function.Arguments = event.Delta.PartialJSON
+				toolCalls.add([]types.ToolCallDelta{delta})
+			}
+		case "message_delta":
+			if event.Delta != nil && event.Delta.StopReason != "" {
+				finishReason = convertAnthropicStopReason(event.Delta.StopReason)
+			}
+			if event.Usage != nil {
+				usage.OutputTokens = event.Usage.OutputTokens
+			}
+		case "message_stop":
+			callback("", "", true)
+			return &types.ChatStreamResponse{
+				ReasoningContent: fullReasoningContent.String(),
+				Content:          fullContent.String(),
+				Usage:            usage.toUsage(),
+				FinishReason:     finishReason,
+				ToolCalls:        toolCalls.result(),
+			}, nil
+		case "error":
+			if event.Error != nil {
+				return partialResponse(), fmt.Errorf("Anthropic API error: %s: %s", event.Error.Type, event.Error.Message)
+			}
+		}
+	}
+
+	return &types.ChatStreamResponse{
+		ReasoningContent: fullReasoningContent.String(),
+		Content:          fullContent.String(),
+		Usage:            usage.toUsage(),
+		FinishReason:     finishReason,
+		ToolCalls:        toolCalls.result(),
+	}, nil
+}
+
+// toUsage converts the usage to the common format, cached input tokens count as prompt tokens
+func (u anthropicUsage) toUsage() *types.Usage {
+	promptTokens := u.InputTokens + u.CacheCreationInputTokens + u.CacheReadInputTokens
+	if promptTokens == 0 && u.OutputTokens == 0 {
+		return nil
+	}
+	return &types.Usage{
+		PromptTokens:     promptTokens,
+		CompletionTokens: u.OutputTokens,
+		TotalTokens:      promptTokens + u.OutputTokens,
+		CacheReadTokens:  u.CacheReadInputTokens,
+		CacheWriteTokens: u.CacheCreationInputTokens,
+	}
+}
@@ -32,6 +32,7 @@ type deepSeekChatRequest struct {
 	StreamOptions *struct {
 		IncludeUsage bool `json:"include_usage,omitempty"`
 	} `json:"stream_options,omitempty"`
+	Tools []types.ToolDefinition `json:"tools,omitempty"`
 }
 
 // StreamResponse represents a streaming response chunk from DeepSeek
@@ -41,9 +42,10 @@ type deepSeekStreamResponse struct {
 	Created int64  `json:"created"`
 	Choices []struct {
 		Delta struct {
-			Role             string `json:"role"`
-			Content          string `json:"content"`
-			ReasoningContent string `json:"reasoning_content"`
+			Role             string                `json:"role"`
+			Content          string                `json:"content"`
+			ReasoningContent string                `json:"reasoning_content"`
+			ToolCalls        []types.ToolCallDelta `json:"tool_calls"`
 		} `json:"delta"`
 		FinishReason string `json:"finish_reason"`
 	} `json:"choices"`
@@ -77,7 +79,7 @@ func NewDeepSeekProvider(config types.ProviderConfig) (*DeepSeekProvider, error)
 	}
 
 	if provider.GetModelInfo() == nil {
-		return nil, fmt.Errorf("model %s not found", model)
+		return nil, fmt.Errorf("%w: %s", types.ErrModelNotFound, model)
 	}
 
 	return provider, nil
@@ -100,6 +102,11 @@ func (p *DeepSeekProvider) GetModelInfo() *types.ModelInfo {
 
 // ChatStream sends a streaming conversation request to the DeepSeek API
 func (p *DeepSeekProvider) ChatStream(ctx context.Context, messages []types.Message, callback func(string, string, bool)) (*types.ChatStreamResponse, error) {
+	return p.ChatStreamWithTools(ctx, messages, nil, callback)
+}
+
+// ChatStreamWithTools sends a streaming conversation request with tool definitions to the DeepSeek API
+func (p *DeepSeekProvider) ChatStreamWithTools(ctx context.Context, messages []types.Message, tools []types.ToolDefinition, callback func(string, string, bool)) (*types.ChatStreamResponse, error) {
 	if p.apiKey == "" {
 		return nil, fmt.Errorf("API key not set for DeepSeek provider")
 	}
@@ -107,6 +114,7 @@ func (p *DeepSeekProvider) ChatStream(ctx context.Context, messages []types.Mess
 	reqBody := deepSeekChatRequest{
 		Model:       p.model,
 		Messages:    messages,
+		Tools:       tools,
 		Stream:      true,
 		Temperature: p.temperature,
 		StreamOptions: &struct {
@@ -166,6 +174,7 @@ func (p *DeepSeekProvider) ChatStream(ctx context.Context, messages []types.Mess
 	var fullReasoningContent strings.Builder
 	var finalUsage *types.Usage
 	var finishReason string
+	var toolCalls toolCallAccumulator
 
 	// Create a channel for handling context cancellation
 	done := make(chan struct{})
@@ -264,6 +273,8 @@ func (p *DeepSeekProvider) ChatStream(ctx context.Context, messages []types.Mess
 			fullContent.WriteString(content)
 		}
 
+		toolCalls.add(streamResp.Choices[0].Delta.ToolCalls)
+
 		if isDone {
 			finishReason = streamResp.Choices[0].FinishReason
 			if streamResp.Usage != nil {
@@ -279,5 +290,6 @@ func (p *DeepSeekProvider) ChatStream(ctx context.Context, messages []types.Mess
 		Content:          fullContent.String(),
 		Usage:            finalUsage,
 		FinishReason:     finishReason,
+		ToolCalls:        toolCalls.result(),
 	}, nil
 }
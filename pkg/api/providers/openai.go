@@ -0,0 +1,327 @@
+package providers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/pederhe/nca/pkg/api/types"
+)
+
+// OpenAIProvider implements the Provider interface for OpenAI and OpenAI compatible APIs
+// such as Azure OpenAI, OpenRouter or a local vLLM server
+type OpenAIProvider struct {
+	apiKey               string
+	apiBaseURL           string
+	model                string
+	temperature          float64
+	disableStreamTimeout bool
+}
+
+// ChatRequest represents a request to the OpenAI chat completions API
+type openAIChatRequest struct {
+	Model         string          `json:"model"`
+	Messages      []types.Message `json:"messages"`
+	MaxTokens     int             `json:"max_tokens,omitempty"`
+	Stream        bool            `json:"stream,omitempty"`
+	Temperature   float64         `json:"temperature,omitempty"`
+	StreamOptions *struct {
+		IncludeUsage bool `json:"include_usage,omitempty"`
+	} `json:"stream_options,omitempty"`
+	Tools []types.ToolDefinition `json:"tools,omitempty"`
+}
+
+// StreamResponse represents a streaming response chunk from an OpenAI compatible API
+type openAIStreamResponse struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	Created int64  `json:"created"`
+	Model   string `json:"model"`
+	Choices []struct {
+		Delta struct {
+			Role             string                `json:"role"`
+			Content          string                `json:"content"`
+			ReasoningContent string                `json:"reasoning_content"` // vLLM, DeepSeek
+			Reasoning        string                `json:"reasoning"`         // OpenRouter
+			ToolCalls        []types.ToolCallDelta `json:"tool_calls"`
+		} `json:"delta"`
+		FinishReason *string `json:"finish_reason"`
+		Index        int     `json:"index"`
+	} `json:"choices"`
+	Usage *types.Usage `json:"usage,omitempty"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+// NewOpenAIProvider creates a new OpenAI compatible provider
+func NewOpenAIProvider(config types.ProviderConfig) (*OpenAIProvider, error) {
+	// Set default values if not provided
+	baseURL := config.APIBaseURL
+	if baseURL == "" {
+		baseURL = "https://api.openai.com/v1"
+	}
+
+	model := config.Model
+	if model == "" {
+		model = string(types.OpenAIDefaultModelID)
+	}
+
+	return &OpenAIProvider{
+		apiKey:               config.APIKey,
+		apiBaseURL:           baseURL,
+		model:                model,
+		temperature:          config.Temperature,
+		disableStreamTimeout: config.DisableStreamTimeout,
+	}, nil
+}
+
+// GetName returns the name of the provider
+func (p *OpenAIProvider) GetName() string {
+	return "openai"
+}
+
+// GetModelInfo returns information about the model, models served by compatible
+// endpoints are not known in advance and get conservative defaults
+func (p *OpenAIProvider) GetModelInfo() *types.ModelInfo {
+	modelInfo, ok := types.OpenAIModels[types.OpenAIModelID(p.model)]
+	if !ok {
+		modelInfo = types.OpenAICompatibleModelInfo
+	}
+	modelInfo.Name = p.model
+	return &modelInfo
+}
+
+// isAzure returns whether the base URL points to Azure OpenAI, which uses a different auth header
+func (p *OpenAIProvider) isAzure() bool {
+	parsed, err := url.Parse(p.apiBaseURL)
+	return err == nil && strings.HasSuffix(parsed.Hostname(), ".openai.azure.com")
+}
+
+// getChatCompletionsURL returns the endpoint URL. Query parameters of the base URL
+// (e.g. api-version for Azure OpenAI) are kept.
+func (p *OpenAIProvider) getChatCompletionsURL() string {
+	parsed, err := url.Parse(p.apiBaseURL)
+	if err != nil {
+		return strings.TrimSuffix(p.apiBaseURL, "/") + "/chat/completions"
+	}
+	parsed.Path = strings.TrimSuffix(parsed.Path, "/") + "/chat/completions"
+	return parsed.String()
+}
+
+// ChatStream sends a streaming conversation request to the OpenAI compatible API
+func (p *OpenAIProvider) ChatStream(ctx context.Context, messages []types.Message, callback func(string, string, bool)) (*types.ChatStreamResponse, error) {
+	return p.ChatStreamWithTools(ctx, messages, nil, callback)
+}
+
+// ChatStreamWithTools sends a streaming conversation request with tool definitions to the OpenAI compatible API
+func (p *OpenAIProvider) ChatStreamWithTools(ctx context.Context, messages []types.Message, tools []types.ToolDefinition, callback func(string, string, bool)) (*types.ChatStreamResponse, error) {
+	// Local servers usually don't need an API key
+	if p.apiKey == "" && p.apiBaseURL == "https://api.openai.com/v1" {
+		return nil, fmt.Errorf("API key not set for OpenAI provider")
+	}
+
+	reqBody := openAIChatRequest{
+		Model:       p.model,
+		Messages:    messages,
+		Tools:       tools,
+		Stream:      true,
+		Temperature: p.temperature,
+		StreamOptions: &struct {
+			IncludeUsage bool `json:"include_usage,omitempty"`
+		}{
+			IncludeUsage: true,
+		},
+	}
+
+	jsonData, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create request with context
+	req, err := http.NewRequestWithContext(ctx, "POST", p.getChatCompletionsURL(), bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if p.apiKey != "" {
+		if p.isAzure() {
+			req.Header.Set("api-key", p.apiKey)
+		} else {
+			req.Header.Set("Authorization", "Bearer "+p.apiKey)
+		}
+	}
+	req.Header.Set("Accept", "text/event-stream")
+
+	// Create an HTTP client for streaming requests
+	var streamClient *http.Client
+
+	if p.disableStreamTimeout {
+		// HTTP client without timeout
+		streamClient = &http.Client{
+			Timeout: 0, // 0 means no timeout
+		}
+	} else {
+		// Use a longer timeout for streaming
+		streamClient = &http.Client{
+			Timeout: types.StreamingTimeout,
+		}
+	}
+
+	resp, err := streamClient.Do(req)
+	if err != nil {
+		// Check if the error is due to context cancellation
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		// A prompt exceeding the context window is reported as an error
+		if strings.Contains(string(body), "context_length_exceeded") || strings.Contains(string(body), "maximum context length") {
+			return &types.ChatStreamResponse{FinishReason: "length"}, nil
+		}
+		return nil, fmt.Errorf("OpenAI API error: %s", string(body))
+	}
+
+	reader := bufio.NewReader(resp.Body)
+	var fullContent strings.Builder
+	var fullReasoningContent strings.Builder
+	var finalUsage *types.Usage
+	var finishReason string
+	var toolCalls toolCallAccumulator
+
+	// Create a channel for handling context cancellation
+	done := make(chan struct{})
+	defer close(done)
+
+	// Monitor context cancellation in a goroutine
+	go func() {
+		select {
+		case <-ctx.Done():
+			// Context was cancelled, close the response body
+			resp.Body.Close()
+		case <-done:
+			// Normal completion, do nothing
+		}
+	}()
+
+	for {
+		// Check if context has been cancelled
+		select {
+		case <-ctx.Done():
+			return &types.ChatStreamResponse{
+				ReasoningContent: fullReasoningContent.String(),
+				Content:          fullContent.String(),
+				Usage:            finalUsage,
+				FinishReason:     finishReason,
+			}, ctx.Err()
+		default:
+			// Continue processing
+		}
+
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			// Check if the error is due to context cancellation
+			if ctx.Err() != nil {
+				return &types.ChatStreamResponse{
+					ReasoningContent: fullReasoningContent.String(),
+					Content:          fullContent.String(),
+					Usage:            finalUsage,
+					FinishReason:     finishReason,
+				}, ctx.Err()
+			}
+			return &types.ChatStreamResponse{
+				ReasoningContent: fullReasoningContent.String(),
+				Content:          fullContent.String(),
+				Usage:            finalUsage,
+				FinishReason:     finishReason,
+			}, err
+		}
+
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		if line == "data: [DONE]" {
+			break
+		}
+
+		if !strings.HasPrefix(line, "data: ") {
+			continue
+		}
+
+		data := strings.TrimPrefix(line, "data: ")
+		var streamResp openAIStreamResponse
+		if err := json.Unmarshal([]byte(data), &streamResp); err != nil {
+			continue
+		}
+
+		if streamResp.Error != nil {
+			return &types.ChatStreamResponse{
+				ReasoningContent: fullReasoningContent.String(),
+				Content:          fullContent.String(),
+				Usage:            finalUsage,
+				FinishReason:     finishReason,
+			}, fmt.Errorf("OpenAI API error: %s", streamResp.Error.Message)
+		}
+
+		// Usage is sent in a separate chunk without choices after the finish reason,
+		// some servers add it to the last chunk instead
+		if streamResp.Usage != nil {
+			finalUsage = streamResp.Usage
+		}
+
+		// Chunks without choices (usage, Azure content filter results) carry no content
+		if len(streamResp.Choices) == 0 {
+			continue
+		}
+
+		choice := streamResp.Choices[0]
+		reasoningContent := choice.Delta.ReasoningContent
+		if reasoningContent == "" {
+			reasoningContent = choice.Delta.Reasoning
+		}
+		content := choice.Delta.Content
+		isDone := choice.FinishReason != nil && *choice.FinishReason != ""
+
+		if reasoningContent != "" {
+			fullReasoningContent.WriteString(reasoningContent)
+		}
+
+		if content != "" {
+			fullContent.WriteString(content)
+		}
+
+		toolCalls.add(choice.Delta.ToolCalls)
+
+		if isDone {
+			finishReason = *choice.FinishReason
+		}
+
+		callback(reasoningContent, content, isDone)
+	}
+
+	return &types.ChatStreamResponse{
+		ReasoningContent: fullReasoningContent.String(),
+		Content:          fullContent.String(),
+		Usage:            finalUsage,
+		FinishReason:     finishReason,
+		ToolCalls:        toolCalls.result(),
+	}, nil
+}
@@ -32,6 +32,7 @@ type qwenChatRequest struct {
 	StreamOptions *struct {
 		IncludeUsage bool `json:"include_usage,omitempty"`
 	} `json:"stream_options,omitempty"`
+	Tools []types.ToolDefinition `json:"tools,omitempty"`
 }
 
 // StreamResponse represents a streaming response chunk from Qwen
@@ -42,9 +43,10 @@ type qwenStreamResponse struct {
 	Model   string `json:"model"`
 	Choices []struct {
 		Delta struct {
-			Role             string `json:"role"`
-			Content          string `json:"content"`
-			ReasoningContent string `json:"reasoning_content"`
+			Role             string                `json:"role"`
+			Content          string                `json:"content"`
+			ReasoningContent string                `json:"reasoning_content"`
+			ToolCalls        []types.ToolCallDelta `json:"tool_calls"`
 		} `json:"delta"`
 		FinishReason string `json:"finish_reason"`
 		Index        int    `json:"index"`
@@ -79,7 +81,7 @@ func NewQwenProvider(config types.ProviderConfig) (*QwenProvider, error) {
 	}
 
 	if provider.GetModelInfo() == nil {
-		return nil, fmt.Errorf("model %s not found", model)
+		return nil, fmt.Errorf("%w: %s", types.ErrModelNotFound, model)
 	}
 
 	return provider, nil
@@ -105,6 +107,11 @@ func (p *QwenProvider) GetModelInfo() *types.ModelInfo {
 
 // ChatStream sends a streaming conversation request to the Qwen API
 func (p *QwenProvider) ChatStream(ctx context.Context, messages []types.Message, callback func(string, string, bool)) (*types.ChatStreamResponse, error) {
+	return p.ChatStreamWithTools(ctx, messages, nil, callback)
+}
+
+// ChatStreamWithTools sends a streaming conversation request with tool definitions to the Qwen API
+func (p *QwenProvider) ChatStreamWithTools(ctx context.Context, messages []types.Message, tools []types.ToolDefinition, callback func(string, string, bool)) (*types.ChatStreamResponse, error) {
 	if p.apiKey == "" {
 		return nil, fmt.Errorf("API key not set for Qwen provider")
 	}
@@ -112,6 +119,7 @@ func (p *QwenProvider) ChatStream(ctx context.Context, messages []types.Message,
 	reqBody := qwenChatRequest{
 		Model:       p.model,
 		Messages:    messages,
+		Tools:       tools,
 		Stream:      true,
 		Temperature: p.temperature,
 		StreamOptions: &struct {
@@ -171,6 +179,7 @@ func (p *QwenProvider) ChatStream(ctx context.Context, messages []types.Message,
 	var fullReasoningContent strings.Builder
 	var finalUsage *types.Usage
 	var finishReason string
+	var toolCalls toolCallAccumulator
 
 	// Create a channel for handling context cancellation
 	done := make(chan struct{})
@@ -264,6 +273,8 @@ func (p *QwenProvider) ChatStream(ctx context.Context, messages []types.Message,
 			fullContent.WriteString(content)
 		}
 
+		toolCalls.add(streamResp.Choices[0].Delta.ToolCalls)
+
 		if isDone {
 			finishReason = streamResp.Choices[0].FinishReason
 			if streamResp.Usage != nil {
@@ -279,5 +290,6 @@ func (p *QwenProvider) ChatStream(ctx context.Context, messages []types.Message,
 		Content:          fullContent.String(),
 		Usage:            finalUsage,
 		FinishReason:     finishReason,
+		ToolCalls:        toolCalls.result(),
 	}, nil
 }
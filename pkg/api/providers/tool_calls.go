@@ -0,0 +1,53 @@
+package providers
+
+import (
+	"sort"
+
+	"github.com/pederhe/nca/pkg/api/types"
+)
+
+// toolCallAccumulator assembles tool calls from the chunks of a streaming response
+type toolCallAccumulator struct {
+	calls map[int]*types.ToolCall
+}
+
+// add merges tool call chunks into the accumulated calls
+func (a *toolCallAccumulator) add(deltas []types.ToolCallDelta) {
+	for _, delta := range deltas {
+		if a.calls == nil {
+			a.calls = make(map[int]*types.ToolCall)
+		}
+		call, ok := a.calls[delta.Index]
+		if !ok {
+			call = &types.ToolCall{Type: "function"}
+			a.calls[delta.Index] = call
+		}
+		if delta.ID != "" {
+			call.ID = delta.ID
+		}
+		if delta.Type != "" {
+			call.Type = delta.Type
+		}
+		call.Function.Name += delta.Function.Name
+		call.Function.Arguments += delta.Function.Arguments
+	}
+}
+
+// result returns the accumulated tool calls ordered by index
+func (a *toolCallAccumulator) result() []types.ToolCall {
+	if len(a.calls) == 0 {
+		return nil
+	}
+
+	indexes := make([]int, 0, len(a.calls))
+	for index := range a.calls {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+
+	calls := make([]types.ToolCall, 0, len(indexes))
+	for _, index := range indexes {
+		calls = append(calls, *a.calls[index])
+	}
+	return calls
+}
@@ -0,0 +1,86 @@
+package api
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pederhe/nca/pkg/api/types"
+	"github.com/pederhe/nca/pkg/config"
+)
+
+// Routes of requests that can use their own model, configured with router.<route>
+const (
+	// RouteEdit is for the requests of Agent mode tasks, which edit code
+	RouteEdit = "edit"
+	// RouteAsk is for the requests of Ask mode
+	RouteAsk = "ask"
+	// RoutePlan is for the requests of tasks in plan mode
+	RoutePlan = "plan"
+	// RouteSummarize is for auxiliary requests like summaries and titles
+	RouteSummarize = "summarize"
+	// RouteReview is for the requests of nca review
+	RouteReview = "review"
+)
+
+// Routes lists the routes that can be configured
+var Routes = []string{RouteEdit, RouteAsk, RoutePlan, RouteSummarize, RouteReview}
+
+// GetRouteModel returns the model configured for a route and its provider. The model may be
+// prefixed with the provider, e.g. "openai:gpt-4o", otherwise the provider is derived from its
+// name or is the main provider.
+func GetRouteModel(route string) (string, ProviderType) {
+	model := strings.TrimSpace(config.Get("router." + route))
+	if model == "" {
+		return "", ""
+	}
+	if prefix, name, found := strings.Cut(model, ":"); found && IsSupportedProvider(ProviderType(prefix)) {
+		return name, ProviderType(prefix)
+	}
+	if providerType := modelProviderType(model); providerType != "" {
+		return model, providerType
+	}
+	return model, GetDefaultProviderType()
+}
+
+// GetRouteProvider returns the provider of the model configured for a route, and false if none is
+// configured. The API key and base URL of the main provider are used if the model has the same
+// provider, otherwise the key stored for its provider by nca setup and its default URL.
+func GetRouteProvider(route string) (types.Provider, bool, error) {
+	model, providerType := GetRouteModel(route)
+	if model == "" {
+		return nil, false, nil
+	}
+	if !IsSupportedProvider(providerType) {
+		return nil, true, fmt.Errorf("%w: %s", ErrUnsupportedProvider, providerType)
+	}
+
+	apiKey, apiBaseURL := "", ""
+	if providerType == GetDefaultProviderType() {
+		apiKey = config.Get("api_key")
+		apiBaseURL = config.Get("api_base_url")
+	}
+	if apiKey == "" {
+		apiKey = config.GetCredential("api_key." + string(providerType))
+	}
+	provider, err := newProvider(providerType, apiKey, apiBaseURL, model)
+	return provider, true, err
+}
+
+// NewClientForRoute creates a client with the model configured for a route. Without one the
+// summarize route uses the summarizer model, and the others use the main model.
+func NewClientForRoute(route string) (*Client, error) {
+	provider, configured, err := GetRouteProvider(route)
+	if !configured {
+		if route == RouteSummarize {
+			return newSummarizerModelClient()
+		}
+		return NewClient()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("router.%s model: %w", route, err)
+	}
+
+	return &Client{
+		provider: provider,
+	}, nil
+}
@@ -525,6 +525,158 @@ var MainlandQwenModels = map[QwenModelID]ModelInfo{
 	},
 }
 
+// AnthropicModelID represents the type of Anthropic model IDs
+type AnthropicModelID string
+
+const (
+	// AnthropicDefaultModelID is the default model ID for Anthropic
+	AnthropicDefaultModelID AnthropicModelID = "claude-sonnet-4-20250514"
+)
+
+// AnthropicModels contains information about all available Anthropic models
+var AnthropicModels = map[AnthropicModelID]ModelInfo{
+	"claude-opus-4-20250514": {
+		MaxTokens:           ptr(32000),
+		ContextWindow:       ptr(200000),
+		SupportsImages:      ptr(true),
+		SupportsPromptCache: true,
+		InputPrice:          ptr(15.0),
+		OutputPrice:         ptr(75.0),
+		CacheWritesPrice:    ptr(18.75),
+		CacheReadsPrice:     ptr(1.5),
+	},
+	"claude-sonnet-4-20250514": {
+		MaxTokens:           ptr(64000),
+		ContextWindow:       ptr(200000),
+		SupportsImages:      ptr(true),
+		SupportsPromptCache: true,
+		InputPrice:          ptr(3.0),
+		OutputPrice:         ptr(15.0),
+		CacheWritesPrice:    ptr(3.75),
+		CacheReadsPrice:     ptr(0.3),
+	},
+	"claude-3-7-sonnet-20250219": {
+		MaxTokens:           ptr(8192),
+		ContextWindow:       ptr(200000),
+		SupportsImages:      ptr(true),
+		SupportsPromptCache: true,
+		InputPrice:          ptr(3.0),
+		OutputPrice:         ptr(15.0),
+		CacheWritesPrice:    ptr(3.75),
+		CacheReadsPrice:     ptr(0.3),
+	},
+	"claude-3-5-sonnet-20241022": {
+		MaxTokens:           ptr(8192),
+		ContextWindow:       ptr(200000),
+		SupportsImages:      ptr(true),
+		SupportsPromptCache: true,
+		InputPrice:          ptr(3.0),
+		OutputPrice:         ptr(15.0),
+		CacheWritesPrice:    ptr(3.75),
+		CacheReadsPrice:     ptr(0.3),
+	},
+	"claude-3-5-haiku-20241022": {
+		MaxTokens:           ptr(8192),
+		ContextWindow:       ptr(200000),
+		SupportsImages:      ptr(false),
+		SupportsPromptCache: true,
+		InputPrice:          ptr(0.8),
+		OutputPrice:         ptr(4.0),
+		CacheWritesPrice:    ptr(1.0),
+		CacheReadsPrice:     ptr(0.08),
+	},
+	"claude-3-opus-20240229": {
+		MaxTokens:           ptr(4096),
+		ContextWindow:       ptr(200000),
+		SupportsImages:      ptr(true),
+		SupportsPromptCache: true,
+		InputPrice:          ptr(15.0),
+		OutputPrice:         ptr(75.0),
+		CacheWritesPrice:    ptr(18.75),
+		CacheReadsPrice:     ptr(1.5),
+	},
+}
+
+// OpenAIModelID represents the type of OpenAI model IDs
+type OpenAIModelID string
+
+const (
+	// OpenAIDefaultModelID is the default model ID for OpenAI
+	OpenAIDefaultModelID OpenAIModelID = "gpt-4.1"
+)
+
+// OpenAIModels contains information about all known OpenAI models
+var OpenAIModels = map[OpenAIModelID]ModelInfo{
+	"gpt-4.1": {
+		MaxTokens:           ptr(32768),
+		ContextWindow:       ptr(1047576),
+		SupportsImages:      ptr(true),
+		SupportsPromptCache: true,
+		InputPrice:          ptr(2.0),
+		OutputPrice:         ptr(8.0),
+		CacheWritesPrice:    ptr(0.0),
+		CacheReadsPrice:     ptr(0.5),
+	},
+	"gpt-4.1-mini": {
+		MaxTokens:           ptr(32768),
+		ContextWindow:       ptr(1047576),
+		SupportsImages:      ptr(true),
+		SupportsPromptCache: true,
+		InputPrice:          ptr(0.4),
+		OutputPrice:         ptr(1.6),
+		CacheWritesPrice:    ptr(0.0),
+		CacheReadsPrice:     ptr(0.1),
+	},
+	"gpt-4o": {
+		MaxTokens:           ptr(16384),
+		ContextWindow:       ptr(128000),
+		SupportsImages:      ptr(true),
+		SupportsPromptCache: true,
+		InputPrice:          ptr(2.5),
+		OutputPrice:         ptr(10.0),
+		CacheWritesPrice:    ptr(0.0),
+		CacheReadsPrice:     ptr(1.25),
+	},
+	"gpt-4o-mini": {
+		MaxTokens:           ptr(16384),
+		ContextWindow:       ptr(128000),
+		SupportsImages:      ptr(true),
+		SupportsPromptCache: true,
+		InputPrice:          ptr(0.15),
+		OutputPrice:         ptr(0.6),
+		CacheWritesPrice:    ptr(0.0),
+		CacheReadsPrice:     ptr(0.075),
+	},
+	"o3-mini": {
+		MaxTokens:           ptr(100000),
+		ContextWindow:       ptr(200000),
+		SupportsImages:      ptr(false),
+		SupportsPromptCache: true,
+		InputPrice:          ptr(1.1),
+		OutputPrice:         ptr(4.4),
+		CacheWritesPrice:    ptr(0.0),
+		CacheReadsPrice:     ptr(0.55),
+	},
+	"o4-mini": {
+		MaxTokens:           ptr(100000),
+		ContextWindow:       ptr(200000),
+		SupportsImages:      ptr(true),
+		SupportsPromptCache: true,
+		InputPrice:          ptr(1.1),
+		OutputPrice:         ptr(4.4),
+		CacheWritesPrice:    ptr(0.0),
+		CacheReadsPrice:     ptr(0.275),
+	},
+}
+
+// OpenAICompatibleModelInfo is used for models of OpenAI compatible endpoints that are not listed above
+var OpenAICompatibleModelInfo = ModelInfo{
+	MaxTokens:           ptr(8192),
+	ContextWindow:       ptr(128000),
+	SupportsImages:      ptr(false),
+	SupportsPromptCache: false,
+}
+
 // Helper function to create pointers to values
 func ptr[T any](v T) *T {
 	return &v
@@ -2,27 +2,141 @@ package types
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"time"
 )
 
 // Message represents a message in a conversation
 type Message struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+	Role       string     `json:"role"`
+	Content    string     `json:"content"`
+	Images     []Image    `json:"-"` // Only sent to models that support images
+	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string     `json:"tool_call_id,omitempty"` // Set for "tool" role messages
+}
+
+// ToolDefinition describes a tool for providers that support native function calling
+type ToolDefinition struct {
+	Type     string             `json:"type"` // Always "function"
+	Function FunctionDefinition `json:"function"`
+}
+
+// FunctionDefinition is the function part of a tool definition
+type FunctionDefinition struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	Parameters  map[string]interface{} `json:"parameters"` // JSON schema of the arguments
+}
+
+// ToolCall is a function call requested by the model
+type ToolCall struct {
+	ID       string       `json:"id"`
+	Type     string       `json:"type"`
+	Function FunctionCall `json:"function"`
+}
+
+// FunctionCall is the function part of a tool call
+type FunctionCall struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"` // JSON encoded arguments
+}
+
+// ToolCallDelta is a chunk of a tool call in a streaming response
+type ToolCallDelta struct {
+	Index    int    `json:"index"`
+	ID       string `json:"id,omitempty"`
+	Type     string `json:"type,omitempty"`
+	Function struct {
+		Name      string `json:"name,omitempty"`
+		Arguments string `json:"arguments,omitempty"`
+	} `json:"function"`
+}
+
+// Image is an image attached to a message
+type Image struct {
+	MimeType string // e.g. "image/png"
+	Data     string // Base64 encoded image data
+}
+
+// messageContentPart is a part of a multimodal message in the OpenAI compatible format
+type messageContentPart struct {
+	Type     string `json:"type"`
+	Text     string `json:"text,omitempty"`
+	ImageURL *struct {
+		URL string `json:"url"`
+	} `json:"image_url,omitempty"`
+}
+
+// MarshalJSON encodes messages with images as a list of content parts
+func (m Message) MarshalJSON() ([]byte, error) {
+	if len(m.Images) == 0 {
+		return json.Marshal(struct {
+			Role       string     `json:"role"`
+			Content    string     `json:"content"`
+			ToolCalls  []ToolCall `json:"tool_calls,omitempty"`
+			ToolCallID string     `json:"tool_call_id,omitempty"`
+		}{m.Role, m.Content, m.ToolCalls, m.ToolCallID})
+	}
+
+	parts := []messageContentPart{{Type: "text", Text: m.Content}}
+	for _, image := range m.Images {
+		part := messageContentPart{Type: "image_url", ImageURL: &struct {
+			URL string `json:"url"`
+		}{URL: "data:" + image.MimeType + ";base64," + image.Data}}
+		parts = append(parts, part)
+	}
+
+	return json.Marshal(struct {
+		Role       string               `json:"role"`
+		Content    []messageContentPart `json:"content"`
+		ToolCallID string               `json:"tool_call_id,omitempty"`
+	}{m.Role, parts, m.ToolCallID})
 }
 
 type Usage struct {
 	PromptTokens     int `json:"prompt_tokens"`
 	CompletionTokens int `json:"completion_tokens"`
 	TotalTokens      int `json:"total_tokens"`
+	// Prompt tokens read from and written to the prompt cache, they're part of PromptTokens
+	CacheReadTokens  int `json:"cache_read_tokens,omitempty"`
+	CacheWriteTokens int `json:"cache_write_tokens,omitempty"`
+}
+
+// UnmarshalJSON reads the usage of OpenAI compatible APIs, which report the prompt cache as
+// prompt_cache_hit_tokens and prompt_cache_miss_tokens (DeepSeek, which caches every prompt
+// automatically) or as prompt_tokens_details.cached_tokens (OpenAI)
+func (u *Usage) UnmarshalJSON(data []byte) error {
+	type usage Usage
+	var raw struct {
+		usage
+		PromptCacheHitTokens  int `json:"prompt_cache_hit_tokens"`
+		PromptCacheMissTokens int `json:"prompt_cache_miss_tokens"`
+		PromptTokensDetails   *struct {
+			CachedTokens int `json:"cached_tokens"`
+		} `json:"prompt_tokens_details"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	*u = Usage(raw.usage)
+	if raw.PromptCacheHitTokens > 0 || raw.PromptCacheMissTokens > 0 {
+		u.CacheReadTokens = raw.PromptCacheHitTokens
+		u.CacheWriteTokens = raw.PromptCacheMissTokens
+	} else if raw.PromptTokensDetails != nil && raw.PromptTokensDetails.CachedTokens > 0 {
+		u.CacheReadTokens = raw.PromptTokensDetails.CachedTokens
+	}
+	return nil
 }
 
 // ChatStreamResponse represents the response from a streaming chat request
 type ChatStreamResponse struct {
-	ReasoningContent string `json:"reasoning_content"`
-	Content          string `json:"content"`
-	Usage            *Usage `json:"usage,omitempty"`
-	FinishReason     string `json:"finish_reason,omitempty"`
+	ReasoningContent string     `json:"reasoning_content"`
+	Content          string     `json:"content"`
+	Usage            *Usage     `json:"usage,omitempty"`
+	FinishReason     string     `json:"finish_reason,omitempty"`
+	ToolCalls        []ToolCall `json:"tool_calls,omitempty"`
 }
 
 // Provider defines the interface that all AI providers must implement
@@ -39,6 +153,15 @@ type Provider interface {
 	GetModelInfo() *ModelInfo
 }
 
+// ToolCallingProvider is implemented by providers that support OpenAI style function calling
+type ToolCallingProvider interface {
+	Provider
+
+	// ChatStreamWithTools works like ChatStream, but sends tool definitions with the request.
+	// Tool calls requested by the model are returned in the response.
+	ChatStreamWithTools(ctx context.Context, messages []Message, tools []ToolDefinition, callback func(string, string, bool)) (*ChatStreamResponse, error)
+}
+
 // ProviderConfig contains common configuration for providers
 type ProviderConfig struct {
 	APIKey      string
@@ -56,3 +179,6 @@ const DefaultTimeout = 120 * time.Second
 // StreamingTimeout is the timeout for streaming API requests
 // Use a longer timeout for streaming requests
 const StreamingTimeout = 300 * time.Second
+
+// ErrModelNotFound is returned by providers for a model they don't know
+var ErrModelNotFound = errors.New("model not found")
@@ -23,6 +23,12 @@ func getGlobalConfigPath() string {
 	return filepath.Join(home, ".nca_config")
 }
 
+// HasGlobalConfig returns whether the global config file exists, it doesn't before the first setup
+func HasGlobalConfig() bool {
+	_, err := os.Stat(getGlobalConfigPath())
+	return err == nil
+}
+
 // Load configuration
 func loadConfig(isGlobal bool) Config {
 	var path string
@@ -66,17 +72,40 @@ func saveConfig(config Config, isGlobal bool) error {
 
 // Get configuration value
 func Get(key string) string {
+	// Environment variables override the config files
+	if value, ok := getEnv(key); ok {
+		return value
+	}
+
 	// Try to get from local config first
 	localConfig := loadConfig(false)
 	if value, ok := localConfig[key]; ok {
 		return value
 	}
 
+	// Then the active profile, which overrides the global config
+	if value, ok := activeProfileConfig()[key]; ok {
+		return value
+	}
+
 	// If not in local, try global config
 	globalConfig := loadConfig(true)
 	return globalConfig[key]
 }
 
+// GetUser returns a setting of the user: from the environment, the active profile or the global
+// config. The config and env files of the project are skipped, for settings an untrusted project
+// must not change.
+func GetUser(key string) string {
+	if value := os.Getenv(envName(key)); value != "" {
+		return value
+	}
+	if value, ok := activeProfileConfig()[key]; ok {
+		return value
+	}
+	return loadConfig(true)[key]
+}
+
 // Set configuration value
 func Set(key, value string, isGlobal bool) error {
 	config := loadConfig(isGlobal)
@@ -102,11 +131,21 @@ func GetAll() map[string]string {
 		result[k] = v
 	}
 
+	// Then the active profile
+	for k, v := range activeProfileConfig() {
+		result[k] = v
+	}
+
 	// Then load local config, overriding any global settings
 	localConfig := loadConfig(false)
 	for k, v := range localConfig {
 		result[k] = v
 	}
 
+	// Environment variables override all of them
+	for k, v := range envOverrides(result) {
+		result[k] = v
+	}
+
 	return result
 }
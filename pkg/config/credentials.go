@@ -0,0 +1,62 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
+// Get credentials file path
+func getCredentialsFilePath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".nca", "credentials.json")
+}
+
+// Load credentials
+func loadCredentials() map[string]string {
+	credentials := make(map[string]string)
+
+	data, err := os.ReadFile(getCredentialsFilePath())
+	if err != nil {
+		return credentials
+	}
+
+	if err := json.Unmarshal(data, &credentials); err != nil {
+		return make(map[string]string)
+	}
+	return credentials
+}
+
+// GetCredential returns a stored secret, e.g. the API key of a provider
+func GetCredential(name string) string {
+	return loadCredentials()[name]
+}
+
+// SetCredential stores a secret in the credentials file, which unlike the config file is
+// only readable by the user. An empty value removes the secret.
+func SetCredential(name, value string) error {
+	credentials := loadCredentials()
+	if value == "" {
+		delete(credentials, name)
+	} else {
+		credentials[name] = value
+	}
+
+	path := getCredentialsFilePath()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(credentials, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return err
+	}
+	// WriteFile keeps the mode of an existing file
+	return os.Chmod(path, 0600)
+}
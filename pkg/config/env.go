@@ -0,0 +1,106 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/joho/godotenv"
+)
+
+// Every setting can be overridden with an environment variable, which takes precedence over the
+// config files and profiles, so CI pipelines and containers can configure NCA without writing to
+// $HOME. The variable of a key is NCA_ followed by the key in upper case, with "." and "-" replaced
+// by "_": api_key is NCA_API_KEY and router.edit is NCA_ROUTER_EDIT.
+
+// Prefix of the environment variables of the settings
+const envPrefix = "NCA_"
+
+// The NCA_ variables loaded from the env files of the project
+var envFileVars = map[string]string{}
+
+// Files of the project the variables are loaded from, .env only with load_dotenv
+const (
+	ncaEnvFile = ".nca.env"
+	dotEnvFile = ".env"
+)
+
+// envName returns the environment variable of a setting
+func envName(key string) string {
+	return envPrefix + strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(key))
+}
+
+// getEnv returns the value of a setting from the environment or the env files, empty variables
+// are ignored
+func getEnv(key string) (string, bool) {
+	value := os.Getenv(envName(key))
+	if value == "" {
+		value = envFileVars[envName(key)]
+	}
+	return value, value != ""
+}
+
+// envOverrides returns the settings of the NCA_ environment variables. The keys of settings
+// already in config are used, other variables become lower case keys with "_".
+func envOverrides(config Config) Config {
+	overrides := Config{}
+	known := make(map[string]bool)
+	for key := range config {
+		known[envName(key)] = true
+		if value, ok := getEnv(key); ok {
+			overrides[key] = value
+		}
+	}
+	vars := make(map[string]string, len(envFileVars))
+	for name, value := range envFileVars {
+		vars[name] = value
+	}
+	for _, entry := range os.Environ() {
+		if name, value, _ := strings.Cut(entry, "="); value != "" {
+			vars[name] = value
+		}
+	}
+	for name, value := range vars {
+		if strings.HasPrefix(name, envPrefix) && !known[name] && value != "" {
+			overrides[strings.ToLower(strings.TrimPrefix(name, envPrefix))] = value
+		}
+	}
+	return overrides
+}
+
+// LoadEnvFiles loads the NCA_ variables of the .nca.env file in dir, and of its .env file if
+// load_dotenv is true, so they override the config like environment variables. Variables of the
+// environment take precedence, and the files aren't passed to the commands NCA runs. The files
+// are only loaded once the user trusted dir, they could set any key, like the API URL the API key
+// is sent to.
+func LoadEnvFiles(dir string) error {
+	if trusted, _ := GetWorkspaceTrust(dir); !trusted {
+		return nil
+	}
+	if err := loadEnvFile(filepath.Join(dir, ncaEnvFile)); err != nil {
+		return err
+	}
+	if load, _ := strconv.ParseBool(Get("load_dotenv")); load {
+		return loadEnvFile(filepath.Join(dir, dotEnvFile))
+	}
+	return nil
+}
+
+// loadEnvFile adds the NCA_ variables of an env file that aren't loaded yet, a missing file is
+// skipped
+func loadEnvFile(path string) error {
+	vars, err := godotenv.Read(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	for name, value := range vars {
+		if _, loaded := envFileVars[name]; strings.HasPrefix(name, envPrefix) && !loaded {
+			envFileVars[name] = value
+		}
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+)
+
+// Profiles are named sets of settings, e.g. the provider, model and API key of an account. The
+// settings of the active profile override the global config, the local config of the project
+// overrides them. The active profile is chosen with --profile, or with the "profile" setting of
+// the environment (NCA_PROFILE), the project or the global config.
+
+// Names of profiles, which are used in commands and paths
+var profileNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// The profile chosen with --profile, which takes precedence over the "profile" setting
+var selectedProfile string
+
+// Get profiles file path
+func getProfilesFilePath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".nca", "profiles.json")
+}
+
+// Load profiles
+func loadProfiles() map[string]Config {
+	profiles := make(map[string]Config)
+
+	data, err := os.ReadFile(getProfilesFilePath())
+	if err != nil {
+		return profiles
+	}
+
+	if err := json.Unmarshal(data, &profiles); err != nil {
+		return make(map[string]Config)
+	}
+	return profiles
+}
+
+// Save profiles, the file is only readable by the user because profiles may hold API keys
+func saveProfiles(profiles map[string]Config) error {
+	path := getProfilesFilePath()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(profiles, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return err
+	}
+	// WriteFile keeps the mode of an existing file
+	return os.Chmod(path, 0600)
+}
+
+// ValidateProfileName returns an error if a profile name isn't valid
+func ValidateProfileName(name string) error {
+	if !profileNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid profile name '%s', use letters, digits, '_', '.' and '-'", name)
+	}
+	return nil
+}
+
+// SelectProfile makes a profile the active one for this process, "" goes back to the "profile"
+// setting. The profile must exist.
+func SelectProfile(name string) error {
+	if name != "" && !ProfileExists(name) {
+		return fmt.Errorf("profile '%s' doesn't exist, create it with: nca config set --profile %s <key> <value>", name, name)
+	}
+	selectedProfile = name
+	return nil
+}
+
+// ActiveProfile returns the name of the active profile, or "" if none is active
+func ActiveProfile() string {
+	if selectedProfile != "" {
+		return selectedProfile
+	}
+	if name, ok := getEnv("profile"); ok {
+		return name
+	}
+	if name, ok := loadConfig(false)["profile"]; ok {
+		return name
+	}
+	return loadConfig(true)["profile"]
+}
+
+// ProfileExists returns whether a profile has been created
+func ProfileExists(name string) bool {
+	_, ok := loadProfiles()[name]
+	return ok
+}
+
+// ListProfiles returns the names of the profiles, sorted
+func ListProfiles() []string {
+	var names []string
+	for name := range loadProfiles() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// GetProfile returns the settings of a profile
+func GetProfile(name string) Config {
+	profile := Config{}
+	for key, value := range loadProfiles()[name] {
+		profile[key] = value
+	}
+	return profile
+}
+
+// SetProfileValue sets a setting of a profile, the profile is created if it doesn't exist
+func SetProfileValue(name, key, value string) error {
+	if err := ValidateProfileName(name); err != nil {
+		return err
+	}
+	if key == "profile" {
+		return fmt.Errorf("a profile can't select another profile")
+	}
+	profiles := loadProfiles()
+	if profiles[name] == nil {
+		profiles[name] = Config{}
+	}
+	profiles[name][key] = value
+	return saveProfiles(profiles)
+}
+
+// UnsetProfileValue removes a setting of a profile
+func UnsetProfileValue(name, key string) error {
+	profiles := loadProfiles()
+	if profiles[name] == nil {
+		return fmt.Errorf("profile '%s' doesn't exist", name)
+	}
+	delete(profiles[name], key)
+	return saveProfiles(profiles)
+}
+
+// DeleteProfile removes a profile and its settings
+func DeleteProfile(name string) error {
+	profiles := loadProfiles()
+	if profiles[name] == nil {
+		return fmt.Errorf("profile '%s' doesn't exist", name)
+	}
+	delete(profiles, name)
+	return saveProfiles(profiles)
+}
+
+// activeProfileConfig returns the settings of the active profile
+func activeProfileConfig() Config {
+	name := ActiveProfile()
+	if name == "" {
+		return Config{}
+	}
+	return loadProfiles()[name]
+}
@@ -0,0 +1,106 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// TrustDecision is the user's answer to the workspace trust prompt
+type TrustDecision struct {
+	Trusted   bool      `json:"trusted"`
+	DecidedAt time.Time `json:"decided_at"`
+}
+
+// Get trust file path
+func getTrustFilePath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".nca", "trusted_workspaces.json")
+}
+
+// Load trust decisions
+func loadTrustDecisions() map[string]TrustDecision {
+	decisions := make(map[string]TrustDecision)
+
+	data, err := os.ReadFile(getTrustFilePath())
+	if err != nil {
+		return decisions
+	}
+
+	if err := json.Unmarshal(data, &decisions); err != nil {
+		return make(map[string]TrustDecision)
+	}
+	return decisions
+}
+
+// Save trust decisions
+func saveTrustDecisions(decisions map[string]TrustDecision) error {
+	path := getTrustFilePath()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(decisions, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// GetWorkspaceTrust returns the trust decision for a directory.
+// Decisions apply to subdirectories, the nearest decided ancestor wins.
+// known is false if no decision has been made for the directory.
+func GetWorkspaceTrust(dir string) (trusted bool, known bool) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return false, false
+	}
+
+	decisions := loadTrustDecisions()
+	for {
+		if decision, ok := decisions[absDir]; ok {
+			return decision.Trusted, true
+		}
+		parent := filepath.Dir(absDir)
+		if parent == absDir {
+			return false, false
+		}
+		absDir = parent
+	}
+}
+
+// SetWorkspaceTrust stores the trust decision for a directory
+func SetWorkspaceTrust(dir string, trusted bool) error {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+
+	decisions := loadTrustDecisions()
+	decisions[absDir] = TrustDecision{Trusted: trusted, DecidedAt: time.Now()}
+	return saveTrustDecisions(decisions)
+}
+
+// RevokeWorkspaceTrust removes the trust decision for a directory, returns false if there was none
+func RevokeWorkspaceTrust(dir string) (bool, error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return false, err
+	}
+
+	decisions := loadTrustDecisions()
+	if _, ok := decisions[absDir]; !ok {
+		return false, nil
+	}
+	delete(decisions, absDir)
+	return true, saveTrustDecisions(decisions)
+}
+
+// ListWorkspaceTrust returns all stored trust decisions by directory
+func ListWorkspaceTrust() map[string]TrustDecision {
+	return loadTrustDecisions()
+}
@@ -0,0 +1,39 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWorkspaceTrust(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	dir := t.TempDir()
+	sub := filepath.Join(dir, "sub")
+	require.NoError(t, os.Mkdir(sub, 0755))
+
+	_, known := GetWorkspaceTrust(dir)
+	assert.False(t, known)
+
+	// Decisions apply to subdirectories, the nearest decided ancestor wins
+	require.NoError(t, SetWorkspaceTrust(dir, true))
+	trusted, known := GetWorkspaceTrust(sub)
+	assert.True(t, known)
+	assert.True(t, trusted)
+	require.NoError(t, SetWorkspaceTrust(sub, false))
+	trusted, _ = GetWorkspaceTrust(sub)
+	assert.False(t, trusted)
+	assert.Len(t, ListWorkspaceTrust(), 2)
+
+	removed, err := RevokeWorkspaceTrust(sub)
+	require.NoError(t, err)
+	assert.True(t, removed)
+	trusted, _ = GetWorkspaceTrust(sub)
+	assert.True(t, trusted)
+	removed, err = RevokeWorkspaceTrust(sub)
+	require.NoError(t, err)
+	assert.False(t, removed)
+}
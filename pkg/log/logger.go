@@ -1,9 +1,13 @@
 package log
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -13,12 +17,25 @@ var (
 	debugLogFile *os.File
 	sessionID    string
 	debugLogPath string
+	// Serializes the writes of events, which are logged from several goroutines
+	debugLogMutex sync.Mutex
+	// Number of API requests of the session, for their request IDs
+	requestCount int64
 )
 
+// Fields are the data of a debug log event besides its time, session and type
+type Fields map[string]interface{}
+
+// getDebugBaseDir returns the directory of the debug logs, with a directory per day
+func getDebugBaseDir() string {
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".nca", "debug")
+}
+
 // InitDebugMode initializes debug mode, creating necessary directories and log file
 func InitDebugMode() {
 	// Create base debug directory if it doesn't exist
-	debugBaseDir := filepath.Join(os.Getenv("HOME"), ".nca", "debug")
+	debugBaseDir := getDebugBaseDir()
 	if err := os.MkdirAll(debugBaseDir, 0755); err != nil {
 		fmt.Printf("Warning: Failed to create debug directory: %s\n", err)
 		debugMode = false
@@ -37,8 +54,8 @@ func InitDebugMode() {
 	// Generate unique session ID based on timestamp
 	sessionID = now.Format("150405-") + fmt.Sprintf("%03d", now.Nanosecond()/1000000)
 
-	// Create log file
-	debugLogPath = filepath.Join(dateDir, fmt.Sprintf("session_%s.log", sessionID))
+	// Create log file, one JSON event per line
+	debugLogPath = filepath.Join(dateDir, fmt.Sprintf("session_%s.jsonl", sessionID))
 	var err error
 	debugLogFile, err = os.Create(debugLogPath)
 	if err != nil {
@@ -51,29 +68,59 @@ func InitDebugMode() {
 	debugMode = true
 
 	// Log session start
-	LogDebug(fmt.Sprintf("Session started at %s\n", now.Format(time.RFC3339)))
+	cwd, _ := os.Getwd()
+	LogEvent("session_start", Fields{"cwd": cwd, "pid": os.Getpid()})
 }
 
-// LogDebug writes a message to the debug log
+// LogDebug writes a free-form message to the debug log, as an event of type "message"
 func LogDebug(message string) {
+	LogEvent("message", Fields{"message": strings.TrimRight(message, "\n")})
+}
+
+// LogEvent writes an event to the debug log as a line of JSON with its time, the session and
+// its type, e.g. "api_request" or "tool_call", followed by its fields
+func LogEvent(eventType string, fields Fields) {
 	if !debugMode || debugLogFile == nil {
 		return
 	}
 
-	timestamp := time.Now().Format("15:04:05.000")
-	logEntry := fmt.Sprintf("[%s] %s", timestamp, message)
+	event := make(map[string]interface{}, len(fields)+3)
+	for key, value := range fields {
+		event[key] = value
+	}
+	event["time"] = time.Now().Format(time.RFC3339Nano)
+	event["session"] = sessionID
+	event["type"] = eventType
+	data, err := json.Marshal(event)
+	if err != nil {
+		data, _ = json.Marshal(map[string]interface{}{"time": event["time"], "session": sessionID, "type": eventType,
+			"message": fmt.Sprintf("Failed to encode event: %s", err)})
+	}
 
-	if _, err := debugLogFile.WriteString(logEntry); err != nil {
+	debugLogMutex.Lock()
+	defer debugLogMutex.Unlock()
+	if debugLogFile == nil {
+		return
+	}
+	if _, err := debugLogFile.Write(append(data, '\n')); err != nil {
 		fmt.Printf("Warning: Failed to write to debug log: %s\n", err)
 	}
 }
 
+// NextRequestID returns the ID of the next API request of the session, which relates the events
+// of a request and of the tool calls of its response
+func NextRequestID() string {
+	return fmt.Sprintf("req-%d", atomic.AddInt64(&requestCount, 1))
+}
+
 // CloseDebugLog closes the debug log file
 func CloseDebugLog() {
 	if debugLogFile != nil {
-		LogDebug("Session ended\n")
+		LogEvent("session_end", nil)
+		debugLogMutex.Lock()
 		debugLogFile.Close()
 		debugLogFile = nil
+		debugLogMutex.Unlock()
 	}
 }
 
@@ -0,0 +1,105 @@
+package log
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// FindLatestDebugLog returns the path of the most recent debug log
+func FindLatestDebugLog() (string, error) {
+	paths, err := filepath.Glob(filepath.Join(getDebugBaseDir(), "*", "session_*.jsonl"))
+	if err != nil {
+		return "", err
+	}
+	latest := ""
+	var latestTime time.Time
+	for _, path := range paths {
+		if info, err := os.Stat(path); err == nil && info.ModTime().After(latestTime) {
+			latest, latestTime = path, info.ModTime()
+		}
+	}
+	if latest == "" {
+		return "", fmt.Errorf("no debug logs found in %s, run nca with -debug to create one", getDebugBaseDir())
+	}
+	return latest, nil
+}
+
+// RenderEvents writes the events of a debug log in a human-readable form: messages as they were
+// logged and other events as their type followed by their fields. Lines that aren't events, e.g.
+// of logs written before they were structured, are copied as they are.
+func RenderEvents(r io.Reader, w io.Writer) error {
+	reader := bufio.NewReader(r)
+	for {
+		line, err := reader.ReadString('\n')
+		if trimmed := strings.TrimRight(line, "\r\n"); trimmed != "" {
+			if _, writeErr := io.WriteString(w, renderEvent(trimmed)+"\n"); writeErr != nil {
+				return writeErr
+			}
+		}
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+// renderEvent formats one line of a debug log
+func renderEvent(line string) string {
+	var event map[string]interface{}
+	if err := json.Unmarshal([]byte(line), &event); err != nil {
+		return line
+	}
+	eventType, _ := event["type"].(string)
+	if eventType == "" {
+		return line
+	}
+
+	timestamp, _ := event["time"].(string)
+	if parsed, err := time.Parse(time.RFC3339Nano, timestamp); err == nil {
+		timestamp = parsed.Format("15:04:05.000")
+	}
+	if message, ok := event["message"].(string); ok && eventType == "message" {
+		return fmt.Sprintf("[%s] %s", timestamp, message)
+	}
+
+	keys := make([]string, 0, len(event))
+	for key := range event {
+		if key != "time" && key != "session" && key != "type" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	rendered := fmt.Sprintf("[%s] %s", timestamp, eventType)
+	for _, key := range keys {
+		rendered += " " + key + "=" + renderValue(event[key])
+	}
+	return rendered
+}
+
+// renderValue formats a field of an event, strings with spaces or quotes are quoted
+func renderValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		if v == "" || strings.ContainsAny(v, " \t\n\"=") {
+			return fmt.Sprintf("%q", v)
+		}
+		return v
+	case float64:
+		// JSON numbers are floats, most fields are counts or durations
+		if v == float64(int64(v)) {
+			return fmt.Sprintf("%d", int64(v))
+		}
+		return fmt.Sprintf("%g", v)
+	default:
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+}
@@ -3,11 +3,13 @@ package client
 import (
 	"bytes"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"net/url"
 	"strings"
@@ -15,6 +17,9 @@ import (
 	"github.com/pederhe/nca/pkg/mcp/common"
 )
 
+// PKCE code challenge method, the plain method doesn't protect the authorization code
+const codeChallengeMethod = "S256"
+
 // AuthResult represents the authentication result
 type AuthResult string
 
@@ -26,6 +31,10 @@ const (
 	Redirect AuthResult = "REDIRECT"
 )
 
+// ErrClientRejected is returned when the authorization server doesn't accept the client, e.g. a
+// registration it no longer knows. The client has to be registered again.
+var ErrClientRejected = errors.New("authorization server rejected the OAuth client")
+
 // UnauthorizedError is already defined in sse.go
 
 // OAuthClientProvider is an interface that provides OAuth client functionality
@@ -90,6 +99,15 @@ type TokenStorage interface {
 	LoadCodeVerifier() (string, error)
 }
 
+// ClientRegistrationStorage is a TokenStorage that also keeps the redirect URIs of a dynamically
+// registered client, so the registration can be checked before it is used again
+type ClientRegistrationStorage interface {
+	TokenStorage
+
+	// SaveClientRegistration saves the client information and the redirect URIs it was registered with
+	SaveClientRegistration(info *common.OAuthClientInformationFull) error
+}
+
 // NewDefaultOAuthClientProvider creates a default OAuth provider
 func NewDefaultOAuthClientProvider(
 	redirectURL string,
@@ -142,6 +160,9 @@ func (p *DefaultOAuthClientProvider) SaveClientInformation(info *common.OAuthCli
 		ClientSecretExpiresAt: info.ClientSecretExpiresAt,
 	}
 
+	if registrations, ok := p.storage.(ClientRegistrationStorage); ok {
+		return registrations.SaveClientRegistration(info)
+	}
 	if p.storage != nil {
 		return p.storage.SaveClientInfo(p.clientInfo)
 	}
@@ -393,6 +414,12 @@ func StartAuthorization(
 		}
 	}
 
+	// Only S256 is used, servers that list the supported methods must include it
+	if len(metadata.CodeChallengeMethodsSupported) > 0 && !containsString(metadata.CodeChallengeMethodsSupported, codeChallengeMethod) {
+		return nil, "", fmt.Errorf("authorization server does not support the %s code challenge method, supported methods: %s",
+			codeChallengeMethod, strings.Join(metadata.CodeChallengeMethodsSupported, ", "))
+	}
+
 	// Create PKCE challenge
 	codeVerifier, err := generateCodeVerifier(64)
 	if err != nil {
@@ -412,7 +439,7 @@ func StartAuthorization(
 	query.Set("client_id", clientInfo.ClientID)
 	query.Set("redirect_uri", redirectURL)
 	query.Set("code_challenge", codeChallenge)
-	query.Set("code_challenge_method", "S256")
+	query.Set("code_challenge_method", codeChallengeMethod)
 	authURL.RawQuery = query.Encode()
 
 	return authURL, codeVerifier, nil
@@ -458,6 +485,10 @@ func ExchangeAuthorization(
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
+		var errorResponse common.OAuthErrorResponse
+		if json.NewDecoder(resp.Body).Decode(&errorResponse) == nil && isClientRejection(errorResponse.Error) {
+			return nil, fmt.Errorf("HTTP %d Attempted to exchange authorization code: %w", resp.StatusCode, ErrClientRejected)
+		}
 		return nil, fmt.Errorf("HTTP %d Attempted to exchange authorization code", resp.StatusCode)
 	}
 
@@ -474,6 +505,26 @@ func ExchangeAuthorization(
 	return tokens, nil
 }
 
+// isClientRejection returns whether an OAuth error code means the client itself isn't accepted
+func isClientRejection(code string) bool {
+	return code == "invalid_client" || code == "unauthorized_client"
+}
+
+// IsLoopbackRedirectURL returns whether a redirect URL is on a loopback address. The authorization
+// server must allow any port for them (RFC 8252 section 7.3), so a client registered with one can
+// be used with callback servers on other ports.
+func IsLoopbackRedirectURL(redirectURL string) bool {
+	parsed, err := url.Parse(redirectURL)
+	if err != nil || parsed.Scheme != "http" {
+		return false
+	}
+	if parsed.Hostname() == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(parsed.Hostname())
+	return ip != nil && ip.IsLoopback()
+}
+
 // RefreshAuthorization refreshes OAuth tokens
 func RefreshAuthorization(
 	serverURL string,
@@ -525,6 +576,11 @@ func RefreshAuthorization(
 		return nil, fmt.Errorf("failed to parse OAuth tokens: %w", err)
 	}
 
+	// Servers that don't rotate refresh tokens leave them out, the old one stays valid
+	if tokens.RefreshToken == "" {
+		tokens.RefreshToken = refreshToken
+	}
+
 	return tokens, nil
 }
 
@@ -734,13 +790,19 @@ func generateCodeVerifier(length int) (string, error) {
 	return encoded, nil
 }
 
-// Helper function: generates a code challenge from a code verifier
+// Helper function: generates the S256 code challenge of a code verifier (RFC 7636 section 4.2),
+// the Base64-URL encoded SHA-256 digest of the verifier without padding
 func generateCodeChallenge(codeVerifier string) string {
-	// This is a simplified implementation
-	// In actual application, SHA-256 should be used to calculate the digest of the code verifier
-	// Then Base64-URL encoding should be performed
+	digest := sha256.Sum256([]byte(codeVerifier))
+	return base64.RawURLEncoding.EncodeToString(digest[:])
+}
 
-	// For simplicity, this directly returns the verifier
-	// In actual application, the correct S256 algorithm should be used
-	return codeVerifier
+// Helper function: returns whether a list contains a value
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
 }
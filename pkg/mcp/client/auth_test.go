@@ -1,12 +1,18 @@
 package client
 
 import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"testing"
 
 	"github.com/pederhe/nca/pkg/mcp/common"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestDefaultOAuthClientProvider(t *testing.T) {
@@ -338,3 +344,137 @@ func (p *MockOAuthClientProvider) refreshToken() (*common.OAuthTokens, error) {
 	p.tokens = refreshed
 	return refreshed, nil
 }
+
+// mockAuthorizationServer is an OAuth authorization server that checks the PKCE challenge
+// of the authorization request when the code is exchanged for tokens
+type mockAuthorizationServer struct {
+	*httptest.Server
+	challengeMethods []string
+	challenge        string
+	challengeMethod  string
+}
+
+func newMockAuthorizationServer(t *testing.T, challengeMethods []string) *mockAuthorizationServer {
+	as := &mockAuthorizationServer{challengeMethods: challengeMethods}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/oauth-authorization-server", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(common.OAuthMetadata{
+			Issuer:                        as.URL,
+			AuthorizationEndpoint:         as.URL + "/authorize",
+			TokenEndpoint:                 as.URL + "/token",
+			ResponseTypesSupported:        []string{"code"},
+			CodeChallengeMethodsSupported: as.challengeMethods,
+		})
+	})
+	mux.HandleFunc("/authorize", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		as.challenge = query.Get("code_challenge")
+		as.challengeMethod = query.Get("code_challenge_method")
+		redirect := query.Get("redirect_uri") + "?code=test-code"
+		if state := query.Get("state"); state != "" {
+			redirect += "&state=" + url.QueryEscape(state)
+		}
+		http.Redirect(w, r, redirect, http.StatusFound)
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		digest := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+		if as.challengeMethod != "S256" || base64.RawURLEncoding.EncodeToString(digest[:]) != as.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(common.OAuthErrorResponse{Error: "invalid_grant"})
+			return
+		}
+		json.NewEncoder(w).Encode(common.OAuthTokens{AccessToken: "pkce-access-token", TokenType: "bearer"})
+	})
+	as.Server = httptest.NewServer(mux)
+	t.Cleanup(as.Close)
+	return as
+}
+
+func TestGenerateCodeChallenge(t *testing.T) {
+	verifier, err := generateCodeVerifier(64)
+	require.NoError(t, err)
+	assert.Len(t, verifier, 64)
+	assert.Regexp(t, `^[A-Za-z0-9\-._~]+$`, verifier, "Verifier should only use unreserved characters")
+
+	// The challenge is the Base64-URL encoded SHA-256 digest without padding
+	challenge := generateCodeChallenge(verifier)
+	digest := sha256.Sum256([]byte(verifier))
+	assert.Equal(t, base64.RawURLEncoding.EncodeToString(digest[:]), challenge)
+	assert.Len(t, challenge, 43)
+	assert.NotEqual(t, verifier, challenge, "Challenge must not be the plain verifier")
+}
+
+func TestPKCEAuthorizationFlow(t *testing.T) {
+	as := newMockAuthorizationServer(t, []string{"S256"})
+	clientInfo := &common.OAuthClientInformation{ClientID: "test-client"}
+	redirectURL := "http://localhost/callback"
+
+	authURL, codeVerifier, err := StartAuthorization(as.URL, nil, clientInfo, redirectURL)
+	require.NoError(t, err)
+	assert.Equal(t, "S256", authURL.Query().Get("code_challenge_method"))
+	assert.Equal(t, generateCodeChallenge(codeVerifier), authURL.Query().Get("code_challenge"))
+
+	// Follow the authorization URL like the user agent and take the code from the redirect
+	noRedirect := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := noRedirect.Get(authURL.String())
+	require.NoError(t, err)
+	resp.Body.Close()
+	location, err := url.Parse(resp.Header.Get("Location"))
+	require.NoError(t, err)
+	code := location.Query().Get("code")
+	require.NotEmpty(t, code)
+
+	tokens, err := ExchangeAuthorization(as.URL, nil, clientInfo, code, codeVerifier, redirectURL)
+	require.NoError(t, err)
+	assert.Equal(t, "pkce-access-token", tokens.AccessToken)
+
+	// The server rejects a verifier that doesn't match the challenge
+	_, err = ExchangeAuthorization(as.URL, nil, clientInfo, code, codeVerifier+"x", redirectURL)
+	assert.Error(t, err)
+}
+
+func TestStartAuthorizationChallengeMethods(t *testing.T) {
+	clientInfo := &common.OAuthClientInformation{ClientID: "test-client"}
+
+	// Servers that don't list the methods are expected to support S256
+	as := newMockAuthorizationServer(t, nil)
+	_, _, err := StartAuthorization(as.URL, nil, clientInfo, "http://localhost/callback")
+	assert.NoError(t, err)
+
+	// Servers that only support the plain method are rejected
+	as = newMockAuthorizationServer(t, []string{"plain"})
+	_, _, err = StartAuthorization(as.URL, nil, clientInfo, "http://localhost/callback")
+	assert.ErrorContains(t, err, "does not support the S256 code challenge method")
+}
+
+func TestIsLoopbackRedirectURL(t *testing.T) {
+	assert.True(t, IsLoopbackRedirectURL("http://127.0.0.1:53124/callback"))
+	assert.True(t, IsLoopbackRedirectURL("http://127.0.0.1/callback"))
+	assert.True(t, IsLoopbackRedirectURL("http://[::1]:8080/callback"))
+	assert.True(t, IsLoopbackRedirectURL("http://localhost:3000/callback"))
+	assert.False(t, IsLoopbackRedirectURL("https://example.com/callback"))
+	assert.False(t, IsLoopbackRedirectURL("http://192.168.1.10:8080/callback"))
+	assert.False(t, IsLoopbackRedirectURL("com.example.app:/callback"))
+	assert.False(t, IsLoopbackRedirectURL(""))
+}
+
+func TestExchangeAuthorizationClientRejected(t *testing.T) {
+	errorCode := "invalid_client"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(common.OAuthErrorResponse{Error: errorCode})
+	}))
+	defer server.Close()
+	metadata := &common.OAuthMetadata{TokenEndpoint: server.URL + "/token"}
+	clientInfo := &common.OAuthClientInformation{ClientID: "unknown-client"}
+
+	_, err := ExchangeAuthorization(server.URL, metadata, clientInfo, "code", "verifier", "http://127.0.0.1:8123/callback")
+	assert.ErrorIs(t, err, ErrClientRejected)
+
+	// Other errors don't need a new registration
+	errorCode = "invalid_grant"
+	_, err = ExchangeAuthorization(server.URL, metadata, clientInfo, "code", "verifier", "http://127.0.0.1:8123/callback")
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrClientRejected)
+}
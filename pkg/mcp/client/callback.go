@@ -0,0 +1,146 @@
+package client
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+)
+
+// callbackResult is the outcome of an authorization received by the callback server
+type callbackResult struct {
+	code string
+	err  error
+}
+
+// CallbackServer receives the authorization code of an OAuth redirect on a loopback address
+// (RFC 8252). It listens on a port chosen by the OS, so the redirect URL differs on every login.
+type CallbackServer struct {
+	listener    net.Listener
+	server      *http.Server
+	redirectURL string
+	state       string
+	results     chan callbackResult
+	once        sync.Once
+}
+
+// NewCallbackServer starts a callback server on 127.0.0.1
+func NewCallbackServer() (*CallbackServer, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to start OAuth callback server: %w", err)
+	}
+
+	// The state ties the redirect to the authorization request this server started
+	stateBytes := make([]byte, 16)
+	if _, err := rand.Read(stateBytes); err != nil {
+		listener.Close()
+		return nil, err
+	}
+
+	s := &CallbackServer{
+		listener:    listener,
+		redirectURL: fmt.Sprintf("http://%s/callback", listener.Addr().String()),
+		state:       base64.RawURLEncoding.EncodeToString(stateBytes),
+		results:     make(chan callbackResult, 1),
+	}
+	s.server = &http.Server{Handler: http.HandlerFunc(s.handleCallback)}
+	go s.server.Serve(listener)
+	return s, nil
+}
+
+// RedirectURL returns the URL the authorization server redirects to
+func (s *CallbackServer) RedirectURL() string {
+	return s.redirectURL
+}
+
+// AuthorizationURL adds the state of the callback server to an authorization URL
+func (s *CallbackServer) AuthorizationURL(authURL *url.URL) *url.URL {
+	withState := *authURL
+	query := withState.Query()
+	query.Set("state", s.state)
+	withState.RawQuery = query.Encode()
+	return &withState
+}
+
+// handleCallback takes the code or error from the redirect of the authorization server
+func (s *CallbackServer) handleCallback(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/callback" {
+		http.NotFound(w, r)
+		return
+	}
+
+	query := r.URL.Query()
+	// Requests without the state weren't started by this login, e.g. a forged link
+	if query.Get("state") != s.state {
+		http.Error(w, "Invalid state parameter.", http.StatusBadRequest)
+		return
+	}
+
+	var result callbackResult
+	switch {
+	case isClientRejection(query.Get("error")):
+		result.err = fmt.Errorf("authorization failed: %s %s: %w", query.Get("error"), query.Get("error_description"), ErrClientRejected)
+		fmt.Fprintf(w, "Authorization failed: %s. You can close this window.", query.Get("error"))
+	case query.Get("error") != "":
+		result.err = fmt.Errorf("authorization failed: %s %s", query.Get("error"), query.Get("error_description"))
+		fmt.Fprintf(w, "Authorization failed: %s. You can close this window.", query.Get("error"))
+	case query.Get("code") == "":
+		result.err = errors.New("authorization server returned no code")
+		http.Error(w, "Missing authorization code.", http.StatusBadRequest)
+	default:
+		result.code = query.Get("code")
+		fmt.Fprint(w, "Authorization complete. You can close this window.")
+	}
+
+	// Only the first redirect counts, e.g. a reload of the page is ignored
+	s.once.Do(func() {
+		s.results <- result
+	})
+}
+
+// WaitForCode waits until the authorization server redirects to the callback server
+func (s *CallbackServer) WaitForCode(ctx context.Context) (string, error) {
+	select {
+	case result := <-s.results:
+		return result.code, result.err
+	case <-ctx.Done():
+		return "", fmt.Errorf("waiting for authorization: %w", ctx.Err())
+	}
+}
+
+// Close stops the callback server
+func (s *CallbackServer) Close() error {
+	return s.server.Close()
+}
+
+// AuthorizeWithCallback runs the authorization flow of Auth to the end. When Auth redirects to
+// the authorization server, the code is received by the callback server and exchanged for tokens,
+// so the user doesn't have to copy it. The provider's redirect URL must be the callback server's.
+func AuthorizeWithCallback(ctx context.Context, provider OAuthClientProvider, serverURL string, callback *CallbackServer) error {
+	result, err := Auth(provider, serverURL, "")
+	if err != nil {
+		return err
+	}
+	if result == Authorized {
+		return nil
+	}
+
+	code, err := callback.WaitForCode(ctx)
+	if err != nil {
+		return err
+	}
+	result, err = Auth(provider, serverURL, code)
+	if err != nil {
+		return err
+	}
+	if result != Authorized {
+		return errors.New("authorization was not completed")
+	}
+	return nil
+}
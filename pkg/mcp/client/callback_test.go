@@ -0,0 +1,99 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/pederhe/nca/pkg/mcp/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthorizeWithCallback(t *testing.T) {
+	as := newMockAuthorizationServer(t, []string{"S256"})
+	callback, err := NewCallbackServer()
+	require.NoError(t, err)
+	defer callback.Close()
+	assert.Regexp(t, `^http://127\.0\.0\.1:\d+/callback$`, callback.RedirectURL())
+
+	storage := NewMemoryTokenStorage()
+	require.NoError(t, storage.SaveClientInfo(&common.OAuthClientInformation{ClientID: "test-client"}))
+
+	// The browser follows the authorization URL, the server redirects it to the callback server
+	provider := NewDefaultOAuthClientProvider(callback.RedirectURL(), nil, storage, func(authURL *url.URL) error {
+		resp, err := http.Get(callback.AuthorizationURL(authURL).String())
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		return nil
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, AuthorizeWithCallback(ctx, provider, as.URL, callback))
+
+	tokens, err := storage.LoadTokens()
+	require.NoError(t, err)
+	assert.Equal(t, "pkce-access-token", tokens.AccessToken)
+}
+
+func TestCallbackServerState(t *testing.T) {
+	callback, err := NewCallbackServer()
+	require.NoError(t, err)
+	defer callback.Close()
+
+	// A redirect without the state of the login is rejected and doesn't end the wait
+	resp, err := http.Get(callback.RedirectURL() + "?code=forged")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	authURL, err := url.Parse("https://auth.example.com/authorize?client_id=test")
+	require.NoError(t, err)
+	state := callback.AuthorizationURL(authURL).Query().Get("state")
+	require.NotEmpty(t, state)
+	assert.Equal(t, "test", callback.AuthorizationURL(authURL).Query().Get("client_id"))
+
+	resp, err = http.Get(callback.RedirectURL() + "?error=access_denied&state=" + url.QueryEscape(state))
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err = callback.WaitForCode(ctx)
+	assert.ErrorContains(t, err, "access_denied")
+	assert.NotErrorIs(t, err, ErrClientRejected)
+}
+
+func TestCallbackServerClientRejected(t *testing.T) {
+	callback, err := NewCallbackServer()
+	require.NoError(t, err)
+	defer callback.Close()
+
+	authURL, err := url.Parse("https://auth.example.com/authorize?client_id=test")
+	require.NoError(t, err)
+	state := callback.AuthorizationURL(authURL).Query().Get("state")
+	resp, err := http.Get(callback.RedirectURL() + "?error=unauthorized_client&state=" + url.QueryEscape(state))
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err = callback.WaitForCode(ctx)
+	assert.ErrorIs(t, err, ErrClientRejected)
+}
+
+func TestCallbackServerTimeout(t *testing.T) {
+	callback, err := NewCallbackServer()
+	require.NoError(t, err)
+	defer callback.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = callback.WaitForCode(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
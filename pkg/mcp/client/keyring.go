@@ -0,0 +1,156 @@
+package client
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// Keyring entry of the key that encrypts stored OAuth tokens
+const (
+	keyringService = "nca"
+	keyringAccount = "mcp-token-key"
+)
+
+// keyring stores secrets in the keyring of the OS
+type keyring interface {
+	// Get returns the secret of an entry, an empty string if there is none
+	Get(service, account string) (string, error)
+
+	// Set creates or replaces an entry
+	Set(service, account, secret string) error
+}
+
+// systemKeyring is the keyring of this OS, nil if there is none
+var systemKeyring = newSystemKeyring()
+
+// newSystemKeyring returns the keyring of this OS if its command line tool is installed: the
+// keychain on macOS and the Secret Service (GNOME Keyring, KWallet) on Linux
+func newSystemKeyring() keyring {
+	switch runtime.GOOS {
+	case "darwin":
+		if _, err := exec.LookPath("security"); err == nil {
+			return macKeychain{}
+		}
+	case "linux", "freebsd", "openbsd", "netbsd":
+		if _, err := exec.LookPath("secret-tool"); err == nil {
+			return secretService{}
+		}
+	}
+	return nil
+}
+
+// macKeychain uses the security tool of macOS
+type macKeychain struct{}
+
+func (macKeychain) Get(service, account string) (string, error) {
+	output, err := exec.Command("security", "find-generic-password", "-s", service, "-a", account, "-w").Output()
+	if err != nil {
+		// Exit status 44 means the entry doesn't exist
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == 44 {
+			return "", nil
+		}
+		return "", err
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+func (macKeychain) Set(service, account, secret string) error {
+	// The command is passed to the interactive mode on stdin so the secret doesn't show up in the
+	// process list. That mode reports failures on stderr only.
+	var stderr bytes.Buffer
+	cmd := exec.Command("security", "-i")
+	cmd.Stdin = strings.NewReader(fmt.Sprintf("add-generic-password -U -s %q -a %q -w %q\n", service, account, secret))
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if message := strings.TrimSpace(stderr.String()); message != "" {
+		return errors.New(message)
+	}
+	return err
+}
+
+// secretService uses secret-tool of libsecret
+type secretService struct{}
+
+func (secretService) Get(service, account string) (string, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command("secret-tool", "lookup", "service", service, "account", account)
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		// A missing entry exits with status 1 and no message
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 && stderr.Len() == 0 {
+			return "", nil
+		}
+		return "", fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+func (secretService) Set(service, account, secret string) error {
+	// The secret is passed on stdin so it doesn't show up in the process list
+	cmd := exec.Command("secret-tool", "store", "--label=NCA MCP token key", "service", service, "account", account)
+	cmd.Stdin = strings.NewReader(secret)
+	return cmd.Run()
+}
+
+// LoadTokenKey returns the key for FileTokenStorage. The key is created on first use and kept in
+// the OS keyring. Without a usable keyring it's kept in keyFile, readable only by the user.
+func LoadTokenKey(keyFile string) ([]byte, error) {
+	if systemKeyring != nil {
+		// A locked or unavailable keyring isn't a missing key, a new key would replace the one the
+		// stored tokens are encrypted with
+		encoded, err := systemKeyring.Get(keyringService, keyringAccount)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the MCP token key from the keyring: %w", err)
+		}
+		if encoded != "" {
+			return decodeTokenKey(encoded)
+		}
+	}
+
+	if encoded, err := os.ReadFile(keyFile); err == nil {
+		return decodeTokenKey(string(encoded))
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	key := make([]byte, tokenKeySize)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, err
+	}
+	encoded := base64.StdEncoding.EncodeToString(key)
+
+	if systemKeyring != nil {
+		if err := systemKeyring.Set(keyringService, keyringAccount, encoded); err == nil {
+			return key, nil
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(keyFile), 0700); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(keyFile, []byte(encoded+"\n"), 0600); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// decodeTokenKey decodes a key stored by LoadTokenKey
+func decodeTokenKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil || len(key) != tokenKeySize {
+		return nil, errors.New("stored MCP token key is invalid")
+	}
+	return key, nil
+}
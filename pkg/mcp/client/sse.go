@@ -160,11 +160,19 @@ func (t *SSEClientTransport) Start(ctx context.Context) error {
 	t.isConnected = true
 	t.mutex.Unlock()
 
-	return t.startOrAuth()
+	if err := t.startOrAuth(true); err != nil {
+		// Set isConnected to false when connection fails
+		t.mutex.Lock()
+		t.isConnected = false
+		t.mutex.Unlock()
+		return err
+	}
+	return nil
 }
 
-// startOrAuth starts the SSE connection or performs authentication
-func (t *SSEClientTransport) startOrAuth() error {
+// startOrAuth starts the SSE connection or performs authentication. On a 401 the token is
+// refreshed and the connection retried once if refresh is true.
+func (t *SSEClientTransport) startOrAuth(refresh bool) error {
 	// Clean up previous resources
 	if t.eventSource != nil {
 		t.eventSource.close()
@@ -213,17 +221,15 @@ func (t *SSEClientTransport) startOrAuth() error {
 		// If it's a 401 error, try refreshing the token and reconnect
 		var sseErr *SseError
 		if errors.As(err, &sseErr) && sseErr.Code == http.StatusUnauthorized && t.authProvider != nil {
+			if !refresh {
+				return &UnauthorizedError{Message: "token rejected after refresh"}
+			}
 			if _, err := t.authProvider.RefreshToken(); err != nil {
 				return &UnauthorizedError{Message: "refresh token failed"}
 			}
-			return t.startOrAuth()
+			return t.startOrAuth(false)
 		}
 
-		// Set isConnected to false when connection fails
-		t.mutex.Lock()
-		t.isConnected = false
-		t.mutex.Unlock()
-
 		return err
 
 	case <-t.ctx.Done():
@@ -10,7 +10,6 @@ import (
 	"os/exec"
 	"strings"
 	"sync"
-	"syscall"
 	"time"
 
 	"github.com/pederhe/nca/pkg/mcp/common"
@@ -37,11 +36,6 @@ type StdioServerParameters struct {
 	Cwd string
 }
 
-// DefaultInheritedEnvVars is the default environment variables to inherit
-var DefaultInheritedEnvVars = []string{
-	"HOME", "LOGNAME", "PATH", "SHELL", "TERM", "USER",
-}
-
 // GetDefaultEnvironment returns a default environment object containing safe variables to inherit
 func GetDefaultEnvironment() map[string]string {
 	env := make(map[string]string)
@@ -73,6 +67,8 @@ type StdioClientTransport struct {
 	sessionID      string
 	mutex          sync.Mutex
 	isConnected    bool
+	closed         bool
+	exited         chan struct{}
 	ctx            context.Context
 	cancel         context.CancelFunc
 }
@@ -95,15 +91,15 @@ func (t *StdioClientTransport) Start(ctx context.Context) error {
 	}
 
 	t.ctx, t.cancel = context.WithCancel(ctx)
+	t.closed = false
+	t.exited = make(chan struct{})
 
 	// Create the command
 	t.process = exec.CommandContext(t.ctx, t.serverParams.Command, t.serverParams.Args...)
 
 	// explicitly set process group, so subprocess can receive termination signals
 	// on Unix systems, this helps ensure that all processes in the process group can be terminated
-	t.process.SysProcAttr = &syscall.SysProcAttr{
-		Setpgid: true,
-	}
+	t.process.SysProcAttr = processGroupAttr()
 
 	// Set environment
 	if t.serverParams.Env != nil {
@@ -183,6 +179,7 @@ func (t *StdioClientTransport) Start(ctx context.Context) error {
 	// Wait for process to exit and call close handler when done
 	go func() {
 		err := t.process.Wait()
+		close(t.exited)
 		t.mutex.Lock()
 		t.isConnected = false
 		t.mutex.Unlock()
@@ -260,6 +257,8 @@ func (t *StdioClientTransport) Close() error {
 		return nil
 	}
 
+	t.closed = true
+
 	// Cancel context, terminate process
 	if t.cancel != nil {
 		t.cancel()
@@ -273,13 +272,8 @@ func (t *StdioClientTransport) Close() error {
 		}
 
 		// wait a short time to see if process exits by itself
-		done := make(chan error, 1)
-		go func() {
-			done <- t.process.Wait()
-		}()
-
 		select {
-		case <-done:
+		case <-t.exited:
 			// process has exited, no need to do anything
 		case <-time.After(100 * time.Millisecond):
 			// if process does not exit by itself, force terminate it
@@ -315,6 +309,14 @@ func (t *StdioClientTransport) Send(msg common.JSONRPCMessage) error {
 	return nil
 }
 
+// Closed reports whether the transport was closed with Close, as opposed to the
+// process exiting by itself
+func (t *StdioClientTransport) Closed() bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.closed
+}
+
 // SetCloseHandler sets the connection close callback
 func (t *StdioClientTransport) SetCloseHandler(handler func()) {
 	t.closeHandler = handler
@@ -12,8 +12,8 @@ import (
 )
 
 func TestStdioTransport(t *testing.T) {
-	// Create a test echo server command
-	echoCmd := exec.Command("echo", "test")
+	// Create a test server command that keeps running until stdin is closed
+	echoCmd := exec.Command("cat")
 
 	params := StdioServerParameters{
 		Command: echoCmd.Path,
@@ -88,3 +88,36 @@ func TestStdioTransportWithCustomEnv(t *testing.T) {
 	err = transport.Close()
 	assert.NoError(t, err)
 }
+
+func TestStdioTransportClosed(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// A process that exits by itself isn't closed
+	transport := NewStdioClientTransport(StdioServerParameters{Command: "true", Env: GetDefaultEnvironment()})
+	exited := make(chan struct{})
+	transport.SetCloseHandler(func() { close(exited) })
+
+	assert.NoError(t, transport.Start(ctx))
+	select {
+	case <-exited:
+	case <-time.After(5 * time.Second):
+		t.Fatal("close handler wasn't called after the process exited")
+	}
+	assert.False(t, transport.Closed())
+
+	// A process that is terminated with Close is
+	transport = NewStdioClientTransport(StdioServerParameters{Command: "cat", Env: GetDefaultEnvironment()})
+	closed := make(chan bool, 1)
+	transport.SetCloseHandler(func() { closed <- transport.Closed() })
+
+	assert.NoError(t, transport.Start(ctx))
+	assert.False(t, transport.Closed())
+	assert.NoError(t, transport.Close())
+	select {
+	case wasClosed := <-closed:
+		assert.True(t, wasClosed)
+	case <-time.After(5 * time.Second):
+		t.Fatal("close handler wasn't called after Close")
+	}
+}
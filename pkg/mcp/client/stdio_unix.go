@@ -0,0 +1,17 @@
+//go:build !windows
+
+package client
+
+import "syscall"
+
+// DefaultInheritedEnvVars is the default environment variables to inherit
+var DefaultInheritedEnvVars = []string{
+	"HOME", "LOGNAME", "PATH", "SHELL", "TERM", "USER",
+}
+
+// processGroupAttr starts a server process in its own process group
+func processGroupAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{
+		Setpgid: true,
+	}
+}
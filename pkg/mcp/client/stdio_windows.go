@@ -0,0 +1,17 @@
+//go:build windows
+
+package client
+
+import "syscall"
+
+// DefaultInheritedEnvVars is the default environment variables to inherit, many programs don't
+// start on Windows without the system directories
+var DefaultInheritedEnvVars = []string{
+	"APPDATA", "HOMEDRIVE", "HOMEPATH", "LOCALAPPDATA", "PATH", "PATHEXT", "PROCESSOR_ARCHITECTURE",
+	"PROGRAMFILES", "SYSTEMDRIVE", "SYSTEMROOT", "TEMP", "USERNAME", "USERPROFILE",
+}
+
+// processGroupAttr returns no attributes, Windows has no process groups like Unix
+func processGroupAttr() *syscall.SysProcAttr {
+	return nil
+}
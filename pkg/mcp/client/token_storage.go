@@ -0,0 +1,230 @@
+package client
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+
+	"github.com/pederhe/nca/pkg/mcp/common"
+)
+
+// Size of the key that encrypts stored OAuth state, AES-256
+const tokenKeySize = 32
+
+// Characters that are replaced in server names to get safe file names
+var unsafeFileNameChars = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// storedAuthState is the OAuth state of one server as stored by FileTokenStorage
+type storedAuthState struct {
+	Tokens             *common.OAuthTokens            `json:"tokens,omitempty"`
+	ClientInfo         *common.OAuthClientInformation `json:"client_info,omitempty"`
+	ClientRedirectURIs []string                       `json:"client_redirect_uris,omitempty"`
+	CodeVerifier       string                         `json:"code_verifier,omitempty"`
+}
+
+// FileTokenStorage is a TokenStorage that keeps the OAuth state of one server in a file
+// encrypted with AES-GCM, so logins survive restarts without storing tokens in plain text
+type FileTokenStorage struct {
+	path       string
+	serverName string
+	gcm        cipher.AEAD
+	mutex      sync.Mutex
+}
+
+// NewFileTokenStorage creates a token storage for a server in dir. Every server has its own
+// file, key must be 32 bytes, see LoadTokenKey.
+func NewFileTokenStorage(dir string, serverName string, key []byte) (*FileTokenStorage, error) {
+	if len(key) != tokenKeySize {
+		return nil, fmt.Errorf("token key must be %d bytes", tokenKeySize)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileTokenStorage{
+		path:       filepath.Join(dir, tokenFileName(serverName)),
+		serverName: serverName,
+		gcm:        gcm,
+	}, nil
+}
+
+// tokenFileName returns the file name of a server. A hash of the name keeps names that only
+// differ in replaced characters apart.
+func tokenFileName(serverName string) string {
+	hash := sha256.Sum256([]byte(serverName))
+	return fmt.Sprintf("%s-%s.enc", unsafeFileNameChars.ReplaceAllString(serverName, "_"), hex.EncodeToString(hash[:4]))
+}
+
+// Path returns the file the OAuth state is stored in
+func (s *FileTokenStorage) Path() string {
+	return s.path
+}
+
+// SaveTokens implements the TokenStorage interface
+func (s *FileTokenStorage) SaveTokens(tokens *common.OAuthTokens) error {
+	return s.update(func(state *storedAuthState) {
+		state.Tokens = tokens
+	})
+}
+
+// LoadTokens implements the TokenStorage interface
+func (s *FileTokenStorage) LoadTokens() (*common.OAuthTokens, error) {
+	state, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	return state.Tokens, nil
+}
+
+// SaveClientInfo implements the TokenStorage interface. The redirect URIs the client was
+// registered with are unknown, so stored ones are removed.
+func (s *FileTokenStorage) SaveClientInfo(info *common.OAuthClientInformation) error {
+	return s.update(func(state *storedAuthState) {
+		state.ClientInfo = info
+		state.ClientRedirectURIs = nil
+	})
+}
+
+// SaveClientRegistration implements the ClientRegistrationStorage interface
+func (s *FileTokenStorage) SaveClientRegistration(info *common.OAuthClientInformationFull) error {
+	return s.update(func(state *storedAuthState) {
+		clientInfo := info.OAuthClientInformation
+		state.ClientInfo = &clientInfo
+		state.ClientRedirectURIs = info.RedirectURIs
+	})
+}
+
+// LoadClientRedirectURIs returns the redirect URIs the stored client was registered with
+func (s *FileTokenStorage) LoadClientRedirectURIs() ([]string, error) {
+	state, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	return state.ClientRedirectURIs, nil
+}
+
+// LoadClientInfo implements the TokenStorage interface
+func (s *FileTokenStorage) LoadClientInfo() (*common.OAuthClientInformation, error) {
+	state, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	return state.ClientInfo, nil
+}
+
+// SaveCodeVerifier implements the TokenStorage interface
+func (s *FileTokenStorage) SaveCodeVerifier(codeVerifier string) error {
+	return s.update(func(state *storedAuthState) {
+		state.CodeVerifier = codeVerifier
+	})
+}
+
+// LoadCodeVerifier implements the TokenStorage interface
+func (s *FileTokenStorage) LoadCodeVerifier() (string, error) {
+	state, err := s.load()
+	if err != nil {
+		return "", err
+	}
+	if state.CodeVerifier == "" {
+		return "", errors.New("token not found")
+	}
+	return state.CodeVerifier, nil
+}
+
+// Clear removes the stored OAuth state of the server
+func (s *FileTokenStorage) Clear() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := os.Remove(s.path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// load reads and decrypts the stored state, a missing file is an empty state
+func (s *FileTokenStorage) load() (*storedAuthState, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.read()
+}
+
+// update changes the stored state and writes it back
+func (s *FileTokenStorage) update(change func(state *storedAuthState)) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// State that can't be decrypted, e.g. after the key was lost, is replaced
+	state, err := s.read()
+	if err != nil {
+		state = &storedAuthState{}
+	}
+	change(state)
+	return s.write(state)
+}
+
+// read decrypts the state file, the mutex must be held
+func (s *FileTokenStorage) read() (*storedAuthState, error) {
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return &storedAuthState{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	nonceSize := s.gcm.NonceSize()
+	if len(data) < nonceSize {
+		return nil, fmt.Errorf("token file %s is corrupt", s.path)
+	}
+	// The server name is authenticated so a file copied to another server's name doesn't decrypt
+	plaintext, err := s.gcm.Open(nil, data[:nonceSize], data[nonceSize:], []byte(s.serverName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt token file %s, log in to the server again", s.path)
+	}
+
+	var state storedAuthState
+	if err := json.Unmarshal(plaintext, &state); err != nil {
+		return nil, fmt.Errorf("failed to parse token file %s: %w", s.path, err)
+	}
+	return &state, nil
+}
+
+// write encrypts the state and replaces the state file, the mutex must be held
+func (s *FileTokenStorage) write(state *storedAuthState) error {
+	plaintext, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	nonce := make([]byte, s.gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return err
+	}
+	data := s.gcm.Seal(nonce, nonce, plaintext, []byte(s.serverName))
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return err
+	}
+	// Write a temporary file first so an interrupted write doesn't lose the stored login
+	tmpPath := s.path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, s.path)
+}
@@ -0,0 +1,203 @@
+package client
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pederhe/nca/pkg/mcp/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryKeyring is a keyring that keeps its entries in memory
+type memoryKeyring struct {
+	entries map[string]string
+	getErr  error
+	setErr  error
+}
+
+func (k *memoryKeyring) Get(service, account string) (string, error) {
+	if k.getErr != nil {
+		return "", k.getErr
+	}
+	return k.entries[service+"/"+account], nil
+}
+
+func (k *memoryKeyring) Set(service, account, secret string) error {
+	if k.setErr != nil {
+		return k.setErr
+	}
+	k.entries[service+"/"+account] = secret
+	return nil
+}
+
+// withKeyring replaces the system keyring for a test
+func withKeyring(t *testing.T, k keyring) {
+	original := systemKeyring
+	systemKeyring = k
+	t.Cleanup(func() { systemKeyring = original })
+}
+
+func testTokenKey() []byte {
+	return bytes.Repeat([]byte{7}, tokenKeySize)
+}
+
+func TestFileTokenStorage(t *testing.T) {
+	dir := t.TempDir()
+	storage, err := NewFileTokenStorage(dir, "github", testTokenKey())
+	require.NoError(t, err)
+
+	// Nothing is stored yet
+	tokens, err := storage.LoadTokens()
+	assert.NoError(t, err)
+	assert.Nil(t, tokens)
+	_, err = storage.LoadCodeVerifier()
+	assert.Error(t, err)
+
+	require.NoError(t, storage.SaveTokens(&common.OAuthTokens{AccessToken: "secret_access_token", RefreshToken: "secret_refresh_token"}))
+	require.NoError(t, storage.SaveClientInfo(&common.OAuthClientInformation{ClientID: "client_id"}))
+	require.NoError(t, storage.SaveCodeVerifier("code_verifier"))
+
+	// A new storage with the same key reads what was saved
+	storage, err = NewFileTokenStorage(dir, "github", testTokenKey())
+	require.NoError(t, err)
+	tokens, err = storage.LoadTokens()
+	require.NoError(t, err)
+	assert.Equal(t, "secret_access_token", tokens.AccessToken)
+	assert.Equal(t, "secret_refresh_token", tokens.RefreshToken)
+	info, err := storage.LoadClientInfo()
+	require.NoError(t, err)
+	assert.Equal(t, "client_id", info.ClientID)
+	verifier, err := storage.LoadCodeVerifier()
+	require.NoError(t, err)
+	assert.Equal(t, "code_verifier", verifier)
+
+	// The file is encrypted and only readable by the user
+	data, err := os.ReadFile(storage.Path())
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "secret_access_token")
+	fileInfo, err := os.Stat(storage.Path())
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), fileInfo.Mode().Perm())
+
+	require.NoError(t, storage.Clear())
+	tokens, err = storage.LoadTokens()
+	assert.NoError(t, err)
+	assert.Nil(t, tokens)
+}
+
+func TestFileTokenStorageServers(t *testing.T) {
+	dir := t.TempDir()
+	first, err := NewFileTokenStorage(dir, "my/server", testTokenKey())
+	require.NoError(t, err)
+	second, err := NewFileTokenStorage(dir, "my_server", testTokenKey())
+	require.NoError(t, err)
+
+	// Names that map to the same safe name still get their own files
+	assert.NotEqual(t, first.Path(), second.Path())
+	assert.Equal(t, dir, filepath.Dir(first.Path()))
+
+	require.NoError(t, first.SaveTokens(&common.OAuthTokens{AccessToken: "first"}))
+	tokens, err := second.LoadTokens()
+	assert.NoError(t, err)
+	assert.Nil(t, tokens)
+
+	// A file copied to another server doesn't decrypt
+	data, err := os.ReadFile(first.Path())
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(second.Path(), data, 0600))
+	_, err = second.LoadTokens()
+	assert.Error(t, err)
+}
+
+func TestFileTokenStorageWrongKey(t *testing.T) {
+	dir := t.TempDir()
+	storage, err := NewFileTokenStorage(dir, "server", testTokenKey())
+	require.NoError(t, err)
+	require.NoError(t, storage.SaveTokens(&common.OAuthTokens{AccessToken: "token"}))
+
+	otherKey := bytes.Repeat([]byte{8}, tokenKeySize)
+	other, err := NewFileTokenStorage(dir, "server", otherKey)
+	require.NoError(t, err)
+	_, err = other.LoadTokens()
+	assert.Error(t, err)
+
+	// Saving with the new key replaces the state that can't be decrypted
+	require.NoError(t, other.SaveTokens(&common.OAuthTokens{AccessToken: "new_token"}))
+	tokens, err := other.LoadTokens()
+	require.NoError(t, err)
+	assert.Equal(t, "new_token", tokens.AccessToken)
+
+	_, err = NewFileTokenStorage(dir, "server", []byte("short"))
+	assert.Error(t, err)
+}
+
+func TestLoadTokenKeyKeyring(t *testing.T) {
+	k := &memoryKeyring{entries: make(map[string]string)}
+	withKeyring(t, k)
+	keyFile := filepath.Join(t.TempDir(), ".key")
+
+	key, err := LoadTokenKey(keyFile)
+	require.NoError(t, err)
+	assert.Len(t, key, tokenKeySize)
+	assert.NotEmpty(t, k.entries[keyringService+"/"+keyringAccount])
+	assert.NoFileExists(t, keyFile)
+
+	again, err := LoadTokenKey(keyFile)
+	require.NoError(t, err)
+	assert.Equal(t, key, again)
+
+	// A locked keyring doesn't get a new key that would replace the stored one
+	k.getErr = errors.New("keychain is locked")
+	_, err = LoadTokenKey(keyFile)
+	assert.EqualError(t, err, "failed to read the MCP token key from the keyring: keychain is locked")
+	assert.Equal(t, base64.StdEncoding.EncodeToString(key), k.entries[keyringService+"/"+keyringAccount])
+	assert.NoFileExists(t, keyFile)
+}
+
+func TestLoadTokenKeyFile(t *testing.T) {
+	// The key is kept in the key file when the keyring can't store it
+	withKeyring(t, &memoryKeyring{entries: make(map[string]string), setErr: errors.New("no keyring")})
+	keyFile := filepath.Join(t.TempDir(), "tokens", ".key")
+
+	key, err := LoadTokenKey(keyFile)
+	require.NoError(t, err)
+	assert.Len(t, key, tokenKeySize)
+	fileInfo, err := os.Stat(keyFile)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), fileInfo.Mode().Perm())
+
+	// Without any keyring the same key is read from the file
+	withKeyring(t, nil)
+	again, err := LoadTokenKey(keyFile)
+	require.NoError(t, err)
+	assert.Equal(t, key, again)
+}
+
+func TestFileTokenStorageClientRegistration(t *testing.T) {
+	storage, err := NewFileTokenStorage(t.TempDir(), "github", testTokenKey())
+	require.NoError(t, err)
+
+	// Clients saved by the provider keep the redirect URIs they were registered with
+	provider := NewDefaultOAuthClientProvider("http://127.0.0.1:8123/callback", nil, storage, nil)
+	require.NoError(t, provider.SaveClientInformation(&common.OAuthClientInformationFull{
+		OAuthClientMetadata:    common.OAuthClientMetadata{RedirectURIs: []string{"http://127.0.0.1:8123/callback"}},
+		OAuthClientInformation: common.OAuthClientInformation{ClientID: "client_id"},
+	}))
+	info, err := storage.LoadClientInfo()
+	require.NoError(t, err)
+	assert.Equal(t, "client_id", info.ClientID)
+	redirectURIs, err := storage.LoadClientRedirectURIs()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"http://127.0.0.1:8123/callback"}, redirectURIs)
+
+	// Client information saved without them doesn't keep the old ones
+	require.NoError(t, storage.SaveClientInfo(&common.OAuthClientInformation{ClientID: "other_client"}))
+	redirectURIs, err = storage.LoadClientRedirectURIs()
+	require.NoError(t, err)
+	assert.Empty(t, redirectURIs)
+}
@@ -4,7 +4,7 @@ package common
 type McpServer struct {
 	Name              string                `json:"name"`
 	Config            string                `json:"config"`
-	Status            string                `json:"status"` // "connected", "connecting", "disconnected"
+	Status            string                `json:"status"` // "connected", "connecting", "disconnected", "disabled"
 	Error             string                `json:"error,omitempty"`
 	Tools             []McpTool             `json:"tools,omitempty"`
 	Resources         []McpResource         `json:"resources,omitempty"`
@@ -1,12 +1,19 @@
 package utils
 
 import (
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"net/http"
+	"os"
 	"os/exec"
 	"runtime"
 	"strings"
 )
 
+// ErrNoClipboardImage is returned when the clipboard doesn't hold an image
+var ErrNoClipboardImage = errors.New("the clipboard doesn't contain an image")
+
 // GetClipboardContent retrieves the content from the clipboard
 func GetClipboardContent() (string, error) {
 	var cmd *exec.Cmd
@@ -47,3 +54,56 @@ func IsClipboardPrefix(input string) (bool, string, error) {
 
 	return false, trimmedClip, nil
 }
+
+// GetClipboardImage retrieves the image in the clipboard as PNG data
+func GetClipboardImage() ([]byte, error) {
+	var cmd *exec.Cmd
+
+	switch runtime.GOOS {
+	case "darwin":
+		// AppleScript returns the PNG data as «data PNGf<hex>»
+		cmd = exec.Command("osascript", "-e", "get the clipboard as «class PNGf»")
+	case "linux":
+		if os.Getenv("WAYLAND_DISPLAY") != "" {
+			cmd = exec.Command("wl-paste", "--type", "image/png")
+		} else {
+			cmd = exec.Command("xclip", "-selection", "clipboard", "-t", "image/png", "-o")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported operating system: %s", runtime.GOOS)
+	}
+
+	output, err := cmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			// The tools fail when the clipboard has no data of the requested type
+			return nil, ErrNoClipboardImage
+		}
+		return nil, err
+	}
+	if runtime.GOOS == "darwin" {
+		output, err = parseAppleScriptData(string(output))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(output) == 0 || http.DetectContentType(output) != "image/png" {
+		return nil, ErrNoClipboardImage
+	}
+	return output, nil
+}
+
+// parseAppleScriptData decodes data printed by osascript as «data XXXX<hex>», where XXXX is the type code
+func parseAppleScriptData(output string) ([]byte, error) {
+	output = strings.TrimSpace(output)
+	if !strings.HasPrefix(output, "«data ") || !strings.HasSuffix(output, "»") {
+		return nil, ErrNoClipboardImage
+	}
+	encoded := strings.TrimSuffix(strings.TrimPrefix(output, "«data "), "»")
+	if len(encoded) < 4 {
+		return nil, ErrNoClipboardImage
+	}
+	return hex.DecodeString(encoded[4:])
+}
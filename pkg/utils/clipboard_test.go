@@ -0,0 +1,22 @@
+package utils
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestParseAppleScriptData(t *testing.T) {
+	data, err := parseAppleScriptData("«data PNGf89504E470D0A1A0A»\n")
+	if err != nil {
+		t.Fatalf("parseAppleScriptData() error = %v", err)
+	}
+	if !bytes.Equal(data, []byte("\x89PNG\r\n\x1a\n")) {
+		t.Errorf("parseAppleScriptData() = %x", data)
+	}
+
+	for _, output := range []string{"", "some text", "«data PN»", "«data PNGfZZ»"} {
+		if _, err := parseAppleScriptData(output); err == nil {
+			t.Errorf("parseAppleScriptData(%q) expected an error", output)
+		}
+	}
+}
@@ -2,6 +2,8 @@ package utils
 
 import (
 	"os"
+	"regexp"
+	"strings"
 )
 
 // ANSI color codes for terminal output
@@ -13,8 +15,13 @@ const (
 	ColorPurple = "\033[35m"
 	ColorRed    = "\033[31m"
 	ColorCyan   = "\033[36m"
+	ColorGray   = "\033[90m"
+	ColorBold   = "\033[1m"
 )
 
+// Matches ANSI escape sequences, e.g. colors and cursor movement
+var ansiEscapeRegex = regexp.MustCompile(`\x1b\[[0-9;?]*[A-Za-z]`)
+
 // IsOutputPiped detects whether standard output is redirected through a pipe
 func IsOutputPiped() bool {
 	stat, _ := os.Stdout.Stat()
@@ -37,3 +44,29 @@ func ColoredText(text string, color string) string {
 	}
 	return color + text + ColorReset
 }
+
+// StripANSI removes ANSI escape sequences from text
+func StripANSI(text string) string {
+	return ansiEscapeRegex.ReplaceAllString(text, "")
+}
+
+// ColoredDiff colors a unified diff: added lines green, removed lines red and hunk headers cyan
+func ColoredDiff(diff string) string {
+	if IsOutputPiped() {
+		return diff
+	}
+	lines := strings.Split(diff, "\n")
+	for i, line := range lines {
+		switch {
+		case strings.HasPrefix(line, "+++") || strings.HasPrefix(line, "---"):
+			lines[i] = ColorYellow + line + ColorReset
+		case strings.HasPrefix(line, "+"):
+			lines[i] = ColorGreen + line + ColorReset
+		case strings.HasPrefix(line, "-"):
+			lines[i] = ColorRed + line + ColorReset
+		case strings.HasPrefix(line, "@@"):
+			lines[i] = ColorCyan + line + ColorReset
+		}
+	}
+	return strings.Join(lines, "\n")
+}
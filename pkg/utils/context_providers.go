@@ -0,0 +1,132 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+// Context providers resolve the references of a prompt, paths or URLs in backticks and @mentions,
+// to the content added to the prompt after them
+
+// maxPromptDiffSize limits the diffs added for git: references
+const maxPromptDiffSize = 64 * 1024
+
+// mentionRegex matches @mentions in prompts, like @main.go, @src/, @git:staged or @https://...
+var mentionRegex = regexp.MustCompile(`(^|\s)@([^\s@]+)`)
+
+// contextProvider resolves the references of one kind
+type contextProvider struct {
+	matches func(ref string) bool
+	resolve func(ref string) (string, error)
+}
+
+// contextProviders are tried in order, the first that matches a reference resolves it
+var contextProviders = []contextProvider{
+	{matches: IsURL, resolve: resolveURLReference},
+	{matches: isGitReference, resolve: resolveGitReference},
+	{matches: isDirectory, resolve: resolveDirectoryReference},
+	{matches: func(string) bool { return true }, resolve: resolveFileReference},
+}
+
+// resolveReference returns the content a reference adds to a prompt
+func resolveReference(ref string) (string, error) {
+	for _, provider := range contextProviders {
+		if provider.matches(ref) {
+			return provider.resolve(ref)
+		}
+	}
+	return "", fmt.Errorf("unknown reference: %s", ref)
+}
+
+// mentionTarget returns the reference of a mention without trailing punctuation of the sentence,
+// and whether it names something that exists. Other mentions, like of people, are left alone.
+func mentionTarget(mention string) (string, bool) {
+	ref := strings.TrimRight(mention, ".,;:!?)'\"")
+	if strings.HasPrefix(ref, "image:") {
+		return "", false
+	}
+	if IsURL(ref) || isGitReference(ref) {
+		return ref, true
+	}
+	_, err := os.Stat(ref)
+	return ref, err == nil
+}
+
+// HasMentions returns whether the prompt mentions files, directories, git changes or URLs
+func HasMentions(prompt string) bool {
+	for _, match := range mentionRegex.FindAllStringSubmatch(prompt, -1) {
+		if _, ok := mentionTarget(match[2]); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func resolveURLReference(ref string) (string, error) {
+	content, err := FetchWebContent(ref)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch web content: %v", err)
+	}
+	return "Web content:\n" + content, nil
+}
+
+func resolveFileReference(ref string) (string, error) {
+	content, err := readFileContent(ref)
+	if err != nil {
+		return "", fmt.Errorf("failed to read file content: %v", err)
+	}
+	return "File content:\n" + content, nil
+}
+
+func isDirectory(ref string) bool {
+	info, err := os.Stat(ref)
+	return err == nil && info.IsDir()
+}
+
+// isGitReference returns whether a reference is one of git:staged (the staged changes),
+// git:diff (all uncommitted changes) or git:<branch> (the changes of the current branch since it
+// forked from branch)
+func isGitReference(ref string) bool {
+	return strings.HasPrefix(ref, "git:") && len(ref) > len("git:")
+}
+
+func resolveGitReference(ref string) (string, error) {
+	target := strings.TrimPrefix(ref, "git:")
+	var args []string
+	var description string
+	switch {
+	case target == "staged":
+		args = []string{"diff", "--cached"}
+		description = "the staged changes"
+	case target == "diff":
+		args = []string{"diff", "HEAD"}
+		description = "the uncommitted changes"
+	case strings.HasPrefix(target, "-"):
+		return "", fmt.Errorf("invalid git reference: %s", ref)
+	default:
+		args = []string{"diff", target + "...HEAD"}
+		description = "the changes since " + target
+	}
+
+	cmd := exec.Command("git", append([]string{"--no-pager", "-c", "core.quotepath=off"}, append(args, "--no-color", "--no-ext-diff")...)...)
+	output, err := cmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+			err = errors.New(strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return "", fmt.Errorf("failed to get the git diff of %s: %v", ref, err)
+	}
+	diff := string(output)
+	if strings.TrimSpace(diff) == "" {
+		return fmt.Sprintf("Git diff of %s: no changes", description), nil
+	}
+	if len(diff) > maxPromptDiffSize {
+		diff = strings.ToValidUTF8(diff[:maxPromptDiffSize], "") + fmt.Sprintf("\n[Diff truncated at %s of %s]", FormatSize(maxPromptDiffSize), FormatSize(int64(len(output))))
+	}
+	return fmt.Sprintf("Git diff of %s:\n%s", description, diff), nil
+}
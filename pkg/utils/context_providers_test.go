@@ -0,0 +1,84 @@
+package utils
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func createMentionFiles(t *testing.T) {
+	t.Chdir(t.TempDir())
+	require.NoError(t, os.MkdirAll(filepath.Join("src", "api"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join("src", "main.go"), []byte("package main\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join("src", "api", "handler.go"), []byte("package api\n"), 0644))
+	require.NoError(t, os.WriteFile("notes.txt", []byte("see @src/main.go\n"), 0644))
+}
+
+func TestProcessPromptMentions(t *testing.T) {
+	createMentionFiles(t)
+
+	result, images, err := ProcessPrompt("Explain @src/main.go, then ask @alice about `notes.txt`.")
+	require.NoError(t, err)
+	assert.Empty(t, images)
+	assert.Equal(t, "Explain @src/main.go\n\nFile content:\npackage main\n\n\n, then ask @alice about `notes.txt`\n\nFile content:\nsee @src/main.go\n\n\n.", result)
+
+	result, _, err = ProcessPrompt("@src/ has the code")
+	require.NoError(t, err)
+	assert.Contains(t, result, "@src/\n\nDirectory tree:\n")
+	assert.Contains(t, result, "handler.go")
+
+	// Mentions in backticks are resolved once, as backtick references
+	result, _, err = ProcessPrompt("`@src/main.go`")
+	require.Error(t, err)
+	assert.Empty(t, result)
+
+	assert.True(t, HasMentions("look at @src/main.go."))
+	assert.False(t, HasMentions("ask @alice"))
+	assert.False(t, HasMentions("mail me at me@example.com"))
+	assert.False(t, HasMentions("@image:missing.png"))
+}
+
+func TestProcessPromptGitMentions(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	createMentionFiles(t)
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"add", "-A"},
+		{"-c", "user.name=Test", "-c", "user.email=test@example.com", "commit", "-q", "-m", "Initial commit"},
+	} {
+		output, err := exec.Command("git", args...).CombinedOutput()
+		require.NoError(t, err, string(output))
+	}
+
+	result, _, err := ProcessPrompt("Review @git:staged")
+	require.NoError(t, err)
+	assert.Equal(t, "Review @git:staged\n\nGit diff of the staged changes: no changes\n\n", result)
+
+	require.NoError(t, os.WriteFile("notes.txt", []byte("changed\n"), 0644))
+	output, err := exec.Command("git", "add", "notes.txt").CombinedOutput()
+	require.NoError(t, err, string(output))
+	result, _, err = ProcessPrompt("Review @git:staged")
+	require.NoError(t, err)
+	assert.Contains(t, result, "Git diff of the staged changes:\ndiff --git a/notes.txt b/notes.txt")
+	assert.Contains(t, result, "+changed")
+
+	// Mentions that fail to resolve don't fail the prompt, the model is told what's missing
+	result, _, err = ProcessPrompt("@git:--output=x")
+	require.NoError(t, err)
+	assert.Equal(t, "@git:--output=x\n\n[@git:--output=x was not added: invalid git reference: git:--output=x]\n\n", result)
+	result, _, err = ProcessPrompt("Compare with @git:missing-branch.")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(result, "Compare with @git:missing-branch\n\n[@git:missing-branch was not added: failed to get the git diff of git:missing-branch"), result)
+	assert.True(t, strings.HasSuffix(result, "]\n\n."), result)
+
+	// Backtick references must resolve
+	_, _, err = ProcessPrompt("`git:missing-branch`")
+	assert.ErrorContains(t, err, "failed to get the git diff of git:missing-branch")
+}
@@ -0,0 +1,198 @@
+package utils
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Limits of the directories added to prompts
+const (
+	// maxDirectoryTreeFiles limits the files shown in the tree of a directory
+	maxDirectoryTreeFiles = 200
+	// maxDirectoryContentSize is the budget of the file contents added for a directory
+	maxDirectoryContentSize = 64 * 1024
+	// maxDirectoryFileSize is the size of the largest file whose content is added
+	maxDirectoryFileSize = 16 * 1024
+	// maxOmittedFilesListed limits the files listed as left out of the contents
+	maxOmittedFilesListed = 20
+)
+
+// Directories skipped outside of git repositories, they are large and rarely relevant
+var directorySkipDirs = map[string]bool{
+	"node_modules": true,
+	"vendor":       true,
+	"dist":         true,
+	"build":        true,
+	"target":       true,
+	"__pycache__":  true,
+}
+
+// resolveDirectoryReference returns the file tree of a directory and the contents of its files,
+// smaller and less nested files first, until the size budget is used up
+func resolveDirectoryReference(ref string) (string, error) {
+	files, err := listDirectoryFiles(ref)
+	if err != nil {
+		return "", fmt.Errorf("failed to read directory: %v", err)
+	}
+
+	var result strings.Builder
+	result.WriteString("Directory tree:\n")
+	result.WriteString(PrintDirectoryTree(buildFileTree(ref, files)))
+	if len(files) > maxDirectoryTreeFiles {
+		fmt.Fprintf(&result, "(%d more files not shown)\n", len(files)-maxDirectoryTreeFiles)
+	}
+
+	var omitted []string
+	total := 0
+	for _, file := range selectionOrder(ref, files) {
+		filePath := path.Join(filepath.ToSlash(ref), file)
+		info, err := os.Stat(filepath.FromSlash(filePath))
+		if err != nil || info.Size() > maxDirectoryFileSize || total+int(info.Size()) > maxDirectoryContentSize {
+			omitted = append(omitted, filePath)
+			continue
+		}
+		// Binary files are left out without mention, the tree shows them
+		content, err := readFileContent(filePath)
+		if err != nil {
+			continue
+		}
+		total += len(content)
+		fmt.Fprintf(&result, "\nFile content of %s:\n%s\n", filePath, content)
+	}
+
+	if len(omitted) > 0 {
+		sort.Strings(omitted)
+		listed := omitted
+		if len(listed) > maxOmittedFilesListed {
+			listed = listed[:maxOmittedFilesListed]
+		}
+		fmt.Fprintf(&result, "\nFiles whose content was left out, they are too large or over the size budget of %s: %s",
+			FormatSize(maxDirectoryContentSize), strings.Join(listed, ", "))
+		if len(omitted) > len(listed) {
+			fmt.Fprintf(&result, " and %d more", len(omitted)-len(listed))
+		}
+		result.WriteString("\nReference them on their own to add their content.\n")
+	}
+	return result.String(), nil
+}
+
+// listDirectoryFiles returns the files of a directory, relative to it with forward slashes. In a
+// git repository the files ignored by git are left out, elsewhere hidden files and dependency or
+// build output directories.
+func listDirectoryFiles(dir string) ([]string, error) {
+	if _, err := os.ReadDir(dir); err != nil {
+		return nil, err
+	}
+
+	cmd := exec.Command("git", "-c", "core.quotepath=off", "ls-files", "--cached", "--others", "--exclude-standard", "-z", "--", ".")
+	cmd.Dir = dir
+	if output, err := cmd.Output(); err == nil {
+		var files []string
+		for _, file := range strings.Split(string(output), "\x00") {
+			// Files deleted from the working tree are still in the index
+			if info, err := os.Stat(filepath.Join(dir, filepath.FromSlash(file))); file != "" && err == nil && !info.IsDir() {
+				files = append(files, file)
+			}
+		}
+		// A directory git ignores completely is listed like one outside of a repository
+		if len(files) > 0 {
+			sort.Strings(files)
+			return files, nil
+		}
+	}
+
+	var files []string
+	err := filepath.WalkDir(dir, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil || filePath == dir {
+			return nil
+		}
+		if strings.HasPrefix(entry.Name(), ".") || (entry.IsDir() && directorySkipDirs[entry.Name()]) {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !entry.IsDir() {
+			rel, err := filepath.Rel(dir, filePath)
+			if err == nil {
+				files = append(files, filepath.ToSlash(rel))
+			}
+		}
+		return nil
+	})
+	return files, err
+}
+
+// buildFileTree returns the tree of the first files of a directory, directories first like in
+// DirectoryTree
+func buildFileTree(dir string, files []string) *TreeNode {
+	root := &TreeNode{Name: filepath.ToSlash(filepath.Clean(dir)), IsDir: true}
+	if len(files) > maxDirectoryTreeFiles {
+		files = files[:maxDirectoryTreeFiles]
+	}
+	for _, file := range files {
+		node := root
+		parts := strings.Split(file, "/")
+		for i, part := range parts {
+			var child *TreeNode
+			for _, existing := range node.Children {
+				if existing.Name == part {
+					child = existing
+					break
+				}
+			}
+			if child == nil {
+				child = &TreeNode{Name: part, IsDir: i < len(parts)-1}
+				if !child.IsDir {
+					if info, err := os.Stat(filepath.Join(dir, filepath.FromSlash(file))); err == nil {
+						child.Size = info.Size()
+					}
+				}
+				node.Children = append(node.Children, child)
+			}
+			node = child
+		}
+	}
+	sortFileTree(root)
+	return root
+}
+
+// sortFileTree sorts the children of the nodes of a tree, directories first, then by name
+func sortFileTree(node *TreeNode) {
+	sort.Slice(node.Children, func(i, j int) bool {
+		if node.Children[i].IsDir != node.Children[j].IsDir {
+			return node.Children[i].IsDir
+		}
+		return node.Children[i].Name < node.Children[j].Name
+	})
+	for _, child := range node.Children {
+		sortFileTree(child)
+	}
+}
+
+// selectionOrder returns the files in the order their contents are added: the top level files
+// first, so a package's overview comes before its details, and within a level the smaller files
+// first, so more of them fit in the budget
+func selectionOrder(dir string, files []string) []string {
+	sizes := make(map[string]int64, len(files))
+	for _, file := range files {
+		if info, err := os.Stat(filepath.Join(dir, filepath.FromSlash(file))); err == nil {
+			sizes[file] = info.Size()
+		}
+	}
+	ordered := append([]string(nil), files...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		depthI, depthJ := strings.Count(ordered[i], "/"), strings.Count(ordered[j], "/")
+		if depthI != depthJ {
+			return depthI < depthJ
+		}
+		return sizes[ordered[i]] < sizes[ordered[j]]
+	})
+	return ordered
+}
@@ -0,0 +1,72 @@
+package utils
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveDirectoryReference(t *testing.T) {
+	t.Chdir(t.TempDir())
+	for path, content := range map[string]string{
+		"pkg/config/config.go":         "package config\n",
+		"pkg/config/load/load.go":      "package load\n",
+		"pkg/config/large.json":        strings.Repeat("x", maxDirectoryFileSize+1),
+		"pkg/config/.env":              "SECRET=1\n",
+		"pkg/config/node_modules/a.js": "a\n",
+	} {
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+
+	result, err := resolveDirectoryReference("pkg/config/")
+	require.NoError(t, err)
+	assert.Equal(t, "Directory tree:\n"+
+		"pkg/config\n"+
+		"├── load/\n"+
+		"│   └── load.go (13B)\n"+
+		"├── config.go (15B)\n"+
+		"└── large.json (16.0KB)\n"+
+		"\nFile content of pkg/config/config.go:\npackage config\n\n"+
+		"\nFile content of pkg/config/load/load.go:\npackage load\n\n"+
+		"\nFiles whose content was left out, they are too large or over the size budget of 64.0KB: pkg/config/large.json\n"+
+		"Reference them on their own to add their content.\n", result)
+
+	result, _, err = ProcessPrompt("look at `pkg/config/`")
+	require.NoError(t, err)
+	assert.Contains(t, result, "File content of pkg/config/config.go:")
+}
+
+func TestListDirectoryFilesGitIgnore(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := t.TempDir()
+	for path, content := range map[string]string{
+		".gitignore":       "*.log\ngenerated/\n",
+		"main.go":          "package main\n",
+		"debug.log":        "log\n",
+		"generated/gen.go": "package generated\n",
+	} {
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, filepath.Dir(path)), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, path), []byte(content), 0644))
+	}
+	cmd := exec.Command("git", "init", "-q")
+	cmd.Dir = dir
+	output, err := cmd.CombinedOutput()
+	require.NoError(t, err, string(output))
+
+	files, err := listDirectoryFiles(dir)
+	require.NoError(t, err)
+	assert.Equal(t, []string{".gitignore", "main.go"}, files)
+
+	// A directory git ignores is listed without the ignore rules
+	files, err = listDirectoryFiles(filepath.Join(dir, "generated"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"gen.go"}, files)
+}
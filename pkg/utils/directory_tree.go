@@ -132,7 +132,7 @@ func printChild(node *TreeNode, prefix string, builder *strings.Builder, isLast
 	if node.IsDir {
 		builder.WriteString(node.Name + "/\n")
 	} else {
-		size := formatSize(node.Size)
+		size := FormatSize(node.Size)
 		if size != "" {
 			builder.WriteString(fmt.Sprintf("%s (%s)\n", node.Name, size))
 		} else {
@@ -152,8 +152,8 @@ func printChild(node *TreeNode, prefix string, builder *strings.Builder, isLast
 	printTreeNode(node, newPrefix, builder, false)
 }
 
-// formatSize formats file size
-func formatSize(size int64) string {
+// FormatSize formats a size in bytes for display
+func FormatSize(size int64) string {
 	if size < 1024 {
 		return fmt.Sprintf("%dB", size)
 	} else if size < 1024*1024 {
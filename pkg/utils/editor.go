@@ -0,0 +1,57 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// GetEditor returns the editor command of the user, from $VISUAL or $EDITOR, vi by default
+func GetEditor() string {
+	if editor := os.Getenv("VISUAL"); editor != "" {
+		return editor
+	}
+	if editor := os.Getenv("EDITOR"); editor != "" {
+		return editor
+	}
+	return "vi"
+}
+
+// EditText opens text in the user's editor and returns the text after the editor exits
+func EditText(text string) (string, error) {
+	return EditTextAs(text, ".md")
+}
+
+// EditTextAs opens text in the user's editor in a file with the extension, so the editor
+// highlights it for its language, and returns the text after the editor exits
+func EditTextAs(text string, ext string) (string, error) {
+	file, err := os.CreateTemp("", "nca-edit-*"+ext)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(file.Name())
+
+	if _, err := file.WriteString(text); err != nil {
+		file.Close()
+		return "", err
+	}
+	file.Close()
+
+	// The editor command may include arguments, e.g. "code --wait"
+	editor := GetEditor()
+	parts := strings.Fields(editor)
+	cmd := exec.Command(parts[0], append(parts[1:], file.Name())...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("editor %s failed: %w", editor, err)
+	}
+
+	content, err := os.ReadFile(file.Name())
+	if err != nil {
+		return "", err
+	}
+	return string(content), nil
+}
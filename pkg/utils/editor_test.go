@@ -0,0 +1,33 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetEditor(t *testing.T) {
+	t.Setenv("VISUAL", "")
+	t.Setenv("EDITOR", "")
+	assert.Equal(t, "vi", GetEditor())
+
+	t.Setenv("EDITOR", "nano")
+	assert.Equal(t, "nano", GetEditor())
+
+	t.Setenv("VISUAL", "code --wait")
+	assert.Equal(t, "code --wait", GetEditor())
+}
+
+func TestEditText(t *testing.T) {
+	t.Setenv("VISUAL", "")
+	t.Setenv("EDITOR", "sed -i s/tests/benchmarks/")
+
+	edited, err := EditText("Fix the failing tests\n")
+	require.NoError(t, err)
+	assert.Equal(t, "Fix the failing benchmarks\n", edited)
+
+	t.Setenv("EDITOR", "false")
+	_, err = EditText("text")
+	assert.Error(t, err)
+}
@@ -0,0 +1,53 @@
+package utils
+
+import "strings"
+
+// TruncatedText is a text cut down to its first and last lines
+type TruncatedText struct {
+	Head string
+	Tail string
+	// The lines left out between the head and the tail, numbered from 1. The first line is only
+	// shown in part when it's longer than the head.
+	FirstOmittedLine int
+	LastOmittedLine  int
+	TotalLines       int
+}
+
+// TruncateMiddle cuts a text longer than maxChars to about maxChars by leaving out lines in the
+// middle, the head gets two thirds and the tail one third. Generated and vendored files start
+// with their imports and declarations and often end with their exports, the middle is the least
+// useful part. It returns false if the text fits.
+func TruncateMiddle(text string, maxChars int) (TruncatedText, bool) {
+	if maxChars <= 0 || len(text) <= maxChars {
+		return TruncatedText{}, false
+	}
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	headBudget := maxChars * 2 / 3
+	head, size := 0, 0
+	for head < len(lines) && size+len(lines[head]) <= headBudget {
+		size += len(lines[head])
+		head++
+	}
+	tail, size := len(lines), 0
+	for tail > head+1 && size+len(lines[tail-1]) <= maxChars-headBudget {
+		size += len(lines[tail-1])
+		tail--
+	}
+
+	truncated := TruncatedText{
+		Head:             strings.Join(lines[:head], ""),
+		Tail:             strings.Join(lines[tail:], ""),
+		FirstOmittedLine: head + 1,
+		LastOmittedLine:  tail,
+		TotalLines:       len(lines),
+	}
+	if head == 0 {
+		// A single line longer than the head, like in minified files
+		truncated.Head = strings.ToValidUTF8(lines[0][:headBudget], "") + "\n"
+	}
+	return truncated, true
+}
@@ -0,0 +1,45 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTruncateMiddle(t *testing.T) {
+	text := "line 1\nline 2\nline 3\nline 4\nline 5\nline 6\n"
+	_, ok := TruncateMiddle(text, len(text))
+	assert.False(t, ok)
+
+	truncated, ok := TruncateMiddle(text, 21)
+	require.True(t, ok)
+	assert.Equal(t, TruncatedText{Head: "line 1\nline 2\n", Tail: "line 6\n", FirstOmittedLine: 3, LastOmittedLine: 5, TotalLines: 6}, truncated)
+
+	// A line longer than the head is shown in part
+	truncated, ok = TruncateMiddle(strings.Repeat("x", 100), 30)
+	require.True(t, ok)
+	assert.Equal(t, strings.Repeat("x", 20)+"\n", truncated.Head)
+	assert.Equal(t, 1, truncated.FirstOmittedLine)
+	assert.Equal(t, 1, truncated.TotalLines)
+}
+
+func TestReadFileContentTruncatesLargeFiles(t *testing.T) {
+	var builder strings.Builder
+	for i := 1; builder.Len() <= maxPromptFileContent; i++ {
+		fmt.Fprintf(&builder, "line %d\n", i)
+	}
+	path := filepath.Join(t.TempDir(), "generated.txt")
+	require.NoError(t, os.WriteFile(path, []byte(builder.String()), 0644))
+
+	content, err := readFileContent(path)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(content, "line 1\nline 2\n"))
+	assert.Regexp(t, `\n\[File truncated: lines \d+-\d+ of \d+ \(64\.\dKB\) are not shown. Read them with read_file, using offset \d+ and limit to page through them\]\n\n`, content)
+	assert.True(t, strings.HasSuffix(content, fmt.Sprintf("line %d\n", strings.Count(builder.String(), "\n"))))
+	assert.Less(t, len(content), maxPromptFileContent+200)
+}
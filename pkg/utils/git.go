@@ -51,14 +51,19 @@ func GitAdd(files []string) error {
 	return nil
 }
 
-// GitCommit commits the staged changes with the given message
-func GitCommit(message string) error {
-	cmd := exec.Command("git", "commit", "-m", message)
+// GitCommit commits the staged changes with the given message, amend replaces the last commit.
+// It returns the output of git, which includes the output of the commit hooks.
+func GitCommit(message string, amend bool) (string, error) {
+	args := []string{"commit", "-m", message}
+	if amend {
+		args = append(args, "--amend")
+	}
+	cmd := exec.Command("git", args...)
 	output, err := cmd.CombinedOutput()
 	if err != nil {
-		return fmt.Errorf("failed to commit changes: %w\n%s", err, string(output))
+		return string(output), fmt.Errorf("failed to commit changes: %w\n%s", err, string(output))
 	}
-	return nil
+	return string(output), nil
 }
 
 // GetModifiedFiles returns a list of modified files in the git repository
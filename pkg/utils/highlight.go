@@ -0,0 +1,213 @@
+package utils
+
+import (
+	"strings"
+)
+
+// codeLanguage is how the lines of a language are highlighted
+type codeLanguage struct {
+	keywords      map[string]bool
+	lineComments  []string
+	blockComments bool   // Whether /* */ comments are used
+	quotes        string // Characters that quote strings
+}
+
+// keywordSet returns the set of the space separated keywords
+func keywordSet(keywords string) map[string]bool {
+	set := make(map[string]bool)
+	for _, keyword := range strings.Fields(keywords) {
+		set[keyword] = true
+	}
+	return set
+}
+
+var (
+	goLanguage = codeLanguage{
+		keywords: keywordSet(`break case chan const continue default defer else fallthrough for func go goto if
+			import interface map package range return select struct switch type var true false nil iota`),
+		lineComments:  []string{"//"},
+		blockComments: true,
+		quotes:        "\"'`",
+	}
+	pythonLanguage = codeLanguage{
+		keywords: keywordSet(`and as assert async await break class continue def del elif else except finally for
+			from global if import in is lambda nonlocal not or pass raise return try while with yield True False None self`),
+		lineComments: []string{"#"},
+		quotes:       `"'`,
+	}
+	javaScriptLanguage = codeLanguage{
+		keywords: keywordSet(`async await break case catch class const continue default delete do else export
+			extends finally for from function if import in instanceof interface let new of return static super switch
+			this throw try type typeof var void while yield true false null undefined`),
+		lineComments:  []string{"//"},
+		blockComments: true,
+		quotes:        "\"'`",
+	}
+	rustLanguage = codeLanguage{
+		keywords: keywordSet(`as async await break const continue crate dyn else enum extern fn for if impl in let
+			loop match mod move mut pub ref return self Self static struct super trait type unsafe use where while true false`),
+		lineComments:  []string{"//"},
+		blockComments: true,
+		quotes:        `"`,
+	}
+	cLanguage = codeLanguage{
+		keywords: keywordSet(`abstract auto bool break case catch char class const continue default delete do double
+			else enum extends final finally float for fun if implements import int interface long namespace new override
+			package private protected public return short signed sizeof static struct super switch template this throw
+			try typedef union unsigned val var virtual void volatile while true false null nullptr`),
+		lineComments:  []string{"//"},
+		blockComments: true,
+		quotes:        `"'`,
+	}
+	shellLanguage = codeLanguage{
+		keywords: keywordSet(`case do done elif else esac export fi for function if in local return then until while
+			echo cd set unset source exit`),
+		lineComments: []string{"#"},
+		quotes:       `"'`,
+	}
+	sqlLanguage = codeLanguage{
+		keywords: keywordSet(`select from where insert into values update set delete create table drop alter index
+			join left right inner outer on and or not null as group by order having limit primary key foreign references
+			SELECT FROM WHERE INSERT INTO VALUES UPDATE SET DELETE CREATE TABLE DROP ALTER INDEX JOIN LEFT RIGHT INNER
+			OUTER ON AND OR NOT NULL AS GROUP BY ORDER HAVING LIMIT PRIMARY KEY FOREIGN REFERENCES`),
+		lineComments: []string{"--"},
+		quotes:       `"'`,
+	}
+	dataLanguage = codeLanguage{
+		keywords:     keywordSet("true false null"),
+		lineComments: []string{"#"},
+		quotes:       `"'`,
+	}
+	// Languages without rules only highlight strings and numbers
+	plainLanguage = codeLanguage{quotes: `"'`}
+)
+
+// Languages of the code blocks by the names used after the fence
+var codeLanguages = map[string]*codeLanguage{
+	"go":         &goLanguage,
+	"golang":     &goLanguage,
+	"python":     &pythonLanguage,
+	"py":         &pythonLanguage,
+	"javascript": &javaScriptLanguage,
+	"js":         &javaScriptLanguage,
+	"jsx":        &javaScriptLanguage,
+	"typescript": &javaScriptLanguage,
+	"ts":         &javaScriptLanguage,
+	"tsx":        &javaScriptLanguage,
+	"rust":       &rustLanguage,
+	"rs":         &rustLanguage,
+	"c":          &cLanguage,
+	"cpp":        &cLanguage,
+	"c++":        &cLanguage,
+	"java":       &cLanguage,
+	"kotlin":     &cLanguage,
+	"csharp":     &cLanguage,
+	"cs":         &cLanguage,
+	"sh":         &shellLanguage,
+	"bash":       &shellLanguage,
+	"shell":      &shellLanguage,
+	"zsh":        &shellLanguage,
+	"sql":        &sqlLanguage,
+	"json":       &dataLanguage,
+	"yaml":       &dataLanguage,
+	"yml":        &dataLanguage,
+	"toml":       &dataLanguage,
+}
+
+// HighlightCode returns a line of code with its keywords, strings, numbers and comments colored.
+// Lines are highlighted on their own, so strings and comments spanning lines aren't recognized.
+func HighlightCode(line string, language string) string {
+	lang, ok := codeLanguages[strings.ToLower(language)]
+	if !ok {
+		lang = &plainLanguage
+	}
+
+	var out strings.Builder
+	for i := 0; i < len(line); {
+		c := line[i]
+		rest := line[i:]
+
+		// Comments run to the end of the line, or of a block comment
+		if lang.isLineComment(rest) {
+			out.WriteString(ColorGray + rest + ColorReset)
+			break
+		}
+		if lang.blockComments && strings.HasPrefix(rest, "/*") {
+			end := strings.Index(rest[2:], "*/")
+			if end < 0 {
+				end = len(rest)
+			} else {
+				end += 4
+			}
+			out.WriteString(ColorGray + rest[:end] + ColorReset)
+			i += end
+			continue
+		}
+
+		switch {
+		case strings.IndexByte(lang.quotes, c) >= 0:
+			end := quotedEnd(rest)
+			out.WriteString(ColorGreen + rest[:end] + ColorReset)
+			i += end
+		case isDigit(c) && (i == 0 || !isIdentChar(line[i-1])):
+			end := 1
+			for end < len(rest) && (isIdentChar(rest[end]) || rest[end] == '.') {
+				end++
+			}
+			out.WriteString(ColorCyan + rest[:end] + ColorReset)
+			i += end
+		case isIdentChar(c):
+			end := 1
+			for end < len(rest) && isIdentChar(rest[end]) {
+				end++
+			}
+			if lang.keywords[rest[:end]] {
+				out.WriteString(ColorPurple + rest[:end] + ColorReset)
+			} else {
+				out.WriteString(rest[:end])
+			}
+			i += end
+		default:
+			out.WriteByte(c)
+			i++
+		}
+	}
+	return out.String()
+}
+
+// isLineComment returns whether text starts with a line comment
+func (lang *codeLanguage) isLineComment(text string) bool {
+	for _, prefix := range lang.lineComments {
+		if strings.HasPrefix(text, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// quotedEnd returns the end of the string that text starts with, or the length of text if the
+// string isn't closed on the line
+func quotedEnd(text string) int {
+	quote := text[0]
+	for i := 1; i < len(text); i++ {
+		switch text[i] {
+		case '\\':
+			if quote != '`' {
+				i++
+			}
+		case quote:
+			return i + 1
+		}
+	}
+	return len(text)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// isIdentChar returns whether a byte can be part of an identifier, bytes of UTF-8 sequences are
+// treated as letters
+func isIdentChar(c byte) bool {
+	return c == '_' || isDigit(c) || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c >= 0x80
+}
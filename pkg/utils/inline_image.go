@@ -0,0 +1,76 @@
+package utils
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Terminal image protocols
+const (
+	imageProtocolNone   = ""
+	imageProtocolITerm2 = "iterm2"
+	imageProtocolKitty  = "kitty"
+)
+
+// getImageProtocol detects which inline image protocol the terminal supports
+func getImageProtocol() string {
+	if IsOutputPiped() {
+		return imageProtocolNone
+	}
+
+	termProgram := os.Getenv("TERM_PROGRAM")
+	if termProgram == "iTerm.app" || termProgram == "WezTerm" {
+		return imageProtocolITerm2
+	}
+	if os.Getenv("KITTY_WINDOW_ID") != "" || strings.Contains(os.Getenv("TERM"), "kitty") {
+		return imageProtocolKitty
+	}
+	return imageProtocolNone
+}
+
+// SupportsInlineImages returns whether the terminal can display images inline
+func SupportsInlineImages() bool {
+	return getImageProtocol() != imageProtocolNone
+}
+
+// DisplayInlineImage shows an image in the terminal using the iTerm2 or kitty image protocol.
+// It returns false if the terminal does not support inline images or the image format.
+func DisplayInlineImage(data []byte, name string, mimeType string) bool {
+	if !strings.HasPrefix(mimeType, "image/") {
+		return false
+	}
+	encoded := base64.StdEncoding.EncodeToString(data)
+
+	switch getImageProtocol() {
+	case imageProtocolITerm2:
+		fmt.Printf("\033]1337;File=name=%s;size=%d;inline=1;preserveAspectRatio=1:%s\a\n",
+			base64.StdEncoding.EncodeToString([]byte(name)), len(data), encoded)
+		return true
+
+	case imageProtocolKitty:
+		// The kitty protocol only decodes PNG directly, and payloads must be sent in chunks of at most 4096 bytes
+		if mimeType != "image/png" {
+			return false
+		}
+		const chunkSize = 4096
+		for i := 0; i < len(encoded); i += chunkSize {
+			end := i + chunkSize
+			more := 1
+			if end >= len(encoded) {
+				end = len(encoded)
+				more = 0
+			}
+			if i == 0 {
+				fmt.Printf("\033_Ga=T,f=100,m=%d;%s\033\\", more, encoded[i:end])
+			} else {
+				fmt.Printf("\033_Gm=%d;%s\033\\", more, encoded[i:end])
+			}
+		}
+		fmt.Println()
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,258 @@
+package utils
+
+import (
+	"strings"
+)
+
+// MarkdownRenderer renders the Markdown of streamed text for the terminal. Headings, list items,
+// quotes and rules get styled markers, inline code and bold text are colored, and fenced code
+// blocks are syntax highlighted. Text is written as it arrives: only the start of a line is held
+// back until it's clear whether it's a marker, and the lines of code blocks until they're complete.
+type MarkdownRenderer struct {
+	pending    strings.Builder // Text of the line that isn't written yet
+	lineStart  bool            // Whether the pending text starts a line
+	heading    bool            // Whether the current line is a heading
+	inCode     bool            // Whether inside a fenced code block
+	fence      string          // Fence that opened the code block
+	language   string          // Language of the code block
+	inlineCode bool
+	bold       bool
+	star       bool // A '*' that may start "**"
+}
+
+// Kinds of Markdown lines
+type markdownLine int
+
+const (
+	lineText markdownLine = iota
+	lineHeading
+	lineBullet
+	lineNumbered
+	lineQuote
+	lineRule
+	lineFence
+)
+
+// NewMarkdownRenderer creates a Markdown renderer
+func NewMarkdownRenderer() *MarkdownRenderer {
+	return &MarkdownRenderer{lineStart: true}
+}
+
+// Render returns the rendered form of the next chunk of text
+func (r *MarkdownRenderer) Render(text string) string {
+	var out strings.Builder
+	for _, c := range text {
+		switch {
+		case r.inCode:
+			if c == '\n' {
+				r.writeCodeLine(&out, r.pending.String(), true)
+				r.pending.Reset()
+			} else {
+				r.pending.WriteRune(c)
+			}
+		case r.lineStart:
+			if c == '\n' {
+				r.writeLineStart(&out, r.pending.String(), true)
+				r.pending.Reset()
+				r.endLine(&out)
+				continue
+			}
+			r.pending.WriteRune(c)
+			if r.writeLineStart(&out, r.pending.String(), false) {
+				r.pending.Reset()
+			}
+		default:
+			r.writeInline(&out, c)
+		}
+	}
+	return out.String()
+}
+
+// Flush returns the text that is held back and ends the styles, e.g. before other output is
+// written or at the end of a response
+func (r *MarkdownRenderer) Flush() string {
+	var out strings.Builder
+	if r.pending.Len() > 0 {
+		if r.inCode {
+			out.WriteString(HighlightCode(r.pending.String(), r.language))
+		} else {
+			r.writeLineStart(&out, r.pending.String(), true)
+		}
+		r.pending.Reset()
+	}
+	if r.star {
+		out.WriteByte('*')
+		r.star = false
+	}
+	if r.heading || r.bold || r.inlineCode {
+		out.WriteString(ColorReset)
+		r.heading, r.bold, r.inlineCode = false, false, false
+	}
+	return out.String()
+}
+
+// writeLineStart writes the start of a line once its kind is known, and returns whether it was
+// written. A complete line is always written.
+func (r *MarkdownRenderer) writeLineStart(out *strings.Builder, line string, complete bool) bool {
+	trimmed := strings.TrimLeft(line, " \t")
+	indent := line[:len(line)-len(trimmed)]
+	kind, size, decided := classifyMarkdownLine(trimmed, complete)
+	if !decided {
+		return false
+	}
+
+	out.WriteString(indent)
+	rest := trimmed[size:]
+	switch kind {
+	case lineFence:
+		r.inCode = true
+		r.fence = trimmed[:size]
+		r.language = strings.ToLower(strings.TrimSpace(rest))
+		out.WriteString(ColorGray + trimmed + ColorReset)
+		return true
+	case lineRule:
+		out.WriteString(ColorGray + strings.Repeat("─", 40) + ColorReset)
+		r.lineStart = false
+		return true
+	case lineHeading:
+		r.heading = true
+		out.WriteString(r.style())
+	case lineBullet:
+		out.WriteString(ColorCyan + "•" + ColorReset + " ")
+	case lineNumbered:
+		out.WriteString(ColorCyan + strings.TrimSpace(trimmed[:size]) + ColorReset + " ")
+	case lineQuote:
+		out.WriteString(ColorGray + "│" + ColorReset + " ")
+	}
+	r.lineStart = false
+	for _, c := range rest {
+		r.writeInline(out, c)
+	}
+	return true
+}
+
+// writeInline writes a character inside a line, "`" and "**" switch the inline styles
+func (r *MarkdownRenderer) writeInline(out *strings.Builder, c rune) {
+	if r.star {
+		r.star = false
+		if c == '*' {
+			r.bold = !r.bold
+			out.WriteString(ColorReset + r.style())
+			return
+		}
+		out.WriteByte('*')
+	}
+	switch {
+	case c == '\n':
+		r.endLine(out)
+	case c == '`':
+		r.inlineCode = !r.inlineCode
+		out.WriteString(ColorReset + r.style())
+	case c == '*' && !r.inlineCode:
+		r.star = true
+	default:
+		out.WriteRune(c)
+	}
+}
+
+// endLine ends the styles of a line and writes the newline
+func (r *MarkdownRenderer) endLine(out *strings.Builder) {
+	if r.star {
+		out.WriteByte('*')
+		r.star = false
+	}
+	if r.heading || r.bold || r.inlineCode {
+		out.WriteString(ColorReset)
+		r.heading, r.bold, r.inlineCode = false, false, false
+	}
+	out.WriteByte('\n')
+	r.lineStart = !r.inCode
+}
+
+// writeCodeLine writes a line of a code block, the closing fence ends the block
+func (r *MarkdownRenderer) writeCodeLine(out *strings.Builder, line string, complete bool) {
+	trimmed := strings.TrimSpace(line)
+	if complete && len(trimmed) >= len(r.fence) && strings.Trim(trimmed, r.fence[:1]) == "" {
+		r.inCode = false
+		r.lineStart = true
+		out.WriteString(ColorGray + line + ColorReset + "\n")
+		return
+	}
+	out.WriteString(HighlightCode(line, r.language))
+	if complete {
+		out.WriteByte('\n')
+	}
+}
+
+// style returns the escape codes of the current inline styles
+func (r *MarkdownRenderer) style() string {
+	var style string
+	if r.heading {
+		style += ColorBold + ColorCyan
+	}
+	if r.bold {
+		style += ColorBold
+	}
+	if r.inlineCode {
+		style += ColorYellow
+	}
+	return style
+}
+
+// classifyMarkdownLine returns the kind of a line without its indentation and the size of its
+// marker. It isn't decided while the start of an incomplete line may still become a marker.
+func classifyMarkdownLine(line string, complete bool) (markdownLine, int, bool) {
+	if line == "" {
+		return lineText, 0, complete
+	}
+
+	switch c := line[0]; {
+	case c == '`' || c == '~':
+		fence := len(line) - len(strings.TrimLeft(line, string(c)))
+		if fence >= 3 || fence == len(line) {
+			if !complete {
+				return lineText, 0, false
+			}
+			if fence >= 3 {
+				return lineFence, fence, true
+			}
+		}
+	case c == '#':
+		level := len(line) - len(strings.TrimLeft(line, "#"))
+		if level == len(line) {
+			return lineText, 0, complete
+		}
+		if level <= 6 && line[level] == ' ' {
+			return lineHeading, level + 1, true
+		}
+	case c == '-' || c == '*' || c == '_' || c == '+':
+		if strings.Trim(line, string(c)+" ") == "" {
+			if !complete {
+				return lineText, 0, false
+			}
+			if c != '+' && strings.Count(line, string(c)) >= 3 {
+				return lineRule, len(line), true
+			}
+		}
+		if c != '_' && len(line) >= 2 && line[1] == ' ' {
+			return lineBullet, 2, true
+		}
+	case c >= '0' && c <= '9':
+		digits := len(line) - len(strings.TrimLeft(line, "0123456789"))
+		if digits == len(line) || (digits+1 == len(line) && (line[digits] == '.' || line[digits] == ')')) {
+			return lineText, 0, complete
+		}
+		if digits <= 9 && (line[digits] == '.' || line[digits] == ')') && line[digits+1] == ' ' {
+			return lineNumbered, digits + 2, true
+		}
+	case c == '>':
+		if len(line) == 1 {
+			return lineQuote, 1, complete
+		}
+		if line[1] == ' ' {
+			return lineQuote, 2, true
+		}
+		return lineQuote, 1, true
+	}
+	return lineText, 0, true
+}
@@ -0,0 +1,85 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// renderChunks renders text split into chunks of a size, like a streamed response
+func renderChunks(text string, size int) string {
+	renderer := NewMarkdownRenderer()
+	var out strings.Builder
+	for len(text) > 0 {
+		n := min(size, len(text))
+		out.WriteString(renderer.Render(text[:n]))
+		text = text[n:]
+	}
+	out.WriteString(renderer.Flush())
+	return out.String()
+}
+
+func TestMarkdownRendererBlocks(t *testing.T) {
+	input := "# Title\nSome text\n- first\n* second\n12. third\n> quoted\n---\n"
+	expected := ColorBold + ColorCyan + "Title" + ColorReset + "\n" +
+		"Some text\n" +
+		ColorCyan + "•" + ColorReset + " first\n" +
+		ColorCyan + "•" + ColorReset + " second\n" +
+		ColorCyan + "12." + ColorReset + " third\n" +
+		ColorGray + "│" + ColorReset + " quoted\n" +
+		ColorGray + strings.Repeat("─", 40) + ColorReset + "\n"
+
+	// The result doesn't depend on how the text is split into chunks
+	for _, size := range []int{1, 3, len(input)} {
+		assert.Equal(t, expected, renderChunks(input, size), "chunk size %d", size)
+	}
+}
+
+func TestMarkdownRendererInline(t *testing.T) {
+	assert.Equal(t, "Run "+ColorReset+ColorYellow+"go test"+ColorReset+" now\n", renderChunks("Run `go test` now\n", 2))
+	assert.Equal(t, "a "+ColorReset+ColorBold+"bold"+ColorReset+" b\n", renderChunks("a **bold** b\n", 1))
+	// Single stars and markers inside text are kept
+	assert.Equal(t, "2 * 3 - 1\n", renderChunks("2 * 3 - 1\n", 1))
+	assert.Equal(t, "#include <stdio.h>\n", renderChunks("#include <stdio.h>\n", 1))
+	assert.Equal(t, "3.5 is a number\n", renderChunks("3.5 is a number\n", 1))
+	// Styles don't continue on the next line
+	assert.Equal(t, ColorReset+ColorYellow+"open"+ColorReset+"\nnext\n", renderChunks("`open\nnext\n", 1))
+}
+
+func TestMarkdownRendererCodeBlock(t *testing.T) {
+	input := "Code:\n```go\nreturn nil // done\n```\n# After\n"
+	expected := "Code:\n" +
+		ColorGray + "```go" + ColorReset + "\n" +
+		ColorPurple + "return" + ColorReset + " " + ColorPurple + "nil" + ColorReset + " " + ColorGray + "// done" + ColorReset + "\n" +
+		ColorGray + "```" + ColorReset + "\n" +
+		ColorBold + ColorCyan + "After" + ColorReset + "\n"
+	for _, size := range []int{1, 4, len(input)} {
+		assert.Equal(t, expected, renderChunks(input, size), "chunk size %d", size)
+	}
+
+	// Markdown isn't rendered inside code blocks
+	assert.Equal(t, ColorGray+"```"+ColorReset+"\n# not a heading\n", renderChunks("```\n# not a heading\n", 5))
+}
+
+func TestMarkdownRendererFlush(t *testing.T) {
+	renderer := NewMarkdownRenderer()
+	// The start of a line is held back until its kind is known
+	assert.Equal(t, "", renderer.Render("#"))
+	assert.Equal(t, "#", renderer.Flush())
+
+	renderer = NewMarkdownRenderer()
+	assert.Equal(t, "Hello ", renderer.Render("Hello "))
+	assert.Equal(t, ColorReset+ColorBold+"wor", renderer.Render("**wor"))
+	assert.Equal(t, ColorReset, renderer.Flush())
+}
+
+func TestHighlightCode(t *testing.T) {
+	assert.Equal(t, ColorPurple+"def"+ColorReset+" f(x): "+ColorPurple+"return"+ColorReset+" "+ColorGreen+`"#1"`+ColorReset+" "+ColorGray+"# comment"+ColorReset,
+		HighlightCode(`def f(x): return "#1" # comment`, "python"))
+	assert.Equal(t, "x := "+ColorCyan+"42"+ColorReset+" "+ColorGray+"/* n */"+ColorReset+" + y2",
+		HighlightCode("x := 42 /* n */ + y2", "go"))
+	assert.Equal(t, ColorGreen+`"a \" b`+ColorReset, HighlightCode(`"a \" b`, "js"))
+	// Unknown languages only get strings and numbers
+	assert.Equal(t, "if "+ColorCyan+"1"+ColorReset, HighlightCode("if 1", "unknown"))
+}
@@ -0,0 +1,88 @@
+package utils
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// OutputBuffer coalesces small writes, like the chunks of a streamed response, so slow terminals
+// and ssh sessions aren't flooded with tiny writes. Text is written at most every interval or once
+// maxBytes are buffered, and a timer writes what is left when no more text arrives.
+type OutputBuffer struct {
+	out       io.Writer
+	interval  time.Duration
+	maxBytes  int
+	buffer    []byte
+	lastFlush time.Time
+	timer     *time.Timer
+	closed    bool
+	mutex     sync.Mutex
+}
+
+// NewOutputBuffer creates an output buffer writing to out. An interval of 0 disables coalescing.
+func NewOutputBuffer(out io.Writer, interval time.Duration, maxBytes int) *OutputBuffer {
+	return &OutputBuffer{
+		out:      out,
+		interval: interval,
+		maxBytes: maxBytes,
+	}
+}
+
+// WriteString buffers text and writes it when the interval has passed or the buffer is full
+func (b *OutputBuffer) WriteString(text string) {
+	if text == "" {
+		return
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.buffer = append(b.buffer, text...)
+	if b.closed || b.interval <= 0 || len(b.buffer) >= b.maxBytes || time.Since(b.lastFlush) >= b.interval {
+		b.flush()
+		return
+	}
+
+	// Write the rest after the interval unless more text fills the buffer first
+	if b.timer == nil {
+		var timer *time.Timer
+		timer = time.AfterFunc(b.interval-time.Since(b.lastFlush), func() {
+			b.mutex.Lock()
+			defer b.mutex.Unlock()
+			// A flush in the meantime already wrote the text
+			if b.timer == timer {
+				b.flush()
+			}
+		})
+		b.timer = timer
+	}
+}
+
+// Flush writes the buffered text right away, e.g. before other output is printed
+func (b *OutputBuffer) Flush() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.flush()
+}
+
+// Close writes the buffered text, later text is written without buffering
+func (b *OutputBuffer) Close() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.flush()
+	b.closed = true
+}
+
+// flush writes the buffered text, the mutex must be held
+func (b *OutputBuffer) flush() {
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	if len(b.buffer) > 0 {
+		b.out.Write(b.buffer)
+		b.buffer = b.buffer[:0]
+	}
+	b.lastFlush = time.Now()
+}
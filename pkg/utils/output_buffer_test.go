@@ -0,0 +1,99 @@
+package utils
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// syncBuffer is a bytes.Buffer that can be written by the flush timer while the test reads it
+type syncBuffer struct {
+	buffer bytes.Buffer
+	writes int
+	mutex  sync.Mutex
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.writes++
+	return b.buffer.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buffer.String()
+}
+
+func (b *syncBuffer) Writes() int {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.writes
+}
+
+func TestOutputBufferCoalescesWrites(t *testing.T) {
+	out := &syncBuffer{}
+	buffer := NewOutputBuffer(out, time.Hour, 1024)
+
+	// The first chunk is written right away, the following ones wait for the interval
+	buffer.WriteString("Hello")
+	buffer.WriteString(", ")
+	buffer.WriteString("world")
+	assert.Equal(t, "Hello", out.String())
+
+	buffer.Flush()
+	assert.Equal(t, "Hello, world", out.String())
+	assert.Equal(t, 2, out.Writes())
+}
+
+func TestOutputBufferMaxBytes(t *testing.T) {
+	out := &syncBuffer{}
+	buffer := NewOutputBuffer(out, time.Hour, 8)
+
+	buffer.WriteString("a")
+	buffer.WriteString("bcd")
+	assert.Equal(t, "a", out.String())
+
+	// Filling the buffer writes it without waiting for the interval
+	buffer.WriteString("efghijkl")
+	assert.Equal(t, "abcdefghijkl", out.String())
+}
+
+func TestOutputBufferTimer(t *testing.T) {
+	out := &syncBuffer{}
+	buffer := NewOutputBuffer(out, 20*time.Millisecond, 1024)
+
+	buffer.WriteString("first ")
+	buffer.WriteString("second")
+
+	// The rest is written after the interval even if no more text arrives
+	assert.Eventually(t, func() bool { return out.String() == "first second" }, time.Second, 5*time.Millisecond)
+}
+
+func TestOutputBufferClose(t *testing.T) {
+	out := &syncBuffer{}
+	buffer := NewOutputBuffer(out, time.Hour, 1024)
+
+	buffer.WriteString("one ")
+	buffer.WriteString("two")
+	buffer.Close()
+	assert.Equal(t, "one two", out.String())
+
+	// Text written after Close isn't buffered
+	buffer.WriteString(" three")
+	assert.Equal(t, "one two three", out.String())
+}
+
+func TestOutputBufferDisabled(t *testing.T) {
+	out := &syncBuffer{}
+	buffer := NewOutputBuffer(out, 0, 1024)
+
+	buffer.WriteString("a")
+	buffer.WriteString("b")
+	assert.Equal(t, "ab", out.String())
+	assert.Equal(t, 2, out.Writes())
+}
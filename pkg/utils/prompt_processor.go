@@ -11,6 +11,7 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
 	"time"
 
@@ -18,59 +19,161 @@ import (
 	"golang.org/x/net/html"
 )
 
-// ProcessPrompt processes user's prompt, finds text wrapped in backticks and appends the content
-// If the text is a file path, it reads the file content and appends it
-// If the text is a URL, it fetches the web content and appends it
-func ProcessPrompt(prompt string) (string, error) {
-	// Regular expression to match content wrapped in backticks
-	re := regexp.MustCompile("`([^`]+)`")
-	matches := re.FindAllStringSubmatch(prompt, -1)
+// Images larger than this can't be attached to a prompt, providers reject them
+const maxPromptImageSize = 5 * 1024 * 1024
 
-	// If no matches found, return the original prompt
-	if len(matches) == 0 {
-		return prompt, nil
+// Image types that can be attached to prompts, by file extension
+var promptImageTypes = map[string]string{
+	".png":  "image/png",
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".gif":  "image/gif",
+	".webp": "image/webp",
+}
+
+// imageReferenceRegex matches @image:path references in prompts
+var imageReferenceRegex = regexp.MustCompile(`(^|\s)@image:(\S+)`)
+
+// PromptImage is an image attached to a prompt
+type PromptImage struct {
+	Path     string
+	MimeType string
+	Data     []byte
+}
+
+// backtickRegex matches content wrapped in backticks
+var backtickRegex = regexp.MustCompile("`([^`]+)`")
+
+// promptReference is a reference of a prompt, in backticks or mentioned with @
+type promptReference struct {
+	start, end int
+	ref        string
+	strict     bool // Backtick references must resolve, mentions that don't are noted in the prompt
+}
+
+// ProcessPrompt processes user's prompt, finds references to files, directories, URLs and git
+// changes, in backticks or mentioned like @path/to/file, @dir/, @git:staged or @https://..., and
+// appends the content the context providers resolve them to after each reference. A directory adds
+// its file tree and the contents of its files up to a size budget.
+// If a reference is the path of an image, or the prompt references it as @image:path, the image is
+// returned to be attached to the prompt.
+// Backtick references must resolve. Mentions of paths that don't exist are left as they are, and
+// mentions that fail to resolve, like of a missing branch or an unreachable URL, get a note
+// instead of the content.
+func ProcessPrompt(prompt string) (string, []PromptImage, error) {
+	var images []PromptImage
+
+	// Attach images referenced as @image:path, the reference stays in the prompt so the model
+	// knows which image is which
+	for _, match := range imageReferenceRegex.FindAllStringSubmatch(prompt, -1) {
+		image, err := readPromptImage(match[2])
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to read image: %v", err)
+		}
+		images = append(images, image)
 	}
 
-	// Process each match
-	for _, match := range matches {
-		if len(match) < 2 {
+	var refs []promptReference
+	for _, loc := range backtickRegex.FindAllStringSubmatchIndex(prompt, -1) {
+		refs = append(refs, promptReference{start: loc[0], end: loc[1], ref: prompt[loc[2]:loc[3]], strict: true})
+	}
+	for _, loc := range mentionRegex.FindAllStringSubmatchIndex(prompt, -1) {
+		ref, ok := mentionTarget(prompt[loc[4]:loc[5]])
+		if !ok || insideReference(refs, loc[4]) {
 			continue
 		}
-
-		content := match[1]
-		appendContent := ""
+		refs = append(refs, promptReference{start: loc[4] - 1, end: loc[4] + len(ref), ref: ref})
+	}
+	sort.Slice(refs, func(i, j int) bool {
+		return refs[i].start < refs[j].start
+	})
+
+	// The content is inserted in one pass over the prompt, so references in the added content
+	// aren't resolved
+	var result strings.Builder
+	last := 0
+	for _, ref := range refs {
+		var content string
 		var err error
-
-		// Determine if the content is a file path or URL
-		if IsURL(content) {
-			// Process URL
-			appendContent, err = FetchWebContent(content)
-			if err != nil {
-				return "", fmt.Errorf("failed to fetch web content: %v", err)
+		if IsImagePath(ref.ref) && !IsURL(ref.ref) {
+			// Images are attached instead of appended
+			var image PromptImage
+			if image, err = readPromptImage(ref.ref); err == nil {
+				images = append(images, image)
+				continue
 			}
-			appendContent = "Web content:\n" + appendContent
+			err = fmt.Errorf("failed to read image: %v", err)
 		} else {
-			// Process file path
-			appendContent, err = readFileContent(content)
-			if err != nil {
-				return "", fmt.Errorf("failed to read file content: %v", err)
+			content, err = resolveReference(ref.ref)
+		}
+		if err != nil {
+			if ref.strict {
+				return "", nil, err
 			}
-			appendContent = "File content:\n" + appendContent
+			content = fmt.Sprintf("[@%s was not added: %v]", ref.ref, err)
 		}
-
 		// Append the content to the prompt instead of replacing
-		prompt = strings.Replace(prompt, match[0], match[0]+"\n\n"+appendContent+"\n\n", 1)
+		result.WriteString(prompt[last:ref.end])
+		result.WriteString("\n\n" + content + "\n\n")
+		last = ref.end
 	}
+	result.WriteString(prompt[last:])
 
-	return prompt, nil
+	return result.String(), images, nil
 }
 
-func HasBackticks(prompt string) bool {
-	// Regular expression to match content wrapped in backticks
-	re := regexp.MustCompile("`([^`]+)`")
-	matches := re.FindAllStringSubmatch(prompt, -1)
+// insideReference returns whether a position of the prompt is inside one of the references
+func insideReference(refs []promptReference, pos int) bool {
+	for _, ref := range refs {
+		if pos >= ref.start && pos < ref.end {
+			return true
+		}
+	}
+	return false
+}
 
-	return len(matches) > 0
+// HasImageReferences returns whether the prompt references images as @image:path
+func HasImageReferences(prompt string) bool {
+	return imageReferenceRegex.MatchString(prompt)
+}
+
+// IsImagePath returns whether a path has the extension of an image type that can be attached to prompts
+func IsImagePath(path string) bool {
+	_, ok := promptImageTypes[strings.ToLower(filepath.Ext(path))]
+	return ok
+}
+
+// readPromptImage reads an image to attach to a prompt, its content must match its extension
+func readPromptImage(path string) (PromptImage, error) {
+	mimeType, ok := promptImageTypes[strings.ToLower(filepath.Ext(path))]
+	if !ok {
+		return PromptImage{}, fmt.Errorf("unsupported image type (use PNG, JPEG, GIF or WebP): %s", path)
+	}
+
+	fileInfo, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return PromptImage{}, fmt.Errorf("file does not exist: %s", path)
+	} else if err != nil {
+		return PromptImage{}, err
+	}
+	if fileInfo.Size() > maxPromptImageSize {
+		return PromptImage{}, fmt.Errorf("image too large (max %s): %s (%s)", FormatSize(maxPromptImageSize), path, FormatSize(fileInfo.Size()))
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return PromptImage{}, fmt.Errorf("failed to read file: %v", err)
+	}
+	if detected := http.DetectContentType(data); detected != mimeType {
+		return PromptImage{}, fmt.Errorf("%s is not a valid %s image", path, strings.TrimPrefix(mimeType, "image/"))
+	}
+
+	return PromptImage{Path: path, MimeType: mimeType, Data: data}, nil
+}
+
+// HasBackticks returns whether the prompt has content wrapped in backticks
+func HasBackticks(prompt string) bool {
+	return backtickRegex.MatchString(prompt)
 }
 
 // IsURL determines if a string is a URL
@@ -79,7 +182,16 @@ func IsURL(str string) bool {
 	return err == nil && u.Scheme != "" && u.Host != ""
 }
 
-// readFileContent reads the content of a file
+// Limits of the files added to prompts
+const (
+	// maxPromptFileSize is the size of the largest file that can be added to a prompt
+	maxPromptFileSize = 16 * 1024 * 1024
+	// maxPromptFileContent limits the content added for a file, larger files are truncated
+	maxPromptFileContent = 64 * 1024
+)
+
+// readFileContent reads the content of a file. The middle of files larger than 64KB is left out,
+// with a notice of the lines to read with read_file.
 func readFileContent(filePath string) (string, error) {
 	// Get absolute path
 	absPath, err := filepath.Abs(filePath)
@@ -98,9 +210,8 @@ func readFileContent(filePath string) (string, error) {
 		return "", err
 	}
 
-	// Check if file size exceeds 64KB (64 * 1024 = 65536 bytes)
-	if fileInfo.Size() > 65536 {
-		return "", fmt.Errorf("file too large (max 64KB): %s (%d bytes)", absPath, fileInfo.Size())
+	if fileInfo.Size() > maxPromptFileSize {
+		return "", fmt.Errorf("file too large (max %s): %s (%s)", FormatSize(maxPromptFileSize), absPath, FormatSize(fileInfo.Size()))
 	}
 
 	// Read file content
@@ -114,7 +225,13 @@ func readFileContent(filePath string) (string, error) {
 		return "", fmt.Errorf("cannot read BINARY file: %s", absPath)
 	}
 
-	return string(content), nil
+	truncated, ok := TruncateMiddle(string(content), maxPromptFileContent)
+	if !ok {
+		return string(content), nil
+	}
+	notice := fmt.Sprintf("\n[File truncated: lines %d-%d of %d (%s) are not shown. Read them with read_file, using offset %d and limit to page through them]\n\n",
+		truncated.FirstOmittedLine, truncated.LastOmittedLine, truncated.TotalLines, FormatSize(fileInfo.Size()), truncated.FirstOmittedLine)
+	return truncated.Head + notice + truncated.Tail, nil
 }
 
 // isTextFileExtension checks if the file has a known text file extension
@@ -302,8 +419,18 @@ func FetchWebContent(urlStr string) (string, error) {
 	// Create a new reader that combines the preview and the rest of the content
 	combinedReader := io.MultiReader(bytes.NewReader(previewBuffer), reader)
 
+	return htmlReaderToMarkdown(combinedReader)
+}
+
+// HTMLToMarkdown converts an HTML document to markdown text
+func HTMLToMarkdown(document string) (string, error) {
+	return htmlReaderToMarkdown(strings.NewReader(document))
+}
+
+// htmlReaderToMarkdown parses HTML and extracts its text content as markdown
+func htmlReaderToMarkdown(reader io.Reader) (string, error) {
 	// Parse HTML
-	doc, err := html.Parse(combinedReader)
+	doc, err := html.Parse(reader)
 	if err != nil {
 		return "", err
 	}
@@ -313,9 +440,7 @@ func FetchWebContent(urlStr string) (string, error) {
 	extractText(doc, &textContent)
 
 	// Clean up the text by removing excessive whitespace
-	result := cleanText(textContent.String())
-
-	return result, nil
+	return cleanText(textContent.String()), nil
 }
 
 // isBinaryContentType checks if the content type indicates binary data
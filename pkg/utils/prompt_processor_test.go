@@ -105,7 +105,7 @@ func TestProcessPrompt(t *testing.T) {
 	// Run tests
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result, err := ProcessPrompt(tt.prompt)
+			result, _, err := ProcessPrompt(tt.prompt)
 
 			// Check for errors
 			if (err != nil) != tt.expectError {
@@ -135,6 +135,51 @@ func TestProcessPrompt(t *testing.T) {
 	}
 }
 
+// TestProcessPromptImages tests attaching images referenced as @image:path or in backticks
+func TestProcessPromptImages(t *testing.T) {
+	tempDir := t.TempDir()
+	pngData := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	pngPath := filepath.Join(tempDir, "screenshot.png")
+	if err := os.WriteFile(pngPath, pngData, 0644); err != nil {
+		t.Fatalf("Failed to create test image: %v", err)
+	}
+	fakePath := filepath.Join(tempDir, "fake.jpg")
+	if err := os.WriteFile(fakePath, []byte("not an image"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	prompt := "Why is the button cut off? @image:" + pngPath + " and `" + pngPath + "`"
+	if !HasImageReferences(prompt) {
+		t.Errorf("HasImageReferences() = false, expected true")
+	}
+	result, images, err := ProcessPrompt(prompt)
+	if err != nil {
+		t.Fatalf("ProcessPrompt() error = %v", err)
+	}
+	if result != prompt {
+		t.Errorf("ProcessPrompt() changed the prompt: %q", result)
+	}
+	if len(images) != 2 {
+		t.Fatalf("ProcessPrompt() returned %d images, expected 2", len(images))
+	}
+	if images[0].Path != pngPath || images[0].MimeType != "image/png" || !bytes.Equal(images[0].Data, pngData) {
+		t.Errorf("ProcessPrompt() returned unexpected image: %+v", images[0])
+	}
+
+	if HasImageReferences("mail me at me@image:x") {
+		t.Errorf("HasImageReferences() = true for a reference inside a word")
+	}
+	if _, _, err := ProcessPrompt("@image:" + fakePath); err == nil {
+		t.Errorf("ProcessPrompt() expected an error for an invalid image")
+	}
+	if _, _, err := ProcessPrompt("@image:" + filepath.Join(tempDir, "missing.png")); err == nil {
+		t.Errorf("ProcessPrompt() expected an error for a missing image")
+	}
+	if _, _, err := ProcessPrompt("@image:" + filepath.Join(tempDir, "diagram.svg")); err == nil {
+		t.Errorf("ProcessPrompt() expected an error for an unsupported image type")
+	}
+}
+
 // TestFetchWebContent tests the FetchWebContent function directly
 func TestFetchWebContent(t *testing.T) {
 	// Setup test HTTP server
@@ -2,6 +2,7 @@ package utils
 
 import (
 	"os"
+	"os/exec"
 	"runtime"
 
 	"github.com/joho/godotenv"
@@ -91,3 +92,57 @@ func GetShell() string {
 	// On macOS/Linux, fall back to POSIX shell
 	return ShellPaths.Fallback
 }
+
+// Kinds of shells that commands are run with
+const (
+	ShellKindPOSIX      = "posix"
+	ShellKindPowerShell = "powershell"
+	ShellKindCmd        = "cmd"
+)
+
+// lookPath finds a program on the PATH, tests replace it
+var lookPath = exec.LookPath
+
+// GetCommandShell returns the shell commands are run with and its kind. On Windows that's
+// PowerShell, which has aliases for most common Unix commands, or cmd without it. Elsewhere it's
+// bash, or the POSIX shell without it, rather than the login shell whose syntax may differ.
+func GetCommandShell() (string, string) {
+	return commandShellFor(runtime.GOOS)
+}
+
+// commandShellFor returns the command shell and its kind on an operating system
+func commandShellFor(goos string) (string, string) {
+	if goos == "windows" {
+		for _, name := range []string{"pwsh.exe", "powershell.exe"} {
+			if path, err := lookPath(name); err == nil {
+				return path, ShellKindPowerShell
+			}
+		}
+		if comspec := os.Getenv("COMSPEC"); comspec != "" {
+			return comspec, ShellKindCmd
+		}
+		return ShellPaths.CMD, ShellKindCmd
+	}
+
+	if path, err := lookPath("bash"); err == nil {
+		return path, ShellKindPOSIX
+	}
+	return ShellPaths.Fallback, ShellKindPOSIX
+}
+
+// ShellArgs returns the program and arguments that run a command line with a shell of a kind
+func ShellArgs(shell string, kind string, command string) []string {
+	switch kind {
+	case ShellKindPowerShell:
+		return []string{shell, "-NoProfile", "-NonInteractive", "-Command", command}
+	case ShellKindCmd:
+		return []string{shell, "/C", command}
+	}
+	return []string{shell, "-c", command}
+}
+
+// ShellCommand returns the program and arguments that run a command line with the command shell
+func ShellCommand(command string) []string {
+	shell, kind := GetCommandShell()
+	return ShellArgs(shell, kind, command)
+}
@@ -0,0 +1,45 @@
+package utils
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommandShellFor(t *testing.T) {
+	available := map[string]string{}
+	original := lookPath
+	lookPath = func(name string) (string, error) {
+		if path, ok := available[name]; ok {
+			return path, nil
+		}
+		return "", errors.New("not found")
+	}
+	defer func() { lookPath = original }()
+
+	t.Setenv("COMSPEC", `C:\Windows\system32\cmd.exe`)
+	shell, kind := commandShellFor("windows")
+	assert.Equal(t, `C:\Windows\system32\cmd.exe`, shell)
+	assert.Equal(t, ShellKindCmd, kind)
+
+	available["powershell.exe"] = `C:\WindowsPowerShell\powershell.exe`
+	shell, kind = commandShellFor("windows")
+	assert.Equal(t, `C:\WindowsPowerShell\powershell.exe`, shell)
+	assert.Equal(t, ShellKindPowerShell, kind)
+
+	shell, kind = commandShellFor("linux")
+	assert.Equal(t, ShellPaths.Fallback, shell)
+	assert.Equal(t, ShellKindPOSIX, kind)
+
+	available["bash"] = "/usr/bin/bash"
+	shell, _ = commandShellFor("darwin")
+	assert.Equal(t, "/usr/bin/bash", shell)
+}
+
+func TestShellArgs(t *testing.T) {
+	assert.Equal(t, []string{"/bin/bash", "-c", "ls | wc -l"}, ShellArgs("/bin/bash", ShellKindPOSIX, "ls | wc -l"))
+	assert.Equal(t, []string{"cmd.exe", "/C", "dir"}, ShellArgs("cmd.exe", ShellKindCmd, "dir"))
+	assert.Equal(t, []string{"pwsh.exe", "-NoProfile", "-NonInteractive", "-Command", "Get-ChildItem"},
+		ShellArgs("pwsh.exe", ShellKindPowerShell, "Get-ChildItem"))
+}
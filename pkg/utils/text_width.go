@@ -0,0 +1,80 @@
+package utils
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Ranges of East Asian wide and fullwidth characters (CJK, Hangul, fullwidth forms, emoji),
+// which take up two terminal columns
+var wideRuneRanges = []struct{ first, last rune }{
+	{0x1100, 0x115F},
+	{0x2E80, 0x303E},
+	{0x3041, 0x33FF},
+	{0x3400, 0x4DBF},
+	{0x4E00, 0x9FFF},
+	{0xA000, 0xA4CF},
+	{0xAC00, 0xD7A3},
+	{0xF900, 0xFAFF},
+	{0xFE30, 0xFE4F},
+	{0xFF00, 0xFF60},
+	{0xFFE0, 0xFFE6},
+	{0x1F300, 0x1F64F},
+	{0x1F900, 0x1F9FF},
+	{0x20000, 0x2FFFD},
+	{0x30000, 0x3FFFD},
+}
+
+// RuneWidth returns the number of terminal columns a rune takes up
+func RuneWidth(r rune) int {
+	if r == 0 || unicode.IsControl(r) || unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf) {
+		return 0
+	}
+	for _, wide := range wideRuneRanges {
+		if r >= wide.first && r <= wide.last {
+			return 2
+		}
+	}
+	return 1
+}
+
+// StringWidth returns the number of terminal columns a string takes up
+func StringWidth(s string) int {
+	width := 0
+	for _, r := range s {
+		width += RuneWidth(r)
+	}
+	return width
+}
+
+// TruncateToWidth cuts a string to at most width terminal columns without splitting runes
+func TruncateToWidth(s string, width int) string {
+	used := 0
+	for i, r := range s {
+		runeWidth := RuneWidth(r)
+		if used+runeWidth > width {
+			return s[:i]
+		}
+		used += runeWidth
+	}
+	return s
+}
+
+// Ellipsize shortens a string to width terminal columns, ending it with "..." if it was cut
+func Ellipsize(s string, width int) string {
+	if StringWidth(s) <= width {
+		return s
+	}
+	if width <= 3 {
+		return TruncateToWidth(s, width)
+	}
+	return TruncateToWidth(s, width-3) + "..."
+}
+
+// PadRight pads a string with spaces to width terminal columns, like %-*s does for ASCII text
+func PadRight(s string, width int) string {
+	if padding := width - StringWidth(s); padding > 0 {
+		return s + strings.Repeat(" ", padding)
+	}
+	return s
+}
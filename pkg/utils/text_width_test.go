@@ -0,0 +1,47 @@
+package utils
+
+import (
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStringWidth(t *testing.T) {
+	assert.Equal(t, 5, StringWidth("hello"))
+	assert.Equal(t, 4, StringWidth("你好"))
+	assert.Equal(t, 6, StringWidth("한국어"))
+	assert.Equal(t, 4, StringWidth("café"))
+	// Combining marks take up no columns
+	assert.Equal(t, 4, StringWidth("cafe\u0301"))
+	assert.Equal(t, 0, StringWidth(""))
+}
+
+func TestTruncateToWidth(t *testing.T) {
+	assert.Equal(t, "hel", TruncateToWidth("hello", 3))
+	assert.Equal(t, "hello", TruncateToWidth("hello", 10))
+	// A wide rune that doesn't fit is left out instead of split
+	assert.Equal(t, "你", TruncateToWidth("你好世界", 3))
+	assert.Equal(t, "你好", TruncateToWidth("你好世界", 4))
+	assert.Equal(t, "", TruncateToWidth("你好", 1))
+
+	for width := 0; width < 12; width++ {
+		truncated := TruncateToWidth("a你b好c世界", width)
+		assert.True(t, utf8.ValidString(truncated))
+		assert.LessOrEqual(t, StringWidth(truncated), width)
+	}
+}
+
+func TestEllipsize(t *testing.T) {
+	assert.Equal(t, "short", Ellipsize("short", 10))
+	assert.Equal(t, "a long...", Ellipsize("a long prompt", 9))
+	assert.Equal(t, "你好...", Ellipsize("你好世界你好世界", 8))
+	assert.Equal(t, "你...", Ellipsize("你好世界你好世界", 6))
+	assert.Equal(t, "ab", Ellipsize("abcdef", 2))
+}
+
+func TestPadRight(t *testing.T) {
+	assert.Equal(t, "ab   ", PadRight("ab", 5))
+	assert.Equal(t, "你好 ", PadRight("你好", 5))
+	assert.Equal(t, "toolong", PadRight("toolong", 3))
+}